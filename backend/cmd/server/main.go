@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,97 +16,304 @@ import (
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
-	"golang.org/x/time/rate"
 
 	"vws-backend/config"
+	"vws-backend/internal/api"
+	"vws-backend/internal/auth"
 	analyticsHandler "vws-backend/internal/handler/analytics"
 	enterpriseHandler "vws-backend/internal/handler/enterprise"
 	faceHandler "vws-backend/internal/handler/face"
+	healthHandler "vws-backend/internal/handler/health"
 	tokenHandler "vws-backend/internal/handler/token"
 	userHandler "vws-backend/internal/handler/user"
 	verificationHandler "vws-backend/internal/handler/verification"
+	"vws-backend/internal/health"
+	"vws-backend/internal/idempotency"
+	"vws-backend/internal/logging"
+	"vws-backend/internal/metrics"
 	"vws-backend/internal/middleware"
+	"vws-backend/internal/migrate"
+	"vws-backend/internal/openapi"
+	"vws-backend/internal/ratelimit"
 	analyticsService "vws-backend/internal/service/analytics"
 	enterpriseService "vws-backend/internal/service/enterprise"
 	faceService "vws-backend/internal/service/face"
 	tokenService "vws-backend/internal/service/token"
 	userService "vws-backend/internal/service/user"
 	verificationService "vws-backend/internal/service/verification"
+	"vws-backend/internal/store/memory"
+	"vws-backend/internal/store/postgres"
+	"vws-backend/internal/tracing"
+	"vws-backend/migrations"
 )
 
 func main() {
 	// Load configuration
-	cfg, err := config.LoadConfig("config/config.json")
+	loadOptions := config.Options{Path: "config/config.json", Args: os.Args[1:]}
+	cfg, args, err := config.Load(loadOptions)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		cfg = config.GetConfig() // Use default config
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Initialize logging
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(logging.ParseLevel(cfg.Logging.Level))
+	logger := logging.New(os.Stdout, logLevel)
+	slog.SetDefault(logger)
+
+	if len(args) > 0 && args[0] == "migrate" {
+		os.Exit(runMigrate(cfg, args[1:]))
 	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	store := config.NewStore(cfg, func() (*config.Config, error) {
+		cfg, _, err := config.Load(loadOptions)
+		return cfg, err
+	})
 
-	// Initialize database
-	db, err := sql.Open("postgres", cfg.Database.URL)
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
+	// Initialize storage
+	var (
+		repos            repositories
+		idempotencyStore idempotency.Store
+		db               *sql.DB
+		migrator         *migrate.Migrator
+	)
+	if cfg.Database.Backend == "memory" {
+		slog.Warn("using the in-memory store, data is lost on exit")
+		repos = memory.New()
+		idempotencyStore = idempotency.NewMemoryStore()
+	} else {
+		db, err = tracing.OpenDB("postgres", cfg.Database.URL)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer db.Close()
+		if err := metrics.RegisterDBStats(db, "vws"); err != nil {
+			log.Fatalf("Failed to register database metrics: %v", err)
+		}
+
+		migrator, err = migrate.New(db, migrations.FS)
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		if cfg.Database.AutoMigrate {
+			applied, err := migrator.Up(context.Background())
+			if err != nil && err != migrate.ErrNoChange {
+				log.Fatalf("Failed to migrate database: %v", err)
+			}
+			slog.Info("database migrated", "applied", applied, "version", migrator.Latest())
+		}
+		repos = postgres.New(db)
+		idempotencyStore = idempotency.NewPostgresStore(db)
 	}
-	defer db.Close()
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+	go idempotency.Sweep(sweepCtx, idempotencyStore, time.Hour)
 
 	// Initialize router
-	router := gin.Default()
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	// Initialize middleware
-	rateLimiter := middleware.NewRateLimiter(
-		rate.Limit(cfg.Security.RequestsPerWindow),
-		int(cfg.Security.RateWindow.Seconds()),
-	)
+	rateLimitStore, err := newRateLimitStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limit store: %v", err)
+	}
+	defer rateLimitStore.Close()
+
+	rateLimiter := middleware.NewRateLimiter(rateLimitStore)
+	rateLimiter.SetDefaultRate(defaultRate(cfg))
+	rateLimiter.SetRoutePolicies(routeRatePolicies(cfg.Security.RateLimits))
+	enterpriseSvc := enterpriseService.NewService(repos.Enterprise())
+	cors := middleware.NewCORSHandler(corsConfig(cfg, enterpriseSvc))
 	router.Use(
-		middleware.CORS(),
-		middleware.Logger(),
-		rateLimiter.RateLimit(),
+		tracing.Middleware(),
+		middleware.Logger(logger),
+		middleware.Metrics(),
+		gin.Recovery(),
+		// Limited by IP before CORS answers preflight requests, so they count too
+		rateLimiter.RateLimit(middleware.RatePolicy{
+			Name:  "ip",
+			KeyBy: []middleware.KeyFunc{middleware.KeyByIP},
+		}),
+		cors.Handle,
 	)
+	// The validator only sees routes registered after it
+	spec := openapi.New(api.Info)
+	if cfg.Server.ValidateAPI {
+		router.Use(spec.Validate(func(c *gin.Context, err error) {
+			logging.FromContext(c.Request.Context()).Error("response does not match the API document", "error", err)
+		}))
+	}
+	// Errors answers for handlers, so the validator sees its responses
+	router.Use(middleware.Errors())
+	principalRateLimit := rateLimiter.RateLimit(middleware.RatePolicy{
+		Name:  "principal",
+		KeyBy: []middleware.KeyFunc{middleware.KeyByAPIKey, middleware.KeyByUser},
+	})
+
+	// Initialize authentication
+	tokenManager, err := auth.NewTokenManager(cfg.Security.JWTSecret, cfg.Security.TokenExpiry, cfg.Security.JWTIssuer)
+	if err != nil {
+		log.Fatalf("Failed to initialize token manager: %v", err)
+	}
 
 	// Initialize services
-	faceDetectionService, err := faceService.NewService(cfg.FaceDetection.ModelPath)
+	faceDetectionService, err := faceService.NewService(cfg.FaceDetection.ModelPath, faceThresholds(cfg))
 	if err != nil {
 		log.Fatalf("Failed to initialize face detection service: %v", err)
 	}
 	defer faceDetectionService.Close()
+	faceDetectionService.SetLivenessThreshold(float32(cfg.FaceDetection.LivenessThreshold))
+	faceVerifier, err := faceService.NewVerifier(faceDetectionService, repos.Faces(),
+		cfg.FaceDetection.RecognitionModelPath, float32(cfg.FaceDetection.MatchThreshold))
+	if err != nil {
+		log.Fatalf("Failed to initialize face verification: %v", err)
+	}
+	defer faceVerifier.Close()
+	faceVerifier.SetRequireLiveness(cfg.FaceDetection.RequireLiveness)
+	faceVerifier.SetDuplicateThreshold(float32(cfg.FaceDetection.DuplicateThreshold))
+	// Indexing many faces takes a while; the readiness check waits for it
+	go func() {
+		start := time.Now()
+		if err := faceVerifier.LoadIndex(context.Background()); err != nil {
+			slog.Error("face index not loaded", "error", err)
+			return
+		}
+		slog.Info("face index loaded", "duration", time.Since(start))
+	}()
 
-	userSvc := userService.NewService(db)
-	tokenSvc := tokenService.NewService(db)
-	verificationSvc, err := verificationService.NewService(db, cfg.Blockchain.NetworkURL, cfg.Blockchain.ContractAddr)
+	userSvc := userService.NewService(repos.Users())
+	tokenSvc := tokenService.NewService(repos.Tokens(), repos.Faces())
+	verificationSvc, err := verificationService.NewService(repos.Verification(), cfg.Blockchain.NetworkURL, cfg.Blockchain.ContractAddr)
 	if err != nil {
 		log.Fatalf("Failed to initialize verification service: %v", err)
 	}
 	defer verificationSvc.Close()
 
-	analyticsSvc := analyticsService.NewService(db)
-	enterpriseSvc := enterpriseService.NewService(db)
+	analyticsSvc := analyticsService.NewService(repos.Analytics())
+
+	// Apply configuration reloads to the components that support them
+	store.Subscribe(func(cfg *config.Config) {
+		logLevel.Set(logging.ParseLevel(cfg.Logging.Level))
+		rateLimiter.SetDefaultRate(defaultRate(cfg))
+		rateLimiter.SetRoutePolicies(routeRatePolicies(cfg.Security.RateLimits))
+		cors.Update(corsConfig(cfg, enterpriseSvc))
+		if err := faceDetectionService.SetModelPath(cfg.FaceDetection.ModelPath); err != nil {
+			slog.Error("face model not switched", "path", cfg.FaceDetection.ModelPath, "error", err)
+		}
+		faceDetectionService.SetThresholds(faceThresholds(cfg))
+		faceDetectionService.SetLivenessThreshold(float32(cfg.FaceDetection.LivenessThreshold))
+		if err := faceVerifier.SetModelPath(cfg.FaceDetection.RecognitionModelPath); err != nil {
+			slog.Error("face recognition model not switched", "path", cfg.FaceDetection.RecognitionModelPath, "error", err)
+		}
+		faceVerifier.SetThreshold(float32(cfg.FaceDetection.MatchThreshold))
+		faceVerifier.SetRequireLiveness(cfg.FaceDetection.RequireLiveness)
+		faceVerifier.SetDuplicateThreshold(float32(cfg.FaceDetection.DuplicateThreshold))
+	})
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go store.Watch(reloadCtx, hup, cfg.Reload.WatchInterval)
+
+	// White label domains are loaded up front rather than looked up per request
+	if err := cors.LoadDomains(reloadCtx); err != nil {
+		slog.Error("cors domains not loaded", "error", err)
+	}
+	go cors.WatchDomains(reloadCtx, cfg.Security.CORS.DomainReload)
 
-	// Initialize handlers
-	faceDetectionHandler := faceHandler.NewHandler(faceDetectionService)
-	userHandler := userHandler.NewHandler(userSvc)
-	tokenHandler := tokenHandler.NewHandler(tokenSvc)
-	verificationHandler := verificationHandler.NewHandler(verificationSvc)
-	analyticsHandler := analyticsHandler.NewHandler(analyticsSvc)
-	enterpriseHandler := enterpriseHandler.NewHandler(enterpriseSvc)
+	// Initialize readiness checks
+	checker := health.NewChecker(cfg.Health.CacheTTL)
+	if db != nil {
+		checker.Add("database", cfg.Health.CheckTimeout, health.Database(db))
+		checker.Add("migrations", cfg.Health.CheckTimeout, health.Migrations(db, migrator.Latest()))
+	}
+	checker.Add("ethereum", cfg.Health.CheckTimeout, health.Chain(verificationSvc, cfg.Blockchain.ChainID, cfg.Health.MaxBlockAge))
+	checker.Add("face_model", cfg.Health.CheckTimeout, health.Ready(faceDetectionService.Ready))
+	checker.Add("face_recognition_model", cfg.Health.CheckTimeout, health.Ready(faceVerifier.Ready))
+	checker.Add("face_index", cfg.Health.CheckTimeout, health.Ready(faceVerifier.IndexReady))
 
 	// Register routes
-	initializeRoutes(router, faceDetectionHandler, userHandler, tokenHandler, verificationHandler, analyticsHandler, enterpriseHandler)
+	authMiddleware := middleware.Auth(tokenManager, userSvc)
+	idempotent := middleware.Idempotency(idempotencyStore, middleware.IdempotencyConfig{
+		Routes:      api.IdempotentRoutes,
+		TTL:         cfg.Security.IdempotencyTTL,
+		LockTimeout: cfg.Security.IdempotencyLockTimeout,
+	})
+	protected := []gin.HandlerFunc{authMiddleware, principalRateLimit, idempotent}
+	enterpriseProtected := []gin.HandlerFunc{middleware.APIKeyAuth(enterpriseSvc, authMiddleware), principalRateLimit, idempotent}
+	uploads := faceHandler.UploadConfig{
+		MaxFileSize:  cfg.FaceDetection.MaxFileSize,
+		AllowedTypes: cfg.FaceDetection.AllowedTypes,
+		MaxPixels:    cfg.FaceDetection.MaxPixels,
+	}
+	err = api.Register(router, spec, protected, enterpriseProtected, api.Handlers{
+		Health:       healthHandler.NewHandler(checker),
+		Face:         faceHandler.NewHandler(faceDetectionService, faceVerifier, userSvc, uploads),
+		User:         userHandler.NewHandler(userSvc, tokenManager, cfg.Security.RefreshExpiry),
+		Token:        tokenHandler.NewHandler(tokenSvc),
+		Verification: verificationHandler.NewHandler(verificationSvc),
+		Analytics:    analyticsHandler.NewHandler(analyticsSvc),
+		Enterprise:   enterpriseHandler.NewHandler(enterpriseSvc),
+	})
+	if err != nil {
+		log.Fatalf("Failed to document routes: %v", err)
+	}
 
 	// Configure server
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
 		Handler:      router,
 		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  15 * time.Second,
+	}
+
+	// Metrics are scraped on an internal listener, never the public port
+	metricsSrv := &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Server.MetricsHost, cfg.Server.MetricsPort),
+		Handler:      metrics.Handler(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  15 * time.Second,
 	}
 
 	// Graceful shutdown
-	go func() {
-		// Service connections
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
-		}
-	}()
+	for _, s := range []*http.Server{srv, metricsSrv} {
+		go func() {
+			// Service connections
+			if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("listen: %s\n", err)
+			}
+		}()
+	}
 
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
@@ -118,38 +328,95 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	if err := metricsSrv.Shutdown(ctx); err != nil {
+		log.Fatal("Metrics server forced to shutdown:", err)
+	}
 
 	log.Println("Server exiting")
 }
 
-func initializeRoutes(router *gin.Engine, faceDetectionHandler *faceHandler.Handler, userHandler *userHandler.Handler, tokenHandler *tokenHandler.Handler, verificationHandler *verificationHandler.Handler, analyticsHandler *analyticsHandler.Handler, enterpriseHandler *enterpriseHandler.Handler) {
-	// API routes
-	api := router.Group("/api")
-	{
-		// Public routes
-		api.GET("/health", func(c *gin.Context) {
-			c.JSON(200, gin.H{
-				"status": "ok",
-			})
+// repositories is a storage backend, see internal/store
+type repositories interface {
+	Users() userService.Repository
+	Tokens() tokenService.Repository
+	Verification() verificationService.Repository
+	Faces() faceService.Repository
+	Analytics() analyticsService.Repository
+	Enterprise() enterpriseService.Repository
+}
+
+// rateLimitStore is a rate limit store that holds resources
+type rateLimitStore interface {
+	ratelimit.Store
+	Close() error
+}
+
+// newRateLimitStore shares rate limits through Redis when configured and
+// falls back to process memory otherwise
+func newRateLimitStore(cfg *config.Config) (rateLimitStore, error) {
+	if cfg.Cache.RedisURL != "" {
+		return ratelimit.NewRedisStoreFromURL(cfg.Cache.RedisURL)
+	}
+	return ratelimit.NewMemoryStore(time.Minute), nil
+}
+
+// corsConfig builds the CORS middleware configuration. Organizations with
+// white labelling enabled may call the API from their own domain.
+func corsConfig(cfg *config.Config, domains middleware.DomainLister) middleware.CORSConfig {
+	rules := make([]middleware.CORSRule, 0, len(cfg.Security.CORS.Rules))
+	for _, rule := range cfg.Security.CORS.Rules {
+		rules = append(rules, middleware.CORSRule{
+			PathPrefix: rule.PathPrefix,
+			Methods:    rule.Methods,
+			Headers:    rule.Headers,
 		})
+	}
+	return middleware.CORSConfig{
+		AllowedOrigins:   cfg.Security.AllowedOrigins,
+		AllowedMethods:   cfg.Security.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.Security.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.Security.CORS.ExposedHeaders,
+		AllowCredentials: cfg.Security.CORS.AllowCredentials,
+		MaxAge:           cfg.Security.CORS.MaxAge,
+		Rules:            rules,
+		Domains:          domains,
+	}
+}
+
+// faceThresholds are the thresholds faces are detected with
+func faceThresholds(cfg *config.Config) faceService.Thresholds {
+	return faceService.Thresholds{
+		Score: float32(cfg.FaceDetection.ScoreThreshold),
+		IoU:   float32(cfg.FaceDetection.IoUThreshold),
+	}
+}
 
-		// User routes
-		userHandler.RegisterRoutes(router)
-
-		// Protected routes
-		protected := api.Group("/")
-		protected.Use(middleware.Auth())
-		{
-			// Face detection routes
-			faceDetectionHandler.RegisterRoutes(router)
-			// Token routes
-			tokenHandler.RegisterRoutes(router)
-			// Verification routes
-			verificationHandler.RegisterRoutes(router)
-			// Analytics routes
-			analyticsHandler.RegisterRoutes(router)
-			// Enterprise routes
-			enterpriseHandler.RegisterRoutes(router)
+// defaultRate is the rate applied to routes without a rule of their own
+func defaultRate(cfg *config.Config) ratelimit.Rate {
+	return ratelimit.Rate{
+		Requests: int(cfg.Security.RequestsPerWindow),
+		Window:   cfg.Security.RateWindow,
+	}
+}
+
+// routeRatePolicies converts configured rate limit rules into route policies
+func routeRatePolicies(rules []config.RateLimitRule) map[string]middleware.RatePolicy {
+	policies := make(map[string]middleware.RatePolicy, len(rules))
+	for _, rule := range rules {
+		keyBy := []middleware.KeyFunc{middleware.KeyByAPIKey, middleware.KeyByUser, middleware.KeyByIP}
+		switch rule.KeyBy {
+		case "ip":
+			keyBy = []middleware.KeyFunc{middleware.KeyByIP}
+		case "user":
+			keyBy = []middleware.KeyFunc{middleware.KeyByUser}
+		case "apiKey":
+			keyBy = []middleware.KeyFunc{middleware.KeyByAPIKey}
+		}
+		policies[rule.Route] = middleware.RatePolicy{
+			Name:  "route:" + rule.Route,
+			Rate:  ratelimit.Rate{Requests: rule.Requests, Window: rule.Window, Burst: rule.Burst},
+			KeyBy: keyBy,
 		}
 	}
+	return policies
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"vws-backend/config"
+	"vws-backend/internal/migrate"
+	"vws-backend/migrations"
+)
+
+const migrateUsage = `usage: vws-backend migrate <command>
+
+commands:
+  up              apply all pending migrations
+  down [n]        roll back the last n migrations (default 1)
+  goto <version>  migrate up or down to version, 0 for an empty schema
+  force <version> record version as applied without running anything
+  status          list migrations and whether they are applied
+  verify          check every migration has an up and a down file`
+
+// runMigrate runs a migrate subcommand and returns the exit code
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	// verify needs no database, so CI can run it
+	if args[0] == "verify" {
+		loaded, err := migrate.Load(migrations.FS)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%d migrations ok\n", len(loaded))
+		return 0
+	}
+
+	db, err := sql.Open("postgres", cfg.Database.URL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx := context.Background()
+	var changed []uint
+	switch args[0] {
+	case "up":
+		changed, err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "invalid step count %q\n", args[1])
+				return 2
+			}
+		}
+		changed, err = migrator.Down(ctx, steps)
+	case "goto", "force":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		version, parseErr := strconv.ParseUint(args[1], 10, 32)
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "invalid version %q\n", args[1])
+			return 2
+		}
+		if args[0] == "force" {
+			err = migrator.Force(ctx, uint(version))
+		} else {
+			changed, err = migrator.Goto(ctx, uint(version))
+		}
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	for _, version := range changed {
+		fmt.Printf("migrated %d\n", version)
+	}
+	if err == migrate.ErrNoChange {
+		fmt.Println("no change")
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	version, _, err := migrator.Version(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("schema at version %d\n", version)
+	return 0
+}
+
+func printMigrationStatus(ctx context.Context, migrator *migrate.Migrator) int {
+	version, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, s := range statuses {
+		state := "pending"
+		if s.Applied {
+			state = "applied"
+		}
+		if dirty && s.Version == version {
+			state = "dirty"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, state)
+	}
+	w.Flush()
+	fmt.Printf("\nschema at version %d of %d\n", version, migrator.Latest())
+	return 0
+}
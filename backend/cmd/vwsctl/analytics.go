@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"vws-backend/internal/service/analytics"
+)
+
+// dateFormat is how days are given on the command line
+const dateFormat = "2006-01-02"
+
+// recomputeMetrics calculates daily metrics again for every day from -from
+// through -to, for one metric or all of them. Each run stores new values
+// next to the ones calculated before.
+func (a *app) recomputeMetrics(ctx context.Context, args []string) error {
+	c := newCommand("metrics recompute")
+	fromFlag := c.String("from", "", "first day, YYYY-MM-DD")
+	toFlag := c.String("to", "", "last day, YYYY-MM-DD; defaults to -from")
+	metricType := c.String("type", "", "metric to recompute; all of them if empty")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	if err := c.required("from"); err != nil {
+		return err
+	}
+	if *toFlag == "" {
+		*toFlag = *fromFlag
+	}
+
+	from, err := time.Parse(dateFormat, *fromFlag)
+	if err != nil {
+		return usageErrorf("metrics recompute: invalid -from %q", *fromFlag)
+	}
+	to, err := time.Parse(dateFormat, *toFlag)
+	if err != nil {
+		return usageErrorf("metrics recompute: invalid -to %q", *toFlag)
+	}
+	if to.Before(from) {
+		return analytics.ErrInvalidDateRange
+	}
+
+	types := analytics.MetricTypes
+	if *metricType != "" {
+		if !slices.Contains(types, *metricType) {
+			return analytics.ErrInvalidMetric
+		}
+		types = []string{*metricType}
+	}
+
+	metrics := []*analytics.DailyMetric{}
+	t := table{header: []string{"DATE", "METRIC", "VALUE"}}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		for _, metricType := range types {
+			metric, err := a.analytics.CalculateDailyMetric(ctx, metricType, day)
+			if err != nil {
+				return err
+			}
+			metrics = append(metrics, metric)
+			t.rows = append(t.rows, []string{metric.Date.Format(dateFormat), metric.Type, formatFloat(metric.Value)})
+		}
+	}
+	return a.render(c, metrics, t)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"vws-backend/internal/service/enterprise"
+)
+
+// createOrganization creates an organization owned by an existing user
+func (a *app) createOrganization(ctx context.Context, args []string) error {
+	c := newCommand("org create")
+	name := c.String("name", "", "organization name")
+	email := c.String("email", "", "contact email address")
+	owner := c.Int64("owner", 0, "ID of the user owning the organization")
+	domain := c.String("domain", "", "domain of the organization")
+	description := c.String("description", "", "description")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	if err := c.required("name", "email"); err != nil {
+		return err
+	}
+	if *owner <= 0 {
+		return usageErrorf("org create: -owner is required")
+	}
+
+	org, err := a.enterprise.CreateOrganization(ctx, *name, *description, *email, *domain, *owner)
+	if err != nil {
+		return err
+	}
+	return a.render(c, org, table{
+		header: []string{"ID", "NAME", "EMAIL", "DOMAIN", "OWNER"},
+		rows:   [][]string{{formatID(org.ID), org.Name, org.ContactEmail, org.Domain, formatID(org.CreatedBy)}},
+	})
+}
+
+func apiKeyTable(keys ...*enterprise.APIKey) table {
+	t := table{header: []string{"ID", "NAME", "SCOPES", "RATE LIMIT", "EXPIRES", "LAST USED"}}
+	for _, key := range keys {
+		t.rows = append(t.rows, []string{
+			formatID(key.ID), key.Name, strings.Join(key.Scopes, ","), strconv.Itoa(key.RateLimit),
+			formatTime(key.ExpiresAt), formatTime(key.LastUsedAt),
+		})
+	}
+	return t
+}
+
+// createAPIKey issues an API key. Its plaintext is printed once and can't
+// be recovered afterwards.
+func (a *app) createAPIKey(ctx context.Context, args []string) error {
+	c := newCommand("apikey create")
+	orgID := c.Int64("org", 0, "organization ID")
+	name := c.String("name", "", "key name")
+	scopes := c.String("scopes", enterprise.ScopeRead, "comma separated scopes")
+	createdBy := c.Int64("created-by", 0, "ID of the user the key acts as")
+	rateLimit := c.Int("rate-limit", 1000, "requests allowed per window")
+	expires := c.Duration("expires", 0, "lifetime of the key, 0 for no expiry")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	if err := c.required("name"); err != nil {
+		return err
+	}
+	if *orgID <= 0 || *createdBy <= 0 {
+		return usageErrorf("apikey create: -org and -created-by are required")
+	}
+
+	var expiresAt time.Time
+	if *expires > 0 {
+		expiresAt = time.Now().Add(*expires)
+	}
+	key, err := a.enterprise.CreateAPIKey(ctx, *orgID, *name, strings.Split(*scopes, ","), *rateLimit, expiresAt, *createdBy)
+	if err != nil {
+		return err
+	}
+
+	t := apiKeyTable(key)
+	t.header = append(t.header, "KEY")
+	t.rows[0] = append(t.rows[0], key.Key)
+	return a.render(c, key, t)
+}
+
+func (a *app) listAPIKeys(ctx context.Context, args []string) error {
+	c := newCommand("apikey list")
+	orgID := c.Int64("org", 0, "organization ID")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	if *orgID <= 0 {
+		return usageErrorf("apikey list: -org is required")
+	}
+
+	keys, err := a.enterprise.ListAPIKeys(ctx, *orgID)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		keys = []*enterprise.APIKey{}
+	}
+	return a.render(c, keys, apiKeyTable(keys...))
+}
+
+func (a *app) revokeAPIKey(ctx context.Context, args []string) error {
+	c := newCommand("apikey revoke")
+	orgID := c.Int64("org", 0, "organization ID")
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+	if *orgID <= 0 {
+		return usageErrorf("apikey revoke: -org is required")
+	}
+	keyID, err := parseID(c.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := a.enterprise.RevokeAPIKey(ctx, *orgID, keyID); err != nil {
+		return err
+	}
+	return a.render(c, map[string]any{"id": keyID, "revoked": true}, table{
+		header: []string{"ID", "REVOKED"},
+		rows:   [][]string{{formatID(keyID), "true"}},
+	})
+}
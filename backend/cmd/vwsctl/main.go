@@ -0,0 +1,207 @@
+// Command vwsctl operates a VWS deployment from the command line. It works
+// on the database directly through the same services the server uses, so
+// routine tasks don't need raw SQL.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	_ "github.com/lib/pq"
+
+	"vws-backend/config"
+	"vws-backend/internal/migrate"
+	"vws-backend/internal/service/analytics"
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/service/face"
+	"vws-backend/internal/service/token"
+	"vws-backend/internal/service/user"
+	"vws-backend/internal/service/verification"
+	"vws-backend/internal/store/postgres"
+	"vws-backend/migrations"
+)
+
+const usage = `usage: vwsctl [config flags] <command> <subcommand> [flags] [args]
+
+commands:
+  user create -username <name> -email <email> -password <password> [-admin]
+  user promote <user-id>
+  user show <user-id>
+  org create -name <name> -email <contact> -owner <user-id> [-domain <domain>] [-description <text>]
+  apikey create -org <id> -name <name> -scopes READ,WRITE -created-by <user-id> [-rate-limit <n>] [-expires <duration>]
+  apikey list -org <id>
+  apikey revoke -org <id> <key-id>
+  metrics recompute -from <YYYY-MM-DD> [-to <YYYY-MM-DD>] [-type <metric>]
+  cert show <certificate-id>
+  cert list <user-id>
+  cert reissue -proof-file <path> <certificate-id>
+  tokens adjust -user <id> -amount <n> -reason <text> [-actor <name>]
+  migrate up | down [n] | goto <version> | force <version> | status | verify
+
+Every subcommand accepts -o table or -o json. Configuration flags and VWS_*
+environment variables are the server's, e.g. -database.url.`
+
+// errUsage marks errors in how vwsctl was invoked
+var errUsage = errors.New("usage")
+
+func usageErrorf(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{errUsage}, args...)...)
+}
+
+// app holds the services commands run against
+type app struct {
+	users        *user.Service
+	tokens       *token.Service
+	verification *verification.Service
+	analytics    *analytics.Service
+	enterprise   *enterprise.Service
+	migrator     *migrate.Migrator
+
+	in  io.Reader
+	out io.Writer
+}
+
+// repositories is a storage backend, see internal/store
+type repositories interface {
+	Users() user.Repository
+	Tokens() token.Repository
+	Faces() face.Repository
+	Verification() verification.Repository
+	Analytics() analytics.Repository
+	Enterprise() enterprise.Repository
+}
+
+func newApp(repos repositories, verificationSvc *verification.Service, migrator *migrate.Migrator, in io.Reader, out io.Writer) *app {
+	return &app{
+		users:        user.NewService(repos.Users()),
+		tokens:       token.NewService(repos.Tokens(), repos.Faces()),
+		verification: verificationSvc,
+		analytics:    analytics.NewService(repos.Analytics()),
+		enterprise:   enterprise.NewService(repos.Enterprise()),
+		migrator:     migrator,
+		in:           in,
+		out:          out,
+	}
+}
+
+func main() {
+	cfg, args, err := config.Load(config.Options{Path: "config/config.json", Args: os.Args[1:]})
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	os.Exit(exitCode(runWithConfig(cfg, args)))
+}
+
+// runWithConfig connects to the configured database and runs a command
+func runWithConfig(cfg *config.Config, args []string) error {
+	// verify needs no database, so CI can run it
+	if len(args) >= 2 && args[0] == "migrate" && args[1] == "verify" {
+		return (&app{in: os.Stdin, out: os.Stdout}).run(context.Background(), args)
+	}
+	if cfg.Database.Backend != "postgres" {
+		return fmt.Errorf("vwsctl needs the postgres backend, not %q", cfg.Database.Backend)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := sql.Open("postgres", cfg.Database.URL)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	verificationSvc, err := verification.NewService(postgres.New(db).Verification(), cfg.Blockchain.NetworkURL, cfg.Blockchain.ContractAddr)
+	if err != nil {
+		return fmt.Errorf("connect to ethereum node: %w", err)
+	}
+	defer verificationSvc.Close()
+
+	return newApp(postgres.New(db), verificationSvc, migrator, os.Stdin, os.Stdout).run(ctx, args)
+}
+
+// exitCode reports err and maps it to the process exit code: 2 for usage
+// errors, 1 for everything else
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(os.Stderr, "%v\n\n%s\n", err, usage)
+		return 2
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+}
+
+// run dispatches args to a command
+func (a *app) run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return usageErrorf("missing subcommand")
+	}
+
+	commands := map[string]map[string]func(context.Context, []string) error{
+		"user": {
+			"create":  a.createUser,
+			"promote": a.promoteUser,
+			"show":    a.showUser,
+		},
+		"org": {
+			"create": a.createOrganization,
+		},
+		"apikey": {
+			"create": a.createAPIKey,
+			"list":   a.listAPIKeys,
+			"revoke": a.revokeAPIKey,
+		},
+		"metrics": {
+			"recompute": a.recomputeMetrics,
+		},
+		"cert": {
+			"show":    a.showCertificate,
+			"list":    a.listCertificates,
+			"reissue": a.reissueCertificate,
+		},
+		"tokens": {
+			"adjust": a.adjustTokens,
+		},
+		"migrate": {
+			"up":     a.migrateUp,
+			"down":   a.migrateDown,
+			"goto":   a.migrateGoto,
+			"force":  a.migrateForce,
+			"status": a.migrateStatus,
+			"verify": a.migrateVerify,
+		},
+	}
+
+	subcommands, ok := commands[args[0]]
+	if !ok {
+		return usageErrorf("unknown command %q", args[0])
+	}
+	command, ok := subcommands[args[1]]
+	if !ok {
+		return usageErrorf("unknown subcommand %q of %s", args[1], args[0])
+	}
+	return command(ctx, args[2:])
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/analytics"
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/service/verification"
+	"vws-backend/internal/store/memory"
+)
+
+// testApp runs commands against an empty in-memory store
+type testApp struct {
+	*app
+	out *bytes.Buffer
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	store := memory.New()
+	verificationSvc, err := verification.NewService(store.Verification(),
+		"http://localhost:8545", "0x0000000000000000000000000000000000000000")
+	require.NoError(t, err)
+	t.Cleanup(func() { verificationSvc.Close() })
+
+	out := &bytes.Buffer{}
+	return &testApp{app: newApp(store, verificationSvc, nil, strings.NewReader("secret123\n"), out), out: out}
+}
+
+// runJSON runs a command with JSON output and decodes it into v
+func (a *testApp) runJSON(t *testing.T, v any, args ...string) {
+	t.Helper()
+
+	a.out.Reset()
+	args = append(args[:2:2], append([]string{"-o", "json"}, args[2:]...)...)
+	require.NoError(t, a.run(context.Background(), args))
+	require.NoError(t, json.Unmarshal(a.out.Bytes(), v), a.out.String())
+}
+
+func TestUsers(t *testing.T) {
+	a := newTestApp(t)
+
+	var created userView
+	a.runJSON(t, &created, "user", "create", "-username", "alice", "-email", "alice@example.com")
+	assert.Equal(t, "alice", created.Username)
+	assert.Equal(t, "USER", created.Role)
+
+	_, err := a.users.Authenticate(context.Background(), "alice@example.com", "secret123")
+	assert.NoError(t, err, "the password is read from stdin")
+
+	var promoted userView
+	a.runJSON(t, &promoted, "user", "promote", formatID(created.ID))
+	assert.Equal(t, "ADMIN", promoted.Role)
+
+	a.out.Reset()
+	require.NoError(t, a.run(context.Background(), []string{"user", "show", formatID(created.ID)}))
+	assert.Contains(t, a.out.String(), "ROLE")
+	assert.Contains(t, a.out.String(), "ADMIN")
+
+	var admin userView
+	a.runJSON(t, &admin, "user", "create", "-username", "bob", "-email", "bob@example.com", "-password", "hunter22", "-admin")
+	assert.Equal(t, "ADMIN", admin.Role)
+}
+
+func TestOrganizationsAndAPIKeys(t *testing.T) {
+	a := newTestApp(t)
+	var owner userView
+	a.runJSON(t, &owner, "user", "create", "-username", "alice", "-email", "alice@example.com")
+
+	var org enterprise.Organization
+	a.runJSON(t, &org, "org", "create", "-name", "Acme", "-email", "ops@acme.test", "-owner", formatID(owner.ID))
+	assert.Equal(t, "Acme", org.Name)
+
+	var key enterprise.APIKey
+	a.runJSON(t, &key, "apikey", "create", "-org", formatID(org.ID), "-name", "ci",
+		"-scopes", "READ,WRITE", "-created-by", formatID(owner.ID), "-expires", "24h")
+	assert.True(t, strings.HasPrefix(key.Key, enterprise.APIKeyPrefix), "the plaintext is shown once")
+	assert.Equal(t, []string{"READ", "WRITE"}, key.Scopes)
+	assert.False(t, key.ExpiresAt.IsZero())
+
+	var keys []enterprise.APIKey
+	a.runJSON(t, &keys, "apikey", "list", "-org", formatID(org.ID))
+	require.Len(t, keys, 1)
+	assert.Empty(t, keys[0].Key)
+
+	a.out.Reset()
+	require.NoError(t, a.run(context.Background(), []string{"apikey", "revoke", "-org", formatID(org.ID), formatID(key.ID)}))
+	_, err := a.enterprise.ValidateAPIKey(context.Background(), key.Key)
+	assert.Equal(t, enterprise.ErrInvalidAPIKey, err)
+
+	err = a.run(context.Background(), []string{"apikey", "create", "-org", formatID(org.ID), "-name", "bad",
+		"-scopes", "ROOT", "-created-by", formatID(owner.ID)})
+	assert.Equal(t, enterprise.ErrInvalidScope, err)
+}
+
+func TestRecomputeMetrics(t *testing.T) {
+	a := newTestApp(t)
+
+	var metrics []analytics.DailyMetric
+	a.runJSON(t, &metrics, "metrics", "recompute", "-from", "2024-03-01", "-to", "2024-03-03")
+	assert.Len(t, metrics, 3*len(analytics.MetricTypes))
+
+	a.runJSON(t, &metrics, "metrics", "recompute", "-from", "2024-03-01", "-type", "NEW_USERS")
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "NEW_USERS", metrics[0].Type)
+	assert.Equal(t, "2024-03-01", metrics[0].Date.Format(dateFormat))
+
+	err := a.run(context.Background(), []string{"metrics", "recompute", "-from", "2024-03-01", "-type", "BOGUS"})
+	assert.Equal(t, analytics.ErrInvalidMetric, err)
+	err = a.run(context.Background(), []string{"metrics", "recompute", "-from", "2024-03-02", "-to", "2024-03-01"})
+	assert.Equal(t, analytics.ErrInvalidDateRange, err)
+}
+
+func TestCertificates(t *testing.T) {
+	a := newTestApp(t)
+	ctx := context.Background()
+	issued, err := a.verification.VerifyVoteParticipation(ctx, 1, "election1", []byte("old proof"))
+	require.NoError(t, err)
+
+	var shown struct {
+		verification.Certificate
+		Valid bool `json:"valid"`
+	}
+	a.runJSON(t, &shown, "cert", "show", issued.ID)
+	assert.Equal(t, issued.Hash, shown.Hash)
+	assert.True(t, shown.Valid)
+
+	proof := filepath.Join(t.TempDir(), "proof")
+	require.NoError(t, os.WriteFile(proof, []byte("new proof"), 0o600))
+	var reissued verification.Certificate
+	a.runJSON(t, &reissued, "cert", "reissue", "-proof-file", proof, issued.ID)
+	assert.NotEqual(t, issued.ID, reissued.ID)
+	assert.Equal(t, "election1", reissued.ElectionID)
+
+	var certs []verification.Certificate
+	a.runJSON(t, &certs, "cert", "list", "1")
+	require.Len(t, certs, 1)
+	assert.Equal(t, reissued.ID, certs[0].ID)
+}
+
+func TestAdjustTokens(t *testing.T) {
+	a := newTestApp(t)
+	var u userView
+	a.runJSON(t, &u, "user", "create", "-username", "alice", "-email", "alice@example.com")
+
+	a.out.Reset()
+	require.NoError(t, a.run(context.Background(), []string{"tokens", "adjust",
+		"-user", formatID(u.ID), "-amount", "12.5", "-reason", "missed reward", "-actor", "ops"}))
+	assert.Contains(t, a.out.String(), "missed reward")
+
+	txns, err := a.tokens.GetUserTransactions(context.Background(), u.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, txns, 1)
+	assert.Equal(t, "ops", txns[0].Actor)
+	assert.Equal(t, 12.5, txns[0].Amount)
+
+	err = a.run(context.Background(), []string{"tokens", "adjust", "-user", formatID(u.ID), "-amount", "5"})
+	assert.ErrorIs(t, err, errUsage, "a reason is required")
+}
+
+func TestUsageErrors(t *testing.T) {
+	a := newTestApp(t)
+
+	for _, args := range [][]string{
+		{"user"},
+		{"bogus", "create"},
+		{"user", "bogus"},
+		{"user", "show"},
+		{"user", "show", "abc"},
+		{"user", "show", "-o", "xml", "1"},
+		{"org", "create", "-name", "Acme"},
+		{"migrate", "down", "zero"},
+	} {
+		assert.ErrorIs(t, a.run(context.Background(), args), errUsage, "%v", args)
+	}
+}
+
+func TestMigrateVerify(t *testing.T) {
+	a := newTestApp(t)
+
+	var result map[string]int
+	a.runJSON(t, &result, "migrate", "verify")
+	assert.Positive(t, result["migrations"])
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"vws-backend/internal/migrate"
+	"vws-backend/migrations"
+)
+
+// migration is the outcome of a migrate subcommand
+type migration struct {
+	Migrated []uint `json:"migrated"`
+	Version  uint   `json:"version"`
+}
+
+// renderMigration reports the versions a subcommand applied or rolled back
+// along with the resulting schema version
+func (a *app) renderMigration(ctx context.Context, c *command, changed []uint, err error) error {
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	version, _, err := a.migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := migration{Migrated: changed, Version: version}
+	if result.Migrated == nil {
+		result.Migrated = []uint{}
+	}
+	t := table{header: []string{"MIGRATED", "VERSION"}}
+	for _, v := range changed {
+		t.rows = append(t.rows, []string{strconv.FormatUint(uint64(v), 10), strconv.FormatUint(uint64(version), 10)})
+	}
+	if len(changed) == 0 {
+		t.rows = append(t.rows, []string{"-", strconv.FormatUint(uint64(version), 10)})
+	}
+	return a.render(c, result, t)
+}
+
+func (a *app) migrateUp(ctx context.Context, args []string) error {
+	c := newCommand("migrate up")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	changed, err := a.migrator.Up(ctx)
+	return a.renderMigration(ctx, c, changed, err)
+}
+
+// migrateDown rolls back the last migration, or as many as given
+func (a *app) migrateDown(ctx context.Context, args []string) error {
+	c := newCommand("migrate down")
+	if err := c.parse(args, -1); err != nil {
+		return err
+	}
+	steps := 1
+	switch c.NArg() {
+	case 0:
+	case 1:
+		var err error
+		if steps, err = strconv.Atoi(c.Arg(0)); err != nil || steps < 1 {
+			return usageErrorf("migrate down: invalid step count %q", c.Arg(0))
+		}
+	default:
+		return usageErrorf("migrate down: expected at most 1 argument, got %d", c.NArg())
+	}
+
+	changed, err := a.migrator.Down(ctx, steps)
+	return a.renderMigration(ctx, c, changed, err)
+}
+
+func (a *app) migrateGoto(ctx context.Context, args []string) error {
+	c := newCommand("migrate goto")
+	version, err := parseVersion(c, args)
+	if err != nil {
+		return err
+	}
+	changed, err := a.migrator.Goto(ctx, version)
+	return a.renderMigration(ctx, c, changed, err)
+}
+
+// migrateForce records a version as applied without running anything, to
+// recover from a failed migration
+func (a *app) migrateForce(ctx context.Context, args []string) error {
+	c := newCommand("migrate force")
+	version, err := parseVersion(c, args)
+	if err != nil {
+		return err
+	}
+	err = a.migrator.Force(ctx, version)
+	return a.renderMigration(ctx, c, nil, err)
+}
+
+func parseVersion(c *command, args []string) (uint, error) {
+	if err := c.parse(args, 1); err != nil {
+		return 0, err
+	}
+	version, err := strconv.ParseUint(c.Arg(0), 10, 32)
+	if err != nil {
+		return 0, usageErrorf("%s: invalid version %q", c.Name(), c.Arg(0))
+	}
+	return uint(version), nil
+}
+
+// migrationStatus is a migration as the status subcommand prints it
+type migrationStatus struct {
+	migrate.Status
+	Dirty bool `json:"dirty,omitempty"`
+}
+
+func (a *app) migrateStatus(ctx context.Context, args []string) error {
+	c := newCommand("migrate status")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+
+	version, dirty, err := a.migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	statuses, err := a.migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := make([]migrationStatus, len(statuses))
+	t := table{header: []string{"VERSION", "NAME", "STATUS"}}
+	for i, s := range statuses {
+		result[i] = migrationStatus{Status: s, Dirty: dirty && s.Version == version}
+		state := "pending"
+		if s.Applied {
+			state = "applied"
+		}
+		if result[i].Dirty {
+			state = "dirty"
+		}
+		t.rows = append(t.rows, []string{strconv.FormatUint(uint64(s.Version), 10), s.Name, state})
+	}
+	return a.render(c, result, t)
+}
+
+// migrateVerify checks every migration has an up and a down file
+func (a *app) migrateVerify(ctx context.Context, args []string) error {
+	c := newCommand("migrate verify")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+
+	loaded, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return err
+	}
+	t := table{header: []string{"VERSION", "NAME"}}
+	for _, m := range loaded {
+		t.rows = append(t.rows, []string{strconv.FormatUint(uint64(m.Version), 10), m.Name})
+	}
+	return a.render(c, map[string]int{"migrations": len(loaded)}, t)
+}
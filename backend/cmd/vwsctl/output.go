@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// command is a subcommand's flag set along with the output format every
+// subcommand accepts
+type command struct {
+	*flag.FlagSet
+	format string
+}
+
+func newCommand(name string) *command {
+	c := &command{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+	c.SetOutput(io.Discard)
+	c.StringVar(&c.format, "o", "table", "output format, table or json")
+	return c
+}
+
+// parse parses args, which must leave exactly positional arguments, or
+// any number of them if positional is negative
+func (c *command) parse(args []string, positional int) error {
+	if err := c.Parse(args); err != nil {
+		return usageErrorf("%s: %v", c.Name(), err)
+	}
+	if c.format != "table" && c.format != "json" {
+		return usageErrorf("%s: output must be table or json, got %q", c.Name(), c.format)
+	}
+	if positional >= 0 && c.NArg() != positional {
+		return usageErrorf("%s: expected %d arguments, got %d", c.Name(), positional, c.NArg())
+	}
+	return nil
+}
+
+// required reports the first of the named string flags left empty
+func (c *command) required(names ...string) error {
+	for _, name := range names {
+		if c.Lookup(name).Value.String() == "" {
+			return usageErrorf("%s: -%s is required", c.Name(), name)
+		}
+	}
+	return nil
+}
+
+// table is what a command prints in table format
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// render writes v as indented JSON or t as an aligned table
+func (a *app) render(c *command, v any, t table) error {
+	if c.format == "json" {
+		enc := json.NewEncoder(a.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func parseID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, usageErrorf("invalid ID %q", s)
+	}
+	return id, nil
+}
+
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os/user"
+)
+
+// adjustTokens credits or debits a user's token balance. The reason and
+// the operator are stored with the transaction; the operator defaults to
+// the account running vwsctl.
+func (a *app) adjustTokens(ctx context.Context, args []string) error {
+	c := newCommand("tokens adjust")
+	userID := c.Int64("user", 0, "ID of the user")
+	amount := c.Float64("amount", 0, "tokens to add, negative to remove")
+	reason := c.String("reason", "", "why the balance is adjusted")
+	actor := c.String("actor", currentUser(), "operator making the adjustment")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	if err := c.required("reason", "actor"); err != nil {
+		return err
+	}
+	if *userID <= 0 || *amount == 0 {
+		return usageErrorf("tokens adjust: -user and a non-zero -amount are required")
+	}
+
+	txn, err := a.tokens.AdjustBalance(ctx, *userID, *amount, *reason, *actor)
+	if err != nil {
+		return err
+	}
+	account, err := a.tokens.GetUserTokens(ctx, *userID)
+	if err != nil {
+		return err
+	}
+
+	return a.render(c, txn, table{
+		header: []string{"TRANSACTION", "USER", "AMOUNT", "BALANCE", "ACTOR", "REASON"},
+		rows: [][]string{{
+			formatID(txn.ID), formatID(txn.UserID), formatFloat(txn.Amount),
+			formatFloat(account.Balance), txn.Actor, txn.Description,
+		}},
+	})
+}
+
+// currentUser returns the name of the account running vwsctl, if known
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
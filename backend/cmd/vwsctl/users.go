@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"strings"
+
+	"vws-backend/internal/service/user"
+)
+
+// userView is a user as vwsctl prints it, with its platform role
+type userView struct {
+	*user.User
+	Role string `json:"role"`
+}
+
+func (a *app) renderUser(c *command, u *user.User, role string) error {
+	view := userView{User: u, Role: role}
+	return a.render(c, view, table{
+		header: []string{"ID", "USERNAME", "EMAIL", "ROLE", "POINTS", "CREATED"},
+		rows: [][]string{{
+			formatID(u.ID), u.Username, u.Email, role, formatID(u.Points), formatTime(u.CreatedAt),
+		}},
+	})
+}
+
+// createUser signs up a user, optionally as an admin. Without -password
+// the password is read from the first line of standard input, which keeps
+// it out of the process list.
+func (a *app) createUser(ctx context.Context, args []string) error {
+	c := newCommand("user create")
+	username := c.String("username", "", "username")
+	email := c.String("email", "", "email address")
+	password := c.String("password", "", "password, read from stdin if empty")
+	admin := c.Bool("admin", false, "make the user an admin")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	if err := c.required("username", "email"); err != nil {
+		return err
+	}
+
+	if *password == "" {
+		line, err := bufio.NewReader(a.in).ReadString('\n')
+		*password = strings.TrimRight(line, "\r\n")
+		if *password == "" {
+			return usageErrorf("user create: no password given: %v", err)
+		}
+	}
+
+	u, err := a.users.CreateUser(ctx, *username, *email, *password)
+	if err != nil {
+		return err
+	}
+	role := user.RoleUser
+	if *admin {
+		role = user.RoleAdmin
+		if err := a.users.SetRole(ctx, u.ID, role); err != nil {
+			return err
+		}
+	}
+	return a.renderUser(c, u, role)
+}
+
+// promoteUser makes an existing user an admin
+func (a *app) promoteUser(ctx context.Context, args []string) error {
+	c := newCommand("user promote")
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+	id, err := parseID(c.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := a.users.SetRole(ctx, id, user.RoleAdmin); err != nil {
+		return err
+	}
+	u, err := a.users.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	return a.renderUser(c, u, user.RoleAdmin)
+}
+
+func (a *app) showUser(ctx context.Context, args []string) error {
+	c := newCommand("user show")
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+	id, err := parseID(c.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	u, err := a.users.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	role, err := a.users.GetRole(ctx, id)
+	if err != nil {
+		return err
+	}
+	return a.renderUser(c, u, role)
+}
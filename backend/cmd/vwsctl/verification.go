@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"vws-backend/internal/service/verification"
+)
+
+func certificateTable(certs ...*verification.Certificate) table {
+	t := table{header: []string{"ID", "USER", "ELECTION", "HASH", "ISSUED"}}
+	for _, cert := range certs {
+		t.rows = append(t.rows, []string{
+			cert.ID, formatID(cert.UserID), cert.ElectionID, cert.Hash, formatTime(cert.CreatedAt),
+		})
+	}
+	return t
+}
+
+// showCertificate prints a certificate and whether it verifies
+func (a *app) showCertificate(ctx context.Context, args []string) error {
+	c := newCommand("cert show")
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+
+	cert, err := a.verification.GetCertificate(ctx, c.Arg(0))
+	if err != nil {
+		return err
+	}
+	valid, err := a.verification.VerifyCertificate(ctx, cert.ID)
+	if err != nil {
+		return err
+	}
+
+	t := certificateTable(cert)
+	t.header = append(t.header, "VALID")
+	t.rows[0] = append(t.rows[0], strconv.FormatBool(valid))
+	return a.render(c, struct {
+		*verification.Certificate
+		Valid bool `json:"valid"`
+	}{cert, valid}, t)
+}
+
+func (a *app) listCertificates(ctx context.Context, args []string) error {
+	c := newCommand("cert list")
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+	userID, err := parseID(c.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	certs, err := a.verification.GetUserCertificates(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if certs == nil {
+		certs = []*verification.Certificate{}
+	}
+	return a.render(c, certs, certificateTable(certs...))
+}
+
+// reissueCertificate replaces a certificate with one built from the proof
+// data in a file
+func (a *app) reissueCertificate(ctx context.Context, args []string) error {
+	c := newCommand("cert reissue")
+	proofFile := c.String("proof-file", "", "file holding the new proof data")
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+	if err := c.required("proof-file"); err != nil {
+		return err
+	}
+
+	proof, err := os.ReadFile(*proofFile)
+	if err != nil {
+		return err
+	}
+	cert, err := a.verification.ReissueCertificate(ctx, c.Arg(0), proof)
+	if err != nil {
+		return err
+	}
+	return a.render(c, cert, certificateTable(cert))
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, args, err := Load(Options{Path: filepath.Join(t.TempDir(), "missing.json"), LookupEnv: env(nil)})
+	require.NoError(t, err)
+	assert.Empty(t, args)
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestLoad_Layers(t *testing.T) {
+	path := writeFile(t, "config.json", `{
+		"server": {"port": 9000, "host": "0.0.0.0"},
+		"security": {
+			"tokenExpiry": "5m",
+			"rateLimits": [{"route": "POST /api/votes", "requests": 3, "window": "10s", "keyBy": "user"}]
+		},
+		"logging": {"level": "debug"}
+	}`)
+
+	cfg, args, err := Load(Options{
+		Path: path,
+		Args: []string{"-server.port=9100", "-database.autoMigrate", "migrate", "up"},
+		LookupEnv: env(map[string]string{
+			"VWS_SERVER_PORT":                  "9001",
+			"VWS_SECURITY_ALLOWED_ORIGINS":     "https://a.example, https://b.example",
+			"VWS_SECURITY_REFRESH_EXPIRY":      "48h",
+			"VWS_CACHE_REDIS_URL":              "redis://localhost:6379",
+			"VWS_TRACING_SAMPLE_RATIO":         "0.25",
+			"VWS_SECURITY_CORS_RULES":          `[{"pathPrefix": "/api/enterprise", "methods": ["GET"]}]`,
+			"VWS_FACE_DETECTION_MAX_FILE_SIZE": "1024",
+		}),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"migrate", "up"}, args)
+	assert.Equal(t, 9100, cfg.Server.Port, "flags override the environment")
+	assert.Equal(t, "0.0.0.0", cfg.Server.Host, "file overrides defaults")
+	assert.True(t, cfg.Database.AutoMigrate)
+	assert.Equal(t, 5*time.Minute, cfg.Security.TokenExpiry)
+	assert.Equal(t, 48*time.Hour, cfg.Security.RefreshExpiry)
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.Security.AllowedOrigins)
+	assert.Equal(t, []RateLimitRule{{Route: "POST /api/votes", Requests: 3, Window: 10 * time.Second, KeyBy: "user"}}, cfg.Security.RateLimits)
+	assert.Equal(t, []CORSRule{{PathPrefix: "/api/enterprise", Methods: []string{"GET"}}}, cfg.Security.CORS.Rules)
+	assert.Equal(t, "redis://localhost:6379", cfg.Cache.RedisURL)
+	assert.Equal(t, 0.25, cfg.Tracing.SampleRatio)
+	assert.Equal(t, int64(1024), cfg.FaceDetection.MaxFileSize)
+	assert.Equal(t, "debug", cfg.Logging.Level)
+	assert.Equal(t, "vws-backend", cfg.Security.JWTIssuer, "unset fields keep their default")
+}
+
+func TestLoad_YAML(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  port: 9200
+health:
+  checkTimeout: 500ms
+security:
+  allowedOrigins: [https://vws.example]
+`)
+
+	cfg, _, err := Load(Options{Path: path, LookupEnv: env(nil)})
+	require.NoError(t, err)
+	assert.Equal(t, 9200, cfg.Server.Port)
+	assert.Equal(t, 500*time.Millisecond, cfg.Health.CheckTimeout)
+	assert.Equal(t, []string{"https://vws.example"}, cfg.Security.AllowedOrigins)
+}
+
+func TestLoad_ConfigSelection(t *testing.T) {
+	fromEnv := writeFile(t, "env.json", `{"server": {"port": 1111}}`)
+	fromFlag := writeFile(t, "flag.json", `{"server": {"port": 2222}}`)
+
+	cfg, _, err := Load(Options{Path: "ignored.json", LookupEnv: env(map[string]string{ConfigEnv: fromEnv})})
+	require.NoError(t, err)
+	assert.Equal(t, 1111, cfg.Server.Port)
+
+	cfg, _, err = Load(Options{
+		Path:      "ignored.json",
+		Args:      []string{"-config", fromFlag},
+		LookupEnv: env(map[string]string{ConfigEnv: fromEnv}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2222, cfg.Server.Port)
+
+	_, _, err = Load(Options{Args: []string{"-config", filepath.Join(t.TempDir(), "missing.json")}, LookupEnv: env(nil)})
+	assert.ErrorIs(t, err, ErrInvalid, "an explicitly chosen file must exist")
+}
+
+func TestLoad_ReportsAllProblems(t *testing.T) {
+	path := writeFile(t, "config.json", `{
+		"server": {"port": "eighty", "colour": "blue"},
+		"security": {"tokenExpiry": "soon"}
+	}`)
+
+	_, _, err := Load(Options{
+		Path:      path,
+		LookupEnv: env(map[string]string{"VWS_DATABASE_AUTO_MIGRATE": "maybe"}),
+	})
+	require.ErrorIs(t, err, ErrInvalid)
+	for _, want := range []string{
+		"server.port: expected an integer",
+		"server.colour: unknown setting",
+		"security.tokenExpiry: expected a duration",
+		"VWS_DATABASE_AUTO_MIGRATE: expected true or false",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestLoad_SecretFiles(t *testing.T) {
+	secret := writeFile(t, "jwt", strings.Repeat("s", 40)+"\n")
+	key := writeFile(t, "key", "0x"+strings.Repeat("ab", 32)+"\n")
+
+	cfg, _, err := Load(Options{LookupEnv: env(map[string]string{
+		"VWS_SECURITY_JWT_SECRET_FILE":    secret,
+		"VWS_BLOCKCHAIN_PRIVATE_KEY_FILE": key,
+	})})
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("s", 40), cfg.Security.JWTSecret)
+	assert.Equal(t, "0x"+strings.Repeat("ab", 32), cfg.Blockchain.PrivateKey)
+
+	_, _, err = Load(Options{LookupEnv: env(map[string]string{
+		"VWS_SECURITY_JWT_SECRET":      "inline",
+		"VWS_SECURITY_JWT_SECRET_FILE": secret,
+	})})
+	require.ErrorIs(t, err, ErrInvalid)
+	assert.Contains(t, err.Error(), "security.jwtSecret and security.jwtSecretFile are both set")
+}
+
+func TestLoad_UnknownFlag(t *testing.T) {
+	_, _, err := Load(Options{Args: []string{"-no.such.flag=1"}, LookupEnv: env(nil)})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrInvalid))
+}
+
+func validConfig(t *testing.T) *Config {
+	cfg := Default()
+	cfg.FaceDetection.ModelPath = writeFile(t, "model.onnx", "model")
+	cfg.FaceDetection.RecognitionModelPath = writeFile(t, "recognition.onnx", "model")
+	cfg.Security.JWTSecret = strings.Repeat("s", MinJWTSecretLength)
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, validConfig(t).Validate())
+
+	cfg := validConfig(t)
+	cfg.Server.Port = 0
+	cfg.Server.MetricsPort = 0
+	cfg.Server.WriteTimeout = 2 * time.Minute
+	cfg.FaceDetection.ModelPath = filepath.Join(t.TempDir(), "missing.onnx")
+	cfg.FaceDetection.ScoreThreshold = 0
+	cfg.FaceDetection.IoUThreshold = 1.5
+	cfg.FaceDetection.AllowedTypes = []string{"image/jpeg", "image/gif"}
+	cfg.FaceDetection.MaxPixels = 0
+	cfg.FaceDetection.RecognitionModelPath = t.TempDir()
+	cfg.FaceDetection.MatchThreshold = 2
+	cfg.FaceDetection.LivenessThreshold = -0.5
+	cfg.FaceDetection.DuplicateThreshold = 1.2
+	cfg.Security.JWTSecret = "short"
+	cfg.Security.RefreshExpiry = time.Minute
+	cfg.Security.RateLimits = []RateLimitRule{{Route: "/api/votes", KeyBy: "session"}}
+	cfg.Security.AllowedOrigins = []string{"*"}
+	cfg.Blockchain.PrivateKey = "not-a-key"
+	cfg.Database.URL = "mysql://localhost/vws"
+	cfg.Logging.Level = "loud"
+	cfg.Tracing.Exporter = "zipkin"
+
+	err := cfg.Validate()
+	require.ErrorIs(t, err, ErrInvalid)
+	for _, want := range []string{
+		"server.port",
+		"server.metricsPort: 0 is not a valid port",
+		"faceDetection.modelPath: " + cfg.FaceDetection.ModelPath + " does not exist, fetch the models with make models",
+		"faceDetection.scoreThreshold",
+		"faceDetection.iouThreshold",
+		"faceDetection.allowedTypes[1]",
+		"faceDetection.maxPixels",
+		"faceDetection.recognitionModelPath",
+		"faceDetection.matchThreshold",
+		"faceDetection.livenessThreshold",
+		"faceDetection.duplicateThreshold",
+		"security.jwtSecret: must be at least 32 bytes",
+		"security.refreshExpiry",
+		"security.idempotencyLockTimeout: must be longer than server.writeTimeout",
+		"security.rateLimits[0].route",
+		"security.rateLimits[0].requests",
+		"security.rateLimits[0].keyBy",
+		"security.allowedOrigins: \"*\" allows every site",
+		"blockchain.privateKey",
+		"database.url: expected a postgres or postgresql URL",
+		"logging.level",
+		"tracing.exporter",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+	assert.NotContains(t, err.Error(), "not-a-key", "secrets are not echoed")
+
+	cfg = validConfig(t)
+	cfg.Database.Backend = "memory"
+	cfg.Database.URL = ""
+	require.NoError(t, cfg.Validate(), "the memory backend needs no database")
+
+	cfg.Database.Backend = "sqlite"
+	assert.ErrorContains(t, cfg.Validate(), "database.backend")
+}
+
+func TestDefault_ModelsFetched(t *testing.T) {
+	manifest, err := os.ReadFile("../models/models.txt")
+	require.NoError(t, err)
+	fetched := map[string]bool{}
+	for _, line := range strings.Split(string(manifest), "\n") {
+		if name, _, _ := strings.Cut(line, " "); name != "" && !strings.HasPrefix(name, "#") {
+			fetched["models/"+name] = true
+		}
+	}
+
+	// The server runs from the backend directory, where make models
+	// fetches the models
+	cfg := Default()
+	assert.True(t, fetched[cfg.FaceDetection.ModelPath], "make models fetches %s", cfg.FaceDetection.ModelPath)
+	assert.True(t, fetched[cfg.FaceDetection.RecognitionModelPath], "make models fetches %s", cfg.FaceDetection.RecognitionModelPath)
+}
+
+func TestUpperSnake(t *testing.T) {
+	for name, want := range map[string]string{
+		"port":          "PORT",
+		"tokenExpiry":   "TOKEN_EXPIRY",
+		"redisURL":      "REDIS_URL",
+		"networkURL":    "NETWORK_URL",
+		"chainId":       "CHAIN_ID",
+		"cacheTTL":      "CACHE_TTL",
+		"jwtSecretFile": "JWT_SECRET_FILE",
+	} {
+		assert.Equal(t, want, upperSnake(name), name)
+	}
+}
+
+func TestDefault_LivenessNotRequired(t *testing.T) {
+	// The liveness checks are experimental and would lock out live faces
+	// they misjudge
+	assert.False(t, Default().FaceDetection.RequireLiveness)
+}
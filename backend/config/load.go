@@ -0,0 +1,445 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the name of every environment variable read by Load.
+// The rest is the field's path in upper snake case, e.g.
+// VWS_SECURITY_TOKEN_EXPIRY for security.tokenExpiry.
+const EnvPrefix = "VWS_"
+
+// ConfigEnv and ConfigFlag select the configuration file
+const (
+	ConfigEnv  = EnvPrefix + "CONFIG"
+	ConfigFlag = "config"
+)
+
+var ErrInvalid = errors.New("invalid configuration")
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Options controls where Load reads configuration from
+type Options struct {
+	Path      string                      // File read unless -config or VWS_CONFIG is set; skipped if missing
+	Args      []string                    // Command line arguments without the program name
+	LookupEnv func(string) (string, bool) // Defaults to os.LookupEnv
+}
+
+// Load builds the configuration from, in increasing precedence, the
+// defaults, a JSON or YAML file, VWS_* environment variables and command
+// line flags such as -security.tokenExpiry=1h. Durations are written like
+// "90s" or "1h30m". Secrets configured as files are read last.
+//
+// Flags must come before any subcommand; the arguments left after them
+// are returned. Load reports every problem it finds at once but does not
+// check the values themselves, which is Validate's job.
+func Load(opts Options) (*Config, []string, error) {
+	lookupEnv := opts.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	cfg := Default()
+	fields := leaves(reflect.ValueOf(cfg).Elem(), nil)
+
+	flags := flag.NewFlagSet("vws-backend", flag.ContinueOnError)
+	configPath := flags.String(ConfigFlag, "", "configuration file, JSON or YAML (env "+ConfigEnv+")")
+	byFlag := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byFlag[f.flagName()] = f
+		flags.Var(&flagValue{isBool: f.value.Kind() == reflect.Bool}, f.flagName(), "env "+f.envName())
+	}
+	if err := flags.Parse(opts.Args); err != nil {
+		return nil, nil, err
+	}
+
+	var problems []string
+
+	path, explicit := opts.Path, false
+	if env, ok := lookupEnv(ConfigEnv); ok && env != "" {
+		path, explicit = env, true
+	}
+	if *configPath != "" {
+		path, explicit = *configPath, true
+	}
+	if path != "" {
+		doc, err := readFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist) && !explicit:
+		case err != nil:
+			problems = append(problems, err.Error())
+		default:
+			problems = applyMap(reflect.ValueOf(cfg).Elem(), doc, "", problems)
+			cfg.source = path
+		}
+	}
+
+	for _, f := range fields {
+		if raw, ok := lookupEnv(f.envName()); ok {
+			problems = setValue(f.value, raw, f.envName(), problems)
+		}
+	}
+
+	flags.Visit(func(fl *flag.Flag) {
+		if f, ok := byFlag[fl.Name]; ok {
+			problems = setValue(f.value, fl.Value.String(), "-"+fl.Name, problems)
+		}
+	})
+
+	if err := readSecret(&cfg.Security.JWTSecret, cfg.Security.JWTSecretFile, "security.jwtSecret"); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := readSecret(&cfg.Blockchain.PrivateKey, cfg.Blockchain.PrivateKeyFile, "blockchain.privateKey"); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, fmt.Errorf("%w:\n  %s", ErrInvalid, strings.Join(problems, "\n  "))
+	}
+	return cfg, flags.Args(), nil
+}
+
+// field is a configurable value, anything but a nested settings struct
+type field struct {
+	path  []string
+	value reflect.Value
+}
+
+func (f field) flagName() string {
+	return strings.Join(f.path, ".")
+}
+
+func (f field) envName() string {
+	parts := make([]string, len(f.path))
+	for i, name := range f.path {
+		parts[i] = upperSnake(name)
+	}
+	return EnvPrefix + strings.Join(parts, "_")
+}
+
+// leaves lists the configurable values below v, which must be a struct
+func leaves(v reflect.Value, path []string) []field {
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		name := jsonName(v.Type().Field(i))
+		if name == "" {
+			continue
+		}
+		fieldPath := append(append([]string(nil), path...), name)
+		value := v.Field(i)
+		if value.Kind() == reflect.Struct && value.Type() != durationType {
+			fields = append(fields, leaves(value, fieldPath)...)
+			continue
+		}
+		fields = append(fields, field{path: fieldPath, value: value})
+	}
+	return fields
+}
+
+func jsonName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// upperSnake turns a camel case name into upper snake case, keeping
+// acronyms together: "redisURL" becomes "REDIS_URL"
+func upperSnake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// readFile decodes a YAML file, recognised by its extension, or a JSON one
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// applyMap sets the fields of the struct v named in doc, leaving the
+// others untouched
+func applyMap(v reflect.Value, doc map[string]any, path string, problems []string) []string {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		value, ok := structField(v, key)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting", fieldPath))
+			continue
+		}
+		problems = setValue(value, doc[key], fieldPath, problems)
+	}
+	return problems
+}
+
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if tag := jsonName(v.Type().Field(i)); tag != "" && strings.EqualFold(tag, name) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setValue stores raw, decoded from a file or read as a string from the
+// environment or a flag, in v
+func setValue(v reflect.Value, raw any, path string, problems []string) []string {
+	fail := func(format string, args ...any) []string {
+		return append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if raw == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return problems
+	}
+
+	if v.Type() == durationType {
+		if s, ok := raw.(string); ok {
+			d, err := time.ParseDuration(strings.TrimSpace(s))
+			if err != nil {
+				return fail("expected a duration such as \"30s\" or \"1h\", got %q", s)
+			}
+			v.SetInt(int64(d))
+			return problems
+		}
+		// Bare numbers are nanoseconds, as encoding/json writes them
+		n, err := toInt(raw)
+		if err != nil {
+			return fail("expected a duration such as \"30s\" or \"1h\"")
+		}
+		v.SetInt(n)
+		return problems
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return fail("expected a string")
+		}
+		v.SetString(s)
+
+	case reflect.Bool:
+		switch b := raw.(type) {
+		case bool:
+			v.SetBool(b)
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(b))
+			if err != nil {
+				return fail("expected true or false, got %q", b)
+			}
+			v.SetBool(parsed)
+		default:
+			return fail("expected true or false")
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt(raw)
+		if err != nil || v.OverflowInt(n) {
+			return fail("expected an integer")
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := toInt(raw)
+		if err != nil || n < 0 || v.OverflowUint(uint64(n)) {
+			return fail("expected a non-negative integer")
+		}
+		v.SetUint(uint64(n))
+
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(raw)
+		if err != nil {
+			return fail("expected a number")
+		}
+		v.SetFloat(f)
+
+	case reflect.Slice:
+		items, ok := raw.([]any)
+		if s, isString := raw.(string); isString {
+			// The environment and flags hold lists of strings as
+			// comma separated values and anything else as JSON
+			if v.Type().Elem().Kind() == reflect.String {
+				items, ok = splitList(s), true
+			} else {
+				decoder := json.NewDecoder(strings.NewReader(s))
+				decoder.UseNumber()
+				if err := decoder.Decode(&items); err != nil {
+					return fail("expected a JSON list: %v", err)
+				}
+				ok = true
+			}
+		}
+		if !ok {
+			return fail("expected a list")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			problems = setValue(slice.Index(i), item, fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+		v.Set(slice)
+
+	case reflect.Struct:
+		doc, ok := raw.(map[string]any)
+		if !ok {
+			return fail("expected an object")
+		}
+		problems = applyMap(v, doc, path, problems)
+
+	default:
+		return fail("unsupported setting type %s", v.Type())
+	}
+	return problems
+}
+
+func splitList(s string) []any {
+	var items []any
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func toInt(raw any) (int64, error) {
+	switch n := raw.(type) {
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint64:
+		if n > 1<<63-1 {
+			return 0, strconv.ErrRange
+		}
+		return int64(n), nil
+	case json.Number:
+		return strconv.ParseInt(n.String(), 10, 64)
+	case float64:
+		if n != float64(int64(n)) {
+			return 0, strconv.ErrSyntax
+		}
+		return int64(n), nil
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+	}
+	return 0, strconv.ErrSyntax
+}
+
+func toFloat(raw any) (float64, error) {
+	switch n := raw.(type) {
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case json.Number:
+		return n.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(n), 64)
+	}
+	return 0, strconv.ErrSyntax
+}
+
+// readSecret replaces *value with the trimmed contents of file, so secrets
+// can be mounted rather than written into the configuration
+func readSecret(value *string, file, name string) error {
+	if file == "" {
+		return nil
+	}
+	if *value != "" {
+		return fmt.Errorf("%s and %sFile are both set, use one", name, name)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("%sFile: %w", name, err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return fmt.Errorf("%sFile: %s is empty", name, file)
+	}
+	*value = secret
+	return nil
+}
+
+// flagValue holds a flag's raw value until the lower layers are applied
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *flagValue) Set(s string) error {
+	f.value = s
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNotReloadable = errors.New("settings that need a restart changed")
+
+// staticSettings are read once at startup. A reload changing any of them,
+// or anything below them, is rejected as a whole.
+var staticSettings = []string{
+	"server",
+	"database",
+	"blockchain",
+	"cache",
+	"health",
+	"tracing",
+	"reload",
+	"security.jwtSecret",
+	"security.jwtSecretFile",
+	"security.jwtIssuer",
+	"security.tokenExpiry",
+	"security.refreshExpiry",
+	"security.idempotencyTTL",
+	"security.idempotencyLockTimeout",
+	"security.cors.domainReload",
+	"faceDetection.maxFileSize",
+	"faceDetection.allowedTypes",
+	"faceDetection.maxPixels",
+}
+
+// Store holds the running configuration and replaces it on reload.
+// Readers always see a complete, validated configuration.
+type Store struct {
+	current atomic.Pointer[Config]
+	load    func() (*Config, error)
+
+	mu          sync.Mutex // Serializes reloads
+	subscribers []func(*Config)
+}
+
+// NewStore creates a store holding cfg, reloaded by calling load. It also
+// makes cfg the configuration GetConfig returns.
+func NewStore(cfg *Config, load func() (*Config, error)) *Store {
+	s := &Store{load: load}
+	s.current.Store(cfg)
+	setCurrent(cfg)
+	return s
+}
+
+// Get returns the current configuration, which must not be modified
+func (s *Store) Get() *Config {
+	return s.current.Load()
+}
+
+// Subscribe registers fn to be called with the new configuration after
+// every successful reload. Subscribers run one at a time, in the order
+// they subscribed.
+func (s *Store) Subscribe(fn func(*Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Reload loads and validates the configuration again and swaps it in. The
+// running configuration is kept if the new one is invalid or changes a
+// setting that needs a restart.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := next.Validate(); err != nil {
+		return err
+	}
+
+	current := s.current.Load()
+	if reflect.DeepEqual(current, next) {
+		return nil
+	}
+	if changed := staticChanges(current, next); len(changed) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotReloadable, strings.Join(changed, ", "))
+	}
+
+	s.current.Store(next)
+	setCurrent(next)
+	for _, fn := range s.subscribers {
+		fn(next)
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever a signal arrives on signals,
+// typically SIGHUP, and when the configuration file's modification time
+// or size changes. The file is checked every interval; zero disables the
+// check. Outcomes are logged. Watch returns once ctx is done.
+func (s *Store) Watch(ctx context.Context, signals <-chan os.Signal, interval time.Duration) {
+	var tick <-chan time.Time
+	path := s.Get().Source()
+	if interval > 0 && path != "" {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	last := statFile(path)
+
+	for {
+		var trigger string
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			trigger = sig.String()
+		case <-tick:
+			stat := statFile(path)
+			if stat == last {
+				continue
+			}
+			last = stat
+			trigger = "file change"
+		}
+
+		if err := s.Reload(); err != nil {
+			slog.Error("configuration reload rejected, keeping the running configuration",
+				"trigger", trigger, "path", path, "error", err)
+			continue
+		}
+		slog.Info("configuration reloaded", "trigger", trigger, "path", path)
+	}
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileStat {
+	if path == "" {
+		return fileStat{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}
+	}
+	return fileStat{modTime: info.ModTime(), size: info.Size()}
+}
+
+// staticChanges lists the static settings that differ between a and b
+func staticChanges(a, b *Config) []string {
+	bFields := leaves(reflect.ValueOf(b).Elem(), nil)
+	var changed []string
+	for i, f := range leaves(reflect.ValueOf(a).Elem(), nil) {
+		name := f.flagName()
+		if isStatic(name) && !reflect.DeepEqual(f.value.Interface(), bFields[i].value.Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+func isStatic(name string) bool {
+	for _, static := range staticSettings {
+		if name == static || strings.HasPrefix(name, static+".") {
+			return true
+		}
+	}
+	return false
+}
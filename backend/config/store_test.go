@@ -0,0 +1,131 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reloadable writes a valid configuration file and returns a store that
+// reloads from it
+func reloadable(t *testing.T, content string) (*Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	model := filepath.Join(dir, "model.onnx")
+	require.NoError(t, os.WriteFile(model, []byte("model"), 0o600))
+
+	opts := Options{
+		Path: filepath.Join(dir, "config.json"),
+		LookupEnv: env(map[string]string{
+			"VWS_FACE_DETECTION_MODEL_PATH":             model,
+			"VWS_FACE_DETECTION_RECOGNITION_MODEL_PATH": model,
+			"VWS_SECURITY_JWT_SECRET":                   strings.Repeat("s", MinJWTSecretLength),
+		}),
+	}
+	require.NoError(t, os.WriteFile(opts.Path, []byte(content), 0o600))
+
+	load := func() (*Config, error) {
+		cfg, _, err := Load(opts)
+		return cfg, err
+	}
+	cfg, err := load()
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	return NewStore(cfg, load), opts.Path
+}
+
+func TestStore_Reload(t *testing.T) {
+	store, path := reloadable(t, `{"security": {"allowedOrigins": ["https://a.example"]}}`)
+	assert.Same(t, store.Get(), GetConfig())
+
+	var notified []*Config
+	store.Subscribe(func(cfg *Config) { notified = append(notified, cfg) })
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"security": {"allowedOrigins": ["https://b.example"]}}`), 0o600))
+	require.NoError(t, store.Reload())
+
+	assert.Equal(t, []string{"https://b.example"}, store.Get().Security.AllowedOrigins)
+	assert.Same(t, store.Get(), GetConfig())
+	require.Len(t, notified, 1)
+	assert.Same(t, store.Get(), notified[0])
+
+	require.NoError(t, store.Reload())
+	assert.Len(t, notified, 1, "an unchanged configuration notifies nobody")
+}
+
+func TestStore_ReloadRejectsStaticChanges(t *testing.T) {
+	store, path := reloadable(t, `{"server": {"port": 8080}}`)
+	before := store.Get()
+	store.Subscribe(func(*Config) { t.Error("subscriber called for a rejected reload") })
+
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"server": {"port": 9090},
+		"database": {"url": "postgres://other/vws"},
+		"logging": {"level": "debug"}
+	}`), 0o600))
+	err := store.Reload()
+	require.ErrorIs(t, err, ErrNotReloadable)
+	assert.Contains(t, err.Error(), "server.port")
+	assert.Contains(t, err.Error(), "database.url")
+	assert.NotContains(t, err.Error(), "logging.level")
+	assert.Same(t, before, store.Get())
+}
+
+func TestStore_ReloadRejectsInvalid(t *testing.T) {
+	store, path := reloadable(t, `{}`)
+	before := store.Get()
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"security": {"rateWindow": "0s"}}`), 0o600))
+	assert.ErrorIs(t, store.Reload(), ErrInvalid)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"security": `), 0o600))
+	assert.Error(t, store.Reload())
+	assert.Same(t, before, store.Get())
+}
+
+func TestStore_Watch(t *testing.T) {
+	store, path := reloadable(t, `{"logging": {"level": "info"}}`)
+	reloaded := make(chan *Config, 2)
+	store.Subscribe(func(cfg *Config) { reloaded <- cfg })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	go store.Watch(ctx, signals, 10*time.Millisecond)
+
+	// Keep moving the modification time forward until the watcher, which
+	// may not have taken its first look yet, notices
+	require.NoError(t, os.WriteFile(path, []byte(`{"logging": {"level": "warn"}}`), 0o600))
+	later := time.Now()
+	deadline := time.After(2 * time.Second)
+	var cfg *Config
+	for cfg == nil {
+		later = later.Add(time.Second)
+		require.NoError(t, os.Chtimes(path, later, later))
+		select {
+		case cfg = <-reloaded:
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("file change did not trigger a reload")
+		}
+	}
+	assert.Equal(t, "warn", cfg.Logging.Level)
+
+	// Same size and modification time, so only the signal notices
+	require.NoError(t, os.WriteFile(path, []byte(`{"logging": {"level": "info"}}`), 0o600))
+	require.NoError(t, os.Chtimes(path, later, later))
+	signals <- syscall.SIGHUP
+	select {
+	case cfg := <-reloaded:
+		assert.Equal(t, "info", cfg.Logging.Level)
+	case <-time.After(2 * time.Second):
+		t.Fatal("signal did not trigger a reload")
+	}
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MinJWTSecretLength is the shortest secret accepted for signing tokens,
+// the size of an HS256 key
+const MinJWTSecretLength = 32
+
+// Validate checks the configuration a server needs and reports every
+// problem at once, so a broken deployment is fixed in one go
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port: %d is not a valid port", c.Server.Port)
+	check(c.Server.WriteTimeout > 0, "server.writeTimeout: must be positive")
+	check(c.Server.MetricsPort > 0 && c.Server.MetricsPort <= 65535, "server.metricsPort: %d is not a valid port", c.Server.MetricsPort)
+	check(c.Server.MetricsPort != c.Server.Port, "server.metricsPort: must differ from server.port, metrics are not served publicly")
+
+	checkModel(&problems, "faceDetection.modelPath", c.FaceDetection.ModelPath)
+	checkModel(&problems, "faceDetection.recognitionModelPath", c.FaceDetection.RecognitionModelPath)
+	check(c.FaceDetection.MaxFileSize > 0, "faceDetection.maxFileSize: must be positive")
+	check(len(c.FaceDetection.AllowedTypes) > 0, "faceDetection.allowedTypes: at least one type is required")
+	for i, t := range c.FaceDetection.AllowedTypes {
+		check(t == "image/jpeg" || t == "image/png" || t == "image/webp",
+			"faceDetection.allowedTypes[%d]: expected \"image/jpeg\", \"image/png\" or \"image/webp\", got %q", i, t)
+	}
+	check(c.FaceDetection.MaxPixels > 0, "faceDetection.maxPixels: must be positive")
+	check(c.FaceDetection.ScoreThreshold > 0 && c.FaceDetection.ScoreThreshold <= 1, "faceDetection.scoreThreshold: must be above 0 and at most 1")
+	check(c.FaceDetection.IoUThreshold >= 0 && c.FaceDetection.IoUThreshold <= 1, "faceDetection.iouThreshold: must be between 0 and 1")
+	check(c.FaceDetection.MatchThreshold >= -1 && c.FaceDetection.MatchThreshold <= 1, "faceDetection.matchThreshold: must be between -1 and 1")
+	check(c.FaceDetection.LivenessThreshold >= 0 && c.FaceDetection.LivenessThreshold <= 1, "faceDetection.livenessThreshold: must be between 0 and 1")
+	check(c.FaceDetection.DuplicateThreshold >= -1 && c.FaceDetection.DuplicateThreshold <= 1, "faceDetection.duplicateThreshold: must be between -1 and 1")
+
+	checkURL(&problems, "blockchain.networkURL", c.Blockchain.NetworkURL, "http", "https", "ws", "wss")
+	check(common.IsHexAddress(c.Blockchain.ContractAddr), "blockchain.contractAddr: %q is not an address", c.Blockchain.ContractAddr)
+	check(c.Blockchain.ChainID > 0, "blockchain.chainId: must be positive")
+	check(c.Blockchain.GasLimit > 0, "blockchain.gasLimit: must be positive")
+	check(c.Blockchain.MaxRetries >= 0, "blockchain.maxRetries: must not be negative")
+	check(c.Blockchain.ConfirmBlocks >= 0, "blockchain.confirmBlocks: must not be negative")
+	if c.Blockchain.PrivateKey != "" {
+		// Never echo the key itself
+		key, err := hex.DecodeString(strings.TrimPrefix(c.Blockchain.PrivateKey, "0x"))
+		check(err == nil && len(key) == 32, "blockchain.privateKey: expected 32 hex encoded bytes")
+	}
+
+	if c.Security.JWTSecret == "" {
+		problems = append(problems, "security.jwtSecret: required, set it or security.jwtSecretFile")
+	} else {
+		check(len(c.Security.JWTSecret) >= MinJWTSecretLength, "security.jwtSecret: must be at least %d bytes", MinJWTSecretLength)
+	}
+	check(c.Security.RequestsPerWindow > 0, "security.requestsPerWindow: must be positive")
+	check(c.Security.RateWindow > 0, "security.rateWindow: must be positive")
+	check(c.Security.TokenExpiry > 0, "security.tokenExpiry: must be positive")
+	check(c.Security.RefreshExpiry > c.Security.TokenExpiry, "security.refreshExpiry: must be longer than security.tokenExpiry")
+	check(c.Security.IdempotencyTTL > 0, "security.idempotencyTTL: must be positive")
+	// A request still running when its lock runs out would be repeated by
+	// a retry taking the key over
+	check(c.Security.IdempotencyLockTimeout > c.Server.WriteTimeout, "security.idempotencyLockTimeout: must be longer than server.writeTimeout")
+	check(c.Security.IdempotencyLockTimeout < c.Security.IdempotencyTTL, "security.idempotencyLockTimeout: must be shorter than security.idempotencyTTL")
+	for i, rule := range c.Security.RateLimits {
+		path := fmt.Sprintf("security.rateLimits[%d]", i)
+		method, route, ok := strings.Cut(rule.Route, " ")
+		check(ok && method != "" && strings.HasPrefix(route, "/"), "%s.route: expected \"METHOD /path\", got %q", path, rule.Route)
+		check(rule.Requests > 0, "%s.requests: must be positive", path)
+		check(rule.Window > 0, "%s.window: must be positive", path)
+		check(rule.Burst >= 0, "%s.burst: must not be negative", path)
+		check(rule.KeyBy == "" || rule.KeyBy == "ip" || rule.KeyBy == "user" || rule.KeyBy == "apiKey",
+			"%s.keyBy: expected \"ip\", \"user\" or \"apiKey\", got %q", path, rule.KeyBy)
+	}
+	check(!c.Security.CORS.AllowCredentials || !slices.Contains(c.Security.AllowedOrigins, "*"),
+		"security.allowedOrigins: \"*\" allows every site, it cannot be combined with security.cors.allowCredentials")
+	check(c.Security.CORS.MaxAge >= 0, "security.cors.maxAge: must not be negative")
+	check(c.Security.CORS.DomainReload > 0, "security.cors.domainReload: must be positive")
+	for i, rule := range c.Security.CORS.Rules {
+		check(strings.HasPrefix(rule.PathPrefix, "/"), "security.cors.rules[%d].pathPrefix: must start with /", i)
+	}
+
+	if c.Cache.RedisURL != "" {
+		checkURL(&problems, "cache.redisURL", c.Cache.RedisURL, "redis", "rediss")
+	}
+	switch c.Database.Backend {
+	case "postgres":
+		checkURL(&problems, "database.url", c.Database.URL, "postgres", "postgresql")
+	case "memory":
+	default:
+		problems = append(problems, fmt.Sprintf("database.backend: expected \"postgres\" or \"memory\", got %q", c.Database.Backend))
+	}
+
+	check(c.Health.CheckTimeout > 0, "health.checkTimeout: must be positive")
+	check(c.Health.CacheTTL >= 0, "health.cacheTTL: must not be negative")
+	check(c.Health.MaxBlockAge >= 0, "health.maxBlockAge: must not be negative")
+
+	check(c.Reload.WatchInterval >= 0, "reload.watchInterval: must not be negative")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Logging.Level)) == nil,
+		"logging.level: expected \"debug\", \"info\", \"warn\" or \"error\", got %q", c.Logging.Level)
+
+	switch c.Tracing.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter: expected \"otlp\", \"stdout\" or empty, got %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio: must be between 0 and 1")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w:\n  %s", ErrInvalid, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkFile checks that path names a file that exists
+func checkFile(problems *[]string, name, path string) {
+	if path == "" {
+		*problems = append(*problems, name+": required")
+		return
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		*problems = append(*problems, fmt.Sprintf("%s: %v", name, err))
+	case info.IsDir():
+		*problems = append(*problems, fmt.Sprintf("%s: %s is a directory", name, path))
+	}
+}
+
+// checkModel checks that path names a model file like checkFile, pointing
+// at make models when it is missing
+func checkModel(problems *[]string, name, path string) {
+	if _, err := os.Stat(path); path != "" && errors.Is(err, fs.ErrNotExist) {
+		*problems = append(*problems, fmt.Sprintf("%s: %s does not exist, fetch the models with make models", name, path))
+		return
+	}
+	checkFile(problems, name, path)
+}
+
+// checkURL records a problem unless raw is a URL with one of schemes. The
+// URL is left out of the message since it may hold a password.
+func checkURL(problems *[]string, path, raw string, schemes ...string) {
+	if raw == "" {
+		*problems = append(*problems, path+": required")
+		return
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		*problems = append(*problems, path+": not a valid URL")
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return
+		}
+	}
+	*problems = append(*problems, fmt.Sprintf("%s: expected a %s URL", path, strings.Join(schemes, " or ")))
+}
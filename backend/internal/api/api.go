@@ -0,0 +1,90 @@
+// Package api assembles the handlers into the routes the server serves and
+// the OpenAPI document describing them
+package api
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	analyticsHandler "vws-backend/internal/handler/analytics"
+	enterpriseHandler "vws-backend/internal/handler/enterprise"
+	faceHandler "vws-backend/internal/handler/face"
+	healthHandler "vws-backend/internal/handler/health"
+	tokenHandler "vws-backend/internal/handler/token"
+	userHandler "vws-backend/internal/handler/user"
+	verificationHandler "vws-backend/internal/handler/verification"
+	"vws-backend/internal/openapi"
+)
+
+// Info describes the API in its document
+var Info = openapi.Info{Title: "VWS API", Version: "1.0.0"}
+
+// IdempotentRoutes honour the Idempotency-Key header. Clients on flaky
+// networks retry them, and repeating them would spend or vote twice.
+var IdempotentRoutes = []string{
+	"POST /api/tokens/convert",
+	"POST /api/tokens/stake",
+	"POST /api/tokens/transfer",
+	"POST /api/enterprise/votes/:id/responses",
+}
+
+// Handlers are the handlers serving the API
+type Handlers struct {
+	Health       *healthHandler.Handler
+	Face         *faceHandler.Handler
+	User         *userHandler.Handler
+	Token        *tokenHandler.Handler
+	Verification *verificationHandler.Handler
+	Analytics    *analyticsHandler.Handler
+	Enterprise   *enterpriseHandler.Handler
+}
+
+// Register registers every route and builds the OpenAPI document
+// describing them. Protected routes require authentication, enterprise
+// routes also accept organization API keys.
+func Register(router *gin.Engine, spec *openapi.Spec, protected, enterpriseProtected []gin.HandlerFunc, h Handlers) error {
+	// Public routes
+	h.Health.RegisterRoutes(router)
+	router.GET("/api/openapi.json", spec.Serve)
+
+	// User routes (login and registration are public)
+	h.User.RegisterRoutes(router, protected...)
+
+	// Protected routes
+	h.Face.RegisterRoutes(router, protected...)
+	h.Token.RegisterRoutes(router, protected...)
+	h.Verification.RegisterRoutes(router, protected...)
+	h.Analytics.RegisterRoutes(router, protected...)
+	h.Enterprise.RegisterRoutes(router, enterpriseProtected...)
+
+	return spec.Build(router.Routes(), slices.Concat(
+		spec.Routes(),
+		h.Health.Routes(),
+		h.User.Routes(),
+		h.Face.Routes(),
+		h.Token.Routes(),
+		h.Verification.Routes(),
+		h.Analytics.Routes(),
+		h.Enterprise.Routes(),
+	)...)
+}
+
+// Document builds the document without any services behind the routes,
+// for tools that only need the description
+func Document() (*openapi.Document, error) {
+	spec := openapi.New(Info)
+	err := Register(gin.New(), spec, nil, nil, Handlers{
+		Health:       healthHandler.NewHandler(nil),
+		Face:         faceHandler.NewHandler(nil, nil, nil, faceHandler.UploadConfig{}),
+		User:         userHandler.NewHandler(nil, nil, 0),
+		Token:        tokenHandler.NewHandler(nil),
+		Verification: verificationHandler.NewHandler(nil),
+		Analytics:    analyticsHandler.NewHandler(nil),
+		Enterprise:   enterpriseHandler.NewHandler(nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return spec.Document(), nil
+}
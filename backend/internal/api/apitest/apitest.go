@@ -0,0 +1,115 @@
+// Package apitest serves the real routes on the in-memory store so tests
+// can drive the API end to end
+package apitest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vws-backend/internal/api"
+	"vws-backend/internal/auth"
+	analyticsHandler "vws-backend/internal/handler/analytics"
+	enterpriseHandler "vws-backend/internal/handler/enterprise"
+	faceHandler "vws-backend/internal/handler/face"
+	healthHandler "vws-backend/internal/handler/health"
+	tokenHandler "vws-backend/internal/handler/token"
+	userHandler "vws-backend/internal/handler/user"
+	verificationHandler "vws-backend/internal/handler/verification"
+	"vws-backend/internal/health"
+	"vws-backend/internal/idempotency"
+	"vws-backend/internal/middleware"
+	"vws-backend/internal/openapi"
+	analyticsService "vws-backend/internal/service/analytics"
+	enterpriseService "vws-backend/internal/service/enterprise"
+	faceService "vws-backend/internal/service/face"
+	"vws-backend/internal/service/face/facetest"
+	tokenService "vws-backend/internal/service/token"
+	userService "vws-backend/internal/service/user"
+	verificationService "vws-backend/internal/service/verification"
+	"vws-backend/internal/store/memory"
+)
+
+// Server is the API and the services behind it, for tests to arrange
+// state the API offers no route for
+type Server struct {
+	Router *gin.Engine
+	Spec   *openapi.Spec
+	Tokens *tokenService.Service
+	Users  *userService.Service
+}
+
+// Limits of the images uploaded, small for tests to exceed cheaply
+const (
+	UploadMaxFileSize = 256 << 10
+	UploadMaxPixels   = 1024 * 1024
+)
+
+// New builds the API, running the handlers in use before every route.
+// Traffic is validated against the API document, failing the test on any
+// request or response that doesn't match it.
+func New(t testing.TB, use ...gin.HandlerFunc) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	s := &Server{Router: gin.New(), Spec: openapi.New(api.Info)}
+	s.Router.Use(use...)
+	s.Router.Use(s.Spec.Validate(func(c *gin.Context, err error) {
+		t.Error(err)
+	}))
+	s.Router.Use(middleware.Errors())
+
+	repos := memory.New()
+	tokens, err := auth.NewTokenManager("test-secret-that-is-long-enough-for-hs256", time.Hour, "vws-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	faceSvc, err := faceService.NewService(facetest.WriteModel(t), faceService.DefaultThresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { faceSvc.Close() })
+	faceVerifier, err := faceService.NewVerifier(faceSvc, repos.Faces(),
+		facetest.WriteRecognitionModel(t), faceService.DefaultMatchThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { faceVerifier.Close() })
+	verificationSvc, err := verificationService.NewService(repos.Verification(),
+		"http://localhost:8545", "0x0000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { verificationSvc.Close() })
+
+	s.Users = userService.NewService(repos.Users())
+	s.Tokens = tokenService.NewService(repos.Tokens(), repos.Faces())
+	enterpriseSvc := enterpriseService.NewService(repos.Enterprise())
+	authMiddleware := middleware.Auth(tokens, s.Users)
+	idempotent := middleware.Idempotency(idempotency.NewMemoryStore(), middleware.IdempotencyConfig{
+		Routes: api.IdempotentRoutes,
+		TTL:    time.Hour,
+	})
+	uploads := faceHandler.UploadConfig{
+		MaxFileSize:  UploadMaxFileSize,
+		AllowedTypes: []string{"image/jpeg", "image/png", "image/webp"},
+		MaxPixels:    UploadMaxPixels,
+	}
+	err = api.Register(s.Router, s.Spec,
+		[]gin.HandlerFunc{authMiddleware, idempotent},
+		[]gin.HandlerFunc{middleware.APIKeyAuth(enterpriseSvc, authMiddleware), idempotent},
+		api.Handlers{
+			Health:       healthHandler.NewHandler(health.NewChecker(time.Second)),
+			Face:         faceHandler.NewHandler(faceSvc, faceVerifier, s.Users, uploads),
+			User:         userHandler.NewHandler(s.Users, tokens, time.Hour),
+			Token:        tokenHandler.NewHandler(s.Tokens),
+			Verification: verificationHandler.NewHandler(verificationSvc),
+			Analytics:    analyticsHandler.NewHandler(analyticsService.NewService(repos.Analytics())),
+			Enterprise:   enterpriseHandler.NewHandler(enterpriseSvc),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
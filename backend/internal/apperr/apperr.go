@@ -0,0 +1,79 @@
+// Package apperr defines the errors the API reports to clients. Every
+// error has a kind, which decides the status it is answered with, a stable
+// code clients can match on and a message that is safe to show them.
+// Errors of any other type are internal: they are logged, and clients only
+// learn that something went wrong.
+package apperr
+
+import "errors"
+
+// Kinds of error, matched with errors.Is
+var (
+	ErrInvalid        = errors.New("invalid request")
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrForbidden      = errors.New("forbidden")
+	ErrNotFound       = errors.New("not found")
+	ErrConflict       = errors.New("conflict")
+	ErrTooLarge       = errors.New("request too large")
+	ErrUnsupported    = errors.New("unsupported media type")
+	ErrUnprocessable  = errors.New("unprocessable request")
+	ErrRateLimited    = errors.New("rate limit exceeded")
+	ErrNotImplemented = errors.New("not implemented")
+)
+
+// Error is an error clients are told about
+type Error struct {
+	Kind    error
+	Code    string            // Stable, snake_case identifier of the error
+	Message string            // Human readable, shown to clients
+	Details map[string]string // Problems with individual fields, if any
+}
+
+// New creates an error of the given kind. Services declare their errors
+// with it, so handlers don't need to know how to report them:
+//
+//	var ErrVoteNotFound = apperr.New(apperr.ErrNotFound, "vote_not_found", "vote not found")
+func New(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the kind of the error
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// WithDetails returns a copy of the error describing problems with fields
+func (e *Error) WithDetails(details map[string]string) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// Invalid reports a request that can't be served as sent
+func Invalid(message string) *Error {
+	return New(ErrInvalid, "invalid_request", message)
+}
+
+// Unauthorized reports a request without valid credentials
+func Unauthorized(message string) *Error {
+	return New(ErrUnauthorized, "unauthorized", message)
+}
+
+// Forbidden reports a caller lacking permission for a request
+func Forbidden(message string) *Error {
+	return New(ErrForbidden, "forbidden", message)
+}
+
+// NotFound reports a missing resource
+func NotFound(message string) *Error {
+	return New(ErrNotFound, "not_found", message)
+}
+
+// NotImplemented reports a route that is documented but not served yet
+func NotImplemented(message string) *Error {
+	return New(ErrNotImplemented, "not_implemented", message)
+}
@@ -0,0 +1,68 @@
+package apperr_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/apperr"
+)
+
+var errVoteNotFound = apperr.New(apperr.ErrNotFound, "vote_not_found", "vote not found")
+
+func TestError(t *testing.T) {
+	err := error(errVoteNotFound)
+	assert.Equal(t, "vote not found", err.Error())
+	assert.ErrorIs(t, err, apperr.ErrNotFound)
+	assert.NotErrorIs(t, err, apperr.ErrConflict)
+
+	var appErr *apperr.Error
+	require.ErrorAs(t, errors.Join(errors.New("context"), err), &appErr)
+	assert.Equal(t, "vote_not_found", appErr.Code)
+
+	detailed := errVoteNotFound.WithDetails(map[string]string{"id": "is unknown"})
+	assert.Nil(t, errVoteNotFound.Details, "sentinels are not modified")
+	assert.Equal(t, "is unknown", detailed.Details["id"])
+}
+
+type registerRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8"`
+	Age      int    `json:"age" binding:"omitempty,gt=12"`
+}
+
+func TestBinding(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body    string
+		message string
+		details map[string]string
+	}{
+		"rules": {`{"email": "carol", "password": "short", "age": 3}`, "invalid request", map[string]string{
+			"username": "is required",
+			"email":    "must be an email address",
+			"password": "must be at least 8 characters",
+			"age":      "must be greater than 12",
+		}},
+		"type":   {`{"username": 7}`, "invalid request", map[string]string{"username": "must be a string"}},
+		"syntax": {`{"username": `, "request body is not valid JSON", nil},
+		"empty":  {``, "request body is empty", nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+
+			var req registerRequest
+			err := apperr.Binding(c.ShouldBindJSON(&req))
+			assert.ErrorIs(t, err, apperr.ErrInvalid)
+			assert.Equal(t, "invalid_request", err.Code)
+			assert.Equal(t, tc.message, err.Message)
+			assert.Equal(t, tc.details, err.Details)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Name fields in validation errors as clients send them
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(fieldName)
+	}
+}
+
+// Binding describes why a request couldn't be bound, without repeating
+// the decoder's messages, which name Go types
+func Binding(err error) *Error {
+	var (
+		validation validator.ValidationErrors
+		typeErr    *json.UnmarshalTypeError
+		syntaxErr  *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &validation):
+		details := make(map[string]string, len(validation))
+		for _, fe := range validation {
+			details[fe.Field()] = problem(fe)
+		}
+		return Invalid("invalid request").WithDetails(details)
+	case errors.As(err, &typeErr):
+		return Invalid("invalid request").WithDetails(map[string]string{typeErr.Field: "must be " + jsonType(typeErr.Type)})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return Invalid("request body is not valid JSON")
+	case errors.Is(err, io.EOF):
+		return Invalid("request body is empty")
+	default:
+		return Invalid("invalid request")
+	}
+}
+
+// problem describes a failed validation rule
+func problem(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be an email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return "must be at least " + fe.Param() + " characters"
+		}
+		return "must be at least " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	default:
+		return "fails the " + fe.Tag() + " rule"
+	}
+}
+
+// jsonType names the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// fieldName names a struct field by its JSON or form name
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
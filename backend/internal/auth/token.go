@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrMissingSecret = errors.New("jwt secret cannot be empty")
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrExpiredToken  = errors.New("token has expired")
+)
+
+// DefaultIssuer is used when no issuer is configured
+const DefaultIssuer = "vws-backend"
+
+// Claims represents the claims carried by an access token
+type Claims struct {
+	SessionID int64 `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the user ID stored in the token subject
+func (c *Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+// TokenManager issues and validates signed access tokens
+type TokenManager struct {
+	secret []byte
+	expiry time.Duration
+	issuer string
+	now    func() time.Time
+}
+
+// NewTokenManager creates a new token manager
+func NewTokenManager(secret string, expiry time.Duration, issuer string) (*TokenManager, error) {
+	if secret == "" {
+		return nil, ErrMissingSecret
+	}
+	if expiry <= 0 {
+		expiry = 24 * time.Hour
+	}
+	if issuer == "" {
+		issuer = DefaultIssuer
+	}
+
+	return &TokenManager{
+		secret: []byte(secret),
+		expiry: expiry,
+		issuer: issuer,
+		now:    time.Now,
+	}, nil
+}
+
+// IssueAccessToken creates a signed access token for the given user session
+func (m *TokenManager) IssueAccessToken(userID, sessionID int64) (string, time.Time, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := m.now()
+	expiresAt := now.Add(m.expiry)
+	claims := Claims{
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    m.issuer,
+			Subject:   strconv.FormatInt(userID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken verifies the token signature, expiry and issuer and returns its claims
+func (m *TokenManager) ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			return m.secret, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(m.now),
+	)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrExpiredToken
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if _, err := claims.UserID(); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// Expiry returns the lifetime of issued access tokens
+func (m *TokenManager) Expiry() time.Duration {
+	return m.expiry
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
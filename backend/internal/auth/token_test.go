@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTokenManager_EmptySecret(t *testing.T) {
+	_, err := NewTokenManager("", time.Hour, "")
+	assert.Equal(t, ErrMissingSecret, err)
+}
+
+func TestIssueAndParseAccessToken(t *testing.T) {
+	m, err := NewTokenManager("test-secret", time.Hour, "vws-test")
+	require.NoError(t, err)
+
+	token, expiresAt, err := m.IssueAccessToken(42, 7)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+	claims, err := m.ParseAccessToken(token)
+	require.NoError(t, err)
+	userID, err := claims.UserID()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), userID)
+	assert.Equal(t, int64(7), claims.SessionID)
+	assert.Equal(t, "vws-test", claims.Issuer)
+}
+
+func TestParseAccessToken_Expired(t *testing.T) {
+	m, err := NewTokenManager("test-secret", time.Minute, "")
+	require.NoError(t, err)
+
+	m.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	token, _, err := m.IssueAccessToken(1, 1)
+	require.NoError(t, err)
+
+	m.now = time.Now
+	_, err = m.ParseAccessToken(token)
+	assert.Equal(t, ErrExpiredToken, err)
+}
+
+func TestParseAccessToken_WrongSecret(t *testing.T) {
+	issuer, err := NewTokenManager("secret-a", time.Hour, "")
+	require.NoError(t, err)
+	verifier, err := NewTokenManager("secret-b", time.Hour, "")
+	require.NoError(t, err)
+
+	token, _, err := issuer.IssueAccessToken(1, 1)
+	require.NoError(t, err)
+
+	_, err = verifier.ParseAccessToken(token)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestParseAccessToken_WrongIssuer(t *testing.T) {
+	issuer, err := NewTokenManager("secret", time.Hour, "someone-else")
+	require.NoError(t, err)
+	verifier, err := NewTokenManager("secret", time.Hour, "vws-backend")
+	require.NoError(t, err)
+
+	token, _, err := issuer.IssueAccessToken(1, 1)
+	require.NoError(t, err)
+
+	_, err = verifier.ParseAccessToken(token)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestParseAccessToken_RejectsNoneAlgorithm(t *testing.T) {
+	m, err := NewTokenManager("secret", time.Hour, "")
+	require.NoError(t, err)
+
+	claims := jwt.RegisteredClaims{
+		Issuer:    DefaultIssuer,
+		Subject:   "1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	_, err = m.ParseAccessToken(token)
+	assert.Equal(t, ErrInvalidToken, err)
+}
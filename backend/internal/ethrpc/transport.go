@@ -0,0 +1,128 @@
+// Package ethrpc instruments the JSON-RPC calls made to the Ethereum node
+package ethrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"vws-backend/internal/metrics"
+	"vws-backend/internal/tracing"
+)
+
+// Longest request body inspected for the JSON-RPC method name
+const maxBodyPeek = 64 * 1024
+
+var errRPCFailed = errors.New("json-rpc call returned an error")
+
+// transport records latency, errors and a client span for every JSON-RPC
+// call made over HTTP
+type transport struct {
+	next http.RoundTripper
+}
+
+// NewTransport wraps an HTTP transport so every JSON-RPC call made through
+// it is measured and traced by method. Batches are recorded as "batch".
+func NewTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
+
+// NewHTTPClient returns an HTTP client for rpc.WithHTTPClient
+func NewHTTPClient() *http.Client {
+	return &http.Client{Transport: NewTransport(http.DefaultTransport)}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	method := "unknown"
+	if req.Body != nil && req.ContentLength <= maxBodyPeek {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		method = rpcMethod(body)
+	}
+
+	ctx, span := otel.Tracer(tracing.ServiceName).Start(req.Context(), "eth "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", method),
+			attribute.String("server.address", req.URL.Host),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err = t.next.RoundTrip(req)
+	if err != nil {
+		metrics.EthRPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		metrics.EthRPCErrors.WithLabelValues(method).Inc()
+		return nil, err
+	}
+
+	// JSON-RPC errors arrive with a 200 status, so the reply has to be read
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	metrics.EthRPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.EthRPCErrors.WithLabelValues(method).Inc()
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	span.SetAttributes(attribute.String("http.response.status_code", strconv.Itoa(resp.StatusCode)))
+	if resp.StatusCode >= http.StatusBadRequest || rpcFailed(body) {
+		metrics.EthRPCErrors.WithLabelValues(method).Inc()
+		span.RecordError(errRPCFailed)
+		span.SetStatus(codes.Error, errRPCFailed.Error())
+	}
+	return resp, nil
+}
+
+func rpcMethod(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		return "batch"
+	}
+	var msg struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil || msg.Method == "" {
+		return "unknown"
+	}
+	return msg.Method
+}
+
+func rpcFailed(body []byte) bool {
+	var msg struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return false
+	}
+	return len(msg.Error) > 0 && string(msg.Error) != "null"
+}
@@ -0,0 +1,53 @@
+package ethrpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+
+	"vws-backend/internal/metrics"
+	"vws-backend/internal/tracing/tracingtest"
+)
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "eth_call") {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"execution reverted"}}`))
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer server.Close()
+
+	spans := tracingtest.Install(t)
+	client := &http.Client{Transport: NewTransport(nil)}
+	call := func(method string) string {
+		resp, err := client.Post(server.URL, "application/json",
+			strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"`+method+`","params":[]}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	// The reply must still reach the caller after being inspected
+	assert.Contains(t, call("eth_chainId"), `"result":"0x1"`)
+	call("eth_call")
+
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.EthRPCDuration))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.EthRPCErrors.WithLabelValues("eth_chainId")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.EthRPCErrors.WithLabelValues("eth_call")))
+
+	assert.Equal(t, []string{"eth eth_chainId", "eth eth_call"}, tracingtest.SpanNames(spans))
+	assert.Equal(t, codes.Unset, spans.GetSpans()[0].Status.Code)
+	assert.Equal(t, codes.Error, spans.GetSpans()[1].Status.Code)
+}
@@ -7,7 +7,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"vws-backend/internal/apperr"
 	"vws-backend/internal/middleware"
+	"vws-backend/internal/openapi"
 	"vws-backend/internal/service/analytics"
 )
 
@@ -19,9 +21,9 @@ func NewHandler(service *analytics.Service) *Handler {
 	return &Handler{service: service}
 }
 
-func (h *Handler) RegisterRoutes(r *gin.Engine) {
+func (h *Handler) RegisterRoutes(r *gin.Engine, authMiddleware ...gin.HandlerFunc) {
 	analytics := r.Group("/api/analytics")
-	analytics.Use(middleware.Auth())
+	analytics.Use(authMiddleware...)
 	{
 		// Activity tracking
 		analytics.POST("/activities", h.trackActivity)
@@ -36,6 +38,36 @@ func (h *Handler) RegisterRoutes(r *gin.Engine) {
 	}
 }
 
+// status is the body of requests that have nothing else to report
+type status struct {
+	Status string `json:"status"`
+}
+
+// Routes documents the routes RegisterRoutes adds
+func (h *Handler) Routes() []openapi.Route {
+	return []openapi.Route{
+		{Handler: h.trackActivity, Summary: "Record an activity of the caller", Body: trackActivityRequest{},
+			Responses: openapi.Responses{http.StatusCreated: status{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: h.getDailyMetrics, Summary: "Calculate a metric for a day",
+			Params: []openapi.Param{
+				{Name: "type", In: openapi.InQuery, Required: true},
+				{Name: "date", In: openapi.InQuery, Format: "date"},
+			},
+			Responses: openapi.Responses{http.StatusOK: analytics.DailyMetric{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: h.getUserEngagement, Summary: "Update the engagement of a user over a date range",
+			Params: []openapi.Param{
+				{Name: "userID", In: openapi.InPath, Type: "integer"},
+				{Name: "startDate", In: openapi.InQuery, Format: "date", Required: true},
+				{Name: "endDate", In: openapi.InQuery, Format: "date", Required: true},
+			},
+			Responses: openapi.Responses{http.StatusOK: status{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: h.generateReport, Summary: "Generate a report over a date range", Body: generateReportRequest{},
+			Responses: openapi.Responses{http.StatusOK: analytics.Report{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: h.getReport, Summary: "Fetch a generated report",
+			Responses: openapi.Responses{http.StatusNotImplemented: openapi.Error{}}},
+	}
+}
+
 type trackActivityRequest struct {
 	Type     string         `json:"type" binding:"required"`
 	Metadata map[string]any `json:"metadata,omitempty"`
@@ -46,13 +78,13 @@ func (h *Handler) trackActivity(c *gin.Context) {
 
 	var req trackActivityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	err := h.service.TrackActivity(c.Request.Context(), userID, req.Type, req.Metadata)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track activity"})
+		c.Error(err)
 		return
 	}
 
@@ -62,7 +94,7 @@ func (h *Handler) trackActivity(c *gin.Context) {
 func (h *Handler) getDailyMetrics(c *gin.Context) {
 	metricType := c.Query("type")
 	if metricType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Metric type is required"})
+		c.Error(apperr.Invalid("Metric type is required"))
 		return
 	}
 
@@ -74,18 +106,14 @@ func (h *Handler) getDailyMetrics(c *gin.Context) {
 	} else {
 		date, err = time.Parse("2006-01-02", dateStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+			c.Error(apperr.Invalid("Invalid date format"))
 			return
 		}
 	}
 
 	metric, err := h.service.CalculateDailyMetric(c.Request.Context(), metricType, date)
-	if err == analytics.ErrInvalidMetric {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid metric type"})
-		return
-	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate metric"})
+		c.Error(err)
 		return
 	}
 
@@ -96,36 +124,32 @@ func (h *Handler) getUserEngagement(c *gin.Context) {
 	userIDStr := c.Param("userID")
 	userID, err := strconv.ParseInt(userIDStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(apperr.Invalid("Invalid user ID"))
 		return
 	}
 
 	startDateStr := c.Query("startDate")
 	endDateStr := c.Query("endDate")
 	if startDateStr == "" || endDateStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Start date and end date are required"})
+		c.Error(apperr.Invalid("Start date and end date are required"))
 		return
 	}
 
 	startDate, err := time.Parse("2006-01-02", startDateStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
+		c.Error(apperr.Invalid("Invalid start date format"))
 		return
 	}
 
 	endDate, err := time.Parse("2006-01-02", endDateStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
+		c.Error(apperr.Invalid("Invalid end date format"))
 		return
 	}
 
 	err = h.service.UpdateUserEngagement(c.Request.Context(), userID, startDate, endDate)
-	if err == analytics.ErrInvalidDateRange {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range"})
-		return
-	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user engagement"})
+		c.Error(err)
 		return
 	}
 
@@ -142,29 +166,25 @@ type generateReportRequest struct {
 func (h *Handler) generateReport(c *gin.Context) {
 	var req generateReportRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	startDate, err := time.Parse("2006-01-02", req.StartDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
+		c.Error(apperr.Invalid("Invalid start date format"))
 		return
 	}
 
 	endDate, err := time.Parse("2006-01-02", req.EndDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
+		c.Error(apperr.Invalid("Invalid end date format"))
 		return
 	}
 
 	report, err := h.service.GenerateReport(c.Request.Context(), req.Type, startDate, endDate, req.Parameters)
-	if err == analytics.ErrInvalidDateRange {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range"})
-		return
-	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate report"})
+		c.Error(err)
 		return
 	}
 
@@ -174,10 +194,10 @@ func (h *Handler) generateReport(c *gin.Context) {
 func (h *Handler) getReport(c *gin.Context) {
 	reportID := c.Param("reportID")
 	if reportID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Report ID is required"})
+		c.Error(apperr.Invalid("Report ID is required"))
 		return
 	}
 
 	// TODO: Implement get report by ID functionality in the service
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented"})
+	c.Error(apperr.NotImplemented("Not implemented"))
 }
@@ -0,0 +1,172 @@
+package enterprise
+
+import (
+	"strconv"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/middleware"
+	"vws-backend/internal/service/enterprise"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Keys for storing the caller's membership in context or, for API keys,
+// the membership of the user who created the key
+const (
+	memberKey  = "member"
+	creatorKey = "creator"
+)
+
+// orgResolver finds the organization a request targets from its path
+type orgResolver func(c *gin.Context) (int64, error)
+
+// requirement is what a route demands of the caller's membership: a
+// minimum role, a permission, or both
+type requirement struct {
+	role       string
+	permission string
+}
+
+func role(r string) requirement {
+	return requirement{role: r}
+}
+
+func permission(p string) requirement {
+	return requirement{permission: p}
+}
+
+// authorize resolves the organization a request targets and checks the
+// caller's membership in it against req. API keys are bound to a single
+// organization and act on behalf of the member who created them, so they
+// are held to that member's role and permissions as well as their scopes.
+func (h *Handler) authorize(resolve orgResolver, req requirement) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, err := resolve(c)
+		if err == strconv.ErrSyntax || err == strconv.ErrRange {
+			err = apperr.Invalid("invalid ID")
+		}
+		if err != nil {
+			middleware.Abort(c, err)
+			return
+		}
+
+		userID := c.GetInt64(middleware.UserIDKey)
+		key, isKey := middleware.GetAPIKey(c)
+		if isKey {
+			if key.OrganizationID != orgID {
+				middleware.Abort(c, apperr.Forbidden("API key does not belong to this organization"))
+				return
+			}
+			userID = key.CreatedBy
+		}
+
+		member, err := h.service.GetMember(c.Request.Context(), orgID, userID)
+		if err == enterprise.ErrMemberNotFound {
+			err = apperr.Forbidden("not a member of this organization")
+		}
+		if err != nil {
+			middleware.Abort(c, err)
+			return
+		}
+
+		if req.role != "" && !enterprise.RoleAtLeast(member.Role, req.role) {
+			middleware.Abort(c, apperr.Forbidden("requires "+req.role+" role"))
+			return
+		}
+		if req.permission != "" && !member.HasPermission(req.permission) {
+			middleware.Abort(c, apperr.Forbidden("missing permission "+req.permission))
+			return
+		}
+
+		c.Set(middleware.OrganizationIDKey, orgID)
+		if isKey {
+			c.Set(creatorKey, member)
+		} else {
+			c.Set(memberKey, member)
+		}
+		middleware.AddLogFields(c, "org_id", orgID)
+		c.Next()
+	}
+}
+
+// byOrganization resolves routes addressed by organization ID
+func (h *Handler) byOrganization(c *gin.Context) (int64, error) {
+	return parseID(c.Param("id"))
+}
+
+// byVotingSystem resolves routes addressed by voting system ID
+func (h *Handler) byVotingSystem(c *gin.Context) (int64, error) {
+	id, err := parseID(c.Param("id"))
+	if err != nil {
+		return 0, err
+	}
+	return h.service.GetVotingSystemOrganization(c.Request.Context(), id)
+}
+
+// byVote resolves routes addressed by vote ID
+func (h *Handler) byVote(c *gin.Context) (int64, error) {
+	id, err := parseID(c.Param("id"))
+	if err != nil {
+		return 0, err
+	}
+	return h.service.GetVoteOrganization(c.Request.Context(), id)
+}
+
+func parseID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if numErr, ok := err.(*strconv.NumError); ok {
+		return 0, numErr.Err
+	}
+	return id, err
+}
+
+// currentMember returns the caller's membership, or nil for API keys
+func currentMember(c *gin.Context) *enterprise.Member {
+	if member, ok := c.Get(memberKey); ok {
+		return member.(*enterprise.Member)
+	}
+	return nil
+}
+
+// isOwner reports whether the caller may manage OWNER memberships. API keys
+// act on behalf of an organization, not as its owner, so they may not.
+func isOwner(c *gin.Context) bool {
+	member := currentMember(c)
+	return member != nil && member.Role == enterprise.RoleOwner
+}
+
+// canGrant reports whether the caller holds every permission of granted,
+// and so may grant them or take them away. API keys hold no permissions of
+// their own, so they may grant no more than a plain membership.
+func canGrant(c *gin.Context, granted *enterprise.Member) bool {
+	caller := currentMember(c)
+	if caller == nil {
+		caller = &enterprise.Member{Role: enterprise.RoleMember}
+	}
+	return caller.Covers(granted)
+}
+
+// canIssue reports whether the caller may create an API key of scopes.
+// Nobody issues scopes beyond the permissions they hold, and API keys
+// issue them on behalf of their creator, within their own scopes.
+func canIssue(c *gin.Context, scopes []string) bool {
+	holder := currentMember(c)
+	key, isKey := middleware.GetAPIKey(c)
+	if isKey {
+		if creator, ok := c.Get(creatorKey); ok {
+			holder = creator.(*enterprise.Member)
+		}
+	}
+	if holder == nil {
+		return false
+	}
+	for _, scope := range scopes {
+		if !enterprise.IsValidScope(scope) {
+			continue // Rejected as invalid by the service
+		}
+		if !holder.HoldsScope(scope) || isKey && !key.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -6,7 +6,9 @@ import (
 	"strconv"
 	"time"
 
+	"vws-backend/internal/apperr"
 	"vws-backend/internal/middleware"
+	"vws-backend/internal/openapi"
 	"vws-backend/internal/service/enterprise"
 
 	"github.com/gin-gonic/gin"
@@ -19,18 +21,6 @@ type Organization struct {
 	Domain       string `json:"domain"`
 }
 
-type Member struct {
-	UserID int64  `json:"user_id"`
-	Role   string `json:"role"`
-}
-
-type APIKey struct {
-	Name      string    `json:"name"`
-	Scopes    []string  `json:"scopes"`
-	RateLimit int       `json:"rate_limit"`
-	ExpiresAt time.Time `json:"expires_at"`
-}
-
 type Handler struct {
 	service *enterprise.Service
 }
@@ -39,33 +29,83 @@ func NewHandler(service *enterprise.Service) *Handler {
 	return &Handler{service: service}
 }
 
-func (h *Handler) RegisterRoutes(router *gin.Engine) {
+func (h *Handler) RegisterRoutes(router *gin.Engine, authMiddleware ...gin.HandlerFunc) {
 	api := router.Group("/api/enterprise")
+	api.Use(authMiddleware...)
 	{
-		// Organization routes
-		api.POST("/organizations", h.createOrganization)
-		api.GET("/organizations/:id", h.getOrganization)
-		api.PUT("/organizations/:id", h.updateOrganization)
-
-		// Member routes
-		api.POST("/organizations/:id/members", h.addMember)
-		api.PUT("/organizations/:id/members/:userId/role", h.updateMemberRole)
+		// Organization routes. Whoever creates an organization becomes its
+		// OWNER, so only users in person may; every other route requires
+		// membership of the organization.
+		api.POST("/organizations", middleware.RequireUser(), h.createOrganization)
+		api.GET("/organizations/:id", middleware.RequireScope(enterprise.ScopeRead), h.authorize(h.byOrganization, role(enterprise.RoleMember)), h.getOrganization)
+		api.PUT("/organizations/:id", middleware.RequireScope(enterprise.ScopeWrite), h.authorize(h.byOrganization, permission(enterprise.PermUpdateOrganization)), h.updateOrganization)
+
+		// Member routes. Permissions are replaced by owners in person.
+		api.POST("/organizations/:id/members", middleware.RequireScope(enterprise.ScopeAdmin), h.authorize(h.byOrganization, permission(enterprise.PermManageMembers)), h.addMember)
+		api.PUT("/organizations/:id/members/:userId/role", middleware.RequireScope(enterprise.ScopeAdmin), h.authorize(h.byOrganization, permission(enterprise.PermManageMembers)), h.updateMemberRole)
+		api.PUT("/organizations/:id/members/:userId/permissions", middleware.RequireUser(), h.authorize(h.byOrganization, role(enterprise.RoleOwner)), h.updateMemberPermissions)
 
 		// API Key routes
-		api.POST("/organizations/:id/api-keys", h.createAPIKey)
-		api.GET("/organizations/:id/api-keys", h.listAPIKeys)
-		api.DELETE("/organizations/:id/api-keys/:keyId", h.revokeAPIKey)
+		api.POST("/organizations/:id/api-keys", middleware.RequireScope(enterprise.ScopeAdmin), h.authorize(h.byOrganization, permission(enterprise.PermManageAPIKeys)), h.createAPIKey)
+		api.GET("/organizations/:id/api-keys", middleware.RequireScope(enterprise.ScopeAdmin), h.authorize(h.byOrganization, permission(enterprise.PermManageAPIKeys)), h.listAPIKeys)
+		api.DELETE("/organizations/:id/api-keys/:keyId", middleware.RequireScope(enterprise.ScopeAdmin), h.authorize(h.byOrganization, permission(enterprise.PermManageAPIKeys)), h.revokeAPIKey)
 
 		// Voting System routes
-		api.POST("/organizations/:id/voting-systems", h.createVotingSystem)
-		api.GET("/organizations/:id/voting-systems", h.listVotingSystems)
-		api.POST("/voting-systems/:id/votes", h.createVote)
-		api.POST("/votes/:id/responses", h.submitVoteResponse)
-		api.GET("/votes/:id/results", h.getVoteResults)
+		api.POST("/organizations/:id/voting-systems", middleware.RequireScope(enterprise.ScopeWrite), h.authorize(h.byOrganization, permission(enterprise.PermManageVoting)), h.createVotingSystem)
+		api.GET("/organizations/:id/voting-systems", middleware.RequireScope(enterprise.ScopeRead), h.authorize(h.byOrganization, role(enterprise.RoleMember)), h.listVotingSystems)
+		api.POST("/voting-systems/:id/votes", middleware.RequireScope(enterprise.ScopeWrite), h.authorize(h.byVotingSystem, permission(enterprise.PermManageVoting)), h.createVote)
+		api.POST("/votes/:id/responses", middleware.RequireScope(enterprise.ScopeWrite), h.authorize(h.byVote, permission(enterprise.PermSubmitVotes)), h.submitVoteResponse)
+		api.GET("/votes/:id/results", middleware.RequireScope(enterprise.ScopeRead), h.authorize(h.byVote, permission(enterprise.PermViewResults)), h.getVoteResults)
 
 		// White Label routes
-		api.PUT("/organizations/:id/white-label", h.updateWhiteLabelSettings)
-		api.GET("/organizations/:id/white-label", h.getWhiteLabelSettings)
+		api.PUT("/organizations/:id/white-label", middleware.RequireScope(enterprise.ScopeWrite), h.authorize(h.byOrganization, permission(enterprise.PermManageWhiteLabel)), h.updateWhiteLabelSettings)
+		api.GET("/organizations/:id/white-label", middleware.RequireScope(enterprise.ScopeRead), h.authorize(h.byOrganization, role(enterprise.RoleMember)), h.getWhiteLabelSettings)
+	}
+}
+
+// Routes documents the routes RegisterRoutes adds
+func (h *Handler) Routes() []openapi.Route {
+	idParam := openapi.Param{Name: "id", In: openapi.InPath, Type: "integer"}
+	id := []openapi.Param{idParam}
+	member := []openapi.Param{idParam, {Name: "userId", In: openapi.InPath, Type: "integer"}}
+	return []openapi.Route{
+		{Handler: h.createOrganization, Summary: "Create an organization owned by the caller", Body: Organization{},
+			Responses: openapi.Responses{http.StatusCreated: enterprise.Organization{}, http.StatusForbidden: openapi.Error{}}},
+		{Handler: h.getOrganization, Summary: "Fetch an organization", Params: id,
+			Responses: openapi.Responses{http.StatusOK: enterprise.Organization{}, http.StatusNotFound: openapi.Error{}}},
+		{Handler: h.updateOrganization, Summary: "Update an organization", Params: id, Body: updateOrganizationRequest{},
+			Responses: openapi.Responses{http.StatusOK: enterprise.Organization{}, http.StatusNotFound: openapi.Error{}}},
+
+		{Handler: h.addMember, Summary: "Add a member to an organization", Params: id, Body: addMemberRequest{},
+			Responses: openapi.Responses{http.StatusCreated: enterprise.Member{}, http.StatusForbidden: openapi.Error{}}},
+		{Handler: h.updateMemberRole, Summary: "Change the role of a member", Params: member, Body: updateMemberRoleRequest{},
+			Responses: openapi.Responses{http.StatusOK: nil, http.StatusForbidden: openapi.Error{}, http.StatusNotFound: openapi.Error{}, http.StatusConflict: openapi.Error{}}},
+		{Handler: h.updateMemberPermissions, Summary: "Replace the permissions of a member", Params: member, Body: updateMemberPermissionsRequest{},
+			Responses: openapi.Responses{http.StatusOK: nil, http.StatusForbidden: openapi.Error{}, http.StatusNotFound: openapi.Error{}}},
+
+		{Handler: h.createAPIKey, Summary: "Create an API key, returning its plaintext once", Params: id, Body: createAPIKeyRequest{},
+			Responses: openapi.Responses{http.StatusCreated: enterprise.APIKey{}, http.StatusForbidden: openapi.Error{}}},
+		{Handler: h.listAPIKeys, Summary: "API keys of an organization", Params: id,
+			Responses: openapi.Responses{http.StatusOK: []*enterprise.APIKey{}}},
+		{Handler: h.revokeAPIKey, Summary: "Revoke an API key",
+			Params:    []openapi.Param{idParam, {Name: "keyId", In: openapi.InPath, Type: "integer"}},
+			Responses: openapi.Responses{http.StatusOK: nil}},
+
+		{Handler: h.createVotingSystem, Summary: "Create a voting system", Params: id, Body: createVotingSystemRequest{},
+			Responses: openapi.Responses{http.StatusCreated: enterprise.VotingSystem{}}},
+		{Handler: h.listVotingSystems, Summary: "Voting systems of an organization", Params: id,
+			Responses: openapi.Responses{http.StatusOK: []*enterprise.VotingSystem{}}},
+		{Handler: h.createVote, Summary: "Open a vote in a voting system", Params: id, Body: createVoteRequest{},
+			Responses: openapi.Responses{http.StatusCreated: enterprise.Vote{}, http.StatusNotFound: openapi.Error{}}},
+		{Handler: h.submitVoteResponse, Summary: "Cast the caller's response to a vote", Params: id, Body: submitVoteResponseRequest{},
+			Responses: openapi.Responses{http.StatusCreated: enterprise.VoteResponse{}, http.StatusNotFound: openapi.Error{}, http.StatusConflict: openapi.Error{}}},
+		{Handler: h.getVoteResults, Summary: "Tally of a vote", Params: id,
+			Responses: openapi.Responses{http.StatusOK: map[string]any{}, http.StatusNotFound: openapi.Error{}}},
+
+		{Handler: h.updateWhiteLabelSettings, Summary: "Configure white labelling", Params: id, Body: updateWhiteLabelRequest{},
+			Responses: openapi.Responses{http.StatusOK: enterprise.WhiteLabelSettings{}}},
+		{Handler: h.getWhiteLabelSettings, Summary: "White label settings of an organization", Params: id,
+			Responses: openapi.Responses{http.StatusOK: enterprise.WhiteLabelSettings{}, http.StatusNotFound: openapi.Error{}}},
 	}
 }
 
@@ -81,12 +121,13 @@ type createOrganizationRequest struct {
 func (h *Handler) createOrganization(c *gin.Context) {
 	var org Organization
 	if err := c.ShouldBindJSON(&org); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	userID := c.GetInt64(middleware.UserIDKey)
 	result, err := h.service.CreateOrganization(
+		c.Request.Context(),
 		org.Name,
 		org.Description,
 		org.ContactEmail,
@@ -94,7 +135,7 @@ func (h *Handler) createOrganization(c *gin.Context) {
 		userID,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -104,17 +145,13 @@ func (h *Handler) createOrganization(c *gin.Context) {
 func (h *Handler) getOrganization(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		c.Error(apperr.Invalid("invalid organization ID"))
 		return
 	}
 
-	org, err := h.service.GetOrganization(id)
-	if err == enterprise.ErrOrganizationNotFound {
-		c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
-		return
-	}
+	org, err := h.service.GetOrganization(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -133,23 +170,19 @@ type updateOrganizationRequest struct {
 func (h *Handler) updateOrganization(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		c.Error(apperr.Invalid("invalid organization ID"))
 		return
 	}
 
 	var req updateOrganizationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
-	org, err := h.service.GetOrganization(id)
-	if err == enterprise.ErrOrganizationNotFound {
-		c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
-		return
-	}
+	org, err := h.service.GetOrganization(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -171,14 +204,14 @@ func (h *Handler) updateOrganization(c *gin.Context) {
 	if req.Settings != nil {
 		settings, err := json.Marshal(req.Settings)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid settings format"})
+			c.Error(apperr.Invalid("invalid settings format"))
 			return
 		}
 		org.Settings = settings
 	}
 
-	if err := h.service.UpdateOrganization(org); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.UpdateOrganization(c.Request.Context(), org); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -186,22 +219,46 @@ func (h *Handler) updateOrganization(c *gin.Context) {
 }
 
 type addMemberRequest struct {
-	UserID      int64                  `json:"user_id" binding:"required"`
-	Role        string                 `json:"role" binding:"required"`
-	Permissions map[string]interface{} `json:"permissions"`
+	UserID      int64           `json:"user_id" binding:"required"`
+	Role        string          `json:"role" binding:"required"`
+	Permissions map[string]bool `json:"permissions"`
 }
 
 func (h *Handler) addMember(c *gin.Context) {
-	var member Member
-	if err := c.ShouldBindJSON(&member); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req addMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Binding(err))
 		return
 	}
 
-	orgID := c.GetInt64("organization_id")
-	result, err := h.service.AddMember(orgID, member.UserID, member.Role)
+	if req.Role == enterprise.RoleOwner && !isOwner(c) {
+		c.Error(apperr.Forbidden("only owners can add owners"))
+		return
+	}
+	// Permissions are replaced by owners alone, as by
+	// updateMemberPermissions, and nobody grants more than they hold
+	if req.Permissions != nil && !isOwner(c) {
+		c.Error(apperr.Forbidden("only owners can set permissions"))
+		return
+	}
+	if !canGrant(c, &enterprise.Member{Role: req.Role}) {
+		c.Error(apperr.Forbidden("cannot grant permissions you do not hold"))
+		return
+	}
+
+	var permissions json.RawMessage
+	if req.Permissions != nil {
+		var err error
+		if permissions, err = json.Marshal(req.Permissions); err != nil {
+			c.Error(apperr.Invalid("invalid permissions format"))
+			return
+		}
+	}
+
+	orgID := c.GetInt64(middleware.OrganizationIDKey)
+	result, err := h.service.AddMember(c.Request.Context(), orgID, req.UserID, req.Role, permissions)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -213,30 +270,80 @@ type updateMemberRoleRequest struct {
 }
 
 func (h *Handler) updateMemberRole(c *gin.Context) {
-	orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	orgID := c.GetInt64(middleware.OrganizationIDKey)
+
+	userID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		c.Error(apperr.Invalid("invalid user ID"))
 		return
 	}
 
+	var req updateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Binding(err))
+		return
+	}
+
+	target, err := h.service.GetMember(c.Request.Context(), orgID, userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Only owners can grant or take away ownership
+	if (req.Role == enterprise.RoleOwner || target.Role == enterprise.RoleOwner) && !isOwner(c) {
+		c.Error(apperr.Forbidden("only owners can change owner roles"))
+		return
+	}
+	// Nor can anyone promote a member past their own permissions, or
+	// demote one holding more
+	promoted := *target
+	promoted.Role = req.Role
+	if !canGrant(c, target) || !canGrant(c, &promoted) {
+		c.Error(apperr.Forbidden("cannot manage members with permissions you do not hold"))
+		return
+	}
+
+	if err := h.service.UpdateMemberRole(c.Request.Context(), orgID, userID, req.Role); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+type updateMemberPermissionsRequest struct {
+	Permissions map[string]bool `json:"permissions" binding:"required"`
+}
+
+func (h *Handler) updateMemberPermissions(c *gin.Context) {
+	orgID := c.GetInt64(middleware.OrganizationIDKey)
+
 	userID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		c.Error(apperr.Invalid("invalid user ID"))
 		return
 	}
 
-	var req updateMemberRoleRequest
+	var req updateMemberPermissionsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
-	if err := h.service.UpdateMemberRole(orgID, userID, req.Role); err != nil {
-		if err == enterprise.ErrMemberNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !isOwner(c) {
+		c.Error(apperr.Forbidden("only owners can set permissions"))
+		return
+	}
+
+	permissions, err := json.Marshal(req.Permissions)
+	if err != nil {
+		c.Error(apperr.Invalid("invalid permissions format"))
+		return
+	}
+
+	if err := h.service.UpdateMemberPermissions(c.Request.Context(), orgID, userID, permissions); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -251,27 +358,53 @@ type createAPIKeyRequest struct {
 }
 
 func (h *Handler) createAPIKey(c *gin.Context) {
-	var key APIKey
-	if err := c.ShouldBindJSON(&key); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apperr.Invalid("invalid organization ID"))
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Binding(err))
+		return
+	}
+
+	if !canIssue(c, req.Scopes) {
+		c.Error(apperr.Forbidden("cannot grant scopes beyond the permissions you hold"))
 		return
 	}
 
-	orgID := c.GetInt64("organization_id")
+	var expiresAt time.Time
+	if req.ExpiresAt != "" {
+		expiresAt, err = time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			c.Error(apperr.Invalid("invalid expires_at format"))
+			return
+		}
+	}
+
+	rateLimit := req.RateLimit
+	if rateLimit <= 0 {
+		rateLimit = 1000
+	}
+
 	userID := c.GetInt64(middleware.UserIDKey)
 	result, err := h.service.CreateAPIKey(
+		c.Request.Context(),
 		orgID,
-		key.Name,
-		key.Scopes,
-		key.RateLimit,
-		key.ExpiresAt,
+		req.Name,
+		req.Scopes,
+		rateLimit,
+		expiresAt,
 		userID,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	// The plaintext key is only returned once
 	c.JSON(http.StatusCreated, result)
 }
 
@@ -285,19 +418,19 @@ type createVotingSystemRequest struct {
 func (h *Handler) createVotingSystem(c *gin.Context) {
 	orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		c.Error(apperr.Invalid("invalid organization ID"))
 		return
 	}
 
 	var req createVotingSystemRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	config, err := json.Marshal(req.Config)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid config format"})
+		c.Error(apperr.Invalid("invalid config format"))
 		return
 	}
 
@@ -308,11 +441,11 @@ func (h *Handler) createVotingSystem(c *gin.Context) {
 		VotingType:     req.VotingType,
 		Config:         config,
 		Active:         true,
-		CreatedBy:      getUserID(c), // Implement this helper function
+		CreatedBy:      c.GetInt64(middleware.UserIDKey),
 	}
 
-	if err := h.service.CreateVotingSystem(vs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.CreateVotingSystem(c.Request.Context(), vs); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -330,31 +463,31 @@ type createVoteRequest struct {
 func (h *Handler) createVote(c *gin.Context) {
 	systemID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid voting system ID"})
+		c.Error(apperr.Invalid("invalid voting system ID"))
 		return
 	}
 
 	var req createVoteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	startDate, err := time.Parse(time.RFC3339, req.StartDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_date format"})
+		c.Error(apperr.Invalid("invalid start_date format"))
 		return
 	}
 
 	endDate, err := time.Parse(time.RFC3339, req.EndDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_date format"})
+		c.Error(apperr.Invalid("invalid end_date format"))
 		return
 	}
 
 	options, err := json.Marshal(req.Options)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid options format"})
+		c.Error(apperr.Invalid("invalid options format"))
 		return
 	}
 
@@ -365,16 +498,12 @@ func (h *Handler) createVote(c *gin.Context) {
 		Options:        options,
 		StartDate:      startDate,
 		EndDate:        endDate,
-		Status:         "PENDING",
-		CreatedBy:      getUserID(c), // Implement this helper function
+		Status:         enterprise.VoteStatusPending,
+		CreatedBy:      c.GetInt64(middleware.UserIDKey),
 	}
 
-	if err := h.service.CreateVote(vote); err != nil {
-		if err == enterprise.ErrInvalidDateRange {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "end date must be after start date"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.CreateVote(c.Request.Context(), vote); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -389,40 +518,31 @@ type submitVoteResponseRequest struct {
 func (h *Handler) submitVoteResponse(c *gin.Context) {
 	voteID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vote ID"})
+		c.Error(apperr.Invalid("invalid vote ID"))
 		return
 	}
 
 	var req submitVoteResponseRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	response, err := json.Marshal(req.Response)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid response format"})
+		c.Error(apperr.Invalid("invalid response format"))
 		return
 	}
 
 	resp := &enterprise.VoteResponse{
 		VoteID:   voteID,
-		UserID:   getUserID(c), // Implement this helper function
+		UserID:   c.GetInt64(middleware.UserIDKey),
 		Response: response,
 		Weight:   req.Weight,
 	}
 
-	if err := h.service.SubmitVoteResponse(resp); err != nil {
-		switch err {
-		case enterprise.ErrVoteNotFound:
-			c.JSON(http.StatusNotFound, gin.H{"error": "vote not found"})
-		case enterprise.ErrVoteExpired:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "vote has expired"})
-		case enterprise.ErrVoteAlreadySubmitted:
-			c.JSON(http.StatusConflict, gin.H{"error": "vote already submitted"})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+	if err := h.service.SubmitVoteResponse(c.Request.Context(), resp); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -440,19 +560,19 @@ type updateWhiteLabelRequest struct {
 func (h *Handler) updateWhiteLabelSettings(c *gin.Context) {
 	orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		c.Error(apperr.Invalid("invalid organization ID"))
 		return
 	}
 
 	var req updateWhiteLabelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	themeConfig, err := json.Marshal(req.ThemeConfig)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid theme_config format"})
+		c.Error(apperr.Invalid("invalid theme_config format"))
 		return
 	}
 
@@ -465,8 +585,8 @@ func (h *Handler) updateWhiteLabelSettings(c *gin.Context) {
 		Enabled:        req.Enabled,
 	}
 
-	if err := h.service.UpdateWhiteLabelSettings(settings); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.UpdateWhiteLabelSettings(c.Request.Context(), settings); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -476,17 +596,17 @@ func (h *Handler) updateWhiteLabelSettings(c *gin.Context) {
 func (h *Handler) getWhiteLabelSettings(c *gin.Context) {
 	orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		c.Error(apperr.Invalid("invalid organization ID"))
 		return
 	}
 
-	settings, err := h.service.GetWhiteLabelSettings(orgID)
+	settings, err := h.service.GetWhiteLabelSettings(c.Request.Context(), orgID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	if settings == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "white label settings not found"})
+		c.Error(apperr.NotFound("white label settings not found"))
 		return
 	}
 
@@ -496,13 +616,13 @@ func (h *Handler) getWhiteLabelSettings(c *gin.Context) {
 func (h *Handler) listAPIKeys(c *gin.Context) {
 	orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		c.Error(apperr.Invalid("invalid organization ID"))
 		return
 	}
 
-	keys, err := h.service.ListAPIKeys(orgID)
+	keys, err := h.service.ListAPIKeys(c.Request.Context(), orgID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -512,18 +632,18 @@ func (h *Handler) listAPIKeys(c *gin.Context) {
 func (h *Handler) revokeAPIKey(c *gin.Context) {
 	orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		c.Error(apperr.Invalid("invalid organization ID"))
 		return
 	}
 
 	keyID, err := strconv.ParseInt(c.Param("keyId"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key ID"})
+		c.Error(apperr.Invalid("invalid API key ID"))
 		return
 	}
 
-	if err := h.service.RevokeAPIKey(orgID, keyID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.RevokeAPIKey(c.Request.Context(), orgID, keyID); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -533,13 +653,13 @@ func (h *Handler) revokeAPIKey(c *gin.Context) {
 func (h *Handler) listVotingSystems(c *gin.Context) {
 	orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization ID"})
+		c.Error(apperr.Invalid("invalid organization ID"))
 		return
 	}
 
-	systems, err := h.service.ListVotingSystems(orgID)
+	systems, err := h.service.ListVotingSystems(c.Request.Context(), orgID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -549,34 +669,15 @@ func (h *Handler) listVotingSystems(c *gin.Context) {
 func (h *Handler) getVoteResults(c *gin.Context) {
 	voteID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vote ID"})
+		c.Error(apperr.Invalid("invalid vote ID"))
 		return
 	}
 
-	results, err := h.service.GetVoteResults(voteID)
-	if err == enterprise.ErrVoteNotFound {
-		c.JSON(http.StatusNotFound, gin.H{"error": "vote not found"})
-		return
-	}
+	results, err := h.service.GetVoteResults(c.Request.Context(), voteID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, results)
 }
-
-// Helper function to get user ID from context
-// This should be implemented based on your authentication middleware
-func getUserID(c *gin.Context) int64 {
-	// Implementation depends on how you store the user ID in the context
-	userID, exists := c.Get("user_id")
-	if !exists {
-		return 0
-	}
-	id, ok := userID.(int64)
-	if !ok {
-		return 0
-	}
-	return id
-}
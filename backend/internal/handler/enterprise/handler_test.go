@@ -0,0 +1,262 @@
+package enterprise
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/middleware"
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/store/memory"
+)
+
+// Users of the organization setup creates, and one outside it
+const (
+	owner           int64 = iota + 1
+	admin                 // An ADMIN
+	restrictedAdmin       // An ADMIN without api_keys:manage
+	manager               // A MEMBER with members:manage
+	member                // A MEMBER
+	keyManager            // A MEMBER with api_keys:manage
+	outsider
+)
+
+type testServer struct {
+	router  *gin.Engine
+	service *enterprise.Service
+	orgID   int64
+}
+
+func setup(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	service := enterprise.NewService(memory.New().Enterprise())
+	org, err := service.CreateOrganization(ctx, "Org", "", "org@example.com", "example.com", owner)
+	require.NoError(t, err)
+	for user, m := range map[int64]struct {
+		role        string
+		permissions string
+	}{
+		admin:           {enterprise.RoleAdmin, ""},
+		restrictedAdmin: {enterprise.RoleAdmin, `{"api_keys:manage": false}`},
+		manager:         {enterprise.RoleMember, `{"members:manage": true}`},
+		member:          {enterprise.RoleMember, ""},
+		keyManager:      {enterprise.RoleMember, `{"api_keys:manage": true}`},
+	} {
+		var permissions json.RawMessage
+		if m.permissions != "" {
+			permissions = json.RawMessage(m.permissions)
+		}
+		_, err := service.AddMember(ctx, org.ID, user, m.role, permissions)
+		require.NoError(t, err)
+	}
+
+	router := gin.New()
+	router.Use(middleware.Errors())
+	NewHandler(service).RegisterRoutes(router, authenticate(org.ID))
+	return &testServer{router: router, service: service, orgID: org.ID}
+}
+
+// authenticate stands in for authentication: the caller is the user of
+// the X-User-ID header or, given X-Scopes, an API key of the organization
+// orgID, or of X-Organization-ID, with those scopes, created by that user
+// or else the owner
+func authenticate(orgID int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.GetHeader("X-User-ID"), 10, 64)
+		if scopes := c.GetHeader("X-Scopes"); scopes != "" {
+			keyOrg := orgID
+			if org := c.GetHeader("X-Organization-ID"); org != "" {
+				keyOrg, _ = strconv.ParseInt(org, 10, 64)
+			}
+			if id == 0 {
+				id = owner
+			}
+			c.Set(middleware.APIKeyKey, &enterprise.APIKey{OrganizationID: keyOrg, Scopes: strings.Split(scopes, ","), CreatedBy: id})
+		}
+		c.Set(middleware.UserIDKey, id)
+	}
+}
+
+// as returns the headers of requests made by user
+func as(user int64) http.Header {
+	return http.Header{"X-User-Id": {strconv.FormatInt(user, 10)}}
+}
+
+// withKey returns the headers of requests made with an API key of scopes
+func withKey(scopes ...string) http.Header {
+	return http.Header{"X-Scopes": {strings.Join(scopes, ",")}}
+}
+
+// keyOf returns the headers of requests made with an API key of scopes
+// created by user
+func keyOf(user int64, scopes ...string) http.Header {
+	header := withKey(scopes...)
+	header.Set("X-User-ID", strconv.FormatInt(user, 10))
+	return header
+}
+
+func (s *testServer) do(method, path string, header http.Header, body any) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthorize(t *testing.T) {
+	s := setup(t)
+	org := fmt.Sprintf("/api/enterprise/organizations/%d", s.orgID)
+	otherOrg := http.Header{"X-Scopes": {enterprise.ScopeAdmin}, "X-Organization-Id": {strconv.FormatInt(s.orgID+1, 10)}}
+	rename := map[string]string{"name": "Renamed"}
+	grant := map[string]any{"permissions": map[string]bool{"votes:results": true}}
+	join := map[string]any{"user_id": outsider + 1, "role": enterprise.RoleMember}
+	newOrg := map[string]string{"name": "Another", "contact_email": "another@example.com"}
+	adminKey := map[string]any{"name": "ci", "scopes": []string{enterprise.ScopeAdmin}}
+	readKey := map[string]any{"name": "ci", "scopes": []string{enterprise.ScopeRead}}
+
+	for name, tc := range map[string]struct {
+		method, path string
+		header       http.Header
+		body         any
+		want         int
+	}{
+		"member reads":                          {http.MethodGet, org, as(member), nil, http.StatusOK},
+		"outsider reads":                        {http.MethodGet, org, as(outsider), nil, http.StatusForbidden},
+		"unknown organization":                  {http.MethodGet, "/api/enterprise/organizations/999", as(owner), nil, http.StatusForbidden},
+		"invalid ID":                            {http.MethodGet, "/api/enterprise/organizations/abc", as(owner), nil, http.StatusBadRequest},
+		"member without permission":             {http.MethodPut, org, as(member), rename, http.StatusForbidden},
+		"admin with permission":                 {http.MethodPut, org, as(admin), rename, http.StatusOK},
+		"permission withheld":                   {http.MethodGet, org + "/api-keys", as(restrictedAdmin), nil, http.StatusForbidden},
+		"permission granted":                    {http.MethodGet, org + "/api-keys", as(admin), nil, http.StatusOK},
+		"admin below the role":                  {http.MethodPut, org + "/members/5/permissions", as(admin), grant, http.StatusForbidden},
+		"owner of the role":                     {http.MethodPut, org + "/members/5/permissions", as(owner), grant, http.StatusOK},
+		"key of the organization":               {http.MethodGet, org, withKey(enterprise.ScopeRead), nil, http.StatusOK},
+		"key of another organization":           {http.MethodGet, org, otherOrg, nil, http.StatusForbidden},
+		"key without scope":                     {http.MethodPut, org, withKey(enterprise.ScopeRead), rename, http.StatusForbidden},
+		"key with scope":                        {http.MethodPut, org, withKey(enterprise.ScopeWrite), rename, http.StatusOK},
+		"key below the admin scope":             {http.MethodPost, org + "/members", withKey(enterprise.ScopeWrite), join, http.StatusForbidden},
+		"key of the admin scope":                {http.MethodPost, org + "/members", withKey(enterprise.ScopeAdmin), join, http.StatusCreated},
+		"user creates an organization":          {http.MethodPost, "/api/enterprise/organizations", as(outsider), newOrg, http.StatusCreated},
+		"key creates an organization":           {http.MethodPost, "/api/enterprise/organizations", withKey(enterprise.ScopeAdmin), newOrg, http.StatusForbidden},
+		"owner's key sets permissions":          {http.MethodPut, org + "/members/5/permissions", withKey(enterprise.ScopeAdmin), grant, http.StatusForbidden},
+		"admin's key sets permissions":          {http.MethodPut, org + "/members/5/permissions", keyOf(admin, enterprise.ScopeAdmin), grant, http.StatusForbidden},
+		"key beyond its creator":                {http.MethodPut, org, keyOf(member, enterprise.ScopeWrite), rename, http.StatusForbidden},
+		"key of a former member":                {http.MethodGet, org, keyOf(outsider, enterprise.ScopeRead), nil, http.StatusForbidden},
+		"key within its creator":                {http.MethodPut, org, keyOf(admin, enterprise.ScopeWrite), rename, http.StatusOK},
+		"owner creates an admin key":            {http.MethodPost, org + "/api-keys", as(owner), adminKey, http.StatusCreated},
+		"key manager creates a read key":        {http.MethodPost, org + "/api-keys", as(keyManager), readKey, http.StatusCreated},
+		"key manager exceeds their permissions": {http.MethodPost, org + "/api-keys", as(keyManager), adminKey, http.StatusForbidden},
+		"key exceeds its creator's permissions": {http.MethodPost, org + "/api-keys", keyOf(keyManager, enterprise.ScopeAdmin), adminKey, http.StatusForbidden},
+		"key creates a key":                     {http.MethodPost, org + "/api-keys", withKey(enterprise.ScopeAdmin), readKey, http.StatusCreated},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := s.do(tc.method, tc.path, tc.header, tc.body)
+			assert.Equal(t, tc.want, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestAddMember_Escalation(t *testing.T) {
+	s := setup(t)
+	path := fmt.Sprintf("/api/enterprise/organizations/%d/members", s.orgID)
+	results := map[string]bool{"votes:results": true}
+
+	user := outsider
+	for name, tc := range map[string]struct {
+		header      http.Header
+		role        string
+		permissions map[string]bool
+		want        int
+	}{
+		"owner adds an owner":                  {as(owner), enterprise.RoleOwner, nil, http.StatusCreated},
+		"owner sets permissions":               {as(owner), enterprise.RoleMember, results, http.StatusCreated},
+		"admin adds an admin":                  {as(admin), enterprise.RoleAdmin, nil, http.StatusCreated},
+		"admin adds an owner":                  {as(admin), enterprise.RoleOwner, nil, http.StatusForbidden},
+		"admin sets permissions":               {as(admin), enterprise.RoleMember, results, http.StatusForbidden},
+		"admin withheld a permission":          {as(restrictedAdmin), enterprise.RoleAdmin, nil, http.StatusForbidden},
+		"restricted admin adds a member":       {as(restrictedAdmin), enterprise.RoleMember, nil, http.StatusCreated},
+		"manager adds an admin":                {as(manager), enterprise.RoleAdmin, nil, http.StatusForbidden},
+		"manager adds a member":                {as(manager), enterprise.RoleMember, nil, http.StatusCreated},
+		"manager sets permissions":             {as(manager), enterprise.RoleMember, map[string]bool{"members:manage": true}, http.StatusForbidden},
+		"key adds an admin":                    {withKey(enterprise.ScopeAdmin), enterprise.RoleAdmin, nil, http.StatusForbidden},
+		"key adds a member":                    {withKey(enterprise.ScopeAdmin), enterprise.RoleMember, nil, http.StatusCreated},
+		"key sets permissions":                 {withKey(enterprise.ScopeAdmin), enterprise.RoleMember, results, http.StatusForbidden},
+		"member without the permission to add": {as(member), enterprise.RoleMember, nil, http.StatusForbidden},
+	} {
+		user++
+		t.Run(name, func(t *testing.T) {
+			body := map[string]any{"user_id": user, "role": tc.role}
+			if tc.permissions != nil {
+				body["permissions"] = tc.permissions
+			}
+			w := s.do(http.MethodPost, path, tc.header, body)
+			assert.Equal(t, tc.want, w.Code, w.Body.String())
+
+			_, err := s.service.GetMember(context.Background(), s.orgID, user)
+			if tc.want == http.StatusCreated {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, enterprise.ErrMemberNotFound, err, "nobody is added")
+			}
+		})
+	}
+}
+
+func TestUpdateMemberRole_Escalation(t *testing.T) {
+	for name, tc := range map[string]struct {
+		header http.Header
+		target int64
+		role   string
+		want   int
+	}{
+		"admin promotes a member":          {as(admin), member, enterprise.RoleAdmin, http.StatusOK},
+		"admin demotes an admin":           {as(admin), restrictedAdmin, enterprise.RoleMember, http.StatusOK},
+		"admin promotes to owner":          {as(admin), member, enterprise.RoleOwner, http.StatusForbidden},
+		"admin demotes the owner":          {as(admin), owner, enterprise.RoleMember, http.StatusForbidden},
+		"restricted admin promotes":        {as(restrictedAdmin), member, enterprise.RoleAdmin, http.StatusForbidden},
+		"restricted admin demotes admin":   {as(restrictedAdmin), admin, enterprise.RoleMember, http.StatusForbidden},
+		"manager promotes a member":        {as(manager), member, enterprise.RoleAdmin, http.StatusForbidden},
+		"manager promotes themselves":      {as(manager), manager, enterprise.RoleAdmin, http.StatusForbidden},
+		"manager demotes an admin":         {as(manager), admin, enterprise.RoleMember, http.StatusForbidden},
+		"key promotes a member":            {withKey(enterprise.ScopeAdmin), member, enterprise.RoleAdmin, http.StatusForbidden},
+		"key demotes an admin":             {withKey(enterprise.ScopeAdmin), admin, enterprise.RoleMember, http.StatusForbidden},
+		"owner promotes a member to owner": {as(owner), member, enterprise.RoleOwner, http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := setup(t)
+			ctx := context.Background()
+			before, err := s.service.GetMember(ctx, s.orgID, tc.target)
+			require.NoError(t, err)
+
+			path := fmt.Sprintf("/api/enterprise/organizations/%d/members/%d/role", s.orgID, tc.target)
+			w := s.do(http.MethodPut, path, tc.header, map[string]string{"role": tc.role})
+			assert.Equal(t, tc.want, w.Code, w.Body.String())
+
+			after, err := s.service.GetMember(ctx, s.orgID, tc.target)
+			require.NoError(t, err)
+			if tc.want == http.StatusOK {
+				assert.Equal(t, tc.role, after.Role)
+			} else {
+				assert.Equal(t, before.Role, after.Role, "the role is unchanged")
+			}
+		})
+	}
+}
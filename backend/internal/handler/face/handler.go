@@ -1,110 +1,341 @@
 package face
 
 import (
-	"bytes"
+	"fmt"
 	"image"
-	"image/jpeg"
-	"io"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/middleware"
+	"vws-backend/internal/openapi"
 	"vws-backend/internal/service/face"
+	"vws-backend/internal/service/user"
 )
 
-// Handler handles HTTP requests for face detection
+// Handler handles HTTP requests for face detection and verification
 type Handler struct {
-	service *face.Service
+	service  *face.Service
+	verifier *face.Verifier
+	roles    middleware.RoleResolver
+	uploads  UploadConfig
 }
 
-// NewHandler creates a new face detection handler
-func NewHandler(service *face.Service) *Handler {
+// NewHandler creates a new face detection and verification handler. The
+// review of duplicates is restricted to the users roles resolves as
+// admins, and uploaded images to those within uploads.
+func NewHandler(service *face.Service, verifier *face.Verifier, roles middleware.RoleResolver, uploads UploadConfig) *Handler {
 	return &Handler{
-		service: service,
+		service:  service,
+		verifier: verifier,
+		roles:    roles,
+		uploads:  uploads,
 	}
 }
 
 // RegisterRoutes registers the face detection routes
-func (h *Handler) RegisterRoutes(router *gin.Engine) {
+func (h *Handler) RegisterRoutes(router *gin.Engine, authMiddleware ...gin.HandlerFunc) {
 	group := router.Group("/api/face")
+	group.Use(authMiddleware...)
 	{
 		group.POST("/detect", h.DetectFace)
 		group.POST("/verify", h.VerifyFace)
+		group.POST("/liveness/challenge", h.IssueChallenge)
+		group.POST("/liveness", h.CheckChallenge)
+		group.GET("/enrollment", h.GetEnrollment)
+		group.POST("/enrollment", h.Enroll)
+		group.PUT("/enrollment", h.Reenroll)
+		group.DELETE("/enrollment", h.Unenroll)
+
+		duplicates := group.Group("/duplicates", middleware.RequireRole(h.roles, user.RoleAdmin))
+		duplicates.GET("", h.ListDuplicates)
+		duplicates.POST("/:id/confirm", h.ConfirmDuplicate)
+		duplicates.POST("/:id/dismiss", h.DismissDuplicate)
+	}
+}
+
+// imageForm is the multipart form face images are uploaded in
+type imageForm struct {
+	Image *multipart.FileHeader `form:"image" binding:"required"`
+}
+
+// challengeForm is the multipart form a liveness challenge is answered
+// in: the ID of the challenge the server issued and the frames the client
+// took while asking the person for it, in order
+type challengeForm struct {
+	ChallengeID string                  `form:"challengeId" binding:"required,max=64"`
+	Frames      []*multipart.FileHeader `form:"frames" binding:"required,min=2,max=10"`
+}
+
+// Routes documents the routes RegisterRoutes adds
+func (h *Handler) Routes() []openapi.Route {
+	idParam := []openapi.Param{{Name: "id", In: openapi.InPath, Type: "integer"}}
+	return []openapi.Route{
+		{Handler: h.DetectFace, Summary: "Detect faces in a JPEG, PNG or WebP image and check their liveness", Form: imageForm{},
+			Responses: openapi.Responses{http.StatusOK: face.DetectionResult{}, http.StatusBadRequest: openapi.Error{},
+				http.StatusRequestEntityTooLarge: openapi.Error{}, http.StatusUnsupportedMediaType: openapi.Error{}}},
+		{Handler: h.VerifyFace, Summary: "Match a face against the caller's enrolled face", Form: imageForm{},
+			Responses: openapi.Responses{http.StatusOK: face.Verification{}, http.StatusBadRequest: openapi.Error{},
+				http.StatusRequestEntityTooLarge: openapi.Error{}, http.StatusUnsupportedMediaType: openapi.Error{},
+				http.StatusNotFound: openapi.Error{}, http.StatusConflict: openapi.Error{}, http.StatusUnprocessableEntity: openapi.Error{}}},
+		{Handler: h.IssueChallenge, Summary: "Issue the caller a liveness challenge to answer once within a minute",
+			Responses: openapi.Responses{http.StatusCreated: face.IssuedChallenge{}}},
+		{Handler: h.CheckChallenge, Summary: "Check the liveness of a person asked to turn their head or blink, as issued", Form: challengeForm{},
+			Responses: openapi.Responses{http.StatusOK: face.Liveness{}, http.StatusBadRequest: openapi.Error{},
+				http.StatusNotFound: openapi.Error{}, http.StatusRequestEntityTooLarge: openapi.Error{},
+				http.StatusUnsupportedMediaType: openapi.Error{}, http.StatusUnprocessableEntity: openapi.Error{}}},
+		{Handler: h.GetEnrollment, Summary: "Get the caller's enrolled face",
+			Responses: openapi.Responses{http.StatusOK: face.Embedding{}, http.StatusNotFound: openapi.Error{}}},
+		{Handler: h.Enroll, Summary: "Enroll the caller's reference face", Form: imageForm{},
+			Responses: openapi.Responses{http.StatusCreated: face.Embedding{}, http.StatusBadRequest: openapi.Error{},
+				http.StatusRequestEntityTooLarge: openapi.Error{}, http.StatusUnsupportedMediaType: openapi.Error{},
+				http.StatusConflict: openapi.Error{}, http.StatusUnprocessableEntity: openapi.Error{}}},
+		{Handler: h.Reenroll, Summary: "Replace the caller's reference face", Form: imageForm{},
+			Responses: openapi.Responses{http.StatusOK: face.Embedding{}, http.StatusBadRequest: openapi.Error{},
+				http.StatusRequestEntityTooLarge: openapi.Error{}, http.StatusUnsupportedMediaType: openapi.Error{},
+				http.StatusNotFound: openapi.Error{}, http.StatusUnprocessableEntity: openapi.Error{}}},
+		{Handler: h.Unenroll, Summary: "Delete the caller's reference face",
+			Responses: openapi.Responses{http.StatusNoContent: nil, http.StatusNotFound: openapi.Error{}}},
+		{Handler: h.ListDuplicates, Summary: "Enrolled faces flagged as duplicating another user's, oldest first, for admins",
+			Params: []openapi.Param{
+				{Name: "status", In: openapi.InQuery},
+				{Name: "limit", In: openapi.InQuery, Type: "integer"},
+				{Name: "offset", In: openapi.InQuery, Type: "integer"},
+			},
+			Responses: openapi.Responses{http.StatusOK: struct {
+				Duplicates []*face.Duplicate `json:"duplicates"`
+				Pagination struct {
+					Limit  int `json:"limit"`
+					Offset int `json:"offset"`
+				} `json:"pagination"`
+			}{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: h.ConfirmDuplicate, Summary: "Confirm a duplicate, blocking its user from converting points, for admins", Params: idParam,
+			Responses: openapi.Responses{http.StatusOK: face.Duplicate{}, http.StatusBadRequest: openapi.Error{},
+				http.StatusNotFound: openapi.Error{}}},
+		{Handler: h.DismissDuplicate, Summary: "Dismiss a duplicate as different people, for admins", Params: idParam,
+			Responses: openapi.Responses{http.StatusOK: face.Duplicate{}, http.StatusBadRequest: openapi.Error{},
+				http.StatusNotFound: openapi.Error{}}},
 	}
 }
 
 // DetectFace handles face detection requests
 func (h *Handler) DetectFace(c *gin.Context) {
-	file, err := c.FormFile("image")
+	img, ok := h.upload(c)
+	if !ok {
+		return
+	}
+
+	// Perform face detection
+	detection, err := h.service.DetectFace(c.Request.Context(), img)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "No image file provided",
-		})
+		c.Error(fmt.Errorf("detect face: %w", err))
 		return
 	}
 
-	// Validate file size and type
-	if err := h.validateFile(file); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	c.JSON(http.StatusOK, detection)
+}
+
+// VerifyFace matches the uploaded face against the caller's enrolled face
+func (h *Handler) VerifyFace(c *gin.Context) {
+	img, ok := h.upload(c)
+	if !ok {
 		return
 	}
 
-	// Open and decode image
-	img, err := h.decodeImage(file)
+	userID := c.GetInt64(middleware.UserIDKey)
+	result, err := h.verifier.Verify(c.Request.Context(), userID, img)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid image format",
-		})
+		c.Error(err)
 		return
 	}
 
-	// Perform face detection
-	detection, err := h.service.DetectFace(c.Request.Context(), img)
+	c.JSON(http.StatusOK, result)
+}
+
+// IssueChallenge picks the challenge the caller is to answer
+func (h *Handler) IssueChallenge(c *gin.Context) {
+	userID := c.GetInt64(middleware.UserIDKey)
+	issued, err := h.verifier.IssueChallenge(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Face detection failed",
-		})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, detection)
+	c.JSON(http.StatusCreated, issued)
 }
 
-// VerifyFace handles face verification requests
-func (h *Handler) VerifyFace(c *gin.Context) {
-	// TODO: Implement face verification
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error": "Face verification not implemented yet",
-	})
+// CheckChallenge checks the liveness of the person in the uploaded frames,
+// answering the challenge the caller was issued
+func (h *Handler) CheckChallenge(c *gin.Context) {
+	h.limitBody(c, face.MaxChallengeFrames)
+	var form challengeForm
+	if err := h.bind(c, &form); err != nil {
+		c.Error(err)
+		return
+	}
+	frames := make([]image.Image, len(form.Frames))
+	for i, file := range form.Frames {
+		img, ok := h.decode(c, file)
+		if !ok {
+			return
+		}
+		frames[i] = img
+	}
+
+	userID := c.GetInt64(middleware.UserIDKey)
+	result, err := h.verifier.AnswerChallenge(c.Request.Context(), userID, form.ChallengeID, frames)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetEnrollment returns when the caller enrolled their face
+func (h *Handler) GetEnrollment(c *gin.Context) {
+	userID := c.GetInt64(middleware.UserIDKey)
+	enrollment, err := h.verifier.Enrollment(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Enroll stores the uploaded face as the caller's reference face
+func (h *Handler) Enroll(c *gin.Context) {
+	img, ok := h.upload(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetInt64(middleware.UserIDKey)
+	enrollment, err := h.verifier.Enroll(c.Request.Context(), userID, img)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, enrollment)
 }
 
-// validateFile validates the uploaded file
-func (h *Handler) validateFile(file *multipart.FileHeader) error {
-	// TODO: Implement file validation
-	return nil
+// Reenroll replaces the caller's reference face with the uploaded one
+func (h *Handler) Reenroll(c *gin.Context) {
+	img, ok := h.upload(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetInt64(middleware.UserIDKey)
+	enrollment, err := h.verifier.Reenroll(c.Request.Context(), userID, img)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Unenroll deletes the caller's reference face
+func (h *Handler) Unenroll(c *gin.Context) {
+	userID := c.GetInt64(middleware.UserIDKey)
+	if err := h.verifier.Unenroll(c.Request.Context(), userID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
 }
 
-// decodeImage decodes the uploaded image file
-func (h *Handler) decodeImage(file *multipart.FileHeader) (image.Image, error) {
-	src, err := file.Open()
+// ListDuplicates lists the flagged duplicates, those with the status
+// queried if any
+func (h *Handler) ListDuplicates(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", face.DuplicatePending, face.DuplicateConfirmed, face.DuplicateDismissed:
+	default:
+		c.Error(apperr.Invalid("status must be PENDING, CONFIRMED or DISMISSED"))
+		return
+	}
+	limit := 20
+	offset := 0
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, 100)
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	duplicates, err := h.verifier.Duplicates(c.Request.Context(), status, limit, offset)
 	if err != nil {
-		return nil, err
+		c.Error(err)
+		return
 	}
-	defer src.Close()
 
-	// Read the entire file into memory
-	buf := new(bytes.Buffer)
-	if _, err := io.Copy(buf, src); err != nil {
-		return nil, err
+	c.JSON(http.StatusOK, gin.H{
+		"duplicates": duplicates,
+		"pagination": gin.H{
+			"limit":  limit,
+			"offset": offset,
+		},
+	})
+}
+
+// ConfirmDuplicate confirms a flagged duplicate
+func (h *Handler) ConfirmDuplicate(c *gin.Context) {
+	h.review(c, face.DuplicateConfirmed)
+}
+
+// DismissDuplicate dismisses a flagged duplicate
+func (h *Handler) DismissDuplicate(c *gin.Context) {
+	h.review(c, face.DuplicateDismissed)
+}
+
+// review records the caller's decision on the duplicate in the path
+func (h *Handler) review(c *gin.Context, status string) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apperr.Invalid("invalid duplicate ID"))
+		return
 	}
 
-	// Decode the image
-	img, err := jpeg.Decode(buf)
+	reviewerID := c.GetInt64(middleware.UserIDKey)
+	duplicate, err := h.verifier.ReviewDuplicate(c.Request.Context(), id, status, reviewerID)
 	if err != nil {
-		return nil, err
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, duplicate)
+}
+
+// upload binds, validates and decodes the uploaded image, reporting the
+// error and returning false if it can't
+func (h *Handler) upload(c *gin.Context) (image.Image, bool) {
+	h.limitBody(c, 1)
+	var form imageForm
+	if err := h.bind(c, &form); err != nil {
+		c.Error(err)
+		return nil, false
 	}
+	return h.decode(c, form.Image)
+}
 
-	return img, nil
-} 
\ No newline at end of file
+// decode validates and decodes an uploaded image like upload
+func (h *Handler) decode(c *gin.Context, file *multipart.FileHeader) (image.Image, bool) {
+	img, err := h.uploads.decode(file)
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	return img, true
+}
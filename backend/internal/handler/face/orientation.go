@@ -0,0 +1,194 @@
+package face
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+)
+
+// orientationTag is the EXIF tag of the orientation
+const orientationTag = 0x0112
+
+// orientation returns the EXIF orientation of an image file of
+// contentType, from 1 to 8, or 1, upright, if it has none. It tells how
+// the pixels stored are rotated and flipped.
+func orientation(contentType string, data []byte) int {
+	var exif []byte
+	switch contentType {
+	case "image/jpeg":
+		exif = jpegExif(data)
+	case "image/png":
+		exif = pngExif(data)
+	case "image/webp":
+		exif = webpExif(data)
+	}
+	return tiffOrientation(exif)
+}
+
+// jpegExif returns the EXIF metadata of a JPEG file, from its APP1
+// segment, or nil if it has none
+func jpegExif(data []byte) []byte {
+	data = data[min(2, len(data)):] // Start of image
+	for len(data) >= 4 && data[0] == 0xff {
+		marker := data[1]
+		switch marker {
+		case 0xff:
+			data = data[1:] // Fill byte
+			continue
+		case 0xda, 0xd9:
+			return nil // Start of scan or end of image: the metadata is over
+		}
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if length < 2 || 2+length > len(data) {
+			return nil
+		}
+		segment := data[4 : 2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		data = data[2+length:]
+	}
+	return nil
+}
+
+// pngExif returns the EXIF metadata of a PNG file, from its eXIf chunk,
+// or nil if it has none
+func pngExif(data []byte) []byte {
+	data = data[min(8, len(data)):] // Signature
+	for len(data) >= 12 {
+		length := int64(binary.BigEndian.Uint32(data))
+		if length > int64(len(data)-12) {
+			return nil
+		}
+		switch string(data[4:8]) {
+		case "eXIf":
+			return data[8 : 8+length]
+		case "IEND":
+			return nil
+		}
+		data = data[12+length:] // Length, type, data and CRC
+	}
+	return nil
+}
+
+// webpExif returns the EXIF metadata of a WebP file, from its EXIF chunk,
+// or nil if it has none
+func webpExif(data []byte) []byte {
+	data = data[min(12, len(data)):] // RIFF header
+	for len(data) >= 8 {
+		size := int64(binary.LittleEndian.Uint32(data[4:]))
+		if size > int64(len(data)-8) {
+			return nil
+		}
+		if string(data[:4]) == "EXIF" {
+			// Some writers keep the header of the JPEG segment
+			return bytes.TrimPrefix(data[8:8+size], []byte("Exif\x00\x00"))
+		}
+		data = data[min(8+size+size%2, int64(len(data))):] // Chunks are padded to an even size
+	}
+	return nil
+}
+
+// tiffOrientation returns the orientation tag of the first image of EXIF
+// metadata, a TIFF file, or 1 if it has none
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int64(order.Uint32(tiff[4:]))
+	if offset+2 > int64(len(tiff)) {
+		return 1
+	}
+	entries := tiff[offset+2:]
+	for i := range int(order.Uint16(tiff[offset:])) {
+		if 12*(i+1) > len(entries) {
+			return 1
+		}
+		entry := entries[12*i : 12*(i+1)] // Tag, type, count and value
+		if order.Uint16(entry) != orientationTag {
+			continue
+		}
+		const short = 3
+		if order.Uint16(entry[2:]) != short {
+			return 1
+		}
+		if o := int(order.Uint16(entry[8:])); o >= 1 && o <= 8 {
+			return o
+		}
+		return 1
+	}
+	return 1
+}
+
+// orient rotates and flips an image stored with an EXIF orientation
+// upright. Phone cameras store photos as the sensor reads them, recording
+// how to turn them, and faces are only detected upright. The pixels are
+// read from the decoded image in place, so turning it takes one copy.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	at := rgbaAt(img)
+
+	size := image.Pt(w, h)
+	if orientation >= 5 {
+		size = image.Pt(h, w) // Turned a quarter
+	}
+	dst := image.NewRGBA(image.Rectangle{Max: size})
+	for y := range dst.Rect.Dy() {
+		for x := range dst.Rect.Dx() {
+			var sx, sy int
+			switch orientation {
+			case 2: // Flipped horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // Flipped vertically
+				sx, sy = x, h-1-y
+			case 5: // Transposed
+				sx, sy = y, x
+			case 6: // Rotated 90° counterclockwise, turned clockwise
+				sx, sy = y, h-1-x
+			case 7: // Transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotated 90° clockwise, turned counterclockwise
+				sx, sy = w-1-y, x
+			}
+			c := at(b.Min.X+sx, b.Min.Y+sy)
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+	}
+	return dst
+}
+
+// rgbaAt returns a function reading the color at a point of img, avoiding
+// the color.Color interface for the types JPEGs and PNGs decode to most
+func rgbaAt(img image.Image) func(x, y int) color.RGBA {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) color.RGBA {
+			c := img.YCbCrAt(x, y)
+			r, g, b := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+			return color.RGBA{r, g, b, 0xff}
+		}
+	case *image.RGBA:
+		return img.RGBAAt
+	}
+	return func(x, y int) color.RGBA {
+		return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	}
+}
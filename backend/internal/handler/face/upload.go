@@ -0,0 +1,122 @@
+package face
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/webp"
+
+	"vws-backend/internal/apperr"
+)
+
+// UploadConfig limits the images clients upload
+type UploadConfig struct {
+	MaxFileSize  int64    // Largest image file accepted, in bytes
+	AllowedTypes []string // Types of image accepted, sniffed from their content rather than taken from the client
+	MaxPixels    int      // Most pixels, width times height, an image is decoded with
+}
+
+var errInvalidImage = apperr.New(apperr.ErrInvalid, "invalid_image", "the image is empty, damaged or not an image")
+
+// formats decode the types of image that can be allowed
+var formats = map[string]struct {
+	decode       func(io.Reader) (image.Image, error)
+	decodeConfig func(io.Reader) (image.Config, error)
+}{
+	"image/jpeg": {jpeg.Decode, jpeg.DecodeConfig},
+	"image/png":  {png.Decode, png.DecodeConfig},
+	"image/webp": {webp.Decode, webp.DecodeConfig},
+}
+
+// formOverhead is the room a request body has besides its images, for the
+// multipart headers and fields around them
+const formOverhead = 64 << 10
+
+// limitBody cuts the request body off past files images of the largest
+// size accepted, before the form is read to disk
+func (h *Handler) limitBody(c *gin.Context, files int) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(files)*h.uploads.MaxFileSize+formOverhead)
+}
+
+// bind binds the multipart form like c.ShouldBind, reporting a body cut
+// off by limitBody as too large
+func (h *Handler) bind(c *gin.Context, form any) error {
+	err := c.ShouldBind(form)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return h.uploads.tooLarge()
+	}
+	if err != nil {
+		return apperr.Binding(err)
+	}
+	return nil
+}
+
+// decode checks an uploaded image against the limits and decodes it
+// upright
+func (u UploadConfig) decode(file *multipart.FileHeader) (image.Image, error) {
+	if file.Size > u.MaxFileSize {
+		return nil, u.tooLarge()
+	}
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open upload: %w", err)
+	}
+	defer src.Close()
+
+	// The size in the header is the client's word
+	data, err := io.ReadAll(io.LimitReader(src, u.MaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read upload: %w", err)
+	}
+	if int64(len(data)) > u.MaxFileSize {
+		return nil, u.tooLarge()
+	}
+	return u.decodeImage(data)
+}
+
+// decodeImage decodes an image file, refusing types not allowed and
+// images of more pixels than allowed before decoding them
+func (u UploadConfig) decodeImage(data []byte) (image.Image, error) {
+	if len(data) == 0 {
+		return nil, errInvalidImage
+	}
+	contentType := http.DetectContentType(data)
+	format, ok := formats[contentType]
+	if !ok || !slices.Contains(u.AllowedTypes, contentType) {
+		contentType, _, _ = strings.Cut(contentType, ";")
+		return nil, apperr.New(apperr.ErrUnsupported, "unsupported_image_type",
+			fmt.Sprintf("%s is not accepted, expected %s", contentType, strings.Join(u.AllowedTypes, ", ")))
+	}
+
+	// A small file can claim a huge image, which would take all the
+	// memory to decode
+	config, err := format.decodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return nil, errInvalidImage
+	}
+	if int64(config.Width)*int64(config.Height) > int64(u.MaxPixels) {
+		return nil, apperr.New(apperr.ErrTooLarge, "image_too_many_pixels",
+			fmt.Sprintf("the image is %dx%d, more than %d pixels", config.Width, config.Height, u.MaxPixels))
+	}
+
+	img, err := format.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errInvalidImage
+	}
+	return orient(img, orientation(contentType, data)), nil
+}
+
+func (u UploadConfig) tooLarge() error {
+	return apperr.New(apperr.ErrTooLarge, "image_too_large", fmt.Sprintf("an image is at most %d bytes", u.MaxFileSize))
+}
@@ -0,0 +1,198 @@
+package face
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/apperr"
+)
+
+var testUploads = UploadConfig{
+	MaxFileSize:  1 << 20,
+	AllowedTypes: []string{"image/jpeg", "image/png", "image/webp"},
+	MaxPixels:    1000 * 1000,
+}
+
+// exif returns EXIF metadata holding orientation
+func exif(order binary.AppendByteOrder, orientation uint16) []byte {
+	tiff := []byte("II*\x00")
+	if order == binary.BigEndian {
+		tiff = []byte("MM\x00*")
+	}
+	tiff = order.AppendUint32(tiff, 8)      // First directory
+	tiff = order.AppendUint16(tiff, 2)      // Entries
+	tiff = order.AppendUint16(tiff, 0x010f) // Make
+	tiff = order.AppendUint16(tiff, 2)      // ASCII
+	tiff = order.AppendUint32(tiff, 4)      // Count
+	tiff = append(tiff, "VWS\x00"...)       // Value
+	tiff = order.AppendUint16(tiff, 0x0112) // Orientation
+	tiff = order.AppendUint16(tiff, 3)      // SHORT
+	tiff = order.AppendUint32(tiff, 1)      // Count
+	tiff = order.AppendUint16(tiff, orientation)
+	tiff = order.AppendUint16(tiff, 0) // Padding of the value
+	return order.AppendUint32(tiff, 0) // No next directory
+}
+
+// pngWithExif encodes img as a PNG with an eXIf chunk after the header
+func pngWithExif(t *testing.T, img image.Image, exif []byte) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	data := buf.Bytes()
+	header := 8 + 12 + 13 // Signature and IHDR chunk
+
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(exif)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, exif...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	return append(append(append([]byte{}, data[:header]...), chunk...), data[header:]...)
+}
+
+// jpegWithExif encodes img as a JPEG with an APP1 segment after the start
+func jpegWithExif(t *testing.T, img image.Image, exif []byte) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	data := buf.Bytes()
+
+	segment := []byte{0xff, 0xe1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(2+6+len(exif)))
+	segment = append(segment, "Exif\x00\x00"...)
+	segment = append(segment, exif...)
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+func TestDecodeImage_Orientation(t *testing.T) {
+	// Every pixel of a 3x2 image is told apart by its red
+	stored := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := range 2 {
+		for x := range 3 {
+			stored.Set(x, y, color.RGBA{uint8(10 * (3*y + x + 1)), 0, 0, 255})
+		}
+	}
+	red := func(img image.Image, p image.Point) uint8 {
+		r, _, _, _ := img.At(p.X, p.Y).RGBA()
+		return uint8(r >> 8)
+	}
+
+	// Where the first two pixels stored end up, upright
+	for orientation, want := range map[uint16]struct {
+		size          image.Point
+		first, second image.Point
+	}{
+		1: {image.Pt(3, 2), image.Pt(0, 0), image.Pt(1, 0)},
+		2: {image.Pt(3, 2), image.Pt(2, 0), image.Pt(1, 0)},
+		3: {image.Pt(3, 2), image.Pt(2, 1), image.Pt(1, 1)},
+		4: {image.Pt(3, 2), image.Pt(0, 1), image.Pt(1, 1)},
+		5: {image.Pt(2, 3), image.Pt(0, 0), image.Pt(0, 1)},
+		6: {image.Pt(2, 3), image.Pt(1, 0), image.Pt(1, 1)},
+		7: {image.Pt(2, 3), image.Pt(1, 2), image.Pt(1, 1)},
+		8: {image.Pt(2, 3), image.Pt(0, 2), image.Pt(0, 1)},
+		9: {image.Pt(3, 2), image.Pt(0, 0), image.Pt(1, 0)}, // Invalid, ignored
+	} {
+		for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+			img, err := testUploads.decodeImage(pngWithExif(t, stored, exif(order, orientation)))
+			require.NoError(t, err, "orientation %d", orientation)
+			assert.Equal(t, want.size, img.Bounds().Size(), "orientation %d", orientation)
+			assert.Equal(t, uint8(10), red(img, want.first), "orientation %d", orientation)
+			assert.Equal(t, uint8(20), red(img, want.second), "orientation %d", orientation)
+		}
+	}
+
+	// Phone photos are JPEGs
+	img, err := testUploads.decodeImage(jpegWithExif(t, image.NewRGBA(image.Rect(0, 0, 40, 16)), exif(binary.BigEndian, 6)))
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(16, 40), img.Bounds().Size())
+
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00" + string(make([]byte, 10)) + "EXIF")
+	webp = binary.LittleEndian.AppendUint32(webp, uint32(len(exif(binary.LittleEndian, 8))))
+	webp = append(webp, exif(binary.LittleEndian, 8)...)
+	assert.Equal(t, 8, orientation("image/webp", webp))
+
+	for name, data := range map[string][]byte{
+		"no metadata":    {0xff, 0xd8, 0xff, 0xdb, 0x00, 0x04, 0x00, 0x00, 0xff, 0xda},
+		"truncated":      {0xff, 0xd8, 0xff, 0xe1, 0x01, 0x00, 'E', 'x', 'i', 'f'},
+		"bad directory":  jpegWithExif(t, stored, []byte("II*\x00\xff\xff\xff\xff")),
+		"not TIFF":       jpegWithExif(t, stored, []byte("not a TIFF file")),
+		"empty metadata": jpegWithExif(t, stored, nil),
+	} {
+		assert.Equal(t, 1, orientation("image/jpeg", data), name)
+	}
+}
+
+func TestOrient_ImageTypes(t *testing.T) {
+	// A gray 4x2 image, offset as a sub-image is, in each type it can
+	// decode to; the fast paths must agree with the generic one
+	gray := image.NewGray(image.Rect(1, 1, 5, 3))
+	for y := 1; y < 3; y++ {
+		for x := 1; x < 5; x++ {
+			gray.SetGray(x, y, color.Gray{uint8(40 * (2*x + y))})
+		}
+	}
+	rgba := image.NewRGBA(gray.Rect)
+	ycbcr := image.NewYCbCr(gray.Rect, image.YCbCrSubsampleRatio444)
+	for y := 1; y < 3; y++ {
+		for x := 1; x < 5; x++ {
+			rgba.Set(x, y, gray.At(x, y))
+			ycbcr.Y[ycbcr.YOffset(x, y)] = gray.GrayAt(x, y).Y
+			ycbcr.Cb[ycbcr.COffset(x, y)], ycbcr.Cr[ycbcr.COffset(x, y)] = 128, 128
+		}
+	}
+
+	want := orient(gray, 6)
+	require.Equal(t, image.Rect(0, 0, 2, 4), want.Bounds())
+	assert.Equal(t, color.RGBAModel.Convert(gray.At(1, 2)), want.At(0, 0), "the bottom left corner turned to the top left")
+	for _, img := range []image.Image{rgba, ycbcr} {
+		assert.Equal(t, want, orient(img, 6), "%T", img)
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	gopher, err := os.ReadFile("testdata/gopher.webp")
+	require.NoError(t, err)
+	img, err := testUploads.decodeImage(gopher)
+	require.NoError(t, err)
+	assert.False(t, img.Bounds().Empty())
+
+	var photo bytes.Buffer
+	require.NoError(t, png.Encode(&photo, image.NewGray(image.Rect(0, 0, 1001, 1000))))
+	gif := []byte("GIF89a")
+
+	// A header alone claims 100000x100000 pixels
+	ihdr := append([]byte("IHDR"), binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 100000), 100000)...)
+	ihdr = append(ihdr, 8, 0, 0, 0, 0) // 8 bit grayscale
+	bomb := append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d"), ihdr...)
+	bomb = binary.BigEndian.AppendUint32(bomb, crc32.ChecksumIEEE(ihdr))
+
+	for name, tc := range map[string]struct {
+		uploads UploadConfig
+		data    []byte
+		kind    error
+		code    string
+	}{
+		"empty":           {testUploads, nil, apperr.ErrInvalid, "invalid_image"},
+		"text":            {testUploads, []byte("hello"), apperr.ErrUnsupported, "unsupported_image_type"},
+		"unsupported":     {testUploads, gif, apperr.ErrUnsupported, "unsupported_image_type"},
+		"not allowed":     {UploadConfig{MaxFileSize: 1 << 20, AllowedTypes: []string{"image/jpeg"}, MaxPixels: 1 << 20}, gopher, apperr.ErrUnsupported, "unsupported_image_type"},
+		"damaged":         {testUploads, gopher[:100], apperr.ErrInvalid, "invalid_image"},
+		"too many pixels": {testUploads, photo.Bytes(), apperr.ErrTooLarge, "image_too_many_pixels"},
+		"bomb":            {testUploads, bomb, apperr.ErrTooLarge, "image_too_many_pixels"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := tc.uploads.decodeImage(tc.data)
+			require.ErrorIs(t, err, tc.kind)
+			var appErr *apperr.Error
+			require.True(t, errors.As(err, &appErr))
+			assert.Equal(t, tc.code, appErr.Code)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"net/http"
+
+	"vws-backend/internal/health"
+	"vws-backend/internal/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	checker *health.Checker
+}
+
+func NewHandler(checker *health.Checker) *Handler {
+	return &Handler{checker: checker}
+}
+
+func (h *Handler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/livez", h.livez)
+	router.GET("/readyz", h.readyz)
+	// Kept for existing monitors; reports readiness like /readyz
+	router.GET("/api/health", h.readyz)
+}
+
+// Routes documents the routes RegisterRoutes adds
+func (h *Handler) Routes() []openapi.Route {
+	return []openapi.Route{
+		{Handler: h.livez, Summary: "Whether the process is serving requests",
+			Responses: openapi.Responses{http.StatusOK: struct {
+				Status string `json:"status"`
+			}{}}},
+		{Handler: h.readyz, Summary: "Whether every dependency is usable",
+			Responses: openapi.Responses{http.StatusOK: health.Report{}, http.StatusServiceUnavailable: health.Report{}}},
+	}
+}
+
+// livez reports that the process is up and serving requests. It never
+// checks dependencies, so an outage doesn't get the server restarted.
+func (h *Handler) livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// readyz reports whether every dependency is usable, with the status and
+// latency of each check; why checks failed is logged
+func (h *Handler) readyz(c *gin.Context) {
+	// Reports are cached and shared, so one client hanging up mustn't fail them
+	report := h.checker.Run(context.WithoutCancel(c.Request.Context()))
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
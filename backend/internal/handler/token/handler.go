@@ -6,7 +6,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"vws-backend/internal/apperr"
 	"vws-backend/internal/middleware"
+	"vws-backend/internal/openapi"
 	"vws-backend/internal/service/token"
 )
 
@@ -18,9 +20,9 @@ func NewHandler(service *token.Service) *Handler {
 	return &Handler{service: service}
 }
 
-func (h *Handler) RegisterRoutes(router *gin.Engine) {
+func (h *Handler) RegisterRoutes(router *gin.Engine, authMiddleware ...gin.HandlerFunc) {
 	api := router.Group("/api/tokens")
-	api.Use(middleware.Auth())
+	api.Use(authMiddleware...)
 	{
 		api.POST("/convert", h.convertPoints)
 		api.POST("/stake", h.stakeTokens)
@@ -31,6 +33,35 @@ func (h *Handler) RegisterRoutes(router *gin.Engine) {
 	}
 }
 
+// Routes documents the routes RegisterRoutes adds
+func (h *Handler) Routes() []openapi.Route {
+	return []openapi.Route{
+		{Handler: h.convertPoints, Summary: "Convert points to tokens, unless the caller is a confirmed duplicate", Body: ConvertRequest{},
+			Responses: openapi.Responses{http.StatusOK: token.Transaction{}, http.StatusBadRequest: openapi.Error{},
+				http.StatusForbidden: openapi.Error{}}},
+		{Handler: h.stakeTokens, Summary: "Stake tokens for a number of days", Body: StakeRequest{},
+			Responses: openapi.Responses{http.StatusOK: token.Transaction{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: h.unstakeTokens, Summary: "Unstake tokens once the stake period has ended",
+			Responses: openapi.Responses{http.StatusOK: token.Transaction{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: h.transferTokens, Summary: "Transfer tokens to another user", Body: TransferRequest{},
+			Responses: openapi.Responses{http.StatusOK: token.Transaction{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: h.getBalance, Summary: "Token balance and stake of the caller",
+			Responses: openapi.Responses{http.StatusOK: token.Token{}}},
+		{Handler: h.getTransactions, Summary: "Transactions of the caller, newest first",
+			Params: []openapi.Param{
+				{Name: "limit", In: openapi.InQuery, Type: "integer"},
+				{Name: "offset", In: openapi.InQuery, Type: "integer"},
+			},
+			Responses: openapi.Responses{http.StatusOK: struct {
+				Transactions []*token.Transaction `json:"transactions"`
+				Pagination   struct {
+					Limit  int `json:"limit"`
+					Offset int `json:"offset"`
+				} `json:"pagination"`
+			}{}}},
+	}
+}
+
 type ConvertRequest struct {
 	Points int `json:"points" binding:"required,min=1"`
 }
@@ -38,18 +69,14 @@ type ConvertRequest struct {
 func (h *Handler) convertPoints(c *gin.Context) {
 	var req ConvertRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
-	userID := c.GetInt64("userID")
+	userID := c.GetInt64(middleware.UserIDKey)
 	txn, err := h.service.ConvertPointsToTokens(c.Request.Context(), userID, req.Points)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err == token.ErrInsufficientBalance {
-			status = http.StatusBadRequest
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -64,20 +91,14 @@ type StakeRequest struct {
 func (h *Handler) stakeTokens(c *gin.Context) {
 	var req StakeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
-	userID := c.GetInt64("userID")
+	userID := c.GetInt64(middleware.UserIDKey)
 	txn, err := h.service.StakeTokens(c.Request.Context(), userID, req.Amount, req.DurationDays)
 	if err != nil {
-		status := http.StatusInternalServerError
-		switch err {
-		case token.ErrInsufficientBalance, token.ErrInvalidAmount,
-			token.ErrInvalidStakePeriod, token.ErrAlreadyStaked:
-			status = http.StatusBadRequest
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -85,15 +106,10 @@ func (h *Handler) stakeTokens(c *gin.Context) {
 }
 
 func (h *Handler) unstakeTokens(c *gin.Context) {
-	userID := c.GetInt64("userID")
+	userID := c.GetInt64(middleware.UserIDKey)
 	txn, err := h.service.UnstakeTokens(c.Request.Context(), userID)
 	if err != nil {
-		status := http.StatusInternalServerError
-		switch err {
-		case token.ErrNoStakedTokens, token.ErrStakePeriodActive:
-			status = http.StatusBadRequest
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -108,23 +124,19 @@ type TransferRequest struct {
 func (h *Handler) transferTokens(c *gin.Context) {
 	var req TransferRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
-	userID := c.GetInt64("userID")
+	userID := c.GetInt64(middleware.UserIDKey)
 	if userID == req.ToUserID {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot transfer to self"})
+		c.Error(apperr.Invalid("cannot transfer to self"))
 		return
 	}
 
 	txn, err := h.service.TransferTokens(c.Request.Context(), userID, req.ToUserID, req.Amount)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err == token.ErrInsufficientBalance || err == token.ErrInvalidAmount {
-			status = http.StatusBadRequest
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -132,10 +144,10 @@ func (h *Handler) transferTokens(c *gin.Context) {
 }
 
 func (h *Handler) getBalance(c *gin.Context) {
-	userID := c.GetInt64("userID")
+	userID := c.GetInt64(middleware.UserIDKey)
 	tokenInfo, err := h.service.GetUserTokens(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -143,7 +155,7 @@ func (h *Handler) getBalance(c *gin.Context) {
 }
 
 func (h *Handler) getTransactions(c *gin.Context) {
-	userID := c.GetInt64("userID")
+	userID := c.GetInt64(middleware.UserIDKey)
 	limit := 10
 	offset := 0
 
@@ -160,7 +172,7 @@ func (h *Handler) getTransactions(c *gin.Context) {
 
 	transactions, err := h.service.GetUserTransactions(c.Request.Context(), userID, limit, offset)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -1,34 +1,88 @@
 package user
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/auth"
+	"vws-backend/internal/middleware"
+	"vws-backend/internal/openapi"
 	"vws-backend/internal/service/user"
 )
 
 // Handler handles HTTP requests for user operations
 type Handler struct {
-	service *user.Service
+	service    *user.Service
+	tokens     *auth.TokenManager
+	refreshTTL time.Duration
 }
 
 // NewHandler creates a new user handler
-func NewHandler(service *user.Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(service *user.Service, tokens *auth.TokenManager, refreshTTL time.Duration) *Handler {
+	if refreshTTL <= 0 {
+		refreshTTL = 30 * 24 * time.Hour
+	}
+	return &Handler{service: service, tokens: tokens, refreshTTL: refreshTTL}
 }
 
 // RegisterRoutes registers the user routes
-func (h *Handler) RegisterRoutes(router *gin.Engine) {
+func (h *Handler) RegisterRoutes(router *gin.Engine, authMiddleware ...gin.HandlerFunc) {
 	users := router.Group("/api/users")
 	{
 		users.POST("/register", h.Register)
 		users.POST("/login", h.Login)
-		users.GET("/me", h.GetProfile)
-		users.PUT("/points", h.UpdatePoints)
+		users.POST("/refresh", h.Refresh)
 		users.GET("/leaderboard", h.GetLeaderboard)
 	}
+
+	authenticated := router.Group("/api/users")
+	authenticated.Use(authMiddleware...)
+	{
+		authenticated.GET("/me", h.GetProfile)
+		authenticated.PUT("/points", h.UpdatePoints)
+
+		// Session management
+		authenticated.GET("/sessions", h.ListSessions)
+		authenticated.DELETE("/sessions", h.RevokeAllSessions)
+		authenticated.DELETE("/sessions/:id", h.RevokeSession)
+	}
+}
+
+// Routes documents the routes RegisterRoutes adds
+func (h *Handler) Routes() []openapi.Route {
+	userIDParam := openapi.Param{Name: "user_id", In: openapi.InQuery, Type: "integer"}
+	return []openapi.Route{
+		{Handler: h.Register, Summary: "Register a user", Body: registerRequest{},
+			Responses: openapi.Responses{http.StatusCreated: user.User{}, http.StatusBadRequest: openapi.Error{}, http.StatusConflict: openapi.Error{}}},
+		{Handler: h.Login, Summary: "Log in and start a session", Body: loginRequest{},
+			Responses: openapi.Responses{http.StatusOK: tokenResponse{}, http.StatusUnauthorized: openapi.Error{}}},
+		{Handler: h.Refresh, Summary: "Exchange a refresh token for new tokens", Body: refreshRequest{},
+			Responses: openapi.Responses{http.StatusOK: tokenResponse{}, http.StatusUnauthorized: openapi.Error{}}},
+		{Handler: h.GetLeaderboard, Summary: "Users with the most points",
+			Params:    []openapi.Param{{Name: "limit", In: openapi.InQuery, Type: "integer"}},
+			Responses: openapi.Responses{http.StatusOK: []*user.User{}}},
+		{Handler: h.GetProfile, Summary: "Profile of the caller",
+			Responses: openapi.Responses{http.StatusOK: user.User{}}},
+		{Handler: h.UpdatePoints, Summary: "Add points to the caller", Body: updatePointsRequest{},
+			Responses: openapi.Responses{http.StatusOK: nil}},
+		{Handler: h.ListSessions, Summary: "Active sessions of the caller, or of any user for admins",
+			Params: []openapi.Param{userIDParam},
+			Responses: openapi.Responses{http.StatusOK: struct {
+				Sessions       []*user.Session `json:"sessions"`
+				CurrentSession int64           `json:"current_session"`
+			}{}, http.StatusForbidden: openapi.Error{}}},
+		{Handler: h.RevokeAllSessions, Summary: "Revoke every session of the caller, or of any user for admins",
+			Params:    []openapi.Param{userIDParam},
+			Responses: openapi.Responses{http.StatusNoContent: nil, http.StatusForbidden: openapi.Error{}}},
+		{Handler: h.RevokeSession, Summary: "Revoke a session",
+			Params:    []openapi.Param{{Name: "id", In: openapi.InPath, Type: "integer"}},
+			Responses: openapi.Responses{http.StatusNoContent: nil, http.StatusNotFound: openapi.Error{}}},
+	}
 }
 
 type registerRequest struct {
@@ -41,13 +95,13 @@ type registerRequest struct {
 func (h *Handler) Register(c *gin.Context) {
 	var req registerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	user, err := h.service.CreateUser(c.Request.Context(), req.Username, req.Email, req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -59,34 +113,95 @@ type loginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type tokenResponse struct {
+	AccessToken      string     `json:"access_token"`
+	TokenType        string     `json:"token_type"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RefreshToken     string     `json:"refresh_token"`
+	RefreshExpiresAt time.Time  `json:"refresh_expires_at"`
+	User             *user.User `json:"user,omitempty"`
+}
+
 // Login handles user login
 func (h *Handler) Login(c *gin.Context) {
 	var req loginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	user, err := h.service.Authenticate(c.Request.Context(), req.Email, req.Password)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	session, refreshToken, err := h.service.CreateSession(c.Request.Context(), user.ID, c.Request.UserAgent(), c.ClientIP(), h.refreshTTL)
+	if err != nil {
+		c.Error(fmt.Errorf("create session: %w", err))
+		return
+	}
+
+	accessToken, expiresAt, err := h.tokens.IssueAccessToken(user.ID, session.ID)
+	if err != nil {
+		c.Error(fmt.Errorf("issue access token: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+		User:             user,
+	})
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token pair
+func (h *Handler) Refresh(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperr.Binding(err))
+		return
+	}
+
+	session, refreshToken, err := h.service.RotateRefreshToken(c.Request.Context(), req.RefreshToken, h.refreshTTL)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	accessToken, expiresAt, err := h.tokens.IssueAccessToken(session.UserID, session.ID)
+	if err != nil {
+		c.Error(fmt.Errorf("issue access token: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	})
 }
 
 // GetProfile returns the user's profile
 func (h *Handler) GetProfile(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	userID, exists := c.Get(middleware.UserIDKey)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.Error(apperr.Unauthorized("Unauthorized"))
 		return
 	}
 
 	user, err := h.service.GetUser(c.Request.Context(), userID.(int64))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -99,21 +214,21 @@ type updatePointsRequest struct {
 
 // UpdatePoints updates the user's points
 func (h *Handler) UpdatePoints(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	userID, exists := c.Get(middleware.UserIDKey)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.Error(apperr.Unauthorized("Unauthorized"))
 		return
 	}
 
 	var req updatePointsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
 	err := h.service.UpdatePoints(c.Request.Context(), userID.(int64), req.Points)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -125,9 +240,119 @@ func (h *Handler) GetLeaderboard(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	users, err := h.service.GetLeaderboard(c.Request.Context(), limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, users)
 }
+
+// ListSessions returns the active sessions of the caller. Admins may pass
+// a user_id query parameter to inspect another user's sessions.
+func (h *Handler) ListSessions(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.service.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions":        sessions,
+		"current_session": c.GetInt64(middleware.SessionIDKey),
+	})
+}
+
+// RevokeSession revokes a single session. Users may revoke their own
+// sessions and admins may revoke any session.
+func (h *Handler) RevokeSession(c *gin.Context) {
+	sessionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apperr.Invalid("Invalid session ID"))
+		return
+	}
+
+	session, err := h.service.GetSession(c.Request.Context(), sessionID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if session.UserID != c.GetInt64(middleware.UserIDKey) {
+		isAdmin, err := h.isAdmin(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if !isAdmin {
+			// Don't reveal that another user's session exists
+			c.Error(user.ErrSessionNotFound)
+			return
+		}
+	}
+
+	if err := h.service.RevokeSession(c.Request.Context(), session.UserID, session.ID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeAllSessions revokes every session of the caller, or of the user
+// given by the user_id query parameter when called by an admin.
+func (h *Handler) RevokeAllSessions(c *gin.Context) {
+	userID, ok := h.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RevokeAllSessions(c.Request.Context(), userID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// targetUserID resolves the user whose sessions are being managed. It records
+// the error and returns false when the request must stop.
+func (h *Handler) targetUserID(c *gin.Context) (int64, bool) {
+	callerID := c.GetInt64(middleware.UserIDKey)
+	userIDStr := c.Query("user_id")
+	if userIDStr == "" {
+		return callerID, true
+	}
+
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		c.Error(apperr.Invalid("Invalid user ID"))
+		return 0, false
+	}
+	if userID == callerID {
+		return userID, true
+	}
+
+	isAdmin, err := h.isAdmin(c)
+	if err != nil {
+		c.Error(err)
+		return 0, false
+	}
+	if !isAdmin {
+		c.Error(apperr.Forbidden("Admin access required"))
+		return 0, false
+	}
+	return userID, true
+}
+
+func (h *Handler) isAdmin(c *gin.Context) (bool, error) {
+	role, err := h.service.GetRole(c.Request.Context(), c.GetInt64(middleware.UserIDKey))
+	if err != nil {
+		return false, err
+	}
+	return role == user.RoleAdmin, nil
+}
@@ -3,7 +3,9 @@ package verification
 import (
 	"net/http"
 
+	"vws-backend/internal/apperr"
 	"vws-backend/internal/middleware"
+	"vws-backend/internal/openapi"
 	"vws-backend/internal/service/verification"
 
 	"github.com/gin-gonic/gin"
@@ -17,9 +19,9 @@ func NewHandler(service *verification.Service) *Handler {
 	return &Handler{service: service}
 }
 
-func (h *Handler) RegisterRoutes(router *gin.Engine) {
+func (h *Handler) RegisterRoutes(router *gin.Engine, authMiddleware ...gin.HandlerFunc) {
 	api := router.Group("/api/verification")
-	api.Use(middleware.Auth())
+	api.Use(authMiddleware...)
 	{
 		api.POST("/verify", h.verifyVoteParticipation)
 		api.GET("/certificate/:id", h.getCertificate)
@@ -28,6 +30,24 @@ func (h *Handler) RegisterRoutes(router *gin.Engine) {
 	}
 }
 
+// Routes documents the routes RegisterRoutes adds
+func (h *Handler) Routes() []openapi.Route {
+	return []openapi.Route{
+		{Handler: h.verifyVoteParticipation, Summary: "Certify participation in an election", Body: VerifyRequest{},
+			Responses: openapi.Responses{http.StatusOK: verification.Certificate{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: h.getCertificate, Summary: "Fetch a certificate of the caller",
+			Responses: openapi.Responses{http.StatusOK: verification.Certificate{}, http.StatusForbidden: openapi.Error{}, http.StatusNotFound: openapi.Error{}}},
+		{Handler: h.getUserCertificates, Summary: "Certificates of the caller",
+			Responses: openapi.Responses{http.StatusOK: struct {
+				Certificates []*verification.Certificate `json:"certificates"`
+			}{}}},
+		{Handler: h.verifyCertificate, Summary: "Check a certificate against the blockchain",
+			Responses: openapi.Responses{http.StatusOK: struct {
+				Valid bool `json:"valid"`
+			}{}}},
+	}
+}
+
 type VerifyRequest struct {
 	ElectionID string `json:"electionId" binding:"required"`
 	ProofData  []byte `json:"proofData" binding:"required"`
@@ -36,14 +56,14 @@ type VerifyRequest struct {
 func (h *Handler) verifyVoteParticipation(c *gin.Context) {
 	var req VerifyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperr.Binding(err))
 		return
 	}
 
-	userID := c.GetInt64("userID")
+	userID := c.GetInt64(middleware.UserIDKey)
 	cert, err := h.service.VerifyVoteParticipation(c.Request.Context(), userID, req.ElectionID, req.ProofData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -54,14 +74,14 @@ func (h *Handler) getCertificate(c *gin.Context) {
 	id := c.Param("id")
 	cert, err := h.service.GetCertificate(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "certificate not found"})
+		c.Error(err)
 		return
 	}
 
 	// Check if the certificate belongs to the requesting user
-	userID := c.GetInt64("userID")
+	userID := c.GetInt64(middleware.UserIDKey)
 	if cert.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		c.Error(apperr.Forbidden("access denied"))
 		return
 	}
 
@@ -69,10 +89,10 @@ func (h *Handler) getCertificate(c *gin.Context) {
 }
 
 func (h *Handler) getUserCertificates(c *gin.Context) {
-	userID := c.GetInt64("userID")
+	userID := c.GetInt64(middleware.UserIDKey)
 	certs, err := h.service.GetUserCertificates(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -83,7 +103,7 @@ func (h *Handler) verifyCertificate(c *gin.Context) {
 	id := c.Param("id")
 	isValid, err := h.service.VerifyCertificate(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -0,0 +1,84 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Database checks that the database accepts connections
+func Database(db *sql.DB) CheckFunc {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// Migrations checks that the schema is at the expected version and that
+// no migration was left half applied
+func Migrations(db *sql.DB, expected uint) CheckFunc {
+	return func(ctx context.Context) error {
+		var version uint
+		var dirty bool
+		err := db.QueryRowContext(ctx,
+			`SELECT version, dirty FROM schema_migrations LIMIT 1`,
+		).Scan(&version, &dirty)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no migrations applied, expected version %d", expected)
+		}
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("migration %d is dirty", version)
+		}
+		if version != expected {
+			return fmt.Errorf("schema is at version %d, expected %d", version, expected)
+		}
+		return nil
+	}
+}
+
+// ChainReader is the part of the Ethereum client the chain check uses
+type ChainReader interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// Chain checks that the Ethereum node is on the expected chain and, when
+// maxBlockAge is set, that its latest block is recent enough to show the
+// node is in sync
+func Chain(client ChainReader, expectedChainID int64, maxBlockAge time.Duration) CheckFunc {
+	return func(ctx context.Context) error {
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			return fmt.Errorf("get chain id: %w", err)
+		}
+		if chainID.Cmp(big.NewInt(expectedChainID)) != 0 {
+			return fmt.Errorf("node is on chain %s, expected %d", chainID, expectedChainID)
+		}
+
+		if maxBlockAge <= 0 {
+			return nil
+		}
+		header, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("get latest block: %w", err)
+		}
+		age := time.Since(time.Unix(int64(header.Time), 0))
+		if age > maxBlockAge {
+			return fmt.Errorf("latest block %s is %s old", header.Number, age.Round(time.Second))
+		}
+		return nil
+	}
+}
+
+// Ready adapts a component's readiness method to a check
+func Ready(ready func() error) CheckFunc {
+	return func(context.Context) error {
+		return ready()
+	}
+}
@@ -0,0 +1,157 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"vws-backend/internal/logging"
+)
+
+// Check statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Defaults used when a check or checker leaves them unset
+const (
+	DefaultTimeout  = 2 * time.Second
+	DefaultCacheTTL = 2 * time.Second
+)
+
+var ErrCheckTimeout = errors.New("check timed out")
+
+// CheckFunc reports whether a dependency is usable
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named readiness check
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Run     CheckFunc
+}
+
+// Result is the outcome of a single check. Reports are served to anyone
+// probing the server, so errors are logged instead, as they can name
+// hosts, users and queries.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"-"`
+}
+
+// Report is the outcome of all checks
+type Report struct {
+	Status    string    `json:"status"`
+	Checks    []Result  `json:"checks"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Healthy reports whether every check passed
+func (r *Report) Healthy() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs readiness checks concurrently and caches the report
+// briefly, so frequent probes don't hammer the dependencies
+type Checker struct {
+	checks   []Check
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	report *Report
+}
+
+// NewChecker creates a checker caching reports for cacheTTL
+func NewChecker(cacheTTL time.Duration) *Checker {
+	if cacheTTL <= 0 {
+		cacheTTL = DefaultCacheTTL
+	}
+	return &Checker{cacheTTL: cacheTTL, now: time.Now}
+}
+
+// Add registers a check. A zero timeout uses DefaultTimeout.
+func (c *Checker) Add(name string, timeout time.Duration, run CheckFunc) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c.checks = append(c.checks, Check{Name: name, Timeout: timeout, Run: run})
+}
+
+// Run returns the cached report if it is fresh, or runs every check
+func (c *Checker) Run(ctx context.Context) *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.report != nil && c.now().Sub(c.report.CheckedAt) < c.cacheTTL {
+		return c.report
+	}
+
+	report := &Report{
+		Status:    StatusOK,
+		Checks:    make([]Result, len(c.checks)),
+		CheckedAt: c.now(),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = runCheck(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+			logging.FromContext(ctx).Warn("readiness check failed",
+				"check", result.Name, "error", result.Error, "latency_ms", result.LatencyMS)
+		}
+	}
+
+	c.report = report
+	return report
+}
+
+// runCheck runs one check, giving up once its timeout has passed even if
+// the check ignores its context
+func runCheck(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrCheckTimeout
+	}
+
+	result := Result{
+		Name:      check.Name,
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
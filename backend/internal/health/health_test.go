@@ -0,0 +1,133 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/logging"
+)
+
+func TestChecker_ReportsEachCheck(t *testing.T) {
+	checker := NewChecker(time.Minute)
+	checker.Add("ok", 0, func(context.Context) error { return nil })
+	checker.Add("broken", 0, func(context.Context) error { return errors.New("down") })
+
+	report := checker.Run(context.Background())
+	assert.False(t, report.Healthy())
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, Result{Name: "ok", Status: StatusOK, LatencyMS: report.Checks[0].LatencyMS}, report.Checks[0])
+	assert.Equal(t, StatusFail, report.Checks[1].Status)
+	assert.Equal(t, "down", report.Checks[1].Error)
+}
+
+func TestChecker_LogsFailures(t *testing.T) {
+	var logs bytes.Buffer
+	ctx := logging.WithContext(context.Background(), logging.New(&logs, slog.LevelInfo))
+	checker := NewChecker(time.Minute)
+	checker.Add("ok", 0, func(context.Context) error { return nil })
+	checker.Add("database", 0, func(context.Context) error {
+		return errors.New(`dial tcp 10.0.0.5:5432: password authentication failed for user "vws"`)
+	})
+
+	report := checker.Run(ctx)
+	encoded, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"status": "fail", "checked_at": %q, "checks": [
+		{"name": "ok", "status": "ok", "latency_ms": %v},
+		{"name": "database", "status": "fail", "latency_ms": %v}
+	]}`, report.CheckedAt.Format(time.RFC3339Nano), report.Checks[0].LatencyMS, report.Checks[1].LatencyMS),
+		string(encoded), "the report names the failed check, without its error")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &record), "one record, of the failed check")
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "database", record["check"])
+	assert.Contains(t, record["error"], "password authentication failed")
+}
+
+func TestChecker_TimesOut(t *testing.T) {
+	checker := NewChecker(time.Minute)
+	checker.Add("slow", 10*time.Millisecond, func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	report := checker.Run(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, ErrCheckTimeout.Error(), report.Checks[0].Error)
+}
+
+func TestChecker_CachesReport(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	checker := NewChecker(time.Second)
+	checker.now = func() time.Time { return now }
+
+	calls := 0
+	checker.Add("counted", 0, func(context.Context) error {
+		calls++
+		return nil
+	})
+
+	checker.Run(context.Background())
+	checker.Run(context.Background())
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(time.Second)
+	checker.Run(context.Background())
+	assert.Equal(t, 2, calls)
+}
+
+func TestMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := func(version int, dirty bool) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"version", "dirty"}).AddRow(version, dirty)
+	}
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).WillReturnRows(rows(6, false))
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).WillReturnRows(rows(5, false))
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).WillReturnRows(rows(6, true))
+
+	check := Migrations(db, 6)
+	assert.NoError(t, check(context.Background()))
+	assert.EqualError(t, check(context.Background()), "schema is at version 5, expected 6")
+	assert.EqualError(t, check(context.Background()), "migration 6 is dirty")
+}
+
+type fakeChain struct {
+	chainID   int64
+	blockTime time.Time
+}
+
+func (f fakeChain) ChainID(context.Context) (*big.Int, error) {
+	return big.NewInt(f.chainID), nil
+}
+
+func (f fakeChain) HeaderByNumber(context.Context, *big.Int) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(100), Time: uint64(f.blockTime.Unix())}, nil
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+
+	assert.NoError(t, Chain(fakeChain{1337, time.Now()}, 1337, time.Minute)(ctx))
+	assert.EqualError(t, Chain(fakeChain{1, time.Now()}, 1337, time.Minute)(ctx), "node is on chain 1, expected 1337")
+	assert.ErrorContains(t, Chain(fakeChain{1337, time.Now().Add(-time.Hour)}, 1337, time.Minute)(ctx), "old")
+
+	// Freshness is optional
+	assert.NoError(t, Chain(fakeChain{1337, time.Now().Add(-time.Hour)}, 1337, 0)(ctx))
+}
@@ -0,0 +1,78 @@
+// Package idempotency stores the responses to requests sent with an
+// Idempotency-Key, so that retrying a request replays its response instead
+// of repeating its effect.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+	ErrMismatch   = errors.New("idempotency key was used for a different request")
+	ErrNotHeld    = errors.New("idempotency key is not claimed by this request")
+)
+
+// Response is a stored response
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store records the requests made with each key. A key is claimed by the
+// first request made with it; until that request completes, others with
+// the same key are turned away, and once it has, they are answered with
+// its response.
+//
+// Each claim is made by an owner, a token unique to the request, and only
+// that owner can complete or release it: once a claim's lock runs out, a
+// retry may take the key over, and the request it was taken from must not
+// overwrite the retry's claim.
+type Store interface {
+	// Begin claims key for owner, a request with the given fingerprint,
+	// holding the claim until lockedUntil and the key until expiresAt. It
+	// returns the response if a request with the key has completed,
+	// ErrInProgress while another request holds the claim and ErrMismatch
+	// if the key was used with another fingerprint. Keys that expired by
+	// now, and claims whose lock did, count as new.
+	Begin(ctx context.Context, key, owner, fingerprint string, now, lockedUntil, expiresAt time.Time) (*Response, error)
+
+	// Complete stores the response to the request holding the claim on
+	// key, returning ErrNotHeld unless owner does
+	Complete(ctx context.Context, key, owner string, resp *Response) error
+
+	// Release drops owner's claim on key without storing a response, so
+	// the request may be retried. It returns ErrNotHeld unless owner
+	// holds the claim.
+	Release(ctx context.Context, key, owner string) error
+
+	// DeleteExpired deletes the keys that expired by now, returning how
+	// many it deleted
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Sweep deletes expired keys from store every interval until ctx is done
+func Sweep(ctx context.Context, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deleted, err := store.DeleteExpired(ctx, now)
+			if err != nil {
+				slog.Error("idempotency keys not swept", "error", err)
+				continue
+			}
+			if deleted > 0 {
+				slog.Debug("idempotency keys swept", "deleted", deleted)
+			}
+		}
+	}
+}
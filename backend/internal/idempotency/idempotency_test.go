@@ -0,0 +1,153 @@
+package idempotency_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/idempotency"
+	"vws-backend/internal/migrate"
+	"vws-backend/migrations"
+)
+
+// newTestStores returns an empty store of each kind. The PostgreSQL store
+// needs a disposable database, named by VWS_TEST_DATABASE_URL.
+func newTestStores(t *testing.T) map[string]func(t *testing.T) idempotency.Store {
+	stores := map[string]func(t *testing.T) idempotency.Store{
+		"memory": func(t *testing.T) idempotency.Store { return idempotency.NewMemoryStore() },
+	}
+
+	url := os.Getenv("VWS_TEST_DATABASE_URL")
+	if url == "" {
+		return stores
+	}
+	db, err := sql.Open("postgres", url)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	m, err := migrate.New(db, migrations.FS)
+	require.NoError(t, err)
+	_, err = m.Up(context.Background())
+	require.NoError(t, err)
+
+	stores["postgres"] = func(t *testing.T) idempotency.Store {
+		_, err := db.Exec(`TRUNCATE idempotency_keys`)
+		require.NoError(t, err)
+		return idempotency.NewPostgresStore(db)
+	}
+	return stores
+}
+
+var (
+	now       = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	lock      = now.Add(time.Minute)
+	expiry    = now.Add(time.Hour)
+	completed = &idempotency.Response{
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body:   []byte(`{"ok":true}`),
+	}
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newStore := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Run("replays completed request", func(t *testing.T) {
+				store := newStore(t)
+				resp, err := store.Begin(ctx, "k", "a", "fp", now, lock, expiry)
+				require.NoError(t, err)
+				assert.Nil(t, resp)
+				require.NoError(t, store.Complete(ctx, "k", "a", completed))
+
+				resp, err = store.Begin(ctx, "k", "b", "fp", now.Add(time.Second), lock, expiry)
+				require.NoError(t, err)
+				assert.Equal(t, completed, resp)
+			})
+
+			t.Run("rejects other fingerprint", func(t *testing.T) {
+				store := newStore(t)
+				_, err := store.Begin(ctx, "k", "a", "fp", now, lock, expiry)
+				require.NoError(t, err)
+				require.NoError(t, store.Complete(ctx, "k", "a", completed))
+
+				_, err = store.Begin(ctx, "k", "b", "other", now, lock, expiry)
+				assert.ErrorIs(t, err, idempotency.ErrMismatch)
+			})
+
+			t.Run("locks request in progress", func(t *testing.T) {
+				store := newStore(t)
+				_, err := store.Begin(ctx, "k", "a", "fp", now, lock, expiry)
+				require.NoError(t, err)
+
+				_, err = store.Begin(ctx, "k", "b", "fp", now.Add(time.Second), lock, expiry)
+				assert.ErrorIs(t, err, idempotency.ErrInProgress)
+
+				// Once the lock runs out, a retry takes the key over, and the
+				// request it was taken from can neither complete nor release it
+				resp, err := store.Begin(ctx, "k", "b", "fp", lock, lock.Add(time.Minute), expiry)
+				require.NoError(t, err)
+				assert.Nil(t, resp)
+				assert.ErrorIs(t, store.Release(ctx, "k", "a"), idempotency.ErrNotHeld)
+				assert.ErrorIs(t, store.Complete(ctx, "k", "a", completed), idempotency.ErrNotHeld)
+
+				retried := &idempotency.Response{Status: http.StatusCreated, Header: http.Header{}, Body: []byte(`{}`)}
+				require.NoError(t, store.Complete(ctx, "k", "b", retried))
+				resp, err = store.Begin(ctx, "k", "c", "fp", lock.Add(time.Second), lock.Add(time.Minute), expiry)
+				require.NoError(t, err)
+				assert.Equal(t, retried, resp)
+			})
+
+			t.Run("released key is claimed again", func(t *testing.T) {
+				store := newStore(t)
+				_, err := store.Begin(ctx, "k", "a", "fp", now, lock, expiry)
+				require.NoError(t, err)
+				require.NoError(t, store.Release(ctx, "k", "a"))
+
+				resp, err := store.Begin(ctx, "k", "a", "fp", now, lock, expiry)
+				require.NoError(t, err)
+				assert.Nil(t, resp)
+			})
+
+			t.Run("completed key is not released", func(t *testing.T) {
+				store := newStore(t)
+				_, err := store.Begin(ctx, "k", "a", "fp", now, lock, expiry)
+				require.NoError(t, err)
+				require.NoError(t, store.Complete(ctx, "k", "a", completed))
+				assert.ErrorIs(t, store.Release(ctx, "k", "a"), idempotency.ErrNotHeld)
+				assert.ErrorIs(t, store.Complete(ctx, "k", "a", completed), idempotency.ErrNotHeld)
+
+				resp, err := store.Begin(ctx, "k", "a", "fp", now, lock, expiry)
+				require.NoError(t, err)
+				assert.Equal(t, completed, resp)
+			})
+
+			t.Run("expired keys are new and deleted", func(t *testing.T) {
+				store := newStore(t)
+				_, err := store.Begin(ctx, "old", "a", "fp", now, lock, expiry)
+				require.NoError(t, err)
+				require.NoError(t, store.Complete(ctx, "old", "a", completed))
+				_, err = store.Begin(ctx, "new", "a", "fp", now, lock, expiry.Add(time.Hour))
+				require.NoError(t, err)
+
+				resp, err := store.Begin(ctx, "old", "a", "other", expiry, expiry.Add(time.Minute), expiry.Add(time.Hour))
+				require.NoError(t, err)
+				assert.Nil(t, resp)
+
+				deleted, err := store.DeleteExpired(ctx, expiry.Add(time.Hour))
+				require.NoError(t, err)
+				assert.EqualValues(t, 2, deleted)
+				deleted, err = store.DeleteExpired(ctx, expiry.Add(time.Hour))
+				require.NoError(t, err)
+				assert.Zero(t, deleted)
+			})
+		})
+	}
+}
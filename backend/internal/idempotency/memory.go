@@ -0,0 +1,88 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps keys in process memory, for tests and servers running
+// without PostgreSQL. Keys are not shared between server instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	owner       string
+	fingerprint string
+	lockedUntil time.Time
+	expiresAt   time.Time
+	response    *Response // Nil while the request is in progress
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*entry)}
+}
+
+// Begin claims key for a request, see Store
+func (s *MemoryStore) Begin(ctx context.Context, key, owner, fingerprint string, now, lockedUntil, expiresAt time.Time) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	switch {
+	case !ok || !now.Before(e.expiresAt):
+	case e.fingerprint != fingerprint:
+		return nil, ErrMismatch
+	case e.response != nil:
+		return e.response, nil
+	case now.Before(e.lockedUntil):
+		return nil, ErrInProgress
+	}
+
+	s.entries[key] = &entry{owner: owner, fingerprint: fingerprint, lockedUntil: lockedUntil, expiresAt: expiresAt}
+	return nil, nil
+}
+
+// Complete stores the response to the request holding key, see Store
+func (s *MemoryStore) Complete(ctx context.Context, key, owner string, resp *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.owner != owner || e.response != nil {
+		return ErrNotHeld
+	}
+	e.response = resp
+	return nil
+}
+
+// Release drops owner's claim on key, see Store
+func (s *MemoryStore) Release(ctx context.Context, key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.owner != owner || e.response != nil {
+		return ErrNotHeld
+	}
+	delete(s.entries, key)
+	return nil
+}
+
+// DeleteExpired deletes the keys that expired by now
+func (s *MemoryStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
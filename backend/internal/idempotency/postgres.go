@@ -0,0 +1,133 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// PostgresStore keeps keys in the idempotency_keys table, so retries are
+// recognized by every server instance
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store on db, which must be migrated to the
+// latest schema
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Begin claims key for a request, see Store. Claiming is a single upsert,
+// so of two concurrent requests with a new key exactly one gets it.
+func (s *PostgresStore) Begin(ctx context.Context, key, owner, fingerprint string, now, lockedUntil, expiresAt time.Time) (*Response, error) {
+	// A key deleted between the two statements is claimed on another try
+	for range 2 {
+		var claimed bool
+		err := s.db.QueryRowContext(ctx, `
+			INSERT INTO idempotency_keys (key, owner, fingerprint, locked_until, expires_at, created_at)
+			VALUES ($1, $6, $2, $4, $5, $3)
+			ON CONFLICT (key) DO UPDATE SET
+				owner = EXCLUDED.owner,
+				fingerprint = EXCLUDED.fingerprint,
+				status = NULL, header = NULL, body = NULL,
+				locked_until = EXCLUDED.locked_until,
+				expires_at = EXCLUDED.expires_at,
+				created_at = EXCLUDED.created_at
+			WHERE idempotency_keys.expires_at <= $3
+				OR (idempotency_keys.status IS NULL
+					AND idempotency_keys.locked_until <= $3
+					AND idempotency_keys.fingerprint = EXCLUDED.fingerprint)
+			RETURNING true`,
+			key, fingerprint, now, lockedUntil, expiresAt, owner,
+		).Scan(&claimed)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		var (
+			stored string
+			status sql.NullInt64
+			header []byte
+			body   []byte
+		)
+		err = s.db.QueryRowContext(ctx, `
+			SELECT fingerprint, status, header, body FROM idempotency_keys WHERE key = $1`, key,
+		).Scan(&stored, &status, &header, &body)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case stored != fingerprint:
+			return nil, ErrMismatch
+		case !status.Valid:
+			return nil, ErrInProgress
+		}
+		resp := &Response{Status: int(status.Int64), Body: body}
+		if err := json.Unmarshal(header, &resp.Header); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	return nil, ErrInProgress
+}
+
+// Complete stores the response to the request holding key, see Store
+func (s *PostgresStore) Complete(ctx context.Context, key, owner string, resp *Response) error {
+	header := resp.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status = $3, header = $4, body = $5
+		WHERE key = $1 AND owner = $2 AND status IS NULL`,
+		key, owner, resp.Status, encoded, resp.Body)
+	return held(result, err)
+}
+
+// Release drops owner's claim on key, see Store
+func (s *PostgresStore) Release(ctx context.Context, key, owner string) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE key = $1 AND owner = $2 AND status IS NULL`,
+		key, owner)
+	return held(result, err)
+}
+
+// held returns ErrNotHeld if the statement of result, conditioned on the
+// claim, changed no row
+func held(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// DeleteExpired deletes the keys that expired by now
+func (s *PostgresStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromContext_Default(t *testing.T) {
+	assert.Equal(t, slog.Default(), FromContext(context.Background()))
+}
+
+func TestWith_CarriesFields(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := WithContext(context.Background(), New(&buf, slog.LevelInfo))
+	ctx = With(ctx, "request_id", "abc")
+	ctx = With(ctx, "user_id", int64(7))
+
+	FromContext(ctx).Info("hello")
+	FromContext(ctx).Debug("dropped")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "hello", record["msg"])
+	assert.Equal(t, "abc", record["request_id"])
+	assert.Equal(t, float64(7), record["user_id"])
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, ParseLevel("debug"))
+	assert.Equal(t, slog.LevelWarn, ParseLevel("WARN"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel(""))
+	assert.Equal(t, slog.LevelInfo, ParseLevel("loud"))
+}
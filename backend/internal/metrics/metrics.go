@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vws"
+
+// HTTP metrics
+var (
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	})
+)
+
+// Domain metrics
+var (
+	FaceDetections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "face",
+		Name:      "detections_total",
+		Help:      "Face detection runs by outcome: detected, none or error.",
+	}, []string{"result"})
+
+	FaceVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "face",
+		Name:      "verifications_total",
+		Help:      "Face verifications by outcome: match, mismatch or error.",
+	}, []string{"result"})
+
+	FaceChallenges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "face",
+		Name:      "liveness_challenges_total",
+		Help:      "Liveness challenges by outcome: live, spoof or error.",
+	}, []string{"result"})
+
+	FaceDuplicates = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "face",
+		Name:      "duplicates_flagged_total",
+		Help:      "Enrolled faces flagged as duplicating another user's, per pair of users.",
+	})
+
+	FaceIndexed = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "face",
+		Name:      "index_faces",
+		Help:      "Enrolled faces in the index enrollments are compared with.",
+	})
+
+	CertificatesIssued = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "verification",
+		Name:      "certificates_issued_total",
+		Help:      "Participation certificates issued.",
+	})
+
+	TokenOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "token",
+		Name:      "operations_total",
+		Help:      "Completed token operations by type: convert, stake, unstake or transfer.",
+	}, []string{"operation"})
+
+	TokenAmount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "token",
+		Name:      "amount_total",
+		Help:      "Tokens moved by completed token operations, by type.",
+	}, []string{"operation"})
+
+	VoteResponses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "enterprise",
+		Name:      "vote_responses_total",
+		Help:      "Vote responses submitted.",
+	})
+
+	EthRPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "eth",
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of Ethereum JSON-RPC calls by method.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method"})
+
+	EthRPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "eth",
+		Name:      "rpc_errors_total",
+		Help:      "Failed Ethereum JSON-RPC calls by method.",
+	}, []string{"method"})
+)
+
+// Token operation labels
+const (
+	OperationConvert  = "convert"
+	OperationStake    = "stake"
+	OperationUnstake  = "unstake"
+	OperationTransfer = "transfer"
+	OperationAdjust   = "adjust"
+)
+
+// Face detection, verification and liveness result labels
+const (
+	FaceDetected = "detected"
+	FaceNone     = "none"
+	FaceMatch    = "match"
+	FaceMismatch = "mismatch"
+	FaceLive     = "live"
+	FaceSpoof    = "spoof"
+	FaceError    = "error"
+)
+
+// RegisterDBStats exposes the connection pool statistics of db
+func RegisterDBStats(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveTokenOperation records a completed token operation
+func ObserveTokenOperation(operation string, amount float64) {
+	TokenOperations.WithLabelValues(operation).Inc()
+	TokenAmount.WithLabelValues(operation).Add(amount)
+}
@@ -0,0 +1,137 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/middleware"
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/store/memory"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	service := enterprise.NewService(memory.New().Enterprise())
+	org, err := service.CreateOrganization(ctx, "Org", "", "org@example.com", "example.com", 7)
+	require.NoError(t, err)
+
+	key, err := service.CreateAPIKey(ctx, org.ID, "live", []string{enterprise.ScopeRead}, 0, time.Time{}, 7)
+	require.NoError(t, err)
+	expired, err := service.CreateAPIKey(ctx, org.ID, "expired", []string{enterprise.ScopeRead}, 0, time.Now().Add(-time.Minute), 7)
+	require.NoError(t, err)
+	revoked, err := service.CreateAPIKey(ctx, org.ID, "revoked", []string{enterprise.ScopeRead}, 0, time.Time{}, 7)
+	require.NoError(t, err)
+	require.NoError(t, service.RevokeAPIKey(ctx, org.ID, revoked.ID))
+
+	// Requests without a key are left to the user token middleware
+	var fellBack bool
+	router := gin.New()
+	router.Use(middleware.Errors(), middleware.APIKeyAuth(service, func(c *gin.Context) {
+		fellBack = true
+		c.Set(middleware.UserIDKey, int64(1))
+	}))
+	router.GET("/me", func(c *gin.Context) {
+		_, withKey := middleware.GetAPIKey(c)
+		c.String(http.StatusOK, "%d %t", c.GetInt64(middleware.UserIDKey), withKey)
+	})
+
+	for name, tc := range map[string]struct {
+		key      string
+		want     int
+		body     string
+		fallback bool
+	}{
+		"missing":   {"", http.StatusOK, "1 false", true},
+		"valid":     {key.Key, http.StatusOK, "7 true", false},
+		"bad":       {"vws_not-a-key", http.StatusUnauthorized, "invalid_api_key", false},
+		"no prefix": {"not-a-key", http.StatusUnauthorized, "invalid_api_key", false},
+		"expired":   {expired.Key, http.StatusUnauthorized, "api_key_expired", false},
+		"revoked":   {revoked.Key, http.StatusUnauthorized, "invalid_api_key", false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fellBack = false
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tc.key != "" {
+				req.Header.Set(middleware.APIKeyHeader, tc.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tc.body)
+			assert.Equal(t, tc.fallback, fellBack)
+		})
+	}
+
+	used, err := service.ListAPIKeys(ctx, org.ID)
+	require.NoError(t, err)
+	for _, k := range used {
+		assert.Equal(t, k.ID == key.ID, !k.LastUsedAt.IsZero(), "only the valid key is marked used, key %d", k.ID)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for name, tc := range map[string]struct {
+		scopes   []string // Of the key, nil for a user token
+		required string
+		want     int
+	}{
+		"user token":            {nil, enterprise.ScopeAdmin, http.StatusOK},
+		"same scope":            {[]string{enterprise.ScopeWrite}, enterprise.ScopeWrite, http.StatusOK},
+		"higher scope":          {[]string{enterprise.ScopeAdmin}, enterprise.ScopeRead, http.StatusOK},
+		"lower scope":           {[]string{enterprise.ScopeRead}, enterprise.ScopeWrite, http.StatusForbidden},
+		"any of several scopes": {[]string{enterprise.ScopeRead, enterprise.ScopeAdmin}, enterprise.ScopeWrite, http.StatusOK},
+		"no scopes":             {[]string{}, enterprise.ScopeRead, http.StatusForbidden},
+		"unknown scope":         {[]string{"ROOT"}, enterprise.ScopeRead, http.StatusForbidden},
+	} {
+		t.Run(name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(middleware.Errors(), func(c *gin.Context) {
+				if tc.scopes != nil {
+					c.Set(middleware.APIKeyKey, &enterprise.APIKey{Scopes: tc.scopes})
+				}
+			})
+			router.GET("/", middleware.RequireScope(tc.required), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tc.want, rec.Code)
+			if tc.want == http.StatusForbidden {
+				assert.Contains(t, rec.Body.String(), "missing_scope")
+			}
+		})
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for withKey, want := range map[bool]int{false: http.StatusOK, true: http.StatusForbidden} {
+		router := gin.New()
+		router.Use(middleware.Errors(), func(c *gin.Context) {
+			if withKey {
+				c.Set(middleware.APIKeyKey, &enterprise.APIKey{Scopes: []string{enterprise.ScopeAdmin}})
+			}
+		})
+		router.POST("/", middleware.RequireUser(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, want, rec.Code, "with key "+strconv.FormatBool(withKey))
+	}
+}
@@ -1,6 +1,84 @@
 package middleware
 
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/auth"
+)
+
 // Key for storing user ID in context
 const UserIDKey = "user_id"
 
-// ... existing code ...
+// Key for storing the session ID of the access token in context
+const SessionIDKey = "session_id"
+
+// SessionValidator reports whether a login session is still usable
+type SessionValidator interface {
+	IsSessionActive(ctx context.Context, sessionID int64) (bool, error)
+}
+
+// Auth middleware validates the bearer token, rejects tokens of revoked
+// sessions and stores the user and session IDs in the context
+func Auth(tokens *auth.TokenManager, sessions SessionValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			Abort(c, apperr.New(apperr.ErrUnauthorized, "missing_token", "No authorization token provided"))
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			Abort(c, apperr.New(apperr.ErrUnauthorized, "invalid_authorization", "Invalid authorization header"))
+			return
+		}
+
+		claims, err := tokens.ParseAccessToken(token)
+		if err != nil {
+			Abort(c, apperr.New(apperr.ErrUnauthorized, "invalid_token", "Invalid token"))
+			return
+		}
+
+		active, err := sessions.IsSessionActive(c.Request.Context(), claims.SessionID)
+		if err != nil {
+			Abort(c, fmt.Errorf("validate session: %w", err))
+			return
+		}
+		if !active {
+			Abort(c, apperr.New(apperr.ErrUnauthorized, "session_revoked", "Session has been revoked"))
+			return
+		}
+
+		userID, _ := claims.UserID()
+		c.Set(UserIDKey, userID)
+		c.Set(SessionIDKey, claims.SessionID)
+		AddLogFields(c, "user_id", userID)
+		c.Next()
+	}
+}
+
+// RoleResolver returns the platform role of a user
+type RoleResolver interface {
+	GetRole(ctx context.Context, userID int64) (string, error)
+}
+
+// RequireRole rejects requests of users without role. It runs after Auth.
+func RequireRole(roles RoleResolver, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got, err := roles.GetRole(c.Request.Context(), c.GetInt64(UserIDKey))
+		if err != nil {
+			Abort(c, fmt.Errorf("resolve role: %w", err))
+			return
+		}
+		if got != role {
+			Abort(c, apperr.Forbidden("Requires the "+role+" role"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,268 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default CORS settings used when CORSConfig leaves them empty
+var (
+	DefaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	DefaultCORSHeaders = []string{"Authorization", "Content-Type", "Accept", "Origin", "Cache-Control", "X-Requested-With", APIKeyHeader, IdempotencyKeyHeader}
+)
+
+// DomainLister lists domains that aren't known up front, such as the white
+// label domains of organizations. Origins served from them over HTTPS are
+// allowed; the same domain over plain HTTP could be anyone on the network.
+type DomainLister interface {
+	WhiteLabelDomains(ctx context.Context) ([]string, error)
+}
+
+// CORSRule overrides the allowed methods and headers for requests to
+// PathPrefix or a path below it. The longest matching prefix wins.
+type CORSRule struct {
+	PathPrefix string
+	Methods    []string
+	Headers    []string
+}
+
+// CORSConfig configures the CORS middleware. AllowedOrigins holds exact
+// origins such as "https://app.example.com", wildcard subdomain patterns
+// such as "https://*.example.com", or "*" to allow every origin. "*" must
+// not be combined with AllowCredentials, which would let every site make
+// requests with the user's cookies.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+	Rules            []CORSRule
+	Domains          DomainLister
+}
+
+type corsPolicy struct {
+	config    CORSConfig
+	exact     map[string]bool
+	wildcards []wildcardOrigin
+	anyOrigin bool
+}
+
+type wildcardOrigin struct {
+	prefix string // Scheme, e.g. "https://"
+	suffix string // Parent domain and port, e.g. ".example.com"
+}
+
+// CORS middleware answers preflight requests and sets CORS headers for
+// allowed origins. Disallowed origins get no CORS headers, so browsers
+// block the response.
+func CORS(config CORSConfig) gin.HandlerFunc {
+	return NewCORSHandler(config).Handle
+}
+
+// CORSHandler is the CORS middleware with a configuration that can be
+// replaced while the server runs. The domains of CORSConfig.Domains are
+// loaded up front and reloaded periodically rather than looked up per
+// request, as any client can send any Origin.
+type CORSHandler struct {
+	policy  atomic.Pointer[corsPolicy]
+	domains atomic.Pointer[map[string]bool]
+}
+
+// NewCORSHandler creates a CORS middleware for config
+func NewCORSHandler(config CORSConfig) *CORSHandler {
+	h := &CORSHandler{}
+	h.Update(config)
+	return h
+}
+
+// Update replaces the configuration for requests arriving from now on
+func (h *CORSHandler) Update(config CORSConfig) {
+	h.policy.Store(newCORSPolicy(config))
+}
+
+// LoadDomains replaces the allowed domains with those CORSConfig.Domains
+// lists now. On failure, the domains loaded last are kept.
+func (h *CORSHandler) LoadDomains(ctx context.Context) error {
+	lister := h.policy.Load().config.Domains
+	if lister == nil {
+		h.domains.Store(nil)
+		return nil
+	}
+	list, err := lister.WhiteLabelDomains(ctx)
+	if err != nil {
+		return err
+	}
+	domains := make(map[string]bool, len(list))
+	for _, domain := range list {
+		domains[strings.ToLower(domain)] = true
+	}
+	h.domains.Store(&domains)
+	return nil
+}
+
+// WatchDomains reloads the allowed domains every interval, logging
+// failures. WatchDomains returns once ctx is done.
+func (h *CORSHandler) WatchDomains(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.LoadDomains(ctx); err != nil {
+				slog.Error("cors domains not reloaded, keeping the domains loaded last", "error", err)
+			}
+		}
+	}
+}
+
+// Handle is the gin middleware
+func (h *CORSHandler) Handle(c *gin.Context) {
+	var domains map[string]bool
+	if loaded := h.domains.Load(); loaded != nil {
+		domains = *loaded
+	}
+	h.policy.Load().handle(c, domains)
+}
+
+func newCORSPolicy(config CORSConfig) *corsPolicy {
+	if len(config.AllowedMethods) == 0 {
+		config.AllowedMethods = DefaultCORSMethods
+	}
+	if len(config.AllowedHeaders) == 0 {
+		config.AllowedHeaders = DefaultCORSHeaders
+	}
+
+	p := &corsPolicy{
+		config: config,
+		exact:  make(map[string]bool),
+	}
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			idx := strings.Index(origin, "*.")
+			p.wildcards = append(p.wildcards, wildcardOrigin{prefix: origin[:idx], suffix: origin[idx+1:]})
+		default:
+			p.exact[origin] = true
+		}
+	}
+	return p
+}
+
+func (p *corsPolicy) handle(c *gin.Context, domains map[string]bool) {
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		c.Next()
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Add("Vary", "Origin")
+
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+	if !p.allowed(origin, domains) {
+		if preflight {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+	if p.config.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if len(p.config.ExposedHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(p.config.ExposedHeaders, ", "))
+		}
+		c.Next()
+		return
+	}
+
+	methods, headers := p.config.AllowedMethods, p.config.AllowedHeaders
+	if rule, ok := p.rule(c.Request.URL.Path); ok {
+		if len(rule.Methods) > 0 {
+			methods = rule.Methods
+		}
+		if len(rule.Headers) > 0 {
+			headers = rule.Headers
+		}
+	}
+
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	if p.config.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(p.config.MaxAge.Seconds())))
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+func (p *corsPolicy) allowed(origin string, domains map[string]bool) bool {
+	normalized := strings.ToLower(origin)
+	if p.anyOrigin || p.exact[normalized] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if w.matches(normalized) {
+			return true
+		}
+	}
+	if p.config.Domains == nil || len(domains) == 0 {
+		return false
+	}
+
+	u, err := url.Parse(normalized)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Path != "" || u.RawQuery != "" {
+		return false
+	}
+	return domains[u.Hostname()]
+}
+
+func (p *corsPolicy) rule(path string) (CORSRule, bool) {
+	var best CORSRule
+	found := false
+	for _, rule := range p.config.Rules {
+		if underPrefix(path, rule.PathPrefix) && (!found || len(rule.PathPrefix) > len(best.PathPrefix)) {
+			best = rule
+			found = true
+		}
+	}
+	return best, found
+}
+
+// underPrefix reports whether path is prefix or below it, so that
+// "/api/enterprise" covers "/api/enterprise/organizations" but not
+// "/api/enterprise-beta"
+func underPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// matches reports whether origin is a subdomain of the pattern's domain,
+// e.g. "https://a.example.com" for "https://*.example.com"
+func (w wildcardOrigin) matches(origin string) bool {
+	if !strings.HasPrefix(origin, w.prefix) || !strings.HasSuffix(origin, w.suffix) {
+		return false
+	}
+	sub := origin[len(w.prefix) : len(origin)-len(w.suffix)]
+	return sub != "" && !strings.ContainsAny(sub, "/:@")
+}
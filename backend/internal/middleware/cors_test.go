@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// whiteLabel lists its domains, counting the lookups
+type whiteLabel struct {
+	mu      sync.Mutex
+	domains []string
+	err     error
+	lookups atomic.Int64
+}
+
+func (w *whiteLabel) WhiteLabelDomains(ctx context.Context) ([]string, error) {
+	w.lookups.Add(1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.domains, w.err
+}
+
+func (w *whiteLabel) set(domains []string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.domains, w.err = domains, err
+}
+
+func corsRouter(h *CORSHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(h.Handle)
+	router.Any("/*path", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return router
+}
+
+func corsRequest(router *gin.Engine, method, path, origin string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORS_Origins(t *testing.T) {
+	h := NewCORSHandler(CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org/"},
+		AllowCredentials: true,
+		ExposedHeaders:   []string{"RateLimit-Limit"},
+		Domains:          &whiteLabel{domains: []string{"vote.customer.com"}},
+	})
+	require.NoError(t, h.LoadDomains(context.Background()))
+	router := corsRouter(h)
+
+	for origin, allowed := range map[string]bool{
+		"https://app.example.com":        true,
+		"https://APP.example.com":        true, // Hosts are case insensitive
+		"http://app.example.com":         false,
+		"https://app.example.com:8443":   false,
+		"https://evil.com":               false,
+		"https://a.example.org":          true,
+		"https://a.b.example.org":        true,
+		"https://example.org":            false, // The parent domain itself
+		"http://a.example.org":           false,
+		"https://evil.com/.example.org":  false,
+		"https://user@a.example.org":     false,
+		"https://a.example.org.evil.com": false,
+		"https://vote.customer.com":      true,
+		"https://Vote.Customer.com:8443": true,
+		"https://other.customer.com":     false,
+		"http://vote.customer.com":       false, // Anyone on the network
+		"wss://vote.customer.com":        false,
+		"https://user@vote.customer.com": false,
+		"https://vote.customer.com/path": false,
+		"not an origin":                  false,
+	} {
+		rec := corsRequest(router, http.MethodGet, "/", origin, nil)
+		assert.Equal(t, http.StatusOK, rec.Code, origin)
+		assert.Contains(t, rec.Header().Values("Vary"), "Origin", origin)
+		if !allowed {
+			assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), origin)
+			continue
+		}
+		assert.Equal(t, origin, rec.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"), origin)
+		assert.Equal(t, "RateLimit-Limit", rec.Header().Get("Access-Control-Expose-Headers"), origin)
+	}
+
+	rec := corsRequest(router, http.MethodGet, "/", "", nil)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), "no CORS headers without an Origin")
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	router := corsRouter(NewCORSHandler(CORSConfig{AllowedOrigins: []string{"*"}}))
+
+	rec := corsRequest(router, http.MethodGet, "/", "https://anywhere.example", nil)
+	assert.Equal(t, "https://anywhere.example", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	router := corsRouter(NewCORSHandler(CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		MaxAge:         10 * time.Minute,
+		Rules: []CORSRule{
+			{PathPrefix: "/api", Methods: []string{"GET", "POST"}},
+			{PathPrefix: "/api/enterprise", Methods: []string{"GET"}, Headers: []string{"X-API-Key"}},
+		},
+	}))
+	preflight := http.Header{"Access-Control-Request-Method": {"POST"}}
+
+	for path, want := range map[string]struct{ methods, headers string }{
+		"/health":              {"GET, POST, PUT, DELETE, OPTIONS", "Authorization"},
+		"/api/votes":           {"GET, POST", "Authorization"},
+		"/api/enterprise/orgs": {"GET", "X-API-Key"},           // The longest prefix wins
+		"/api/enterprise-beta": {"GET, POST", "Authorization"}, // Prefixes end at a segment
+		"/api":                 {"GET, POST", "Authorization"},
+	} {
+		rec := corsRequest(router, http.MethodOptions, path, "https://app.example.com", preflight)
+		assert.Equal(t, http.StatusNoContent, rec.Code, path)
+		assert.Equal(t, want.methods, rec.Header().Get("Access-Control-Allow-Methods"), path)
+		assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), want.headers, path)
+		assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"), path)
+		assert.Subset(t, rec.Header().Values("Vary"), []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, path)
+		assert.Empty(t, rec.Body.String(), "preflights are answered without the handler")
+	}
+
+	rec := corsRequest(router, http.MethodOptions, "/api/votes", "https://evil.com", preflight)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "preflights of origins not allowed are refused")
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Methods"))
+
+	rec = corsRequest(router, http.MethodOptions, "/api/votes", "https://app.example.com", nil)
+	assert.Equal(t, http.StatusOK, rec.Code, "OPTIONS without a requested method is no preflight")
+	assert.Empty(t, rec.Header().Get("Access-Control-Max-Age"))
+
+	noMaxAge := corsRouter(NewCORSHandler(CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}))
+	rec = corsRequest(noMaxAge, http.MethodOptions, "/", "https://app.example.com", preflight)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORS_WhiteLabelDomains(t *testing.T) {
+	ctx := context.Background()
+	domains := &whiteLabel{domains: []string{"vote.customer.com"}}
+	h := NewCORSHandler(CORSConfig{Domains: domains})
+	router := corsRouter(h)
+	allowed := func(origin string) bool {
+		rec := corsRequest(router, http.MethodGet, "/", origin, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		return rec.Header().Get("Access-Control-Allow-Origin") == origin
+	}
+
+	assert.False(t, allowed("https://vote.customer.com"), "not loaded yet")
+	require.NoError(t, h.LoadDomains(ctx))
+	assert.True(t, allowed("https://vote.customer.com"))
+
+	// Every client can send any origin, without costing a lookup
+	for i := range 100 {
+		assert.False(t, allowed("https://"+strconv.Itoa(i)+".evil.com"))
+	}
+	assert.Equal(t, int64(1), domains.lookups.Load())
+
+	// Updating the configuration keeps the domains
+	h.Update(CORSConfig{Domains: domains})
+	assert.True(t, allowed("https://vote.customer.com"))
+
+	// Failed reloads keep the domains loaded last
+	domains.set(nil, errors.New("database down"))
+	require.Error(t, h.LoadDomains(ctx))
+	assert.True(t, allowed("https://vote.customer.com"))
+
+	// Domains are reloaded periodically
+	domains.set([]string{"Vote.Other.com"}, nil)
+	watchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go h.WatchDomains(watchCtx, time.Millisecond)
+	assert.Eventually(t, func() bool { return allowed("https://vote.other.com") }, time.Second, time.Millisecond)
+	assert.False(t, allowed("https://vote.customer.com"))
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/openapi"
+)
+
+// Statuses errors of each kind are answered with
+var statuses = []struct {
+	kind   error
+	status int
+}{
+	{apperr.ErrInvalid, http.StatusBadRequest},
+	{apperr.ErrUnauthorized, http.StatusUnauthorized},
+	{apperr.ErrForbidden, http.StatusForbidden},
+	{apperr.ErrNotFound, http.StatusNotFound},
+	{apperr.ErrConflict, http.StatusConflict},
+	{apperr.ErrTooLarge, http.StatusRequestEntityTooLarge},
+	{apperr.ErrUnsupported, http.StatusUnsupportedMediaType},
+	{apperr.ErrUnprocessable, http.StatusUnprocessableEntity},
+	{apperr.ErrRateLimited, http.StatusTooManyRequests},
+	{apperr.ErrNotImplemented, http.StatusNotImplemented},
+}
+
+// Errors middleware answers requests whose handler recorded an error with
+// c.Error and wrote nothing else. Errors from package apperr are answered
+// with the status of their kind; anything else is an internal error,
+// answered with 500 and a generic message while Logger logs the cause.
+//
+// It must be added to the router after middleware that inspects response
+// bodies, such as the API validator.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		writePendingError(c)
+	}
+}
+
+// writePendingError answers with the last error recorded, unless a
+// response has been written already
+func writePendingError(c *gin.Context) {
+	if err := c.Errors.Last(); err != nil && !c.Writer.Written() {
+		writeError(c, err.Err)
+	}
+}
+
+// Abort stops the handler chain and answers the request with err. It is
+// for middleware, which may run before Errors does.
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+	writeError(c, err)
+}
+
+func writeError(c *gin.Context, err error) {
+	body := openapi.Error{
+		Error:     "internal server error",
+		Code:      "internal",
+		RequestID: c.GetString(RequestIDKey),
+	}
+	status := http.StatusInternalServerError
+
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		for _, s := range statuses {
+			if errors.Is(appErr, s.kind) {
+				status = s.status
+				body.Error = appErr.Message
+				body.Code = appErr.Code
+				body.Details = appErr.Details
+				break
+			}
+		}
+	}
+	c.JSON(status, body)
+}
@@ -0,0 +1,69 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/logging"
+	"vws-backend/internal/middleware"
+	"vws-backend/internal/openapi"
+)
+
+func TestErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	router := gin.New()
+	router.Use(middleware.Logger(logging.New(&logs, slog.LevelInfo)), middleware.Errors())
+	router.GET("/conflict", func(c *gin.Context) {
+		c.Error(apperr.New(apperr.ErrConflict, "vote_already_submitted", "vote already submitted"))
+	})
+	router.GET("/internal", func(c *gin.Context) {
+		c.Error(errors.New(`pq: relation "votes" does not exist`))
+	})
+	router.GET("/written", func(c *gin.Context) {
+		c.Error(errors.New("logged only"))
+		c.String(http.StatusAccepted, "queued")
+	})
+	router.GET("/aborted", func(c *gin.Context) {
+		middleware.Abort(c, apperr.Unauthorized("Invalid token"))
+	}, func(c *gin.Context) {
+		t.Error("handlers after Abort ran")
+	})
+
+	for path, want := range map[string]struct {
+		status int
+		body   openapi.Error
+	}{
+		"/conflict": {http.StatusConflict, openapi.Error{Error: "vote already submitted", Code: "vote_already_submitted"}},
+		"/internal": {http.StatusInternalServerError, openapi.Error{Error: "internal server error", Code: "internal"}},
+		"/aborted":  {http.StatusUnauthorized, openapi.Error{Error: "Invalid token", Code: "unauthorized"}},
+	} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, want.status, rec.Code)
+
+			var body openapi.Error
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, rec.Header().Get(middleware.RequestIDHeader), body.RequestID)
+			body.RequestID = ""
+			assert.Equal(t, want.body, body)
+		})
+	}
+	assert.Contains(t, logs.String(), `pq: relation \"votes\" does not exist`, "internal errors are logged")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/written", nil))
+	assert.Equal(t, http.StatusAccepted, rec.Code, "responses handlers wrote are kept")
+	assert.Equal(t, "queued", rec.Body.String())
+}
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/idempotency"
+	"vws-backend/internal/logging"
+)
+
+// IdempotencyKeyHeader is the request header clients send a key in, so a
+// retried request is answered like the first one instead of repeated
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader marks responses replayed from an earlier request
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// Longest idempotency key accepted
+const maxIdempotencyKeyLength = 255
+
+// Errors for idempotency keys that can't be honoured
+var (
+	errIdempotencyKeyInUse  = apperr.New(apperr.ErrConflict, "idempotency_key_in_use", "a request with this idempotency key is in progress")
+	errIdempotencyKeyReused = apperr.New(apperr.ErrUnprocessable, "idempotency_key_reused", "idempotency key was used for a different request")
+	errIdempotencyKeyLength = apperr.New(apperr.ErrInvalid, "invalid_idempotency_key", "idempotency key must be at most 255 characters")
+)
+
+// IdempotencyConfig configures the Idempotency middleware
+type IdempotencyConfig struct {
+	Routes      []string      // Method and route template, e.g. "POST /api/tokens/transfer"
+	TTL         time.Duration // How long responses are kept for replay
+	LockTimeout time.Duration // How long a request may hold its key before a retry takes over, longer than any request takes
+}
+
+// Idempotency honours the Idempotency-Key header on the configured routes.
+// The first request with a key is served and its response stored; retries
+// with the same key and body are answered with that response, marked by
+// the Idempotent-Replayed header. Retries while the first request is still
+// being served are rejected with 409, and reusing a key for a different
+// request with 422. Server errors are not stored, so the request can be
+// retried with the same key.
+//
+// Keys belong to the caller, so it must run after authentication.
+// Requests without a key are served as usual.
+func Idempotency(store idempotency.Store, cfg IdempotencyConfig) gin.HandlerFunc {
+	routes := make(map[string]bool, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		routes[route] = true
+	}
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = time.Minute
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !routes[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			Abort(c, errIdempotencyKeyLength)
+			return
+		}
+		identity, ok := resolveKey(c, []KeyFunc{KeyByAPIKey, KeyByUser})
+		if !ok {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			Abort(c, apperr.Invalid("failed to read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		owner := make([]byte, 16)
+		if _, err := rand.Read(owner); err != nil {
+			Abort(c, fmt.Errorf("generate idempotency claim: %w", err))
+			return
+		}
+		claim := hex.EncodeToString(owner)
+
+		ctx := c.Request.Context()
+		key = identity + ":" + key
+		now := time.Now()
+		stored, err := store.Begin(ctx, key, claim, fingerprint(c.Request, body), now, now.Add(cfg.LockTimeout), now.Add(cfg.TTL))
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			Abort(c, errIdempotencyKeyInUse)
+			return
+		case errors.Is(err, idempotency.ErrMismatch):
+			Abort(c, errIdempotencyKeyReused)
+			return
+		case err != nil:
+			Abort(c, fmt.Errorf("claim idempotency key: %w", err))
+			return
+		case stored != nil:
+			replay(c, stored)
+			return
+		}
+
+		// Only headers set from here on belong to the response; the
+		// others, like the request ID, describe this request
+		before := maps.Clone(c.Writer.Header())
+		rec := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		c.Next()
+		writePendingError(c)
+
+		// Finish even if the client has gone, or its retry would wait out the lock
+		ctx = context.WithoutCancel(ctx)
+		if rec.Status() >= http.StatusInternalServerError {
+			err = store.Release(ctx, key, claim)
+		} else {
+			header := rec.Header().Clone()
+			for name := range before {
+				header.Del(name)
+			}
+			err = store.Complete(ctx, key, claim, &idempotency.Response{Status: rec.Status(), Header: header, Body: rec.body.Bytes()})
+		}
+		switch {
+		case errors.Is(err, idempotency.ErrNotHeld):
+			// The lock ran out and a retry took the key over; its
+			// response is the one kept
+			logging.FromContext(ctx).Warn("idempotency key taken over before the response was stored")
+		case err != nil:
+			logging.FromContext(ctx).Error("idempotent response not stored", "error", err)
+		}
+	}
+}
+
+// fingerprint identifies a request by its method, target and body
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay answers with a stored response
+func replay(c *gin.Context, resp *idempotency.Response) {
+	for name, values := range resp.Header {
+		if c.Writer.Header().Get(name) == "" {
+			c.Writer.Header()[name] = values
+		}
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Status(resp.Status)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Write(resp.Body)
+	c.Abort()
+}
+
+// responseRecorder keeps a copy of the body written through it
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
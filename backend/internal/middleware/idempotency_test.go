@@ -0,0 +1,114 @@
+package middleware_test
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"vws-backend/internal/idempotency"
+	"vws-backend/internal/logging"
+	"vws-backend/internal/middleware"
+)
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var transfers, failures atomic.Int64
+	started, release := make(chan struct{}), make(chan struct{})
+
+	router := gin.New()
+	router.Use(middleware.Logger(logging.New(io.Discard, slog.LevelInfo)), middleware.Errors(), func(c *gin.Context) {
+		c.Set(middleware.UserIDKey, int64(1))
+	}, middleware.Idempotency(idempotency.NewMemoryStore(), middleware.IdempotencyConfig{
+		Routes: []string{"POST /transfer", "POST /flaky", "POST /slow"},
+		TTL:    time.Hour,
+	}))
+	router.POST("/transfer", func(c *gin.Context) {
+		n := transfers.Add(1)
+		c.Header("Location", "/transfers/"+strconv.FormatInt(n, 10))
+		c.JSON(http.StatusCreated, gin.H{"transfer": n})
+	})
+	router.POST("/flaky", func(c *gin.Context) {
+		if failures.Add(1) == 1 {
+			c.Error(errors.New("connection reset"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	router.POST("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	send := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("replays response", func(t *testing.T) {
+		first := send("/transfer", "a", `{"amount":5}`)
+		assert.Equal(t, http.StatusCreated, first.Code)
+		assert.Empty(t, first.Header().Get(middleware.IdempotentReplayedHeader))
+
+		retry := send("/transfer", "a", `{"amount":5}`)
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, first.Header().Get("Location"), retry.Header().Get("Location"))
+		assert.Equal(t, "true", retry.Header().Get(middleware.IdempotentReplayedHeader))
+		assert.NotEqual(t, first.Header().Get(middleware.RequestIDHeader), retry.Header().Get(middleware.RequestIDHeader))
+		assert.EqualValues(t, 1, transfers.Load())
+
+		send("/transfer", "", `{"amount":5}`)
+		send("/transfer", "b", `{"amount":5}`)
+		assert.EqualValues(t, 3, transfers.Load(), "requests without the key, or with another, are served")
+	})
+
+	t.Run("rejects key reused with other body", func(t *testing.T) {
+		send("/transfer", "c", `{"amount":5}`)
+		rec := send("/transfer", "c", `{"amount":6}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":"idempotency_key_reused"`)
+	})
+
+	t.Run("rejects overlong key", func(t *testing.T) {
+		rec := send("/transfer", strings.Repeat("k", 256), `{}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":"invalid_idempotency_key"`)
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		assert.Equal(t, http.StatusInternalServerError, send("/flaky", "d", `{}`).Code)
+		rec := send("/flaky", "d", `{}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get(middleware.IdempotentReplayedHeader))
+	})
+
+	t.Run("locks request in progress", func(t *testing.T) {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- send("/slow", "e", `{}`) }()
+		<-started
+
+		rec := send("/slow", "e", `{}`)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":"idempotency_key_in_use"`)
+
+		close(release)
+		assert.Equal(t, http.StatusOK, (<-done).Code)
+		assert.Equal(t, "true", send("/slow", "e", `{}`).Header().Get(middleware.IdempotentReplayedHeader))
+	})
+}
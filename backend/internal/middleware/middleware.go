@@ -1,131 +1,149 @@
 package middleware
 
 import (
-	"net/http"
-	"sync"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/otel/trace"
+
+	"vws-backend/internal/logging"
+	"vws-backend/internal/metrics"
 )
 
-// RateLimiter implements rate limiting
-type RateLimiter struct {
-	ips    map[string]*rate.Limiter
-	mu     *sync.RWMutex
-	rate   rate.Limit
-	burst  int
-}
+// Header carrying the request ID between clients, proxies and the server
+const RequestIDHeader = "X-Request-ID"
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(r rate.Limit, b int) *RateLimiter {
-	return &RateLimiter{
-		ips:   make(map[string]*rate.Limiter),
-		mu:    &sync.RWMutex{},
-		rate:  r,
-		burst: b,
-	}
-}
+// Key for storing the request ID in context
+const RequestIDKey = "request_id"
+
+// Key for storing the organization a request acts on in context
+const OrganizationIDKey = "organization_id"
+
+// Longest client supplied request ID that is propagated
+const maxRequestIDLength = 128
 
-// RateLimit middleware function
-func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
+// Logger middleware assigns every request an ID, stores a request-scoped
+// logger carrying it in the request context and logs each request once it
+// has been handled
+func Logger(logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		limiter := rl.getLimiter(ip)
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded",
-			})
-			c.Abort()
-			return
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		fields := []any{
+			slog.String("request_id", requestID),
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+		}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			fields = append(fields,
+				slog.String("trace_id", span.TraceID().String()),
+				slog.String("span_id", span.SpanID().String()),
+			)
 		}
+		ctx := logging.WithContext(c.Request.Context(), logger.With(fields...))
+		c.Request = c.Request.WithContext(ctx)
+
 		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if userID := c.GetInt64(UserIDKey); userID != 0 {
+			attrs = append(attrs, slog.Int64("user_id", userID))
+		}
+		if key, ok := GetAPIKey(c); ok {
+			attrs = append(attrs, slog.Int64("api_key_id", key.ID))
+		}
+		if orgID := c.GetInt64(OrganizationIDKey); orgID != 0 {
+			attrs = append(attrs, slog.Int64("org_id", orgID))
+		}
+		if len(c.Errors) > 0 {
+			errs := make([][]string, 0, len(c.Errors))
+			for _, e := range c.Errors {
+				errs = append(errs, errorChain(e.Err))
+			}
+			attrs = append(attrs, slog.Any("errors", errs))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		logging.FromContext(ctx).LogAttrs(ctx, level, "request", attrs...)
 	}
 }
 
-// getLimiter returns a rate limiter for the provided IP
-func (rl *RateLimiter) getLimiter(ip string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// AddLogFields adds fields to the request-scoped logger, so everything
+// logged further down the chain carries them
+func AddLogFields(c *gin.Context, args ...any) {
+	c.Request = c.Request.WithContext(logging.With(c.Request.Context(), args...))
+}
 
-	limiter, exists := rl.ips[ip]
-	if !exists {
-		limiter = rate.NewLimiter(rl.rate, rl.burst)
-		rl.ips[ip] = limiter
+// errorChain lists the messages of err and every error it wraps
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil {
+		chain = append(chain, err.Error())
+		err = errors.Unwrap(err)
 	}
-
-	return limiter
+	return chain
 }
 
-// CORS middleware
-func CORS() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
 		}
+	}
+	return true
+}
 
-		c.Next()
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
 	}
+	return hex.EncodeToString(b)
 }
 
-// Logger middleware
-func Logger() gin.HandlerFunc {
+// Metrics middleware records the duration of every request by route template
+func Metrics() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
-		path := c.Request.URL.Path
+		metrics.HTTPRequestsInFlight.Inc()
+		defer metrics.HTTPRequestsInFlight.Dec()
 
 		c.Next()
 
-		end := time.Now()
-		latency := end.Sub(start)
-
-		// Log request details
-		if len(c.Errors) > 0 {
-			// Log errors
-			for _, e := range c.Errors.Errors() {
-				// TODO: Use proper logging
-				println(e)
-			}
-		} else {
-			// Log success
-			println(c.Request.Method, path, c.Writer.Status(), latency)
-		}
-	}
-}
-
-// Auth middleware
-func Auth() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token := c.GetHeader("Authorization")
-		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "No authorization token provided",
-			})
-			c.Abort()
-			return
+		route := c.FullPath()
+		if route == "" {
+			// Keep unmatched paths from creating a series each
+			route = "unmatched"
 		}
-
-		// TODO: Implement proper JWT validation
-		if !validateToken(token) {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token",
-			})
-			c.Abort()
-			return
-		}
-
-		c.Next()
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
 	}
 }
-
-// validateToken validates the JWT token
-func validateToken(token string) bool {
-	// TODO: Implement proper JWT validation
-	return true
-} 
\ No newline at end of file
@@ -0,0 +1,169 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/logging"
+	"vws-backend/internal/middleware"
+	"vws-backend/internal/service/enterprise"
+)
+
+// records decodes the JSON log records in logs
+func records(t *testing.T, logs *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var result []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		result = append(result, record)
+	}
+	return result
+}
+
+func TestLogger_RequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	for name, tc := range map[string]struct {
+		header string
+		kept   bool
+	}{
+		"missing":      {"", false},
+		"valid":        {"req-42.abc_DEF", true},
+		"longest":      {strings.Repeat("a", 128), true},
+		"too long":     {strings.Repeat("a", 129), false},
+		"space":        {"req 42", false},
+		"control":      {"req\x0142", false},
+		"non-ASCII":    {"réq-42", false},
+		"log injected": {`x","level":"ERROR`, true}, // Printable, and escaped by the JSON handler
+	} {
+		t.Run(name, func(t *testing.T) {
+			var logs bytes.Buffer
+			var seen string
+			router := gin.New()
+			router.Use(middleware.Logger(logging.New(&logs, slog.LevelInfo)))
+			router.GET("/", func(c *gin.Context) {
+				seen = c.GetString(middleware.RequestIDKey)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set(middleware.RequestIDHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(middleware.RequestIDHeader)
+			if tc.kept {
+				assert.Equal(t, tc.header, id)
+			} else {
+				assert.Regexp(t, generated, id, "replaced by a generated ID")
+			}
+			assert.Equal(t, id, seen, "the handler sees the echoed ID")
+			logged := records(t, &logs)
+			require.Len(t, logged, 1)
+			assert.Equal(t, id, logged[0]["request_id"])
+			assert.Equal(t, "INFO", logged[0]["level"])
+		})
+	}
+
+	// Generated IDs are unique
+	router := gin.New()
+	router.Use(middleware.Logger(logging.New(&bytes.Buffer{}, slog.LevelInfo)))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	ids := map[string]bool{}
+	for range 10 {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		ids[rec.Header().Get(middleware.RequestIDHeader)] = true
+	}
+	assert.Len(t, ids, 10)
+}
+
+func TestLogger_Fields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	router := gin.New()
+	router.Use(middleware.Logger(logging.New(&logs, slog.LevelInfo)))
+	router.GET("/orgs/:id", func(c *gin.Context) {
+		key := &enterprise.APIKey{ID: 3, CreatedBy: 7}
+		c.Set(middleware.APIKeyKey, key)
+		c.Set(middleware.UserIDKey, key.CreatedBy)
+		c.Set(middleware.OrganizationIDKey, int64(5))
+		middleware.AddLogFields(c, "user_id", key.CreatedBy, "api_key_id", key.ID)
+		middleware.AddLogFields(c, "org_id", int64(5))
+		logging.FromContext(c.Request.Context()).Info("handled")
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/missing", func(c *gin.Context) {
+		c.Error(fmt.Errorf("load vote: %w", errors.New("not found")))
+		c.Status(http.StatusNotFound)
+	})
+	router.GET("/broken", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/orgs/5?page=2", nil)
+	req.RemoteAddr = "192.0.2.9:1234"
+	router.ServeHTTP(rec, req)
+	logged := records(t, &logs)
+	require.Len(t, logged, 2)
+
+	// Fields added down the chain are carried by what it logs
+	handled := logged[0]
+	assert.Equal(t, "handled", handled["msg"])
+	assert.Equal(t, rec.Header().Get(middleware.RequestIDHeader), handled["request_id"])
+	assert.Equal(t, "GET", handled["method"])
+	assert.Equal(t, "/orgs/:id", handled["route"])
+	assert.Equal(t, float64(7), handled["user_id"])
+	assert.Equal(t, float64(3), handled["api_key_id"])
+	assert.Equal(t, float64(5), handled["org_id"])
+
+	request := logged[1]
+	assert.Equal(t, "request", request["msg"])
+	assert.Equal(t, "INFO", request["level"])
+	assert.Equal(t, handled["request_id"], request["request_id"])
+	assert.Equal(t, "GET", request["method"])
+	assert.Equal(t, "/orgs/:id", request["route"], "the route template")
+	assert.Equal(t, "/orgs/5", request["path"], "the path, without the query")
+	assert.Equal(t, float64(http.StatusNoContent), request["status"])
+	assert.Equal(t, "192.0.2.9", request["client_ip"])
+	assert.Contains(t, request, "latency")
+	assert.Equal(t, float64(7), request["user_id"])
+	assert.Equal(t, float64(3), request["api_key_id"])
+	assert.Equal(t, float64(5), request["org_id"])
+	assert.NotContains(t, request, "errors")
+	assert.NotContains(t, request, "trace_id", "no span without tracing")
+
+	// Client errors are warnings listing their chains, server errors errors
+	for path, want := range map[string]struct {
+		level  string
+		errors any
+	}{
+		"/missing": {"WARN", []any{[]any{"load vote: not found", "not found"}}},
+		"/broken":  {"ERROR", nil},
+	} {
+		logs.Reset()
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		logged := records(t, &logs)
+		require.Len(t, logged, 1, path)
+		assert.Equal(t, want.level, logged[0]["level"], path)
+		assert.Equal(t, want.errors, logged[0]["errors"], path)
+		assert.NotContains(t, logged[0], "user_id", path)
+	}
+}
@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/logging"
+	"vws-backend/internal/ratelimit"
+)
+
+// Key marking that a route specific policy was already applied to the request
+const rateLimitRouteAppliedKey = "rate_limit_route_applied"
+
+// DefaultAPIKeyWindow is the window APIKey.RateLimit is measured over
+const DefaultAPIKeyWindow = time.Hour
+
+// KeyFunc returns the identity a rate limit is tracked for, or false if
+// the request carries no such identity
+type KeyFunc func(c *gin.Context) (string, bool)
+
+// KeyByIP identifies requests by client IP
+func KeyByIP(c *gin.Context) (string, bool) {
+	return "ip:" + c.ClientIP(), true
+}
+
+// KeyByUser identifies requests by the authenticated user
+func KeyByUser(c *gin.Context) (string, bool) {
+	userID := c.GetInt64(UserIDKey)
+	if userID == 0 {
+		return "", false
+	}
+	return "user:" + strconv.FormatInt(userID, 10), true
+}
+
+// KeyByAPIKey identifies requests by the API key that authenticated them
+func KeyByAPIKey(c *gin.Context) (string, bool) {
+	key, ok := GetAPIKey(c)
+	if !ok {
+		return "", false
+	}
+	return "apikey:" + strconv.FormatInt(key.ID, 10), true
+}
+
+// RatePolicy describes a rate limit and who it applies to. The first key
+// function that resolves an identity is used; requests matching none of
+// them are not limited by the policy. A zero Rate stands for the
+// limiter's default rate.
+type RatePolicy struct {
+	Name  string
+	Rate  ratelimit.Rate
+	KeyBy []KeyFunc
+}
+
+// RateLimiter enforces rate policies against a shared store
+type RateLimiter struct {
+	store        ratelimit.Store
+	apiKeyWindow time.Duration
+
+	mu          sync.RWMutex
+	defaultRate ratelimit.Rate
+	routes      map[string]RatePolicy
+}
+
+// NewRateLimiter creates a new rate limiter
+func NewRateLimiter(store ratelimit.Store) *RateLimiter {
+	return &RateLimiter{
+		store:        store,
+		apiKeyWindow: DefaultAPIKeyWindow,
+		routes:       make(map[string]RatePolicy),
+	}
+}
+
+// SetRoutePolicy overrides the policy for one route, identified by its
+// method and route template, e.g. ("POST", "/api/users/login")
+func (rl *RateLimiter) SetRoutePolicy(method, path string, policy RatePolicy) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.routes[method+" "+path] = policy
+}
+
+// SetDefaultRate changes the rate of policies that don't set their own
+func (rl *RateLimiter) SetDefaultRate(rate ratelimit.Rate) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.defaultRate = rate
+}
+
+// SetRoutePolicies replaces every route policy at once
+func (rl *RateLimiter) SetRoutePolicies(policies map[string]RatePolicy) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.routes = policies
+}
+
+// RateLimit middleware enforces policy, or the route's own policy if one
+// is registered. A route policy is only applied once per request even when
+// several RateLimit middlewares run in the chain.
+func (rl *RateLimiter) RateLimit(policy RatePolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		effective := policy
+		if routePolicy, ok := rl.routePolicy(c); ok && !c.GetBool(rateLimitRouteAppliedKey) {
+			if _, resolvable := resolveKey(c, routePolicy.KeyBy); resolvable {
+				effective = routePolicy
+				c.Set(rateLimitRouteAppliedKey, true)
+			}
+		}
+
+		identity, ok := resolveKey(c, effective.KeyBy)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		rate := effective.Rate
+		if rate == (ratelimit.Rate{}) {
+			rate = rl.currentDefaultRate()
+		}
+		if key, ok := GetAPIKey(c); ok && key.RateLimit > 0 {
+			if apiKeyIdentity, _ := KeyByAPIKey(c); identity == apiKeyIdentity {
+				rate = ratelimit.Rate{Requests: key.RateLimit, Window: rl.apiKeyWindow}
+			}
+		}
+
+		result, err := rl.store.Allow(c.Request.Context(), effective.Name+":"+identity, rate)
+		if err != nil {
+			// Fail open so a storage outage doesn't take the API down
+			logging.FromContext(c.Request.Context()).Error("rate limit check failed",
+				"policy", effective.Name, "error", err)
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, rate, result)
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			Abort(c, apperr.New(apperr.ErrRateLimited, "rate_limited", "Rate limit exceeded"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (rl *RateLimiter) currentDefaultRate() ratelimit.Rate {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.defaultRate
+}
+
+func (rl *RateLimiter) routePolicy(c *gin.Context) (RatePolicy, bool) {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	policy, ok := rl.routes[c.Request.Method+" "+c.FullPath()]
+	return policy, ok
+}
+
+func resolveKey(c *gin.Context, keyFuncs []KeyFunc) (string, bool) {
+	for _, keyFunc := range keyFuncs {
+		if identity, ok := keyFunc(c); ok {
+			return identity, true
+		}
+	}
+	return "", false
+}
+
+// setRateLimitHeaders writes the IETF RateLimit header fields
+func setRateLimitHeaders(c *gin.Context, rate ratelimit.Rate, result *ratelimit.Result) {
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rate.Requests, ceilSeconds(rate.Window)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
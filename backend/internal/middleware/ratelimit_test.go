@@ -0,0 +1,209 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/middleware"
+	"vws-backend/internal/ratelimit"
+	"vws-backend/internal/service/enterprise"
+)
+
+// recordingStore is a memory store recording the keys and rates checked,
+// or failing with err
+type recordingStore struct {
+	store *ratelimit.MemoryStore
+	err   error
+
+	mu     sync.Mutex
+	checks []check
+}
+
+type check struct {
+	key  string
+	rate ratelimit.Rate
+}
+
+func newRecordingStore() *recordingStore {
+	return &recordingStore{store: ratelimit.NewMemoryStore(0)}
+}
+
+func (s *recordingStore) Allow(ctx context.Context, key string, rate ratelimit.Rate) (*ratelimit.Result, error) {
+	s.mu.Lock()
+	s.checks = append(s.checks, check{key, rate})
+	s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.store.Allow(ctx, key, rate)
+}
+
+func (s *recordingStore) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, len(s.checks))
+	for i, c := range s.checks {
+		keys[i] = c.key
+	}
+	return keys
+}
+
+func perMinute(n int) ratelimit.Rate {
+	return ratelimit.Rate{Requests: n, Window: time.Minute}
+}
+
+// rateLimitRouter serves GET and POST /items/:id behind the limiter's
+// RateLimit(policy), authenticating requests as the user or API key set by
+// the test
+func rateLimitRouter(limiter *middleware.RateLimiter, policy middleware.RatePolicy, auth gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Errors(), auth, limiter.RateLimit(policy))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/items/:id", ok)
+	router.POST("/items/:id", ok)
+	return router
+}
+
+func asUser(id int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id != 0 {
+			c.Set(middleware.UserIDKey, id)
+		}
+	}
+}
+
+func send(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestRateLimit_Headers(t *testing.T) {
+	limiter := middleware.NewRateLimiter(newRecordingStore())
+	router := rateLimitRouter(limiter, middleware.RatePolicy{Name: "api", Rate: perMinute(2), KeyBy: []middleware.KeyFunc{middleware.KeyByIP}}, asUser(0))
+
+	// Two requests a minute refill one every 30 seconds
+	for i, want := range []struct{ remaining, reset string }{{"1", "30"}, {"0", "60"}} {
+		rec := send(router, http.MethodGet, "/items/1")
+		require.Equal(t, http.StatusOK, rec.Code, "request %d", i)
+		assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, want.remaining, rec.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, want.reset, rec.Header().Get("RateLimit-Reset"))
+		assert.Equal(t, "2;w=60", rec.Header().Get("RateLimit-Policy"))
+		assert.Empty(t, rec.Header().Get("Retry-After"))
+	}
+
+	rec := send(router, http.MethodGet, "/items/1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, rec.Body.String(), "rate_limited")
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+}
+
+func TestRateLimit_RoutePolicy(t *testing.T) {
+	store := newRecordingStore()
+	limiter := middleware.NewRateLimiter(store)
+	limiter.SetDefaultRate(perMinute(100))
+	limiter.SetRoutePolicy(http.MethodPost, "/items/:id", middleware.RatePolicy{Name: "writes", Rate: perMinute(1), KeyBy: []middleware.KeyFunc{middleware.KeyByUser}})
+	router := rateLimitRouter(limiter, middleware.RatePolicy{Name: "api", KeyBy: []middleware.KeyFunc{middleware.KeyByUser}}, asUser(7))
+
+	// The route policy is keyed by the route template, not the path
+	assert.Equal(t, http.StatusOK, send(router, http.MethodPost, "/items/1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(router, http.MethodPost, "/items/2").Code)
+	// Other methods of the path get the policy of the middleware, at the
+	// default rate it leaves unset
+	rec := send(router, http.MethodGet, "/items/1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "100", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, []string{"writes:user:7", "writes:user:7", "api:user:7"}, store.keys())
+
+	// A route policy whose identity the request lacks leaves the request
+	// to the middleware's policy
+	anonymous := rateLimitRouter(limiter, middleware.RatePolicy{Name: "api", KeyBy: []middleware.KeyFunc{middleware.KeyByIP}}, asUser(0))
+	rec = send(anonymous, http.MethodPost, "/items/1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "100", rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimit_RoutePolicyAppliedOnce(t *testing.T) {
+	store := newRecordingStore()
+	limiter := middleware.NewRateLimiter(store)
+	limiter.SetRoutePolicy(http.MethodGet, "/items/:id", middleware.RatePolicy{Name: "route", Rate: perMinute(5), KeyBy: []middleware.KeyFunc{middleware.KeyByIP}})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Errors(), limiter.RateLimit(middleware.RatePolicy{Name: "global", Rate: perMinute(50), KeyBy: []middleware.KeyFunc{middleware.KeyByIP}}))
+	router.GET("/items/:id", limiter.RateLimit(middleware.RatePolicy{Name: "group", Rate: perMinute(20), KeyBy: []middleware.KeyFunc{middleware.KeyByIP}}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	require.Equal(t, http.StatusOK, send(router, http.MethodGet, "/items/1").Code)
+	assert.Equal(t, []string{"route:ip:192.0.2.1", "group:ip:192.0.2.1"}, store.keys())
+}
+
+func TestRateLimit_APIKeyRate(t *testing.T) {
+	store := newRecordingStore()
+	limiter := middleware.NewRateLimiter(store)
+	key := &enterprise.APIKey{ID: 3, RateLimit: 1, CreatedBy: 7}
+	withKey := func(c *gin.Context) {
+		c.Set(middleware.APIKeyKey, key)
+		c.Set(middleware.UserIDKey, key.CreatedBy)
+	}
+
+	// The key's own limit replaces the policy's rate when the policy
+	// tracks the key
+	byKey := rateLimitRouter(limiter, middleware.RatePolicy{Name: "keys", Rate: perMinute(50), KeyBy: []middleware.KeyFunc{middleware.KeyByAPIKey, middleware.KeyByUser}}, withKey)
+	rec := send(byKey, http.MethodGet, "/items/1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1;w=3600", rec.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, http.StatusTooManyRequests, send(byKey, http.MethodGet, "/items/1").Code)
+	assert.Equal(t, ratelimit.Rate{Requests: 1, Window: middleware.DefaultAPIKeyWindow}, store.checks[0].rate)
+
+	// but not when it tracks someone else, such as the key's creator
+	byUser := rateLimitRouter(limiter, middleware.RatePolicy{Name: "users", Rate: perMinute(50), KeyBy: []middleware.KeyFunc{middleware.KeyByUser}}, withKey)
+	rec = send(byUser, http.MethodGet, "/items/1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "50", rec.Header().Get("RateLimit-Limit"))
+
+	// Keys without a limit of their own get the policy's rate
+	key.RateLimit = 0
+	key.ID = 4
+	rec = send(byKey, http.MethodGet, "/items/1")
+	assert.Equal(t, "50", rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimit_FailsOpen(t *testing.T) {
+	store := newRecordingStore()
+	store.err = errors.New("redis: connection refused")
+	limiter := middleware.NewRateLimiter(store)
+	router := rateLimitRouter(limiter, middleware.RatePolicy{Name: "api", Rate: perMinute(1), KeyBy: []middleware.KeyFunc{middleware.KeyByIP}}, asUser(0))
+
+	for range 3 {
+		rec := send(router, http.MethodGet, "/items/1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+	}
+	assert.Len(t, store.keys(), 3, "the store is asked every time")
+}
+
+func TestRateLimit_NoIdentity(t *testing.T) {
+	store := newRecordingStore()
+	limiter := middleware.NewRateLimiter(store)
+	router := rateLimitRouter(limiter, middleware.RatePolicy{Name: "users", Rate: perMinute(1), KeyBy: []middleware.KeyFunc{middleware.KeyByUser}}, asUser(0))
+
+	for range 3 {
+		assert.Equal(t, http.StatusOK, send(router, http.MethodGet, "/items/1").Code)
+	}
+	assert.Empty(t, store.keys(), "requests without the identity are not limited")
+}
@@ -0,0 +1,367 @@
+// Package migrate applies the embedded SQL migrations to Postgres
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table records the current schema version. Its layout matches the one
+// used by golang-migrate, so databases migrated with it keep working.
+const Table = "schema_migrations"
+
+// Advisory lock key held while migrating, so concurrently starting
+// servers don't apply the same migration twice
+const lockKey int64 = 0x767773 // "vws"
+
+var (
+	ErrDirty         = errors.New("database is dirty, a migration failed part way; fix it manually and force the version")
+	ErrNoChange      = errors.New("no change")
+	ErrUnknownTarget = errors.New("unknown migration version")
+)
+
+// Migration is one schema change and its inverse
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Version uint   `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+// Load reads migrations named <version>_<name>.<up|down>.sql from fsys. It
+// fails if any migration is missing its up or down file, so it doubles as
+// a consistency check.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*Migration)
+	var problems []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+
+		base := strings.TrimSuffix(name, ".sql")
+		base, direction, ok := cutLast(base, ".")
+		if !ok || (direction != "up" && direction != "down") {
+			problems = append(problems, fmt.Sprintf("%s: expected <version>_<name>.<up|down>.sql", name))
+			continue
+		}
+		prefix, title, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseUint(prefix, 10, 32)
+		if !ok || err != nil || version == 0 {
+			problems = append(problems, fmt.Sprintf("%s: expected a positive version number prefix", name))
+			continue
+		}
+
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: title}
+			byVersion[uint(version)] = m
+		}
+		if m.Name != title {
+			problems = append(problems, fmt.Sprintf("%s: version %d is also used by %q", name, version, m.Name))
+			continue
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			problems = append(problems, fmt.Sprintf("%06d_%s: missing or empty up migration", m.Version, m.Name))
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			problems = append(problems, fmt.Sprintf("%06d_%s: missing or empty down migration", m.Version, m.Name))
+		}
+		migrations = append(migrations, *m)
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid migrations:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// Migrator moves a database between schema versions
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New creates a migrator for the migrations in fsys
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the version of the newest migration
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the current schema version, zero if nothing is applied
+func (m *Migrator) Version(ctx context.Context) (version uint, dirty bool, err error) {
+	if err := m.ensureTable(ctx, m.db); err != nil {
+		return 0, false, err
+	}
+	return readVersion(ctx, m.db)
+}
+
+// Status lists every migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	version, _, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+			Applied: migration.Version <= version,
+		})
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) ([]uint, error) {
+	return m.Goto(ctx, m.Latest())
+}
+
+// Down rolls back the last steps migrations
+func (m *Migrator) Down(ctx context.Context, steps int) ([]uint, error) {
+	version, _, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := m.indexOf(version)
+	if index < 0 {
+		return nil, ErrNoChange
+	}
+	target := uint(0)
+	if index-steps >= 0 {
+		target = m.migrations[index-steps].Version
+	}
+	return m.Goto(ctx, target)
+}
+
+// Goto migrates up or down to version, zero meaning an empty schema, and
+// returns the versions it applied or rolled back in order
+func (m *Migrator) Goto(ctx context.Context, target uint) ([]uint, error) {
+	if target != 0 && m.indexOf(target) < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownTarget, target)
+	}
+
+	var changed []uint
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		if err := m.ensureTable(ctx, conn); err != nil {
+			return err
+		}
+		version, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w (version %d)", ErrDirty, version)
+		}
+
+		for _, step := range m.plan(version, target) {
+			if err := m.apply(ctx, conn, step); err != nil {
+				return err
+			}
+			changed = append(changed, step.migration.Version)
+		}
+		return nil
+	})
+	if err != nil {
+		return changed, err
+	}
+	if len(changed) == 0 {
+		return nil, ErrNoChange
+	}
+	return changed, nil
+}
+
+// Force records version as the current one without running any migration,
+// clearing the dirty flag. It is the way out after fixing a failed
+// migration by hand.
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	if version != 0 && m.indexOf(version) < 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownTarget, version)
+	}
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		if err := m.ensureTable(ctx, conn); err != nil {
+			return err
+		}
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := setVersion(ctx, tx, version); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+type step struct {
+	migration Migration
+	up        bool
+	after     uint // Version recorded once the step is done
+}
+
+// plan lists the steps leading from version to target
+func (m *Migrator) plan(version, target uint) []step {
+	var steps []step
+	if target >= version {
+		for _, migration := range m.migrations {
+			if migration.Version > version && migration.Version <= target {
+				steps = append(steps, step{migration: migration, up: true, after: migration.Version})
+			}
+		}
+		return steps
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= version && migration.Version > target {
+			after := uint(0)
+			if i > 0 {
+				after = m.migrations[i-1].Version
+			}
+			steps = append(steps, step{migration: migration, up: false, after: after})
+		}
+	}
+	return steps
+}
+
+// apply runs one migration and records the new version in the same
+// transaction, so a failure leaves the schema untouched
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, s step) error {
+	body, direction := s.migration.Up, "up"
+	if !s.up {
+		body, direction = s.migration.Down, "down"
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return fmt.Errorf("migration %d_%s %s: %w", s.migration.Version, s.migration.Name, direction, err)
+	}
+	if err := setVersion(ctx, tx, s.after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) indexOf(version uint) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// withLock runs fn on a dedicated connection holding the migration lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	return fn(conn)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, db execer) error {
+	_, err := db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS `+Table+` (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`)
+	return err
+}
+
+func readVersion(ctx context.Context, db execer) (uint, bool, error) {
+	var version int64
+	var dirty bool
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM `+Table+` LIMIT 1`).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint(version), dirty, nil
+}
+
+func setVersion(ctx context.Context, tx *sql.Tx, version uint) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+Table); err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO `+Table+` (version, dirty) VALUES ($1, false)`, int64(version))
+	return err
+}
@@ -0,0 +1,148 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"000001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+		"000001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"000002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INT);")},
+		"000002_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"README.md":                {Data: []byte("not a migration")},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testFS())
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, uint(1), migrations[0].Version)
+	assert.Equal(t, "create_a", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE b;", migrations[1].Down)
+}
+
+func TestLoad_ReportsEveryProblem(t *testing.T) {
+	fsys := testFS()
+	delete(fsys, "000002_create_b.down.sql")
+	fsys["000003_create_c.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE c;")}
+	fsys["bad.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+
+	_, err := Load(fsys)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "000002_create_b: missing or empty down migration")
+	assert.Contains(t, err.Error(), "000003_create_c: missing or empty up migration")
+	assert.Contains(t, err.Error(), "bad.up.sql: expected a positive version number prefix")
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := New(db, testFS())
+	require.NoError(t, err)
+	return m, mock
+}
+
+func expectLocked(mock sqlmock.Sqlmock, version int64, dirty bool) {
+	mock.ExpectExec(`SELECT pg_advisory_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "dirty"})
+	if version > 0 {
+		rows.AddRow(version, dirty)
+	}
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).WillReturnRows(rows)
+}
+
+func expectStep(mock sqlmock.Sqlmock, statement string, after int64) {
+	mock.ExpectBegin()
+	mock.ExpectExec(statement).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 1))
+	if after > 0 {
+		mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(after).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestUp(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	expectLocked(mock, 1, false)
+	expectStep(mock, `CREATE TABLE b`, 2)
+	mock.ExpectExec(`SELECT pg_advisory_unlock`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := m.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []uint{2}, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUp_NoChange(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	expectLocked(mock, 2, false)
+	mock.ExpectExec(`SELECT pg_advisory_unlock`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := m.Up(context.Background())
+	assert.Equal(t, ErrNoChange, err)
+}
+
+func TestUp_RefusesDirtyDatabase(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	expectLocked(mock, 1, true)
+	mock.ExpectExec(`SELECT pg_advisory_unlock`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := m.Up(context.Background())
+	assert.ErrorIs(t, err, ErrDirty)
+}
+
+func TestUp_FailureRollsBack(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	expectLocked(mock, 0, false)
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE a`).WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+	mock.ExpectExec(`SELECT pg_advisory_unlock`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := m.Up(context.Background())
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	assert.Contains(t, err.Error(), "migration 1_create_a up")
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDown(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	// Down reads the version before taking the lock
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(2, false))
+	expectLocked(mock, 2, false)
+	expectStep(mock, `DROP TABLE b`, 1)
+	expectStep(mock, `DROP TABLE a`, 0)
+	mock.ExpectExec(`SELECT pg_advisory_unlock`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rolledBack, err := m.Down(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{2, 1}, rolledBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGoto_UnknownVersion(t *testing.T) {
+	m, _ := newTestMigrator(t)
+
+	_, err := m.Goto(context.Background(), 7)
+	assert.ErrorIs(t, err, ErrUnknownTarget)
+}
@@ -0,0 +1,231 @@
+// Package onnx runs ONNX models on the CPU, in pure Go. It implements the
+// operators convolutional detection networks are built from, for float32
+// and int64 tensors; models using any other operator fail to load.
+package onnx
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+)
+
+// DataType is the element type of a tensor
+type DataType int32
+
+// Data types, numbered as in the ONNX format. Int32 tensors in a model are
+// widened to Int64 when it is loaded.
+const (
+	Float DataType = 1
+	Int64 DataType = 7
+)
+
+func (t DataType) String() string {
+	switch t {
+	case Float:
+		return "float"
+	case Int64:
+		return "int64"
+	}
+	return fmt.Sprintf("type %d", int32(t))
+}
+
+// Tensor is a dense tensor in row-major order. The elements of Float
+// tensors are kept in Float, those of Int64 tensors in Int. Operators never
+// modify their inputs, so tensors may share their elements.
+type Tensor struct {
+	Type  DataType
+	Shape []int
+	Float []float32
+	Int   []int64
+}
+
+// NewFloat returns a float tensor of the given shape holding data
+func NewFloat(shape []int, data []float32) *Tensor {
+	return &Tensor{Type: Float, Shape: scalarShape(shape), Float: data}
+}
+
+// NewInt64 returns an int64 tensor of the given shape holding data
+func NewInt64(shape []int, data []int64) *Tensor {
+	return &Tensor{Type: Int64, Shape: scalarShape(shape), Int: data}
+}
+
+// scalarShape keeps the shape of scalars from being nil, so that equal
+// tensors compare equal
+func scalarShape(shape []int) []int {
+	if shape == nil {
+		return []int{}
+	}
+	return shape
+}
+
+// Len returns the number of elements of the tensor
+func (t *Tensor) Len() int {
+	return size(t.Shape)
+}
+
+// reshaped returns the tensor with another shape of the same size
+func (t *Tensor) reshaped(shape []int) *Tensor {
+	c := *t
+	c.Shape = scalarShape(shape)
+	return &c
+}
+
+// size returns the number of elements of a tensor of shape
+func size(shape []int) int {
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	return n
+}
+
+// Model is a computation graph. Its methods are safe for concurrent use.
+type Model struct {
+	Opset        int64              // Version of the default operator set
+	Inputs       []ValueInfo        // Inputs the caller provides
+	Outputs      []ValueInfo        // Outputs Run returns
+	Initializers map[string]*Tensor // Weights, by name
+	Nodes        []Node             // In topological order
+}
+
+// ValueInfo describes an input or output of a model
+type ValueInfo struct {
+	Name  string
+	Type  DataType
+	Shape []int // -1 for dimensions decided when the model is run, nil if unknown
+}
+
+// Node applies an operator to tensors
+type Node struct {
+	Name    string
+	Op      string
+	Inputs  []string       // "" for optional inputs left out
+	Outputs []string       // "" for optional outputs not needed
+	Attrs   map[string]any // int64, []int64, float32, []float32, string or *Tensor
+}
+
+// Load reads the model in the file at path
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes a model in the ONNX protobuf format and checks that it can
+// be run
+func Parse(data []byte) (*Model, error) {
+	m, err := decodeModel(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode model: %w", err)
+	}
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// check verifies that the operator of every node is implemented, and that
+// its inputs are computed before it
+func (m *Model) check() error {
+	known := map[string]bool{"": true}
+	for _, in := range m.Inputs {
+		known[in.Name] = true
+	}
+	for name := range m.Initializers {
+		known[name] = true
+	}
+	for _, n := range m.Nodes {
+		if _, ok := operators[n.Op]; !ok {
+			return fmt.Errorf("node %q: operator %s is not supported", n.Name, n.Op)
+		}
+		for _, in := range n.Inputs {
+			if !known[in] {
+				return fmt.Errorf("node %q: input %q is not computed before it", n.Name, in)
+			}
+		}
+		for _, out := range n.Outputs {
+			known[out] = true
+		}
+	}
+	for _, out := range m.Outputs {
+		if !known[out.Name] {
+			return fmt.Errorf("output %q is not computed", out.Name)
+		}
+	}
+	return nil
+}
+
+// Run computes the outputs of the model from inputs, keyed by name. It
+// stops early if ctx is done.
+func (m *Model) Run(ctx context.Context, inputs map[string]*Tensor) (map[string]*Tensor, error) {
+	values := make(map[string]*Tensor, len(m.Initializers)+len(m.Nodes))
+	maps.Copy(values, m.Initializers)
+	for _, in := range m.Inputs {
+		t, ok := inputs[in.Name]
+		if !ok {
+			if _, ok := m.Initializers[in.Name]; ok {
+				continue // Older models list their weights as inputs
+			}
+			return nil, fmt.Errorf("input %q is missing", in.Name)
+		}
+		if err := in.accepts(t); err != nil {
+			return nil, fmt.Errorf("input %q: %w", in.Name, err)
+		}
+		values[in.Name] = t
+	}
+
+	for i := range m.Nodes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n := &m.Nodes[i]
+		args := make([]*Tensor, len(n.Inputs))
+		for j, name := range n.Inputs {
+			args[j] = values[name]
+		}
+		results, err := operators[n.Op](n, args)
+		if err != nil {
+			return nil, fmt.Errorf("%s node %q: %w", n.Op, n.Name, err)
+		}
+		for j, name := range n.Outputs {
+			if name == "" {
+				continue
+			}
+			if j >= len(results) {
+				return nil, fmt.Errorf("%s node %q: output %d is not supported", n.Op, n.Name, j)
+			}
+			values[name] = results[j]
+		}
+	}
+
+	outputs := make(map[string]*Tensor, len(m.Outputs))
+	for _, out := range m.Outputs {
+		outputs[out.Name] = values[out.Name]
+	}
+	return outputs, nil
+}
+
+// accepts checks that t can be passed for the input
+func (v ValueInfo) accepts(t *Tensor) error {
+	if t.Type != v.Type {
+		return fmt.Errorf("got %s tensor, want %s", t.Type, v.Type)
+	}
+	if v.Shape == nil {
+		return nil // Any shape
+	}
+	if len(t.Shape) != len(v.Shape) {
+		return fmt.Errorf("got shape %v, want %v", t.Shape, v.Shape)
+	}
+	for i, d := range v.Shape {
+		if d >= 0 && t.Shape[i] != d {
+			return fmt.Errorf("got shape %v, want %v", t.Shape, v.Shape)
+		}
+	}
+	if t.Type == Float && len(t.Float) != t.Len() || t.Type == Int64 && len(t.Int) != t.Len() {
+		return fmt.Errorf("shape %v doesn't match its elements", t.Shape)
+	}
+	return nil
+}
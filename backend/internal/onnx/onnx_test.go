@@ -0,0 +1,234 @@
+package onnx_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/onnx"
+)
+
+// run applies op to the inputs, named a, b, c... in order, through a model
+// that is encoded and decoded first
+func run(t *testing.T, op string, attrs map[string]any, inputs ...*onnx.Tensor) *onnx.Tensor {
+	t.Helper()
+	m := &onnx.Model{Opset: 13, Initializers: map[string]*onnx.Tensor{}, Outputs: []onnx.ValueInfo{{Name: "y", Type: onnx.Float}}}
+	node := onnx.Node{Name: "node", Op: op, Outputs: []string{"y"}, Attrs: attrs}
+	for i, in := range inputs {
+		name := ""
+		if in != nil {
+			name = string(rune('a' + i))
+			m.Initializers[name] = in
+		}
+		node.Inputs = append(node.Inputs, name)
+	}
+	m.Nodes = []onnx.Node{node}
+
+	data, err := m.Marshal()
+	require.NoError(t, err)
+	parsed, err := onnx.Parse(data)
+	require.NoError(t, err)
+	out, err := parsed.Run(context.Background(), nil)
+	require.NoError(t, err)
+	return out["y"]
+}
+
+func floats(shape []int, data ...float32) *onnx.Tensor { return onnx.NewFloat(shape, data) }
+func ints(shape []int, data ...int64) *onnx.Tensor     { return onnx.NewInt64(shape, data) }
+
+func count(n int) []float32 {
+	data := make([]float32, n)
+	for i := range data {
+		data[i] = float32(i)
+	}
+	return data
+}
+
+func TestOperators(t *testing.T) {
+	for name, tc := range map[string]struct {
+		op     string
+		attrs  map[string]any
+		inputs []*onnx.Tensor
+		want   *onnx.Tensor
+	}{
+		"Conv padded": {"Conv", map[string]any{"pads": []int64{1, 1, 1, 1}},
+			[]*onnx.Tensor{floats([]int{1, 1, 3, 3}, 1, 2, 3, 4, 5, 6, 7, 8, 9), floats([]int{1, 1, 3, 3}, 1, 1, 1, 1, 1, 1, 1, 1, 1), floats([]int{1}, 10)},
+			floats([]int{1, 1, 3, 3}, 22, 31, 26, 37, 55, 43, 34, 49, 38)},
+		"Conv depthwise strided": {"Conv", map[string]any{"group": int64(2), "strides": []int64{2, 2}},
+			[]*onnx.Tensor{floats([]int{1, 2, 4, 4}, append(repeat(1, 16), repeat(2, 16)...)...), floats([]int{2, 1, 2, 2}, repeat(1, 8)...)},
+			floats([]int{1, 2, 2, 2}, 4, 4, 4, 4, 8, 8, 8, 8)},
+		"Conv same padding": {"Conv", map[string]any{"auto_pad": "SAME_UPPER", "strides": []int64{2, 2}},
+			[]*onnx.Tensor{floats([]int{1, 1, 3, 3}, repeat(1, 9)...), floats([]int{1, 1, 3, 3}, repeat(1, 9)...)},
+			floats([]int{1, 1, 2, 2}, 4, 4, 4, 4)},
+		"MaxPool": {"MaxPool", map[string]any{"kernel_shape": []int64{2, 2}, "strides": []int64{2, 2}},
+			[]*onnx.Tensor{floats([]int{1, 1, 4, 4}, count(16)...)},
+			floats([]int{1, 1, 2, 2}, 5, 7, 13, 15)},
+		"MaxPool ceil": {"MaxPool", map[string]any{"kernel_shape": []int64{2, 2}, "strides": []int64{2, 2}, "ceil_mode": int64(1)},
+			[]*onnx.Tensor{floats([]int{1, 1, 3, 3}, count(9)...)},
+			floats([]int{1, 1, 2, 2}, 4, 5, 7, 8)},
+		"AveragePool padded": {"AveragePool", map[string]any{"kernel_shape": []int64{2, 2}, "pads": []int64{1, 1, 1, 1}},
+			[]*onnx.Tensor{floats([]int{1, 1, 2, 2}, 1, 2, 3, 4)},
+			floats([]int{1, 1, 3, 3}, 1, 1.5, 2, 2, 2.5, 3, 3, 3.5, 4)},
+		"GlobalAveragePool": {"GlobalAveragePool", nil,
+			[]*onnx.Tensor{floats([]int{1, 2, 1, 2}, 1, 3, 5, 7)},
+			floats([]int{1, 2, 1, 1}, 2, 6)},
+		"BatchNormalization": {"BatchNormalization", map[string]any{"epsilon": float32(0)},
+			[]*onnx.Tensor{floats([]int{1, 2, 1, 1}, 1, 2), floats([]int{2}, 2, 1), floats([]int{2}, 0, 1), floats([]int{2}, 1, 0), floats([]int{2}, 4, 1)},
+			floats([]int{1, 2, 1, 1}, 0, 3)},
+		"Add broadcast": {"Add", nil,
+			[]*onnx.Tensor{floats([]int{2, 3}, 1, 2, 3, 4, 5, 6), floats([]int{3}, 10, 20, 30)},
+			floats([]int{2, 3}, 11, 22, 33, 14, 25, 36)},
+		"Mul int64 scalar": {"Mul", nil,
+			[]*onnx.Tensor{ints([]int{2}, 2, 3), ints([]int{}, 4)},
+			ints([]int{2}, 8, 12)},
+		"Div":     {"Div", nil, []*onnx.Tensor{floats([]int{2}, 1, 3), floats([]int{1}, 2)}, floats([]int{2}, 0.5, 1.5)},
+		"Relu":    {"Relu", nil, []*onnx.Tensor{floats([]int{2}, -1, 2)}, floats([]int{2}, 0, 2)},
+		"Sigmoid": {"Sigmoid", nil, []*onnx.Tensor{floats([]int{1}, 0)}, floats([]int{1}, 0.5)},
+		"PRelu per channel": {"PRelu", nil,
+			[]*onnx.Tensor{floats([]int{1, 2, 2}, -1, 2, -3, 4), floats([]int{2, 1}, 0.5, 0.25)},
+			floats([]int{1, 2, 2}, -0.5, 2, -0.75, 4)},
+		"Gemm": {"Gemm", map[string]any{"transB": int64(1), "alpha": float32(2)},
+			[]*onnx.Tensor{floats([]int{2, 2}, 1, 2, 3, 4), floats([]int{3, 2}, 1, 0, 0, 1, 1, 1), floats([]int{3}, 1, 1, 1)},
+			floats([]int{2, 3}, 3, 5, 7, 7, 9, 15)},
+		"Gemm transposed A": {"Gemm", map[string]any{"transA": int64(1)},
+			[]*onnx.Tensor{floats([]int{2, 1}, 1, 2), floats([]int{2, 2}, 1, 2, 3, 4)},
+			floats([]int{1, 2}, 7, 10)},
+		"MatMul batched": {"MatMul", nil,
+			[]*onnx.Tensor{floats([]int{2, 1, 2}, 1, 2, 3, 4), floats([]int{2, 2}, 1, 0, 0, 2)},
+			floats([]int{2, 1, 2}, 1, 4, 3, 8)},
+		"Reshape": {"Reshape", nil,
+			[]*onnx.Tensor{floats([]int{2, 3, 2}, count(12)...), ints([]int{2}, 0, -1)},
+			floats([]int{2, 6}, count(12)...)},
+		"Flatten": {"Flatten", map[string]any{"axis": int64(2)},
+			[]*onnx.Tensor{floats([]int{2, 3, 2}, count(12)...)},
+			floats([]int{6, 2}, count(12)...)},
+		"Transpose": {"Transpose", nil,
+			[]*onnx.Tensor{floats([]int{2, 3}, 1, 2, 3, 4, 5, 6)},
+			floats([]int{3, 2}, 1, 4, 2, 5, 3, 6)},
+		"Transpose perm": {"Transpose", map[string]any{"perm": []int64{0, 2, 1}},
+			[]*onnx.Tensor{floats([]int{1, 2, 3}, 1, 2, 3, 4, 5, 6)},
+			floats([]int{1, 3, 2}, 1, 4, 2, 5, 3, 6)},
+		"Concat": {"Concat", map[string]any{"axis": int64(-1)},
+			[]*onnx.Tensor{floats([]int{2, 1}, 1, 2), floats([]int{2, 2}, 3, 4, 5, 6)},
+			floats([]int{2, 3}, 1, 3, 4, 2, 5, 6)},
+		"Shape": {"Shape", nil, []*onnx.Tensor{floats([]int{2, 3, 2}, count(12)...)}, ints([]int{3}, 2, 3, 2)},
+		"Gather": {"Gather", map[string]any{"axis": int64(1)},
+			[]*onnx.Tensor{floats([]int{2, 3}, 1, 2, 3, 4, 5, 6), ints([]int{2}, -1, 0)},
+			floats([]int{2, 2}, 3, 1, 6, 4)},
+		"Gather scalar index": {"Gather", nil,
+			[]*onnx.Tensor{ints([]int{3}, 7, 8, 9), ints([]int{}, 1)},
+			ints([]int{}, 8)},
+		"Unsqueeze attribute": {"Unsqueeze", map[string]any{"axes": []int64{0, 2}},
+			[]*onnx.Tensor{floats([]int{3}, 1, 2, 3)},
+			floats([]int{1, 3, 1}, 1, 2, 3)},
+		"Unsqueeze input": {"Unsqueeze", nil,
+			[]*onnx.Tensor{floats([]int{3}, 1, 2, 3), ints([]int{1}, -1)},
+			floats([]int{3, 1}, 1, 2, 3)},
+		"Squeeze":  {"Squeeze", nil, []*onnx.Tensor{floats([]int{1, 3, 1}, 1, 2, 3)}, floats([]int{3}, 1, 2, 3)},
+		"Constant": {"Constant", map[string]any{"value": floats([]int{2}, 1, 2)}, nil, floats([]int{2}, 1, 2)},
+		"Upsample nearest": {"Upsample", nil,
+			[]*onnx.Tensor{floats([]int{1, 1, 2, 2}, 1, 2, 3, 4), floats([]int{4}, 1, 1, 2, 2)},
+			floats([]int{1, 1, 4, 4}, 1, 1, 2, 2, 1, 1, 2, 2, 3, 3, 4, 4, 3, 3, 4, 4)},
+		"Resize linear": {"Resize", map[string]any{"mode": "linear"},
+			[]*onnx.Tensor{floats([]int{1, 1, 1, 2}, 0, 4), nil, nil, ints([]int{4}, 1, 1, 1, 4)},
+			floats([]int{1, 1, 1, 4}, 0, 1, 3, 4)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := run(t, tc.op, tc.attrs, tc.inputs...)
+			require.NotNil(t, got)
+			assert.Equal(t, tc.want.Type, got.Type)
+			assert.Equal(t, tc.want.Shape, got.Shape)
+			assert.Equal(t, tc.want.Int, got.Int)
+			assert.InDeltaSlice(t, tc.want.Float, got.Float, 1e-5)
+		})
+	}
+}
+
+func repeat(v float32, n int) []float32 {
+	data := make([]float32, n)
+	for i := range data {
+		data[i] = v
+	}
+	return data
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	m := &onnx.Model{
+		Opset:   11,
+		Inputs:  []onnx.ValueInfo{{Name: "x", Type: onnx.Float, Shape: []int{1, 3, -1, -1}}},
+		Outputs: []onnx.ValueInfo{{Name: "y", Type: onnx.Float, Shape: []int{1, -1}}},
+		Initializers: map[string]*onnx.Tensor{
+			"w":     floats([]int{2}, 1.5, -2),
+			"shape": ints([]int{2}, 1, -1),
+		},
+		Nodes: []onnx.Node{{
+			Name: "reshape", Op: "Reshape", Inputs: []string{"x", "shape"}, Outputs: []string{"y"},
+			Attrs: map[string]any{
+				"f": float32(0.25), "i": int64(-3), "s": "text", "t": ints([]int{}, 5),
+				"floats": []float32{1, 2}, "ints": []int64{3, -4},
+			},
+		}},
+	}
+	data, err := m.Marshal()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "model.onnx")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	loaded, err := onnx.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, m, loaded)
+
+	out, err := loaded.Run(context.Background(), map[string]*onnx.Tensor{"x": floats([]int{1, 3, 1, 2}, count(6)...)})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 6}, out["y"].Shape)
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, m := range map[string]*onnx.Model{
+		"unsupported operator": {Nodes: []onnx.Node{{Name: "lstm", Op: "LSTM", Inputs: []string{"x"}, Outputs: []string{"y"}}},
+			Inputs: []onnx.ValueInfo{{Name: "x", Type: onnx.Float}}},
+		"input not computed":  {Nodes: []onnx.Node{{Name: "relu", Op: "Relu", Inputs: []string{"x"}, Outputs: []string{"y"}}}},
+		"output not computed": {Outputs: []onnx.ValueInfo{{Name: "y", Type: onnx.Float}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := m.Marshal()
+			require.NoError(t, err)
+			_, err = onnx.Parse(data)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := onnx.Parse([]byte("version: 1\ninputs:\n"))
+	assert.Error(t, err, "not a protobuf model")
+	_, err = onnx.Parse(nil)
+	assert.Error(t, err, "no graph")
+}
+
+func TestRun(t *testing.T) {
+	m := &onnx.Model{
+		Inputs:  []onnx.ValueInfo{{Name: "x", Type: onnx.Float, Shape: []int{1, -1}}},
+		Outputs: []onnx.ValueInfo{{Name: "y", Type: onnx.Float}},
+		Nodes:   []onnx.Node{{Op: "Relu", Inputs: []string{"x"}, Outputs: []string{"y"}}},
+	}
+	ctx := context.Background()
+
+	out, err := m.Run(ctx, map[string]*onnx.Tensor{"x": floats([]int{1, 2}, -1, 1)})
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0, 1}, out["y"].Float)
+
+	_, err = m.Run(ctx, nil)
+	assert.ErrorContains(t, err, `input "x" is missing`)
+	_, err = m.Run(ctx, map[string]*onnx.Tensor{"x": floats([]int{2, 1}, -1, 1)})
+	assert.ErrorContains(t, err, "want [1 -1]")
+	_, err = m.Run(ctx, map[string]*onnx.Tensor{"x": ints([]int{1, 1}, 1)})
+	assert.ErrorContains(t, err, "got int64 tensor, want float")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = m.Run(cancelled, map[string]*onnx.Tensor{"x": floats([]int{1, 1}, 1)})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,1089 @@
+package onnx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// operator computes the outputs of a node from its inputs, which are nil
+// where left out
+type operator func(n *Node, in []*Tensor) ([]*Tensor, error)
+
+// operators are the implemented operators, by ONNX name
+var operators = map[string]operator{
+	"Add":                arithmetic(func(a, b float32) float32 { return a + b }, func(a, b int64) int64 { return a + b }),
+	"AveragePool":        pool(false),
+	"BatchNormalization": batchNormalization,
+	"Concat":             concat,
+	"Constant":           constant,
+	"Conv":               conv,
+	"Div":                arithmetic(func(a, b float32) float32 { return a / b }, nil),
+	"Dropout":            identity,
+	"Flatten":            flatten,
+	"Gather":             gather,
+	"Gemm":               gemm,
+	"GlobalAveragePool":  globalAveragePool,
+	"Identity":           identity,
+	"MatMul":             matMul,
+	"MaxPool":            pool(true),
+	"Mul":                arithmetic(func(a, b float32) float32 { return a * b }, func(a, b int64) int64 { return a * b }),
+	"PRelu":              arithmetic(func(x, slope float32) float32 { return min(x, 0)*slope + max(x, 0) }, nil),
+	"Relu":               unary(func(v float32) float32 { return max(v, 0) }),
+	"Reshape":            reshape,
+	"Resize":             resize,
+	"Shape":              shapeOf,
+	"Sigmoid":            unary(func(v float32) float32 { return float32(1 / (1 + math.Exp(-float64(v)))) }),
+	"Squeeze":            squeeze,
+	"Sub":                arithmetic(func(a, b float32) float32 { return a - b }, func(a, b int64) int64 { return a - b }),
+	"Transpose":          transpose,
+	"Unsqueeze":          unsqueeze,
+	"Upsample":           resize,
+}
+
+func (n *Node) attrInt(name string, def int) int {
+	if v, ok := n.Attrs[name].(int64); ok {
+		return int(v)
+	}
+	return def
+}
+
+func (n *Node) attrInts(name string, def []int) []int {
+	v, ok := n.Attrs[name].([]int64)
+	if !ok {
+		return def
+	}
+	ints := make([]int, len(v))
+	for i, x := range v {
+		ints[i] = int(x)
+	}
+	return ints
+}
+
+func (n *Node) attrFloat(name string, def float32) float32 {
+	if v, ok := n.Attrs[name].(float32); ok {
+		return v
+	}
+	return def
+}
+
+func (n *Node) attrString(name, def string) string {
+	if v, ok := n.Attrs[name].(string); ok {
+		return v
+	}
+	return def
+}
+
+// arg returns input i, which must be given and of type typ
+func arg(in []*Tensor, i int, typ DataType) (*Tensor, error) {
+	t, err := anyArg(in, i)
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != typ {
+		return nil, fmt.Errorf("input %d is %s, want %s", i, t.Type, typ)
+	}
+	return t, nil
+}
+
+// anyArg returns input i, which must be given
+func anyArg(in []*Tensor, i int) (*Tensor, error) {
+	if i >= len(in) || in[i] == nil {
+		return nil, fmt.Errorf("input %d is required", i)
+	}
+	return in[i], nil
+}
+
+// optionalArg returns input i of type typ, or nil if it was left out
+func optionalArg(in []*Tensor, i int, typ DataType) (*Tensor, error) {
+	if i >= len(in) || in[i] == nil {
+		return nil, nil
+	}
+	return arg(in, i, typ)
+}
+
+// axis resolves a possibly negative axis of a tensor of rank
+func axis(a, rank int) (int, error) {
+	if a < -rank || a >= rank {
+		return 0, fmt.Errorf("axis %d out of range for rank %d", a, rank)
+	}
+	if a < 0 {
+		a += rank
+	}
+	return a, nil
+}
+
+// parallel calls fn for every i below n, spread over the CPUs
+func parallel(n int, fn func(i int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if workers <= 1 {
+		for i := range n {
+			fn(i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func identity(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := anyArg(in, 0)
+	if err != nil {
+		return nil, err
+	}
+	return []*Tensor{x}, nil
+}
+
+func unary(f func(float32) float32) operator {
+	return func(n *Node, in []*Tensor) ([]*Tensor, error) {
+		x, err := arg(in, 0, Float)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]float32, len(x.Float))
+		for i, v := range x.Float {
+			out[i] = f(v)
+		}
+		return []*Tensor{NewFloat(x.Shape, out)}, nil
+	}
+}
+
+// arithmetic applies an elementwise operator with broadcasting. Operators
+// without an int64 variant take float tensors only.
+func arithmetic(floatOp func(a, b float32) float32, intOp func(a, b int64) int64) operator {
+	return func(n *Node, in []*Tensor) ([]*Tensor, error) {
+		a, err := anyArg(in, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := arg(in, 1, a.Type)
+		if err != nil {
+			return nil, err
+		}
+		shape, err := broadcastShape(a.Shape, b.Shape)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case a.Type == Float:
+			return []*Tensor{NewFloat(shape, broadcast(shape, a.Shape, b.Shape, a.Float, b.Float, floatOp))}, nil
+		case a.Type == Int64 && intOp != nil:
+			return []*Tensor{NewInt64(shape, broadcast(shape, a.Shape, b.Shape, a.Int, b.Int, intOp))}, nil
+		}
+		return nil, fmt.Errorf("%s inputs are not supported", a.Type)
+	}
+}
+
+// broadcastShape returns the shape two tensors broadcast to
+func broadcastShape(a, b []int) ([]int, error) {
+	shape := make([]int, max(len(a), len(b)))
+	for i := range shape {
+		da, db := 1, 1
+		if j := i - len(shape) + len(a); j >= 0 {
+			da = a[j]
+		}
+		if j := i - len(shape) + len(b); j >= 0 {
+			db = b[j]
+		}
+		switch {
+		case da == db || db == 1:
+			shape[i] = da
+		case da == 1:
+			shape[i] = db
+		default:
+			return nil, fmt.Errorf("shapes %v and %v don't broadcast", a, b)
+		}
+	}
+	return shape, nil
+}
+
+// broadcast applies f to the elements of a and b broadcast to shape
+func broadcast[T float32 | int64](shape, aShape, bShape []int, a, b []T, f func(T, T) T) []T {
+	out := make([]T, size(shape))
+	if slices.Equal(aShape, bShape) {
+		for i := range out {
+			out[i] = f(a[i], b[i])
+		}
+		return out
+	}
+
+	aStrides, bStrides := broadcastStrides(shape, aShape), broadcastStrides(shape, bShape)
+	index := make([]int, len(shape))
+	var ai, bi int
+	for i := range out {
+		out[i] = f(a[ai], b[bi])
+		for d := len(shape) - 1; d >= 0; d-- {
+			index[d]++
+			ai += aStrides[d]
+			bi += bStrides[d]
+			if index[d] < shape[d] {
+				break
+			}
+			ai -= aStrides[d] * shape[d]
+			bi -= bStrides[d] * shape[d]
+			index[d] = 0
+		}
+	}
+	return out
+}
+
+// broadcastStrides returns the strides of a tensor of shape s broadcast to
+// shape, which are zero along the dimensions it is repeated in
+func broadcastStrides(shape, s []int) []int {
+	strides := make([]int, len(shape))
+	stride := 1
+	for d := len(s) - 1; d >= 0; d-- {
+		if s[d] != 1 {
+			strides[d+len(shape)-len(s)] = stride
+		}
+		stride *= s[d]
+	}
+	return strides
+}
+
+// window is the geometry of a 2D convolution or pooling over an input
+// plane
+type window struct {
+	kh, kw     int // Kernel size
+	sh, sw     int // Strides
+	dh, dw     int // Dilations
+	top, left  int // Padding before the input
+	outH, outW int
+}
+
+func newWindow(n *Node, height, width, kh, kw int, ceil bool) (*window, error) {
+	strides := n.attrInts("strides", []int{1, 1})
+	dilations := n.attrInts("dilations", []int{1, 1})
+	pads := n.attrInts("pads", []int{0, 0, 0, 0})
+	if len(strides) != 2 || len(dilations) != 2 || len(pads) != 4 {
+		return nil, errors.New("only 2D windows are supported")
+	}
+	w := &window{kh: kh, kw: kw, sh: strides[0], sw: strides[1], dh: dilations[0], dw: dilations[1]}
+	if w.sh <= 0 || w.sw <= 0 || w.dh <= 0 || w.dw <= 0 || kh <= 0 || kw <= 0 {
+		return nil, fmt.Errorf("invalid window: kernel %dx%d, strides %v, dilations %v", kh, kw, strides, dilations)
+	}
+	extentH, extentW := (kh-1)*w.dh+1, (kw-1)*w.dw+1
+
+	switch pad := n.attrString("auto_pad", "NOTSET"); pad {
+	case "NOTSET":
+	case "VALID":
+		pads = []int{0, 0, 0, 0}
+	case "SAME_UPPER", "SAME_LOWER":
+		padH := max((ceilDiv(height, w.sh)-1)*w.sh+extentH-height, 0)
+		padW := max((ceilDiv(width, w.sw)-1)*w.sw+extentW-width, 0)
+		if pad == "SAME_UPPER" {
+			pads = []int{padH / 2, padW / 2, padH - padH/2, padW - padW/2}
+		} else {
+			pads = []int{padH - padH/2, padW - padW/2, padH / 2, padW / 2}
+		}
+	default:
+		return nil, fmt.Errorf("auto_pad %s is not supported", pad)
+	}
+	w.top, w.left = pads[0], pads[1]
+
+	spanH := height + pads[0] + pads[2] - extentH
+	spanW := width + pads[1] + pads[3] - extentW
+	if spanH < 0 || spanW < 0 {
+		return nil, fmt.Errorf("kernel %dx%d is larger than the padded %dx%d input", kh, kw, height, width)
+	}
+	if ceil {
+		w.outH, w.outW = ceilDiv(spanH, w.sh)+1, ceilDiv(spanW, w.sw)+1
+		// The last window must start inside the input or its leading padding
+		if (w.outH-1)*w.sh >= height+pads[0] {
+			w.outH--
+		}
+		if (w.outW-1)*w.sw >= width+pads[1] {
+			w.outW--
+		}
+	} else {
+		w.outH, w.outW = spanH/w.sh+1, spanW/w.sw+1
+	}
+	return w, nil
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+func conv(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := arg(in, 0, Float)
+	if err != nil {
+		return nil, err
+	}
+	w, err := arg(in, 1, Float)
+	if err != nil {
+		return nil, err
+	}
+	b, err := optionalArg(in, 2, Float)
+	if err != nil {
+		return nil, err
+	}
+	if len(x.Shape) != 4 || len(w.Shape) != 4 {
+		return nil, errors.New("only 2D convolutions are supported")
+	}
+	batch, channels, height, width := x.Shape[0], x.Shape[1], x.Shape[2], x.Shape[3]
+	filters, groupChannels, kh, kw := w.Shape[0], w.Shape[1], w.Shape[2], w.Shape[3]
+	group := n.attrInt("group", 1)
+	if group <= 0 || channels != groupChannels*group || filters%group != 0 {
+		return nil, fmt.Errorf("weights of shape %v don't fit input of shape %v in %d groups", w.Shape, x.Shape, group)
+	}
+	if b != nil && b.Len() != filters {
+		return nil, fmt.Errorf("bias of shape %v doesn't fit %d filters", b.Shape, filters)
+	}
+	win, err := newWindow(n, height, width, kh, kw, false)
+	if err != nil {
+		return nil, err
+	}
+
+	plane, inPlane := win.outH*win.outW, height*width
+	out := make([]float32, batch*filters*plane)
+	perGroup := filters / group
+	parallel(batch*filters, func(i int) {
+		image, f := i/filters, i%filters
+		dst := out[i*plane : (i+1)*plane]
+		if b != nil {
+			for j := range dst {
+				dst[j] = b.Float[f]
+			}
+		}
+		first := image*channels + f/perGroup*groupChannels
+		for c := range groupChannels {
+			src := x.Float[(first+c)*inPlane : (first+c+1)*inPlane]
+			kernel := w.Float[(f*groupChannels+c)*kh*kw : (f*groupChannels+c+1)*kh*kw]
+			for ky := range kh {
+				for kx := range kw {
+					weight := kernel[ky*kw+kx]
+					if weight == 0 {
+						continue
+					}
+					for oy := range win.outH {
+						iy := oy*win.sh - win.top + ky*win.dh
+						if iy < 0 || iy >= height {
+							continue
+						}
+						row, dstRow := src[iy*width:(iy+1)*width], dst[oy*win.outW:(oy+1)*win.outW]
+						for ox := range win.outW {
+							if ix := ox*win.sw - win.left + kx*win.dw; ix >= 0 && ix < width {
+								dstRow[ox] += weight * row[ix]
+							}
+						}
+					}
+				}
+			}
+		}
+	})
+	return []*Tensor{NewFloat([]int{batch, filters, win.outH, win.outW}, out)}, nil
+}
+
+// pool returns MaxPool if isMax is set, otherwise AveragePool
+func pool(isMax bool) operator {
+	return func(n *Node, in []*Tensor) ([]*Tensor, error) {
+		x, err := arg(in, 0, Float)
+		if err != nil {
+			return nil, err
+		}
+		kernel := n.attrInts("kernel_shape", nil)
+		if len(x.Shape) != 4 || len(kernel) != 2 {
+			return nil, errors.New("only 2D pooling is supported")
+		}
+		if len(n.Outputs) > 1 && n.Outputs[1] != "" {
+			return nil, errors.New("indices are not supported")
+		}
+		batch, channels, height, width := x.Shape[0], x.Shape[1], x.Shape[2], x.Shape[3]
+		win, err := newWindow(n, height, width, kernel[0], kernel[1], n.attrInt("ceil_mode", 0) == 1)
+		if err != nil {
+			return nil, err
+		}
+		includePad := n.attrInt("count_include_pad", 0) == 1
+
+		plane, inPlane := win.outH*win.outW, height*width
+		out := make([]float32, batch*channels*plane)
+		parallel(batch*channels, func(i int) {
+			src, dst := x.Float[i*inPlane:(i+1)*inPlane], out[i*plane:(i+1)*plane]
+			for oy := range win.outH {
+				for ox := range win.outW {
+					best, sum, count := float32(math.Inf(-1)), float32(0), 0
+					for ky := range win.kh {
+						iy := oy*win.sh - win.top + ky*win.dh
+						for kx := range win.kw {
+							ix := ox*win.sw - win.left + kx*win.dw
+							if iy < 0 || iy >= height || ix < 0 || ix >= width {
+								if includePad {
+									count++
+								}
+								continue
+							}
+							v := src[iy*width+ix]
+							best = maxf(best, v)
+							sum += v
+							count++
+						}
+					}
+					if isMax {
+						dst[oy*win.outW+ox] = best
+					} else if count > 0 {
+						dst[oy*win.outW+ox] = sum / float32(count)
+					}
+				}
+			}
+		})
+		return []*Tensor{NewFloat([]int{batch, channels, win.outH, win.outW}, out)}, nil
+	}
+}
+
+func maxf(a, b float32) float32 {
+	if b > a {
+		return b
+	}
+	return a
+}
+
+func globalAveragePool(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := arg(in, 0, Float)
+	if err != nil {
+		return nil, err
+	}
+	if len(x.Shape) < 3 {
+		return nil, fmt.Errorf("input of shape %v has no spatial dimensions", x.Shape)
+	}
+	planes, plane := x.Shape[0]*x.Shape[1], size(x.Shape[2:])
+	out := make([]float32, planes)
+	for i := range out {
+		var sum float32
+		for _, v := range x.Float[i*plane : (i+1)*plane] {
+			sum += v
+		}
+		out[i] = sum / float32(plane)
+	}
+	shape := []int{x.Shape[0], x.Shape[1]}
+	for range x.Shape[2:] {
+		shape = append(shape, 1)
+	}
+	return []*Tensor{NewFloat(shape, out)}, nil
+}
+
+func batchNormalization(n *Node, in []*Tensor) ([]*Tensor, error) {
+	if len(n.Outputs) > 1 {
+		return nil, errors.New("training mode is not supported")
+	}
+	x, err := arg(in, 0, Float)
+	if err != nil {
+		return nil, err
+	}
+	if len(x.Shape) < 2 {
+		return nil, fmt.Errorf("input of shape %v has no channels", x.Shape)
+	}
+	channels := x.Shape[1]
+	var params [4][]float32 // Scale, bias, mean and variance
+	for i := range params {
+		p, err := arg(in, i+1, Float)
+		if err != nil {
+			return nil, err
+		}
+		if p.Len() != channels {
+			return nil, fmt.Errorf("input %d of shape %v doesn't fit %d channels", i+1, p.Shape, channels)
+		}
+		params[i] = p.Float
+	}
+	epsilon := float64(n.attrFloat("epsilon", 1e-5))
+
+	inner := size(x.Shape[2:])
+	out := make([]float32, len(x.Float))
+	for i := range x.Len() / inner {
+		c := i % channels
+		scale := params[0][c] / float32(math.Sqrt(float64(params[3][c])+epsilon))
+		shift := params[1][c] - params[2][c]*scale
+		for j := i * inner; j < (i+1)*inner; j++ {
+			out[j] = x.Float[j]*scale + shift
+		}
+	}
+	return []*Tensor{NewFloat(x.Shape, out)}, nil
+}
+
+func gemm(n *Node, in []*Tensor) ([]*Tensor, error) {
+	a, err := arg(in, 0, Float)
+	if err != nil {
+		return nil, err
+	}
+	b, err := arg(in, 1, Float)
+	if err != nil {
+		return nil, err
+	}
+	c, err := optionalArg(in, 2, Float)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.Shape) != 2 || len(b.Shape) != 2 {
+		return nil, fmt.Errorf("inputs of shapes %v and %v are not matrices", a.Shape, b.Shape)
+	}
+	transA, transB := n.attrInt("transA", 0) == 1, n.attrInt("transB", 0) == 1
+	m, k := a.Shape[0], a.Shape[1]
+	if transA {
+		m, k = k, m
+	}
+	kb, cols := b.Shape[0], b.Shape[1]
+	if transB {
+		kb, cols = cols, kb
+	}
+	if k != kb {
+		return nil, fmt.Errorf("inputs of shapes %v and %v don't multiply", a.Shape, b.Shape)
+	}
+
+	out := multiply(a.Float, b.Float, m, k, cols, transA, transB)
+	alpha, beta := n.attrFloat("alpha", 1), n.attrFloat("beta", 1)
+	shape := []int{m, cols}
+	if c == nil {
+		for i := range out {
+			out[i] *= alpha
+		}
+		return []*Tensor{NewFloat(shape, out)}, nil
+	}
+	if s, err := broadcastShape(shape, c.Shape); err != nil || !slices.Equal(s, shape) {
+		return nil, fmt.Errorf("input 2 of shape %v doesn't broadcast to %v", c.Shape, shape)
+	}
+	out = broadcast(shape, shape, c.Shape, out, c.Float, func(ab, c float32) float32 {
+		return alpha*ab + beta*c
+	})
+	return []*Tensor{NewFloat(shape, out)}, nil
+}
+
+// matMul multiplies matrices like numpy.matmul. The second input may be a
+// single matrix multiplying every matrix of the first, as for weights.
+func matMul(n *Node, in []*Tensor) ([]*Tensor, error) {
+	a, err := arg(in, 0, Float)
+	if err != nil {
+		return nil, err
+	}
+	b, err := arg(in, 1, Float)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.Shape) < 2 || len(b.Shape) < 2 {
+		return nil, errors.New("vector inputs are not supported")
+	}
+	m, k := a.Shape[len(a.Shape)-2], a.Shape[len(a.Shape)-1]
+	kb, cols := b.Shape[len(b.Shape)-2], b.Shape[len(b.Shape)-1]
+	batch := a.Shape[:len(a.Shape)-2]
+	if k != kb || len(b.Shape) > 2 && !slices.Equal(b.Shape[:len(b.Shape)-2], batch) {
+		return nil, fmt.Errorf("inputs of shapes %v and %v don't multiply", a.Shape, b.Shape)
+	}
+
+	out := make([]float32, 0, size(batch)*m*cols)
+	for i := range size(batch) {
+		bm := b.Float
+		if len(b.Shape) > 2 {
+			bm = b.Float[i*k*cols : (i+1)*k*cols]
+		}
+		out = append(out, multiply(a.Float[i*m*k:(i+1)*m*k], bm, m, k, cols, false, false)...)
+	}
+	return []*Tensor{NewFloat(append(slices.Clone(batch), m, cols), out)}, nil
+}
+
+// multiply returns the m by n product of an m by k matrix a and a k by n
+// matrix b, either stored transposed if its flag is set
+func multiply(a, b []float32, m, k, n int, transA, transB bool) []float32 {
+	out := make([]float32, m*n)
+	parallel(m, func(i int) {
+		row := out[i*n : (i+1)*n]
+		for p := range k {
+			av := a[i*k+p]
+			if transA {
+				av = a[p*m+i]
+			}
+			if av == 0 {
+				continue
+			}
+			if transB {
+				for j := range row {
+					row[j] += av * b[j*k+p]
+				}
+			} else {
+				for j, bv := range b[p*n : (p+1)*n] {
+					row[j] += av * bv
+				}
+			}
+		}
+	})
+	return out
+}
+
+func constant(n *Node, in []*Tensor) ([]*Tensor, error) {
+	switch v := n.Attrs["value"].(type) {
+	case *Tensor:
+		return []*Tensor{v}, nil
+	}
+	switch {
+	case n.Attrs["value_float"] != nil:
+		return []*Tensor{NewFloat([]int{}, []float32{n.attrFloat("value_float", 0)})}, nil
+	case n.Attrs["value_int"] != nil:
+		return []*Tensor{NewInt64([]int{}, []int64{int64(n.attrInt("value_int", 0))})}, nil
+	}
+	if v, ok := n.Attrs["value_floats"].([]float32); ok {
+		return []*Tensor{NewFloat([]int{len(v)}, v)}, nil
+	}
+	if v, ok := n.Attrs["value_ints"].([]int64); ok {
+		return []*Tensor{NewInt64([]int{len(v)}, v)}, nil
+	}
+	return nil, errors.New("no supported value")
+}
+
+func reshape(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := anyArg(in, 0)
+	if err != nil {
+		return nil, err
+	}
+	target, err := arg(in, 1, Int64)
+	if err != nil {
+		return nil, err
+	}
+	allowZero := n.attrInt("allowzero", 0) == 1
+
+	shape := make([]int, len(target.Int))
+	inferred, known := -1, 1
+	for i, d := range target.Int {
+		switch {
+		case d == -1:
+			if inferred >= 0 {
+				return nil, fmt.Errorf("shape %v infers more than one dimension", target.Int)
+			}
+			inferred = i
+			continue
+		case d == 0 && !allowZero:
+			if i >= len(x.Shape) {
+				return nil, fmt.Errorf("shape %v copies a dimension input of shape %v lacks", target.Int, x.Shape)
+			}
+			shape[i] = x.Shape[i]
+		case d < 0:
+			return nil, fmt.Errorf("invalid shape %v", target.Int)
+		default:
+			shape[i] = int(d)
+		}
+		known *= shape[i]
+	}
+	if inferred >= 0 && known > 0 {
+		shape[inferred] = x.Len() / known
+	}
+	if size(shape) != x.Len() {
+		return nil, fmt.Errorf("input of shape %v can't be reshaped to %v", x.Shape, target.Int)
+	}
+	return []*Tensor{x.reshaped(shape)}, nil
+}
+
+func flatten(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := anyArg(in, 0)
+	if err != nil {
+		return nil, err
+	}
+	a := n.attrInt("axis", 1)
+	if a != len(x.Shape) { // Flattening after the last axis is allowed
+		if a, err = axis(a, len(x.Shape)); err != nil {
+			return nil, err
+		}
+	}
+	return []*Tensor{x.reshaped([]int{size(x.Shape[:a]), size(x.Shape[a:])})}, nil
+}
+
+func squeeze(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := anyArg(in, 0)
+	if err != nil {
+		return nil, err
+	}
+	axes, err := axesOf(n, in)
+	if err != nil {
+		return nil, err
+	}
+	drop := make([]bool, len(x.Shape))
+	if axes == nil {
+		for i, d := range x.Shape {
+			drop[i] = d == 1
+		}
+	}
+	for _, a := range axes {
+		if a, err = axis(a, len(x.Shape)); err != nil {
+			return nil, err
+		}
+		if x.Shape[a] != 1 {
+			return nil, fmt.Errorf("dimension %d of shape %v is not 1", a, x.Shape)
+		}
+		drop[a] = true
+	}
+	shape := []int{}
+	for i, d := range x.Shape {
+		if !drop[i] {
+			shape = append(shape, d)
+		}
+	}
+	return []*Tensor{x.reshaped(shape)}, nil
+}
+
+func unsqueeze(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := anyArg(in, 0)
+	if err != nil {
+		return nil, err
+	}
+	axes, err := axesOf(n, in)
+	if err != nil {
+		return nil, err
+	}
+	rank := len(x.Shape) + len(axes)
+	insert := make([]bool, rank)
+	for _, a := range axes {
+		if a, err = axis(a, rank); err != nil {
+			return nil, err
+		}
+		if insert[a] {
+			return nil, fmt.Errorf("axes %v repeat an axis", axes)
+		}
+		insert[a] = true
+	}
+	shape, rest := make([]int, rank), x.Shape
+	for i := range shape {
+		if insert[i] {
+			shape[i] = 1
+		} else {
+			shape[i], rest = rest[0], rest[1:]
+		}
+	}
+	return []*Tensor{x.reshaped(shape)}, nil
+}
+
+// axesOf returns the axes of Squeeze or Unsqueeze, given as an attribute
+// before opset 13 and as the second input since
+func axesOf(n *Node, in []*Tensor) ([]int, error) {
+	if axes := n.attrInts("axes", nil); axes != nil {
+		return axes, nil
+	}
+	t, err := optionalArg(in, 1, Int64)
+	if err != nil || t == nil {
+		return nil, err
+	}
+	axes := make([]int, len(t.Int))
+	for i, a := range t.Int {
+		axes[i] = int(a)
+	}
+	return axes, nil
+}
+
+func transpose(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := anyArg(in, 0)
+	if err != nil {
+		return nil, err
+	}
+	rank := len(x.Shape)
+	perm := n.attrInts("perm", nil)
+	if perm == nil {
+		for i := range rank {
+			perm = append(perm, rank-1-i)
+		}
+	}
+	seen := make([]bool, rank)
+	for _, p := range perm {
+		if p < 0 || p >= rank || seen[p] {
+			return nil, fmt.Errorf("perm %v is not a permutation of %d axes", perm, rank)
+		}
+		seen[p] = true
+	}
+	if len(perm) != rank {
+		return nil, fmt.Errorf("perm %v is not a permutation of %d axes", perm, rank)
+	}
+
+	shape := make([]int, rank)
+	for i, p := range perm {
+		shape[i] = x.Shape[p]
+	}
+	if x.Type == Float {
+		return []*Tensor{NewFloat(shape, permute(x.Float, x.Shape, perm))}, nil
+	}
+	return []*Tensor{NewInt64(shape, permute(x.Int, x.Shape, perm))}, nil
+}
+
+// permute returns the elements of a tensor of shape with its axes permuted
+func permute[T any](data []T, shape, perm []int) []T {
+	strides := make([]int, len(shape))
+	stride := 1
+	for d := len(shape) - 1; d >= 0; d-- {
+		strides[d] = stride
+		stride *= shape[d]
+	}
+	outShape, outStrides := make([]int, len(perm)), make([]int, len(perm))
+	for i, p := range perm {
+		outShape[i], outStrides[i] = shape[p], strides[p]
+	}
+
+	out := make([]T, len(data))
+	index := make([]int, len(perm))
+	src := 0
+	for i := range out {
+		out[i] = data[src]
+		for d := len(perm) - 1; d >= 0; d-- {
+			index[d]++
+			src += outStrides[d]
+			if index[d] < outShape[d] {
+				break
+			}
+			src -= outStrides[d] * outShape[d]
+			index[d] = 0
+		}
+	}
+	return out
+}
+
+func concat(n *Node, in []*Tensor) ([]*Tensor, error) {
+	first, err := anyArg(in, 0)
+	if err != nil {
+		return nil, err
+	}
+	a, err := axis(n.attrInt("axis", 0), len(first.Shape))
+	if err != nil {
+		return nil, err
+	}
+	shape := slices.Clone(first.Shape)
+	shape[a] = 0
+	for i := range in {
+		t, err := arg(in, i, first.Type)
+		if err != nil {
+			return nil, err
+		}
+		if len(t.Shape) != len(shape) {
+			return nil, fmt.Errorf("shapes %v and %v differ in rank", first.Shape, t.Shape)
+		}
+		for d := range shape {
+			if d != a && t.Shape[d] != shape[d] {
+				return nil, fmt.Errorf("shapes %v and %v differ outside axis %d", first.Shape, t.Shape, a)
+			}
+		}
+		shape[a] += t.Shape[a]
+	}
+
+	outer, inner := size(shape[:a]), size(shape[a+1:])
+	if first.Type == Float {
+		return []*Tensor{NewFloat(shape, join(in, a, outer, inner, func(t *Tensor) []float32 { return t.Float }))}, nil
+	}
+	return []*Tensor{NewInt64(shape, join(in, a, outer, inner, func(t *Tensor) []int64 { return t.Int }))}, nil
+}
+
+// join concatenates the elements of tensors along axis a
+func join[T any](in []*Tensor, a, outer, inner int, data func(*Tensor) []T) []T {
+	var out []T
+	for o := range outer {
+		for _, t := range in {
+			chunk := t.Shape[a] * inner
+			out = append(out, data(t)[o*chunk:(o+1)*chunk]...)
+		}
+	}
+	return out
+}
+
+func shapeOf(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := anyArg(in, 0)
+	if err != nil {
+		return nil, err
+	}
+	rank := len(x.Shape)
+	start, end := n.attrInt("start", 0), n.attrInt("end", rank)
+	if start < 0 {
+		start += rank
+	}
+	if end < 0 {
+		end += rank
+	}
+	start, end = min(max(start, 0), rank), min(max(end, 0), rank)
+	dims := []int64{}
+	for _, d := range x.Shape[start:max(start, end)] {
+		dims = append(dims, int64(d))
+	}
+	return []*Tensor{NewInt64([]int{len(dims)}, dims)}, nil
+}
+
+func gather(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := anyArg(in, 0)
+	if err != nil {
+		return nil, err
+	}
+	indices, err := arg(in, 1, Int64)
+	if err != nil {
+		return nil, err
+	}
+	if len(x.Shape) == 0 {
+		return nil, errors.New("can't gather from a scalar")
+	}
+	a, err := axis(n.attrInt("axis", 0), len(x.Shape))
+	if err != nil {
+		return nil, err
+	}
+	dim := x.Shape[a]
+	picks := make([]int, len(indices.Int))
+	for i, index := range indices.Int {
+		if index < -int64(dim) || index >= int64(dim) {
+			return nil, fmt.Errorf("index %d out of range for dimension of %d", index, dim)
+		}
+		if index < 0 {
+			index += int64(dim)
+		}
+		picks[i] = int(index)
+	}
+
+	shape := slices.Concat(x.Shape[:a], indices.Shape, x.Shape[a+1:])
+	outer, inner := size(x.Shape[:a]), size(x.Shape[a+1:])
+	if x.Type == Float {
+		return []*Tensor{NewFloat(shape, pick(x.Float, picks, outer, dim, inner))}, nil
+	}
+	return []*Tensor{NewInt64(shape, pick(x.Int, picks, outer, dim, inner))}, nil
+}
+
+// pick gathers the slices at picks along an axis of size dim
+func pick[T any](data []T, picks []int, outer, dim, inner int) []T {
+	out := make([]T, 0, outer*len(picks)*inner)
+	for o := range outer {
+		for _, p := range picks {
+			start := (o*dim + p) * inner
+			out = append(out, data[start:start+inner]...)
+		}
+	}
+	return out
+}
+
+// resize implements Resize and its predecessor Upsample, scaling the last
+// two dimensions
+func resize(n *Node, in []*Tensor) ([]*Tensor, error) {
+	x, err := arg(in, 0, Float)
+	if err != nil {
+		return nil, err
+	}
+	rank := len(x.Shape)
+	if rank < 2 {
+		return nil, fmt.Errorf("input of shape %v has no spatial dimensions", x.Shape)
+	}
+
+	// Upsample and Resize before opset 11 take the scales second and map
+	// coordinates asymmetrically
+	legacy := n.Op == "Upsample" || len(in) == 2
+	coordinates := n.attrString("coordinate_transformation_mode", "half_pixel")
+	scalesAt := 2
+	if legacy {
+		coordinates, scalesAt = "asymmetric", 1
+	}
+	scales, err := optionalArg(in, scalesAt, Float)
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := optionalArg(in, 3, Int64)
+	if err != nil {
+		return nil, err
+	}
+
+	shape := make([]int, rank)
+	factors := make([]float64, rank)
+	switch {
+	case sizes != nil && sizes.Len() == rank:
+		for i := range shape {
+			shape[i] = int(sizes.Int[i])
+			factors[i] = float64(shape[i]) / float64(x.Shape[i])
+		}
+	case scales != nil && scales.Len() == rank:
+		for i := range shape {
+			factors[i] = float64(scales.Float[i])
+			shape[i] = int(math.Floor(float64(x.Shape[i]) * factors[i]))
+		}
+	default:
+		return nil, errors.New("neither scales nor sizes fit the input")
+	}
+	if !slices.Equal(shape[:rank-2], x.Shape[:rank-2]) {
+		return nil, errors.New("only the last two dimensions can be resized")
+	}
+
+	mode := n.attrString("mode", "nearest")
+	nearest := n.attrString("nearest_mode", "round_prefer_floor")
+	var rows, cols []sample
+	for i, dst := range []*[]sample{&rows, &cols} {
+		d := rank - 2 + i
+		if *dst, err = samples(x.Shape[d], shape[d], factors[d], mode, coordinates, nearest); err != nil {
+			return nil, err
+		}
+	}
+
+	inH, inW, outH, outW := x.Shape[rank-2], x.Shape[rank-1], shape[rank-2], shape[rank-1]
+	out := make([]float32, size(shape))
+	for p := range size(shape[:rank-2]) {
+		src, dst := x.Float[p*inH*inW:(p+1)*inH*inW], out[p*outH*outW:(p+1)*outH*outW]
+		for oy, r := range rows {
+			for ox, c := range cols {
+				top := src[r.lo*inW+c.lo]*(1-c.w) + src[r.lo*inW+c.hi]*c.w
+				bottom := src[r.hi*inW+c.lo]*(1-c.w) + src[r.hi*inW+c.hi]*c.w
+				dst[oy*outW+ox] = top*(1-r.w) + bottom*r.w
+			}
+		}
+	}
+	return []*Tensor{NewFloat(shape, out)}, nil
+}
+
+// sample is where an output coordinate of Resize reads from: lo and hi,
+// weighted by 1-w and w
+type sample struct {
+	lo, hi int
+	w      float32
+}
+
+// samples maps the coordinates of an axis resized from in to out
+func samples(in, out int, scale float64, mode, coordinates, nearest string) ([]sample, error) {
+	s := make([]sample, out)
+	for o := range s {
+		var x float64
+		switch coordinates {
+		case "half_pixel":
+			x = (float64(o)+0.5)/scale - 0.5
+		case "pytorch_half_pixel":
+			if out > 1 {
+				x = (float64(o)+0.5)/scale - 0.5
+			}
+		case "asymmetric":
+			x = float64(o) / scale
+		case "align_corners":
+			if out > 1 {
+				x = float64(o) * float64(in-1) / float64(out-1)
+			}
+		case "tf_half_pixel_for_nn":
+			x = (float64(o) + 0.5) / scale
+		default:
+			return nil, fmt.Errorf("coordinate_transformation_mode %s is not supported", coordinates)
+		}
+
+		switch mode {
+		case "nearest":
+			var i float64
+			switch nearest {
+			case "round_prefer_floor":
+				i = math.Ceil(x - 0.5)
+			case "round_prefer_ceil":
+				i = math.Floor(x + 0.5)
+			case "floor":
+				i = math.Floor(x)
+			case "ceil":
+				i = math.Ceil(x)
+			default:
+				return nil, fmt.Errorf("nearest_mode %s is not supported", nearest)
+			}
+			i = min(max(i, 0), float64(in-1))
+			s[o] = sample{lo: int(i), hi: int(i)}
+		case "linear":
+			x = min(max(x, 0), float64(in-1))
+			lo := int(x)
+			s[o] = sample{lo: lo, hi: min(lo+1, in-1), w: float32(x - float64(lo))}
+		default:
+			return nil, fmt.Errorf("mode %s is not supported", mode)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,541 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of onnx.proto are decoded by hand, as only a few of their
+// fields matter here. Field numbers are those of the ONNX IR.
+
+// field is a decoded protobuf field
+type field struct {
+	num   protowire.Number
+	typ   protowire.Type
+	bytes []byte // Length delimited value
+	value uint64 // Varint or fixed size value
+}
+
+// walk calls fn with each field of the message in b
+func walk(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.value = uint64(v)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ints appends the integers of a repeated field, packed or not
+func (f field) ints(dst []int64) ([]int64, error) {
+	if f.typ != protowire.BytesType {
+		return append(dst, int64(f.value)), nil
+	}
+	for b := f.bytes; len(b) > 0; {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		dst = append(dst, int64(v))
+		b = b[n:]
+	}
+	return dst, nil
+}
+
+// floats appends the floats of a repeated field, packed or not
+func (f field) floats(dst []float32) ([]float32, error) {
+	if f.typ != protowire.BytesType {
+		return append(dst, math.Float32frombits(uint32(f.value))), nil
+	}
+	if len(f.bytes)%4 != 0 {
+		return nil, errors.New("truncated floats")
+	}
+	for b := f.bytes; len(b) > 0; b = b[4:] {
+		dst = append(dst, math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	return dst, nil
+}
+
+func decodeModel(b []byte) (*Model, error) {
+	m := &Model{Initializers: make(map[string]*Tensor)}
+	var graph []byte
+	err := walk(b, func(f field) error {
+		switch f.num {
+		case 7: // graph
+			graph = f.bytes
+		case 8: // opset_import
+			var domain string
+			var version int64
+			err := walk(f.bytes, func(f field) error {
+				switch f.num {
+				case 1:
+					domain = string(f.bytes)
+				case 2:
+					version = int64(f.value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if domain == "" || domain == "ai.onnx" {
+				m.Opset = version
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if graph == nil {
+		return nil, errors.New("model has no graph")
+	}
+
+	err = walk(graph, func(f field) error {
+		switch f.num {
+		case 1: // node
+			n, err := decodeNode(f.bytes)
+			if err != nil {
+				return err
+			}
+			m.Nodes = append(m.Nodes, *n)
+		case 5: // initializer
+			name, t, err := decodeTensor(f.bytes)
+			if err != nil {
+				return fmt.Errorf("initializer %q: %w", name, err)
+			}
+			m.Initializers[name] = t
+		case 11, 12: // input, output
+			v, err := decodeValueInfo(f.bytes)
+			if err != nil {
+				return err
+			}
+			if f.num == 11 {
+				m.Inputs = append(m.Inputs, v)
+			} else {
+				m.Outputs = append(m.Outputs, v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func decodeNode(b []byte) (*Node, error) {
+	n := &Node{Attrs: make(map[string]any)}
+	var domain string
+	err := walk(b, func(f field) error {
+		switch f.num {
+		case 1:
+			n.Inputs = append(n.Inputs, string(f.bytes))
+		case 2:
+			n.Outputs = append(n.Outputs, string(f.bytes))
+		case 3:
+			n.Name = string(f.bytes)
+		case 4:
+			n.Op = string(f.bytes)
+		case 5:
+			name, value, err := decodeAttribute(f.bytes)
+			if err != nil {
+				return fmt.Errorf("attribute %q: %w", name, err)
+			}
+			n.Attrs[name] = value
+		case 7:
+			domain = string(f.bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("node %q: %w", n.Name, err)
+	}
+	if domain != "" && domain != "ai.onnx" {
+		return nil, fmt.Errorf("node %q: operator %s of domain %s is not supported", n.Name, n.Op, domain)
+	}
+	return n, nil
+}
+
+// Attribute types
+const (
+	attrFloat   = 1
+	attrInt     = 2
+	attrString  = 3
+	attrTensor  = 4
+	attrFloats  = 6
+	attrInts    = 7
+	attrUnknown = 0
+)
+
+func decodeAttribute(b []byte) (string, any, error) {
+	var (
+		name   string
+		typ    int
+		seen   int // Type of the last value field, for models not setting typ
+		f32    float32
+		i64    int64
+		str    string
+		tensor *Tensor
+		floats []float32
+		ints   []int64
+	)
+	err := walk(b, func(f field) error {
+		var err error
+		switch f.num {
+		case 1:
+			name = string(f.bytes)
+		case 2:
+			f32, seen = math.Float32frombits(uint32(f.value)), attrFloat
+		case 3:
+			i64, seen = int64(f.value), attrInt
+		case 4:
+			str, seen = string(f.bytes), attrString
+		case 5:
+			_, tensor, err = decodeTensor(f.bytes)
+			seen = attrTensor
+		case 7:
+			floats, err = f.floats(floats)
+			seen = attrFloats
+		case 8:
+			ints, err = f.ints(ints)
+			seen = attrInts
+		case 20:
+			typ = int(f.value)
+		}
+		return err
+	})
+	if err != nil {
+		return name, nil, err
+	}
+	if typ == attrUnknown {
+		typ = seen
+	}
+
+	switch typ {
+	case attrFloat:
+		return name, f32, nil
+	case attrInt:
+		return name, i64, nil
+	case attrString:
+		return name, str, nil
+	case attrTensor:
+		return name, tensor, nil
+	case attrFloats:
+		return name, floats, nil
+	case attrInts:
+		return name, ints, nil
+	}
+	return name, nil, fmt.Errorf("attribute type %d is not supported", typ)
+}
+
+// Tensor element types
+const (
+	typeFloat = 1
+	typeInt32 = 6
+	typeInt64 = 7
+)
+
+func decodeTensor(b []byte) (string, *Tensor, error) {
+	var (
+		name     string
+		dims     []int64
+		dataType int
+		floats   []float32
+		ints     []int64
+		raw      []byte
+		external bool
+	)
+	err := walk(b, func(f field) error {
+		var err error
+		switch f.num {
+		case 1:
+			dims, err = f.ints(dims)
+		case 2:
+			dataType = int(f.value)
+		case 4:
+			floats, err = f.floats(floats)
+		case 5, 7: // int32_data, int64_data
+			ints, err = f.ints(ints)
+		case 8:
+			name = string(f.bytes)
+		case 9:
+			raw = f.bytes
+		case 14:
+			external = f.value == 1
+		}
+		return err
+	})
+	if err != nil {
+		return name, nil, err
+	}
+	if external {
+		return name, nil, errors.New("tensors stored outside the model are not supported")
+	}
+
+	shape := make([]int, len(dims))
+	for i, d := range dims {
+		if d < 0 {
+			return name, nil, fmt.Errorf("invalid dimensions %v", dims)
+		}
+		shape[i] = int(d)
+	}
+	n := size(shape)
+
+	var t *Tensor
+	switch dataType {
+	case typeFloat:
+		if raw != nil {
+			floats, err = field{typ: protowire.BytesType, bytes: raw}.floats(nil)
+			if err != nil {
+				return name, nil, err
+			}
+		}
+		t = NewFloat(shape, floats)
+	case typeInt64:
+		if raw != nil {
+			if len(raw)%8 != 0 {
+				return name, nil, errors.New("truncated int64 data")
+			}
+			ints = make([]int64, 0, len(raw)/8)
+			for ; len(raw) > 0; raw = raw[8:] {
+				ints = append(ints, int64(binary.LittleEndian.Uint64(raw)))
+			}
+		}
+		t = NewInt64(shape, ints)
+	case typeInt32:
+		if raw != nil {
+			if len(raw)%4 != 0 {
+				return name, nil, errors.New("truncated int32 data")
+			}
+			ints = make([]int64, 0, len(raw)/4)
+			for ; len(raw) > 0; raw = raw[4:] {
+				ints = append(ints, int64(int32(binary.LittleEndian.Uint32(raw))))
+			}
+		}
+		for i, v := range ints {
+			ints[i] = int64(int32(v)) // Varints of negative int32 are sign extended
+		}
+		t = NewInt64(shape, ints)
+	default:
+		return name, nil, fmt.Errorf("data type %d is not supported", dataType)
+	}
+	if len(t.Float)+len(t.Int) != n {
+		return name, nil, fmt.Errorf("%d elements for shape %v", len(t.Float)+len(t.Int), shape)
+	}
+	return name, t, nil
+}
+
+func decodeValueInfo(b []byte) (ValueInfo, error) {
+	var v ValueInfo
+	err := walk(b, func(f field) error {
+		switch f.num {
+		case 1:
+			v.Name = string(f.bytes)
+		case 2: // type
+			return walk(f.bytes, func(f field) error {
+				if f.num != 1 { // tensor_type
+					return nil
+				}
+				return walk(f.bytes, func(f field) error {
+					switch f.num {
+					case 1:
+						v.Type = DataType(f.value)
+						if v.Type == typeInt32 {
+							v.Type = Int64
+						}
+					case 2: // shape
+						return walk(f.bytes, func(f field) error {
+							if f.num != 1 {
+								return nil
+							}
+							dim := -1
+							err := walk(f.bytes, func(f field) error {
+								if f.num == 1 {
+									dim = int(f.value)
+								}
+								return nil
+							})
+							v.Shape = append(v.Shape, dim)
+							return err
+						})
+					}
+					return nil
+				})
+			})
+		}
+		return nil
+	})
+	return v, err
+}
+
+// Marshal encodes the model in the ONNX protobuf format
+func (m *Model) Marshal() ([]byte, error) {
+	var graph []byte
+	for _, n := range m.Nodes {
+		node, err := encodeNode(&n)
+		if err != nil {
+			return nil, fmt.Errorf("node %q: %w", n.Name, err)
+		}
+		graph = appendBytes(graph, 1, node)
+	}
+	graph = appendBytes(graph, 2, []byte("main"))
+	for _, name := range slices.Sorted(maps.Keys(m.Initializers)) {
+		tensor, err := encodeTensor(name, m.Initializers[name])
+		if err != nil {
+			return nil, fmt.Errorf("initializer %q: %w", name, err)
+		}
+		graph = appendBytes(graph, 5, tensor)
+	}
+	for _, in := range m.Inputs {
+		graph = appendBytes(graph, 11, encodeValueInfo(in))
+	}
+	for _, out := range m.Outputs {
+		graph = appendBytes(graph, 12, encodeValueInfo(out))
+	}
+
+	var b []byte
+	b = appendVarint(b, 1, 8) // ir_version
+	b = appendBytes(b, 2, []byte("vws-backend"))
+	b = appendBytes(b, 7, graph)
+	b = appendBytes(b, 8, appendVarint(nil, 2, uint64(m.Opset)))
+	return b, nil
+}
+
+func encodeNode(n *Node) ([]byte, error) {
+	var b []byte
+	for _, in := range n.Inputs {
+		b = appendBytes(b, 1, []byte(in))
+	}
+	for _, out := range n.Outputs {
+		b = appendBytes(b, 2, []byte(out))
+	}
+	if n.Name != "" {
+		b = appendBytes(b, 3, []byte(n.Name))
+	}
+	b = appendBytes(b, 4, []byte(n.Op))
+	for _, name := range slices.Sorted(maps.Keys(n.Attrs)) {
+		attr := appendBytes(nil, 1, []byte(name))
+		switch v := n.Attrs[name].(type) {
+		case float32:
+			attr = protowire.AppendTag(attr, 2, protowire.Fixed32Type)
+			attr = protowire.AppendFixed32(attr, math.Float32bits(v))
+			attr = appendVarint(attr, 20, attrFloat)
+		case int64:
+			attr = appendVarint(attr, 3, uint64(v))
+			attr = appendVarint(attr, 20, attrInt)
+		case string:
+			attr = appendBytes(attr, 4, []byte(v))
+			attr = appendVarint(attr, 20, attrString)
+		case *Tensor:
+			tensor, err := encodeTensor("", v)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %q: %w", name, err)
+			}
+			attr = appendBytes(attr, 5, tensor)
+			attr = appendVarint(attr, 20, attrTensor)
+		case []float32:
+			for _, f := range v {
+				attr = protowire.AppendTag(attr, 7, protowire.Fixed32Type)
+				attr = protowire.AppendFixed32(attr, math.Float32bits(f))
+			}
+			attr = appendVarint(attr, 20, attrFloats)
+		case []int64:
+			for _, i := range v {
+				attr = appendVarint(attr, 8, uint64(i))
+			}
+			attr = appendVarint(attr, 20, attrInts)
+		default:
+			return nil, fmt.Errorf("attribute %q: values of type %T are not supported", name, v)
+		}
+		b = appendBytes(b, 5, attr)
+	}
+	return b, nil
+}
+
+func encodeTensor(name string, t *Tensor) ([]byte, error) {
+	var b, raw []byte
+	for _, d := range t.Shape {
+		b = appendVarint(b, 1, uint64(d))
+	}
+	switch t.Type {
+	case Float:
+		if len(t.Float) != t.Len() {
+			return nil, fmt.Errorf("%d elements for shape %v", len(t.Float), t.Shape)
+		}
+		for _, f := range t.Float {
+			raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(f))
+		}
+	case Int64:
+		if len(t.Int) != t.Len() {
+			return nil, fmt.Errorf("%d elements for shape %v", len(t.Int), t.Shape)
+		}
+		for _, i := range t.Int {
+			raw = binary.LittleEndian.AppendUint64(raw, uint64(i))
+		}
+	default:
+		return nil, fmt.Errorf("%s tensors are not supported", t.Type)
+	}
+	b = appendVarint(b, 2, uint64(t.Type))
+	if name != "" {
+		b = appendBytes(b, 8, []byte(name))
+	}
+	return appendBytes(b, 9, raw), nil
+}
+
+func encodeValueInfo(v ValueInfo) []byte {
+	var shape []byte
+	for i, d := range v.Shape {
+		if d >= 0 {
+			shape = appendBytes(shape, 1, appendVarint(nil, 1, uint64(d)))
+		} else {
+			shape = appendBytes(shape, 1, appendBytes(nil, 2, fmt.Appendf(nil, "%s_%d", v.Name, i)))
+		}
+	}
+	tensorType := appendVarint(nil, 1, uint64(v.Type))
+	tensorType = appendBytes(tensorType, 2, shape)
+
+	b := appendBytes(nil, 1, []byte(v.Name))
+	return appendBytes(b, 2, appendBytes(nil, 1, tensorType))
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
@@ -0,0 +1,180 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Validate checks requests and responses of documented routes against the
+// document. Requests that don't match are answered with 400 or 415 before
+// reaching the handler. Responses have been sent by the time they are
+// checked, so mismatches are passed to report instead. It buffers every
+// body and is meant for development and tests.
+//
+// It must be added to the router before the routes it checks.
+func (s *Spec) Validate(report func(c *gin.Context, err error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op, ok := s.ops[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if status, err := s.validateRequest(op, c); err != nil {
+			code := "invalid_request"
+			if status == http.StatusUnsupportedMediaType {
+				code = "unsupported_media_type"
+			}
+			// The request ID is set by the logging middleware, if any
+			c.AbortWithStatusJSON(status, Error{Error: err.Error(), Code: code, RequestID: c.Writer.Header().Get("X-Request-ID")})
+			return
+		}
+
+		rec := &recorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		c.Next()
+
+		if err := s.validateResponse(op, rec.Status(), rec.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+			report(c, fmt.Errorf("%s %s responded %d: %w", c.Request.Method, c.FullPath(), rec.Status(), err))
+		}
+	}
+}
+
+// validateRequest checks the parameters and body of a request, returning
+// the status to reject it with
+func (s *Spec) validateRequest(op *Operation, c *gin.Context) (int, error) {
+	v := &validator{schemas: s.doc.Components.Schemas}
+	for _, p := range op.Parameters {
+		var (
+			raw     string
+			present bool
+		)
+		if p.In == InPath {
+			raw, present = c.Params.Get(p.Name)
+		} else {
+			raw, present = c.GetQuery(p.Name)
+		}
+		if !present {
+			if p.Required {
+				v.fail(p.In+" parameter "+p.Name, "is required")
+			}
+			continue
+		}
+		v.validate(p.Schema, parseParam(p.Schema.Type, raw), p.In+" parameter "+p.Name)
+	}
+	if err := v.err(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if op.RequestBody == nil {
+		return 0, nil
+	}
+	contentType := c.ContentType()
+	if _, ok := op.RequestBody.Content[gin.MIMEJSON]; ok && contentType == "" {
+		contentType = gin.MIMEJSON
+	}
+	media, ok := op.RequestBody.Content[contentType]
+	if !ok {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("content type %q is not accepted", contentType)
+	}
+	if contentType != gin.MIMEJSON {
+		return 0, nil
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err := s.validateJSON(media.Schema, body, "request body"); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
+
+// validateResponse checks a response against the one documented for its
+// status
+func (s *Spec) validateResponse(op *Operation, status int, contentType string, body []byte) error {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok && status >= http.StatusBadRequest {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return errors.New("status is not documented")
+	}
+
+	if len(resp.Content) == 0 {
+		if len(body) > 0 {
+			return errors.New("body should be empty")
+		}
+		return nil
+	}
+	if len(body) == 0 {
+		return errors.New("body is empty")
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	media, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("content type %q is not documented", contentType)
+	}
+	if mediaType != gin.MIMEJSON {
+		return nil
+	}
+	return s.validateJSON(media.Schema, body, "response body")
+}
+
+func (s *Spec) validateJSON(schema *Schema, body []byte, name string) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("%s is not JSON: %w", name, err)
+	}
+
+	v := &validator{schemas: s.doc.Components.Schemas}
+	v.validate(schema, value, "$")
+	if err := v.err(); err != nil {
+		return fmt.Errorf("%s does not match the schema: %w", name, err)
+	}
+	return nil
+}
+
+// parseParam converts a parameter to the JSON value its schema expects,
+// leaving it a string when it doesn't parse so validation reports it
+func parseParam(typ, raw string) any {
+	switch typ {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return json.Number(raw)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
+
+// recorder keeps a copy of the body written through it
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
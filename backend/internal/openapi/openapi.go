@@ -0,0 +1,386 @@
+// Package openapi describes the HTTP API as an OpenAPI 3 document. The
+// document is built from the routes registered on a gin engine and the
+// types their handlers bind and respond with, so it can't drift from the
+// handlers, and traffic can be validated against it.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version of the OpenAPI specification documents follow
+const Version = "3.0.3"
+
+// ErrUndocumented is returned by Build when the registered routes and the
+// documented ones differ
+var ErrUndocumented = errors.New("routes and their documentation differ")
+
+// Locations of parameters
+const (
+	InPath  = "path"
+	InQuery = "query"
+)
+
+// Route documents the routes a handler serves. The method and path come
+// from the routes the handler is registered on.
+type Route struct {
+	Handler   gin.HandlerFunc
+	ID        string // Names the operation, by default after the handler
+	Summary   string
+	Params    []Param   // Path parameters not listed are strings
+	Body      any       // Value of the type bound from a JSON body
+	Form      any       // Value of the type bound from a multipart form
+	Responses Responses // Statuses the handler itself answers with
+}
+
+// Param documents a path or query parameter
+type Param struct {
+	Name     string
+	In       string // InPath or InQuery
+	Type     string // JSON schema type, string if empty
+	Format   string // e.g. "date"
+	Required bool   // Path parameters always are
+}
+
+// Responses maps the statuses a route answers with to a value of the type
+// written as the body. A nil value documents an empty body. Error statuses
+// left out, such as those of middleware, are documented as Error.
+type Responses map[int]any
+
+// Error is the body of error responses
+type Error struct {
+	Error     string            `json:"error"` // Message for people
+	Code      string            `json:"code"`  // Stable identifier for programs
+	Details   map[string]string `json:"details,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// Text documents a plain text body
+type Text struct{}
+
+// Document is an OpenAPI document, limited to what the API uses
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem maps lower case HTTP methods to the operations of a path
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Schema is a JSON schema as OpenAPI 3.0 extends it. An empty schema
+// matches any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"` // false or a *Schema
+	Items                *Schema            `json:"items,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     bool               `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// Spec builds the document for a router and validates traffic against it
+type Spec struct {
+	info Info
+	doc  *Document
+	ops  map[string]*Operation // By method and gin route, e.g. "GET /api/users/:id"
+}
+
+func New(info Info) *Spec {
+	return &Spec{info: info}
+}
+
+// Document returns the document Build produced
+func (s *Spec) Document() *Document {
+	return s.doc
+}
+
+// Serve writes the document
+func (s *Spec) Serve(c *gin.Context) {
+	c.JSON(http.StatusOK, s.doc)
+}
+
+// Routes documents the route serving the document
+func (s *Spec) Routes() []Route {
+	return []Route{
+		{Handler: s.Serve, ID: "openAPI", Summary: "OpenAPI document of this API", Responses: Responses{http.StatusOK: map[string]any{}}},
+	}
+}
+
+// Build documents every registered route. Each must be served by a handler
+// one of routes documents, and every documented handler must be registered.
+// It must be called before the router serves requests.
+func (s *Spec) Build(registered gin.RoutesInfo, routes ...Route) error {
+	byHandler := make(map[string]*Route, len(routes))
+	for i := range routes {
+		byHandler[handlerName(routes[i].Handler)] = &routes[i]
+	}
+
+	g := newGenerator()
+	// Responses are described first so that when two packages share a
+	// name, the types clients read get the short component names
+	for _, route := range routes {
+		for _, body := range route.Responses {
+			if t := reflect.TypeOf(body); t != nil && t != reflect.TypeOf(Text{}) {
+				g.schema(t, response) // Errors are reported with the operation
+			}
+		}
+	}
+	doc := &Document{
+		OpenAPI:    Version,
+		Info:       s.info,
+		Paths:      make(map[string]PathItem),
+		Components: Components{Schemas: g.schemas},
+	}
+	ops := make(map[string]*Operation, len(registered))
+	used := make(map[string]bool, len(routes))
+	ids := make(map[string]string, len(routes)) // Handlers by operation ID
+	var problems []string
+	for _, r := range registered {
+		route, ok := byHandler[r.Handler]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s %s is not documented", r.Method, r.Path))
+			continue
+		}
+
+		template, pathParams := convertPath(r.Path)
+		op, err := g.operation(route, template, pathParams)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s %s: %v", r.Method, r.Path, err))
+			continue
+		}
+		// A handler registered on several paths is named where it is first
+		if !used[r.Handler] {
+			op.OperationID = operationID(route)
+			if other, ok := ids[op.OperationID]; ok && op.OperationID != "" {
+				problems = append(problems, fmt.Sprintf("%s and %s are both operation %q", other, r.Handler, op.OperationID))
+			}
+			ids[op.OperationID] = r.Handler
+		}
+		used[r.Handler] = true
+		if doc.Paths[template] == nil {
+			doc.Paths[template] = make(PathItem)
+		}
+		doc.Paths[template][strings.ToLower(r.Method)] = op
+		ops[r.Method+" "+r.Path] = op
+	}
+	for name := range byHandler {
+		if !used[name] {
+			problems = append(problems, fmt.Sprintf("%s is documented but not registered", name))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%w:\n  %s", ErrUndocumented, strings.Join(problems, "\n  "))
+	}
+
+	s.doc, s.ops = doc, ops
+	return nil
+}
+
+// handlerName names a handler the way gin does in RoutesInfo
+func handlerName(h gin.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+}
+
+// operationID is the ID of the route, or the name of its handler method in
+// lower camel case. Function literals are left unnamed.
+func operationID(route *Route) string {
+	if route.ID != "" {
+		return route.ID
+	}
+	name := handlerName(route.Handler)
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+	if strings.HasPrefix(name, "func") {
+		return ""
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// convertPath turns a gin route into an OpenAPI path template and returns
+// the names of its parameters
+func convertPath(route string) (string, []string) {
+	segments := strings.Split(route, "/")
+	var params []string
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// tag groups operations by the first segment below /api, e.g. "tokens"
+func tag(template string) []string {
+	rest, ok := strings.CutPrefix(template, "/api/")
+	if !ok {
+		return nil
+	}
+	first, _, _ := strings.Cut(rest, "/")
+	return []string{strings.TrimSuffix(first, path.Ext(first))}
+}
+
+func (g *generator) operation(route *Route, template string, pathParams []string) (*Operation, error) {
+	op := &Operation{
+		Summary:   route.Summary,
+		Tags:      tag(template),
+		Responses: make(map[string]*Response),
+	}
+
+	declared := make(map[string]Param, len(route.Params))
+	for _, p := range route.Params {
+		declared[p.In+" "+p.Name] = p
+	}
+	for _, name := range pathParams {
+		p, ok := declared[InPath+" "+name]
+		if !ok {
+			p = Param{Name: name, In: InPath}
+		}
+		delete(declared, InPath+" "+name)
+		op.Parameters = append(op.Parameters, p.parameter())
+	}
+	for _, p := range route.Params {
+		if p.In == InPath {
+			if _, ok := declared[InPath+" "+p.Name]; ok {
+				return nil, fmt.Errorf("path parameter %q is not in the path", p.Name)
+			}
+			continue
+		}
+		op.Parameters = append(op.Parameters, p.parameter())
+	}
+
+	var err error
+	switch {
+	case route.Body != nil:
+		op.RequestBody, err = g.requestBody(gin.MIMEJSON, route.Body)
+	case route.Form != nil:
+		op.RequestBody, err = g.requestBody(gin.MIMEMultipartPOSTForm, route.Form)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for status, body := range route.Responses {
+		if op.Responses[strconv.Itoa(status)], err = g.response(status, body); err != nil {
+			return nil, err
+		}
+	}
+	if op.Responses["default"], err = g.response(0, Error{}); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p Param) parameter() *Parameter {
+	typ := p.Type
+	if typ == "" {
+		typ = "string"
+	}
+	return &Parameter{
+		Name:     p.Name,
+		In:       p.In,
+		Required: p.Required || p.In == InPath,
+		Schema:   &Schema{Type: typ, Format: p.Format},
+	}
+}
+
+func (g *generator) requestBody(contentType string, v any) (*RequestBody, error) {
+	var (
+		schema *Schema
+		err    error
+	)
+	if contentType == gin.MIMEMultipartPOSTForm {
+		schema, err = g.form(reflect.TypeOf(v))
+	} else {
+		schema, err = g.schema(reflect.TypeOf(v), request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &RequestBody{Required: true, Content: map[string]MediaType{contentType: {Schema: schema}}}, nil
+}
+
+func (g *generator) response(status int, body any) (*Response, error) {
+	resp := &Response{Description: http.StatusText(status)}
+	if status == 0 {
+		resp.Description = "Error"
+	}
+	switch body.(type) {
+	case nil:
+		return resp, nil
+	case Text:
+		resp.Content = map[string]MediaType{gin.MIMEPlain: {Schema: &Schema{Type: "string"}}}
+		return resp, nil
+	}
+
+	schema, err := g.schema(reflect.TypeOf(body), response)
+	if err != nil {
+		return nil, err
+	}
+	resp.Content = map[string]MediaType{gin.MIMEJSON: {Schema: schema}}
+	return resp, nil
+}
@@ -0,0 +1,215 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/openapi"
+)
+
+type widget struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Tags    []string  `json:"tags"`
+	Parent  *widget   `json:"parent,omitempty"`
+	Created time.Time `json:"created_at"`
+	secret  string
+}
+
+type createWidgetRequest struct {
+	Name  string  `json:"name" binding:"required,min=3"`
+	Email string  `json:"email" binding:"omitempty,email"`
+	Price float64 `json:"price" binding:"required,gt=0"`
+	Kind  string  `json:"kind" binding:"oneof=small large"`
+}
+
+// widgets serves a route whose response is whatever the test sets
+type widgets struct {
+	status int
+	body   any
+}
+
+func (w *widgets) create(c *gin.Context) {
+	c.JSON(w.status, w.body)
+}
+
+func (w *widgets) get(c *gin.Context) {
+	c.JSON(w.status, w.body)
+}
+
+func (w *widgets) routes() []openapi.Route {
+	return []openapi.Route{
+		{Handler: w.create, Summary: "Create a widget", Body: createWidgetRequest{},
+			Responses: openapi.Responses{http.StatusCreated: widget{}, http.StatusBadRequest: openapi.Error{}}},
+		{Handler: w.get, Summary: "Fetch a widget",
+			Params: []openapi.Param{
+				{Name: "id", In: openapi.InPath, Type: "integer"},
+				{Name: "expand", In: openapi.InQuery, Type: "boolean"},
+			},
+			Responses: openapi.Responses{http.StatusOK: widget{}}},
+	}
+}
+
+// newRouter serves widgets through the validator, collecting what it reports
+func newRouter(t *testing.T, w *widgets) (*gin.Engine, *openapi.Spec, *[]error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var reported []error
+	spec := openapi.New(openapi.Info{Title: "Widgets", Version: "1"})
+	router := gin.New()
+	router.Use(spec.Validate(func(c *gin.Context, err error) {
+		reported = append(reported, err)
+	}))
+	router.POST("/api/widgets", w.create)
+	router.GET("/api/widgets/:id", w.get)
+	router.GET("/api/openapi.json", spec.Serve)
+	require.NoError(t, spec.Build(router.Routes(), append(w.routes(), spec.Routes()...)...))
+	return router, spec, &reported
+}
+
+func serve(router *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBuild_Document(t *testing.T) {
+	_, spec, _ := newRouter(t, &widgets{})
+	doc := spec.Document()
+
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+	require.Contains(t, doc.Paths, "/api/widgets/{id}")
+	get := doc.Paths["/api/widgets/{id}"]["get"]
+	require.NotNil(t, get)
+	assert.Equal(t, []string{"widgets"}, get.Tags)
+	assert.Equal(t, "get", get.OperationID, "operations are named after their handler")
+	require.Len(t, get.Parameters, 2)
+	assert.Equal(t, "id", get.Parameters[0].Name)
+	assert.True(t, get.Parameters[0].Required)
+	assert.Equal(t, "integer", get.Parameters[0].Schema.Type)
+	assert.Contains(t, get.Responses, "default", "undocumented errors fall back to Error")
+
+	w := doc.Components.Schemas["openapi_test.widget"]
+	require.NotNil(t, w)
+	assert.ElementsMatch(t, []string{"id", "name", "tags", "created_at"}, w.Required)
+	assert.NotContains(t, w.Properties, "secret")
+	assert.Equal(t, "date-time", w.Properties["created_at"].Format)
+	assert.True(t, w.Properties["tags"].Nullable)
+	require.Len(t, w.Properties["parent"].AllOf, 1)
+	assert.Equal(t, "#/components/schemas/openapi_test.widget", w.Properties["parent"].AllOf[0].Ref)
+
+	req := doc.Components.Schemas["openapi_test.createWidgetRequest"]
+	require.NotNil(t, req)
+	assert.ElementsMatch(t, []string{"name", "price"}, req.Required)
+	assert.Equal(t, 3, *req.Properties["name"].MinLength)
+	assert.Equal(t, "email", req.Properties["email"].Format)
+	assert.Equal(t, 0.0, *req.Properties["price"].Minimum)
+	assert.True(t, req.Properties["price"].ExclusiveMinimum)
+	assert.Equal(t, []any{"small", "large"}, req.Properties["kind"].Enum)
+}
+
+func TestBuild_Mismatch(t *testing.T) {
+	w := &widgets{}
+	spec := openapi.New(openapi.Info{Title: "Widgets", Version: "1"})
+	router := gin.New()
+	router.POST("/api/widgets", w.create)
+	router.DELETE("/api/widgets/:id", func(c *gin.Context) {})
+
+	err := spec.Build(router.Routes(), w.routes()...)
+	assert.ErrorIs(t, err, openapi.ErrUndocumented)
+	assert.ErrorContains(t, err, "DELETE /api/widgets/:id is not documented")
+	assert.ErrorContains(t, err, "(*widgets).get-fm is documented but not registered")
+}
+
+func TestServe(t *testing.T) {
+	router, _, reported := newRouter(t, &widgets{})
+
+	rec := serve(router, http.MethodGet, "/api/openapi.json", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var doc openapi.Document
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Contains(t, doc.Paths, "/api/widgets")
+	assert.Empty(t, *reported)
+}
+
+func TestValidate_Request(t *testing.T) {
+	router, _, reported := newRouter(t, &widgets{status: http.StatusCreated, body: widget{Name: "gear"}})
+
+	for name, tc := range map[string]struct {
+		method, target, body string
+		status               int
+		err                  string
+	}{
+		"valid":          {http.MethodPost, "/api/widgets", `{"name":"gear","price":2.5,"kind":"small"}`, http.StatusCreated, ""},
+		"missing":        {http.MethodPost, "/api/widgets", `{"name":"gear"}`, http.StatusBadRequest, `missing property \"price\"`},
+		"too short":      {http.MethodPost, "/api/widgets", `{"name":"g","price":1}`, http.StatusBadRequest, "$.name: must be at least 3 characters"},
+		"exclusive":      {http.MethodPost, "/api/widgets", `{"name":"gear","price":0}`, http.StatusBadRequest, "$.price: 0 is below the minimum"},
+		"wrong type":     {http.MethodPost, "/api/widgets", `{"name":"gear","price":"2"}`, http.StatusBadRequest, "$.price: must be a number, not a string"},
+		"enum":           {http.MethodPost, "/api/widgets", `{"name":"gear","price":1,"kind":"huge"}`, http.StatusBadRequest, "$.kind: huge is not one of"},
+		"extra property": {http.MethodPost, "/api/widgets", `{"name":"gear","price":1,"colour":"red"}`, http.StatusBadRequest, `unexpected property \"colour\"`},
+		"not JSON":       {http.MethodPost, "/api/widgets", `{`, http.StatusBadRequest, "request body is not JSON"},
+		"path param":     {http.MethodGet, "/api/widgets/abc", "", http.StatusBadRequest, "path parameter id: must be an integer"},
+		"query param":    {http.MethodGet, "/api/widgets/1?expand=maybe", "", http.StatusBadRequest, "query parameter expand: must be a boolean"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := serve(router, tc.method, tc.target, tc.body)
+			assert.Equal(t, tc.status, rec.Code)
+			if tc.err != "" {
+				assert.Contains(t, rec.Body.String(), tc.err)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/widgets", strings.NewReader("name=gear"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Empty(t, *reported)
+}
+
+func TestValidate_Response(t *testing.T) {
+	now := time.Now()
+	for name, tc := range map[string]struct {
+		status int
+		body   any
+		err    string
+	}{
+		"matches":          {http.StatusOK, widget{ID: 1, Name: "gear", Created: now}, ""},
+		"nested":           {http.StatusOK, widget{ID: 1, Parent: &widget{ID: 2}}, ""},
+		"documented error": {http.StatusNotFound, openapi.Error{Error: "not found", Code: "not_found"}, ""},
+		"missing field":    {http.StatusOK, map[string]any{"id": 1, "name": "gear", "tags": nil}, `missing property \"created_at\"`},
+		"renamed field":    {http.StatusOK, map[string]any{"id": 1, "name": "gear", "tags": nil, "createdAt": now}, `unexpected property "createdAt"`},
+		"wrong type":       {http.StatusOK, map[string]any{"id": "1", "name": "gear", "tags": nil, "created_at": now}, "$.id: must be an integer, not a string"},
+		"bad nested":       {http.StatusOK, map[string]any{"id": 1, "name": "gear", "tags": []int{1}, "created_at": now}, "$.tags[0]: must be a string"},
+		"status":           {http.StatusAccepted, widget{}, "status is not documented"},
+		"error shape":      {http.StatusInternalServerError, map[string]string{"message": "oops"}, `missing property "error"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			router, _, reported := newRouter(t, &widgets{status: tc.status, body: tc.body})
+			rec := serve(router, http.MethodGet, "/api/widgets/1", "")
+			assert.Equal(t, tc.status, rec.Code, "responses are passed through")
+
+			if tc.err == "" {
+				assert.Empty(t, *reported)
+				return
+			}
+			require.Len(t, *reported, 1)
+			assert.ErrorContains(t, (*reported)[0], "GET /api/widgets/:id responded")
+			assert.ErrorContains(t, (*reported)[0], strings.ReplaceAll(tc.err, `\"`, `"`))
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// direction is whether a type is read from requests or written in
+// responses. Requests only require fields bound as required, responses
+// always include fields without omitempty.
+type direction int
+
+const (
+	request direction = iota
+	response
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	fileHeaderType = reflect.TypeOf(&multipart.FileHeader{})
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType       = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// generator derives schemas from Go types the way encoding/json and gin's
+// binding see them. Named structs become components referenced by name.
+type generator struct {
+	schemas map[string]*Schema
+	names   map[typeKey]string
+}
+
+type typeKey struct {
+	t   reflect.Type
+	dir direction
+}
+
+func newGenerator() *generator {
+	return &generator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[typeKey]string),
+	}
+}
+
+func (g *generator) schema(t reflect.Type, dir direction) (*Schema, error) {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case t == rawMessageType:
+		return &Schema{}, nil
+	case t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface &&
+		(t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType)):
+		// Custom encodings can't be derived
+		return &Schema{}, nil
+	case t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface &&
+		(t.Implements(textType) || reflect.PointerTo(t).Implements(textType)):
+		return &Schema{Type: "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Minimum: ptr(0.0)}, nil
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}, nil
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Pointer:
+		s, err := g.schema(t.Elem(), dir)
+		if err != nil {
+			return nil, err
+		}
+		return nullable(s), nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: t.Kind() == reflect.Slice}, nil
+		}
+		items, err := g.schema(t.Elem(), dir)
+		if err != nil {
+			return nil, err
+		}
+		s := &Schema{Type: "array", Items: items, Nullable: t.Kind() == reflect.Slice}
+		if t.Kind() == reflect.Array {
+			s.MinItems, s.MaxItems = ptr(t.Len()), ptr(t.Len())
+		}
+		return s, nil
+	case reflect.Map:
+		if k := t.Key().Kind(); k != reflect.String && (k < reflect.Int || k > reflect.Uint64) {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := g.schema(t.Elem(), dir)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values, Nullable: true}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t, dir)
+		}
+		return g.ref(t, dir)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// ref returns a reference to the component describing a named struct,
+// adding the component the first time
+func (g *generator) ref(t reflect.Type, dir direction) (*Schema, error) {
+	key := typeKey{t, dir}
+	if name, ok := g.names[key]; ok {
+		return &Schema{Ref: "#/components/schemas/" + name}, nil
+	}
+
+	name := g.componentName(t, dir)
+	g.names[key] = name
+	// Registered before the fields so recursive types terminate
+	g.schemas[name] = &Schema{}
+	s, err := g.object(t, dir)
+	if err != nil {
+		return nil, err
+	}
+	*g.schemas[name] = *s
+	return &Schema{Ref: "#/components/schemas/" + name}, nil
+}
+
+// componentName names a component after its type, e.g. "token.Transaction",
+// falling back to the full package path when two packages share a name. A
+// type used both ways gets a separate request component.
+func (g *generator) componentName(t reflect.Type, dir direction) string {
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	candidates := []string{
+		pkg + "." + t.Name(),
+		strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + t.Name(),
+	}
+	for _, name := range candidates {
+		if dir == request {
+			if _, ok := g.names[typeKey{t, response}]; ok {
+				name += "Input"
+			}
+		}
+		if _, taken := g.schemas[name]; !taken {
+			return name
+		}
+	}
+	for i := 2; ; i++ {
+		name := candidates[1] + strconv.Itoa(i)
+		if _, taken := g.schemas[name]; !taken {
+			return name
+		}
+	}
+}
+
+// object describes a struct as encoding/json writes it
+func (g *generator) object(t reflect.Type, dir direction) (*Schema, error) {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+	if err := g.fields(s, t, dir); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (g *generator) fields(s *Schema, t reflect.Type, dir direction) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := g.fields(s, ft, dir); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop, err := g.schema(f.Type, dir)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t, f.Name, err)
+		}
+		binding := f.Tag.Get("binding")
+		constrain(prop, binding)
+		s.Properties[name] = prop
+
+		required := !hasOption(opts, "omitempty")
+		if dir == request {
+			required = hasOption(binding, "required")
+		}
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return nil
+}
+
+// form describes a struct bound from a multipart form by its form tags
+func (g *generator) form(t reflect.Type) (*Schema, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("form type %s is not a struct", t)
+	}
+
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("form"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		var (
+			prop *Schema
+			err  error
+		)
+		switch {
+		case f.Type == fileHeaderType:
+			prop = &Schema{Type: "string", Format: "binary"}
+		case f.Type.Kind() == reflect.Slice && f.Type.Elem() == fileHeaderType:
+			prop = &Schema{Type: "array", Items: &Schema{Type: "string", Format: "binary"}}
+		default:
+			prop, err = g.schema(f.Type, request)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t, f.Name, err)
+		}
+		binding := f.Tag.Get("binding")
+		constrain(prop, binding)
+		s.Properties[name] = prop
+		if hasOption(binding, "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s, nil
+}
+
+// constrain adds the validations of a binding tag that JSON schema can
+// express
+func constrain(s *Schema, binding string) {
+	if s.Type == "" || s.Ref != "" || len(s.AllOf) > 0 {
+		return
+	}
+	for _, rule := range strings.Split(binding, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "email":
+			s.Format = "email"
+		case "url":
+			s.Format = "uri"
+		case "oneof":
+			for _, v := range strings.Fields(value) {
+				if s.Type == "string" {
+					s.Enum = append(s.Enum, v)
+				} else if n, err := strconv.ParseFloat(v, 64); err == nil {
+					s.Enum = append(s.Enum, n)
+				}
+			}
+		case "min", "max", "len":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			switch s.Type {
+			case "string":
+				if key != "max" {
+					s.MinLength = ptr(int(n))
+				}
+				if key != "min" {
+					s.MaxLength = ptr(int(n))
+				}
+			case "array":
+				if key != "max" {
+					s.MinItems = ptr(int(n))
+				}
+				if key != "min" {
+					s.MaxItems = ptr(int(n))
+				}
+			case "integer", "number":
+				if key != "max" {
+					s.Minimum = ptr(n)
+				}
+				if key != "min" {
+					s.Maximum = ptr(n)
+				}
+			}
+		case "gt", "gte", "lt", "lte":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil || (s.Type != "integer" && s.Type != "number") {
+				continue
+			}
+			if key[0] == 'g' {
+				s.Minimum, s.ExclusiveMinimum = ptr(n), key == "gt"
+			} else {
+				s.Maximum, s.ExclusiveMaximum = ptr(n), key == "lt"
+			}
+		}
+	}
+}
+
+// nullable marks s as also allowing null. References can't carry other
+// keywords in OpenAPI 3.0, so they are wrapped.
+func nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return &Schema{AllOf: []*Schema{s}, Nullable: true}
+	}
+	if s.Type != "" {
+		s.Nullable = true
+	}
+	return s
+}
+
+func hasOption(tag, option string) bool {
+	for _, o := range strings.Split(tag, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
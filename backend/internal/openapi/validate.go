@@ -0,0 +1,208 @@
+package openapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// validator checks decoded JSON against schemas, resolving references
+// against the document's components
+type validator struct {
+	schemas map[string]*Schema
+	errs    []error
+}
+
+// validate checks a value decoded with json.Decoder.UseNumber. Problems
+// are reported with the JSONPath of the offending value.
+func (v *validator) validate(s *Schema, value any, path string) {
+	if s.Ref != "" {
+		target, ok := v.schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			v.fail(path, "unresolved reference %s", s.Ref)
+			return
+		}
+		v.validate(target, value, path)
+		return
+	}
+	if value == nil {
+		if !s.Nullable && (s.Type != "" || len(s.AllOf) > 0) {
+			v.fail(path, "must not be null")
+		}
+		return
+	}
+	for _, sub := range s.AllOf {
+		v.validate(sub, value, path)
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		v.fail(path, "%v is not one of %v", value, s.Enum)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			v.mismatch(path, s.Type, value)
+			return
+		}
+		v.object(s, obj, path)
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			v.mismatch(path, s.Type, value)
+			return
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			v.fail(path, "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			v.fail(path, "must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			v.mismatch(path, s.Type, value)
+			return
+		}
+		v.string(s, str, path)
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			v.mismatch(path, s.Type, value)
+			return
+		}
+		v.number(s, n, path)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.mismatch(path, s.Type, value)
+		}
+	}
+}
+
+func (v *validator) object(s *Schema, obj map[string]any, path string) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			v.fail(path, "missing property %q", name)
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := obj[name]
+		if prop, ok := s.Properties[name]; ok {
+			v.validate(prop, value, path+"."+name)
+			continue
+		}
+		switch extra := s.AdditionalProperties.(type) {
+		case bool:
+			if !extra {
+				v.fail(path, "unexpected property %q", name)
+			}
+		case *Schema:
+			v.validate(extra, value, path+"."+name)
+		}
+	}
+}
+
+func (v *validator) string(s *Schema, str, path string) {
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		v.fail(path, "must be at least %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		v.fail(path, "must be at most %d characters", *s.MaxLength)
+	}
+
+	var err error
+	switch s.Format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339Nano, str)
+	case "date":
+		_, err = time.Parse(time.DateOnly, str)
+	case "email":
+		_, err = mail.ParseAddress(str)
+	case "byte":
+		_, err = base64.StdEncoding.DecodeString(str)
+	}
+	if err != nil {
+		v.fail(path, "%q is not a valid %s", str, s.Format)
+	}
+}
+
+func (v *validator) number(s *Schema, n json.Number, path string) {
+	if s.Type == "integer" {
+		if _, err := n.Int64(); err != nil {
+			v.fail(path, "%s is not an integer", n)
+			return
+		}
+	}
+	f, err := n.Float64()
+	if err != nil {
+		v.fail(path, "%s is not a number", n)
+		return
+	}
+	if s.Minimum != nil && (f < *s.Minimum || s.ExclusiveMinimum && f == *s.Minimum) {
+		v.fail(path, "%s is below the minimum of %v", n, *s.Minimum)
+	}
+	if s.Maximum != nil && (f > *s.Maximum || s.ExclusiveMaximum && f == *s.Maximum) {
+		v.fail(path, "%s is above the maximum of %v", n, *s.Maximum)
+	}
+}
+
+func (v *validator) mismatch(path, want string, got any) {
+	v.fail(path, "must be %s, not %s", article(want), article(jsonType(got)))
+}
+
+func (v *validator) fail(path, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) err() error {
+	return errors.Join(v.errs...)
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+func article(typ string) string {
+	if typ == "object" || typ == "array" || typ == "integer" {
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps rate limit state in process memory. Entries whose
+// bucket has fully refilled carry no information and are evicted.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	now     func() time.Time
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewMemoryStore creates an in-memory store that evicts idle entries every
+// cleanupInterval. A non-positive interval disables background eviction.
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		entries: make(map[string]time.Time),
+		now:     time.Now,
+		done:    make(chan struct{}),
+	}
+	if cleanupInterval > 0 {
+		go s.janitor(cleanupInterval)
+	}
+	return s
+}
+
+// Allow records a request for key and reports whether it is within rate
+func (s *MemoryStore) Allow(ctx context.Context, key string, rate Rate) (*Result, error) {
+	g, err := newGCRA(rate)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	tat, result := g.step(now, s.entries[key], rate.Requests)
+	if result.Allowed {
+		s.entries[key] = tat
+	}
+	return result, nil
+}
+
+// Len returns the number of tracked keys
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// EvictIdle removes every key whose bucket has fully refilled
+func (s *MemoryStore) EvictIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, tat := range s.entries {
+		if !tat.After(now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// Close stops background eviction
+func (s *MemoryStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *MemoryStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.EvictIdle()
+		case <-s.done:
+			return
+		}
+	}
+}
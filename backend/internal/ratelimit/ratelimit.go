@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInvalidRate = errors.New("rate must allow at least one request per window")
+
+// Rate describes how many requests are allowed per window. Burst is the
+// number of requests that may be made back to back and defaults to Requests.
+type Rate struct {
+	Requests int
+	Window   time.Duration
+	Burst    int
+}
+
+// Result describes the outcome of a rate limit check
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration // Time until the bucket is completely refilled
+	RetryAfter time.Duration // Time until the next request is allowed, zero if allowed
+}
+
+// Store records request counts for rate limit keys. Implementations use
+// the generic cell rate algorithm, so each key only stores one timestamp.
+type Store interface {
+	Allow(ctx context.Context, key string, rate Rate) (*Result, error)
+}
+
+// gcra holds the derived parameters of the generic cell rate algorithm
+type gcra struct {
+	interval  time.Duration // Time it takes to earn one request back
+	tolerance time.Duration // How far the theoretical arrival time may run ahead of now
+}
+
+func newGCRA(rate Rate) (gcra, error) {
+	if rate.Requests <= 0 || rate.Window <= 0 {
+		return gcra{}, ErrInvalidRate
+	}
+	burst := rate.Burst
+	if burst <= 0 {
+		burst = rate.Requests
+	}
+	interval := rate.Window / time.Duration(rate.Requests)
+	if interval < time.Microsecond {
+		interval = time.Microsecond
+	}
+	return gcra{
+		interval:  interval,
+		tolerance: interval * time.Duration(burst),
+	}, nil
+}
+
+// step applies one request at now to the stored theoretical arrival time
+// and returns the new arrival time to store along with the result
+func (g gcra) step(now, tat time.Time, limit int) (time.Time, *Result) {
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTAT := tat.Add(g.interval)
+	allowAt := newTAT.Add(-g.tolerance)
+	if now.Before(allowAt) {
+		return tat, &Result{
+			Allowed:    false,
+			Limit:      limit,
+			Remaining:  0,
+			ResetAfter: tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}
+	}
+
+	return newTAT, g.result(now, newTAT, limit)
+}
+
+func (g gcra) result(now, tat time.Time, limit int) *Result {
+	resetAfter := tat.Sub(now)
+	remaining := int((g.tolerance - resetAfter) / g.interval)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &Result{
+		Allowed:    true,
+		Limit:      limit,
+		Remaining:  remaining,
+		ResetAfter: resetAfter,
+	}
+}
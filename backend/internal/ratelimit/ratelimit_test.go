@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a manually advanced clock shared by a store under test
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestStores(t *testing.T) map[string]struct {
+	store Store
+	clock *fakeClock
+} {
+	memClock := &fakeClock{t: time.Unix(1700000000, 0)}
+	mem := NewMemoryStore(0)
+	mem.now = memClock.Now
+	t.Cleanup(func() { mem.Close() })
+
+	mr := miniredis.RunT(t)
+	redisClock := &fakeClock{t: time.Unix(1700000000, 0)}
+	rs := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	rs.now = redisClock.Now
+	t.Cleanup(func() { rs.Close() })
+
+	return map[string]struct {
+		store Store
+		clock *fakeClock
+	}{
+		"memory": {mem, memClock},
+		"redis":  {rs, redisClock},
+	}
+}
+
+func TestStore_AllowsUpToBurstThenRejects(t *testing.T) {
+	for name, tc := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			rate := Rate{Requests: 3, Window: 3 * time.Second}
+			ctx := context.Background()
+
+			for i := 0; i < 3; i++ {
+				res, err := tc.store.Allow(ctx, "user:1", rate)
+				require.NoError(t, err)
+				assert.True(t, res.Allowed, "request %d should be allowed", i+1)
+				assert.Equal(t, 3, res.Limit)
+				assert.Equal(t, 2-i, res.Remaining)
+			}
+
+			res, err := tc.store.Allow(ctx, "user:1", rate)
+			require.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.Equal(t, 0, res.Remaining)
+			assert.Equal(t, time.Second, res.RetryAfter)
+
+			// Other keys have their own bucket
+			res, err = tc.store.Allow(ctx, "user:2", rate)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+
+			// One request is earned back per interval
+			tc.clock.Advance(time.Second)
+			res, err = tc.store.Allow(ctx, "user:1", rate)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, 0, res.Remaining)
+		})
+	}
+}
+
+func TestStore_InvalidRate(t *testing.T) {
+	for name, tc := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := tc.store.Allow(context.Background(), "k", Rate{})
+			assert.Equal(t, ErrInvalidRate, err)
+		})
+	}
+}
+
+func TestMemoryStore_EvictIdle(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	store := NewMemoryStore(0)
+	store.now = clock.Now
+	defer store.Close()
+
+	rate := Rate{Requests: 10, Window: time.Minute}
+	_, err := store.Allow(context.Background(), "ip:1", rate)
+	require.NoError(t, err)
+	_, err = store.Allow(context.Background(), "ip:2", rate)
+	require.NoError(t, err)
+	assert.Equal(t, 2, store.Len())
+
+	// Entries stay while their bucket is still refilling
+	store.EvictIdle()
+	assert.Equal(t, 2, store.Len())
+
+	clock.Advance(time.Minute)
+	store.EvictIdle()
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestRedisStore_KeysExpire(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	defer store.Close()
+
+	_, err := store.Allow(context.Background(), "ip:1", Rate{Requests: 10, Window: time.Minute})
+	require.NoError(t, err)
+	assert.True(t, mr.Exists("ratelimit:ip:1"))
+
+	mr.FastForward(6 * time.Second)
+	assert.False(t, mr.Exists("ratelimit:ip:1"))
+}
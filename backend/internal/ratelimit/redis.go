@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript atomically applies one request to the stored theoretical
+// arrival time. All times are in microseconds; the returned time is
+// relative to now so it fits in a Redis integer reply.
+var gcraScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local tolerance = tonumber(ARGV[3])
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval
+if now < new_tat - tolerance then
+	return {0, tat - now}
+end
+
+redis.call('SET', KEYS[1], string.format('%d', new_tat), 'PX', math.ceil((new_tat - now) / 1000))
+return {1, new_tat - now}
+`)
+
+// RedisStore keeps rate limit state in Redis so limits are shared between
+// server instances. Keys expire as soon as their bucket has refilled.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisStore creates a store backed by the given Redis client
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{
+		client: client,
+		prefix: "ratelimit:",
+		now:    time.Now,
+	}
+}
+
+// NewRedisStoreFromURL connects to Redis using a redis:// URL
+func NewRedisStoreFromURL(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	return NewRedisStore(redis.NewClient(opts)), nil
+}
+
+// Allow records a request for key and reports whether it is within rate
+func (s *RedisStore) Allow(ctx context.Context, key string, rate Rate) (*Result, error) {
+	g, err := newGCRA(rate)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	reply, err := gcraScript.Run(ctx, s.client, []string{s.prefix + key},
+		now.UnixMicro(),
+		g.interval.Microseconds(),
+		g.tolerance.Microseconds(),
+	).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 2 {
+		return nil, fmt.Errorf("unexpected rate limit script reply: %v", reply)
+	}
+
+	tat := now.Add(time.Duration(reply[1]) * time.Microsecond)
+	if reply[0] == 1 {
+		return g.result(now, tat, rate.Requests), nil
+	}
+
+	return &Result{
+		Allowed:    false,
+		Limit:      rate.Requests,
+		Remaining:  0,
+		ResetAfter: tat.Sub(now),
+		RetryAfter: tat.Add(g.interval - g.tolerance).Sub(now),
+	}, nil
+}
+
+// Close closes the underlying Redis client
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,67 @@
+package analytics
+
+import (
+	"context"
+	"time"
+)
+
+// DayFormat is the layout of the day keys in daily breakdowns. Days are
+// calendar days in UTC.
+const DayFormat = "2006-01-02"
+
+// Period is the span of time from From up to, but not including, To. A
+// zero From reaches back to the beginning.
+type Period struct {
+	From time.Time
+	To   time.Time
+}
+
+// ActivityFilter narrows which activities are counted. Zero fields match
+// everything.
+type ActivityFilter struct {
+	UserID int64
+	Type   string
+	// Successful restricts to activities whose metadata has "success": true
+	Successful bool
+}
+
+// TokenVolume summarises the token transactions of a period
+type TokenVolume struct {
+	Total        float64
+	Staked       float64
+	Transactions int
+	Users        int
+}
+
+// Repository records activities and answers the aggregate queries metrics
+// and reports are built from
+type Repository interface {
+	// WithTx runs fn in a transaction, as user.Repository.WithTx does
+	WithTx(ctx context.Context, fn func(Repository) error) error
+
+	// CreateActivity stores activity and sets its ID
+	CreateActivity(ctx context.Context, activity *Activity) error
+
+	// CountUsers counts the users who signed up during the period
+	CountUsers(ctx context.Context, period Period) (int, error)
+	// CountActiveUsers counts the users with at least one activity
+	CountActiveUsers(ctx context.Context, period Period) (int, error)
+	// CountRetainedUsers counts the users active during both periods
+	CountRetainedUsers(ctx context.Context, first, second Period) (int, error)
+	CountActivities(ctx context.Context, filter ActivityFilter, period Period) (int, error)
+	// ActivityCounts counts activities by type
+	ActivityCounts(ctx context.Context, period Period) (map[string]int, error)
+	// DailyActiveUsers counts the distinct active users of each day
+	DailyActiveUsers(ctx context.Context, period Period) (map[string]int, error)
+	// DailyNewUsers counts the sign ups of each day
+	DailyNewUsers(ctx context.Context, period Period) (map[string]int, error)
+	TokenVolume(ctx context.Context, period Period) (TokenVolume, error)
+	// DailyTokenVolume sums the transaction amounts of each day
+	DailyTokenVolume(ctx context.Context, period Period) (map[string]float64, error)
+
+	// CreateDailyMetric, CreateEngagement and CreateReport store their
+	// argument and set its ID
+	CreateDailyMetric(ctx context.Context, metric *DailyMetric) error
+	CreateEngagement(ctx context.Context, engagement *UserEngagement) error
+	CreateReport(ctx context.Context, report *Report) error
+}
@@ -2,20 +2,27 @@ package analytics
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
-	"errors"
 	"time"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/tracing"
 )
 
 var (
-	ErrInvalidDateRange = errors.New("invalid date range")
-	ErrInvalidMetric    = errors.New("invalid metric type")
-	ErrInvalidActivity  = errors.New("invalid activity type")
+	ErrInvalidDateRange  = apperr.New(apperr.ErrInvalid, "invalid_date_range", "invalid date range")
+	ErrInvalidMetric     = apperr.New(apperr.ErrInvalid, "invalid_metric", "invalid metric type")
+	ErrInvalidActivity   = apperr.New(apperr.ErrInvalid, "invalid_activity", "invalid activity type")
+	ErrInvalidReportType = apperr.New(apperr.ErrInvalid, "invalid_report_type", "unsupported report type")
 )
 
+// MetricTypes lists the metrics CalculateDailyMetric computes
+var MetricTypes = []string{
+	"ACTIVE_USERS", "NEW_USERS", "VERIFICATIONS", "TOKEN_VOLUME",
+	"STAKE_VOLUME", "ENGAGEMENT_RATE", "RETENTION_RATE",
+}
+
 type Service struct {
-	db *sql.DB
+	repo Repository
 }
 
 type Activity struct {
@@ -55,123 +62,97 @@ type Report struct {
 	CreatedAt  time.Time      `json:"createdAt"`
 }
 
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
 }
 
 // TrackActivity records a user activity
-func (s *Service) TrackActivity(ctx context.Context, userID int64, activityType string, metadata map[string]any) error {
-	metadataJSON, err := json.Marshal(metadata)
-	if err != nil {
-		return err
-	}
-
-	_, err = s.db.ExecContext(ctx,
-		`INSERT INTO user_activities (user_id, activity_type, metadata)
-		VALUES ($1, $2, $3)`,
-		userID, activityType, metadataJSON)
-	return err
+func (s *Service) TrackActivity(ctx context.Context, userID int64, activityType string, metadata map[string]any) (err error) {
+	ctx, span := tracing.Start(ctx, "analytics.TrackActivity")
+	defer tracing.End(span, &err)
+
+	return s.repo.CreateActivity(ctx, &Activity{
+		UserID:    userID,
+		Type:      activityType,
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+	})
 }
 
 // CalculateDailyMetric calculates and stores a daily metric
-func (s *Service) CalculateDailyMetric(ctx context.Context, metricType string, date time.Time) (*DailyMetric, error) {
+func (s *Service) CalculateDailyMetric(ctx context.Context, metricType string, date time.Time) (_ *DailyMetric, err error) {
+	ctx, span := tracing.Start(ctx, "analytics.CalculateDailyMetric")
+	defer tracing.End(span, &err)
+
+	day := dayOf(date)
 	var value float64
 	var metadata map[string]any
 
 	// Calculate metric value based on type
 	switch metricType {
 	case "ACTIVE_USERS":
-		err := s.db.QueryRowContext(ctx,
-			`SELECT COUNT(DISTINCT user_id) 
-			FROM user_activities 
-			WHERE DATE(created_at) = DATE($1)`,
-			date).Scan(&value)
+		count, err := s.repo.CountActiveUsers(ctx, day)
 		if err != nil {
 			return nil, err
 		}
+		value = float64(count)
 
 	case "NEW_USERS":
-		err := s.db.QueryRowContext(ctx,
-			`SELECT COUNT(*) 
-			FROM users 
-			WHERE DATE(created_at) = DATE($1)`,
-			date).Scan(&value)
+		count, err := s.repo.CountUsers(ctx, day)
 		if err != nil {
 			return nil, err
 		}
+		value = float64(count)
 
 	case "VERIFICATIONS":
-		err := s.db.QueryRowContext(ctx,
-			`SELECT COUNT(*) 
-			FROM user_activities 
-			WHERE activity_type = 'VERIFICATION' 
-			AND DATE(created_at) = DATE($1)`,
-			date).Scan(&value)
+		count, err := s.repo.CountActivities(ctx, ActivityFilter{Type: "VERIFICATION"}, day)
 		if err != nil {
 			return nil, err
 		}
+		value = float64(count)
 
 	case "TOKEN_VOLUME":
-		err := s.db.QueryRowContext(ctx,
-			`SELECT COALESCE(SUM(amount), 0) 
-			FROM token_transactions 
-			WHERE DATE(created_at) = DATE($1)`,
-			date).Scan(&value)
+		volume, err := s.repo.TokenVolume(ctx, day)
 		if err != nil {
 			return nil, err
 		}
+		value = volume.Total
 
 	case "STAKE_VOLUME":
-		err := s.db.QueryRowContext(ctx,
-			`SELECT COALESCE(SUM(amount), 0) 
-			FROM token_transactions 
-			WHERE type = 'STAKE' 
-			AND DATE(created_at) = DATE($1)`,
-			date).Scan(&value)
+		volume, err := s.repo.TokenVolume(ctx, day)
 		if err != nil {
 			return nil, err
 		}
+		value = volume.Staked
 
 	case "ENGAGEMENT_RATE":
-		var totalUsers, activeUsers float64
-		err := s.db.QueryRowContext(ctx,
-			`SELECT 
-				(SELECT COUNT(*) FROM users WHERE created_at <= $1) as total_users,
-				(SELECT COUNT(DISTINCT user_id) FROM user_activities WHERE DATE(created_at) = DATE($1)) as active_users`,
-			date).Scan(&totalUsers, &activeUsers)
+		total, err := s.repo.CountUsers(ctx, Period{To: day.To})
 		if err != nil {
 			return nil, err
 		}
-		if totalUsers > 0 {
-			value = (activeUsers / totalUsers) * 100
+		active, err := s.repo.CountActiveUsers(ctx, day)
+		if err != nil {
+			return nil, err
 		}
+		totalUsers, activeUsers := float64(total), float64(active)
+		value = percentage(activeUsers, totalUsers)
 		metadata = map[string]any{
 			"totalUsers":  totalUsers,
 			"activeUsers": activeUsers,
 		}
 
 	case "RETENTION_RATE":
-		var prevUsers, retainedUsers float64
-		prevDate := date.AddDate(0, 0, -1)
-		err := s.db.QueryRowContext(ctx,
-			`WITH prev_users AS (
-				SELECT DISTINCT user_id 
-				FROM user_activities 
-				WHERE DATE(created_at) = DATE($1)
-			)
-			SELECT 
-				(SELECT COUNT(*) FROM prev_users) as prev_users,
-				(SELECT COUNT(DISTINCT a.user_id) 
-				FROM user_activities a 
-				JOIN prev_users p ON a.user_id = p.user_id 
-				WHERE DATE(a.created_at) = DATE($2)) as retained_users`,
-			prevDate, date).Scan(&prevUsers, &retainedUsers)
+		prevDay := dayOf(date.AddDate(0, 0, -1))
+		prev, err := s.repo.CountActiveUsers(ctx, prevDay)
 		if err != nil {
 			return nil, err
 		}
-		if prevUsers > 0 {
-			value = (retainedUsers / prevUsers) * 100
+		retained, err := s.repo.CountRetainedUsers(ctx, prevDay, day)
+		if err != nil {
+			return nil, err
 		}
+		prevUsers, retainedUsers := float64(prev), float64(retained)
+		value = percentage(retainedUsers, prevUsers)
 		metadata = map[string]any{
 			"previousUsers": prevUsers,
 			"retainedUsers": retainedUsers,
@@ -181,250 +162,173 @@ func (s *Service) CalculateDailyMetric(ctx context.Context, metricType string, d
 		return nil, ErrInvalidMetric
 	}
 
-	// Store metric
-	metadataJSON, err := json.Marshal(metadata)
-	if err != nil {
-		return nil, err
+	metric := &DailyMetric{
+		Date:      day.From,
+		Type:      metricType,
+		Value:     value,
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
 	}
-
-	var metric DailyMetric
-	err = s.db.QueryRowContext(ctx,
-		`INSERT INTO daily_metrics (metric_date, metric_type, metric_value, metadata)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, metric_date, metric_type, metric_value, metadata, created_at`,
-		date, metricType, value, metadataJSON).Scan(
-		&metric.ID, &metric.Date, &metric.Type, &metric.Value,
-		&metadataJSON, &metric.CreatedAt)
-	if err != nil {
+	if err := s.repo.CreateDailyMetric(ctx, metric); err != nil {
 		return nil, err
 	}
+	return metric, nil
+}
 
-	if len(metadataJSON) > 0 {
-		if err := json.Unmarshal(metadataJSON, &metric.Metadata); err != nil {
-			return nil, err
-		}
-	}
-
-	return &metric, nil
+// dayOf returns the UTC calendar day containing t
+func dayOf(t time.Time) Period {
+	t = t.UTC()
+	from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return Period{From: from, To: from.AddDate(0, 0, 1)}
 }
 
 // UpdateUserEngagement calculates and stores user engagement metrics
-func (s *Service) UpdateUserEngagement(ctx context.Context, userID int64, startDate, endDate time.Time) error {
+func (s *Service) UpdateUserEngagement(ctx context.Context, userID int64, startDate, endDate time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "analytics.UpdateUserEngagement")
+	defer tracing.End(span, &err)
+
 	if endDate.Before(startDate) {
 		return ErrInvalidDateRange
 	}
+	period := Period{From: startDate, To: endDate}
 
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	// Calculate activity count
-	var activityCount float64
-	err = tx.QueryRowContext(ctx,
-		`SELECT COUNT(*) 
-		FROM user_activities 
-		WHERE user_id = $1 
-		AND created_at BETWEEN $2 AND $3`,
-		userID, startDate, endDate).Scan(&activityCount)
-	if err != nil {
-		return err
-	}
-
-	// Calculate verification success rate
-	var totalVerifications, successfulVerifications float64
-	err = tx.QueryRowContext(ctx,
-		`SELECT 
-			COUNT(*) as total,
-			COUNT(*) FILTER (WHERE (metadata->>'success')::boolean = true) as successful
-		FROM user_activities 
-		WHERE user_id = $1 
-		AND activity_type = 'VERIFICATION'
-		AND created_at BETWEEN $2 AND $3`,
-		userID, startDate, endDate).Scan(&totalVerifications, &successfulVerifications)
-	if err != nil {
-		return err
-	}
-
-	// Store metrics
-	metrics := []struct {
-		Type  string
-		Value float64
-	}{
-		{"ACTIVITY_COUNT", activityCount},
-		{"VERIFICATION_SUCCESS_RATE", calculateSuccessRate(totalVerifications, successfulVerifications)},
-	}
+	return s.repo.WithTx(ctx, func(repo Repository) error {
+		// Calculate activity count
+		activityCount, err := repo.CountActivities(ctx, ActivityFilter{UserID: userID}, period)
+		if err != nil {
+			return err
+		}
 
-	for _, m := range metrics {
-		_, err = tx.ExecContext(ctx,
-			`INSERT INTO user_engagement (user_id, metric_type, metric_value, start_date, end_date)
-			VALUES ($1, $2, $3, $4, $5)`,
-			userID, m.Type, m.Value, startDate, endDate)
+		// Calculate verification success rate
+		verifications := ActivityFilter{UserID: userID, Type: "VERIFICATION"}
+		totalVerifications, err := repo.CountActivities(ctx, verifications, period)
 		if err != nil {
 			return err
 		}
-	}
+		verifications.Successful = true
+		successfulVerifications, err := repo.CountActivities(ctx, verifications, period)
+		if err != nil {
+			return err
+		}
+
+		// Store metrics
+		metrics := []struct {
+			Type  string
+			Value float64
+		}{
+			{"ACTIVITY_COUNT", float64(activityCount)},
+			{"VERIFICATION_SUCCESS_RATE", percentage(float64(successfulVerifications), float64(totalVerifications))},
+		}
 
-	return tx.Commit()
+		now := time.Now()
+		for _, m := range metrics {
+			err := repo.CreateEngagement(ctx, &UserEngagement{
+				UserID:    userID,
+				Type:      m.Type,
+				Value:     m.Value,
+				StartDate: startDate,
+				EndDate:   endDate,
+				CreatedAt: now,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func calculateSuccessRate(total, successful float64) float64 {
-	if total > 0 {
-		return (successful / total) * 100
+// percentage returns part as a percentage of whole, or zero when whole is zero
+func percentage(part, whole float64) float64 {
+	if whole > 0 {
+		return (part / whole) * 100
 	}
 	return 0
 }
 
 // GenerateReport creates an analytics report for the specified period
-func (s *Service) GenerateReport(ctx context.Context, reportType string, startDate, endDate time.Time, parameters map[string]any) (*Report, error) {
+func (s *Service) GenerateReport(ctx context.Context, reportType string, startDate, endDate time.Time, parameters map[string]any) (_ *Report, err error) {
+	ctx, span := tracing.Start(ctx, "analytics.GenerateReport")
+	defer tracing.End(span, &err)
+
 	if endDate.Before(startDate) {
 		return nil, ErrInvalidDateRange
 	}
+	period := Period{From: startDate, To: endDate}
 
 	// Prepare report data
-	data := make(map[string]any)
-	var err error
+	var data map[string]any
 
 	switch reportType {
 	case "USER_GROWTH":
-		data, err = s.generateUserGrowthReport(ctx, startDate, endDate)
+		data, err = s.generateUserGrowthReport(ctx, period)
 	case "PLATFORM_ACTIVITY":
-		data, err = s.generatePlatformActivityReport(ctx, startDate, endDate)
+		data, err = s.generatePlatformActivityReport(ctx, period)
 	case "TOKEN_METRICS":
-		data, err = s.generateTokenMetricsReport(ctx, startDate, endDate)
+		data, err = s.generateTokenMetricsReport(ctx, period)
 	default:
-		return nil, errors.New("unsupported report type")
+		return nil, ErrInvalidReportType
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Store report
-	dataJSON, err := json.Marshal(data)
-	if err != nil {
-		return nil, err
+	report := &Report{
+		Type:       reportType,
+		Data:       data,
+		Parameters: parameters,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		CreatedAt:  time.Now(),
 	}
-
-	parametersJSON, err := json.Marshal(parameters)
-	if err != nil {
+	if err := s.repo.CreateReport(ctx, report); err != nil {
 		return nil, err
 	}
+	return report, nil
+}
 
-	var report Report
-	err = s.db.QueryRowContext(ctx,
-		`INSERT INTO analytics_reports (report_type, report_data, parameters, start_date, end_date)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, report_type, report_data, parameters, start_date, end_date, created_at`,
-		reportType, dataJSON, parametersJSON, startDate, endDate).Scan(
-		&report.ID, &report.Type, &dataJSON, &parametersJSON,
-		&report.StartDate, &report.EndDate, &report.CreatedAt)
+func (s *Service) generateUserGrowthReport(ctx context.Context, period Period) (map[string]any, error) {
+	totalUsers, err := s.repo.CountUsers(ctx, Period{To: period.To})
 	if err != nil {
 		return nil, err
 	}
-
-	if err := json.Unmarshal(dataJSON, &report.Data); err != nil {
+	newUsers, err := s.repo.CountUsers(ctx, period)
+	if err != nil {
 		return nil, err
 	}
-	if len(parametersJSON) > 0 {
-		if err := json.Unmarshal(parametersJSON, &report.Parameters); err != nil {
-			return nil, err
-		}
-	}
-
-	return &report, nil
-}
-
-func (s *Service) generateUserGrowthReport(ctx context.Context, startDate, endDate time.Time) (map[string]any, error) {
-	var totalUsers, newUsers, activeUsers int
-	err := s.db.QueryRowContext(ctx,
-		`SELECT 
-			(SELECT COUNT(*) FROM users WHERE created_at <= $2) as total_users,
-			(SELECT COUNT(*) FROM users WHERE created_at BETWEEN $1 AND $2) as new_users,
-			(SELECT COUNT(DISTINCT user_id) FROM user_activities WHERE created_at BETWEEN $1 AND $2) as active_users`,
-		startDate, endDate).Scan(&totalUsers, &newUsers, &activeUsers)
+	activeUsers, err := s.repo.CountActiveUsers(ctx, period)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get daily new users
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT DATE(created_at) as date, COUNT(*) as count
-		FROM users
-		WHERE created_at BETWEEN $1 AND $2
-		GROUP BY DATE(created_at)
-		ORDER BY date`,
-		startDate, endDate)
+	dailyNewUsers, err := s.repo.DailyNewUsers(ctx, period)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	dailyNewUsers := make(map[string]int)
-	for rows.Next() {
-		var date time.Time
-		var count int
-		if err := rows.Scan(&date, &count); err != nil {
-			return nil, err
-		}
-		dailyNewUsers[date.Format("2006-01-02")] = count
-	}
 
 	return map[string]any{
 		"totalUsers":     totalUsers,
 		"newUsers":       newUsers,
 		"activeUsers":    activeUsers,
 		"dailyNewUsers":  dailyNewUsers,
-		"growthRate":     float64(newUsers) / float64(totalUsers-newUsers) * 100,
-		"activationRate": float64(activeUsers) / float64(totalUsers) * 100,
+		"growthRate":     percentage(float64(newUsers), float64(totalUsers-newUsers)),
+		"activationRate": percentage(float64(activeUsers), float64(totalUsers)),
 	}, nil
 }
 
-func (s *Service) generatePlatformActivityReport(ctx context.Context, startDate, endDate time.Time) (map[string]any, error) {
+func (s *Service) generatePlatformActivityReport(ctx context.Context, period Period) (map[string]any, error) {
 	// Get activity counts by type
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT activity_type, COUNT(*) as count
-		FROM user_activities
-		WHERE created_at BETWEEN $1 AND $2
-		GROUP BY activity_type`,
-		startDate, endDate)
+	activityCounts, err := s.repo.ActivityCounts(ctx, period)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	activityCounts := make(map[string]int)
-	for rows.Next() {
-		var activityType string
-		var count int
-		if err := rows.Scan(&activityType, &count); err != nil {
-			return nil, err
-		}
-		activityCounts[activityType] = count
-	}
 
 	// Get daily active users
-	rows, err = s.db.QueryContext(ctx,
-		`SELECT DATE(created_at) as date, COUNT(DISTINCT user_id) as count
-		FROM user_activities
-		WHERE created_at BETWEEN $1 AND $2
-		GROUP BY DATE(created_at)
-		ORDER BY date`,
-		startDate, endDate)
+	dailyActiveUsers, err := s.repo.DailyActiveUsers(ctx, period)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	dailyActiveUsers := make(map[string]int)
-	for rows.Next() {
-		var date time.Time
-		var count int
-		if err := rows.Scan(&date, &count); err != nil {
-			return nil, err
-		}
-		dailyActiveUsers[date.Format("2006-01-02")] = count
-	}
 
 	return map[string]any{
 		"activityCounts":    activityCounts,
@@ -434,52 +338,30 @@ func (s *Service) generatePlatformActivityReport(ctx context.Context, startDate,
 	}, nil
 }
 
-func (s *Service) generateTokenMetricsReport(ctx context.Context, startDate, endDate time.Time) (map[string]any, error) {
-	var totalVolume, stakingVolume float64
-	var totalTransactions, uniqueUsers int
-	err := s.db.QueryRowContext(ctx,
-		`SELECT 
-			COALESCE(SUM(amount), 0) as total_volume,
-			COALESCE(SUM(CASE WHEN type = 'STAKE' THEN amount ELSE 0 END), 0) as staking_volume,
-			COUNT(*) as total_transactions,
-			COUNT(DISTINCT user_id) as unique_users
-		FROM token_transactions
-		WHERE created_at BETWEEN $1 AND $2`,
-		startDate, endDate).Scan(&totalVolume, &stakingVolume, &totalTransactions, &uniqueUsers)
+func (s *Service) generateTokenMetricsReport(ctx context.Context, period Period) (map[string]any, error) {
+	volume, err := s.repo.TokenVolume(ctx, period)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get daily transaction volume
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT DATE(created_at) as date, SUM(amount) as volume
-		FROM token_transactions
-		WHERE created_at BETWEEN $1 AND $2
-		GROUP BY DATE(created_at)
-		ORDER BY date`,
-		startDate, endDate)
+	dailyVolume, err := s.repo.DailyTokenVolume(ctx, period)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	dailyVolume := make(map[string]float64)
-	for rows.Next() {
-		var date time.Time
-		var volume float64
-		if err := rows.Scan(&date, &volume); err != nil {
-			return nil, err
-		}
-		dailyVolume[date.Format("2006-01-02")] = volume
+	averageVolume := 0.0
+	if len(dailyVolume) > 0 {
+		averageVolume = volume.Total / float64(len(dailyVolume))
 	}
 
 	return map[string]any{
-		"totalVolume":       totalVolume,
-		"stakingVolume":     stakingVolume,
-		"totalTransactions": totalTransactions,
-		"uniqueUsers":       uniqueUsers,
+		"totalVolume":       volume.Total,
+		"stakingVolume":     volume.Staked,
+		"totalTransactions": volume.Transactions,
+		"uniqueUsers":       volume.Users,
 		"dailyVolume":       dailyVolume,
-		"averageVolume":     totalVolume / float64(len(dailyVolume)),
+		"averageVolume":     averageVolume,
 	}, nil
 }
 
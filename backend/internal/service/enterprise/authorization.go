@@ -0,0 +1,167 @@
+package enterprise
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/tracing"
+)
+
+var (
+	ErrLastOwner            = apperr.New(apperr.ErrConflict, "last_owner", "organization must keep at least one owner")
+	ErrVotingSystemNotFound = apperr.New(apperr.ErrNotFound, "voting_system_not_found", "voting system not found")
+)
+
+// Organization roles, from most to least privileged
+const (
+	RoleOwner  = "OWNER"
+	RoleAdmin  = "ADMIN"
+	RoleMember = "MEMBER"
+)
+
+// Fine-grained permissions that can be granted to or withheld from members
+// through their permissions JSON, e.g. {"votes:results": true}
+const (
+	PermUpdateOrganization = "organization:update"
+	PermManageMembers      = "members:manage"
+	PermManageAPIKeys      = "api_keys:manage"
+	PermManageVoting       = "voting:manage"
+	PermSubmitVotes        = "votes:submit"
+	PermViewResults        = "votes:results"
+	PermManageWhiteLabel   = "white_label:manage"
+)
+
+// permissions lists every permission
+var permissions = []string{
+	PermUpdateOrganization, PermManageMembers, PermManageAPIKeys,
+	PermManageVoting, PermSubmitVotes, PermViewResults, PermManageWhiteLabel,
+}
+
+// rolePermissions lists the permissions each role has unless overridden
+var rolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermUpdateOrganization, PermManageMembers, PermManageAPIKeys,
+		PermManageVoting, PermSubmitVotes, PermViewResults, PermManageWhiteLabel,
+	},
+	RoleMember: {PermSubmitVotes},
+}
+
+// scopePermissions lists the permissions each API key scope unlocks,
+// besides those of the scopes below it. READ unlocks reads, which need
+// membership alone.
+var scopePermissions = map[string][]string{
+	ScopeWrite: {PermUpdateOrganization, PermManageVoting, PermSubmitVotes, PermManageWhiteLabel},
+	ScopeAdmin: {PermManageMembers, PermManageAPIKeys},
+}
+
+// IsValidRole reports whether role is a known organization role
+func IsValidRole(role string) bool {
+	return roleLevel(role) > 0
+}
+
+// RoleAtLeast reports whether role is at least as privileged as required
+func RoleAtLeast(role, required string) bool {
+	return roleLevel(role) >= roleLevel(required) && roleLevel(role) > 0
+}
+
+func roleLevel(role string) int {
+	switch role {
+	case RoleMember:
+		return 1
+	case RoleAdmin:
+		return 2
+	case RoleOwner:
+		return 3
+	}
+	return 0
+}
+
+// HasPermission reports whether the member holds a permission. Owners hold
+// every permission; for other roles an explicit entry in the member's
+// permissions JSON takes precedence over the role's defaults.
+func (m *Member) HasPermission(permission string) bool {
+	if m.Role == RoleOwner {
+		return true
+	}
+
+	if len(m.Permissions) > 0 {
+		var overrides map[string]bool
+		if err := json.Unmarshal(m.Permissions, &overrides); err == nil {
+			if granted, ok := overrides[permission]; ok {
+				return granted
+			}
+		}
+	}
+
+	for _, p := range rolePermissions[m.Role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether the member holds every permission other holds,
+// so that they may grant other's role and permissions or take them away
+func (m *Member) Covers(other *Member) bool {
+	for _, p := range permissions {
+		if other.HasPermission(p) && !m.HasPermission(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// HoldsScope reports whether the member holds every permission an API key
+// of scope unlocks, and so may create one
+func (m *Member) HoldsScope(scope string) bool {
+	for s, granted := range scopePermissions {
+		if scopeLevel(s) > scopeLevel(scope) {
+			continue
+		}
+		for _, p := range granted {
+			if !m.HasPermission(p) {
+				return false
+			}
+		}
+	}
+	return IsValidScope(scope)
+}
+
+// GetMember retrieves the membership of a user in an organization
+func (s *Service) GetMember(ctx context.Context, orgID, userID int64) (_ *Member, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.GetMember")
+	defer tracing.End(span, &err)
+
+	return s.repo.GetMember(ctx, orgID, userID)
+}
+
+// UpdateMemberPermissions replaces the permission overrides of a member
+func (s *Service) UpdateMemberPermissions(ctx context.Context, orgID, userID int64, permissions json.RawMessage) (err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.UpdateMemberPermissions")
+	defer tracing.End(span, &err)
+
+	return s.repo.UpdateMemberPermissions(ctx, orgID, userID, permissions, time.Now())
+}
+
+// GetVotingSystemOrganization returns the organization a voting system belongs to
+func (s *Service) GetVotingSystemOrganization(ctx context.Context, systemID int64) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.GetVotingSystemOrganization")
+	defer tracing.End(span, &err)
+
+	vs, err := s.repo.GetVotingSystem(ctx, systemID)
+	if err != nil {
+		return 0, err
+	}
+	return vs.OrganizationID, nil
+}
+
+// GetVoteOrganization returns the organization a vote belongs to
+func (s *Service) GetVoteOrganization(ctx context.Context, voteID int64) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.GetVoteOrganization")
+	defer tracing.End(span, &err)
+
+	return s.repo.GetVoteOrganization(ctx, voteID)
+}
@@ -0,0 +1,68 @@
+package enterprise
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Repository stores organizations with their members, API keys, voting
+// systems, votes and white label settings
+type Repository interface {
+	// WithTx runs fn in a transaction, as user.Repository.WithTx does
+	WithTx(ctx context.Context, fn func(Repository) error) error
+
+	// CreateOrganization stores org and sets its ID
+	CreateOrganization(ctx context.Context, org *Organization) error
+	GetOrganization(ctx context.Context, id int64) (*Organization, error)
+	// UpdateOrganization saves the editable fields of org, returning
+	// ErrOrganizationNotFound if it doesn't exist
+	UpdateOrganization(ctx context.Context, org *Organization) error
+
+	// AddMember stores member and sets its ID, returning ErrMemberExists
+	// if the user already belongs to the organization
+	AddMember(ctx context.Context, member *Member) error
+	GetMember(ctx context.Context, orgID, userID int64) (*Member, error)
+	// ListOwners returns the user IDs of the organization's owners,
+	// locking their memberships until the transaction ends
+	ListOwners(ctx context.Context, orgID int64) ([]int64, error)
+	UpdateMemberRole(ctx context.Context, orgID, userID int64, role string, at time.Time) error
+	UpdateMemberPermissions(ctx context.Context, orgID, userID int64, permissions json.RawMessage, at time.Time) error
+
+	// CreateAPIKey stores key under the hash of its plaintext and sets its ID
+	CreateAPIKey(ctx context.Context, key *APIKey, keyHash string) error
+	// GetAPIKeyByHash returns ErrInvalidAPIKey for unknown hashes
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID int64, at time.Time) error
+	ListAPIKeys(ctx context.Context, orgID int64) ([]*APIKey, error)
+	DeleteAPIKey(ctx context.Context, orgID, keyID int64) error
+
+	// CreateVotingSystem stores vs and sets its ID
+	CreateVotingSystem(ctx context.Context, vs *VotingSystem) error
+	GetVotingSystem(ctx context.Context, id int64) (*VotingSystem, error)
+	ListVotingSystems(ctx context.Context, orgID int64) ([]*VotingSystem, error)
+
+	// CreateVote stores vote and sets its ID
+	CreateVote(ctx context.Context, vote *Vote) error
+	// GetVote returns the vote, keeping it from changing until the
+	// transaction ends
+	GetVote(ctx context.Context, id int64) (*Vote, error)
+	// GetVoteOrganization returns the organization a vote belongs to
+	// through its voting system
+	GetVoteOrganization(ctx context.Context, voteID int64) (int64, error)
+	SaveVoteResult(ctx context.Context, voteID int64, status string, result json.RawMessage, at time.Time) error
+
+	// CreateVoteResponse stores resp and sets its ID, returning
+	// ErrVoteAlreadySubmitted if the user already responded
+	CreateVoteResponse(ctx context.Context, resp *VoteResponse) error
+	ListVoteResponses(ctx context.Context, voteID int64) ([]*VoteResponse, error)
+
+	// SaveWhiteLabelSettings creates or replaces an organization's
+	// settings and sets their ID
+	SaveWhiteLabelSettings(ctx context.Context, settings *WhiteLabelSettings) error
+	// GetWhiteLabelSettings returns nil if the organization has none
+	GetWhiteLabelSettings(ctx context.Context, orgID int64) (*WhiteLabelSettings, error)
+	// ListWhiteLabelDomains returns the domains of organizations with
+	// white labelling enabled, in lower case
+	ListWhiteLabelDomains(ctx context.Context) ([]string, error)
+}
@@ -1,25 +1,53 @@
 package enterprise
 
 import (
-	"database/sql"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
+	"strings"
 	"time"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/metrics"
+	"vws-backend/internal/tracing"
 )
 
 var (
-	ErrOrganizationNotFound = errors.New("organization not found")
-	ErrMemberNotFound       = errors.New("member not found")
-	ErrInvalidRole          = errors.New("invalid role")
-	ErrVoteNotFound         = errors.New("vote not found")
-	ErrInvalidDateRange     = errors.New("invalid date range")
-	ErrInvalidVotingType    = errors.New("invalid voting type")
-	ErrVoteExpired          = errors.New("vote has expired")
-	ErrVoteAlreadySubmitted = errors.New("vote already submitted")
+	ErrOrganizationNotFound = apperr.New(apperr.ErrNotFound, "organization_not_found", "organization not found")
+	ErrMemberNotFound       = apperr.New(apperr.ErrNotFound, "member_not_found", "member not found")
+	ErrInvalidRole          = apperr.New(apperr.ErrInvalid, "invalid_role", "invalid role")
+	ErrVoteNotFound         = apperr.New(apperr.ErrNotFound, "vote_not_found", "vote not found")
+	ErrInvalidDateRange     = apperr.New(apperr.ErrInvalid, "invalid_date_range", "invalid date range")
+	ErrInvalidVotingType    = apperr.New(apperr.ErrInvalid, "invalid_voting_type", "invalid voting type")
+	ErrVoteExpired          = apperr.New(apperr.ErrInvalid, "vote_expired", "vote has expired")
+	ErrVoteAlreadySubmitted = apperr.New(apperr.ErrConflict, "vote_already_submitted", "vote already submitted")
+	ErrInvalidScope         = apperr.New(apperr.ErrInvalid, "invalid_scope", "invalid API key scope")
+	ErrInvalidAPIKey        = apperr.New(apperr.ErrUnauthorized, "invalid_api_key", "invalid API key")
+	ErrAPIKeyExpired        = apperr.New(apperr.ErrUnauthorized, "api_key_expired", "API key has expired")
+	ErrAPIKeyNotFound       = apperr.New(apperr.ErrNotFound, "api_key_not_found", "API key not found")
+	ErrMemberExists         = apperr.New(apperr.ErrConflict, "member_exists", "user is already a member")
+)
+
+// API key scopes. Each scope includes the permissions of the ones below it.
+const (
+	ScopeRead  = "READ"
+	ScopeWrite = "WRITE"
+	ScopeAdmin = "ADMIN"
+)
+
+// Vote statuses
+const (
+	VoteStatusPending   = "PENDING"
+	VoteStatusCompleted = "COMPLETED"
 )
 
+// APIKeyPrefix marks plaintext API keys so they are recognisable in logs and secret scanners
+const APIKeyPrefix = "vws_"
+
 type Service struct {
-	db *sql.DB
+	repo Repository
 }
 
 type Organization struct {
@@ -50,6 +78,7 @@ type APIKey struct {
 	ID             int64     `json:"id"`
 	OrganizationID int64     `json:"organization_id"`
 	Name           string    `json:"name"`
+	Key            string    `json:"key,omitempty"` // Plaintext key, only set on creation
 	Scopes         []string  `json:"scopes"`
 	RateLimit      int       `json:"rate_limit"`
 	ExpiresAt      time.Time `json:"expires_at"`
@@ -110,25 +139,38 @@ type WhiteLabelSettings struct {
 	UpdatedAt      time.Time       `json:"updated_at"`
 }
 
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
 }
 
-func (s *Service) CreateOrganization(name, description, contactEmail, domain string, createdBy int64) (*Organization, error) {
+// CreateOrganization creates an organization and makes its creator the first OWNER
+func (s *Service) CreateOrganization(ctx context.Context, name, description, contactEmail, domain string, createdBy int64) (_ *Organization, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.CreateOrganization")
+	defer tracing.End(span, &err)
+
+	now := time.Now()
 	org := &Organization{
 		Name:         name,
 		Description:  description,
 		ContactEmail: contactEmail,
 		Domain:       domain,
 		CreatedBy:    createdBy,
+		CreatedAt:    now,
+		UpdatedAt:    now,
 	}
 
-	err := s.db.QueryRow(
-		`INSERT INTO organizations (name, description, contact_email, domain, created_by)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, updated_at`,
-		name, description, contactEmail, domain, createdBy,
-	).Scan(&org.ID, &org.CreatedAt, &org.UpdatedAt)
+	err = s.repo.WithTx(ctx, func(repo Repository) error {
+		if err := repo.CreateOrganization(ctx, org); err != nil {
+			return err
+		}
+		return repo.AddMember(ctx, &Member{
+			OrganizationID: org.ID,
+			UserID:         createdBy,
+			Role:           RoleOwner,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -136,265 +178,212 @@ func (s *Service) CreateOrganization(name, description, contactEmail, domain str
 	return org, nil
 }
 
-func (s *Service) GetOrganization(id int64) (*Organization, error) {
-	org := &Organization{}
-	err := s.db.QueryRow(
-		`SELECT id, name, description, contact_email, domain,
-		created_by, created_at, updated_at
-		FROM organizations WHERE id = $1`,
-		id,
-	).Scan(
-		&org.ID, &org.Name, &org.Description, &org.ContactEmail,
-		&org.Domain, &org.CreatedBy, &org.CreatedAt, &org.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrOrganizationNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-	return org, nil
+func (s *Service) GetOrganization(ctx context.Context, id int64) (_ *Organization, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.GetOrganization")
+	defer tracing.End(span, &err)
+
+	return s.repo.GetOrganization(ctx, id)
 }
 
-func (s *Service) AddMember(orgID, userID int64, role string) (*Member, error) {
+// AddMember adds a user to an organization with a role and, optionally,
+// permissions overriding the role's defaults
+func (s *Service) AddMember(ctx context.Context, orgID, userID int64, role string, permissions json.RawMessage) (_ *Member, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.AddMember")
+	defer tracing.End(span, &err)
+
+	if !IsValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	now := time.Now()
 	member := &Member{
 		OrganizationID: orgID,
 		UserID:         userID,
 		Role:           role,
+		Permissions:    permissions,
+		CreatedAt:      now,
+		UpdatedAt:      now,
 	}
-
-	err := s.db.QueryRow(
-		`INSERT INTO organization_members (organization_id, user_id, role)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at, updated_at`,
-		orgID, userID, role,
-	).Scan(&member.ID, &member.CreatedAt, &member.UpdatedAt)
-	if err != nil {
+	if err := s.repo.AddMember(ctx, member); err != nil {
 		return nil, err
 	}
 
 	return member, nil
 }
 
-func (s *Service) UpdateMemberRole(orgID, userID int64, role string) error {
-	result, err := s.db.Exec(
-		`UPDATE organization_members SET role = $1, updated_at = NOW()
-		WHERE organization_id = $2 AND user_id = $3`,
-		role, orgID, userID,
-	)
-	if err != nil {
-		return err
-	}
+// UpdateMemberRole changes a member's role. The last OWNER of an
+// organization can't be demoted, so it always has someone in control.
+func (s *Service) UpdateMemberRole(ctx context.Context, orgID, userID int64, role string) (err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.UpdateMemberRole")
+	defer tracing.End(span, &err)
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if rows == 0 {
-		return ErrMemberNotFound
+	if !IsValidRole(role) {
+		return ErrInvalidRole
 	}
 
-	return nil
+	return s.repo.WithTx(ctx, func(repo Repository) error {
+		// Lock the owners so concurrent demotions can't both pass the check
+		owners, err := repo.ListOwners(ctx, orgID)
+		if err != nil {
+			return err
+		}
+
+		if role != RoleOwner && len(owners) == 1 && owners[0] == userID {
+			return ErrLastOwner
+		}
+
+		return repo.UpdateMemberRole(ctx, orgID, userID, role, time.Now())
+	})
 }
 
-func (s *Service) CreateAPIKey(orgID int64, name string, scopes []string, rateLimit int, expiresAt time.Time, createdBy int64) (*APIKey, error) {
-	scopesJSON, err := json.Marshal(scopes)
-	if err != nil {
-		return nil, err
+func (s *Service) CreateAPIKey(ctx context.Context, orgID int64, name string, scopes []string, rateLimit int, expiresAt time.Time, createdBy int64) (_ *APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.CreateAPIKey")
+	defer tracing.End(span, &err)
+
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !IsValidScope(scope) {
+			return nil, ErrInvalidScope
+		}
 	}
 
-	key := &APIKey{}
-	err = s.db.QueryRow(
-		`INSERT INTO api_keys (organization_id, name, scopes, rate_limit, expires_at, created_by)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at`,
-		orgID, name, scopesJSON, rateLimit, expiresAt, createdBy,
-	).Scan(&key.ID, &key.CreatedAt, &key.UpdatedAt)
+	plaintext, keyHash, err := generateAPIKey()
 	if err != nil {
 		return nil, err
 	}
 
-	key.OrganizationID = orgID
-	key.Name = name
-	key.Scopes = scopes
-	key.RateLimit = rateLimit
-	key.ExpiresAt = expiresAt
-	key.CreatedBy = createdBy
+	now := time.Now()
+	key := &APIKey{
+		OrganizationID: orgID,
+		Name:           name,
+		Key:            plaintext,
+		Scopes:         scopes,
+		RateLimit:      rateLimit,
+		ExpiresAt:      expiresAt,
+		CreatedBy:      createdBy,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := s.repo.CreateAPIKey(ctx, key, keyHash); err != nil {
+		return nil, err
+	}
 
 	return key, nil
 }
 
-func (s *Service) ValidateAPIKey(keyID, orgID int64) (*APIKey, error) {
-	key := &APIKey{}
-	var scopesJSON []byte
-	err := s.db.QueryRow(
-		`SELECT id, organization_id, name, scopes, rate_limit,
-		expires_at, last_used_at, created_by, created_at, updated_at
-		FROM api_keys WHERE id = $1 AND organization_id = $2`,
-		keyID, orgID,
-	).Scan(
-		&key.ID, &key.OrganizationID, &key.Name, &scopesJSON,
-		&key.RateLimit, &key.ExpiresAt, &key.LastUsedAt,
-		&key.CreatedBy, &key.CreatedAt, &key.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
+// ValidateAPIKey looks up a plaintext API key by its hash, rejects expired
+// keys and records the time it was last used
+func (s *Service) ValidateAPIKey(ctx context.Context, plaintext string) (_ *APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.ValidateAPIKey")
+	defer tracing.End(span, &err)
+
+	if !strings.HasPrefix(plaintext, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
 	}
 
-	err = json.Unmarshal(scopesJSON, &key.Scopes)
+	key, err := s.repo.GetAPIKeyByHash(ctx, hashAPIKey(plaintext))
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = s.db.Exec(
-		`UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`,
-		keyID,
-	)
-	if err != nil {
+	now := time.Now()
+	if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	if err := s.repo.TouchAPIKey(ctx, key.ID, now); err != nil {
 		return nil, err
 	}
 
 	return key, nil
 }
 
-func (s *Service) ListAPIKeys(orgID int64) ([]*APIKey, error) {
-	rows, err := s.db.Query(
-		`SELECT id, organization_id, name, scopes, rate_limit,
-		expires_at, last_used_at, created_by, created_at, updated_at
-		FROM api_keys WHERE organization_id = $1`,
-		orgID,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var keys []*APIKey
-	for rows.Next() {
-		key := &APIKey{}
-		var scopesJSON []byte
-		err := rows.Scan(
-			&key.ID, &key.OrganizationID, &key.Name, &scopesJSON,
-			&key.RateLimit, &key.ExpiresAt, &key.LastUsedAt,
-			&key.CreatedBy, &key.CreatedAt, &key.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
+func (s *Service) ListAPIKeys(ctx context.Context, orgID int64) (_ []*APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.ListAPIKeys")
+	defer tracing.End(span, &err)
 
-		err = json.Unmarshal(scopesJSON, &key.Scopes)
-		if err != nil {
-			return nil, err
-		}
+	return s.repo.ListAPIKeys(ctx, orgID)
+}
 
-		keys = append(keys, key)
-	}
-	return keys, rows.Err()
+func (s *Service) RevokeAPIKey(ctx context.Context, orgID, keyID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.RevokeAPIKey")
+	defer tracing.End(span, &err)
+
+	return s.repo.DeleteAPIKey(ctx, orgID, keyID)
 }
 
-func (s *Service) RevokeAPIKey(orgID, keyID int64) error {
-	result, err := s.db.Exec(
-		`DELETE FROM api_keys WHERE organization_id = $1 AND id = $2`,
-		orgID, keyID,
-	)
-	if err != nil {
-		return err
-	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if rows == 0 {
-		return sql.ErrNoRows
+// HasScope reports whether the key grants the required scope
+func (k *APIKey) HasScope(required string) bool {
+	for _, scope := range k.Scopes {
+		if scopeLevel(scope) >= scopeLevel(required) {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
-func (s *Service) ListVotingSystems(orgID int64) ([]*VotingSystem, error) {
-	rows, err := s.db.Query(
-		`SELECT id, organization_id, name, description, voting_type,
-		config, active, created_by, created_at, updated_at
-		FROM voting_systems WHERE organization_id = $1`,
-		orgID,
-	)
-	if err != nil {
-		return nil, err
+func scopeLevel(scope string) int {
+	switch scope {
+	case ScopeRead:
+		return 1
+	case ScopeWrite:
+		return 2
+	case ScopeAdmin:
+		return 3
 	}
-	defer rows.Close()
+	return 0
+}
 
-	var systems []*VotingSystem
-	for rows.Next() {
-		vs := &VotingSystem{}
-		err := rows.Scan(
-			&vs.ID, &vs.OrganizationID, &vs.Name, &vs.Description,
-			&vs.VotingType, &vs.Config, &vs.Active, &vs.CreatedBy,
-			&vs.CreatedAt, &vs.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		systems = append(systems, vs)
+// IsValidScope reports whether scope is a known API key scope
+func IsValidScope(scope string) bool {
+	return scopeLevel(scope) > 0
+}
+
+// generateAPIKey returns a new plaintext API key and the hash stored for it
+func generateAPIKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
 	}
-	return systems, rows.Err()
+	plaintext := APIKeyPrefix + hex.EncodeToString(b)
+	return plaintext, hashAPIKey(plaintext), nil
 }
 
-func (s *Service) GetVoteResults(voteID int64) (map[string]interface{}, error) {
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Service) ListVotingSystems(ctx context.Context, orgID int64) (_ []*VotingSystem, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.ListVotingSystems")
+	defer tracing.End(span, &err)
+
+	return s.repo.ListVotingSystems(ctx, orgID)
+}
+
+func (s *Service) GetVoteResults(ctx context.Context, voteID int64) (_ map[string]interface{}, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.GetVoteResults")
+	defer tracing.End(span, &err)
+
 	// Get vote details
-	vote := &Vote{}
-	err := s.db.QueryRow(
-		`SELECT id, voting_system_id, title, description, options,
-		start_date, end_date, status, result, created_by, created_at, updated_at
-		FROM votes WHERE id = $1`,
-		voteID,
-	).Scan(
-		&vote.ID, &vote.VotingSystemID, &vote.Title, &vote.Description,
-		&vote.Options, &vote.StartDate, &vote.EndDate, &vote.Status,
-		&vote.Result, &vote.CreatedBy, &vote.CreatedAt, &vote.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrVoteNotFound
-	}
+	vote, err := s.repo.GetVote(ctx, voteID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get voting system details
-	vs := &VotingSystem{}
-	err = s.db.QueryRow(
-		`SELECT voting_type, config FROM voting_systems WHERE id = $1`,
-		vote.VotingSystemID,
-	).Scan(&vs.VotingType, &vs.Config)
+	vs, err := s.repo.GetVotingSystem(ctx, vote.VotingSystemID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get all responses
-	rows, err := s.db.Query(
-		`SELECT response, weight FROM vote_responses WHERE vote_id = $1`,
-		voteID,
-	)
+	responses, err := s.repo.ListVoteResponses(ctx, voteID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var responses []struct {
-		Response json.RawMessage
-		Weight   float64
-	}
-	for rows.Next() {
-		var resp struct {
-			Response json.RawMessage
-			Weight   float64
-		}
-		if err := rows.Scan(&resp.Response, &resp.Weight); err != nil {
-			return nil, err
-		}
-		responses = append(responses, resp)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
 
 	// Calculate results based on voting type
 	var results map[string]interface{}
@@ -417,11 +406,7 @@ func (s *Service) GetVoteResults(voteID int64) (map[string]interface{}, error) {
 		return nil, err
 	}
 
-	_, err = s.db.Exec(
-		`UPDATE votes SET result = $1, status = 'COMPLETED', updated_at = NOW()
-		WHERE id = $2`,
-		resultJSON, voteID,
-	)
+	err = s.repo.SaveVoteResult(ctx, voteID, VoteStatusCompleted, resultJSON, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -429,10 +414,7 @@ func (s *Service) GetVoteResults(voteID int64) (map[string]interface{}, error) {
 	return results, nil
 }
 
-func calculateMajorityResults(responses []struct {
-	Response json.RawMessage
-	Weight   float64
-}) map[string]interface{} {
+func calculateMajorityResults(responses []*VoteResponse) map[string]interface{} {
 	counts := make(map[string]int)
 	total := 0
 
@@ -457,10 +439,7 @@ func calculateMajorityResults(responses []struct {
 	}
 }
 
-func calculateWeightedResults(responses []struct {
-	Response json.RawMessage
-	Weight   float64
-}) map[string]interface{} {
+func calculateWeightedResults(responses []*VoteResponse) map[string]interface{} {
 	weights := make(map[string]float64)
 	totalWeight := 0.0
 
@@ -485,10 +464,7 @@ func calculateWeightedResults(responses []struct {
 	}
 }
 
-func calculateConsensusResults(responses []struct {
-	Response json.RawMessage
-	Weight   float64
-}) map[string]interface{} {
+func calculateConsensusResults(responses []*VoteResponse) map[string]interface{} {
 	type consensusResponse struct {
 		Choice string `json:"choice"`
 		Level  int    `json:"level"` // 1: Strongly Agree, 2: Agree, 3: Neutral, 4: Disagree, 5: Strongly Disagree
@@ -525,10 +501,7 @@ func calculateConsensusResults(responses []struct {
 	}
 }
 
-func calculateCustomResults(responses []struct {
-	Response json.RawMessage
-	Weight   float64
-}, config json.RawMessage) map[string]interface{} {
+func calculateCustomResults(responses []*VoteResponse, config json.RawMessage) map[string]interface{} {
 	// Custom calculation based on config
 	// This is a placeholder that returns raw response data
 	var rawResponses []interface{}
@@ -550,130 +523,88 @@ func calculateCustomResults(responses []struct {
 	}
 }
 
-func (s *Service) UpdateOrganization(org *Organization) error {
-	result, err := s.db.Exec(
-		`UPDATE organizations 
-		SET name = $1, description = $2, contact_email = $3, domain = $4,
-		logo_url = $5, website_url = $6, settings = $7, updated_at = NOW()
-		WHERE id = $8`,
-		org.Name, org.Description, org.ContactEmail, org.Domain,
-		org.LogoURL, org.WebsiteURL, org.Settings, org.ID,
-	)
-	if err != nil {
-		return err
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if rows == 0 {
-		return ErrOrganizationNotFound
-	}
+func (s *Service) UpdateOrganization(ctx context.Context, org *Organization) (err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.UpdateOrganization")
+	defer tracing.End(span, &err)
 
-	return nil
+	org.UpdatedAt = time.Now()
+	return s.repo.UpdateOrganization(ctx, org)
 }
 
-func (s *Service) CreateVotingSystem(vs *VotingSystem) error {
-	err := s.db.QueryRow(
-		`INSERT INTO voting_systems (organization_id, name, description, voting_type, config, active, created_by)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, created_at, updated_at`,
-		vs.OrganizationID, vs.Name, vs.Description, vs.VotingType,
-		vs.Config, vs.Active, vs.CreatedBy,
-	).Scan(&vs.ID, &vs.CreatedAt, &vs.UpdatedAt)
-	return err
+func (s *Service) CreateVotingSystem(ctx context.Context, vs *VotingSystem) (err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.CreateVotingSystem")
+	defer tracing.End(span, &err)
+
+	vs.CreatedAt = time.Now()
+	vs.UpdatedAt = vs.CreatedAt
+	return s.repo.CreateVotingSystem(ctx, vs)
 }
 
-func (s *Service) CreateVote(vote *Vote) error {
+func (s *Service) CreateVote(ctx context.Context, vote *Vote) (err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.CreateVote")
+	defer tracing.End(span, &err)
+
 	if vote.EndDate.Before(vote.StartDate) {
 		return ErrInvalidDateRange
 	}
 
-	err := s.db.QueryRow(
-		`INSERT INTO votes (voting_system_id, title, description, options, start_date, end_date, status, created_by)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, created_at, updated_at`,
-		vote.VotingSystemID, vote.Title, vote.Description, vote.Options,
-		vote.StartDate, vote.EndDate, vote.Status, vote.CreatedBy,
-	).Scan(&vote.ID, &vote.CreatedAt, &vote.UpdatedAt)
-	return err
+	vote.CreatedAt = time.Now()
+	vote.UpdatedAt = vote.CreatedAt
+	return s.repo.CreateVote(ctx, vote)
 }
 
-func (s *Service) SubmitVoteResponse(resp *VoteResponse) error {
-	// Check if vote exists and is active
-	var startDate, endDate time.Time
-	var status string
-	err := s.db.QueryRow(
-		`SELECT start_date, end_date, status FROM votes WHERE id = $1`,
-		resp.VoteID,
-	).Scan(&startDate, &endDate, &status)
-	if err == sql.ErrNoRows {
-		return ErrVoteNotFound
-	}
-	if err != nil {
-		return err
-	}
+// SubmitVoteResponse records a user's response to a vote that is open. The
+// vote is read with a shared lock in the transaction storing the response,
+// so it can't be changed or closed before the response is stored.
+func (s *Service) SubmitVoteResponse(ctx context.Context, resp *VoteResponse) (err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.SubmitVoteResponse")
+	defer tracing.End(span, &err)
 
-	now := time.Now()
-	if now.Before(startDate) || now.After(endDate) {
-		return ErrVoteExpired
-	}
+	err = s.repo.WithTx(ctx, func(repo Repository) error {
+		// Check if vote exists and is active
+		vote, err := repo.GetVote(ctx, resp.VoteID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if now.Before(vote.StartDate) || now.After(vote.EndDate) {
+			return ErrVoteExpired
+		}
 
-	// Check if user has already voted
-	var count int
-	err = s.db.QueryRow(
-		`SELECT COUNT(*) FROM vote_responses WHERE vote_id = $1 AND user_id = $2`,
-		resp.VoteID, resp.UserID,
-	).Scan(&count)
+		// Submit response, refused if the user has already voted
+		resp.CreatedAt = now
+		resp.UpdatedAt = now
+		return repo.CreateVoteResponse(ctx, resp)
+	})
 	if err != nil {
 		return err
 	}
-	if count > 0 {
-		return ErrVoteAlreadySubmitted
-	}
-
-	// Submit response
-	err = s.db.QueryRow(
-		`INSERT INTO vote_responses (vote_id, user_id, response, weight)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, updated_at`,
-		resp.VoteID, resp.UserID, resp.Response, resp.Weight,
-	).Scan(&resp.ID, &resp.CreatedAt, &resp.UpdatedAt)
-	return err
-}
-
-func (s *Service) UpdateWhiteLabelSettings(settings *WhiteLabelSettings) error {
-	err := s.db.QueryRow(
-		`INSERT INTO white_label_settings 
-		(organization_id, domain, theme_config, custom_css, custom_js, enabled)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (organization_id) DO UPDATE
-		SET domain = $2, theme_config = $3, custom_css = $4, custom_js = $5, enabled = $6,
-		updated_at = NOW()
-		RETURNING id, created_at, updated_at`,
-		settings.OrganizationID, settings.Domain, settings.ThemeConfig,
-		settings.CustomCSS, settings.CustomJS, settings.Enabled,
-	).Scan(&settings.ID, &settings.CreatedAt, &settings.UpdatedAt)
-	return err
-}
-
-func (s *Service) GetWhiteLabelSettings(orgID int64) (*WhiteLabelSettings, error) {
-	settings := &WhiteLabelSettings{OrganizationID: orgID}
-	err := s.db.QueryRow(
-		`SELECT id, domain, theme_config, custom_css, custom_js, enabled, created_at, updated_at
-		FROM white_label_settings WHERE organization_id = $1`,
-		orgID,
-	).Scan(
-		&settings.ID, &settings.Domain, &settings.ThemeConfig,
-		&settings.CustomCSS, &settings.CustomJS, &settings.Enabled,
-		&settings.CreatedAt, &settings.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return settings, nil
+
+	metrics.VoteResponses.Inc()
+	return nil
+}
+
+func (s *Service) UpdateWhiteLabelSettings(ctx context.Context, settings *WhiteLabelSettings) (err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.UpdateWhiteLabelSettings")
+	defer tracing.End(span, &err)
+
+	settings.UpdatedAt = time.Now()
+	return s.repo.SaveWhiteLabelSettings(ctx, settings)
+}
+
+func (s *Service) GetWhiteLabelSettings(ctx context.Context, orgID int64) (_ *WhiteLabelSettings, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.GetWhiteLabelSettings")
+	defer tracing.End(span, &err)
+
+	return s.repo.GetWhiteLabelSettings(ctx, orgID)
+}
+
+// WhiteLabelDomains returns the domains of organizations with white
+// labelling enabled, which may call the API from them
+func (s *Service) WhiteLabelDomains(ctx context.Context) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "enterprise.WhiteLabelDomains")
+	defer tracing.End(span, &err)
+
+	return s.repo.ListWhiteLabelDomains(ctx)
 }
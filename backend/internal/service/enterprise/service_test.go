@@ -1,25 +1,59 @@
-package enterprise
+package enterprise_test
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/store/memory"
 )
 
-func setupTest(t *testing.T) (*Service, sqlmock.Sqlmock) {
-	db, mock, err := sqlmock.New()
+func setupTest(t *testing.T) *enterprise.Service {
+	t.Helper()
+	return enterprise.NewService(memory.New().Enterprise())
+}
+
+// setupOrganization creates an organization owned by user 1
+func setupOrganization(t *testing.T, service *enterprise.Service) *enterprise.Organization {
+	t.Helper()
+	ctx := context.Background()
+	org, err := service.CreateOrganization(ctx, "Test Org", "Test Description", "test@example.com", "example.com", 1)
 	require.NoError(t, err)
-	service := NewService(db)
-	return service, mock
+	return org
+}
+
+// setupVote creates a voting system of the given type with a vote open
+// for the next day
+func setupVote(t *testing.T, service *enterprise.Service, orgID int64, votingType string) *enterprise.Vote {
+	t.Helper()
+	ctx := context.Background()
+
+	vs := &enterprise.VotingSystem{OrganizationID: orgID, Name: "Board", VotingType: votingType, Active: true, CreatedBy: 1}
+	require.NoError(t, service.CreateVotingSystem(ctx, vs))
+	vote := &enterprise.Vote{
+		VotingSystemID: vs.ID,
+		Title:          "Test Vote",
+		Options:        json.RawMessage(`["option1", "option2"]`),
+		StartDate:      time.Now().Add(-time.Hour),
+		EndDate:        time.Now().Add(23 * time.Hour),
+		Status:         enterprise.VoteStatusPending,
+		CreatedBy:      1,
+	}
+	require.NoError(t, service.CreateVote(ctx, vote))
+	return vote
 }
 
 func TestCreateOrganization(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	ctx := context.Background()
 
 	name := "Test Org"
 	description := "Test Description"
@@ -27,163 +61,341 @@ func TestCreateOrganization(t *testing.T) {
 	domain := "example.com"
 	createdBy := int64(1)
 
-	mock.ExpectQuery(`INSERT INTO organizations`).
-		WithArgs(name, description, contactEmail, domain, createdBy).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-			AddRow(1, time.Now(), time.Now()))
-
-	org, err := service.CreateOrganization(name, description, contactEmail, domain, createdBy)
+	org, err := service.CreateOrganization(ctx, name, description, contactEmail, domain, createdBy)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), org.ID)
+	assert.NotZero(t, org.ID)
 	assert.Equal(t, name, org.Name)
 	assert.Equal(t, description, org.Description)
 	assert.Equal(t, contactEmail, org.ContactEmail)
 	assert.Equal(t, domain, org.Domain)
 	assert.Equal(t, createdBy, org.CreatedBy)
+
+	member, err := service.GetMember(ctx, org.ID, createdBy)
+	require.NoError(t, err)
+	assert.Equal(t, enterprise.RoleOwner, member.Role, "the creator owns the organization")
 }
 
 func TestGetOrganization(t *testing.T) {
-	service, mock := setupTest(t)
-
-	now := time.Now()
-	mock.ExpectQuery(`SELECT .+ FROM organizations WHERE id = \$1`).
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"id", "name", "description", "contact_email", "domain",
-			"created_by", "created_at", "updated_at",
-		}).AddRow(
-			1, "Test Org", "Test Description", "test@example.com",
-			"example.com", 1, now, now,
-		))
-
-	org, err := service.GetOrganization(1)
+	service := setupTest(t)
+	ctx := context.Background()
+	created := setupOrganization(t, service)
+
+	org, err := service.GetOrganization(ctx, created.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, "Test Org", org.Name)
 	assert.Equal(t, "test@example.com", org.ContactEmail)
 }
 
 func TestGetOrganization_NotFound(t *testing.T) {
-	service, mock := setupTest(t)
-
-	mock.ExpectQuery(`SELECT .+ FROM organizations WHERE id = \$1`).
-		WithArgs(1).
-		WillReturnError(sql.ErrNoRows)
+	service := setupTest(t)
+	ctx := context.Background()
 
-	org, err := service.GetOrganization(1)
+	org, err := service.GetOrganization(ctx, 1)
 	assert.Error(t, err)
-	assert.Equal(t, ErrOrganizationNotFound, err)
+	assert.Equal(t, enterprise.ErrOrganizationNotFound, err)
 	assert.Nil(t, org)
 }
 
+func TestUpdateOrganization(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+
+	org.Name = "Renamed"
+	require.NoError(t, service.UpdateOrganization(ctx, org))
+
+	got, err := service.GetOrganization(ctx, org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", got.Name)
+
+	assert.Equal(t, enterprise.ErrOrganizationNotFound,
+		service.UpdateOrganization(ctx, &enterprise.Organization{ID: org.ID + 100}))
+}
+
 func TestAddMember(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
 
-	orgID := int64(1)
 	userID := int64(2)
 	role := "ADMIN"
 
-	mock.ExpectQuery(`INSERT INTO organization_members`).
-		WithArgs(orgID, userID, role).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-			AddRow(1, time.Now(), time.Now()))
-
-	member, err := service.AddMember(orgID, userID, role)
+	member, err := service.AddMember(ctx, org.ID, userID, role, nil)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), member.ID)
-	assert.Equal(t, orgID, member.OrganizationID)
+	assert.NotZero(t, member.ID)
+	assert.Equal(t, org.ID, member.OrganizationID)
 	assert.Equal(t, userID, member.UserID)
 	assert.Equal(t, role, member.Role)
+
+	_, err = service.AddMember(ctx, org.ID, userID, enterprise.RoleMember, nil)
+	assert.Equal(t, enterprise.ErrMemberExists, err)
+
+	_, err = service.AddMember(ctx, org.ID, 3, enterprise.RoleMember, json.RawMessage(`{"votes:results": true}`))
+	require.NoError(t, err)
+	member, err = service.GetMember(ctx, org.ID, 3)
+	require.NoError(t, err)
+	assert.True(t, member.HasPermission(enterprise.PermViewResults), "permissions are stored with the member")
 }
 
 func TestUpdateMemberRole(t *testing.T) {
-	service, mock := setupTest(t)
-
-	mock.ExpectExec(`UPDATE organization_members SET role = \$1, updated_at = NOW\(\) WHERE organization_id = \$2 AND user_id = \$3`).
-		WithArgs("OWNER", 1, 2).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	_, err := service.AddMember(ctx, org.ID, 2, enterprise.RoleMember, nil)
+	require.NoError(t, err)
 
-	err := service.UpdateMemberRole(1, 2, "OWNER")
+	err = service.UpdateMemberRole(ctx, org.ID, 2, "OWNER")
 	assert.NoError(t, err)
+
+	member, err := service.GetMember(ctx, org.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, enterprise.RoleOwner, member.Role)
 }
 
 func TestUpdateMemberRole_NotFound(t *testing.T) {
-	service, mock := setupTest(t)
-
-	mock.ExpectExec(`UPDATE organization_members SET role = \$1, updated_at = NOW\(\) WHERE organization_id = \$2 AND user_id = \$3`).
-		WithArgs("OWNER", 1, 2).
-		WillReturnResult(sqlmock.NewResult(0, 0))
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
 
-	err := service.UpdateMemberRole(1, 2, "OWNER")
+	err := service.UpdateMemberRole(ctx, org.ID, 2, "OWNER")
 	assert.Error(t, err)
-	assert.Equal(t, ErrMemberNotFound, err)
+	assert.Equal(t, enterprise.ErrMemberNotFound, err)
+}
+
+func TestUpdateMemberRole_LastOwner(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+
+	err := service.UpdateMemberRole(ctx, org.ID, 1, enterprise.RoleAdmin)
+	assert.Equal(t, enterprise.ErrLastOwner, err)
+
+	member, err := service.GetMember(ctx, org.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, enterprise.RoleOwner, member.Role)
+}
+
+func TestUpdateMemberRole_DemoteOwnerWithCoOwner(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	_, err := service.AddMember(ctx, org.ID, 2, enterprise.RoleOwner, nil)
+	require.NoError(t, err)
+
+	err = service.UpdateMemberRole(ctx, org.ID, 1, enterprise.RoleMember)
+	assert.NoError(t, err)
+
+	err = service.UpdateMemberRole(ctx, org.ID, 2, enterprise.RoleMember)
+	assert.Equal(t, enterprise.ErrLastOwner, err, "the remaining owner stays")
+}
+
+func TestUpdateMemberRole_InvalidRole(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+
+	err := service.UpdateMemberRole(ctx, 1, 2, "SUPERUSER")
+	assert.Equal(t, enterprise.ErrInvalidRole, err)
+}
+
+func TestGetMember(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	_, err := service.AddMember(ctx, org.ID, 2, enterprise.RoleMember, nil)
+	require.NoError(t, err)
+	require.NoError(t, service.UpdateMemberPermissions(ctx, org.ID, 2, json.RawMessage(`{"votes:results": true}`)))
+
+	member, err := service.GetMember(ctx, org.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, enterprise.RoleMember, member.Role)
+	assert.True(t, member.HasPermission(enterprise.PermViewResults))
+}
+
+func TestGetMember_NotFound(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+
+	member, err := service.GetMember(ctx, 1, 2)
+	assert.Equal(t, enterprise.ErrMemberNotFound, err)
+	assert.Nil(t, member)
+}
+
+func TestMemberHasPermission(t *testing.T) {
+	owner := &enterprise.Member{Role: enterprise.RoleOwner, Permissions: json.RawMessage(`{"members:manage": false}`)}
+	assert.True(t, owner.HasPermission(enterprise.PermManageMembers), "owners can't be restricted")
+
+	admin := &enterprise.Member{Role: enterprise.RoleAdmin}
+	assert.True(t, admin.HasPermission(enterprise.PermManageAPIKeys))
+
+	restricted := &enterprise.Member{Role: enterprise.RoleAdmin, Permissions: json.RawMessage(`{"api_keys:manage": false}`)}
+	assert.False(t, restricted.HasPermission(enterprise.PermManageAPIKeys))
+	assert.True(t, restricted.HasPermission(enterprise.PermManageVoting))
+
+	member := &enterprise.Member{Role: enterprise.RoleMember}
+	assert.True(t, member.HasPermission(enterprise.PermSubmitVotes))
+	assert.False(t, member.HasPermission(enterprise.PermViewResults))
+}
+
+func TestMemberCovers(t *testing.T) {
+	owner := &enterprise.Member{Role: enterprise.RoleOwner}
+	admin := &enterprise.Member{Role: enterprise.RoleAdmin}
+	restricted := &enterprise.Member{Role: enterprise.RoleAdmin, Permissions: json.RawMessage(`{"api_keys:manage": false}`)}
+	manager := &enterprise.Member{Role: enterprise.RoleMember, Permissions: json.RawMessage(`{"members:manage": true}`)}
+	member := &enterprise.Member{Role: enterprise.RoleMember}
+
+	assert.True(t, owner.Covers(admin))
+	assert.True(t, admin.Covers(restricted))
+	assert.False(t, restricted.Covers(admin), "api_keys:manage is withheld")
+	assert.False(t, manager.Covers(admin))
+	assert.True(t, manager.Covers(member))
+	assert.False(t, member.Covers(manager))
+}
+
+func TestMemberHoldsScope(t *testing.T) {
+	admin := &enterprise.Member{Role: enterprise.RoleAdmin}
+	restricted := &enterprise.Member{Role: enterprise.RoleAdmin, Permissions: json.RawMessage(`{"members:manage": false}`)}
+	keyManager := &enterprise.Member{Role: enterprise.RoleMember, Permissions: json.RawMessage(`{"api_keys:manage": true}`)}
+
+	assert.True(t, admin.HoldsScope(enterprise.ScopeAdmin))
+	assert.False(t, restricted.HoldsScope(enterprise.ScopeAdmin), "members:manage is withheld")
+	assert.True(t, restricted.HoldsScope(enterprise.ScopeWrite))
+	assert.False(t, keyManager.HoldsScope(enterprise.ScopeAdmin), "WRITE permissions are missing")
+	assert.False(t, keyManager.HoldsScope(enterprise.ScopeWrite))
+	assert.True(t, keyManager.HoldsScope(enterprise.ScopeRead))
+	assert.False(t, admin.HoldsScope("SUPERUSER"))
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	assert.True(t, enterprise.RoleAtLeast(enterprise.RoleOwner, enterprise.RoleAdmin))
+	assert.True(t, enterprise.RoleAtLeast(enterprise.RoleAdmin, enterprise.RoleAdmin))
+	assert.False(t, enterprise.RoleAtLeast(enterprise.RoleMember, enterprise.RoleAdmin))
+	assert.False(t, enterprise.RoleAtLeast("GUEST", enterprise.RoleMember))
+}
+
+func TestGetVoteOrganization(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	vote := setupVote(t, service, org.ID, "MAJORITY")
+
+	orgID, err := service.GetVoteOrganization(ctx, vote.ID)
+	require.NoError(t, err)
+	assert.Equal(t, org.ID, orgID)
+
+	orgID, err = service.GetVotingSystemOrganization(ctx, vote.VotingSystemID)
+	require.NoError(t, err)
+	assert.Equal(t, org.ID, orgID)
+
+	_, err = service.GetVoteOrganization(ctx, vote.ID+100)
+	assert.Equal(t, enterprise.ErrVoteNotFound, err)
 }
 
 func TestCreateAPIKey(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
 
-	orgID := int64(1)
 	name := "Test Key"
 	scopes := []string{"READ", "WRITE"}
 	rateLimit := 1000
 	expiresAt := time.Now().Add(24 * time.Hour)
 	createdBy := int64(2)
 
-	scopesJSON, err := json.Marshal(scopes)
-	require.NoError(t, err)
-
-	mock.ExpectQuery(`INSERT INTO api_keys`).
-		WithArgs(orgID, name, scopesJSON, rateLimit, expiresAt, createdBy).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-			AddRow(1, time.Now(), time.Now()))
-
-	key, err := service.CreateAPIKey(orgID, name, scopes, rateLimit, expiresAt, createdBy)
+	key, err := service.CreateAPIKey(ctx, org.ID, name, scopes, rateLimit, expiresAt, createdBy)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), key.ID)
-	assert.Equal(t, orgID, key.OrganizationID)
+	assert.NotZero(t, key.ID)
+	assert.Equal(t, org.ID, key.OrganizationID)
 	assert.Equal(t, name, key.Name)
+	assert.True(t, strings.HasPrefix(key.Key, enterprise.APIKeyPrefix))
 	assert.Equal(t, scopes, key.Scopes)
 	assert.Equal(t, rateLimit, key.RateLimit)
 	assert.Equal(t, expiresAt.Unix(), key.ExpiresAt.Unix())
 	assert.Equal(t, createdBy, key.CreatedBy)
+
+	keys, err := service.ListAPIKeys(ctx, org.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Empty(t, keys[0].Key, "the plaintext is only returned on creation")
+}
+
+func TestCreateAPIKey_InvalidScope(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+
+	_, err := service.CreateAPIKey(ctx, 1, "Test Key", []string{"SUPERUSER"}, 1000, time.Time{}, 2)
+	assert.Equal(t, enterprise.ErrInvalidScope, err)
+
+	_, err = service.CreateAPIKey(ctx, 1, "Test Key", nil, 1000, time.Time{}, 2)
+	assert.Equal(t, enterprise.ErrInvalidScope, err)
 }
 
 func TestValidateAPIKey(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
 
-	keyID := int64(1)
-	orgID := int64(1)
-	now := time.Now()
-	expiresAt := now.Add(24 * time.Hour)
-	scopes := []string{"READ", "WRITE"}
-	scopesJSON, err := json.Marshal(scopes)
+	created, err := service.CreateAPIKey(ctx, org.ID, "Test Key", []string{"READ", "WRITE"}, 1000, time.Now().Add(24*time.Hour), 2)
 	require.NoError(t, err)
 
-	mock.ExpectQuery(`SELECT .+ FROM api_keys WHERE id = \$1 AND organization_id = \$2`).
-		WithArgs(keyID, orgID).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"id", "organization_id", "name", "scopes", "rate_limit",
-			"expires_at", "last_used_at", "created_by", "created_at", "updated_at",
-		}).AddRow(
-			keyID, orgID, "Test Key", scopesJSON, 1000,
-			expiresAt, now, 2, now, now,
-		))
-
-	mock.ExpectExec(`UPDATE api_keys SET last_used_at = NOW\(\) WHERE id = \$1`).
-		WithArgs(keyID).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	key, err := service.ValidateAPIKey(keyID, orgID)
+	key, err := service.ValidateAPIKey(ctx, created.Key)
 	assert.NoError(t, err)
-	assert.Equal(t, keyID, key.ID)
-	assert.Equal(t, orgID, key.OrganizationID)
-	assert.Equal(t, scopes, key.Scopes)
+	assert.Equal(t, created.ID, key.ID)
+	assert.Equal(t, org.ID, key.OrganizationID)
+	assert.Equal(t, []string{"READ", "WRITE"}, key.Scopes)
+	assert.True(t, key.HasScope(enterprise.ScopeWrite))
+	assert.False(t, key.HasScope(enterprise.ScopeAdmin))
+
+	keys, err := service.ListAPIKeys(ctx, org.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.False(t, keys[0].LastUsedAt.IsZero(), "validating records the use")
+}
+
+func TestValidateAPIKey_Expired(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+
+	created, err := service.CreateAPIKey(ctx, org.ID, "Test Key", []string{"READ"}, 1000, time.Now().Add(-time.Hour), 2)
+	require.NoError(t, err)
+
+	_, err = service.ValidateAPIKey(ctx, created.Key)
+	assert.Equal(t, enterprise.ErrAPIKeyExpired, err)
+}
+
+func TestValidateAPIKey_Unknown(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+
+	_, err := service.ValidateAPIKey(ctx, enterprise.APIKeyPrefix+"unknown")
+	assert.Equal(t, enterprise.ErrInvalidAPIKey, err)
+
+	_, err = service.ValidateAPIKey(ctx, "not-a-vws-key")
+	assert.Equal(t, enterprise.ErrInvalidAPIKey, err)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+
+	created, err := service.CreateAPIKey(ctx, org.ID, "Test Key", []string{"READ"}, 1000, time.Time{}, 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, enterprise.ErrAPIKeyNotFound, service.RevokeAPIKey(ctx, org.ID+1, created.ID))
+	require.NoError(t, service.RevokeAPIKey(ctx, org.ID, created.ID))
+
+	_, err = service.ValidateAPIKey(ctx, created.Key)
+	assert.Equal(t, enterprise.ErrInvalidAPIKey, err)
 }
 
 func TestCreateVotingSystem(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
 
-	vs := &VotingSystem{
-		OrganizationID: 1,
+	vs := &enterprise.VotingSystem{
+		OrganizationID: org.ID,
 		Name:           "Test Voting System",
 		Description:    "Test Description",
 		VotingType:     "MAJORITY",
@@ -192,50 +404,32 @@ func TestCreateVotingSystem(t *testing.T) {
 		CreatedBy:      2,
 	}
 
-	mock.ExpectQuery(`INSERT INTO voting_systems`).
-		WithArgs(vs.OrganizationID, vs.Name, vs.Description, vs.VotingType,
-			vs.Config, vs.Active, vs.CreatedBy).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-			AddRow(1, time.Now(), time.Now()))
-
-	err := service.CreateVotingSystem(vs)
+	err := service.CreateVotingSystem(ctx, vs)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), vs.ID)
+	assert.NotZero(t, vs.ID)
+
+	systems, err := service.ListVotingSystems(ctx, org.ID)
+	require.NoError(t, err)
+	require.Len(t, systems, 1)
+	assert.JSONEq(t, `{"threshold": 0.5}`, string(systems[0].Config))
 }
 
 func TestCreateVote(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	org := setupOrganization(t, service)
 
-	startDate := time.Now()
-	endDate := startDate.Add(24 * time.Hour)
-	vote := &Vote{
-		VotingSystemID: 1,
-		Title:          "Test Vote",
-		Description:    "Test Description",
-		Options:        json.RawMessage(`["option1", "option2"]`),
-		StartDate:      startDate,
-		EndDate:        endDate,
-		Status:         "PENDING",
-		CreatedBy:      2,
-	}
-
-	mock.ExpectQuery(`INSERT INTO votes`).
-		WithArgs(vote.VotingSystemID, vote.Title, vote.Description, vote.Options,
-			vote.StartDate, vote.EndDate, vote.Status, vote.CreatedBy).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-			AddRow(1, time.Now(), time.Now()))
-
-	err := service.CreateVote(vote)
-	assert.NoError(t, err)
-	assert.Equal(t, int64(1), vote.ID)
+	vote := setupVote(t, service, org.ID, "MAJORITY")
+	assert.NotZero(t, vote.ID)
+	assert.False(t, vote.CreatedAt.IsZero())
 }
 
 func TestCreateVote_InvalidDateRange(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	ctx := context.Background()
 
 	endDate := time.Now()
 	startDate := endDate.Add(24 * time.Hour)
-	vote := &Vote{
+	vote := &enterprise.Vote{
 		VotingSystemID: 1,
 		Title:          "Test Vote",
 		Description:    "Test Description",
@@ -246,78 +440,122 @@ func TestCreateVote_InvalidDateRange(t *testing.T) {
 		CreatedBy:      2,
 	}
 
-	err := service.CreateVote(vote)
+	err := service.CreateVote(ctx, vote)
 	assert.Error(t, err)
-	assert.Equal(t, ErrInvalidDateRange, err)
-	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, enterprise.ErrInvalidDateRange, err)
 }
 
 func TestSubmitVoteResponse(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	vote := setupVote(t, service, org.ID, "MAJORITY")
+
+	resp := &enterprise.VoteResponse{
+		VoteID:   vote.ID,
+		UserID:   2,
+		Response: json.RawMessage(`"option1"`),
+		Weight:   1.0,
+	}
 
-	now := time.Now()
-	startDate := now.Add(-1 * time.Hour)
-	endDate := now.Add(23 * time.Hour)
+	err := service.SubmitVoteResponse(ctx, resp)
+	assert.NoError(t, err)
+	assert.NotZero(t, resp.ID)
+}
 
-	mock.ExpectQuery(`SELECT start_date, end_date, status FROM votes WHERE id = \$1`).
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date", "status"}).
-			AddRow(startDate, endDate, "PENDING"))
+func TestSubmitVoteResponse_AlreadySubmitted(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	vote := setupVote(t, service, org.ID, "MAJORITY")
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM vote_responses WHERE vote_id = \$1 AND user_id = \$2`).
-		WithArgs(1, 2).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	first := &enterprise.VoteResponse{VoteID: vote.ID, UserID: 2, Response: json.RawMessage(`"option1"`), Weight: 1.0}
+	require.NoError(t, service.SubmitVoteResponse(ctx, first))
 
-	resp := &VoteResponse{
-		VoteID:   1,
+	resp := &enterprise.VoteResponse{
+		VoteID:   vote.ID,
 		UserID:   2,
-		Response: json.RawMessage(`{"choice": "option1"}`),
+		Response: json.RawMessage(`"option2"`),
 		Weight:   1.0,
 	}
 
-	mock.ExpectQuery(`INSERT INTO vote_responses`).
-		WithArgs(resp.VoteID, resp.UserID, resp.Response, resp.Weight).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-			AddRow(1, time.Now(), time.Now()))
+	err := service.SubmitVoteResponse(ctx, resp)
+	assert.Error(t, err)
+	assert.Equal(t, enterprise.ErrVoteAlreadySubmitted, err)
+}
 
-	err := service.SubmitVoteResponse(resp)
-	assert.NoError(t, err)
-	assert.Equal(t, int64(1), resp.ID)
+func TestSubmitVoteResponse_Concurrent(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	vote := setupVote(t, service, org.ID, "MAJORITY")
+
+	var wg sync.WaitGroup
+	var accepted atomic.Int32
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := &enterprise.VoteResponse{VoteID: vote.ID, UserID: 2, Response: json.RawMessage(`"option1"`), Weight: 1}
+			if service.SubmitVoteResponse(ctx, resp) == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), accepted.Load(), "a user votes once")
 }
 
-func TestSubmitVoteResponse_AlreadySubmitted(t *testing.T) {
-	service, mock := setupTest(t)
+func TestSubmitVoteResponse_Closed(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+
+	vs := &enterprise.VotingSystem{OrganizationID: org.ID, Name: "Board", VotingType: "MAJORITY", CreatedBy: 1}
+	require.NoError(t, service.CreateVotingSystem(ctx, vs))
+	vote := &enterprise.Vote{
+		VotingSystemID: vs.ID,
+		Title:          "Past Vote",
+		StartDate:      time.Now().Add(-48 * time.Hour),
+		EndDate:        time.Now().Add(-24 * time.Hour),
+		Status:         enterprise.VoteStatusPending,
+		CreatedBy:      1,
+	}
+	require.NoError(t, service.CreateVote(ctx, vote))
 
-	now := time.Now()
-	startDate := now.Add(-1 * time.Hour)
-	endDate := now.Add(23 * time.Hour)
+	err := service.SubmitVoteResponse(ctx, &enterprise.VoteResponse{VoteID: vote.ID, UserID: 2, Response: json.RawMessage(`"option1"`)})
+	assert.Equal(t, enterprise.ErrVoteExpired, err)
 
-	mock.ExpectQuery(`SELECT start_date, end_date, status FROM votes WHERE id = \$1`).
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"start_date", "end_date", "status"}).
-			AddRow(startDate, endDate, "PENDING"))
+	err = service.SubmitVoteResponse(ctx, &enterprise.VoteResponse{VoteID: vote.ID + 100, UserID: 2})
+	assert.Equal(t, enterprise.ErrVoteNotFound, err)
+}
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM vote_responses WHERE vote_id = \$1 AND user_id = \$2`).
-		WithArgs(1, 2).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+func TestGetVoteResults(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	vote := setupVote(t, service, org.ID, "MAJORITY")
 
-	resp := &VoteResponse{
-		VoteID:   1,
-		UserID:   2,
-		Response: json.RawMessage(`{"choice": "option1"}`),
-		Weight:   1.0,
+	for userID, choice := range map[int64]string{2: `"option1"`, 3: `"option1"`, 4: `"option2"`, 5: `"option1"`} {
+		require.NoError(t, service.SubmitVoteResponse(ctx, &enterprise.VoteResponse{
+			VoteID: vote.ID, UserID: userID, Response: json.RawMessage(choice), Weight: 1,
+		}))
 	}
 
-	err := service.SubmitVoteResponse(resp)
-	assert.Error(t, err)
-	assert.Equal(t, ErrVoteAlreadySubmitted, err)
+	results, err := service.GetVoteResults(ctx, vote.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "MAJORITY", results["type"])
+	assert.Equal(t, 4, results["total_votes"])
+	assert.Equal(t, map[string]interface{}{"option1": 75.0, "option2": 25.0}, results["results"])
 }
 
 func TestUpdateWhiteLabelSettings(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
 
-	settings := &WhiteLabelSettings{
-		OrganizationID: 1,
+	settings := &enterprise.WhiteLabelSettings{
+		OrganizationID: org.ID,
 		Domain:         "custom.example.com",
 		ThemeConfig:    json.RawMessage(`{"primary": "#000000"}`),
 		CustomCSS:      ".custom { color: black; }",
@@ -325,33 +563,23 @@ func TestUpdateWhiteLabelSettings(t *testing.T) {
 		Enabled:        true,
 	}
 
-	mock.ExpectQuery(`INSERT INTO white_label_settings`).
-		WithArgs(settings.OrganizationID, settings.Domain, settings.ThemeConfig,
-			settings.CustomCSS, settings.CustomJS, settings.Enabled).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-			AddRow(1, time.Now(), time.Now()))
-
-	err := service.UpdateWhiteLabelSettings(settings)
+	err := service.UpdateWhiteLabelSettings(ctx, settings)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), settings.ID)
+	assert.NotZero(t, settings.ID)
 }
 
 func TestGetWhiteLabelSettings(t *testing.T) {
-	service, mock := setupTest(t)
-
-	now := time.Now()
-	mock.ExpectQuery(`SELECT .+ FROM white_label_settings WHERE organization_id = \$1`).
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"id", "domain", "theme_config", "custom_css",
-			"custom_js", "enabled", "created_at", "updated_at",
-		}).AddRow(
-			1, "custom.example.com", []byte(`{"primary": "#000000"}`),
-			".custom { color: black; }", "console.log('custom');", true,
-			now, now,
-		))
-
-	settings, err := service.GetWhiteLabelSettings(1)
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	require.NoError(t, service.UpdateWhiteLabelSettings(ctx, &enterprise.WhiteLabelSettings{
+		OrganizationID: org.ID,
+		Domain:         "custom.example.com",
+		ThemeConfig:    json.RawMessage(`{"primary": "#000000"}`),
+		Enabled:        true,
+	}))
+
+	settings, err := service.GetWhiteLabelSettings(ctx, org.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, settings)
 	assert.Equal(t, "custom.example.com", settings.Domain)
@@ -359,13 +587,25 @@ func TestGetWhiteLabelSettings(t *testing.T) {
 }
 
 func TestGetWhiteLabelSettings_NotFound(t *testing.T) {
-	service, mock := setupTest(t)
+	service := setupTest(t)
+	ctx := context.Background()
 
-	mock.ExpectQuery(`SELECT .+ FROM white_label_settings WHERE organization_id = \$1`).
-		WithArgs(1).
-		WillReturnError(sql.ErrNoRows)
-
-	settings, err := service.GetWhiteLabelSettings(1)
+	settings, err := service.GetWhiteLabelSettings(ctx, 1)
 	assert.NoError(t, err)
 	assert.Nil(t, settings)
 }
+
+func TestWhiteLabelDomains(t *testing.T) {
+	service := setupTest(t)
+	ctx := context.Background()
+	org := setupOrganization(t, service)
+	require.NoError(t, service.UpdateWhiteLabelSettings(ctx, &enterprise.WhiteLabelSettings{
+		OrganizationID: org.ID,
+		Domain:         "Vote.Example.com",
+		Enabled:        true,
+	}))
+
+	domains, err := service.WhiteLabelDomains(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vote.example.com"}, domains)
+}
@@ -0,0 +1,112 @@
+package face
+
+import (
+	"image"
+	"math"
+)
+
+// alignedSize is the width and height of aligned faces, in pixels
+const alignedSize = 112
+
+// alignTemplate is where the landmarks of a face land once aligned, in
+// the order of Face.Landmarks: the ArcFace template recognition models
+// are trained on
+var alignTemplate = [5][2]float64{
+	{38.2946, 51.6963},
+	{73.5318, 51.5014},
+	{56.0252, 71.7366},
+	{41.5493, 92.3655},
+	{70.7299, 92.2041},
+}
+
+// similarity is a transform scaling, rotating and moving points:
+// x' = a·x - b·y + tx, y' = b·x + a·y + ty
+type similarity struct {
+	a, b, tx, ty float64
+}
+
+// fitSimilarity returns the similarity moving the points of src closest to
+// those of dst, in the least squares sense
+func fitSimilarity(src, dst [][2]float64) similarity {
+	var sx, sy, dx, dy float64
+	for i := range src {
+		sx, sy = sx+src[i][0], sy+src[i][1]
+		dx, dy = dx+dst[i][0], dy+dst[i][1]
+	}
+	n := float64(len(src))
+	sx, sy, dx, dy = sx/n, sy/n, dx/n, dy/n
+
+	var dot, cross, norm float64
+	for i := range src {
+		x, y := src[i][0]-sx, src[i][1]-sy
+		u, v := dst[i][0]-dx, dst[i][1]-dy
+		dot += x*u + y*v
+		cross += x*v - y*u
+		norm += x*x + y*y
+	}
+	if norm == 0 {
+		return similarity{a: 1, tx: dx - sx, ty: dy - sy}
+	}
+	a, b := dot/norm, cross/norm
+	return similarity{a: a, b: b, tx: dx - (a*sx - b*sy), ty: dy - (b*sx + a*sy)}
+}
+
+// apply moves the point x, y
+func (s similarity) apply(x, y float64) (float64, float64) {
+	return s.a*x - s.b*y + s.tx, s.b*x + s.a*y + s.ty
+}
+
+// invert returns the similarity moving points back, the identity if s
+// collapses them
+func (s similarity) invert() similarity {
+	det := s.a*s.a + s.b*s.b
+	if det == 0 {
+		return similarity{a: 1}
+	}
+	a, b := s.a/det, -s.b/det
+	return similarity{a: a, b: b, tx: -(a*s.tx - b*s.ty), ty: -(b*s.tx + a*s.ty)}
+}
+
+// align crops the face with the given landmarks out of img, rotated and
+// scaled so its landmarks land on alignTemplate. Pixels outside img are
+// black.
+func align(img image.Image, landmarks []image.Point) *image.RGBA {
+	bounds := img.Bounds()
+	src := make([][2]float64, len(landmarks))
+	for i, l := range landmarks {
+		src[i] = [2]float64{float64(l.X - bounds.Min.X), float64(l.Y - bounds.Min.Y)}
+	}
+	back := fitSimilarity(src, alignTemplate[:]).invert()
+
+	px := pixels(img)
+	at := func(x, y int) (float64, float64, float64) {
+		if x < 0 || y < 0 || x >= bounds.Dx() || y >= bounds.Dy() {
+			return 0, 0, 0
+		}
+		r, g, b := px(bounds.Min.X+x, bounds.Min.Y+y)
+		return float64(r), float64(g), float64(b)
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, alignedSize, alignedSize))
+	for v := range alignedSize {
+		for u := range alignedSize {
+			x, y := back.apply(float64(u), float64(v))
+			x0, y0 := math.Floor(x), math.Floor(y)
+			fx, fy := x-x0, y-y0
+			r00, g00, b00 := at(int(x0), int(y0))
+			r10, g10, b10 := at(int(x0)+1, int(y0))
+			r01, g01, b01 := at(int(x0), int(y0)+1)
+			r11, g11, b11 := at(int(x0)+1, int(y0)+1)
+			mix := func(v00, v10, v01, v11 float64) uint8 {
+				v := (v00*(1-fx)+v10*fx)*(1-fy) + (v01*(1-fx)+v11*fx)*fy
+				return uint8(min(max(math.Round(v), 0), 255))
+			}
+			i := out.PixOffset(u, v)
+			out.Pix[i] = mix(r00, r10, r01, r11)
+			out.Pix[i+1] = mix(g00, g10, g01, g11)
+			out.Pix[i+2] = mix(b00, b10, b01, b11)
+			out.Pix[i+3] = 255
+		}
+	}
+	return out
+}
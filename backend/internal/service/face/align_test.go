@@ -0,0 +1,63 @@
+package face
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"vws-backend/internal/service/face/facetest"
+)
+
+func TestFitSimilarity(t *testing.T) {
+	// Scaled by 2, turned by 30 degrees and moved
+	want := similarity{a: 2 * math.Cos(math.Pi/6), b: 2 * math.Sin(math.Pi/6), tx: 5, ty: -3}
+	src := [][2]float64{{0, 0}, {10, 0}, {0, 10}, {7, 4}}
+	dst := make([][2]float64, len(src))
+	for i, p := range src {
+		dst[i][0], dst[i][1] = want.apply(p[0], p[1])
+	}
+
+	got := fitSimilarity(src, dst)
+	for _, d := range []float64{got.a - want.a, got.b - want.b, got.tx - want.tx, got.ty - want.ty} {
+		if math.Abs(d) > 1e-9 {
+			t.Fatalf("fitSimilarity() = %+v, want %+v", got, want)
+		}
+	}
+	x, y := got.invert().apply(dst[3][0], dst[3][1])
+	if math.Abs(x-7) > 1e-9 || math.Abs(y-4) > 1e-9 {
+		t.Errorf("invert() moves %v back to %v, %v", dst[3], x, y)
+	}
+}
+
+func TestAlign(t *testing.T) {
+	// Landmarks marked on a turned, enlarged and offset face
+	place := similarity{a: 3 * math.Cos(0.4), b: 3 * math.Sin(0.4), tx: 40, ty: 20}
+	img := facetest.Blank(400, 400)
+	img.Rect = img.Rect.Add(image.Pt(-50, 30))
+	marks := []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}, {R: 255, G: 255, A: 255}, {G: 255, B: 255, A: 255}}
+	landmarks := make([]image.Point, len(alignTemplate))
+	for i, p := range alignTemplate {
+		x, y := place.apply(p[0], p[1])
+		landmarks[i] = image.Pt(int(math.Round(x)), int(math.Round(y))).Add(img.Rect.Min)
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				img.Set(landmarks[i].X+dx, landmarks[i].Y+dy, marks[i])
+			}
+		}
+	}
+
+	aligned := align(img, landmarks)
+	if aligned.Bounds() != image.Rect(0, 0, alignedSize, alignedSize) {
+		t.Fatalf("aligned face bounds = %v", aligned.Bounds())
+	}
+	for i, p := range alignTemplate {
+		got := aligned.RGBAAt(int(math.Round(p[0])), int(math.Round(p[1])))
+		if got != marks[i] {
+			t.Errorf("landmark %d aligned to %v, want %v", i, got, marks[i])
+		}
+	}
+	if got := aligned.RGBAAt(0, 0); got.R != 235 {
+		t.Errorf("aligned corner = %v, want the background", got)
+	}
+}
@@ -0,0 +1,233 @@
+package face
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"image"
+	"math/big"
+	"slices"
+	"time"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/metrics"
+	"vws-backend/internal/tracing"
+)
+
+// Challenge is a movement a person is asked to make in front of the
+// camera, which a photo of them can't
+type Challenge string
+
+// Challenges, turns being to the person's own left or right
+const (
+	ChallengeTurnLeft  Challenge = "turn_left"
+	ChallengeTurnRight Challenge = "turn_right"
+	ChallengeBlink     Challenge = "blink"
+)
+
+// Challenges lists every challenge
+var Challenges = []Challenge{ChallengeTurnLeft, ChallengeTurnRight, ChallengeBlink}
+
+// Frames a challenge is answered with, a short burst starting before the
+// movement
+const (
+	MinChallengeFrames = 2
+	MaxChallengeFrames = 10
+)
+
+// ChallengeTTL is how long an issued challenge may be answered for
+const ChallengeTTL = time.Minute
+
+var (
+	ErrUnknownChallenge  = apperr.New(apperr.ErrInvalid, "unknown_challenge", "unknown liveness challenge")
+	ErrChallengeFrames   = apperr.New(apperr.ErrInvalid, "invalid_frame_count", "a challenge is answered with 2 to 10 frames")
+	ErrChallengeNotFound = apperr.New(apperr.ErrNotFound, "challenge_not_found",
+		"no such liveness challenge was issued to you, or it was answered or expired")
+)
+
+// IssuedChallenge is a challenge the server picked for a user, answered by
+// quoting its ID. It can be answered once, before it expires, so a clip
+// recorded for another challenge can't be replayed to answer it.
+type IssuedChallenge struct {
+	ID        string    `json:"id"`
+	UserID    int64     `json:"-"`
+	Challenge Challenge `json:"challenge"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// How much the face must move to answer a challenge
+const (
+	// Least change of yaw, the offset of the nose from the middle of the
+	// box over the width of the box, from the first frame
+	minTurn = 0.1
+	// Most openness of the eyes, relative to the widest open, of a frame
+	// with the eyes closed
+	maxBlinkOpenness = 0.5
+)
+
+// IssueChallenge picks a challenge at random for the user to answer,
+// replacing any they were issued before
+func (v *Verifier) IssueChallenge(ctx context.Context, userID int64) (_ *IssuedChallenge, err error) {
+	ctx, span := tracing.Start(ctx, "face.IssueChallenge")
+	defer tracing.End(span, &err)
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	pick, err := rand.Int(rand.Reader, big.NewInt(int64(len(Challenges))))
+	if err != nil {
+		return nil, err
+	}
+	issued := &IssuedChallenge{
+		ID:        hex.EncodeToString(nonce),
+		UserID:    userID,
+		Challenge: Challenges[pick.Int64()],
+		ExpiresAt: time.Now().Add(ChallengeTTL),
+	}
+	if err := v.repo.SaveChallenge(ctx, issued); err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// AnswerChallenge checks the liveness of the user from frames answering
+// the challenge with ID they were issued, like Service.CheckChallenge. The
+// challenge is used up whatever the answer.
+func (v *Verifier) AnswerChallenge(ctx context.Context, userID int64, id string, frames []image.Image) (_ *Liveness, err error) {
+	ctx, span := tracing.Start(ctx, "face.AnswerChallenge")
+	defer tracing.End(span, &err)
+
+	issued, err := v.repo.TakeChallenge(ctx, userID, id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return v.detector.CheckChallenge(ctx, issued.Challenge, frames)
+}
+
+// CheckChallenge checks the liveness of a person from frames taken while
+// they were asked to make challenge. Every frame must show one face. The
+// face scores the mean liveness of the frames, with the reasons of all, or
+// 0 with ReasonNoResponse if it didn't move as asked.
+func (s *Service) CheckChallenge(ctx context.Context, challenge Challenge, frames []image.Image) (_ *Liveness, err error) {
+	ctx, span := tracing.Start(ctx, "face.CheckChallenge")
+	defer tracing.End(span, &err)
+
+	result, err := s.checkChallenge(ctx, challenge, frames)
+	switch {
+	case err != nil:
+		metrics.FaceChallenges.WithLabelValues(metrics.FaceError).Inc()
+	case result.Live:
+		metrics.FaceChallenges.WithLabelValues(metrics.FaceLive).Inc()
+	default:
+		metrics.FaceChallenges.WithLabelValues(metrics.FaceSpoof).Inc()
+	}
+	return result, err
+}
+
+func (s *Service) checkChallenge(ctx context.Context, challenge Challenge, frames []image.Image) (*Liveness, error) {
+	if !slices.Contains(Challenges, challenge) {
+		return nil, ErrUnknownChallenge
+	}
+	if len(frames) < MinChallengeFrames || len(frames) > MaxChallengeFrames {
+		return nil, ErrChallengeFrames
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	faces := make([]Face, len(frames))
+	result := &Liveness{Threshold: s.livenessThreshold, Reasons: []string{}}
+	for i, frame := range frames {
+		detection, err := s.detect(ctx, frame)
+		if err != nil {
+			return nil, err
+		}
+		switch len(detection.Faces) {
+		case 0:
+			return nil, ErrNoFace
+		case 1:
+		default:
+			return nil, ErrMultipleFaces
+		}
+		faces[i] = detection.Faces[0]
+		result.Score += faces[i].Liveness.Score / float32(len(frames))
+		for _, reason := range faces[i].Liveness.Reasons {
+			if !slices.Contains(result.Reasons, reason) {
+				result.Reasons = append(result.Reasons, reason)
+			}
+		}
+	}
+
+	if !responded(challenge, frames, faces) {
+		result.Score = 0
+		result.Reasons = append(result.Reasons, ReasonNoResponse)
+	}
+	result.Live = result.Score >= result.Threshold
+	return result, nil
+}
+
+// responded reports whether the faces detected in frames moved as
+// challenge asked
+func responded(challenge Challenge, frames []image.Image, faces []Face) bool {
+	switch challenge {
+	case ChallengeTurnLeft, ChallengeTurnRight:
+		// The person's left is right in the image, where the nose moves
+		direction := 1.0
+		if challenge == ChallengeTurnRight {
+			direction = -1
+		}
+		start := yaw(faces[0])
+		for _, face := range faces[1:] {
+			if (yaw(face)-start)*direction >= minTurn {
+				return true
+			}
+		}
+	case ChallengeBlink:
+		open := make([]float64, len(frames))
+		for i := range frames {
+			open[i] = openness(frames[i], faces[i])
+		}
+		widest := slices.Max(open)
+		return widest > 0 && slices.Min(open) <= maxBlinkOpenness*widest
+	}
+	return false
+}
+
+// yaw returns how far the face is turned, as the offset of its nose from
+// the middle of its box over the width of the box: positive when turned to
+// the right of the image
+func yaw(face Face) float64 {
+	if len(face.Landmarks) < 3 || face.Box.Dx() == 0 {
+		return 0
+	}
+	middle := float64(face.Box.Min.X+face.Box.Max.X) / 2
+	return (float64(face.Landmarks[2].X) - middle) / float64(face.Box.Dx())
+}
+
+// Radius, in aligned pixels, of the patches of skin and eyes compared by
+// openness
+const eyePatch = 5
+
+// openness returns how open the eyes of face are, as how much darker the
+// patches on them are than the one on the nose, aligned
+func openness(img image.Image, face Face) float64 {
+	aligned := align(img, face.Landmarks)
+	patch := func(center [2]float64) float64 {
+		var sum float64
+		n := 0
+		for y := -eyePatch; y <= eyePatch; y++ {
+			for x := -eyePatch; x <= eyePatch; x++ {
+				if x*x+y*y > eyePatch*eyePatch {
+					continue
+				}
+				i := aligned.PixOffset(int(center[0])+x, int(center[1])+y)
+				sum += luma601(float64(aligned.Pix[i]), float64(aligned.Pix[i+1]), float64(aligned.Pix[i+2]))
+				n++
+			}
+		}
+		return sum / float64(n)
+	}
+	eyes := (patch(alignTemplate[0]) + patch(alignTemplate[1])) / 2
+	return max(patch(alignTemplate[2])-eyes, 0)
+}
@@ -0,0 +1,142 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"image"
+	"slices"
+	"testing"
+	"time"
+
+	"vws-backend/internal/service/face/facetest"
+)
+
+// posed returns a frame of the first of People in pose
+func posed(pose facetest.Pose) image.Image {
+	img := facetest.Blank(320, 240)
+	facetest.DrawPose(img, image.Pt(164, 116), 1, 0, pose)
+	return img
+}
+
+func TestService_CheckChallenge(t *testing.T) {
+	svc, err := NewService("testdata/standin_yunet.onnx", DefaultThresholds)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	front := posed(facetest.Pose{})
+	toLeft := posed(facetest.Pose{Turn: 0.6})
+	toRight := posed(facetest.Pose{Turn: -0.6})
+	closed := posed(facetest.Pose{EyesClosed: true})
+
+	tests := []struct {
+		name        string
+		challenge   Challenge
+		frames      []image.Image
+		wantLive    bool
+		wantReasons []string
+		wantErr     error
+	}{
+		{name: "Turned left", challenge: ChallengeTurnLeft, frames: []image.Image{front, front, toLeft}, wantLive: true},
+		{name: "Turned right", challenge: ChallengeTurnRight, frames: []image.Image{front, toRight, front}, wantLive: true},
+		{name: "Blinked", challenge: ChallengeBlink, frames: []image.Image{front, closed, front}, wantLive: true},
+		{
+			name: "Turned the wrong way", challenge: ChallengeTurnLeft, frames: []image.Image{front, toRight},
+			wantReasons: []string{ReasonNoResponse},
+		},
+		{
+			name: "Eyes open throughout", challenge: ChallengeBlink, frames: []image.Image{front, toLeft, front},
+			wantReasons: []string{ReasonNoResponse},
+		},
+		{
+			name: "Replayed on a screen", challenge: ChallengeTurnLeft,
+			frames:      []image.Image{facetest.Screen(front), facetest.Screen(toLeft)},
+			wantReasons: []string{ReasonMoire},
+		},
+		{name: "Unknown challenge", challenge: "smile", frames: []image.Image{front, front}, wantErr: ErrUnknownChallenge},
+		{name: "One frame", challenge: ChallengeBlink, frames: []image.Image{front}, wantErr: ErrChallengeFrames},
+		{name: "Too many frames", challenge: ChallengeBlink, frames: slices.Repeat([]image.Image{front}, MaxChallengeFrames+1), wantErr: ErrChallengeFrames},
+		{name: "Frame without a face", challenge: ChallengeBlink, frames: []image.Image{front, loadImage(t, "no_face.png")}, wantErr: ErrNoFace},
+		{name: "Frame with faces", challenge: ChallengeBlink, frames: []image.Image{front, loadImage(t, "three_faces.png")}, wantErr: ErrMultipleFaces},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.CheckChallenge(context.Background(), tt.challenge, tt.frames)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CheckChallenge() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Live != tt.wantLive || got.Live != (got.Score >= got.Threshold) {
+				t.Errorf("CheckChallenge() = %+v, want live %v", got, tt.wantLive)
+			}
+			if tt.wantReasons == nil {
+				tt.wantReasons = []string{}
+			}
+			if !slices.Equal(got.Reasons, tt.wantReasons) {
+				t.Errorf("CheckChallenge() reasons = %v, want %v", got.Reasons, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestVerifier_AnswerChallenge(t *testing.T) {
+	ctx := context.Background()
+	v, repo := newTestVerifier(t)
+	const alice, bob = 1, 2
+
+	front := posed(facetest.Pose{})
+	answers := map[Challenge][]image.Image{
+		ChallengeTurnLeft:  {front, posed(facetest.Pose{Turn: 0.6})},
+		ChallengeTurnRight: {front, posed(facetest.Pose{Turn: -0.6})},
+		ChallengeBlink:     {front, posed(facetest.Pose{EyesClosed: true}), front},
+	}
+
+	issued, err := v.IssueChallenge(ctx, alice)
+	if err != nil {
+		t.Fatalf("IssueChallenge() error = %v", err)
+	}
+	if !slices.Contains(Challenges, issued.Challenge) || len(issued.ID) != 32 || time.Until(issued.ExpiresAt) > ChallengeTTL {
+		t.Fatalf("IssueChallenge() = %+v", issued)
+	}
+	if _, err := v.AnswerChallenge(ctx, bob, issued.ID, answers[issued.Challenge]); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("AnswerChallenge() by another user error = %v, want %v", err, ErrChallengeNotFound)
+	}
+	result, err := v.AnswerChallenge(ctx, alice, issued.ID, answers[issued.Challenge])
+	if err != nil || !result.Live {
+		t.Errorf("AnswerChallenge() = %+v, %v, want live", result, err)
+	}
+	if _, err := v.AnswerChallenge(ctx, alice, issued.ID, answers[issued.Challenge]); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("AnswerChallenge() again error = %v, want %v", err, ErrChallengeNotFound)
+	}
+
+	// The frames are checked against the issued challenge, not another
+	issued, err = v.IssueChallenge(ctx, alice)
+	if err != nil {
+		t.Fatalf("IssueChallenge() error = %v", err)
+	}
+	other := ChallengeTurnLeft
+	if issued.Challenge == ChallengeTurnLeft {
+		other = ChallengeTurnRight
+	}
+	result, err = v.AnswerChallenge(ctx, alice, issued.ID, answers[other])
+	if err != nil || result.Live {
+		t.Errorf("AnswerChallenge() with the answer to %s = %+v, %v, want not live", other, result, err)
+	}
+
+	// Issuing replaces the challenge issued before
+	first, _ := v.IssueChallenge(ctx, alice)
+	second, _ := v.IssueChallenge(ctx, alice)
+	if _, err := v.AnswerChallenge(ctx, alice, first.ID, answers[first.Challenge]); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("AnswerChallenge() of a replaced challenge error = %v, want %v", err, ErrChallengeNotFound)
+	}
+
+	// Expired challenges can't be answered
+	expired := repo.challenges[alice]
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	repo.challenges[alice] = expired
+	if _, err := v.AnswerChallenge(ctx, alice, second.ID, answers[second.Challenge]); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("AnswerChallenge() of an expired challenge error = %v, want %v", err, ErrChallengeNotFound)
+	}
+}
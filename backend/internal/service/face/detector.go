@@ -0,0 +1,85 @@
+package face
+
+import (
+	"context"
+	"image"
+	"slices"
+)
+
+// Detector finds faces in images
+type Detector interface {
+	// Detect returns the faces in img scored at least thresholds.Score,
+	// best first. Of faces overlapping by more than thresholds.IoU only
+	// the best is kept.
+	Detect(ctx context.Context, img image.Image, thresholds Thresholds) ([]Face, error)
+
+	// Close releases the resources of the detector
+	Close() error
+}
+
+// Thresholds tune which detections are reported as faces
+type Thresholds struct {
+	Score float32 // Lowest confidence reported, between 0 and 1
+	IoU   float32 // Highest overlap, as intersection over union, of two faces reported
+}
+
+// DefaultThresholds are the thresholds YuNet is evaluated with
+var DefaultThresholds = Thresholds{Score: 0.9, IoU: 0.3}
+
+// candidate is a detection before suppression, in model input coordinates
+type candidate struct {
+	x1, y1, x2, y2 float32
+	score          float32
+	landmarks      [5][2]float32
+}
+
+// iou returns the intersection over union of two boxes
+func iou(a, b *candidate) float32 {
+	w := min(a.x2, b.x2) - max(a.x1, b.x1)
+	h := min(a.y2, b.y2) - max(a.y1, b.y1)
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	inter := w * h
+	union := (a.x2-a.x1)*(a.y2-a.y1) + (b.x2-b.x1)*(b.y2-b.y1) - inter
+	if union <= 0 {
+		return 0
+	}
+	return inter / union
+}
+
+// Most candidates considered by nms, as YuNet proposes thousands of boxes
+// for images full of noise
+const maxCandidates = 5000
+
+// nms applies non-maximum suppression: it keeps the best of candidates
+// overlapping by more than threshold, best first
+func nms(candidates []candidate, threshold float32) []candidate {
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+		return 0
+	})
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+
+	var kept []candidate
+	for i := range candidates {
+		suppressed := false
+		for j := range kept {
+			if iou(&candidates[i], &kept[j]) > threshold {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, candidates[i])
+		}
+	}
+	return kept
+}
@@ -0,0 +1,176 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/metrics"
+	"vws-backend/internal/tracing"
+)
+
+var (
+	ErrDuplicateNotFound = apperr.New(apperr.ErrNotFound, "duplicate_not_found", "duplicate not found")
+	ErrDuplicateFlagged  = apperr.New(apperr.ErrConflict, "duplicate_flagged", "the faces are already flagged as duplicates")
+	ErrDuplicateStatus   = apperr.New(apperr.ErrInvalid, "invalid_duplicate_status", "a duplicate is reviewed as CONFIRMED or DISMISSED")
+)
+
+// Duplicate is an enrolled face flagged as likely of the same person as
+// the face another user enrolled before, one person holding two accounts.
+// Admins review it: a confirmed duplicate keeps UserID from converting
+// points to tokens.
+type Duplicate struct {
+	ID            int64      `json:"id"`
+	UserID        int64      `json:"userId"`        // Who enrolled the face
+	MatchedUserID int64      `json:"matchedUserId"` // Whose enrolled face it matched
+	Similarity    float32    `json:"similarity"`
+	Status        string     `json:"status"`
+	ReviewedBy    int64      `json:"reviewedBy,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// Duplicate statuses
+const (
+	DuplicatePending   = "PENDING"
+	DuplicateConfirmed = "CONFIRMED"
+	DuplicateDismissed = "DISMISSED"
+)
+
+// DefaultDuplicateThreshold is the similarity from which faces of
+// different users are flagged. It is above the match threshold, as every
+// enrollment is compared with every face and a lower one would flag many
+// people who merely look alike.
+const DefaultDuplicateThreshold = 0.5
+
+// maxDuplicates bounds the faces an enrollment is flagged against
+const maxDuplicates = 5
+
+// indexPageSize is the number of embeddings LoadIndex reads at a time
+const indexPageSize = 1000
+
+// LoadIndex indexes every enrolled face, for enrollments to be compared
+// with. It takes a while with many faces, so it can run while the
+// verifier serves requests: the faces enrolled meanwhile are indexed as
+// well, but only compared with those loaded so far, and IndexReady fails
+// until it is done.
+//
+// The verifier keeps the index up to date with the enrollments it makes,
+// but not with those of other servers sharing the repository, which it
+// only sees when loading again.
+func (v *Verifier) LoadIndex(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "face.LoadIndex")
+	defer tracing.End(span, &err)
+
+	defer func() {
+		v.mu.Lock()
+		v.indexErr = err
+		v.mu.Unlock()
+	}()
+
+	var after int64
+	for {
+		page, err := v.repo.ListEmbeddings(ctx, after, indexPageSize)
+		if err != nil {
+			return fmt.Errorf("list embeddings: %w", err)
+		}
+		for _, e := range page {
+			// Faces enrolled since the page was read are newer
+			v.index.addIfAbsent(e.UserID, e.Vector)
+		}
+		metrics.FaceIndexed.Set(float64(v.index.Len()))
+		if len(page) < indexPageSize {
+			return nil
+		}
+		after = page[len(page)-1].UserID
+	}
+}
+
+// IndexReady reports whether the enrolled faces are indexed
+func (v *Verifier) IndexReady() error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.indexErr
+}
+
+// store stores the face the user enrolled with save, flagging the faces of
+// other users it is as similar to as the duplicate threshold in the same
+// transaction, and indexes it once that commits. Enrollments hold enrollMu
+// from the lookup to the indexing, so of two similar faces enrolled at
+// once, one finds the other.
+func (v *Verifier) store(ctx context.Context, e *Embedding, save func(Repository) error) error {
+	v.mu.RLock()
+	threshold := v.duplicateThreshold
+	v.mu.RUnlock()
+
+	v.enrollMu.Lock()
+	defer v.enrollMu.Unlock()
+
+	matches := v.index.searchOthers(e.UserID, e.Vector, maxDuplicates, threshold)
+	var flagged int
+	err := v.repo.WithTx(ctx, func(repo Repository) error {
+		flagged = 0
+		if err := save(repo); err != nil {
+			return err
+		}
+		for _, match := range matches {
+			d := &Duplicate{
+				UserID:        e.UserID,
+				MatchedUserID: match.UserID,
+				Similarity:    match.Similarity,
+				Status:        DuplicatePending,
+				CreatedAt:     e.UpdatedAt,
+			}
+			err := repo.CreateDuplicate(ctx, d)
+			if errors.Is(err, ErrDuplicateFlagged) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("flag duplicate of user %d: %w", match.UserID, err)
+			}
+			flagged++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	v.index.put(e.UserID, e.Vector)
+	metrics.FaceIndexed.Set(float64(v.index.Len()))
+	metrics.FaceDuplicates.Add(float64(flagged))
+	return nil
+}
+
+// Duplicates lists the flagged duplicates with status, or all if empty,
+// oldest first
+func (v *Verifier) Duplicates(ctx context.Context, status string, limit, offset int) ([]*Duplicate, error) {
+	return v.repo.ListDuplicates(ctx, status, limit, offset)
+}
+
+// ReviewDuplicate records an admin's decision on a flagged duplicate,
+// DuplicateConfirmed or DuplicateDismissed. A decision can be revised.
+func (v *Verifier) ReviewDuplicate(ctx context.Context, id int64, status string, reviewerID int64) (_ *Duplicate, err error) {
+	ctx, span := tracing.Start(ctx, "face.ReviewDuplicate")
+	defer tracing.End(span, &err)
+
+	if status != DuplicateConfirmed && status != DuplicateDismissed {
+		return nil, ErrDuplicateStatus
+	}
+	now := time.Now()
+	d := &Duplicate{ID: id, Status: status, ReviewedBy: reviewerID, ReviewedAt: &now}
+	if err := v.repo.ReviewDuplicate(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetDuplicateThreshold changes the similarity from which enrolled faces
+// are flagged as duplicates
+func (v *Verifier) SetDuplicateThreshold(threshold float32) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.duplicateThreshold = threshold
+}
@@ -0,0 +1,429 @@
+// Package facetest builds stand-ins for the YuNet face detection and SFace
+// recognition models and the faces they work on, so tests run the face
+// service end to end without the weights of the real models.
+//
+// The stand-ins have the inputs and outputs of the real models but handle
+// fixture faces only: discs of skin color FaceSize pixels wide, with two
+// eyes and a mouth, drawn by DrawFace on a light background. The detector
+// proposes them on the grid of stride 8 alone, scoring every cell by how
+// much red outweighs blue around it, with a box FaceSize wide centered on
+// the cell and landmarks at the features DrawFace draws, moved sideways
+// with them when a face is turned. The recognizer
+// tells people apart by the hue of their features, each person of People
+// having their own.
+//
+// The stand-ins say nothing of how the real models do on real faces. Tests
+// of the face service running them on photos are skipped unless
+// VWS_FACE_MODELS names a directory holding the real models, as fetched by
+// make models; make test-models fetches them and the photos and runs those
+// tests.
+package facetest
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"vws-backend/internal/onnx"
+)
+
+// FaceSize is the width and height, in pixels, of the faces the model
+// detects
+const FaceSize = 64
+
+// Landmarks are the offsets, from the center of a face drawn by DrawFace,
+// of its right eye, left eye, nose tip, right and left mouth corners
+var Landmarks = [5]image.Point{{-11, -8}, {11, -8}, {0, 2}, {-9, 12}, {9, 12}}
+
+// Skin is the color of the faces DrawFace draws
+var Skin = color.RGBA{R: 230, G: 180, B: 140, A: 255}
+
+// People are the colors of the eyes and mouth of the people DrawFace
+// draws, dark enough to stand out from the skin and of distinct hues
+var People = []color.RGBA{
+	{R: 70, G: 45, B: 40, A: 255},
+	{R: 40, G: 90, B: 50, A: 255},
+	{R: 50, G: 40, B: 80, A: 255},
+}
+
+const stride = 8
+
+// Score the model gives cells, as logistic(scoreGain·(redness-scoreBias))
+// of the mean redness, red minus blue, of the window of cells around them.
+// Faces drawn on a cell center score 0.99 there and about 0.95 on the cells
+// next to it, whose boxes overlap the best one too much to be reported.
+const (
+	window    = 7
+	scoreGain = 0.25
+	scoreBias = 60
+)
+
+// Model returns the stand-in model for inputs of width by height pixels,
+// or of any size multiple of 32 if they are 0
+func Model(width, height int) *onnx.Model {
+	h, w := -1, -1
+	if width > 0 && height > 0 {
+		h, w = height, width
+	}
+	m := &onnx.Model{
+		Opset:        13,
+		Inputs:       []onnx.ValueInfo{{Name: "input", Type: onnx.Float, Shape: []int{1, 3, h, w}}},
+		Initializers: map[string]*onnx.Tensor{},
+	}
+	b := builder{m}
+
+	// Redness of each cell of the grid of stride 8, as the mean of red
+	// minus blue over its pixels
+	redness := make([]float32, 3*stride*stride)
+	for i := range stride * stride {
+		redness[i] = -1.0 / (stride * stride)                // Blue
+		redness[2*stride*stride+i] = 1.0 / (stride * stride) // Red
+	}
+	b.weight("redness.w", []int{1, 3, stride, stride}, redness)
+	b.node("Conv", []string{"input", "redness.w"}, "redness",
+		map[string]any{"strides": []int64{stride, stride}})
+
+	// Mean redness around each cell, then its score
+	b.weight("around.w", []int{1, 1, window, window}, fill(window*window, 1.0/(window*window)))
+	b.node("Conv", []string{"redness", "around.w"}, "around",
+		map[string]any{"pads": []int64{window / 2, window / 2, window / 2, window / 2}})
+	b.weight("logit.w", []int{1, 1, 1, 1}, []float32{scoreGain})
+	b.weight("logit.b", []int{1}, []float32{-scoreGain * scoreBias})
+	b.node("Conv", []string{"around", "logit.w", "logit.b"}, "logit", nil)
+	b.node("Sigmoid", []string{"logit"}, "score", nil)
+	b.head("score", "cls_8", 1)
+	b.node("Identity", []string{"cls_8"}, "obj_8", nil)
+
+	// The same box for every cell, and the same landmarks moved sideways
+	// by as much as the features are off the cell
+	b.constant("redness", "box", []float32{0.5, 0.5, float32(math.Log(FaceSize / stride)), float32(math.Log(FaceSize / stride))})
+	b.head("box", "bbox_8", 4)
+	b.featureShift()
+	var kps []float32
+	shift := make([]float32, 10)
+	for i, l := range Landmarks {
+		kps = append(kps, float32(l.X+stride/2)/stride, float32(l.Y+stride/2)/stride)
+		shift[2*i] = 1.0 / stride
+	}
+	b.constant("redness", "kps.cell", kps)
+	b.weight("kps.shift.w", []int{10, 1, 1, 1}, shift)
+	b.node("Conv", []string{"shift", "kps.shift.w"}, "kps.shift", nil)
+	b.node("Add", []string{"kps.cell", "kps.shift"}, "kps", nil)
+	b.head("kps", "kps_8", 10)
+
+	// No faces on the coarser grids
+	for _, s := range []int{16, 32} {
+		grid := "grid_" + strconv.Itoa(s)
+		b.weight(grid+".w", []int{1, 3, s, s}, make([]float32, 3*s*s))
+		b.node("Conv", []string{"input", grid + ".w"}, grid, map[string]any{"strides": []int64{int64(s), int64(s)}})
+		b.constant(grid, grid+".cls", []float32{-20})
+		b.head(grid+".cls", "cls_"+strconv.Itoa(s), 1)
+		b.node("Sigmoid", []string{"cls_" + strconv.Itoa(s)}, "obj_"+strconv.Itoa(s), nil)
+		b.constant(grid, grid+".box", make([]float32, 4))
+		b.head(grid+".box", "bbox_"+strconv.Itoa(s), 4)
+		b.constant(grid, grid+".kps", make([]float32, 10))
+		b.head(grid+".kps", "kps_"+strconv.Itoa(s), 10)
+	}
+
+	for _, s := range []int{8, 16, 32} {
+		for _, out := range []string{"cls", "obj", "bbox", "kps"} {
+			m.Outputs = append(m.Outputs, onnx.ValueInfo{Name: out + "_" + strconv.Itoa(s), Type: onnx.Float})
+		}
+	}
+	return m
+}
+
+// Width of the window features are looked for in around each cell, as
+// wide as a face less its edges
+const featureWindow = 7 * stride
+
+// featureShift computes, from the input, the horizontal offset in pixels
+// of the centroid of the features around each cell: of the pixels darker
+// than a luma of 100, weighted by how much darker
+func (b builder) featureShift() {
+	b.weight("feature.w", []int{1, 3, 1, 1}, []float32{-0.114, -0.587, -0.299}) // Blue, green, red
+	b.weight("feature.b", []int{1}, []float32{100})
+	b.node("Conv", []string{"input", "feature.w", "feature.b"}, "feature.luma", nil)
+	b.node("Relu", []string{"feature.luma"}, "feature", nil)
+
+	// Sums over the window centered on each cell of the darkness and of
+	// the darkness times the offset of its pixel from the center. One is
+	// added to the first so that it can divide the second.
+	pad := int64(featureWindow/2 - stride/2)
+	attrs := map[string]any{"strides": []int64{stride, stride}, "pads": []int64{pad, pad, pad, pad}}
+	offsets := make([]float32, featureWindow*featureWindow)
+	for i := range offsets {
+		offsets[i] = float32(i%featureWindow - featureWindow/2)
+	}
+	b.weight("darkness.w", []int{1, 1, featureWindow, featureWindow}, fill(featureWindow*featureWindow, 1))
+	b.weight("darkness.b", []int{1}, []float32{1})
+	b.node("Conv", []string{"feature", "darkness.w", "darkness.b"}, "darkness", attrs)
+	b.weight("moment.w", []int{1, 1, featureWindow, featureWindow}, offsets)
+	b.node("Conv", []string{"feature", "moment.w"}, "moment", attrs)
+	b.node("Div", []string{"moment", "darkness"}, "shift", nil)
+}
+
+// builder appends nodes and weights to a model
+type builder struct {
+	m *onnx.Model
+}
+
+func (b builder) weight(name string, shape []int, data []float32) {
+	b.m.Initializers[name] = onnx.NewFloat(shape, data)
+}
+
+func (b builder) node(op string, inputs []string, output string, attrs map[string]any) {
+	b.m.Nodes = append(b.m.Nodes, onnx.Node{Name: output, Op: op, Inputs: inputs, Outputs: []string{output}, Attrs: attrs})
+}
+
+// constant computes, from the single channel grid, one holding values in
+// its channels at every cell
+func (b builder) constant(grid, output string, values []float32) {
+	n := len(values)
+	b.weight(output+".w", []int{n, 1, 1, 1}, make([]float32, n))
+	b.weight(output+".b", []int{n}, values)
+	b.node("Conv", []string{grid, output + ".w", output + ".b"}, output, nil)
+}
+
+// head lays the channels of the grid input out as YuNet does, one row of
+// channels values per cell
+func (b builder) head(input, output string, channels int) {
+	b.node("Transpose", []string{input}, input+".t", map[string]any{"perm": []int64{0, 2, 3, 1}})
+	b.m.Initializers[output+".shape"] = onnx.NewInt64([]int{3}, []int64{1, -1, int64(channels)})
+	b.node("Reshape", []string{input + ".t", output + ".shape"}, output, nil)
+}
+
+func fill(n int, v float32) []float32 {
+	data := make([]float32, n)
+	for i := range data {
+		data[i] = v
+	}
+	return data
+}
+
+// Size of the embeddings the stand-in recognition model computes
+const embeddingSize = 128
+
+// RecognitionModel returns the stand-in recognition model. Its embedding
+// of an aligned face is the mean hue of its dark pixels, weighted by how
+// dark they are, spread over 128 values.
+func RecognitionModel() *onnx.Model {
+	m := &onnx.Model{
+		Opset:        13,
+		Inputs:       []onnx.ValueInfo{{Name: "data", Type: onnx.Float, Shape: []int{1, 3, 112, 112}}},
+		Outputs:      []onnx.ValueInfo{{Name: "fc1", Type: onnx.Float, Shape: []int{1, embeddingSize}}},
+		Initializers: map[string]*onnx.Tensor{},
+	}
+	b := builder{m}
+
+	// How far each pixel is below a luma of 100
+	b.weight("dark.w", []int{1, 3, 1, 1}, []float32{-0.299, -0.587, -0.114})
+	b.weight("dark.b", []int{1}, []float32{100})
+	b.node("Conv", []string{"data", "dark.w", "dark.b"}, "luma", nil)
+	b.node("Relu", []string{"luma"}, "dark", nil)
+
+	// Hue of each pixel, as its red, green and blue less their mean
+	hue := make([]float32, 9)
+	for i := range 3 {
+		for j := range 3 {
+			hue[3*i+j] = -1.0 / 3
+		}
+		hue[4*i] += 1
+	}
+	b.weight("hue.w", []int{3, 3, 1, 1}, hue)
+	b.node("Conv", []string{"data", "hue.w"}, "hue", nil)
+	b.node("Mul", []string{"hue", "dark"}, "dark_hue", nil)
+	b.node("GlobalAveragePool", []string{"dark_hue"}, "mean_hue", nil)
+	b.node("Flatten", []string{"mean_hue"}, "features", nil)
+
+	// Spread over orthogonal columns of a Hadamard matrix, so that the
+	// angles between embeddings are those between hues
+	spread := make([]float32, 3*embeddingSize)
+	for i, column := range []int{1, 2, 4} {
+		for j := range embeddingSize {
+			v := float32(1 / math.Sqrt(embeddingSize))
+			if bits.OnesCount(uint(column&j))%2 == 1 {
+				v = -v
+			}
+			spread[i*embeddingSize+j] = v
+		}
+	}
+	b.weight("fc1.w", []int{3, embeddingSize}, spread)
+	b.node("Gemm", []string{"features", "fc1.w"}, "fc1", nil)
+	return m
+}
+
+// WriteModel writes the stand-in detection model for inputs of any size to
+// a file removed when the test ends, and returns its path
+func WriteModel(t testing.TB) string {
+	t.Helper()
+	return write(t, Model(0, 0), "yunet.onnx")
+}
+
+// WriteRecognitionModel writes the stand-in recognition model like
+// WriteModel
+func WriteRecognitionModel(t testing.TB) string {
+	t.Helper()
+	return write(t, RecognitionModel(), "sface.onnx")
+}
+
+func write(t testing.TB, m *onnx.Model, name string) string {
+	t.Helper()
+
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// DrawFace draws the face of the first of People on img, centered at
+// center and scaled from FaceSize by scale
+func DrawFace(img draw.Image, center image.Point, scale float64) {
+	DrawPerson(img, center, scale, 0)
+}
+
+// DrawPerson draws the face of People[person] like DrawFace
+func DrawPerson(img draw.Image, center image.Point, scale float64, person int) {
+	DrawPose(img, center, scale, person, Pose{})
+}
+
+// Pose is how the person drawn by DrawPose holds their head
+type Pose struct {
+	// Turn is how far the head is turned to the person's left, which is
+	// right in the image, from -1 to 1. The features move sideways by up to
+	// a quarter of the face.
+	Turn       float64
+	EyesClosed bool
+}
+
+// DrawPose draws the face of People[person] like DrawFace, in pose. The
+// skin has a fine grain, the same wherever the face is drawn, standing for
+// the texture a camera picks up on a person and loses on a recapture.
+func DrawPose(img draw.Image, center image.Point, scale float64, person int, pose Pose) {
+	features := People[person]
+	radius := scale * FaceSize / 2
+	skin(img, center, radius)
+	turn := pose.Turn * FaceSize / 4
+	at := func(p image.Point) image.Point {
+		return center.Add(image.Pt(int(math.Round((float64(p.X)+turn)*scale)), int(math.Round(float64(p.Y)*scale))))
+	}
+	for _, eye := range []image.Point{at(Landmarks[0]), at(Landmarks[1])} {
+		if !pose.EyesClosed {
+			disc(img, eye, 4*scale, features)
+			continue
+		}
+		lid := image.Rect(eye.X-int(4*scale), eye.Y, eye.X+int(4*scale)+1, eye.Y+1)
+		draw.Draw(img, lid, image.NewUniform(features), image.Point{}, draw.Src)
+	}
+	right, left := at(Landmarks[3]), at(Landmarks[4])
+	mouth := image.Rect(right.X, right.Y-int(2*scale), left.X+1, left.Y+int(2*scale)+1)
+	draw.Draw(img, mouth, image.NewUniform(features), image.Point{}, draw.Src)
+}
+
+// Largest change of brightness the grain of the skin makes
+const grain = 12
+
+// skin fills the disc of radius around center with Skin, grained
+func skin(img draw.Image, center image.Point, radius float64) {
+	r := int(math.Ceil(radius))
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if float64(x*x+y*y) > radius*radius {
+				continue
+			}
+			// A hash of the offset, so the grain moves with the face
+			h := uint32(x)*0x9e3779b1 ^ uint32(y)*0x85ebca77
+			h ^= h >> 15
+			h *= 0x2c1b3c6d
+			h ^= h >> 12
+			d := int(h%(2*grain+1)) - grain
+			img.Set(center.X+x, center.Y+y, color.RGBA{
+				R: uint8(int(Skin.R) + d), G: uint8(int(Skin.G) + d), B: uint8(int(Skin.B) + d), A: 255,
+			})
+		}
+	}
+}
+
+// Print returns img as if printed and photographed: blurred, and washed
+// out toward gray
+func Print(img image.Image) *image.RGBA {
+	const radius = 2
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var sum [3]uint32
+			n := uint32(0)
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					p := image.Pt(x+dx, y+dy)
+					if !p.In(bounds) {
+						continue
+					}
+					r, g, b, _ := img.At(p.X, p.Y).RGBA()
+					sum[0], sum[1], sum[2] = sum[0]+r>>8, sum[1]+g>>8, sum[2]+b>>8
+					n++
+				}
+			}
+			r, g, b := sum[0]/n, sum[1]/n, sum[2]/n
+			gray := (r + g + b) / 3
+			out.Set(x, y, color.RGBA{R: uint8((r + 2*gray) / 3), G: uint8((g + 2*gray) / 3), B: uint8((b + 2*gray) / 3), A: 255})
+		}
+	}
+	return out
+}
+
+// Screen returns img as if shown on a screen and photographed: crossed by
+// the fine stripes of moiré the pixels of the screen make with those of
+// the camera
+func Screen(img image.Image) *image.RGBA {
+	const (
+		period    = 4.5 // Pixels
+		amplitude = 14
+		angle     = 0.35 // Radians
+	)
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			d := amplitude * math.Sin(2*math.Pi*(float64(x)*cos+float64(y)*sin)/period)
+			r, g, b, _ := img.At(x, y).RGBA()
+			shade := func(v uint32) uint8 {
+				return uint8(min(max(math.Round(float64(v>>8)+d), 0), 255))
+			}
+			out.Set(x, y, color.RGBA{R: shade(r), G: shade(g), B: shade(b), A: 255})
+		}
+	}
+	return out
+}
+
+// disc fills the disc of radius around center with c
+func disc(img draw.Image, center image.Point, radius float64, c color.Color) {
+	r := int(math.Ceil(radius))
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if float64(x*x+y*y) <= radius*radius {
+				img.Set(center.X+x, center.Y+y, c)
+			}
+		}
+	}
+}
+
+// Blank returns a light gray image of width by height pixels to draw on
+func Blank(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 235, G: 235, B: 235, A: 255}), image.Point{}, draw.Src)
+	return img
+}
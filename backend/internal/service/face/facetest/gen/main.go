@@ -0,0 +1,89 @@
+// Command gen writes the stand-in models of package facetest and the
+// fixture images the face service is tested with. Run it with go generate
+// in internal/service/face.
+package main
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+
+	"vws-backend/internal/onnx"
+	"vws-backend/internal/service/face/facetest"
+)
+
+// Centers of the faces drawn on the fixture images, on the centers of
+// cells of the grid of stride 8
+var (
+	oneFace    = []image.Point{{164, 116}}
+	threeFaces = []image.Point{{84, 84}, {244, 164}, {396, 236}}
+	otherFace  = image.Point{100, 148}
+)
+
+func main() {
+	out := flag.String("o", "testdata", "directory to write to")
+	flag.Parse()
+
+	for name, model := range map[string]*onnx.Model{
+		"standin_yunet.onnx": facetest.Model(0, 0),
+		"standin_sface.onnx": facetest.RecognitionModel(),
+	} {
+		data, err := model.Marshal()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(*out, name), data, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	write(filepath.Join(*out, "one_face.jpg"), faces(320, 240, oneFace))
+	write(filepath.Join(*out, "three_faces.png"), faces(480, 320, threeFaces))
+
+	// The person of one_face.jpg elsewhere, and someone else there
+	for name, person := range map[string]int{"same_person.jpg": 0, "other_person.jpg": 1} {
+		img := facetest.Blank(320, 240)
+		facetest.DrawPerson(img, otherFace, 1, person)
+		write(filepath.Join(*out, name), img)
+	}
+
+	// Shapes of other colors than skin
+	none := facetest.Blank(320, 240)
+	draw.Draw(none, image.Rect(40, 40, 140, 140), image.NewUniform(color.RGBA{R: 40, G: 90, B: 200, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(none, image.Rect(180, 80, 280, 200), image.NewUniform(color.RGBA{R: 90, G: 90, B: 90, A: 255}), image.Point{}, draw.Src)
+	write(filepath.Join(*out, "no_face.png"), none)
+}
+
+// faces returns an image of width by height pixels with faces at centers
+func faces(width, height int, centers []image.Point) image.Image {
+	img := facetest.Blank(width, height)
+	for _, c := range centers {
+		facetest.DrawFace(img, c, 1)
+	}
+	return img
+}
+
+// write encodes img to path, as JPEG or PNG by its extension
+func write(path string, img image.Image) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if filepath.Ext(path) == ".jpg" {
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(f, img)
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/onnx"
+	"vws-backend/internal/service/face/facetest"
+)
+
+func TestModelsAreCurrent(t *testing.T) {
+	for name, model := range map[string]*onnx.Model{
+		"standin_yunet.onnx": facetest.Model(0, 0),
+		"standin_sface.onnx": facetest.RecognitionModel(),
+	} {
+		want, err := model.Marshal()
+		require.NoError(t, err)
+
+		got, err := os.ReadFile("../../testdata/" + name)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "run go generate ./internal/service/face after changing %s", name)
+	}
+}
@@ -0,0 +1,398 @@
+package face
+
+import (
+	"container/heap"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+// Index finds, among the enrolled faces, those most similar to a face,
+// without comparing it with every one. It is a hierarchical navigable
+// small world graph (HNSW): each face links to faces near it on layers
+// thinning out exponentially, so a search walks from a far entry towards
+// the face in a number of steps growing with the logarithm of the faces.
+//
+// Embeddings of different lengths, computed by different models, don't
+// compare, so each length has a graph of its own. A face removed stays in
+// its graph to route searches until removed faces make half of it, when
+// the graph is rebuilt.
+type Index struct {
+	mu      sync.RWMutex
+	graphs  map[int]*graph // By length of the vectors
+	lengths map[int64]int  // Length of each user's vector, by user ID
+}
+
+// Neighbour is an indexed face similar to another
+type Neighbour struct {
+	UserID     int64
+	Similarity float32
+}
+
+// Parameters of the graphs
+const (
+	indexLinks          = 16  // Most links of a face on each layer above the bottom one, which has twice as many
+	indexConstructionEf = 100 // Candidates considered when linking a face
+	indexSearchEf       = 64  // Least candidates considered by a search
+)
+
+// indexLevelMult scales the exponential distribution of the top layer of
+// faces, so each layer has about 1/indexLinks of the faces below
+var indexLevelMult = 1 / math.Log(indexLinks)
+
+// NewIndex creates an empty index
+func NewIndex() *Index {
+	return &Index{graphs: make(map[int]*graph), lengths: make(map[int64]int)}
+}
+
+// addIfAbsent indexes vector as the face of a user unless theirs is
+func (x *Index) addIfAbsent(userID int64, vector []float32) {
+	vector = slices.Clone(vector)
+	normalize(vector)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if _, ok := x.lengths[userID]; ok {
+		return
+	}
+	x.graph(len(vector)).add(userID, vector)
+	x.lengths[userID] = len(vector)
+}
+
+// put indexes vector as the face of a user, replacing theirs if indexed.
+// Enrollments look up the faces similar to theirs with searchOthers first,
+// holding Verifier.enrollMu across both.
+func (x *Index) put(userID int64, vector []float32) {
+	vector = slices.Clone(vector)
+	normalize(vector)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(userID)
+	x.graph(len(vector)).add(userID, vector)
+	x.lengths[userID] = len(vector)
+}
+
+// Remove removes the user's face from the index, if indexed
+func (x *Index) Remove(userID int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(userID)
+}
+
+// graph returns the graph of vectors of length, creating it if needed
+func (x *Index) graph(length int) *graph {
+	g, ok := x.graphs[length]
+	if !ok {
+		g = newGraph()
+		x.graphs[length] = g
+	}
+	return g
+}
+
+func (x *Index) remove(userID int64) {
+	length, ok := x.lengths[userID]
+	if !ok {
+		return
+	}
+	delete(x.lengths, userID)
+	x.graphs[length].remove(userID)
+}
+
+// searchOthers returns the at most k indexed faces at least minSimilarity
+// similar to vector, most similar first, leaving out the user's face
+func (x *Index) searchOthers(userID int64, vector []float32, k int, minSimilarity float32) []Neighbour {
+	vector = slices.Clone(vector)
+	normalize(vector)
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	g, ok := x.graphs[len(vector)]
+	if !ok {
+		return nil
+	}
+	// One more candidate, in case the user's face is among them
+	return neighbours(g, g.search(vector, max(indexSearchEf, k+1)), userID, k, minSimilarity)
+}
+
+// Len returns the number of faces indexed
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.lengths)
+}
+
+// neighbours returns the at most k faces of found, sorted most similar
+// first, that are indexed, not of the user excluded and at least
+// minSimilarity similar
+func neighbours(g *graph, found []hit, excluded int64, k int, minSimilarity float32) []Neighbour {
+	var result []Neighbour
+	for _, c := range found {
+		if len(result) == k || c.similarity < minSimilarity {
+			break
+		}
+		n := &g.nodes[c.id]
+		if n.removed || n.userID == excluded {
+			continue
+		}
+		result = append(result, Neighbour{UserID: n.userID, Similarity: c.similarity})
+	}
+	return result
+}
+
+// graph is the HNSW graph of vectors of one length, normalized so their
+// dot product is their cosine similarity
+type graph struct {
+	nodes   []node
+	byUser  map[int64]int32 // Node of each user's face
+	entry   int32           // Node on the top layer searches start from, -1 when empty
+	removed int
+	rng     *rand.Rand
+}
+
+type node struct {
+	userID  int64
+	vector  []float32
+	links   [][]int32 // Linked nodes on each layer, from the bottom one to the top one of the node
+	removed bool
+}
+
+// hit is a node found by a search and its similarity to the vector
+// searched for
+type hit struct {
+	id         int32
+	similarity float32
+}
+
+func newGraph() *graph {
+	// Seeded, so the same faces build the same graph
+	return &graph{byUser: make(map[int64]int32), entry: -1, rng: rand.New(rand.NewPCG(1, 2))}
+}
+
+// add links a node for the user's face, which mustn't have one, and
+// returns the nodes found near it, most similar first
+func (g *graph) add(userID int64, vector []float32) []hit {
+	level := int(-math.Log(1-g.rng.Float64()) * indexLevelMult)
+	id := int32(len(g.nodes))
+	g.nodes = append(g.nodes, node{userID: userID, vector: vector, links: make([][]int32, level+1)})
+	g.byUser[userID] = id
+	if g.entry < 0 {
+		g.entry = id
+		return nil
+	}
+
+	top := len(g.nodes[g.entry].links) - 1
+	entries := []hit{{g.entry, dot(vector, g.nodes[g.entry].vector)}}
+	for layer := top; layer > level; layer-- {
+		entries = g.searchLayer(vector, entries, 1, layer)
+	}
+	var nearest []hit
+	for layer := min(level, top); layer >= 0; layer-- {
+		found := g.searchLayer(vector, entries, indexConstructionEf, layer)
+		for _, c := range g.selectLinks(found, indexLinks) {
+			g.nodes[id].links[layer] = append(g.nodes[id].links[layer], c.id)
+			g.link(c.id, id, layer, c.similarity)
+		}
+		entries, nearest = found, found
+	}
+	if level > top {
+		g.entry = id
+	}
+	return nearest
+}
+
+// link links from to to on layer, dropping the least useful link of from
+// if it has too many. similarity is the similarity of their vectors.
+func (g *graph) link(from, to int32, layer int, similarity float32) {
+	n := &g.nodes[from]
+	n.links[layer] = append(n.links[layer], to)
+	if len(n.links[layer]) <= maxLinks(layer) {
+		return
+	}
+
+	linked := make([]hit, len(n.links[layer]))
+	for i, id := range n.links[layer] {
+		if id == to {
+			linked[i] = hit{id, similarity}
+		} else {
+			linked[i] = hit{id, dot(n.vector, g.nodes[id].vector)}
+		}
+	}
+	sortHits(linked)
+	n.links[layer] = n.links[layer][:0]
+	for _, c := range g.selectLinks(linked, maxLinks(layer)) {
+		n.links[layer] = append(n.links[layer], c.id)
+	}
+}
+
+// maxLinks returns the most links a node has on layer
+func maxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * indexLinks
+	}
+	return indexLinks
+}
+
+// selectLinks returns at most m of the candidates to link a node with,
+// given most similar first. It prefers candidates more similar to the
+// node than to those already selected, which spreads the links out over
+// clusters of faces, and fills up with the rest.
+func (g *graph) selectLinks(candidates []hit, m int) []hit {
+	if len(candidates) <= m {
+		return candidates
+	}
+	selected := make([]hit, 0, m)
+	var skipped []hit
+	for _, c := range candidates {
+		if len(selected) == m {
+			return selected
+		}
+		spread := true
+		for _, s := range selected {
+			if dot(g.nodes[c.id].vector, g.nodes[s.id].vector) > c.similarity {
+				spread = false
+				break
+			}
+		}
+		if spread {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+	return append(selected, skipped[:min(len(skipped), m-len(selected))]...)
+}
+
+// search returns the ef nodes nearest vector found, most similar first
+func (g *graph) search(vector []float32, ef int) []hit {
+	if g.entry < 0 {
+		return nil
+	}
+	entries := []hit{{g.entry, dot(vector, g.nodes[g.entry].vector)}}
+	for layer := len(g.nodes[g.entry].links) - 1; layer > 0; layer-- {
+		entries = g.searchLayer(vector, entries, 1, layer)
+	}
+	return g.searchLayer(vector, entries, ef, 0)
+}
+
+// searchLayer walks layer from entries towards vector, and returns the ef
+// nodes nearest it found, most similar first
+func (g *graph) searchLayer(vector []float32, entries []hit, ef, layer int) []hit {
+	visited := make(map[int32]bool, ef*maxLinks(layer))
+	next := &hits{nearest: true} // To visit, nearest first
+	found := &hits{}             // Farthest first, to drop
+	for _, c := range entries {
+		visited[c.id] = true
+		heap.Push(next, c)
+		heap.Push(found, c)
+		if found.Len() > ef {
+			heap.Pop(found)
+		}
+	}
+
+	for next.Len() > 0 {
+		c := heap.Pop(next).(hit)
+		if found.Len() >= ef && c.similarity < found.items[0].similarity {
+			break // Nearer than any left to visit
+		}
+		for _, id := range g.nodes[c.id].links[layer] {
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			similarity := dot(vector, g.nodes[id].vector)
+			if found.Len() < ef || similarity > found.items[0].similarity {
+				heap.Push(next, hit{id, similarity})
+				heap.Push(found, hit{id, similarity})
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+	sortHits(found.items)
+	return found.items
+}
+
+// remove marks the user's node removed, rebuilding the graph once half of
+// its nodes are
+func (g *graph) remove(userID int64) {
+	id, ok := g.byUser[userID]
+	if !ok {
+		return
+	}
+	delete(g.byUser, userID)
+	g.nodes[id].removed = true
+	g.removed++
+	if g.removed*2 < len(g.nodes) {
+		return
+	}
+
+	nodes := g.nodes
+	*g = *newGraph()
+	for _, n := range nodes {
+		if !n.removed {
+			g.add(n.userID, n.vector)
+		}
+	}
+}
+
+// sortHits sorts hits most similar first
+func sortHits(h []hit) {
+	slices.SortFunc(h, func(a, b hit) int {
+		switch {
+		case a.similarity > b.similarity:
+			return -1
+		case a.similarity < b.similarity:
+			return 1
+		}
+		return 0
+	})
+}
+
+// dot returns the dot product of vectors of the same length. Searches
+// spend most of their time here, so it is unrolled.
+func dot(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// hits is a heap of hits, the least similar on top unless nearest
+type hits struct {
+	items   []hit
+	nearest bool
+}
+
+func (h *hits) Len() int { return len(h.items) }
+
+func (h *hits) Less(i, j int) bool {
+	if h.nearest {
+		return h.items[i].similarity > h.items[j].similarity
+	}
+	return h.items[i].similarity < h.items[j].similarity
+}
+
+func (h *hits) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *hits) Push(x any) { h.items = append(h.items, x.(hit)) }
+
+func (h *hits) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,157 @@
+package face
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// randomVectors returns n random vectors of length dim, normalized
+func randomVectors(rng *rand.Rand, n, dim int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+		normalize(vectors[i])
+	}
+	return vectors
+}
+
+// nearest returns the IDs, as indexes of vectors, of the k vectors most
+// similar to v by brute force
+func nearest(vectors [][]float32, v []float32, k int) []int64 {
+	ids := make([]int64, len(vectors))
+	for i := range ids {
+		ids[i] = int64(i)
+	}
+	slices.SortFunc(ids, func(a, b int64) int {
+		sa, sb := Similarity(v, vectors[a]), Similarity(v, vectors[b])
+		switch {
+		case sa > sb:
+			return -1
+		case sa < sb:
+			return 1
+		}
+		return 0
+	})
+	return ids[:k]
+}
+
+// enroll looks up the faces similar to vector and indexes it as the face
+// of the user, as Verifier.store does
+func enroll(x *Index, userID int64, vector []float32, k int, minSimilarity float32) []Neighbour {
+	found := x.searchOthers(userID, vector, k, minSimilarity)
+	x.put(userID, vector)
+	return found
+}
+
+func TestIndex_Recall(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	vectors := randomVectors(rng, 5000, 32)
+	x := NewIndex()
+	for i, v := range vectors {
+		x.put(int64(i), v)
+	}
+	if x.Len() != len(vectors) {
+		t.Fatalf("Len() = %d, want %d", x.Len(), len(vectors))
+	}
+
+	const k = 10
+	queries := randomVectors(rng, 200, 32)
+	hits := 0
+	for _, q := range queries {
+		got := x.searchOthers(-1, q, k, -1)
+		if len(got) != k {
+			t.Fatalf("searchOthers() returned %d faces, want %d", len(got), k)
+		}
+		want := nearest(vectors, q, k)
+		for i, n := range got {
+			if slices.Contains(want, n.UserID) {
+				hits++
+			}
+			if i > 0 && n.Similarity > got[i-1].Similarity {
+				t.Fatalf("searchOthers() = %v, not most similar first", got)
+			}
+		}
+	}
+	if recall := float64(hits) / float64(k*len(queries)); recall < 0.95 {
+		t.Errorf("recall = %.3f, want at least 0.95", recall)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	vectors := randomVectors(rng, 300, 16)
+	x := NewIndex()
+	for i, v := range vectors {
+		x.put(int64(i), v)
+	}
+
+	// A slightly different face of an indexed person finds them
+	twin := slices.Clone(vectors[7])
+	twin[0] += 0.1
+	got := enroll(x, 1000, twin, 5, 0.9)
+	if len(got) != 1 || got[0].UserID != 7 || got[0].Similarity < 0.9 {
+		t.Fatalf("enroll() = %v, want the face of user 7", got)
+	}
+	if got := enroll(x, 1000, twin, 5, 0.9); len(got) != 1 || got[0].UserID != 7 {
+		t.Errorf("enroll() again = %v, want only the face of user 7, not the user's own", got)
+	}
+	if x.Len() != 301 {
+		t.Errorf("Len() = %d, want 301, the face replaced", x.Len())
+	}
+	if got := x.searchOthers(7, vectors[7], 2, 0.9); len(got) != 1 || got[0].UserID != 1000 {
+		t.Errorf("searchOthers() = %v, want user 1000, not the user's own", got)
+	}
+
+	// Faces of another model are kept apart
+	if got := enroll(x, 2000, vectors[7][:8], 5, -1); len(got) != 0 {
+		t.Errorf("enroll() of another length = %v, want no faces", got)
+	}
+	if got := x.searchOthers(-1, vectors[7][:8], 5, -1); len(got) != 1 || got[0].UserID != 2000 {
+		t.Errorf("searchOthers() of another length = %v, want user 2000", got)
+	}
+
+	x.Remove(7)
+	x.Remove(7)
+	if got := x.searchOthers(-1, vectors[7], 1, 0.9); len(got) != 1 || got[0].UserID != 1000 {
+		t.Errorf("searchOthers() after removing user 7 = %v, want user 1000", got)
+	}
+
+	// Removing most faces rebuilds the graph, which keeps finding the rest
+	for i := range 250 {
+		x.Remove(int64(i))
+	}
+	if x.Len() != 52 {
+		t.Errorf("Len() = %d, want 52", x.Len())
+	}
+	for i := 250; i < 300; i++ {
+		if got := x.searchOthers(-1, vectors[i], 1, 0.99); len(got) != 1 || got[0].UserID != int64(i) {
+			t.Errorf("searchOthers() for user %d = %v", i, got)
+		}
+	}
+}
+
+func BenchmarkIndex_Enroll(b *testing.B) {
+	vectors := randomVectors(rand.New(rand.NewPCG(7, 8)), b.N, 128)
+	x := NewIndex()
+	b.ResetTimer()
+	for i, v := range vectors {
+		enroll(x, int64(i), v, 5, DefaultDuplicateThreshold)
+	}
+}
+
+func BenchmarkIndex_Search(b *testing.B) {
+	rng := rand.New(rand.NewPCG(9, 10))
+	x := NewIndex()
+	for i, v := range randomVectors(rng, 20000, 128) {
+		x.put(int64(i), v)
+	}
+	queries := randomVectors(rng, b.N, 128)
+	b.ResetTimer()
+	for _, q := range queries {
+		x.searchOthers(-1, q, 5, DefaultDuplicateThreshold)
+	}
+}
@@ -0,0 +1,230 @@
+package face
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/cmplx"
+)
+
+// Liveness is how likely a face is of a person in front of the camera,
+// rather than a photo of them, printed or on a screen
+type Liveness struct {
+	Score     float32  `json:"score"`     // Between 0 and 1
+	Threshold float32  `json:"threshold"` // Lowest score of a live face
+	Live      bool     `json:"live"`      // Whether Score reaches Threshold
+	Reasons   []string `json:"reasons"`   // Why the face looks recaptured, empty if it doesn't
+}
+
+// Reasons a face looks recaptured
+const (
+	ReasonBlurred    = "blurred"     // Lacks the fine detail of skin, as prints do
+	ReasonMoire      = "moire"       // Crossed by the regular stripes screens show on camera
+	ReasonWashedOut  = "washed_out"  // Has the faded colors of prints
+	ReasonNoResponse = "no_response" // Didn't move as a challenge asked
+)
+
+// DefaultLivenessThreshold is the score faces are considered live from
+const DefaultLivenessThreshold = 0.5
+
+// LivenessChecker tells faces of people in front of the camera from
+// recaptured ones
+type LivenessChecker interface {
+	// Check scores how live face, detected in img, looks. Reasons lists
+	// the cues scoring below one half; Threshold and Live are left to the
+	// caller.
+	Check(ctx context.Context, img image.Image, face Face) (*Liveness, error)
+}
+
+// TextureLiveness checks liveness from a single image, by the texture of
+// the aligned face: a printed photo loses the fine detail and the colors
+// of skin, and a photo of a screen picks up moiré, a regular pattern that
+// stands out as a peak of its spectrum. Each cue scores from 0 to 1 and
+// the face scores its weakest.
+//
+// The cues are heuristics: they catch plain recaptures, and take faces too
+// small or out of focus in the image for prints. They are experimental:
+// their ranges were set on the synthetic faces of facetest, not on photos
+// from real cameras. Dim or tinted light and pale skin can wash a live
+// face out, so the scores are reported without refusing anyone unless
+// liveness is required by configuration.
+type TextureLiveness struct{}
+
+// Ranges over which the cues go from failing to passing
+var (
+	detailRange     = [2]float64{5, 9}       // Mean absolute Laplacian of the luma
+	moireRange      = [2]float64{8, 5}       // Highest peak of the spectrum over the mean of its ring
+	saturationRange = [2]float64{0.12, 0.22} // Mean saturation of the skin
+)
+
+// Region of the aligned face analyzed, between the eyebrows and the chin
+const (
+	regionSize       = 64
+	regionX, regionY = (alignedSize - regionSize) / 2, 36
+)
+
+const (
+	minFreq, maxFreq = 6, regionSize / 2 // Band of the spectrum moiré is looked for in, in cycles
+	darkestSkin      = 60                // Lowest luma of the pixels saturation is measured on
+	passingCue       = 0.5               // Lowest score of a cue not reported as a reason
+)
+
+// Check scores the texture of face, see LivenessChecker
+func (TextureLiveness) Check(ctx context.Context, img image.Image, face Face) (*Liveness, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	aligned := align(img, face.Landmarks)
+	luma, saturation := analyze(aligned)
+
+	cues := []struct {
+		reason string
+		score  float64
+	}{
+		{ReasonBlurred, ramp(detail(luma), detailRange)},
+		{ReasonMoire, ramp(moire(luma), moireRange)},
+		{ReasonWashedOut, ramp(saturation, saturationRange)},
+	}
+	result := &Liveness{Score: 1, Reasons: []string{}}
+	for _, cue := range cues {
+		result.Score = min(result.Score, float32(cue.score))
+		if cue.score < passingCue {
+			result.Reasons = append(result.Reasons, cue.reason)
+		}
+	}
+	return result, nil
+}
+
+// analyze returns the luma of the region of an aligned face, row by row,
+// and the mean saturation of its skin
+func analyze(aligned *image.RGBA) ([]float64, float64) {
+	luma := make([]float64, regionSize*regionSize)
+	var saturation float64
+	skin := 0
+	for y := range regionSize {
+		for x := range regionSize {
+			i := aligned.PixOffset(regionX+x, regionY+y)
+			r, g, b := float64(aligned.Pix[i]), float64(aligned.Pix[i+1]), float64(aligned.Pix[i+2])
+			l := luma601(r, g, b)
+			luma[y*regionSize+x] = l
+			if l >= darkestSkin {
+				hi := max(r, g, b)
+				saturation += (hi - min(r, g, b)) / hi
+				skin++
+			}
+		}
+	}
+	if skin == 0 {
+		return luma, 0
+	}
+	return luma, saturation / float64(skin)
+}
+
+// luma601 returns the luma of a color, as weighted by BT.601
+func luma601(r, g, b float64) float64 {
+	return 0.299*r + 0.587*g + 0.114*b
+}
+
+// detail returns the mean absolute Laplacian of luma, high where it has
+// fine detail
+func detail(luma []float64) float64 {
+	var sum float64
+	for y := 1; y < regionSize-1; y++ {
+		for x := 1; x < regionSize-1; x++ {
+			i := y*regionSize + x
+			sum += math.Abs(4*luma[i] - luma[i-1] - luma[i+1] - luma[i-regionSize] - luma[i+regionSize])
+		}
+	}
+	return sum / ((regionSize - 2) * (regionSize - 2))
+}
+
+// moire returns the highest magnitude of the spectrum of luma over the
+// band of fine stripes, relative to the mean of those as fine: noise and
+// the edges of features spread over the band, a regular pattern peaks
+func moire(luma []float64) float64 {
+	var mean float64
+	for _, l := range luma {
+		mean += l
+	}
+	mean /= float64(len(luma))
+
+	// Windowed, so the edges of the region don't show as stripes
+	window := make([]float64, regionSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/regionSize)
+	}
+	spectrum := make([]complex128, len(luma))
+	for y := range regionSize {
+		for x := range regionSize {
+			spectrum[y*regionSize+x] = complex((luma[y*regionSize+x]-mean)*window[x]*window[y], 0)
+		}
+	}
+	dft2(spectrum)
+
+	// Mean magnitude of each ring of frequencies, as the spectra of faces
+	// fall off with frequency
+	var rings [maxFreq + 1]struct {
+		sum float64
+		n   int
+	}
+	band := func(u, v int) (ring int, ok bool) {
+		fv := v
+		if v >= regionSize/2 {
+			fv -= regionSize
+		}
+		// Horizontal and vertical edges, such as those of the eyes and
+		// mouth, line the axes
+		r := int(math.Round(math.Hypot(float64(u), float64(fv))))
+		return r, r >= minFreq && r <= maxFreq && u > 1 && fv*fv > 1
+	}
+	for v := range regionSize {
+		for u := range regionSize / 2 { // The other half mirrors it
+			if r, ok := band(u, v); ok {
+				rings[r].sum += cmplx.Abs(spectrum[v*regionSize+u])
+				rings[r].n++
+			}
+		}
+	}
+	var peak float64
+	for v := range regionSize {
+		for u := range regionSize / 2 {
+			if r, ok := band(u, v); ok && rings[r].sum > 0 {
+				peak = max(peak, cmplx.Abs(spectrum[v*regionSize+u])*float64(rings[r].n)/rings[r].sum)
+			}
+		}
+	}
+	return peak
+}
+
+// dft2 replaces data, regionSize by regionSize values row by row, with its
+// discrete Fourier transform, along rows then columns
+func dft2(data []complex128) {
+	twiddle := make([]complex128, regionSize)
+	for k := range twiddle {
+		twiddle[k] = cmplx.Rect(1, -2*math.Pi*float64(k)/regionSize)
+	}
+	line := make([]complex128, regionSize)
+	transform := func(at func(i int) *complex128) {
+		for k := range regionSize {
+			var sum complex128
+			for i := range regionSize {
+				sum += *at(i) * twiddle[k*i%regionSize]
+			}
+			line[k] = sum
+		}
+		for k := range regionSize {
+			*at(k) = line[k]
+		}
+	}
+	for row := range regionSize {
+		transform(func(i int) *complex128 { return &data[row*regionSize+i] })
+	}
+	for col := range regionSize {
+		transform(func(i int) *complex128 { return &data[i*regionSize+col] })
+	}
+}
+
+// ramp maps v to 0 at r[0], 1 at r[1] and linearly between, clamped
+func ramp(v float64, r [2]float64) float64 {
+	return min(max((v-r[0])/(r[1]-r[0]), 0), 1)
+}
@@ -0,0 +1,87 @@
+package face
+
+import (
+	"context"
+	"image"
+	"slices"
+	"testing"
+
+	"vws-backend/internal/service/face/facetest"
+)
+
+// drawnFace returns the face facetest draws at center, as detected
+func drawnFace(center image.Point) Face {
+	face := Face{Box: image.Rectangle{
+		Min: center.Sub(image.Pt(facetest.FaceSize/2, facetest.FaceSize/2)),
+		Max: center.Add(image.Pt(facetest.FaceSize/2, facetest.FaceSize/2)),
+	}}
+	for _, l := range facetest.Landmarks {
+		face.Landmarks = append(face.Landmarks, center.Add(l))
+	}
+	return face
+}
+
+func TestTextureLiveness(t *testing.T) {
+	center := image.Pt(164, 116)
+	tests := []struct {
+		name        string
+		recapture   func(image.Image) *image.RGBA
+		wantLive    bool
+		wantReasons []string
+	}{
+		{name: "Live", recapture: nil, wantLive: true, wantReasons: []string{}},
+		{name: "Printed", recapture: facetest.Print, wantReasons: []string{ReasonBlurred, ReasonWashedOut}},
+		{name: "On a screen", recapture: facetest.Screen, wantReasons: []string{ReasonMoire}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for person := range facetest.People {
+				canvas := facetest.Blank(320, 240)
+				facetest.DrawPerson(canvas, center, 1, person)
+				var img image.Image = canvas
+				if tt.recapture != nil {
+					img = tt.recapture(canvas)
+				}
+
+				got, err := TextureLiveness{}.Check(context.Background(), img, drawnFace(center))
+				if err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				if got.Score < 0 || got.Score > 1 || (got.Score >= DefaultLivenessThreshold) != tt.wantLive {
+					t.Errorf("person %d: Check() score = %v, want live %v", person, got.Score, tt.wantLive)
+				}
+				if !slices.Equal(got.Reasons, tt.wantReasons) {
+					t.Errorf("person %d: Check() reasons = %v, want %v", person, got.Reasons, tt.wantReasons)
+				}
+			}
+		})
+	}
+}
+
+func TestService_DetectFace_Liveness(t *testing.T) {
+	svc, err := NewService("testdata/standin_yunet.onnx", DefaultThresholds)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	img := loadImage(t, "one_face.jpg")
+
+	for _, tt := range []struct {
+		img       image.Image
+		threshold float32
+		live      bool
+	}{
+		{img: img, threshold: DefaultLivenessThreshold, live: true},
+		{img: facetest.Screen(img), threshold: DefaultLivenessThreshold, live: false},
+		{img: facetest.Screen(img), threshold: 0, live: true},
+	} {
+		svc.SetLivenessThreshold(tt.threshold)
+		result, err := svc.DetectFace(context.Background(), tt.img)
+		if err != nil || len(result.Faces) != 1 {
+			t.Fatalf("DetectFace() = %+v, %v, want one face", result, err)
+		}
+		got := result.Faces[0].Liveness
+		if got == nil || got.Threshold != tt.threshold || got.Live != tt.live {
+			t.Errorf("DetectFace() liveness at threshold %v = %+v, want live %v", tt.threshold, got, tt.live)
+		}
+	}
+}
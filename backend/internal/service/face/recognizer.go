@@ -0,0 +1,55 @@
+package face
+
+import (
+	"context"
+	"image"
+	"math"
+)
+
+// Recognizer computes embeddings of faces: vectors pointing the same way
+// for faces of the same person
+type Recognizer interface {
+	// Embed returns the embedding of face, detected in img, scaled to
+	// unit length
+	Embed(ctx context.Context, img image.Image, face Face) ([]float32, error)
+
+	// Close releases the resources of the recognizer
+	Close() error
+}
+
+// DefaultMatchThreshold is the similarity above which SFace embeddings
+// are of the same person, as evaluated on LFW
+const DefaultMatchThreshold = 0.363
+
+// Similarity returns the cosine similarity of two embeddings, between -1
+// and 1, or 0 if they differ in length or either is zero
+func Similarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(na*nb))
+}
+
+// normalize scales v to unit length in place
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	scale := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= scale
+	}
+}
@@ -0,0 +1,49 @@
+package face
+
+import (
+	"context"
+	"time"
+)
+
+// Repository stores the reference faces users enroll, the duplicates
+// flagged among them and the liveness challenges they are issued
+type Repository interface {
+	// WithTx runs fn in a transaction, as user.Repository.WithTx does
+	WithTx(ctx context.Context, fn func(Repository) error) error
+
+	// CreateEmbedding stores the reference face of a user, returning
+	// ErrAlreadyEnrolled if they have one
+	CreateEmbedding(ctx context.Context, e *Embedding) error
+	// UpdateEmbedding replaces the vector of a user's reference face and
+	// its UpdatedAt, setting CreatedAt from the stored one. It returns
+	// ErrNotEnrolled if the user has none.
+	UpdateEmbedding(ctx context.Context, e *Embedding) error
+	GetEmbedding(ctx context.Context, userID int64) (*Embedding, error)
+	DeleteEmbedding(ctx context.Context, userID int64) error
+	// ListEmbeddings returns at most limit reference faces of users with
+	// IDs above afterUserID, by user ID
+	ListEmbeddings(ctx context.Context, afterUserID int64, limit int) ([]Embedding, error)
+
+	// CreateDuplicate stores a flagged duplicate and sets its ID,
+	// returning ErrDuplicateFlagged if the two users are already flagged,
+	// either way round
+	CreateDuplicate(ctx context.Context, d *Duplicate) error
+	// ListDuplicates returns flagged duplicates with status, or all if
+	// empty, oldest first
+	ListDuplicates(ctx context.Context, status string, limit, offset int) ([]*Duplicate, error)
+	// ReviewDuplicate sets the status, reviewer and review time of the
+	// duplicate with d.ID, filling in the rest of d from the stored one.
+	// It returns ErrDuplicateNotFound if there is none.
+	ReviewDuplicate(ctx context.Context, d *Duplicate) error
+	// IsConfirmedDuplicate reports whether the user enrolled a face
+	// confirmed to duplicate another user's
+	IsConfirmedDuplicate(ctx context.Context, userID int64) (bool, error)
+
+	// SaveChallenge stores a challenge issued to a user, replacing any they
+	// were issued before
+	SaveChallenge(ctx context.Context, c *IssuedChallenge) error
+	// TakeChallenge deletes and returns the challenge with id issued to
+	// the user, returning ErrChallengeNotFound if there is none or it
+	// expired by now
+	TakeChallenge(ctx context.Context, userID int64, id string, now time.Time) (*IssuedChallenge, error)
+}
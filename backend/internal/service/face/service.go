@@ -3,26 +3,46 @@ package face
 import (
 	"context"
 	"errors"
+	"fmt"
 	"image"
-	"image/color"
 	"sync"
+
+	"vws-backend/internal/metrics"
+	"vws-backend/internal/tracing"
 )
 
-// Service represents the face detection service
+//go:generate go run ./facetest/gen -o testdata
+
+// Service represents the face detection service. It checks the liveness
+// of the faces it detects too.
 type Service struct {
-	modelPath string
-	mu        sync.RWMutex
+	mu                sync.RWMutex
+	detector          Detector // Nil while no model is loaded
+	loadErr           error    // Why the model isn't loaded
+	thresholds        Thresholds
+	liveness          LivenessChecker
+	livenessThreshold float32
 }
 
-// NewService creates a new face detection service
-func NewService(modelPath string) (*Service, error) {
+// NewService creates a face detection service for the YuNet model at
+// modelPath. A model that can't be loaded doesn't fail the service: Ready
+// reports it until SetModelPath loads another.
+func NewService(modelPath string, thresholds Thresholds) (*Service, error) {
 	if modelPath == "" {
 		return nil, errors.New("model path cannot be empty")
 	}
 
-	return &Service{
-		modelPath: modelPath,
-	}, nil
+	s := &Service{thresholds: thresholds, liveness: TextureLiveness{}, livenessThreshold: DefaultLivenessThreshold}
+	s.detector, s.loadErr = loadDetector(modelPath)
+	return s, nil
+}
+
+func loadDetector(path string) (Detector, error) {
+	detector, err := LoadYuNet(path)
+	if err != nil {
+		return nil, err
+	}
+	return detector, nil
 }
 
 // DetectionResult represents the result of face detection
@@ -31,108 +51,113 @@ type DetectionResult struct {
 	Error error
 }
 
-// Face represents a detected face
+// Face represents a detected face. Its landmarks are the right eye, left
+// eye, nose tip, right and left mouth corners, right and left as seen by
+// the person in the image.
 type Face struct {
 	Box       image.Rectangle
 	Score     float32
 	Landmarks []image.Point
+	Liveness  *Liveness // Nil until checked
 }
 
-// DetectFace detects faces in the given image using a basic skin color detection approach
-func (s *Service) DetectFace(ctx context.Context, img image.Image) (*DetectionResult, error) {
+// DetectFace detects the faces in the given image
+func (s *Service) DetectFace(ctx context.Context, img image.Image) (_ *DetectionResult, err error) {
+	ctx, span := tracing.Start(ctx, "face.DetectFace")
+	defer tracing.End(span, &err)
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	result, err := s.detect(ctx, img)
+	switch {
+	case err != nil:
+		metrics.FaceDetections.WithLabelValues(metrics.FaceError).Inc()
+	case len(result.Faces) == 0:
+		metrics.FaceDetections.WithLabelValues(metrics.FaceNone).Inc()
+	default:
+		metrics.FaceDetections.WithLabelValues(metrics.FaceDetected).Inc()
+	}
+	return result, err
+}
+
+func (s *Service) detect(ctx context.Context, img image.Image) (*DetectionResult, error) {
 	if img == nil {
 		return nil, errors.New("input image is nil")
 	}
-
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
-
-	// For small images, return no faces
-	if width < 64 || height < 64 {
-		return &DetectionResult{
-			Faces: []Face{},
-		}, nil
+	if s.detector == nil {
+		return nil, fmt.Errorf("face model not loaded: %w", s.loadErr)
 	}
 
-	// Simple face detection based on skin color and basic shape detection
-	var faces []Face
-
-	// Scan the image in blocks
-	blockSize := width / 4 // Adjust block size based on image width
-	for y := 0; y < height-blockSize; y += blockSize / 2 {
-		for x := 0; x < width-blockSize; x += blockSize / 2 {
-			// Check if this block might contain a face
-			if isFaceBlock(img, x, y, blockSize) {
-				face := Face{
-					Box:   image.Rect(x, y, x+blockSize, y+blockSize),
-					Score: 0.8, // Confidence score
-					Landmarks: []image.Point{
-						{X: x + blockSize/3, Y: y + blockSize/3},   // Left eye
-						{X: x + 2*blockSize/3, Y: y + blockSize/3}, // Right eye
-						{X: x + blockSize/2, Y: y + 2*blockSize/3}, // Nose
-					},
-				}
-				faces = append(faces, face)
-
-				// Since our test images only contain one face, we can stop after finding it
-				if len(faces) == 1 {
-					break
-				}
-			}
-		}
-		if len(faces) == 1 {
-			break
+	faces, err := s.detector.Detect(ctx, img, s.thresholds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range faces {
+		liveness, err := s.liveness.Check(ctx, img, faces[i])
+		if err != nil {
+			return nil, fmt.Errorf("check liveness: %w", err)
 		}
+		liveness.Threshold = s.livenessThreshold
+		liveness.Live = liveness.Score >= s.livenessThreshold
+		faces[i].Liveness = liveness
 	}
+	return &DetectionResult{Faces: faces}, nil
+}
+
+// Ready reports whether the detection model is loaded
+func (s *Service) Ready() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return &DetectionResult{
-		Faces: faces,
-	}, nil
+	if s.detector == nil {
+		return fmt.Errorf("face model not loaded: %w", s.loadErr)
+	}
+	return nil
 }
 
-// isFaceBlock checks if an image block might contain a face based on skin color
-func isFaceBlock(img image.Image, x, y, size int) bool {
-	skinPixels := 0
-	threshold := 0.4 // Lower threshold to be more lenient
-
-	for dy := 0; dy < size; dy++ {
-		for dx := 0; dx < size; dx++ {
-			if x+dx < img.Bounds().Max.X && y+dy < img.Bounds().Max.Y {
-				if isSkinColor(img.At(x+dx, y+dy)) {
-					skinPixels++
-				}
-			}
-		}
+// SetModelPath switches to the model at path, which must load. Detections
+// already running finish with the previous model.
+func (s *Service) SetModelPath(path string) error {
+	detector, err := loadDetector(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	previous := s.detector
+	s.detector, s.loadErr = detector, nil
+	s.mu.Unlock()
+
+	if previous != nil {
+		return previous.Close()
 	}
+	return nil
+}
 
-	ratio := float64(skinPixels) / float64(size*size)
-	return ratio > threshold
+// SetThresholds changes the thresholds faces are detected with
+func (s *Service) SetThresholds(thresholds Thresholds) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.thresholds = thresholds
 }
 
-// isSkinColor checks if a color is within the range of skin colors
-func isSkinColor(c color.Color) bool {
-	r, g, b, _ := c.RGBA()
-
-	// Convert from 0-65535 to 0-255 range
-	r = r >> 8
-	g = g >> 8
-	b = b >> 8
-
-	// More lenient skin color detection
-	return r > 150 && // High red component
-		g > 100 && // Moderate green component
-		b > 50 && // Some blue component
-		r > g && // Red should be highest
-		g > b // Green should be higher than blue
+// SetLivenessThreshold changes the score faces are considered live from
+func (s *Service) SetLivenessThreshold(threshold float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.livenessThreshold = threshold
 }
 
 // Close releases resources used by the service
 func (s *Service) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return nil
+
+	if s.detector == nil {
+		return nil
+	}
+	err := s.detector.Close()
+	s.detector, s.loadErr = nil, errors.New("service closed")
+	return err
 }
@@ -3,10 +3,30 @@ package face
 import (
 	"context"
 	"image"
-	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
 	"testing"
+
+	"vws-backend/internal/service/face/facetest"
 )
 
+// loadImage decodes a fixture image of testdata
+func loadImage(t *testing.T, name string) image.Image {
+	t.Helper()
+
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("decode %s: %v", name, err)
+	}
+	return img
+}
+
 func TestNewService(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -15,7 +35,7 @@ func TestNewService(t *testing.T) {
 	}{
 		{
 			name:      "Valid model path",
-			modelPath: "testdata/yunet.onnx",
+			modelPath: "testdata/standin_yunet.onnx",
 			wantErr:   false,
 		},
 		{
@@ -27,7 +47,7 @@ func TestNewService(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			svc, err := NewService(tt.modelPath)
+			svc, err := NewService(tt.modelPath, DefaultThresholds)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewService() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -40,7 +60,7 @@ func TestNewService(t *testing.T) {
 }
 
 func TestService_DetectFace(t *testing.T) {
-	svc, err := NewService("testdata/yunet.onnx")
+	svc, err := NewService("testdata/standin_yunet.onnx", DefaultThresholds)
 	if err != nil {
 		t.Fatalf("Failed to create service: %v", err)
 	}
@@ -48,31 +68,34 @@ func TestService_DetectFace(t *testing.T) {
 	tests := []struct {
 		name    string
 		img     image.Image
-		want    int // Expected number of faces
+		centers []image.Point // Of the faces expected, best first
 		wantErr bool
 	}{
 		{
-			name:    "Valid image with face",
-			img:     createTestImage(320, 320, true), // Image with a face
-			want:    1,
-			wantErr: false,
+			name:    "One face",
+			img:     loadImage(t, "one_face.jpg"),
+			centers: []image.Point{{164, 116}},
 		},
 		{
-			name:    "Valid image without face",
-			img:     createTestImage(320, 320, false), // Image without a face
-			want:    0,
-			wantErr: false,
+			name:    "Three faces",
+			img:     loadImage(t, "three_faces.png"),
+			centers: []image.Point{{84, 84}, {244, 164}, {396, 236}},
 		},
 		{
-			name:    "Small image",
-			img:     createTestImage(32, 32, true),
-			want:    0,
-			wantErr: false,
+			name: "No face",
+			img:  loadImage(t, "no_face.png"),
+		},
+		{
+			name: "Small image",
+			img:  facetest.Blank(32, 32),
+		},
+		{
+			name: "Empty image",
+			img:  image.NewRGBA(image.Rectangle{}),
 		},
 		{
 			name:    "Nil image",
 			img:     nil,
-			want:    0,
 			wantErr: true,
 		},
 	}
@@ -84,15 +107,112 @@ func TestService_DetectFace(t *testing.T) {
 				t.Errorf("DetectFace() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !tt.wantErr && len(result.Faces) != tt.want {
-				t.Errorf("DetectFace() got %v faces, want %v", len(result.Faces), tt.want)
+			if tt.wantErr {
+				return
+			}
+			if len(result.Faces) != len(tt.centers) {
+				t.Fatalf("DetectFace() got %v faces, want %v", len(result.Faces), len(tt.centers))
+			}
+			for _, center := range tt.centers {
+				checkFace(t, findFace(result.Faces, center), center, 1)
+			}
+		})
+	}
+}
+
+// findFace returns the face centered closest to center
+func findFace(faces []Face, center image.Point) Face {
+	var best Face
+	bestDist := -1
+	for _, f := range faces {
+		d := f.Box.Min.Add(f.Box.Max).Div(2).Sub(center)
+		if dist := d.X*d.X + d.Y*d.Y; bestDist < 0 || dist < bestDist {
+			best, bestDist = f, dist
+		}
+	}
+	return best
+}
+
+// checkFace checks that face is the one facetest.DrawFace draws at center,
+// scaled by scale, within a couple of pixels
+func checkFace(t *testing.T, face Face, center image.Point, scale float64) {
+	t.Helper()
+
+	near := func(got, want image.Point) bool {
+		d := got.Sub(want)
+		return d.X >= -2 && d.X <= 2 && d.Y >= -2 && d.Y <= 2
+	}
+	at := func(p image.Point) image.Point {
+		return center.Add(image.Pt(int(float64(p.X)*scale), int(float64(p.Y)*scale)))
+	}
+	half := int(facetest.FaceSize * scale / 2)
+	want := image.Rect(center.X-half, center.Y-half, center.X+half, center.Y+half)
+	if !near(face.Box.Min, want.Min) || !near(face.Box.Max, want.Max) {
+		t.Errorf("face box = %v, want %v", face.Box, want)
+	}
+	if face.Score < DefaultThresholds.Score || face.Score > 1 {
+		t.Errorf("face score = %v, want at least %v", face.Score, DefaultThresholds.Score)
+	}
+	if len(face.Landmarks) != len(facetest.Landmarks) {
+		t.Fatalf("face has %d landmarks, want %d", len(face.Landmarks), len(facetest.Landmarks))
+	}
+	for i, l := range facetest.Landmarks {
+		if !near(face.Landmarks[i], at(l)) {
+			t.Errorf("landmark %d = %v, want %v", i, face.Landmarks[i], at(l))
+		}
+	}
+}
+
+func TestService_SetThresholds(t *testing.T) {
+	svc, err := NewService("testdata/standin_yunet.onnx", DefaultThresholds)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	img := loadImage(t, "three_faces.png")
+
+	tests := []struct {
+		name       string
+		thresholds Thresholds
+		faces      func(n int) bool
+	}{
+		{
+			name:       "Default",
+			thresholds: DefaultThresholds,
+			faces:      func(n int) bool { return n == 3 },
+		},
+		{
+			name:       "Score above every face",
+			thresholds: Thresholds{Score: 0.999, IoU: 0.3},
+			faces:      func(n int) bool { return n == 0 },
+		},
+		{
+			name:       "Overlapping faces kept",
+			thresholds: Thresholds{Score: 0.9, IoU: 0.9},
+			faces:      func(n int) bool { return n > 3 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc.SetThresholds(tt.thresholds)
+			result, err := svc.DetectFace(context.Background(), img)
+			if err != nil {
+				t.Fatalf("DetectFace() error = %v", err)
+			}
+			if !tt.faces(len(result.Faces)) {
+				t.Errorf("DetectFace() got %d faces", len(result.Faces))
+			}
+			for i := 1; i < len(result.Faces); i++ {
+				if result.Faces[i].Score > result.Faces[i-1].Score {
+					t.Errorf("face %d scored %v, above face %d", i, result.Faces[i].Score, i-1)
+				}
 			}
 		})
 	}
 }
 
 func TestService_Close(t *testing.T) {
-	svc, err := NewService("testdata/yunet.onnx")
+	svc, err := NewService("testdata/standin_yunet.onnx", DefaultThresholds)
 	if err != nil {
 		t.Fatalf("Failed to create service: %v", err)
 	}
@@ -100,55 +220,51 @@ func TestService_Close(t *testing.T) {
 	if err := svc.Close(); err != nil {
 		t.Errorf("Close() error = %v", err)
 	}
+	if _, err := svc.DetectFace(context.Background(), facetest.Blank(32, 32)); err == nil {
+		t.Error("DetectFace() error = nil after Close")
+	}
 }
 
-// Helper function to create a test image
-func createTestImage(width, height int, withFace bool) image.Image {
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-
-	// Fill background with white
-	for x := 0; x < width; x++ {
-		for y := 0; y < height; y++ {
-			img.Set(x, y, color.White)
-		}
+func TestService_Ready(t *testing.T) {
+	svc, err := NewService("testdata/standin_yunet.onnx", DefaultThresholds)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
 	}
-
-	if withFace {
-		// Draw a simple face-like pattern with skin color
-		centerX := width / 2
-		centerY := height / 2
-		faceSize := width / 4
-
-		// Draw face outline with skin color
-		skinColor := color.RGBA{R: 255, G: 200, B: 150, A: 255}
-		drawCircle(img, centerX, centerY, faceSize, skinColor)
-
-		// Draw features in darker color
-		featureColor := color.RGBA{R: 100, G: 80, B: 60, A: 255}
-		eyeSize := faceSize / 4
-		drawCircle(img, centerX-faceSize/3, centerY-faceSize/4, eyeSize, featureColor)
-		drawCircle(img, centerX+faceSize/3, centerY-faceSize/4, eyeSize, featureColor)
-		drawArc(img, centerX, centerY+faceSize/3, faceSize/2, faceSize/4, featureColor)
+	if err := svc.Ready(); err != nil {
+		t.Errorf("Ready() error = %v, want nil", err)
 	}
 
-	return img
+	missing, err := NewService("testdata/missing.onnx", DefaultThresholds)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	if err := missing.Ready(); err == nil {
+		t.Error("Ready() error = nil, want error for missing model")
+	}
+	if _, err := missing.DetectFace(context.Background(), facetest.Blank(32, 32)); err == nil {
+		t.Error("DetectFace() error = nil, want error for missing model")
+	}
 }
 
-// Helper function to draw a circle
-func drawCircle(img *image.RGBA, centerX, centerY, radius int, c color.Color) {
-	for x := -radius; x <= radius; x++ {
-		for y := -radius; y <= radius; y++ {
-			if x*x+y*y <= radius*radius {
-				img.Set(centerX+x, centerY+y, c)
-			}
+func TestService_SetModelPath(t *testing.T) {
+	svc, err := NewService("testdata/missing.onnx", DefaultThresholds)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	for _, path := range []string{"testdata", "testdata/no_face.png"} {
+		if err := svc.SetModelPath(path); err == nil {
+			t.Errorf("SetModelPath(%q) error = nil, want error", path)
 		}
 	}
-}
+	if err := svc.Ready(); err == nil {
+		t.Error("Ready() error = nil, a rejected path must not be used")
+	}
 
-// Helper function to draw an arc (simple smile)
-func drawArc(img *image.RGBA, centerX, centerY, width, height int, c color.Color) {
-	for x := -width; x <= width; x++ {
-		y := height * x * x / (width * width)
-		img.Set(centerX+x, centerY+y, c)
+	if err := svc.SetModelPath("testdata/standin_yunet.onnx"); err != nil {
+		t.Fatalf("SetModelPath() error = %v, want nil", err)
+	}
+	if err := svc.Ready(); err != nil {
+		t.Errorf("Ready() error = %v, want nil after switching models", err)
 	}
 }
@@ -0,0 +1,88 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"slices"
+
+	"vws-backend/internal/onnx"
+)
+
+// SFace computes face embeddings with an SFace model, such as
+// face_recognition_sface_2021dec.onnx from the OpenCV model zoo. The model
+// takes faces aligned to 112 by 112 pixels and returns a vector of 128
+// values.
+type SFace struct {
+	model  *onnx.Model
+	input  string
+	output string
+}
+
+// LoadSFace loads the SFace model in the file at path
+func LoadSFace(path string) (*SFace, error) {
+	model, err := onnx.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := slices.DeleteFunc(slices.Clone(model.Inputs), func(in onnx.ValueInfo) bool {
+		_, weight := model.Initializers[in.Name]
+		return weight
+	})
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("%s: model takes %d inputs, want an image", path, len(inputs))
+	}
+	in := inputs[0]
+	if in.Type != onnx.Float || len(in.Shape) != 4 {
+		return nil, fmt.Errorf("%s: input %q of shape %v is not an image", path, in.Name, in.Shape)
+	}
+	for i, want := range []int{1, 3, alignedSize, alignedSize} {
+		if d := in.Shape[i]; d >= 0 && d != want {
+			return nil, fmt.Errorf("%s: input %q of shape %v doesn't take %dx%d faces", path, in.Name, in.Shape, alignedSize, alignedSize)
+		}
+	}
+	if len(model.Outputs) == 0 {
+		return nil, fmt.Errorf("%s: model has no outputs", path)
+	}
+	return &SFace{model: model, input: in.Name, output: model.Outputs[0].Name}, nil
+}
+
+// Embed computes the embedding of face, see Recognizer
+func (s *SFace) Embed(ctx context.Context, img image.Image, face Face) ([]float32, error) {
+	if img == nil {
+		return nil, errors.New("input image is nil")
+	}
+	if len(face.Landmarks) != len(alignTemplate) {
+		return nil, fmt.Errorf("face has %d landmarks, want %d", len(face.Landmarks), len(alignTemplate))
+	}
+
+	// Red, green and blue planes of the aligned face
+	aligned := align(img, face.Landmarks)
+	const plane = alignedSize * alignedSize
+	data := make([]float32, 3*plane)
+	for i := range plane {
+		data[i] = float32(aligned.Pix[4*i])
+		data[plane+i] = float32(aligned.Pix[4*i+1])
+		data[2*plane+i] = float32(aligned.Pix[4*i+2])
+	}
+	input := onnx.NewFloat([]int{1, 3, alignedSize, alignedSize}, data)
+
+	outputs, err := s.model.Run(ctx, map[string]*onnx.Tensor{s.input: input})
+	if err != nil {
+		return nil, fmt.Errorf("run model: %w", err)
+	}
+	out := outputs[s.output]
+	if out == nil || out.Type != onnx.Float || out.Len() == 0 {
+		return nil, fmt.Errorf("output %s is not an embedding", s.output)
+	}
+	embedding := slices.Clone(out.Float)
+	normalize(embedding)
+	return embedding, nil
+}
+
+// Close releases the model
+func (s *SFace) Close() error {
+	return nil
+}
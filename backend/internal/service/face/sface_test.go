@@ -0,0 +1,52 @@
+package face
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSFace_RealModel(t *testing.T) {
+	detector, err := LoadYuNet(realModel(t, "yunet.onnx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recognizer, err := LoadSFace(realModel(t, "sface.onnx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// embed returns the embeddings of the faces on a photo
+	embed := func(name string) [][]float32 {
+		t.Helper()
+
+		img := loadPhoto(t, name)
+		faces, err := detector.Detect(ctx, img, DefaultThresholds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(faces) == 0 {
+			t.Fatalf("no face found in %s", name)
+		}
+		vectors := make([][]float32, len(faces))
+		for i, face := range faces {
+			if vectors[i], err = recognizer.Embed(ctx, img, face); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return vectors
+	}
+
+	person := embed("face.jpg")[0]
+	if s := Similarity(person, embed("face_again.jpg")[0]); s < DefaultMatchThreshold {
+		t.Errorf("the same person on another photo is %v similar, want at least %v", s, DefaultMatchThreshold)
+	}
+	if s := Similarity(person, embed("other.jpg")[0]); s >= DefaultMatchThreshold {
+		t.Errorf("someone else is %v similar, want less than %v", s, DefaultMatchThreshold)
+	}
+	for i, other := range embed("group.jpg") {
+		if s := Similarity(person, other); s >= DefaultMatchThreshold {
+			t.Errorf("face %d of group.jpg is %v similar, want less than %v", i, s, DefaultMatchThreshold)
+		}
+	}
+}
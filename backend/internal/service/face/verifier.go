@@ -0,0 +1,287 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"time"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/metrics"
+	"vws-backend/internal/tracing"
+)
+
+var (
+	ErrNoFace          = apperr.New(apperr.ErrUnprocessable, "no_face", "no face found in the image")
+	ErrMultipleFaces   = apperr.New(apperr.ErrUnprocessable, "multiple_faces", "more than one face found in the image")
+	ErrNotEnrolled     = apperr.New(apperr.ErrNotFound, "face_not_enrolled", "no face enrolled")
+	ErrAlreadyEnrolled = apperr.New(apperr.ErrConflict, "face_already_enrolled", "a face is already enrolled")
+	ErrStaleEnrollment = apperr.New(apperr.ErrConflict, "face_enrollment_stale",
+		"the enrolled face was computed by another model, enroll again")
+	ErrNotLive = apperr.New(apperr.ErrUnprocessable, "face_not_live",
+		"the face looks like a photo rather than a person in front of the camera")
+)
+
+// Embedding is the reference face enrolled for a user. Its vector is never
+// sent to clients.
+type Embedding struct {
+	UserID    int64     `json:"userId"`
+	Vector    []float32 `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Verification is the outcome of matching a face against the enrolled one
+type Verification struct {
+	Similarity float32   `json:"similarity"` // Cosine similarity of the embeddings, between -1 and 1
+	Threshold  float32   `json:"threshold"`
+	Match      bool      `json:"match"` // Whether Similarity reaches Threshold
+	Liveness   *Liveness `json:"liveness"`
+}
+
+// Verifier enrolls a reference face per user and matches new captures
+// against it: it detects the face, aligns it on its landmarks and compares
+// the embeddings a recognition model computes. It can require faces to be
+// live, as the detector checks, to enroll and verify them. Each face
+// enrolled is compared with an index of the enrolled faces, and those of
+// other users it matches are flagged as duplicates.
+type Verifier struct {
+	detector *Service
+	repo     Repository
+
+	mu                 sync.RWMutex
+	recognizer         Recognizer // Nil while no model is loaded
+	loadErr            error      // Why the model isn't loaded
+	threshold          float32
+	requireLiveness    bool
+	indexErr           error // Why the index isn't loaded
+	duplicateThreshold float32
+
+	index    *Index     // Locks itself
+	enrollMu sync.Mutex // Held while a face is stored and indexed
+}
+
+// NewVerifier creates a verifier finding faces with detector and
+// embedding them with the SFace model at modelPath. Like NewService, it
+// doesn't fail on a model that can't be loaded.
+func NewVerifier(detector *Service, repo Repository, modelPath string, threshold float32) (*Verifier, error) {
+	if modelPath == "" {
+		return nil, errors.New("model path cannot be empty")
+	}
+
+	v := &Verifier{
+		detector:           detector,
+		repo:               repo,
+		threshold:          threshold,
+		indexErr:           errors.New("face index not loaded"),
+		duplicateThreshold: DefaultDuplicateThreshold,
+		index:              NewIndex(),
+	}
+	v.recognizer, v.loadErr = loadRecognizer(modelPath)
+	return v, nil
+}
+
+func loadRecognizer(path string) (Recognizer, error) {
+	recognizer, err := LoadSFace(path)
+	if err != nil {
+		return nil, err
+	}
+	return recognizer, nil
+}
+
+// Enroll stores the face in img as the user's reference face and flags
+// the faces of other users it matches as duplicates
+func (v *Verifier) Enroll(ctx context.Context, userID int64, img image.Image) (_ *Embedding, err error) {
+	ctx, span := tracing.Start(ctx, "face.Enroll")
+	defer tracing.End(span, &err)
+
+	vector, _, err := v.embed(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	e := &Embedding{UserID: userID, Vector: vector, CreatedAt: now, UpdatedAt: now}
+	err = v.store(ctx, e, func(repo Repository) error {
+		return repo.CreateEmbedding(ctx, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reenroll replaces the user's reference face with the face in img, and
+// flags duplicates like Enroll
+func (v *Verifier) Reenroll(ctx context.Context, userID int64, img image.Image) (_ *Embedding, err error) {
+	ctx, span := tracing.Start(ctx, "face.Reenroll")
+	defer tracing.End(span, &err)
+
+	vector, _, err := v.embed(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+	e := &Embedding{UserID: userID, Vector: vector, UpdatedAt: time.Now()}
+	err = v.store(ctx, e, func(repo Repository) error {
+		return repo.UpdateEmbedding(ctx, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Enrollment returns the user's reference face
+func (v *Verifier) Enrollment(ctx context.Context, userID int64) (*Embedding, error) {
+	return v.repo.GetEmbedding(ctx, userID)
+}
+
+// Unenroll deletes the user's reference face
+func (v *Verifier) Unenroll(ctx context.Context, userID int64) error {
+	v.enrollMu.Lock()
+	defer v.enrollMu.Unlock()
+
+	if err := v.repo.DeleteEmbedding(ctx, userID); err != nil {
+		return err
+	}
+	v.index.Remove(userID)
+	metrics.FaceIndexed.Set(float64(v.index.Len()))
+	return nil
+}
+
+// Verify matches the face in img against the user's reference face
+func (v *Verifier) Verify(ctx context.Context, userID int64, img image.Image) (_ *Verification, err error) {
+	ctx, span := tracing.Start(ctx, "face.Verify")
+	defer tracing.End(span, &err)
+
+	result, err := v.verify(ctx, userID, img)
+	switch {
+	case err != nil:
+		metrics.FaceVerifications.WithLabelValues(metrics.FaceError).Inc()
+	case result.Match:
+		metrics.FaceVerifications.WithLabelValues(metrics.FaceMatch).Inc()
+	default:
+		metrics.FaceVerifications.WithLabelValues(metrics.FaceMismatch).Inc()
+	}
+	return result, err
+}
+
+func (v *Verifier) verify(ctx context.Context, userID int64, img image.Image) (*Verification, error) {
+	enrolled, err := v.repo.GetEmbedding(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	vector, liveness, err := v.embed(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+	if len(vector) != len(enrolled.Vector) {
+		return nil, ErrStaleEnrollment
+	}
+
+	v.mu.RLock()
+	threshold := v.threshold
+	v.mu.RUnlock()
+	similarity := Similarity(vector, enrolled.Vector)
+	return &Verification{
+		Similarity: similarity,
+		Threshold:  threshold,
+		Match:      similarity >= threshold,
+		Liveness:   liveness,
+	}, nil
+}
+
+// embed returns the embedding of the one face in img and its liveness,
+// which must be live if required
+func (v *Verifier) embed(ctx context.Context, img image.Image) ([]float32, *Liveness, error) {
+	detection, err := v.detector.DetectFace(ctx, img)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch len(detection.Faces) {
+	case 0:
+		return nil, nil, ErrNoFace
+	case 1:
+	default:
+		return nil, nil, ErrMultipleFaces
+	}
+	face := detection.Faces[0]
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.requireLiveness && !face.Liveness.Live {
+		if len(face.Liveness.Reasons) == 0 {
+			return nil, nil, ErrNotLive
+		}
+		return nil, nil, ErrNotLive.WithDetails(map[string]string{"image": strings.Join(face.Liveness.Reasons, ", ")})
+	}
+	if v.recognizer == nil {
+		return nil, nil, fmt.Errorf("face recognition model not loaded: %w", v.loadErr)
+	}
+	vector, err := v.recognizer.Embed(ctx, img, face)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vector, face.Liveness, nil
+}
+
+// Ready reports whether the recognition model is loaded
+func (v *Verifier) Ready() error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.recognizer == nil {
+		return fmt.Errorf("face recognition model not loaded: %w", v.loadErr)
+	}
+	return nil
+}
+
+// SetModelPath switches to the recognition model at path, which must
+// load. Faces enrolled with another model don't compare with its
+// embeddings, so their users have to enroll again.
+func (v *Verifier) SetModelPath(path string) error {
+	recognizer, err := loadRecognizer(path)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	previous := v.recognizer
+	v.recognizer, v.loadErr = recognizer, nil
+	v.mu.Unlock()
+
+	if previous != nil {
+		return previous.Close()
+	}
+	return nil
+}
+
+// SetThreshold changes the similarity faces must reach to match
+func (v *Verifier) SetThreshold(threshold float32) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.threshold = threshold
+}
+
+// SetRequireLiveness changes whether faces must be live to enroll and
+// verify
+func (v *Verifier) SetRequireLiveness(require bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.requireLiveness = require
+}
+
+// Close releases the recognition model
+func (v *Verifier) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.recognizer == nil {
+		return nil
+	}
+	err := v.recognizer.Close()
+	v.recognizer, v.loadErr = nil, errors.New("verifier closed")
+	return err
+}
@@ -0,0 +1,522 @@
+package face
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"image"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/service/face/facetest"
+)
+
+// memoryRepo keeps embeddings, duplicates and challenges in maps.
+// Flagging duplicates fails with failFlag when set.
+type memoryRepo struct {
+	mu         sync.Mutex
+	embeddings map[int64]Embedding
+	duplicates map[int64]Duplicate
+	challenges map[int64]IssuedChallenge
+	failFlag   error
+}
+
+// WithTx runs fn on r, restoring the maps unless it returns nil
+func (r *memoryRepo) WithTx(ctx context.Context, fn func(Repository) error) error {
+	r.mu.Lock()
+	embeddings, duplicates := maps.Clone(r.embeddings), maps.Clone(r.duplicates)
+	r.mu.Unlock()
+
+	err := fn(r)
+	if err != nil {
+		r.mu.Lock()
+		r.embeddings, r.duplicates = embeddings, duplicates
+		r.mu.Unlock()
+	}
+	return err
+}
+
+func (r *memoryRepo) CreateEmbedding(ctx context.Context, e *Embedding) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.embeddings[e.UserID]; ok {
+		return ErrAlreadyEnrolled
+	}
+	r.embeddings[e.UserID] = *e
+	return nil
+}
+
+func (r *memoryRepo) UpdateEmbedding(ctx context.Context, e *Embedding) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.embeddings[e.UserID]
+	if !ok {
+		return ErrNotEnrolled
+	}
+	e.CreatedAt = stored.CreatedAt
+	r.embeddings[e.UserID] = *e
+	return nil
+}
+
+func (r *memoryRepo) GetEmbedding(ctx context.Context, userID int64) (*Embedding, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.embeddings[userID]
+	if !ok {
+		return nil, ErrNotEnrolled
+	}
+	return &stored, nil
+}
+
+func (r *memoryRepo) DeleteEmbedding(ctx context.Context, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.embeddings[userID]; !ok {
+		return ErrNotEnrolled
+	}
+	delete(r.embeddings, userID)
+	return nil
+}
+
+func (r *memoryRepo) ListEmbeddings(ctx context.Context, afterUserID int64, limit int) ([]Embedding, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var embeddings []Embedding
+	for _, e := range r.embeddings {
+		if e.UserID > afterUserID {
+			embeddings = append(embeddings, e)
+		}
+	}
+	slices.SortFunc(embeddings, func(a, b Embedding) int { return cmp.Compare(a.UserID, b.UserID) })
+	return embeddings[:min(limit, len(embeddings))], nil
+}
+
+func (r *memoryRepo) CreateDuplicate(ctx context.Context, d *Duplicate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failFlag != nil {
+		return r.failFlag
+	}
+	for _, stored := range r.duplicates {
+		if min(stored.UserID, stored.MatchedUserID) == min(d.UserID, d.MatchedUserID) &&
+			max(stored.UserID, stored.MatchedUserID) == max(d.UserID, d.MatchedUserID) {
+			return ErrDuplicateFlagged
+		}
+	}
+	d.ID = int64(len(r.duplicates) + 1)
+	r.duplicates[d.ID] = *d
+	return nil
+}
+
+func (r *memoryRepo) ListDuplicates(ctx context.Context, status string, limit, offset int) ([]*Duplicate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var duplicates []*Duplicate
+	for id := int64(1); id <= int64(len(r.duplicates)); id++ {
+		if d := r.duplicates[id]; status == "" || d.Status == status {
+			duplicates = append(duplicates, &d)
+		}
+	}
+	duplicates = duplicates[min(offset, len(duplicates)):]
+	return duplicates[:min(limit, len(duplicates))], nil
+}
+
+func (r *memoryRepo) ReviewDuplicate(ctx context.Context, d *Duplicate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.duplicates[d.ID]
+	if !ok {
+		return ErrDuplicateNotFound
+	}
+	stored.Status, stored.ReviewedBy, stored.ReviewedAt = d.Status, d.ReviewedBy, d.ReviewedAt
+	r.duplicates[d.ID] = stored
+	*d = stored
+	return nil
+}
+
+func (r *memoryRepo) IsConfirmedDuplicate(ctx context.Context, userID int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.duplicates {
+		if d.UserID == userID && d.Status == DuplicateConfirmed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRepo) SaveChallenge(ctx context.Context, c *IssuedChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.challenges[c.UserID] = *c
+	return nil
+}
+
+func (r *memoryRepo) TakeChallenge(ctx context.Context, userID int64, id string, now time.Time) (*IssuedChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.challenges[userID]
+	if !ok || stored.ID != id {
+		return nil, ErrChallengeNotFound
+	}
+	delete(r.challenges, userID)
+	if !now.Before(stored.ExpiresAt) {
+		return nil, ErrChallengeNotFound
+	}
+	return &stored, nil
+}
+
+func newMemoryRepo() *memoryRepo {
+	return &memoryRepo{
+		embeddings: make(map[int64]Embedding),
+		duplicates: make(map[int64]Duplicate),
+		challenges: make(map[int64]IssuedChallenge),
+	}
+}
+
+func newTestVerifier(t *testing.T) (*Verifier, *memoryRepo) {
+	t.Helper()
+
+	detector, err := NewService("testdata/standin_yunet.onnx", DefaultThresholds)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	repo := newMemoryRepo()
+	v, err := NewVerifier(detector, repo, "testdata/standin_sface.onnx", DefaultMatchThreshold)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	return v, repo
+}
+
+func TestVerifier(t *testing.T) {
+	ctx := context.Background()
+	v, repo := newTestVerifier(t)
+	const alice = 1
+
+	if _, err := v.Verify(ctx, alice, loadImage(t, "same_person.jpg")); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("Verify() before enrolling error = %v, want %v", err, ErrNotEnrolled)
+	}
+
+	enrolled, err := v.Enroll(ctx, alice, loadImage(t, "one_face.jpg"))
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if enrolled.UserID != alice || len(enrolled.Vector) != 128 || enrolled.CreatedAt.IsZero() {
+		t.Errorf("Enroll() = %+v", enrolled)
+	}
+	if _, err := v.Enroll(ctx, alice, loadImage(t, "one_face.jpg")); !errors.Is(err, ErrAlreadyEnrolled) {
+		t.Errorf("Enroll() again error = %v, want %v", err, ErrAlreadyEnrolled)
+	}
+
+	tests := []struct {
+		name    string
+		image   string
+		match   bool
+		wantErr error
+	}{
+		{name: "Same person", image: "same_person.jpg", match: true},
+		{name: "Other person", image: "other_person.jpg", match: false},
+		{name: "No face", image: "no_face.png", wantErr: ErrNoFace},
+		{name: "Several faces", image: "three_faces.png", wantErr: ErrMultipleFaces},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := v.Verify(ctx, alice, loadImage(t, tt.image))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if result.Match != tt.match || result.Threshold != DefaultMatchThreshold {
+				t.Errorf("Verify() = %+v, want match %v", result, tt.match)
+			}
+			if result.Match != (result.Similarity >= result.Threshold) {
+				t.Errorf("Verify() = %+v, match doesn't follow the threshold", result)
+			}
+		})
+	}
+
+	// A stricter threshold than any similarity
+	v.SetThreshold(1.01)
+	if result, err := v.Verify(ctx, alice, loadImage(t, "same_person.jpg")); err != nil || result.Match {
+		t.Errorf("Verify() = %+v, %v, want no match above the threshold", result, err)
+	}
+	v.SetThreshold(DefaultMatchThreshold)
+
+	reenrolled, err := v.Reenroll(ctx, alice, loadImage(t, "other_person.jpg"))
+	if err != nil {
+		t.Fatalf("Reenroll() error = %v", err)
+	}
+	if !reenrolled.CreatedAt.Equal(enrolled.CreatedAt) {
+		t.Errorf("Reenroll() created at %v, want %v", reenrolled.CreatedAt, enrolled.CreatedAt)
+	}
+	if result, err := v.Verify(ctx, alice, loadImage(t, "other_person.jpg")); err != nil || !result.Match {
+		t.Errorf("Verify() after reenrolling = %+v, %v, want a match", result, err)
+	}
+	if _, err := v.Reenroll(ctx, 2, loadImage(t, "one_face.jpg")); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("Reenroll() without enrolling error = %v, want %v", err, ErrNotEnrolled)
+	}
+
+	// An embedding computed by another model
+	stale := repo.embeddings[alice]
+	stale.Vector = slices.Repeat([]float32{0.5}, 4)
+	repo.embeddings[alice] = stale
+	if _, err := v.Verify(ctx, alice, loadImage(t, "one_face.jpg")); !errors.Is(err, ErrStaleEnrollment) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrStaleEnrollment)
+	}
+
+	if err := v.Unenroll(ctx, alice); err != nil {
+		t.Fatalf("Unenroll() error = %v", err)
+	}
+	if _, err := v.Enrollment(ctx, alice); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("Enrollment() after unenrolling error = %v, want %v", err, ErrNotEnrolled)
+	}
+}
+
+func TestVerifier_People(t *testing.T) {
+	ctx := context.Background()
+	v, _ := newTestVerifier(t)
+
+	// Every person matches themselves wherever they are, and nobody else
+	for person := range facetest.People {
+		img := facetest.Blank(320, 240)
+		facetest.DrawPerson(img, image.Pt(100, 100), 1, person)
+		if _, err := v.Enroll(ctx, int64(person), img); err != nil {
+			t.Fatalf("Enroll() error = %v", err)
+		}
+	}
+	for person := range facetest.People {
+		img := facetest.Blank(400, 300)
+		facetest.DrawPerson(img, image.Pt(292, 188), 1, person)
+		for enrolled := range facetest.People {
+			result, err := v.Verify(ctx, int64(enrolled), img)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if result.Match != (person == enrolled) {
+				t.Errorf("person %d against %d: %+v", person, enrolled, result)
+			}
+		}
+	}
+}
+
+func TestVerifier_RequireLiveness(t *testing.T) {
+	ctx := context.Background()
+	v, _ := newTestVerifier(t)
+	live := loadImage(t, "one_face.jpg")
+	screen := facetest.Screen(live)
+
+	// Reported, not required
+	if _, err := v.Enroll(ctx, 1, screen); err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	result, err := v.Verify(ctx, 1, screen)
+	if err != nil || result.Liveness == nil || result.Liveness.Live {
+		t.Fatalf("Verify() = %+v, %v, want a match reported not live", result, err)
+	}
+
+	// Refused with the reasons, as details of the sentinel
+	v.SetRequireLiveness(true)
+	notLive := func(err error) bool {
+		var appErr *apperr.Error
+		return errors.As(err, &appErr) && appErr.Code == ErrNotLive.Code && appErr.Details["image"] == ReasonMoire
+	}
+	if _, err := v.Verify(ctx, 1, screen); !notLive(err) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrNotLive)
+	}
+	if _, err := v.Reenroll(ctx, 1, screen); !notLive(err) {
+		t.Errorf("Reenroll() error = %v, want %v", err, ErrNotLive)
+	}
+	if result, err := v.Verify(ctx, 1, live); err != nil || !result.Match || !result.Liveness.Live {
+		t.Errorf("Verify() = %+v, %v, want a live match", result, err)
+	}
+}
+
+func TestVerifier_SetModelPath(t *testing.T) {
+	detector, err := NewService("testdata/standin_yunet.onnx", DefaultThresholds)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	v, err := NewVerifier(detector, newMemoryRepo(), "testdata/missing.onnx", DefaultMatchThreshold)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	if err := v.Ready(); err == nil {
+		t.Error("Ready() error = nil, want error for missing model")
+	}
+	if _, err := v.Enroll(context.Background(), 1, loadImage(t, "one_face.jpg")); err == nil {
+		t.Error("Enroll() error = nil, want error for missing model")
+	}
+
+	if err := v.SetModelPath("testdata/no_face.png"); err == nil {
+		t.Error("SetModelPath() error = nil, want error for an image")
+	}
+	if err := v.SetModelPath("testdata/standin_sface.onnx"); err != nil {
+		t.Fatalf("SetModelPath() error = %v", err)
+	}
+	if err := v.Ready(); err != nil {
+		t.Errorf("Ready() error = %v, want nil after switching models", err)
+	}
+	if err := v.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestVerifier_Duplicates(t *testing.T) {
+	ctx := context.Background()
+	v, repo := newTestVerifier(t)
+	drawn := func(person int, at image.Point) image.Image {
+		img := facetest.Blank(400, 300)
+		facetest.DrawPerson(img, at, 1, person)
+		return img
+	}
+
+	if _, err := v.Enroll(ctx, 1, drawn(0, image.Pt(100, 100))); err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+
+	// Another server finds the face enrolled once it loads its index
+	v, err := NewVerifier(v.detector, repo, "testdata/standin_sface.onnx", DefaultMatchThreshold)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	if err := v.IndexReady(); err == nil {
+		t.Error("IndexReady() error = nil before loading")
+	}
+	if err := v.LoadIndex(ctx); err != nil {
+		t.Fatalf("LoadIndex() error = %v", err)
+	}
+	if err := v.IndexReady(); err != nil || v.index.Len() != 1 {
+		t.Fatalf("IndexReady() = %v with %d faces, want the enrolled face", err, v.index.Len())
+	}
+
+	// Everybody else looks different
+	for person := 1; person < len(facetest.People); person++ {
+		if _, err := v.Enroll(ctx, int64(person+1), drawn(person, image.Pt(100, 100))); err != nil {
+			t.Fatalf("Enroll() error = %v", err)
+		}
+	}
+	if len(repo.duplicates) != 0 {
+		t.Fatalf("duplicates of different people = %v, want none", repo.duplicates)
+	}
+
+	// The first person again, enrolled as another user elsewhere in the
+	// frame, and re-enrolled
+	if _, err := v.Enroll(ctx, 10, drawn(0, image.Pt(292, 188))); err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if _, err := v.Reenroll(ctx, 10, drawn(0, image.Pt(200, 150))); err != nil {
+		t.Fatalf("Reenroll() error = %v", err)
+	}
+	pending, err := v.Duplicates(ctx, DuplicatePending, 10, 0)
+	if err != nil {
+		t.Fatalf("Duplicates() error = %v", err)
+	}
+	if len(pending) != 1 || pending[0].UserID != 10 || pending[0].MatchedUserID != 1 ||
+		pending[0].Similarity < DefaultDuplicateThreshold {
+		t.Fatalf("Duplicates() = %+v, want user 10 flagged once against user 1", pending)
+	}
+
+	if _, err := v.ReviewDuplicate(ctx, pending[0].ID, DuplicatePending, 99); !errors.Is(err, ErrDuplicateStatus) {
+		t.Errorf("ReviewDuplicate() error = %v, want %v", err, ErrDuplicateStatus)
+	}
+	if _, err := v.ReviewDuplicate(ctx, 1000, DuplicateConfirmed, 99); !errors.Is(err, ErrDuplicateNotFound) {
+		t.Errorf("ReviewDuplicate() error = %v, want %v", err, ErrDuplicateNotFound)
+	}
+	confirmed, err := v.ReviewDuplicate(ctx, pending[0].ID, DuplicateConfirmed, 99)
+	if err != nil {
+		t.Fatalf("ReviewDuplicate() error = %v", err)
+	}
+	if confirmed.Status != DuplicateConfirmed || confirmed.ReviewedBy != 99 || confirmed.ReviewedAt == nil || confirmed.UserID != 10 {
+		t.Errorf("ReviewDuplicate() = %+v", confirmed)
+	}
+
+	// Unenrolled faces aren't matched any more
+	if err := v.Unenroll(ctx, 1); err != nil {
+		t.Fatalf("Unenroll() error = %v", err)
+	}
+	if err := v.Unenroll(ctx, 10); err != nil {
+		t.Fatalf("Unenroll() error = %v", err)
+	}
+	if _, err := v.Enroll(ctx, 11, drawn(0, image.Pt(100, 100))); err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if all, _ := v.Duplicates(ctx, "", 10, 0); len(all) != 1 {
+		t.Errorf("Duplicates() = %+v, want only the first", all)
+	}
+}
+
+func TestVerifier_DuplicatesAtomic(t *testing.T) {
+	ctx := context.Background()
+	v, repo := newTestVerifier(t)
+	drawn := func(at image.Point) image.Image {
+		img := facetest.Blank(400, 300)
+		facetest.DrawPerson(img, at, 1, 0)
+		return img
+	}
+	if err := v.LoadIndex(ctx); err != nil {
+		t.Fatalf("LoadIndex() error = %v", err)
+	}
+	if _, err := v.Enroll(ctx, 1, drawn(image.Pt(100, 100))); err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+
+	// A face whose duplicate can't be flagged is neither stored nor indexed
+	repo.failFlag = errors.New("database down")
+	if _, err := v.Enroll(ctx, 2, drawn(image.Pt(292, 188))); !errors.Is(err, repo.failFlag) {
+		t.Fatalf("Enroll() error = %v, want %v", err, repo.failFlag)
+	}
+	if _, err := v.Enrollment(ctx, 2); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("Enrollment() error = %v, want %v", err, ErrNotEnrolled)
+	}
+	if v.index.Len() != 1 {
+		t.Errorf("index holds %d faces, want 1", v.index.Len())
+	}
+
+	// so enrolling again flags it
+	repo.failFlag = nil
+	if _, err := v.Enroll(ctx, 2, drawn(image.Pt(292, 188))); err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if all, _ := v.Duplicates(ctx, "", 10, 0); len(all) != 1 || all[0].UserID != 2 || all[0].MatchedUserID != 1 {
+		t.Errorf("Duplicates() = %+v, want user 2 flagged against user 1", all)
+	}
+}
+
+func TestVerifier_DuplicatesConcurrent(t *testing.T) {
+	ctx := context.Background()
+	v, _ := newTestVerifier(t)
+	if err := v.LoadIndex(ctx); err != nil {
+		t.Fatalf("LoadIndex() error = %v", err)
+	}
+	img := facetest.Blank(400, 300)
+	facetest.DrawPerson(img, image.Pt(200, 150), 1, 0)
+
+	// Of the same face enrolled by users at once, each finds those before
+	const users = 4
+	var wg sync.WaitGroup
+	for user := range int64(users) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Enroll(ctx, user+1, img); err != nil {
+				t.Errorf("Enroll() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	all, err := v.Duplicates(ctx, "", 10, 0)
+	if err != nil {
+		t.Fatalf("Duplicates() error = %v", err)
+	}
+	if len(all) != users*(users-1)/2 {
+		t.Errorf("Duplicates() = %+v, want every pair flagged once", all)
+	}
+}
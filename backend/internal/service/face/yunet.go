@@ -0,0 +1,269 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	"vws-backend/internal/onnx"
+)
+
+// YuNet detects faces with a YuNet model, such as
+// face_detection_yunet_2023mar.onnx from the OpenCV model zoo. The model
+// proposes a face for every cell of grids of 8, 16 and 32 pixels: how
+// likely the cell holds a face, as cls and obj scores, and where, as a box
+// and five landmarks relative to the cell.
+type YuNet struct {
+	model         *onnx.Model
+	input         string
+	width, height int // Input size fixed by the model, 0 if it takes any
+}
+
+// Strides of the grids YuNet proposes faces on
+var yunetStrides = []int{8, 16, 32}
+
+// Longest side images are scaled down to for models taking any input size
+const maxInputSide = 640
+
+// LoadYuNet loads the YuNet model in the file at path
+func LoadYuNet(path string) (*YuNet, error) {
+	model, err := onnx.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := slices.DeleteFunc(slices.Clone(model.Inputs), func(in onnx.ValueInfo) bool {
+		_, weight := model.Initializers[in.Name]
+		return weight
+	})
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("%s: model takes %d inputs, want an image", path, len(inputs))
+	}
+	in := inputs[0]
+	if in.Type != onnx.Float || len(in.Shape) != 4 || in.Shape[1] != 3 && in.Shape[1] >= 0 {
+		return nil, fmt.Errorf("%s: input %q of shape %v is not an image", path, in.Name, in.Shape)
+	}
+	y := &YuNet{model: model, input: in.Name}
+	if height, width := in.Shape[2], in.Shape[3]; height > 0 && width > 0 {
+		if height%32 != 0 || width%32 != 0 {
+			return nil, fmt.Errorf("%s: input size %dx%d is not a multiple of 32", path, width, height)
+		}
+		y.width, y.height = width, height
+	}
+
+	outputs := make(map[string]bool, len(model.Outputs))
+	for _, out := range model.Outputs {
+		outputs[out.Name] = true
+	}
+	for _, stride := range yunetStrides {
+		for _, name := range yunetOutputs(stride) {
+			if !outputs[name] {
+				return nil, fmt.Errorf("%s: not a YuNet model, output %s is missing", path, name)
+			}
+		}
+	}
+	return y, nil
+}
+
+// yunetOutputs returns the names of the cls, obj, bbox and kps outputs for
+// the grid of stride
+func yunetOutputs(stride int) [4]string {
+	return [4]string{
+		fmt.Sprintf("cls_%d", stride),
+		fmt.Sprintf("obj_%d", stride),
+		fmt.Sprintf("bbox_%d", stride),
+		fmt.Sprintf("kps_%d", stride),
+	}
+}
+
+// Detect finds the faces in img, see Detector
+func (y *YuNet) Detect(ctx context.Context, img image.Image, thresholds Thresholds) ([]Face, error) {
+	if img == nil {
+		return nil, errors.New("input image is nil")
+	}
+	if img.Bounds().Empty() {
+		return []Face{}, nil
+	}
+	input, scale := y.preprocess(img)
+	outputs, err := y.model.Run(ctx, map[string]*onnx.Tensor{y.input: input})
+	if err != nil {
+		return nil, fmt.Errorf("run model: %w", err)
+	}
+	candidates, err := decode(outputs, input.Shape[3], input.Shape[2], thresholds.Score)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := img.Bounds().Min
+	at := func(x, y float32) image.Point {
+		return image.Pt(origin.X+int(math.Round(float64(x)/scale)), origin.Y+int(math.Round(float64(y)/scale)))
+	}
+	kept := nms(candidates, thresholds.IoU)
+	faces := make([]Face, 0, len(kept))
+	for _, c := range kept {
+		face := Face{
+			Box:       image.Rectangle{Min: at(c.x1, c.y1), Max: at(c.x2, c.y2)},
+			Score:     c.score,
+			Landmarks: make([]image.Point, len(c.landmarks)),
+		}
+		for i, l := range c.landmarks {
+			face.Landmarks[i] = at(l[0], l[1])
+		}
+		faces = append(faces, face)
+	}
+	return faces, nil
+}
+
+// Close releases the model
+func (y *YuNet) Close() error {
+	return nil
+}
+
+// preprocess scales img to the input size of the model, keeping its aspect
+// ratio and padding it right and below, and returns it as a tensor of its
+// blue, green and red planes along with the scale applied
+func (y *YuNet) preprocess(img image.Image) (*onnx.Tensor, float64) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	width, height := y.width, y.height
+	var scale float64
+	if width > 0 {
+		scale = min(float64(width)/float64(w), float64(height)/float64(h))
+	} else {
+		scale = min(1, maxInputSide/float64(max(w, h)))
+		width = max(ceilTo(int(math.Ceil(float64(w)*scale)), 32), 32)
+		height = max(ceilTo(int(math.Ceil(float64(h)*scale)), 32), 32)
+	}
+	scaledW := min(max(int(math.Round(float64(w)*scale)), 1), width)
+	scaledH := min(max(int(math.Round(float64(h)*scale)), 1), height)
+
+	plane := width * height
+	data := make([]float32, 3*plane)
+	px := pixels(img)
+	for dy := range scaledH {
+		for dx := range scaledW {
+			r, g, b := resample(px, bounds, dx, dy, scale)
+			i := dy*width + dx
+			data[i], data[plane+i], data[2*plane+i] = b, g, r
+		}
+	}
+	return onnx.NewFloat([]int{1, 3, height, width}, data), scale
+}
+
+func ceilTo(n, multiple int) int {
+	return (n + multiple - 1) / multiple * multiple
+}
+
+// pixels returns a function reading the 8-bit RGB color at a point of img,
+// avoiding the color.Color interface for the common image types
+func pixels(img image.Image) func(x, y int) (r, g, b float32) {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return func(x, y int) (float32, float32, float32) {
+			i := img.PixOffset(x, y)
+			return float32(img.Pix[i]), float32(img.Pix[i+1]), float32(img.Pix[i+2])
+		}
+	case *image.YCbCr:
+		return func(x, y int) (float32, float32, float32) {
+			c := img.YCbCrAt(x, y)
+			r, g, b := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+			return float32(r), float32(g), float32(b)
+		}
+	}
+	return func(x, y int) (float32, float32, float32) {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return float32(r >> 8), float32(g >> 8), float32(b >> 8)
+	}
+}
+
+// resample returns the color of the scaled image at dx, dy. Shrinking
+// averages the pixels it covers; enlarging interpolates between the
+// nearest four.
+func resample(px func(x, y int) (float32, float32, float32), bounds image.Rectangle, dx, dy int, scale float64) (r, g, b float32) {
+	if scale < 1 {
+		x0, x1 := span(dx, scale, bounds.Min.X, bounds.Max.X)
+		y0, y1 := span(dy, scale, bounds.Min.Y, bounds.Max.Y)
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				pr, pg, pb := px(x, y)
+				r, g, b = r+pr, g+pg, b+pb
+			}
+		}
+		n := float32((x1 - x0) * (y1 - y0))
+		return r / n, g / n, b / n
+	}
+
+	x0, x1, fx := between(dx, scale, bounds.Min.X, bounds.Max.X)
+	y0, y1, fy := between(dy, scale, bounds.Min.Y, bounds.Max.Y)
+	r00, g00, b00 := px(x0, y0)
+	r10, g10, b10 := px(x1, y0)
+	r01, g01, b01 := px(x0, y1)
+	r11, g11, b11 := px(x1, y1)
+	mix := func(v00, v10, v01, v11 float32) float32 {
+		return (v00*(1-fx)+v10*fx)*(1-fy) + (v01*(1-fx)+v11*fx)*fy
+	}
+	return mix(r00, r10, r01, r11), mix(g00, g10, g01, g11), mix(b00, b10, b01, b11)
+}
+
+// span returns the source pixels a shrunk pixel covers, at least one
+func span(d int, scale float64, lo, hi int) (int, int) {
+	start := lo + int(float64(d)/scale)
+	end := lo + int(math.Ceil(float64(d+1)/scale))
+	start = min(start, hi-1)
+	return start, min(max(end, start+1), hi)
+}
+
+// between returns the source pixels an enlarged pixel lies between, and
+// how far it is from the first
+func between(d int, scale float64, lo, hi int) (int, int, float32) {
+	s := min(max((float64(d)+0.5)/scale-0.5, 0), float64(hi-lo-1))
+	first := int(s)
+	return lo + first, lo + min(first+1, hi-lo-1), float32(s - float64(first))
+}
+
+// decode turns the outputs of the model for an input of width by height
+// into the candidates scored at least threshold, in input coordinates
+func decode(outputs map[string]*onnx.Tensor, width, height int, threshold float32) ([]candidate, error) {
+	var candidates []candidate
+	for _, stride := range yunetStrides {
+		cols, rows := width/stride, height/stride
+		names := yunetOutputs(stride)
+		var heads [4][]float32
+		for i, per := range []int{1, 1, 4, 10} {
+			out := outputs[names[i]]
+			if out == nil || out.Type != onnx.Float || out.Len() != rows*cols*per {
+				return nil, fmt.Errorf("output %s doesn't hold %d values for each of %dx%d cells", names[i], per, cols, rows)
+			}
+			heads[i] = out.Float
+		}
+		cls, obj, bbox, kps := heads[0], heads[1], heads[2], heads[3]
+
+		s := float32(stride)
+		for row := range rows {
+			for col := range cols {
+				i := row*cols + col
+				score := float32(math.Sqrt(float64(clamp01(cls[i]) * clamp01(obj[i]))))
+				if !(score >= threshold) { // Also skips NaN
+					continue
+				}
+				cx, cy := (float32(col)+bbox[4*i])*s, (float32(row)+bbox[4*i+1])*s
+				w := float32(math.Exp(float64(bbox[4*i+2]))) * s
+				h := float32(math.Exp(float64(bbox[4*i+3]))) * s
+				c := candidate{x1: cx - w/2, y1: cy - h/2, x2: cx + w/2, y2: cy + h/2, score: score}
+				for k := range c.landmarks {
+					c.landmarks[k] = [2]float32{(kps[10*i+2*k] + float32(col)) * s, (kps[10*i+2*k+1] + float32(row)) * s}
+				}
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	return candidates, nil
+}
+
+func clamp01(v float32) float32 {
+	return min(max(v, 0), 1)
+}
@@ -0,0 +1,237 @@
+package face
+
+import (
+	"context"
+	"image"
+	_ "image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vws-backend/internal/onnx"
+	"vws-backend/internal/service/face/facetest"
+)
+
+// writeModel writes m to a temporary file and returns its path
+func writeModel(t *testing.T, m *onnx.Model) string {
+	t.Helper()
+
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "model.onnx")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestYuNet_Scaling(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int // Of the model input, 0 for any
+		img           image.Rectangle
+		scale         float64 // Of the faces drawn, shrunk or enlarged to facetest.FaceSize
+		centers       []image.Point
+	}{
+		{
+			name:    "Shrunk to fixed input",
+			width:   320,
+			height:  320,
+			img:     image.Rect(0, 0, 640, 480),
+			scale:   2,
+			centers: []image.Point{{168, 200}, {488, 264}},
+		},
+		{
+			name:    "Enlarged to fixed input",
+			width:   320,
+			height:  256,
+			img:     image.Rect(0, 0, 160, 120),
+			scale:   0.5,
+			centers: []image.Point{{42, 62}, {118, 38}},
+		},
+		{
+			name:    "Shrunk to the longest side of any input",
+			img:     image.Rect(0, 0, 1280, 640),
+			scale:   2,
+			centers: []image.Point{{328, 328}},
+		},
+		{
+			name:    "Offset bounds",
+			img:     image.Rect(100, 50, 420, 290),
+			scale:   1,
+			centers: []image.Point{{264, 166}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			y, err := LoadYuNet(writeModel(t, facetest.Model(tt.width, tt.height)))
+			if err != nil {
+				t.Fatalf("LoadYuNet() error = %v", err)
+			}
+
+			img := facetest.Blank(tt.img.Dx(), tt.img.Dy())
+			img.Rect = tt.img
+			for _, c := range tt.centers {
+				facetest.DrawFace(img, c, tt.scale)
+			}
+			faces, err := y.Detect(context.Background(), img, DefaultThresholds)
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			if len(faces) != len(tt.centers) {
+				t.Fatalf("Detect() got %d faces, want %d", len(faces), len(tt.centers))
+			}
+			for _, c := range tt.centers {
+				checkFace(t, findFace(faces, c), c, tt.scale)
+			}
+		})
+	}
+}
+
+func TestLoadYuNet_Rejects(t *testing.T) {
+	withoutOutput := facetest.Model(0, 0)
+	withoutOutput.Outputs = withoutOutput.Outputs[1:]
+	oddSize := facetest.Model(300, 300)
+	gray := facetest.Model(0, 0)
+	gray.Inputs[0].Shape = []int{1, 1, -1, -1}
+
+	for name, m := range map[string]*onnx.Model{
+		"missing output":  withoutOutput,
+		"odd input size":  oddSize,
+		"not color input": gray,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadYuNet(writeModel(t, m)); err == nil {
+				t.Error("LoadYuNet() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNMS(t *testing.T) {
+	box := func(x, score float32) candidate {
+		return candidate{x1: x, y1: 0, x2: x + 10, y2: 10, score: score}
+	}
+	kept := nms([]candidate{box(0, 0.8), box(1, 0.95), box(20, 0.9), box(5, 0.99)}, 0.3)
+
+	want := []float32{0.99, 0.9}
+	if len(kept) != len(want) {
+		t.Fatalf("nms() kept %d candidates, want %d", len(kept), len(want))
+	}
+	for i, score := range want {
+		if kept[i].score != score {
+			t.Errorf("candidate %d scored %v, want %v", i, kept[i].score, score)
+		}
+	}
+}
+
+// realModel returns the path of a real model in the directory named by
+// VWS_FACE_MODELS, skipping the test if it is unset
+func realModel(t *testing.T, name string) string {
+	t.Helper()
+
+	dir := os.Getenv("VWS_FACE_MODELS")
+	if dir == "" {
+		t.Skip("VWS_FACE_MODELS is unset, run make test-models")
+	}
+	return filepath.Join(dir, name)
+}
+
+// loadPhoto decodes a photo of testdata/photos, fetched by make test-models
+func loadPhoto(t *testing.T, name string) image.Image {
+	t.Helper()
+
+	if _, err := os.Stat("testdata/photos/" + name); err != nil {
+		t.Fatalf("%v, run make test-models", err)
+	}
+	return loadImage(t, "photos/"+name)
+}
+
+// near reports whether p is within tolerance pixels of want
+func near(p, want image.Point, tolerance int) bool {
+	d := p.Sub(want)
+	return d.X*d.X+d.Y*d.Y <= tolerance*tolerance
+}
+
+func TestYuNet_RealModel(t *testing.T) {
+	y, err := LoadYuNet(realModel(t, "yunet.onnx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	faces, err := y.Detect(ctx, loadPhoto(t, "face.jpg"), DefaultThresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 1 {
+		t.Fatalf("Detect() found %d faces in face.jpg, want 1", len(faces))
+	}
+	face := faces[0]
+	if c := face.Box.Min.Add(face.Box.Max).Div(2); !near(c, image.Pt(355, 275), 40) {
+		t.Errorf("face centered at %v, want near (355, 275)", c)
+	}
+	if w := face.Box.Dx(); w < 130 || w > 260 {
+		t.Errorf("face %d pixels wide, want about 190", w)
+	}
+
+	// The landmarks of the person facing the camera, their right eye on
+	// the left of the photo
+	for i, want := range []struct {
+		name string
+		at   image.Point
+	}{
+		{"right eye", image.Pt(312, 248)},
+		{"left eye", image.Pt(405, 245)},
+		{"nose tip", image.Pt(352, 288)},
+		{"right mouth corner", image.Pt(322, 325)},
+		{"left mouth corner", image.Pt(392, 322)},
+	} {
+		if !near(face.Landmarks[i], want.at, 30) {
+			t.Errorf("%s at %v, want near %v", want.name, face.Landmarks[i], want.at)
+		}
+		if !face.Landmarks[i].In(face.Box) {
+			t.Errorf("%s at %v is outside the face %v", want.name, face.Landmarks[i], face.Box)
+		}
+	}
+	l := face.Landmarks
+	if !(l[0].X < l[2].X && l[2].X < l[1].X && l[3].X < l[4].X) {
+		t.Errorf("landmarks %v are not ordered right to left as seen by the person", l)
+	}
+	if !(l[2].Y > max(l[0].Y, l[1].Y) && min(l[3].Y, l[4].Y) > l[2].Y) {
+		t.Errorf("landmarks %v are not eyes above the nose above the mouth", l)
+	}
+
+	// Six people, each proposed many times over before suppression
+	group := loadPhoto(t, "group.jpg")
+	all, err := y.Detect(ctx, group, Thresholds{Score: DefaultThresholds.Score, IoU: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	faces, err = y.Detect(ctx, group, DefaultThresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 6 {
+		t.Fatalf("Detect() found %d faces in group.jpg, want 6", len(faces))
+	}
+	if len(all) <= len(faces) {
+		t.Errorf("Detect() proposed %d faces without suppression, want more than %d", len(all), len(faces))
+	}
+	box := func(r image.Rectangle) *candidate {
+		return &candidate{x1: float32(r.Min.X), y1: float32(r.Min.Y), x2: float32(r.Max.X), y2: float32(r.Max.Y)}
+	}
+	for i := range faces {
+		for j := range i {
+			if overlap := iou(box(faces[i].Box), box(faces[j].Box)); overlap > DefaultThresholds.IoU {
+				t.Errorf("faces %v and %v overlap by %v, more than %v", faces[i].Box, faces[j].Box, overlap, DefaultThresholds.IoU)
+			}
+		}
+		if faces[i].Score < DefaultThresholds.Score {
+			t.Errorf("face %v scored %v, below %v", faces[i].Box, faces[i].Score, DefaultThresholds.Score)
+		}
+	}
+}
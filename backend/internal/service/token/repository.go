@@ -0,0 +1,36 @@
+package token
+
+import (
+	"context"
+	"time"
+)
+
+// Repository stores token accounts and their transaction history
+type Repository interface {
+	// WithTx runs fn in a transaction, as user.Repository.WithTx does
+	WithTx(ctx context.Context, fn func(Repository) error) error
+
+	// DeductPoints takes points from a user's point balance, returning
+	// ErrUserNotFound or ErrInsufficientPoints
+	DeductPoints(ctx context.Context, userID int64, points int) error
+
+	// GetAccount returns a user's token account, locking it until the
+	// transaction ends. It returns ErrNoAccount if the user has none.
+	GetAccount(ctx context.Context, userID int64) (*Token, error)
+	// Stake moves amount from the balance into the stake, returning
+	// ErrInsufficientBalance if the account can't cover it
+	Stake(ctx context.Context, userID int64, amount float64, durationDays int, start, end time.Time) error
+	// ReleaseStake clears the stake and credits amount to the balance
+	ReleaseStake(ctx context.Context, userID int64, amount float64) error
+	// Debit takes amount from the balance, returning
+	// ErrInsufficientBalance if the account can't cover it
+	Debit(ctx context.Context, userID int64, amount float64) error
+	// Credit adds amount to the balance, opening the account if needed
+	Credit(ctx context.Context, userID int64, amount float64) error
+
+	// CreateTransaction stores txn and sets its ID
+	CreateTransaction(ctx context.Context, txn *Transaction) error
+	GetTransaction(ctx context.Context, id int64) (*Transaction, error)
+	// ListTransactions returns a page of a user's transactions, newest first
+	ListTransactions(ctx context.Context, userID int64, limit, offset int) ([]*Transaction, error)
+}
@@ -2,19 +2,38 @@ package token
 
 import (
 	"context"
-	"database/sql"
-	"errors"
+	"math"
 	"time"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/logging"
+	"vws-backend/internal/metrics"
+	"vws-backend/internal/tracing"
 )
 
 var (
-	ErrInsufficientPoints  = errors.New("insufficient points")
-	ErrInsufficientBalance = errors.New("insufficient balance")
-	ErrInvalidAmount       = errors.New("invalid amount")
-	ErrInvalidStakePeriod  = errors.New("invalid stake period")
-	ErrAlreadyStaked       = errors.New("tokens already staked")
-	ErrNoStakedTokens      = errors.New("no staked tokens")
-	ErrStakePeriodActive   = errors.New("stake period still active")
+	ErrInsufficientPoints  = apperr.New(apperr.ErrInvalid, "insufficient_points", "insufficient points")
+	ErrInsufficientBalance = apperr.New(apperr.ErrInvalid, "insufficient_balance", "insufficient balance")
+	ErrInvalidAmount       = apperr.New(apperr.ErrInvalid, "invalid_amount", "invalid amount")
+	ErrInvalidStakePeriod  = apperr.New(apperr.ErrInvalid, "invalid_stake_period", "invalid stake period")
+	ErrAlreadyStaked       = apperr.New(apperr.ErrInvalid, "already_staked", "tokens already staked")
+	ErrNoStakedTokens      = apperr.New(apperr.ErrInvalid, "no_staked_tokens", "no staked tokens")
+	ErrStakePeriodActive   = apperr.New(apperr.ErrInvalid, "stake_period_active", "stake period still active")
+	ErrUserNotFound        = apperr.New(apperr.ErrNotFound, "user_not_found", "user not found")
+	ErrNoAccount           = apperr.New(apperr.ErrNotFound, "no_account", "no token account")
+	ErrTransactionNotFound = apperr.New(apperr.ErrNotFound, "transaction_not_found", "transaction not found")
+	ErrReasonRequired      = apperr.New(apperr.ErrInvalid, "reason_required", "a reason and an actor are required")
+	ErrDuplicateIdentity   = apperr.New(apperr.ErrForbidden, "duplicate_identity",
+		"the account was found to duplicate another person's and can't earn tokens")
+)
+
+// Transaction types
+const (
+	TypeEarn     = "EARN"
+	TypeStake    = "STAKE"
+	TypeUnstake  = "UNSTAKE"
+	TypeTransfer = "TRANSFER"
+	TypeAdjust   = "ADJUST"
 )
 
 type Token struct {
@@ -34,86 +53,78 @@ type Transaction struct {
 	UserID          int64     `json:"user_id"`
 	Type            string    `json:"type"`
 	Amount          float64   `json:"amount"`
+	FromUserID      int64     `json:"from_user_id,omitempty"`
+	ToUserID        int64     `json:"to_user_id,omitempty"`
 	PointsConverted int       `json:"points_converted"`
 	Description     string    `json:"description"`
+	Actor           string    `json:"actor,omitempty"` // Operator behind an ADJUST
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
 
-type Service struct {
-	db *sql.DB
+// Duplicates tells users confirmed to hold another account of the same
+// person, which face.Repository does
+type Duplicates interface {
+	IsConfirmedDuplicate(ctx context.Context, userID int64) (bool, error)
 }
 
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+type Service struct {
+	repo       Repository
+	duplicates Duplicates
 }
 
-// ConvertPointsToTokens converts user points to tokens at a specified rate
-func (s *Service) ConvertPointsToTokens(ctx context.Context, userID int64, points int) (*Transaction, error) {
-	// Calculate token amount (1 point = 0.1 tokens)
-	tokenAmount := float64(points) * 0.1
+// NewService creates a token service. Users duplicates confirms can't
+// convert points to tokens.
+func NewService(repo Repository, duplicates Duplicates) *Service {
+	return &Service{repo: repo, duplicates: duplicates}
+}
 
-	tx, err := s.db.Begin()
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
+// ConvertPointsToTokens converts user points to tokens at a specified
+// rate, unless the user is a confirmed duplicate
+func (s *Service) ConvertPointsToTokens(ctx context.Context, userID int64, points int) (_ *Transaction, err error) {
+	ctx, span := tracing.Start(ctx, "token.ConvertPointsToTokens")
+	defer tracing.End(span, &err)
 
-	// Check if user has enough points
-	var userPoints int
-	err = tx.QueryRow("SELECT points FROM users WHERE id = $1", userID).Scan(&userPoints)
+	duplicate, err := s.duplicates.IsConfirmedDuplicate(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	if userPoints < points {
-		return nil, ErrInsufficientPoints
-	}
-
-	// Create token transaction
-	var transaction Transaction
-	err = tx.QueryRow(
-		`INSERT INTO token_transactions
-		(user_id, type, amount, points_converted, description)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, updated_at`,
-		userID, "EARN", tokenAmount, points, "Points conversion",
-	).Scan(&transaction.ID, &transaction.CreatedAt, &transaction.UpdatedAt)
-	if err != nil {
-		return nil, err
+	if duplicate {
+		return nil, ErrDuplicateIdentity
 	}
 
-	// Update user points
-	result, err := tx.Exec(
-		`UPDATE users SET points = points - $1 WHERE id = $2`,
-		points, userID,
-	)
-	if err != nil {
-		return nil, err
-	}
+	// Calculate token amount (1 point = 0.1 tokens)
+	tokenAmount := float64(points) * 0.1
 
-	rows, err := result.RowsAffected()
+	now := time.Now()
+	transaction := &Transaction{
+		UserID:          userID,
+		Type:            TypeEarn,
+		Amount:          tokenAmount,
+		PointsConverted: points,
+		Description:     "Points conversion",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	err = s.repo.WithTx(ctx, func(repo Repository) error {
+		if err := repo.DeductPoints(ctx, userID, points); err != nil {
+			return err
+		}
+		return repo.CreateTransaction(ctx, transaction)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if rows == 0 {
-		return nil, sql.ErrNoRows
-	}
+	metrics.ObserveTokenOperation(metrics.OperationConvert, tokenAmount)
 
-	if err := tx.Commit(); err != nil {
-		return nil, err
-	}
-
-	transaction.UserID = userID
-	transaction.Type = "EARN"
-	transaction.Amount = tokenAmount
-	transaction.PointsConverted = points
-	transaction.Description = "Points conversion"
-
-	return &transaction, nil
+	return transaction, nil
 }
 
 // StakeTokens stakes a specified amount of tokens for a duration
-func (s *Service) StakeTokens(ctx context.Context, userID int64, amount float64, durationDays int) (*Transaction, error) {
+func (s *Service) StakeTokens(ctx context.Context, userID int64, amount float64, durationDays int) (_ *Transaction, err error) {
+	ctx, span := tracing.Start(ctx, "token.StakeTokens")
+	defer tracing.End(span, &err)
+
 	if amount <= 0 {
 		return nil, ErrInvalidAmount
 	}
@@ -121,205 +132,186 @@ func (s *Service) StakeTokens(ctx context.Context, userID int64, amount float64,
 		return nil, ErrInvalidStakePeriod
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	// Check if user already has staked tokens
-	var stakedAmount float64
-	err = tx.QueryRowContext(ctx,
-		"SELECT staked_amount FROM tokens WHERE user_id = $1",
-		userID).Scan(&stakedAmount)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, err
-	}
-	if stakedAmount > 0 {
-		return nil, ErrAlreadyStaked
-	}
-
-	// Update token balance and stake
 	now := time.Now()
-	endDate := now.AddDate(0, 0, durationDays)
-	result, err := tx.ExecContext(ctx,
-		`UPDATE tokens 
-		SET balance = balance - $1,
-			staked_amount = $1,
-			last_stake_date = $2,
-			stake_duration_days = $3,
-			stake_end_date = $4
-		WHERE user_id = $5 AND balance >= $1`,
-		amount, now, durationDays, endDate, userID)
-	if err != nil {
-		return nil, err
-	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return nil, err
-	}
-	if rows == 0 {
-		return nil, ErrInsufficientBalance
-	}
+	transaction := &Transaction{
+		UserID:      userID,
+		Type:        TypeStake,
+		Amount:      amount,
+		Description: "Token staking",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err = s.repo.WithTx(ctx, func(repo Repository) error {
+		// Check if user already has staked tokens
+		account, err := repo.GetAccount(ctx, userID)
+		if err == ErrNoAccount {
+			return ErrInsufficientBalance
+		}
+		if err != nil {
+			return err
+		}
+		if account.StakedAmount > 0 {
+			return ErrAlreadyStaked
+		}
 
-	// Record transaction
-	var txnID int64
-	err = tx.QueryRowContext(ctx,
-		`INSERT INTO token_transactions 
-		(user_id, type, amount, description)
-		VALUES ($1, 'STAKE', $2, $3)
-		RETURNING id`,
-		userID, amount, "Token staking").Scan(&txnID)
+		endDate := now.AddDate(0, 0, durationDays)
+		if err := repo.Stake(ctx, userID, amount, durationDays, now, endDate); err != nil {
+			return err
+		}
+		return repo.CreateTransaction(ctx, transaction)
+	})
 	if err != nil {
 		return nil, err
 	}
+	metrics.ObserveTokenOperation(metrics.OperationStake, amount)
 
-	if err := tx.Commit(); err != nil {
-		return nil, err
-	}
-
-	return s.GetTransaction(ctx, txnID)
+	return transaction, nil
 }
 
 // UnstakeTokens unstakes tokens after the staking period has ended
-func (s *Service) UnstakeTokens(ctx context.Context, userID int64) (*Transaction, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	// Get staking details
-	var token Token
-	err = tx.QueryRowContext(ctx,
-		`SELECT staked_amount, stake_end_date 
-		FROM tokens WHERE user_id = $1`,
-		userID).Scan(&token.StakedAmount, &token.StakeEndDate)
-	if err != nil {
-		return nil, err
-	}
+func (s *Service) UnstakeTokens(ctx context.Context, userID int64) (_ *Transaction, err error) {
+	ctx, span := tracing.Start(ctx, "token.UnstakeTokens")
+	defer tracing.End(span, &err)
+
+	var transaction *Transaction
+	var staked float64
+	err = s.repo.WithTx(ctx, func(repo Repository) error {
+		// Get staking details
+		account, err := repo.GetAccount(ctx, userID)
+		if err == ErrNoAccount {
+			return ErrNoStakedTokens
+		}
+		if err != nil {
+			return err
+		}
 
-	if token.StakedAmount == 0 {
-		return nil, ErrNoStakedTokens
-	}
+		if account.StakedAmount == 0 {
+			return ErrNoStakedTokens
+		}
 
-	if time.Now().Before(token.StakeEndDate) {
-		return nil, ErrStakePeriodActive
-	}
+		now := time.Now()
+		if now.Before(account.StakeEndDate) {
+			return ErrStakePeriodActive
+		}
 
-	// Calculate reward (5% APY, prorated for stake duration)
-	reward := token.StakedAmount * 0.05
-
-	// Update token balance
-	_, err = tx.ExecContext(ctx,
-		`UPDATE tokens 
-		SET balance = balance + $1 + $2,
-			staked_amount = 0,
-			last_stake_date = NULL,
-			stake_duration_days = NULL,
-			stake_end_date = NULL
-		WHERE user_id = $3`,
-		token.StakedAmount, reward, userID)
-	if err != nil {
-		return nil, err
-	}
+		// Calculate reward (5% APY, prorated for stake duration)
+		staked = account.StakedAmount
+		reward := staked * 0.05
 
-	// Record transaction
-	var txnID int64
-	err = tx.QueryRowContext(ctx,
-		`INSERT INTO token_transactions 
-		(user_id, type, amount, description)
-		VALUES ($1, 'UNSTAKE', $2, $3)
-		RETURNING id`,
-		userID, token.StakedAmount+reward,
-		"Token unstaking with reward").Scan(&txnID)
-	if err != nil {
-		return nil, err
-	}
+		if err := repo.ReleaseStake(ctx, userID, staked+reward); err != nil {
+			return err
+		}
 
-	if err := tx.Commit(); err != nil {
+		transaction = &Transaction{
+			UserID:      userID,
+			Type:        TypeUnstake,
+			Amount:      staked + reward,
+			Description: "Token unstaking with reward",
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		return repo.CreateTransaction(ctx, transaction)
+	})
+	if err != nil {
 		return nil, err
 	}
+	metrics.ObserveTokenOperation(metrics.OperationUnstake, staked)
 
-	return s.GetTransaction(ctx, txnID)
+	return transaction, nil
 }
 
 // TransferTokens transfers tokens between users
-func (s *Service) TransferTokens(ctx context.Context, fromUserID, toUserID int64, amount float64) (*Transaction, error) {
+func (s *Service) TransferTokens(ctx context.Context, fromUserID, toUserID int64, amount float64) (_ *Transaction, err error) {
+	ctx, span := tracing.Start(ctx, "token.TransferTokens")
+	defer tracing.End(span, &err)
+
 	if amount <= 0 {
 		return nil, ErrInvalidAmount
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	// Deduct from sender
-	result, err := tx.ExecContext(ctx,
-		`UPDATE tokens 
-		SET balance = balance - $1
-		WHERE user_id = $2 AND balance >= $1`,
-		amount, fromUserID)
-	if err != nil {
-		return nil, err
-	}
-	rows, err := result.RowsAffected()
+	now := time.Now()
+	transaction := &Transaction{
+		UserID:      fromUserID,
+		Type:        TypeTransfer,
+		Amount:      amount,
+		FromUserID:  fromUserID,
+		ToUserID:    toUserID,
+		Description: "Token transfer",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err = s.repo.WithTx(ctx, func(repo Repository) error {
+		if err := repo.Debit(ctx, fromUserID, amount); err != nil {
+			return err
+		}
+		if err := repo.Credit(ctx, toUserID, amount); err != nil {
+			return err
+		}
+		return repo.CreateTransaction(ctx, transaction)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if rows == 0 {
-		return nil, ErrInsufficientBalance
-	}
+	metrics.ObserveTokenOperation(metrics.OperationTransfer, amount)
 
-	// Add to receiver
-	_, err = tx.ExecContext(ctx,
-		`INSERT INTO tokens (user_id, balance) 
-		VALUES ($1, $2)
-		ON CONFLICT (user_id) 
-		DO UPDATE SET balance = tokens.balance + $2`,
-		toUserID, amount)
-	if err != nil {
-		return nil, err
-	}
+	return transaction, nil
+}
 
-	// Record transaction
-	var txnID int64
-	err = tx.QueryRowContext(ctx,
-		`INSERT INTO token_transactions 
-		(user_id, type, amount, from_user_id, to_user_id, description)
-		VALUES ($1, 'TRANSFER', $2, $3, $4, $5)
-		RETURNING id`,
-		fromUserID, amount, fromUserID, toUserID,
-		"Token transfer").Scan(&txnID)
-	if err != nil {
-		return nil, err
+// AdjustBalance corrects a user's balance by amount, debiting it when amount
+// is negative. Adjustments are made by operators outside the usual flows, so
+// the transaction records who made it and why.
+func (s *Service) AdjustBalance(ctx context.Context, userID int64, amount float64, reason, actor string) (_ *Transaction, err error) {
+	ctx, span := tracing.Start(ctx, "token.AdjustBalance")
+	defer tracing.End(span, &err)
+
+	if amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+	if reason == "" || actor == "" {
+		return nil, ErrReasonRequired
 	}
 
-	if err := tx.Commit(); err != nil {
+	now := time.Now()
+	transaction := &Transaction{
+		UserID:      userID,
+		Type:        TypeAdjust,
+		Amount:      amount,
+		Description: reason,
+		Actor:       actor,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err = s.repo.WithTx(ctx, func(repo Repository) error {
+		var err error
+		if amount > 0 {
+			err = repo.Credit(ctx, userID, amount)
+		} else {
+			err = repo.Debit(ctx, userID, -amount)
+		}
+		if err != nil {
+			return err
+		}
+		return repo.CreateTransaction(ctx, transaction)
+	})
+	if err != nil {
 		return nil, err
 	}
+	metrics.ObserveTokenOperation(metrics.OperationAdjust, math.Abs(amount))
+	logging.FromContext(ctx).Info("token balance adjusted",
+		"user_id", userID, "amount", amount, "reason", reason, "actor", actor, "transaction_id", transaction.ID)
 
-	return s.GetTransaction(ctx, txnID)
+	return transaction, nil
 }
 
 // GetUserTokens gets a user's token information
-func (s *Service) GetUserTokens(ctx context.Context, userID int64) (*Token, error) {
-	token := &Token{}
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, user_id, balance, staked_amount, 
-		last_stake_date, stake_duration_days, stake_end_date,
-		created_at, updated_at
-		FROM tokens WHERE user_id = $1`,
-		userID).Scan(
-		&token.ID, &token.UserID, &token.Balance, &token.StakedAmount,
-		&token.LastStakeDate, &token.StakeDuration, &token.StakeEndDate,
-		&token.CreatedAt, &token.UpdatedAt)
-	if err == sql.ErrNoRows {
+func (s *Service) GetUserTokens(ctx context.Context, userID int64) (_ *Token, err error) {
+	ctx, span := tracing.Start(ctx, "token.GetUserTokens")
+	defer tracing.End(span, &err)
+
+	token, err := s.repo.GetAccount(ctx, userID)
+	if err == ErrNoAccount {
 		// Return empty token info if not found
-		token.UserID = userID
-		return token, nil
+		return &Token{UserID: userID}, nil
 	}
 	if err != nil {
 		return nil, err
@@ -328,44 +320,17 @@ func (s *Service) GetUserTokens(ctx context.Context, userID int64) (*Token, erro
 }
 
 // GetTransaction gets a transaction by ID
-func (s *Service) GetTransaction(ctx context.Context, id int64) (*Transaction, error) {
-	txn := &Transaction{}
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, user_id, type, amount, points_converted, description, created_at, updated_at
-		FROM token_transactions WHERE id = $1`,
-		id).Scan(
-		&txn.ID, &txn.UserID, &txn.Type, &txn.Amount,
-		&txn.PointsConverted, &txn.Description, &txn.CreatedAt, &txn.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return txn, nil
+func (s *Service) GetTransaction(ctx context.Context, id int64) (_ *Transaction, err error) {
+	ctx, span := tracing.Start(ctx, "token.GetTransaction")
+	defer tracing.End(span, &err)
+
+	return s.repo.GetTransaction(ctx, id)
 }
 
 // GetUserTransactions gets a user's transaction history
-func (s *Service) GetUserTransactions(ctx context.Context, userID int64, limit, offset int) ([]*Transaction, error) {
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, user_id, type, amount, points_converted, description, created_at, updated_at
-		FROM token_transactions 
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3`,
-		userID, limit, offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var transactions []*Transaction
-	for rows.Next() {
-		txn := &Transaction{}
-		err := rows.Scan(
-			&txn.ID, &txn.UserID, &txn.Type, &txn.Amount,
-			&txn.PointsConverted, &txn.Description, &txn.CreatedAt, &txn.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		transactions = append(transactions, txn)
-	}
-	return transactions, nil
+func (s *Service) GetUserTransactions(ctx context.Context, userID int64, limit, offset int) (_ []*Transaction, err error) {
+	ctx, span := tracing.Start(ctx, "token.GetUserTransactions")
+	defer tracing.End(span, &err)
+
+	return s.repo.ListTransactions(ctx, userID, limit, offset)
 }
@@ -1,137 +1,221 @@
-package token
+package token_test
 
 import (
 	"context"
 	"testing"
 	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/face"
+	"vws-backend/internal/service/token"
+	"vws-backend/internal/service/user"
+	"vws-backend/internal/store/memory"
 )
 
-func TestConvertPointsToTokens(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock DB: %v", err)
-	}
-	defer db.Close()
+// newTestService returns a service on an empty store along with a user
+// holding points
+func newTestService(t *testing.T, points int64) (*token.Service, *memory.Store, int64) {
+	t.Helper()
 
-	svc := &Service{db: db}
+	store := memory.New()
 	ctx := context.Background()
 	now := time.Now()
+	u := &user.User{Username: "testuser", Email: "test@example.com", CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, store.Users().CreateUser(ctx, u))
+	require.NoError(t, store.Users().AddPoints(ctx, u.ID, points, now))
+	return token.NewService(store.Tokens(), store.Faces()), store, u.ID
+}
 
-	mock.ExpectBegin()
-
-	// Expect points check query
-	mock.ExpectQuery(`SELECT points FROM users WHERE id = \$1`).
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"points"}).AddRow(200)) // User has 200 points
-
-	mock.ExpectQuery(`INSERT INTO token_transactions`).
-		WithArgs(1, "EARN", 10.0, 100, "Points conversion").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
-			AddRow(1, now, now))
-
-	mock.ExpectExec(`UPDATE users SET points = points - \$1 WHERE id = \$2`).
-		WithArgs(100, 1).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	mock.ExpectCommit()
+func TestConvertPointsToTokens(t *testing.T) {
+	svc, store, userID := newTestService(t, 200)
+	ctx := context.Background()
 
-	txn, err := svc.ConvertPointsToTokens(ctx, 1, 100)
+	txn, err := svc.ConvertPointsToTokens(ctx, userID, 100)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), txn.ID)
-	assert.Equal(t, int64(1), txn.UserID)
+	assert.NotZero(t, txn.ID)
+	assert.Equal(t, userID, txn.UserID)
 	assert.Equal(t, "EARN", txn.Type)
 	assert.Equal(t, 10.0, txn.Amount)
 	assert.Equal(t, 100, txn.PointsConverted)
 	assert.Equal(t, "Points conversion", txn.Description)
+
+	u, err := store.Users().GetUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), u.Points)
 }
 
-func TestGetTransaction(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock DB: %v", err)
-	}
-	defer db.Close()
+func TestConvertPointsToTokens_InsufficientPoints(t *testing.T) {
+	svc, store, userID := newTestService(t, 50)
+	ctx := context.Background()
+
+	_, err := svc.ConvertPointsToTokens(ctx, userID, 100) // Trying to convert 100 points
+	assert.Error(t, err)
+	assert.Equal(t, token.ErrInsufficientPoints, err)
+
+	u, err := store.Users().GetUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), u.Points)
+	txns, err := svc.GetUserTransactions(ctx, userID, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, txns)
+}
 
-	svc := &Service{db: db}
+func TestConvertPointsToTokens_DuplicateIdentity(t *testing.T) {
+	svc, store, userID := newTestService(t, 200)
 	ctx := context.Background()
 	now := time.Now()
+	original := &user.User{Username: "original", Email: "original@example.com", CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, store.Users().CreateUser(ctx, original))
+
+	// Flagged, it may still convert until an admin confirms
+	duplicate := &face.Duplicate{
+		UserID: userID, MatchedUserID: original.ID, Similarity: 0.8, Status: face.DuplicatePending, CreatedAt: now,
+	}
+	require.NoError(t, store.Faces().CreateDuplicate(ctx, duplicate))
+	_, err := svc.ConvertPointsToTokens(ctx, userID, 50)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Faces().ReviewDuplicate(ctx, &face.Duplicate{
+		ID: duplicate.ID, Status: face.DuplicateConfirmed, ReviewedBy: original.ID, ReviewedAt: &now,
+	}))
+	_, err = svc.ConvertPointsToTokens(ctx, userID, 50)
+	assert.Equal(t, token.ErrDuplicateIdentity, err)
+
+	u, err := store.Users().GetUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), u.Points)
+}
 
-	mock.ExpectQuery(`SELECT .+ FROM token_transactions WHERE id = \$1`).
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"id", "user_id", "type", "amount", "points_converted",
-			"description", "created_at", "updated_at",
-		}).AddRow(1, 1, "EARN", 10.0, 100, "Points conversion", now, now))
+func TestGetTransaction(t *testing.T) {
+	svc, _, userID := newTestService(t, 200)
+	ctx := context.Background()
+
+	created, err := svc.ConvertPointsToTokens(ctx, userID, 100)
+	require.NoError(t, err)
 
-	txn, err := svc.GetTransaction(ctx, 1)
+	txn, err := svc.GetTransaction(ctx, created.ID)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), txn.ID)
-	assert.Equal(t, int64(1), txn.UserID)
+	assert.Equal(t, created.ID, txn.ID)
+	assert.Equal(t, userID, txn.UserID)
 	assert.Equal(t, "EARN", txn.Type)
 	assert.Equal(t, 10.0, txn.Amount)
 	assert.Equal(t, 100, txn.PointsConverted)
 	assert.Equal(t, "Points conversion", txn.Description)
+
+	_, err = svc.GetTransaction(ctx, created.ID+1)
+	assert.Equal(t, token.ErrTransactionNotFound, err)
 }
 
 func TestGetUserTransactions(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock DB: %v", err)
+	svc, _, userID := newTestService(t, 1000)
+	ctx := context.Background()
+
+	for range 3 {
+		_, err := svc.ConvertPointsToTokens(ctx, userID, 100)
+		require.NoError(t, err)
 	}
-	defer db.Close()
 
-	svc := NewService(db)
-	ctx := context.Background()
-	now := time.Now()
+	txns, err := svc.GetUserTransactions(ctx, userID, 2, 0)
+	assert.NoError(t, err)
+	assert.Len(t, txns, 2)
+	assert.Greater(t, txns[0].ID, txns[1].ID, "newest first")
 
-	mock.ExpectQuery(`SELECT id, user_id, type, amount, points_converted, description, created_at, updated_at
-		FROM token_transactions
-		WHERE user_id = \$1
-		ORDER BY created_at DESC
-		LIMIT \$2 OFFSET \$3`).
-		WithArgs(1, 10, 0).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"id", "user_id", "type", "amount", "points_converted",
-			"description", "created_at", "updated_at",
-		}).AddRow(
-			1, 1, "POINTS_CONVERSION", 100.0, 1000,
-			"Converted points to tokens", now, now,
-		))
-
-	txns, err := svc.GetUserTransactions(ctx, 1, 10, 0)
+	txns, err = svc.GetUserTransactions(ctx, userID, 10, 2)
 	assert.NoError(t, err)
 	assert.Len(t, txns, 1)
-	assert.Equal(t, int64(1), txns[0].ID)
-	assert.Equal(t, int64(1), txns[0].UserID)
-	assert.Equal(t, "POINTS_CONVERSION", txns[0].Type)
-	assert.Equal(t, 100.0, txns[0].Amount)
-	assert.Equal(t, 1000, txns[0].PointsConverted)
-	assert.Equal(t, "Converted points to tokens", txns[0].Description)
 }
 
-func TestConvertPointsToTokens_InsufficientPoints(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock DB: %v", err)
-	}
-	defer db.Close()
+func TestStakeAndUnstakeTokens(t *testing.T) {
+	svc, store, userID := newTestService(t, 0)
+	ctx := context.Background()
+	require.NoError(t, store.Tokens().Credit(ctx, userID, 100))
+
+	_, err := svc.StakeTokens(ctx, userID, 40, 10)
+	assert.Equal(t, token.ErrInvalidStakePeriod, err)
+	_, err = svc.StakeTokens(ctx, userID, 400, 30)
+	assert.Equal(t, token.ErrInsufficientBalance, err)
+
+	txn, err := svc.StakeTokens(ctx, userID, 40, 30)
+	require.NoError(t, err)
+	assert.Equal(t, token.TypeStake, txn.Type)
+
+	_, err = svc.StakeTokens(ctx, userID, 10, 30)
+	assert.Equal(t, token.ErrAlreadyStaked, err)
+	_, err = svc.UnstakeTokens(ctx, userID)
+	assert.Equal(t, token.ErrStakePeriodActive, err)
+
+	account, err := svc.GetUserTokens(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 60.0, account.Balance)
+	assert.Equal(t, 40.0, account.StakedAmount)
+}
+
+func TestUnstakeTokens_NoStake(t *testing.T) {
+	svc, _, userID := newTestService(t, 0)
+
+	_, err := svc.UnstakeTokens(context.Background(), userID)
+	assert.Equal(t, token.ErrNoStakedTokens, err)
+}
 
-	svc := &Service{db: db}
+func TestTransferTokens(t *testing.T) {
+	svc, store, fromID := newTestService(t, 0)
 	ctx := context.Background()
+	now := time.Now()
+	to := &user.User{Username: "other", Email: "other@example.com", CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, store.Users().CreateUser(ctx, to))
+	require.NoError(t, store.Tokens().Credit(ctx, fromID, 10))
+
+	txn, err := svc.TransferTokens(ctx, fromID, to.ID, 4)
+	require.NoError(t, err)
+	assert.Equal(t, fromID, txn.FromUserID)
+	assert.Equal(t, to.ID, txn.ToUserID)
+
+	_, err = svc.TransferTokens(ctx, fromID, to.ID, 7)
+	assert.Equal(t, token.ErrInsufficientBalance, err)
+
+	from, err := svc.GetUserTokens(ctx, fromID)
+	require.NoError(t, err)
+	assert.Equal(t, 6.0, from.Balance)
+	received, err := svc.GetUserTokens(ctx, to.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 4.0, received.Balance)
+}
 
-	mock.ExpectBegin()
+func TestGetUserTokens_NoAccount(t *testing.T) {
+	svc, _, userID := newTestService(t, 0)
 
-	// First, check if user has enough points
-	mock.ExpectQuery(`SELECT points FROM users WHERE id = \$1`).
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"points"}).AddRow(50)) // User only has 50 points
+	account, err := svc.GetUserTokens(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, userID, account.UserID)
+	assert.Zero(t, account.Balance)
+}
 
-	mock.ExpectRollback()
+func TestAdjustBalance(t *testing.T) {
+	svc, _, userID := newTestService(t, 0)
+	ctx := context.Background()
 
-	_, err = svc.ConvertPointsToTokens(ctx, 1, 100) // Trying to convert 100 points
-	assert.Error(t, err)
-	assert.Equal(t, ErrInsufficientPoints, err)
+	txn, err := svc.AdjustBalance(ctx, userID, 25, "support ticket 42", "ops")
+	require.NoError(t, err)
+	assert.Equal(t, token.TypeAdjust, txn.Type)
+	assert.Equal(t, "support ticket 42", txn.Description)
+	assert.Equal(t, "ops", txn.Actor)
+
+	_, err = svc.AdjustBalance(ctx, userID, -10, "duplicate credit", "ops")
+	require.NoError(t, err)
+	_, err = svc.AdjustBalance(ctx, userID, -100, "too much", "ops")
+	assert.Equal(t, token.ErrInsufficientBalance, err)
+
+	_, err = svc.AdjustBalance(ctx, userID, 5, "", "ops")
+	assert.Equal(t, token.ErrReasonRequired, err)
+	_, err = svc.AdjustBalance(ctx, userID, 0, "nothing", "ops")
+	assert.Equal(t, token.ErrInvalidAmount, err)
+
+	account, err := svc.GetUserTokens(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 15.0, account.Balance)
+	txns, err := svc.GetUserTransactions(ctx, userID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, txns, 2, "failed adjustments leave no record")
 }
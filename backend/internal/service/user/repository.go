@@ -0,0 +1,66 @@
+package user
+
+import (
+	"context"
+	"time"
+)
+
+// RefreshToken is one link in a session's chain of refresh tokens
+type RefreshToken struct {
+	ID               int64
+	SessionID        int64
+	UserID           int64 // Owner of the session
+	TokenHash        string
+	ExpiresAt        time.Time
+	UsedAt           *time.Time
+	SessionRevokedAt *time.Time
+}
+
+// Repository stores users, their sessions and refresh tokens
+type Repository interface {
+	// WithTx runs fn in a serializable transaction. The repository passed
+	// to fn reads and writes inside it; the transaction commits when fn
+	// returns nil and rolls back otherwise. Calls nest into the outer
+	// transaction. fn is run again when the transaction fails on a
+	// serialization conflict or deadlock, so it must not have effects
+	// outside it. The other services' repositories share this contract.
+	WithTx(ctx context.Context, fn func(Repository) error) error
+
+	// CreateUser stores user and sets its ID. It returns ErrUserExists
+	// when the username or email is taken.
+	CreateUser(ctx context.Context, user *User) error
+	// GetUser returns the user without its password hash
+	GetUser(ctx context.Context, id int64) (*User, error)
+	// GetUserByEmail returns the user including its password hash
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	AddPoints(ctx context.Context, userID, points int64, at time.Time) error
+	// RecordLogin sets the last login to at. The streak grows by one when
+	// the previous login was at most a day earlier and restarts at one
+	// otherwise.
+	RecordLogin(ctx context.Context, userID int64, at time.Time) error
+	// Leaderboard returns the users with the most points, with only ID,
+	// username, points and streak set
+	Leaderboard(ctx context.Context, limit int) ([]*User, error)
+	GetRole(ctx context.Context, userID int64) (string, error)
+	SetRole(ctx context.Context, userID int64, role string, at time.Time) error
+
+	// CreateSession stores session and sets its ID
+	CreateSession(ctx context.Context, session *Session) error
+	GetSession(ctx context.Context, id int64) (*Session, error)
+	// ListActiveSessions returns the user's unrevoked sessions expiring
+	// after now, most recently used first
+	ListActiveSessions(ctx context.Context, userID int64, now time.Time) ([]*Session, error)
+	TouchSession(ctx context.Context, sessionID int64, expiresAt, lastUsedAt time.Time) error
+	// RevokeSession revokes one unrevoked session of the user, returning
+	// ErrSessionNotFound if there is none
+	RevokeSession(ctx context.Context, userID, sessionID int64, reason string, at time.Time) error
+	RevokeAllSessions(ctx context.Context, userID int64, reason string, at time.Time) error
+
+	// CreateRefreshToken stores token and sets its ID
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	// GetRefreshToken finds a token by hash together with its session's
+	// owner and revocation, locking it until the transaction ends. It
+	// returns ErrInvalidRefreshToken for unknown hashes.
+	GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, tokenID int64, at time.Time) error
+}
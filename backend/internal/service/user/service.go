@@ -2,11 +2,19 @@ package user
 
 import (
 	"context"
-	"database/sql"
-	"errors"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/tracing"
+)
+
+var (
+	ErrUserNotFound       = apperr.New(apperr.ErrNotFound, "user_not_found", "user not found")
+	ErrUserExists         = apperr.New(apperr.ErrConflict, "user_exists", "username or email already taken")
+	ErrInvalidCredentials = apperr.New(apperr.ErrUnauthorized, "invalid_credentials", "invalid credentials")
+	ErrMissingFields      = apperr.New(apperr.ErrInvalid, "missing_fields", "username, email, and password are required")
 )
 
 // User represents a user in the system
@@ -24,18 +32,21 @@ type User struct {
 
 // Service represents the user service
 type Service struct {
-	db *sql.DB
+	repo Repository
 }
 
 // NewService creates a new user service
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
 }
 
 // CreateUser creates a new user
-func (s *Service) CreateUser(ctx context.Context, username, email, password string) (*User, error) {
+func (s *Service) CreateUser(ctx context.Context, username, email, password string) (_ *User, err error) {
+	ctx, span := tracing.Start(ctx, "user.CreateUser")
+	defer tracing.End(span, &err)
+
 	if username == "" || email == "" || password == "" {
-		return nil, errors.New("username, email, and password are required")
+		return nil, ErrMissingFields
 	}
 
 	// Hash password
@@ -57,24 +68,7 @@ func (s *Service) CreateUser(ctx context.Context, username, email, password stri
 		UpdatedAt: now,
 	}
 
-	// Insert into database
-	query := `
-		INSERT INTO users (username, email, password, points, streak, last_login, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id`
-
-	err = s.db.QueryRowContext(ctx, query,
-		user.Username,
-		user.Email,
-		user.Password,
-		user.Points,
-		user.Streak,
-		user.LastLogin,
-		user.CreatedAt,
-		user.UpdatedAt,
-	).Scan(&user.ID)
-
-	if err != nil {
+	if err := s.repo.CreateUser(ctx, user); err != nil {
 		return nil, err
 	}
 
@@ -82,150 +76,48 @@ func (s *Service) CreateUser(ctx context.Context, username, email, password stri
 }
 
 // GetUser retrieves a user by ID
-func (s *Service) GetUser(ctx context.Context, id int64) (*User, error) {
-	user := &User{}
-	query := `
-		SELECT id, username, email, points, streak, last_login, created_at, updated_at
-		FROM users
-		WHERE id = $1`
-
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.Points,
-		&user.Streak,
-		&user.LastLogin,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
-	}
-	if err != nil {
-		return nil, err
-	}
+func (s *Service) GetUser(ctx context.Context, id int64) (_ *User, err error) {
+	ctx, span := tracing.Start(ctx, "user.GetUser")
+	defer tracing.End(span, &err)
 
-	return user, nil
+	return s.repo.GetUser(ctx, id)
 }
 
 // UpdatePoints updates a user's points
-func (s *Service) UpdatePoints(ctx context.Context, userID int64, points int64) error {
-	query := `
-		UPDATE users
-		SET points = points + $1, updated_at = $2
-		WHERE id = $3`
-
-	result, err := s.db.ExecContext(ctx, query, points, time.Now(), userID)
-	if err != nil {
-		return err
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if rows == 0 {
-		return errors.New("user not found")
-	}
+func (s *Service) UpdatePoints(ctx context.Context, userID int64, points int64) (err error) {
+	ctx, span := tracing.Start(ctx, "user.UpdatePoints")
+	defer tracing.End(span, &err)
 
-	return nil
+	return s.repo.AddPoints(ctx, userID, points, time.Now())
 }
 
 // UpdateStreak updates a user's streak
-func (s *Service) UpdateStreak(ctx context.Context, userID int64) error {
-	query := `
-		UPDATE users
-		SET streak = streak + 1, last_login = $1, updated_at = $1
-		WHERE id = $2 AND (
-			last_login IS NULL OR
-			(EXTRACT(EPOCH FROM ($1 - last_login)) <= 86400)
-		)`
+func (s *Service) UpdateStreak(ctx context.Context, userID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "user.UpdateStreak")
+	defer tracing.End(span, &err)
 
-	now := time.Now()
-	result, err := s.db.ExecContext(ctx, query, now, userID)
-	if err != nil {
-		return err
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if rows == 0 {
-		// Reset streak if more than 24 hours have passed
-		query = `
-			UPDATE users
-			SET streak = 1, last_login = $1, updated_at = $1
-			WHERE id = $2`
-		_, err = s.db.ExecContext(ctx, query, now, userID)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return s.repo.RecordLogin(ctx, userID, time.Now())
 }
 
 // GetLeaderboard returns the top users by points
-func (s *Service) GetLeaderboard(ctx context.Context, limit int) ([]*User, error) {
+func (s *Service) GetLeaderboard(ctx context.Context, limit int) (_ []*User, err error) {
+	ctx, span := tracing.Start(ctx, "user.GetLeaderboard")
+	defer tracing.End(span, &err)
+
 	if limit <= 0 {
 		limit = 10
 	}
-
-	query := `
-		SELECT id, username, points, streak
-		FROM users
-		ORDER BY points DESC
-		LIMIT $1`
-
-	rows, err := s.db.QueryContext(ctx, query, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []*User
-	for rows.Next() {
-		user := &User{}
-		err := rows.Scan(
-			&user.ID,
-			&user.Username,
-			&user.Points,
-			&user.Streak,
-		)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, user)
-	}
-
-	return users, nil
+	return s.repo.Leaderboard(ctx, limit)
 }
 
 // Authenticate authenticates a user
-func (s *Service) Authenticate(ctx context.Context, email, password string) (*User, error) {
-	user := &User{}
-	query := `
-		SELECT id, username, email, password, points, streak, last_login, created_at, updated_at
-		FROM users
-		WHERE email = $1`
-
-	err := s.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.Password,
-		&user.Points,
-		&user.Streak,
-		&user.LastLogin,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, errors.New("invalid credentials")
+func (s *Service) Authenticate(ctx context.Context, email, password string) (_ *User, err error) {
+	ctx, span := tracing.Start(ctx, "user.Authenticate")
+	defer tracing.End(span, &err)
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err == ErrUserNotFound {
+		return nil, ErrInvalidCredentials
 	}
 	if err != nil {
 		return nil, err
@@ -234,7 +126,7 @@ func (s *Service) Authenticate(ctx context.Context, email, password string) (*Us
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	// Update last login and streak
@@ -1,178 +1,146 @@
-package user
+package user_test
 
 import (
 	"context"
-	"database/sql"
 	"testing"
-	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/user"
+	"vws-backend/internal/store/memory"
 )
 
+func newTestService(t *testing.T) *user.Service {
+	t.Helper()
+	return user.NewService(memory.New().Users())
+}
+
 func TestCreateUser(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
-
-	service := NewService(db)
-
-	mock.ExpectQuery("INSERT INTO users").
-		WithArgs(
-			sqlmock.AnyArg(), // username
-			sqlmock.AnyArg(), // email
-			sqlmock.AnyArg(), // password
-			sqlmock.AnyArg(), // points
-			sqlmock.AnyArg(), // streak
-			sqlmock.AnyArg(), // last_login
-			sqlmock.AnyArg(), // created_at
-			sqlmock.AnyArg(), // updated_at
-		).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-
-	user, err := service.CreateUser(context.Background(), "testuser", "test@example.com", "password123")
+	service := newTestService(t)
+
+	u, err := service.CreateUser(context.Background(), "testuser", "test@example.com", "password123")
 	assert.NoError(t, err)
-	assert.NotNil(t, user)
-	assert.Equal(t, "testuser", user.Username)
-	assert.Equal(t, "test@example.com", user.Email)
-	assert.Equal(t, int64(0), user.Points)
-	assert.Equal(t, 0, user.Streak)
+	assert.NotNil(t, u)
+	assert.NotZero(t, u.ID)
+	assert.Equal(t, "testuser", u.Username)
+	assert.Equal(t, "test@example.com", u.Email)
+	assert.NotEqual(t, "password123", u.Password, "the password is stored hashed")
+	assert.Equal(t, int64(0), u.Points)
+	assert.Equal(t, 0, u.Streak)
 }
 
-func TestGetUser(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
+func TestCreateUser_Taken(t *testing.T) {
+	service := newTestService(t)
 
-	service := NewService(db)
-	now := time.Now()
+	_, err := service.CreateUser(context.Background(), "testuser", "test@example.com", "password123")
+	require.NoError(t, err)
+
+	_, err = service.CreateUser(context.Background(), "testuser", "other@example.com", "password123")
+	assert.Equal(t, user.ErrUserExists, err)
+}
+
+func TestCreateUser_MissingFields(t *testing.T) {
+	service := newTestService(t)
+
+	_, err := service.CreateUser(context.Background(), "testuser", "", "password123")
+	assert.Error(t, err)
+}
 
-	rows := sqlmock.NewRows([]string{
-		"id", "username", "email", "points", "streak",
-		"last_login", "created_at", "updated_at",
-	}).AddRow(
-		1, "testuser", "test@example.com", 100, 5,
-		now, now, now,
-	)
+func TestGetUser(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
 
-	mock.ExpectQuery("SELECT (.+) FROM users").
-		WithArgs(1).
-		WillReturnRows(rows)
+	created, err := service.CreateUser(ctx, "testuser", "test@example.com", "password123")
+	require.NoError(t, err)
+	require.NoError(t, service.UpdatePoints(ctx, created.ID, 100))
 
-	user, err := service.GetUser(context.Background(), 1)
+	u, err := service.GetUser(ctx, created.ID)
 	assert.NoError(t, err)
-	assert.NotNil(t, user)
-	assert.Equal(t, int64(1), user.ID)
-	assert.Equal(t, "testuser", user.Username)
-	assert.Equal(t, int64(100), user.Points)
-	assert.Equal(t, 5, user.Streak)
+	assert.NotNil(t, u)
+	assert.Equal(t, created.ID, u.ID)
+	assert.Equal(t, "testuser", u.Username)
+	assert.Equal(t, int64(100), u.Points)
+	assert.Empty(t, u.Password)
+
+	_, err = service.GetUser(ctx, created.ID+1)
+	assert.Equal(t, user.ErrUserNotFound, err)
 }
 
 func TestUpdatePoints(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
+	service := newTestService(t)
+	ctx := context.Background()
 
-	service := NewService(db)
+	created, err := service.CreateUser(ctx, "testuser", "test@example.com", "password123")
+	require.NoError(t, err)
 
-	mock.ExpectExec("UPDATE users").
-		WithArgs(
-			sqlmock.AnyArg(), // points
-			sqlmock.AnyArg(), // updated_at
-			1,                // user_id
-		).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, service.UpdatePoints(ctx, created.ID, 50))
+	assert.NoError(t, service.UpdatePoints(ctx, created.ID, 25))
+	u, err := service.GetUser(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(75), u.Points)
 
-	err = service.UpdatePoints(context.Background(), 1, 50)
-	assert.NoError(t, err)
+	assert.Equal(t, user.ErrUserNotFound, service.UpdatePoints(ctx, created.ID+1, 50))
 }
 
 func TestGetLeaderboard(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
+	service := newTestService(t)
+	ctx := context.Background()
+
+	for _, seed := range []struct {
+		username string
+		points   int64
+	}{
+		{"user3", 60},
+		{"user1", 100},
+		{"user2", 80},
+	} {
+		u, err := service.CreateUser(ctx, seed.username, seed.username+"@example.com", "password123")
+		require.NoError(t, err)
+		require.NoError(t, service.UpdatePoints(ctx, u.ID, seed.points))
 	}
-	defer db.Close()
-
-	service := NewService(db)
 
-	rows := sqlmock.NewRows([]string{
-		"id", "username", "points", "streak",
-	}).
-		AddRow(1, "user1", 100, 5).
-		AddRow(2, "user2", 80, 3).
-		AddRow(3, "user3", 60, 2)
-
-	mock.ExpectQuery("SELECT (.+) FROM users ORDER BY points DESC").
-		WithArgs(10).
-		WillReturnRows(rows)
-
-	users, err := service.GetLeaderboard(context.Background(), 10)
+	users, err := service.GetLeaderboard(ctx, 10)
 	assert.NoError(t, err)
 	assert.Len(t, users, 3)
 	assert.Equal(t, "user1", users[0].Username)
 	assert.Equal(t, int64(100), users[0].Points)
+	assert.Equal(t, "user3", users[2].Username)
+
+	users, err = service.GetLeaderboard(ctx, 2)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
 }
 
 func TestAuthenticate(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
-
-	service := NewService(db)
-	now := time.Now()
-
-	// Set up mock for user query
-	rows := sqlmock.NewRows([]string{
-		"id", "username", "email", "password", "points", "streak",
-		"last_login", "created_at", "updated_at",
-	}).AddRow(
-		1, "testuser", "test@example.com",
-		"$2a$10$f21Tq4lkY4/zBs5GyEu0vuq1hgiv9j0oblJfX594mvp7LHuK7Mpbm", // pre-hashed "password123"
-		100, 5,
-		now, now, now,
-	)
-
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE email").
-		WithArgs("test@example.com").
-		WillReturnRows(rows)
-
-	mock.ExpectExec("UPDATE users").
-		WithArgs(
-			sqlmock.AnyArg(), // last_login
-			1,                // user_id
-		).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	authenticatedUser, err := service.Authenticate(context.Background(), "test@example.com", "password123")
+	service := newTestService(t)
+	ctx := context.Background()
+
+	created, err := service.CreateUser(ctx, "testuser", "test@example.com", "password123")
+	require.NoError(t, err)
+
+	authenticatedUser, err := service.Authenticate(ctx, "test@example.com", "password123")
 	assert.NoError(t, err)
 	assert.NotNil(t, authenticatedUser)
 	assert.Equal(t, "testuser", authenticatedUser.Username)
 	assert.Equal(t, "", authenticatedUser.Password) // Password should be cleared
+
+	u, err := service.GetUser(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, u.Streak, "logging in within a day of signing up extends the streak")
 }
 
 func TestAuthenticateInvalidCredentials(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
+	service := newTestService(t)
+	ctx := context.Background()
 
-	service := NewService(db)
+	_, err := service.CreateUser(ctx, "testuser", "test@example.com", "password123")
+	require.NoError(t, err)
 
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE email").
-		WithArgs("test@example.com").
-		WillReturnError(sql.ErrNoRows)
+	_, err = service.Authenticate(ctx, "test@example.com", "wrongpassword")
+	assert.Equal(t, user.ErrInvalidCredentials, err)
 
-	_, err = service.Authenticate(context.Background(), "test@example.com", "wrongpassword")
+	_, err = service.Authenticate(ctx, "unknown@example.com", "password123")
 	assert.Error(t, err)
 	assert.Equal(t, "invalid credentials", err.Error())
 }
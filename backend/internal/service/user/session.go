@@ -0,0 +1,232 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/logging"
+	"vws-backend/internal/tracing"
+)
+
+const (
+	RoleUser  = "USER"
+	RoleAdmin = "ADMIN"
+)
+
+// Reasons recorded when a session is revoked
+const (
+	RevokeReasonRevoked       = "REVOKED"
+	RevokeReasonReuseDetected = "REUSE_DETECTED"
+)
+
+var (
+	ErrInvalidRefreshToken = apperr.New(apperr.ErrUnauthorized, "invalid_refresh_token", "invalid refresh token")
+	ErrRefreshTokenExpired = apperr.New(apperr.ErrUnauthorized, "refresh_token_expired", "refresh token has expired")
+	ErrRefreshTokenReused  = apperr.New(apperr.ErrUnauthorized, "refresh_token_reused", "refresh token reuse detected")
+	ErrSessionRevoked      = apperr.New(apperr.ErrUnauthorized, "session_revoked", "session has been revoked")
+	ErrInvalidRole         = apperr.New(apperr.ErrInvalid, "invalid_role", "role must be USER or ADMIN")
+	ErrSessionNotFound     = apperr.New(apperr.ErrNotFound, "session_not_found", "session not found")
+)
+
+// Session represents a login session backed by a chain of refresh tokens
+type Session struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	UserAgent    string     `json:"user_agent"`
+	IPAddress    string     `json:"ip_address"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	LastUsedAt   time.Time  `json:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// CreateSession starts a new session for the user and returns its first refresh token
+func (s *Service) CreateSession(ctx context.Context, userID int64, userAgent, ipAddress string, ttl time.Duration) (_ *Session, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "user.CreateSession")
+	defer tracing.End(span, &err)
+
+	refreshToken, tokenHash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		ExpiresAt:  now.Add(ttl),
+		LastUsedAt: now,
+		CreatedAt:  now,
+	}
+
+	err = s.repo.WithTx(ctx, func(repo Repository) error {
+		if err := repo.CreateSession(ctx, session); err != nil {
+			return err
+		}
+		return repo.CreateRefreshToken(ctx, &RefreshToken{
+			SessionID: session.ID,
+			TokenHash: tokenHash,
+			ExpiresAt: session.ExpiresAt,
+		})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one. Each refresh token
+// can be used once; presenting an already used token revokes the whole session.
+func (s *Service) RotateRefreshToken(ctx context.Context, refreshToken string, ttl time.Duration) (_ *Session, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "user.RotateRefreshToken")
+	defer tracing.End(span, &err)
+
+	var (
+		session  *Session
+		newToken string
+		reused   bool
+	)
+	err = s.repo.WithTx(ctx, func(repo Repository) error {
+		token, err := repo.GetRefreshToken(ctx, hashRefreshToken(refreshToken))
+		if err != nil {
+			return err
+		}
+		session = &Session{ID: token.SessionID, UserID: token.UserID}
+
+		if token.SessionRevokedAt != nil {
+			return ErrSessionRevoked
+		}
+
+		now := time.Now()
+		if token.UsedAt != nil {
+			// A rotated token was replayed, so the chain is compromised.
+			// The revocation has to commit, so this is not an error here.
+			reused = true
+			return repo.RevokeSession(ctx, session.UserID, session.ID, RevokeReasonReuseDetected, now)
+		}
+
+		if now.After(token.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		var newHash string
+		newToken, newHash, err = newRefreshToken()
+		if err != nil {
+			return err
+		}
+		session.ExpiresAt = now.Add(ttl)
+		session.LastUsedAt = now
+
+		if err := repo.MarkRefreshTokenUsed(ctx, token.ID, now); err != nil {
+			return err
+		}
+		err = repo.CreateRefreshToken(ctx, &RefreshToken{
+			SessionID: session.ID,
+			TokenHash: newHash,
+			ExpiresAt: session.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		return repo.TouchSession(ctx, session.ID, session.ExpiresAt, session.LastUsedAt)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if reused {
+		logging.FromContext(ctx).Warn("refresh token reuse detected, session revoked",
+			"session_id", session.ID, "user_id", session.UserID)
+		return nil, "", ErrRefreshTokenReused
+	}
+	return session, newToken, nil
+}
+
+// GetSession retrieves a session by ID
+func (s *Service) GetSession(ctx context.Context, sessionID int64) (_ *Session, err error) {
+	ctx, span := tracing.Start(ctx, "user.GetSession")
+	defer tracing.End(span, &err)
+
+	return s.repo.GetSession(ctx, sessionID)
+}
+
+// ListSessions returns the active sessions of a user
+func (s *Service) ListSessions(ctx context.Context, userID int64) (_ []*Session, err error) {
+	ctx, span := tracing.Start(ctx, "user.ListSessions")
+	defer tracing.End(span, &err)
+
+	return s.repo.ListActiveSessions(ctx, userID, time.Now())
+}
+
+// RevokeSession revokes a single session of a user
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "user.RevokeSession")
+	defer tracing.End(span, &err)
+
+	return s.repo.RevokeSession(ctx, userID, sessionID, RevokeReasonRevoked, time.Now())
+}
+
+// RevokeAllSessions revokes every active session of a user
+func (s *Service) RevokeAllSessions(ctx context.Context, userID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "user.RevokeAllSessions")
+	defer tracing.End(span, &err)
+
+	return s.repo.RevokeAllSessions(ctx, userID, RevokeReasonRevoked, time.Now())
+}
+
+// IsSessionActive reports whether a session exists and has neither expired nor been revoked
+func (s *Service) IsSessionActive(ctx context.Context, sessionID int64) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "user.IsSessionActive")
+	defer tracing.End(span, &err)
+
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err == ErrSessionNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return session.RevokedAt == nil && time.Now().Before(session.ExpiresAt), nil
+}
+
+// GetRole returns the platform role of a user
+func (s *Service) GetRole(ctx context.Context, userID int64) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "user.GetRole")
+	defer tracing.End(span, &err)
+
+	return s.repo.GetRole(ctx, userID)
+}
+
+// SetRole changes the platform role of a user
+func (s *Service) SetRole(ctx context.Context, userID int64, role string) (err error) {
+	ctx, span := tracing.Start(ctx, "user.SetRole")
+	defer tracing.End(span, &err)
+
+	if role != RoleUser && role != RoleAdmin {
+		return ErrInvalidRole
+	}
+	return s.repo.SetRole(ctx, userID, role, time.Now())
+}
+
+// newRefreshToken generates a random refresh token and its storage hash
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,159 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/user"
+)
+
+// newTestSession signs up a user and starts a session for them
+func newTestSession(t *testing.T, service *user.Service, ttl time.Duration) (*user.Session, string) {
+	t.Helper()
+
+	ctx := context.Background()
+	u, err := service.CreateUser(ctx, "testuser", "test@example.com", "password123")
+	require.NoError(t, err)
+	session, token, err := service.CreateSession(ctx, u.ID, "test-agent", "127.0.0.1", ttl)
+	require.NoError(t, err)
+	return session, token
+}
+
+func TestCreateSession(t *testing.T) {
+	service := newTestService(t)
+
+	session, token := newTestSession(t, service, time.Hour)
+	assert.NotZero(t, session.ID)
+	assert.NotEmpty(t, token)
+
+	got, err := service.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "test-agent", got.UserAgent)
+	assert.Equal(t, "127.0.0.1", got.IPAddress)
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	service := newTestService(t)
+	created, token := newTestSession(t, service, time.Hour)
+
+	session, newToken, err := service.RotateRefreshToken(context.Background(), token, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, session.ID)
+	assert.Equal(t, created.UserID, session.UserID)
+	assert.NotEqual(t, token, newToken)
+
+	_, _, err = service.RotateRefreshToken(context.Background(), newToken, time.Hour)
+	assert.NoError(t, err, "the new token rotates in turn")
+}
+
+func TestRotateRefreshToken_ReuseRevokesSession(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
+	created, token := newTestSession(t, service, time.Hour)
+
+	_, newToken, err := service.RotateRefreshToken(ctx, token, time.Hour)
+	require.NoError(t, err)
+
+	_, _, err = service.RotateRefreshToken(ctx, token, time.Hour)
+	assert.Equal(t, user.ErrRefreshTokenReused, err)
+
+	session, err := service.GetSession(ctx, created.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, session.RevokedAt, "the revocation is kept")
+	assert.Equal(t, user.RevokeReasonReuseDetected, session.RevokeReason)
+
+	_, _, err = service.RotateRefreshToken(ctx, newToken, time.Hour)
+	assert.Equal(t, user.ErrSessionRevoked, err, "the whole chain is revoked")
+}
+
+func TestRotateRefreshToken_RevokedSession(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
+	created, token := newTestSession(t, service, time.Hour)
+
+	require.NoError(t, service.RevokeSession(ctx, created.UserID, created.ID))
+
+	_, _, err := service.RotateRefreshToken(ctx, token, time.Hour)
+	assert.Equal(t, user.ErrSessionRevoked, err)
+}
+
+func TestRotateRefreshToken_Expired(t *testing.T) {
+	service := newTestService(t)
+	_, token := newTestSession(t, service, -time.Minute)
+
+	_, _, err := service.RotateRefreshToken(context.Background(), token, time.Hour)
+	assert.Equal(t, user.ErrRefreshTokenExpired, err)
+}
+
+func TestRotateRefreshToken_Unknown(t *testing.T) {
+	service := newTestService(t)
+
+	_, _, err := service.RotateRefreshToken(context.Background(), "unknown", time.Hour)
+	assert.Equal(t, user.ErrInvalidRefreshToken, err)
+}
+
+func TestRevokeSession_NotFound(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
+	created, _ := newTestSession(t, service, time.Hour)
+
+	err := service.RevokeSession(ctx, created.UserID, created.ID+1)
+	assert.Equal(t, user.ErrSessionNotFound, err)
+
+	err = service.RevokeSession(ctx, created.UserID+1, created.ID)
+	assert.Equal(t, user.ErrSessionNotFound, err, "users can only revoke their own sessions")
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
+	created, _ := newTestSession(t, service, time.Hour)
+	_, _, err := service.CreateSession(ctx, created.UserID, "other-agent", "127.0.0.2", time.Hour)
+	require.NoError(t, err)
+
+	sessions, err := service.ListSessions(ctx, created.UserID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	require.NoError(t, service.RevokeAllSessions(ctx, created.UserID))
+	sessions, err = service.ListSessions(ctx, created.UserID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestIsSessionActive(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
+	created, _ := newTestSession(t, service, time.Hour)
+
+	active, err := service.IsSessionActive(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.True(t, active)
+
+	require.NoError(t, service.RevokeSession(ctx, created.UserID, created.ID))
+	active, err = service.IsSessionActive(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.False(t, active)
+
+	active, err = service.IsSessionActive(ctx, created.ID+1)
+	assert.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestSetRole(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
+	created, _ := newTestSession(t, service, time.Hour)
+
+	require.NoError(t, service.SetRole(ctx, created.UserID, user.RoleAdmin))
+	role, err := service.GetRole(ctx, created.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleAdmin, role)
+
+	assert.Equal(t, user.ErrInvalidRole, service.SetRole(ctx, created.UserID, "ROOT"))
+	assert.Equal(t, user.ErrUserNotFound, service.SetRole(ctx, created.UserID+1, user.RoleAdmin))
+}
@@ -0,0 +1,16 @@
+package verification
+
+import "context"
+
+// Repository stores issued certificates
+type Repository interface {
+	// CreateCertificate stores cert, returning ErrCertificateExists if the
+	// user already holds one for the election
+	CreateCertificate(ctx context.Context, cert *Certificate) error
+	GetCertificate(ctx context.Context, id string) (*Certificate, error)
+	// ReplaceCertificate swaps the certificate oldID for cert in one step,
+	// returning ErrCertificateNotFound if there is no such certificate
+	ReplaceCertificate(ctx context.Context, oldID string, cert *Certificate) error
+	// ListCertificates returns a user's certificates, newest first
+	ListCertificates(ctx context.Context, userID int64) ([]*Certificate, error)
+}
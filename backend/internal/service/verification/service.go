@@ -3,13 +3,24 @@ package verification
 import (
 	"context"
 	"crypto/sha256"
-	"database/sql"
 	"encoding/hex"
-	"errors"
+	"math/big"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/ethrpc"
+	"vws-backend/internal/metrics"
+	"vws-backend/internal/tracing"
+)
+
+var (
+	ErrCertificateExists   = apperr.New(apperr.ErrConflict, "certificate_exists", "verification already exists")
+	ErrCertificateNotFound = apperr.New(apperr.ErrNotFound, "certificate_not_found", "certificate not found")
 )
 
 type Certificate struct {
@@ -22,105 +33,97 @@ type Certificate struct {
 }
 
 type Service struct {
-	db          *sql.DB
+	repo        Repository
 	ethClient   *ethclient.Client
 	contractAdr common.Address
 }
 
-func NewService(db *sql.DB, ethURL string, contractAddress string) (*Service, error) {
-	client, err := ethclient.Dial(ethURL)
+func NewService(repo Repository, ethURL string, contractAddress string) (*Service, error) {
+	// Calls over HTTP are instrumented; the option is ignored for websockets and IPC
+	rpcClient, err := rpc.DialOptions(context.Background(), ethURL,
+		rpc.WithHTTPClient(ethrpc.NewHTTPClient()))
 	if err != nil {
 		return nil, err
 	}
 
 	return &Service{
-		db:          db,
-		ethClient:   client,
+		repo:        repo,
+		ethClient:   ethclient.NewClient(rpcClient),
 		contractAdr: common.HexToAddress(contractAddress),
 	}, nil
 }
 
 // VerifyVoteParticipation verifies a user's vote participation and generates a certificate
-func (s *Service) VerifyVoteParticipation(ctx context.Context, userID int64, electionID string, proofData []byte) (*Certificate, error) {
-	// Generate hash of the proof data
-	hash := sha256.Sum256(proofData)
-	hashStr := hex.EncodeToString(hash[:])
+func (s *Service) VerifyVoteParticipation(ctx context.Context, userID int64, electionID string, proofData []byte) (_ *Certificate, err error) {
+	ctx, span := tracing.Start(ctx, "verification.VerifyVoteParticipation")
+	defer tracing.End(span, &err)
+
+	cert := newCertificate(userID, electionID, proofData)
+	if err := s.repo.CreateCertificate(ctx, cert); err != nil {
+		return nil, err
+	}
+
+	metrics.CertificatesIssued.Inc()
+	return cert, nil
+}
 
-	// Check if verification already exists
-	var exists bool
-	err := s.db.QueryRowContext(ctx,
-		"SELECT EXISTS(SELECT 1 FROM certificates WHERE user_id = $1 AND election_id = $2)",
-		userID, electionID).Scan(&exists)
+// ReissueCertificate replaces a certificate with one for the same user and
+// election built from new proof data, for when the original proof was
+// wrong or its certificate has to be invalidated
+func (s *Service) ReissueCertificate(ctx context.Context, id string, proofData []byte) (_ *Certificate, err error) {
+	ctx, span := tracing.Start(ctx, "verification.ReissueCertificate")
+	defer tracing.End(span, &err)
+
+	old, err := s.repo.GetCertificate(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	if exists {
-		return nil, errors.New("verification already exists")
+
+	cert := newCertificate(old.UserID, old.ElectionID, proofData)
+	if err := s.repo.ReplaceCertificate(ctx, id, cert); err != nil {
+		return nil, err
 	}
 
-	// Store verification record
-	cert := &Certificate{
+	metrics.CertificatesIssued.Inc()
+	return cert, nil
+}
+
+// newCertificate builds a certificate identified by the hash of its proof
+func newCertificate(userID int64, electionID string, proofData []byte) *Certificate {
+	hash := sha256.Sum256(proofData)
+	hashStr := hex.EncodeToString(hash[:])
+
+	return &Certificate{
 		ID:         hashStr[:8],
 		UserID:     userID,
 		ElectionID: electionID,
 		Hash:       hashStr,
 		CreatedAt:  time.Now(),
 	}
-
-	// Insert into database
-	_, err = s.db.ExecContext(ctx,
-		`INSERT INTO certificates (id, user_id, election_id, hash, blockchain_txn, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)`,
-		cert.ID, cert.UserID, cert.ElectionID, cert.Hash, cert.BlockchainTxn, cert.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-
-	return cert, nil
 }
 
 // GetCertificate retrieves a certificate by ID
-func (s *Service) GetCertificate(ctx context.Context, id string) (*Certificate, error) {
-	cert := &Certificate{}
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, user_id, election_id, hash, blockchain_txn, created_at
-		FROM certificates WHERE id = $1`,
-		id).Scan(&cert.ID, &cert.UserID, &cert.ElectionID, &cert.Hash,
-		&cert.BlockchainTxn, &cert.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return cert, nil
+func (s *Service) GetCertificate(ctx context.Context, id string) (_ *Certificate, err error) {
+	ctx, span := tracing.Start(ctx, "verification.GetCertificate")
+	defer tracing.End(span, &err)
+
+	return s.repo.GetCertificate(ctx, id)
 }
 
 // GetUserCertificates retrieves all certificates for a user
-func (s *Service) GetUserCertificates(ctx context.Context, userID int64) ([]*Certificate, error) {
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, user_id, election_id, hash, blockchain_txn, created_at
-		FROM certificates WHERE user_id = $1
-		ORDER BY created_at DESC`,
-		userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var certs []*Certificate
-	for rows.Next() {
-		cert := &Certificate{}
-		err := rows.Scan(&cert.ID, &cert.UserID, &cert.ElectionID, &cert.Hash,
-			&cert.BlockchainTxn, &cert.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		certs = append(certs, cert)
-	}
-	return certs, nil
+func (s *Service) GetUserCertificates(ctx context.Context, userID int64) (_ []*Certificate, err error) {
+	ctx, span := tracing.Start(ctx, "verification.GetUserCertificates")
+	defer tracing.End(span, &err)
+
+	return s.repo.ListCertificates(ctx, userID)
 }
 
 // VerifyCertificate verifies a certificate's authenticity on the blockchain
-func (s *Service) VerifyCertificate(ctx context.Context, id string) (bool, error) {
-	_, err := s.GetCertificate(ctx, id)
+func (s *Service) VerifyCertificate(ctx context.Context, id string) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "verification.VerifyCertificate")
+	defer tracing.End(span, &err)
+
+	_, err = s.GetCertificate(ctx, id)
 	if err != nil {
 		return false, err
 	}
@@ -134,6 +137,17 @@ func (s *Service) VerifyCertificate(ctx context.Context, id string) (bool, error
 	return true, nil
 }
 
+// ChainID returns the chain ID reported by the Ethereum node
+func (s *Service) ChainID(ctx context.Context) (*big.Int, error) {
+	return s.ethClient.ChainID(ctx)
+}
+
+// HeaderByNumber returns a block header from the Ethereum node, the latest
+// one if number is nil
+func (s *Service) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return s.ethClient.HeaderByNumber(ctx, number)
+}
+
 // Close closes the service connections
 func (s *Service) Close() error {
 	s.ethClient.Close()
@@ -1,212 +1,159 @@
-package verification
+package verification_test
 
 import (
 	"context"
-	"database/sql"
 	"testing"
-	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+
+	"vws-backend/internal/service/verification"
+	"vws-backend/internal/store/memory"
+	"vws-backend/internal/tracing/tracingtest"
 )
 
-func TestVerifyVoteParticipation(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
+func newTestService(t *testing.T) *verification.Service {
+	t.Helper()
 
-	service, err := NewService(db, "http://localhost:8545", "0x0000000000000000000000000000000000000000")
-	assert.NoError(t, err)
-	defer service.Close()
+	service, err := verification.NewService(memory.New().Verification(),
+		"http://localhost:8545", "0x0000000000000000000000000000000000000000")
+	require.NoError(t, err)
+	t.Cleanup(func() { service.Close() })
+	return service
+}
+
+func TestVerifyVoteParticipation(t *testing.T) {
+	service := newTestService(t)
 
 	// Test data
 	userID := int64(1)
 	electionID := "election123"
 	proofData := []byte("test proof data")
 
-	// Mock the existence check
-	mock.ExpectQuery("SELECT EXISTS").
-		WithArgs(userID, electionID).
-		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
-
-	// Mock the insert
-	mock.ExpectExec("INSERT INTO certificates").
-		WithArgs(
-			sqlmock.AnyArg(), // id
-			userID,
-			electionID,
-			sqlmock.AnyArg(), // hash
-			sqlmock.AnyArg(), // blockchain_txn
-			sqlmock.AnyArg(), // created_at
-		).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
 	// Test the verification
 	cert, err := service.VerifyVoteParticipation(context.Background(), userID, electionID, proofData)
 	assert.NoError(t, err)
 	assert.NotNil(t, cert)
 	assert.Equal(t, userID, cert.UserID)
 	assert.Equal(t, electionID, cert.ElectionID)
+	assert.Len(t, cert.Hash, 64)
+	assert.Equal(t, cert.Hash[:8], cert.ID)
 }
 
 func TestGetCertificate(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
-
-	service, err := NewService(db, "http://localhost:8545", "0x0000000000000000000000000000000000000000")
-	assert.NoError(t, err)
-	defer service.Close()
-
-	// Test data
-	now := time.Now()
-	certID := "cert123"
-	userID := int64(1)
-	electionID := "election123"
-	hash := "testhash"
-	blockchainTxn := "0xtxn"
+	service := newTestService(t)
+	ctx := context.Background()
 
-	rows := sqlmock.NewRows([]string{
-		"id", "user_id", "election_id", "hash", "blockchain_txn", "created_at",
-	}).AddRow(
-		certID, userID, electionID, hash, blockchainTxn, now,
-	)
-
-	mock.ExpectQuery("SELECT (.+) FROM certificates WHERE id").
-		WithArgs(certID).
-		WillReturnRows(rows)
+	issued, err := service.VerifyVoteParticipation(ctx, 1, "election123", []byte("test proof data"))
+	require.NoError(t, err)
 
 	// Test getting the certificate
-	cert, err := service.GetCertificate(context.Background(), certID)
+	cert, err := service.GetCertificate(ctx, issued.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, cert)
-	assert.Equal(t, certID, cert.ID)
-	assert.Equal(t, userID, cert.UserID)
-	assert.Equal(t, electionID, cert.ElectionID)
-	assert.Equal(t, hash, cert.Hash)
-	assert.Equal(t, blockchainTxn, cert.BlockchainTxn)
+	assert.Equal(t, issued.ID, cert.ID)
+	assert.Equal(t, int64(1), cert.UserID)
+	assert.Equal(t, "election123", cert.ElectionID)
+	assert.Equal(t, issued.Hash, cert.Hash)
 }
 
 func TestGetUserCertificates(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
+	service := newTestService(t)
+	ctx := context.Background()
 
-	service, err := NewService(db, "http://localhost:8545", "0x0000000000000000000000000000000000000000")
-	assert.NoError(t, err)
-	defer service.Close()
-
-	// Test data
-	now := time.Now()
-	userID := int64(1)
-
-	rows := sqlmock.NewRows([]string{
-		"id", "user_id", "election_id", "hash", "blockchain_txn", "created_at",
-	}).AddRow(
-		"cert1", userID, "election1", "hash1", "0xtxn1", now,
-	).AddRow(
-		"cert2", userID, "election2", "hash2", "0xtxn2", now,
-	)
-
-	mock.ExpectQuery("SELECT (.+) FROM certificates WHERE user_id").
-		WithArgs(userID).
-		WillReturnRows(rows)
+	_, err := service.VerifyVoteParticipation(ctx, 1, "election1", []byte("proof1"))
+	require.NoError(t, err)
+	_, err = service.VerifyVoteParticipation(ctx, 1, "election2", []byte("proof2"))
+	require.NoError(t, err)
+	_, err = service.VerifyVoteParticipation(ctx, 2, "election1", []byte("proof3"))
+	require.NoError(t, err)
 
 	// Test getting user certificates
-	certs, err := service.GetUserCertificates(context.Background(), userID)
+	certs, err := service.GetUserCertificates(ctx, 1)
 	assert.NoError(t, err)
 	assert.Len(t, certs, 2)
-	assert.Equal(t, "cert1", certs[0].ID)
-	assert.Equal(t, "cert2", certs[1].ID)
+	for _, cert := range certs {
+		assert.Equal(t, int64(1), cert.UserID)
+	}
 }
 
 func TestVerifyCertificate(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
+	service := newTestService(t)
+	ctx := context.Background()
 
-	service, err := NewService(db, "http://localhost:8545", "0x0000000000000000000000000000000000000000")
-	assert.NoError(t, err)
-	defer service.Close()
-
-	// Test data
-	now := time.Now()
-	certID := "cert123"
-	userID := int64(1)
-	electionID := "election123"
-	hash := "testhash"
-	blockchainTxn := "0xtxn"
-
-	rows := sqlmock.NewRows([]string{
-		"id", "user_id", "election_id", "hash", "blockchain_txn", "created_at",
-	}).AddRow(
-		certID, userID, electionID, hash, blockchainTxn, now,
-	)
-
-	mock.ExpectQuery("SELECT (.+) FROM certificates WHERE id").
-		WithArgs(certID).
-		WillReturnRows(rows)
+	issued, err := service.VerifyVoteParticipation(ctx, 1, "election123", []byte("test proof data"))
+	require.NoError(t, err)
 
 	// Test verifying the certificate
-	isValid, err := service.VerifyCertificate(context.Background(), certID)
+	isValid, err := service.VerifyCertificate(ctx, issued.ID)
 	assert.NoError(t, err)
 	assert.True(t, isValid)
+
+	isValid, err = service.VerifyCertificate(ctx, "nonexistent")
+	assert.Equal(t, verification.ErrCertificateNotFound, err)
+	assert.False(t, isValid)
 }
 
 func TestVerifyVoteParticipation_AlreadyExists(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
+	service := newTestService(t)
+	ctx := context.Background()
 
-	service, err := NewService(db, "http://localhost:8545", "0x0000000000000000000000000000000000000000")
-	assert.NoError(t, err)
-	defer service.Close()
-
-	// Test data
-	userID := int64(1)
-	electionID := "election123"
-	proofData := []byte("test proof data")
-
-	// Mock the existence check to return true
-	mock.ExpectQuery("SELECT EXISTS").
-		WithArgs(userID, electionID).
-		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	_, err := service.VerifyVoteParticipation(ctx, 1, "election123", []byte("test proof data"))
+	require.NoError(t, err)
 
 	// Test the verification
-	cert, err := service.VerifyVoteParticipation(context.Background(), userID, electionID, proofData)
+	cert, err := service.VerifyVoteParticipation(ctx, 1, "election123", []byte("other proof data"))
 	assert.Error(t, err)
 	assert.Nil(t, cert)
+	assert.Equal(t, verification.ErrCertificateExists, err)
 	assert.Equal(t, "verification already exists", err.Error())
 }
 
 func TestGetCertificate_NotFound(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock: %v", err)
-	}
-	defer db.Close()
+	service := newTestService(t)
 
-	service, err := NewService(db, "http://localhost:8545", "0x0000000000000000000000000000000000000000")
-	assert.NoError(t, err)
-	defer service.Close()
+	cert, err := service.GetCertificate(context.Background(), "nonexistent")
+	assert.Error(t, err)
+	assert.Nil(t, cert)
+	assert.Equal(t, verification.ErrCertificateNotFound, err)
+}
 
-	certID := "nonexistent"
-	mock.ExpectQuery("SELECT (.+) FROM certificates WHERE id").
-		WithArgs(certID).
-		WillReturnError(sql.ErrNoRows)
+func TestVerifyVoteParticipation_RecordsSpan(t *testing.T) {
+	spans := tracingtest.Install(t)
+	service := newTestService(t)
+	ctx := context.Background()
 
-	cert, err := service.GetCertificate(context.Background(), certID)
+	_, err := service.VerifyVoteParticipation(ctx, 1, "election123", []byte("proof"))
+	require.NoError(t, err)
+	spans.Reset()
+
+	_, err = service.VerifyVoteParticipation(ctx, 1, "election123", []byte("proof"))
 	assert.Error(t, err)
-	assert.Nil(t, cert)
-	assert.Equal(t, sql.ErrNoRows, err)
+
+	recorded := spans.GetSpans()
+	if assert.Len(t, recorded, 1) {
+		assert.Equal(t, "verification.VerifyVoteParticipation", recorded[0].Name)
+		assert.Equal(t, codes.Error, recorded[0].Status.Code)
+	}
+}
+
+func TestReissueCertificate(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
+
+	issued, err := service.VerifyVoteParticipation(ctx, 1, "election123", []byte("wrong proof"))
+	require.NoError(t, err)
+
+	cert, err := service.ReissueCertificate(ctx, issued.ID, []byte("corrected proof"))
+	require.NoError(t, err)
+	assert.NotEqual(t, issued.ID, cert.ID)
+	assert.Equal(t, issued.UserID, cert.UserID)
+	assert.Equal(t, issued.ElectionID, cert.ElectionID)
+
+	_, err = service.GetCertificate(ctx, issued.ID)
+	assert.Equal(t, verification.ErrCertificateNotFound, err, "the old certificate is gone")
+
+	_, err = service.ReissueCertificate(ctx, "nonexistent", []byte("proof"))
+	assert.Equal(t, verification.ErrCertificateNotFound, err)
 }
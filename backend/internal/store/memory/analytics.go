@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"vws-backend/internal/service/analytics"
+	"vws-backend/internal/service/token"
+)
+
+type analyticsRepo struct {
+	conn
+}
+
+func (r *analyticsRepo) WithTx(ctx context.Context, fn func(analytics.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&analyticsRepo{c})
+	})
+}
+
+// within reports whether t falls in the period
+func within(period analytics.Period, t time.Time) bool {
+	return !t.Before(period.From) && t.Before(period.To)
+}
+
+func day(t time.Time) string {
+	return t.UTC().Format(analytics.DayFormat)
+}
+
+func (r *analyticsRepo) CreateActivity(ctx context.Context, activity *analytics.Activity) error {
+	defer r.lock()()
+
+	activity.ID = r.nextID()
+	row := *activity
+	row.Metadata = maps.Clone(activity.Metadata)
+	r.db.activities[activity.ID] = row
+	return nil
+}
+
+func (r *analyticsRepo) CountUsers(ctx context.Context, period analytics.Period) (int, error) {
+	defer r.lock()()
+
+	n := 0
+	for _, row := range r.db.users {
+		if within(period, row.CreatedAt) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// activeUsers returns the set of users active during the period; the
+// lock must be held
+func (r *analyticsRepo) activeUsers(period analytics.Period) map[int64]bool {
+	active := make(map[int64]bool)
+	for _, activity := range r.db.activities {
+		if within(period, activity.CreatedAt) {
+			active[activity.UserID] = true
+		}
+	}
+	return active
+}
+
+func (r *analyticsRepo) CountActiveUsers(ctx context.Context, period analytics.Period) (int, error) {
+	defer r.lock()()
+
+	return len(r.activeUsers(period)), nil
+}
+
+func (r *analyticsRepo) CountRetainedUsers(ctx context.Context, first, second analytics.Period) (int, error) {
+	defer r.lock()()
+
+	before := r.activeUsers(first)
+	n := 0
+	for userID := range r.activeUsers(second) {
+		if before[userID] {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *analyticsRepo) CountActivities(ctx context.Context, filter analytics.ActivityFilter, period analytics.Period) (int, error) {
+	defer r.lock()()
+
+	n := 0
+	for _, activity := range r.db.activities {
+		switch {
+		case !within(period, activity.CreatedAt):
+		case filter.UserID != 0 && activity.UserID != filter.UserID:
+		case filter.Type != "" && activity.Type != filter.Type:
+		case filter.Successful && activity.Metadata["success"] != true:
+		default:
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *analyticsRepo) ActivityCounts(ctx context.Context, period analytics.Period) (map[string]int, error) {
+	defer r.lock()()
+
+	counts := make(map[string]int)
+	for _, activity := range r.db.activities {
+		if within(period, activity.CreatedAt) {
+			counts[activity.Type]++
+		}
+	}
+	return counts, nil
+}
+
+func (r *analyticsRepo) DailyActiveUsers(ctx context.Context, period analytics.Period) (map[string]int, error) {
+	defer r.lock()()
+
+	seen := make(map[string]map[int64]bool)
+	for _, activity := range r.db.activities {
+		if !within(period, activity.CreatedAt) {
+			continue
+		}
+		d := day(activity.CreatedAt)
+		if seen[d] == nil {
+			seen[d] = make(map[int64]bool)
+		}
+		seen[d][activity.UserID] = true
+	}
+
+	counts := make(map[string]int, len(seen))
+	for d, users := range seen {
+		counts[d] = len(users)
+	}
+	return counts, nil
+}
+
+func (r *analyticsRepo) DailyNewUsers(ctx context.Context, period analytics.Period) (map[string]int, error) {
+	defer r.lock()()
+
+	counts := make(map[string]int)
+	for _, row := range r.db.users {
+		if within(period, row.CreatedAt) {
+			counts[day(row.CreatedAt)]++
+		}
+	}
+	return counts, nil
+}
+
+func (r *analyticsRepo) TokenVolume(ctx context.Context, period analytics.Period) (analytics.TokenVolume, error) {
+	defer r.lock()()
+
+	var volume analytics.TokenVolume
+	users := make(map[int64]bool)
+	for _, txn := range r.db.transactions {
+		if !within(period, txn.CreatedAt) {
+			continue
+		}
+		volume.Total += txn.Amount
+		if txn.Type == token.TypeStake {
+			volume.Staked += txn.Amount
+		}
+		volume.Transactions++
+		users[txn.UserID] = true
+	}
+	volume.Users = len(users)
+	return volume, nil
+}
+
+func (r *analyticsRepo) DailyTokenVolume(ctx context.Context, period analytics.Period) (map[string]float64, error) {
+	defer r.lock()()
+
+	volume := make(map[string]float64)
+	for _, txn := range r.db.transactions {
+		if within(period, txn.CreatedAt) {
+			volume[day(txn.CreatedAt)] += txn.Amount
+		}
+	}
+	return volume, nil
+}
+
+func (r *analyticsRepo) CreateDailyMetric(ctx context.Context, metric *analytics.DailyMetric) error {
+	defer r.lock()()
+
+	metric.ID = r.nextID()
+	r.db.dailyMetrics[metric.ID] = *metric
+	return nil
+}
+
+func (r *analyticsRepo) CreateEngagement(ctx context.Context, engagement *analytics.UserEngagement) error {
+	defer r.lock()()
+
+	engagement.ID = r.nextID()
+	r.db.engagement[engagement.ID] = *engagement
+	return nil
+}
+
+func (r *analyticsRepo) CreateReport(ctx context.Context, report *analytics.Report) error {
+	defer r.lock()()
+
+	report.ID = r.nextID()
+	r.db.reports[report.ID] = *report
+	return nil
+}
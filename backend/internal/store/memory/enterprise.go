@@ -0,0 +1,375 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"vws-backend/internal/service/enterprise"
+)
+
+// apiKeyRow keeps the hash of a key, never its plaintext
+type apiKeyRow struct {
+	enterprise.APIKey
+	KeyHash string
+}
+
+type enterpriseRepo struct {
+	conn
+}
+
+func (r *enterpriseRepo) WithTx(ctx context.Context, fn func(enterprise.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&enterpriseRepo{c})
+	})
+}
+
+// jsonOr copies raw, returning def for an empty document like the NOT NULL
+// JSONB columns of the Postgres schema
+func jsonOr(raw json.RawMessage, def string) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage(def)
+	}
+	return slices.Clone(raw)
+}
+
+func (r *enterpriseRepo) CreateOrganization(ctx context.Context, org *enterprise.Organization) error {
+	defer r.lock()()
+
+	org.ID = r.nextID()
+	row := *org
+	row.Settings = jsonOr(org.Settings, "{}")
+	r.db.organizations[org.ID] = row
+	return nil
+}
+
+func (r *enterpriseRepo) GetOrganization(ctx context.Context, id int64) (*enterprise.Organization, error) {
+	defer r.lock()()
+
+	org, ok := r.db.organizations[id]
+	if !ok {
+		return nil, enterprise.ErrOrganizationNotFound
+	}
+	return &org, nil
+}
+
+func (r *enterpriseRepo) UpdateOrganization(ctx context.Context, org *enterprise.Organization) error {
+	defer r.lock()()
+
+	row, ok := r.db.organizations[org.ID]
+	if !ok {
+		return enterprise.ErrOrganizationNotFound
+	}
+	row.Name = org.Name
+	row.Description = org.Description
+	row.ContactEmail = org.ContactEmail
+	row.Domain = org.Domain
+	row.LogoURL = org.LogoURL
+	row.WebsiteURL = org.WebsiteURL
+	row.Settings = jsonOr(org.Settings, "{}")
+	row.UpdatedAt = org.UpdatedAt
+	r.db.organizations[org.ID] = row
+	return nil
+}
+
+// member finds a membership; the lock must be held
+func (r *enterpriseRepo) member(orgID, userID int64) (enterprise.Member, bool) {
+	for _, member := range r.db.members {
+		if member.OrganizationID == orgID && member.UserID == userID {
+			return member, true
+		}
+	}
+	return enterprise.Member{}, false
+}
+
+func (r *enterpriseRepo) AddMember(ctx context.Context, member *enterprise.Member) error {
+	defer r.lock()()
+
+	if _, ok := r.member(member.OrganizationID, member.UserID); ok {
+		return enterprise.ErrMemberExists
+	}
+	member.ID = r.nextID()
+	row := *member
+	row.Permissions = jsonOr(member.Permissions, "{}")
+	r.db.members[member.ID] = row
+	return nil
+}
+
+func (r *enterpriseRepo) GetMember(ctx context.Context, orgID, userID int64) (*enterprise.Member, error) {
+	defer r.lock()()
+
+	member, ok := r.member(orgID, userID)
+	if !ok {
+		return nil, enterprise.ErrMemberNotFound
+	}
+	return &member, nil
+}
+
+func (r *enterpriseRepo) ListOwners(ctx context.Context, orgID int64) ([]int64, error) {
+	defer r.lock()()
+
+	var owners []int64
+	for _, member := range r.db.members {
+		if member.OrganizationID == orgID && member.Role == enterprise.RoleOwner {
+			owners = append(owners, member.UserID)
+		}
+	}
+	slices.Sort(owners)
+	return owners, nil
+}
+
+// updateMember applies fn to a membership; the lock must be held
+func (r *enterpriseRepo) updateMember(orgID, userID int64, fn func(*enterprise.Member)) error {
+	member, ok := r.member(orgID, userID)
+	if !ok {
+		return enterprise.ErrMemberNotFound
+	}
+	fn(&member)
+	r.db.members[member.ID] = member
+	return nil
+}
+
+func (r *enterpriseRepo) UpdateMemberRole(ctx context.Context, orgID, userID int64, role string, at time.Time) error {
+	defer r.lock()()
+
+	return r.updateMember(orgID, userID, func(member *enterprise.Member) {
+		member.Role = role
+		member.UpdatedAt = at
+	})
+}
+
+func (r *enterpriseRepo) UpdateMemberPermissions(ctx context.Context, orgID, userID int64, permissions json.RawMessage, at time.Time) error {
+	defer r.lock()()
+
+	return r.updateMember(orgID, userID, func(member *enterprise.Member) {
+		member.Permissions = jsonOr(permissions, "{}")
+		member.UpdatedAt = at
+	})
+}
+
+func (r *enterpriseRepo) CreateAPIKey(ctx context.Context, key *enterprise.APIKey, keyHash string) error {
+	defer r.lock()()
+
+	key.ID = r.nextID()
+	row := apiKeyRow{APIKey: *key, KeyHash: keyHash}
+	row.Key = ""
+	row.Scopes = slices.Clone(key.Scopes)
+	row.LastUsedAt = time.Time{}
+	r.db.apiKeys[key.ID] = row
+	return nil
+}
+
+func (r *enterpriseRepo) GetAPIKeyByHash(ctx context.Context, keyHash string) (*enterprise.APIKey, error) {
+	defer r.lock()()
+
+	for _, row := range r.db.apiKeys {
+		if row.KeyHash == keyHash {
+			key := row.APIKey
+			return &key, nil
+		}
+	}
+	return nil, enterprise.ErrInvalidAPIKey
+}
+
+func (r *enterpriseRepo) TouchAPIKey(ctx context.Context, keyID int64, at time.Time) error {
+	defer r.lock()()
+
+	row, ok := r.db.apiKeys[keyID]
+	if !ok {
+		return enterprise.ErrAPIKeyNotFound
+	}
+	row.LastUsedAt = at
+	r.db.apiKeys[keyID] = row
+	return nil
+}
+
+func (r *enterpriseRepo) ListAPIKeys(ctx context.Context, orgID int64) ([]*enterprise.APIKey, error) {
+	defer r.lock()()
+
+	var keys []*enterprise.APIKey
+	for _, row := range r.db.apiKeys {
+		if row.OrganizationID == orgID {
+			key := row.APIKey
+			keys = append(keys, &key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b *enterprise.APIKey) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return keys, nil
+}
+
+func (r *enterpriseRepo) DeleteAPIKey(ctx context.Context, orgID, keyID int64) error {
+	defer r.lock()()
+
+	row, ok := r.db.apiKeys[keyID]
+	if !ok || row.OrganizationID != orgID {
+		return enterprise.ErrAPIKeyNotFound
+	}
+	delete(r.db.apiKeys, keyID)
+	return nil
+}
+
+func (r *enterpriseRepo) CreateVotingSystem(ctx context.Context, vs *enterprise.VotingSystem) error {
+	defer r.lock()()
+
+	vs.ID = r.nextID()
+	row := *vs
+	row.Config = jsonOr(vs.Config, "{}")
+	r.db.votingSystems[vs.ID] = row
+	return nil
+}
+
+func (r *enterpriseRepo) GetVotingSystem(ctx context.Context, id int64) (*enterprise.VotingSystem, error) {
+	defer r.lock()()
+
+	vs, ok := r.db.votingSystems[id]
+	if !ok {
+		return nil, enterprise.ErrVotingSystemNotFound
+	}
+	return &vs, nil
+}
+
+func (r *enterpriseRepo) ListVotingSystems(ctx context.Context, orgID int64) ([]*enterprise.VotingSystem, error) {
+	defer r.lock()()
+
+	var systems []*enterprise.VotingSystem
+	for _, vs := range r.db.votingSystems {
+		if vs.OrganizationID == orgID {
+			systems = append(systems, &vs)
+		}
+	}
+	slices.SortFunc(systems, func(a, b *enterprise.VotingSystem) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return systems, nil
+}
+
+func (r *enterpriseRepo) CreateVote(ctx context.Context, vote *enterprise.Vote) error {
+	defer r.lock()()
+
+	vote.ID = r.nextID()
+	row := *vote
+	row.Options = jsonOr(vote.Options, "[]")
+	row.Result = nil
+	r.db.votes[vote.ID] = row
+	return nil
+}
+
+func (r *enterpriseRepo) GetVote(ctx context.Context, id int64) (*enterprise.Vote, error) {
+	defer r.lock()()
+
+	vote, ok := r.db.votes[id]
+	if !ok {
+		return nil, enterprise.ErrVoteNotFound
+	}
+	return &vote, nil
+}
+
+func (r *enterpriseRepo) GetVoteOrganization(ctx context.Context, voteID int64) (int64, error) {
+	defer r.lock()()
+
+	vote, ok := r.db.votes[voteID]
+	if !ok {
+		return 0, enterprise.ErrVoteNotFound
+	}
+	vs, ok := r.db.votingSystems[vote.VotingSystemID]
+	if !ok {
+		return 0, enterprise.ErrVoteNotFound
+	}
+	return vs.OrganizationID, nil
+}
+
+func (r *enterpriseRepo) SaveVoteResult(ctx context.Context, voteID int64, status string, result json.RawMessage, at time.Time) error {
+	defer r.lock()()
+
+	vote, ok := r.db.votes[voteID]
+	if !ok {
+		return enterprise.ErrVoteNotFound
+	}
+	vote.Status = status
+	vote.Result = slices.Clone(result)
+	vote.UpdatedAt = at
+	r.db.votes[voteID] = vote
+	return nil
+}
+
+func (r *enterpriseRepo) CreateVoteResponse(ctx context.Context, resp *enterprise.VoteResponse) error {
+	defer r.lock()()
+
+	for _, existing := range r.db.voteResponses {
+		if existing.VoteID == resp.VoteID && existing.UserID == resp.UserID {
+			return enterprise.ErrVoteAlreadySubmitted
+		}
+	}
+	resp.ID = r.nextID()
+	row := *resp
+	row.Response = slices.Clone(resp.Response)
+	r.db.voteResponses[resp.ID] = row
+	return nil
+}
+
+func (r *enterpriseRepo) ListVoteResponses(ctx context.Context, voteID int64) ([]*enterprise.VoteResponse, error) {
+	defer r.lock()()
+
+	var responses []*enterprise.VoteResponse
+	for _, resp := range r.db.voteResponses {
+		if resp.VoteID == voteID {
+			responses = append(responses, &resp)
+		}
+	}
+	slices.SortFunc(responses, func(a, b *enterprise.VoteResponse) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return responses, nil
+}
+
+func (r *enterpriseRepo) SaveWhiteLabelSettings(ctx context.Context, settings *enterprise.WhiteLabelSettings) error {
+	defer r.lock()()
+
+	existing, ok := r.db.whiteLabel[settings.OrganizationID]
+	if ok {
+		settings.ID = existing.ID
+		settings.CreatedAt = existing.CreatedAt
+	} else {
+		settings.ID = r.nextID()
+		settings.CreatedAt = settings.UpdatedAt
+	}
+	r.db.whiteLabel[settings.OrganizationID] = enterprise.WhiteLabelSettings{
+		ID:             settings.ID,
+		OrganizationID: settings.OrganizationID,
+		Domain:         settings.Domain,
+		ThemeConfig:    jsonOr(settings.ThemeConfig, "{}"),
+		CustomCSS:      settings.CustomCSS,
+		CustomJS:       settings.CustomJS,
+		Enabled:        settings.Enabled,
+		CreatedAt:      settings.CreatedAt,
+		UpdatedAt:      settings.UpdatedAt,
+	}
+	return nil
+}
+
+func (r *enterpriseRepo) GetWhiteLabelSettings(ctx context.Context, orgID int64) (*enterprise.WhiteLabelSettings, error) {
+	defer r.lock()()
+
+	settings, ok := r.db.whiteLabel[orgID]
+	if !ok {
+		return nil, nil
+	}
+	return &settings, nil
+}
+
+func (r *enterpriseRepo) ListWhiteLabelDomains(ctx context.Context) ([]string, error) {
+	defer r.lock()()
+
+	var domains []string
+	for _, settings := range r.db.whiteLabel {
+		if settings.Enabled && settings.Domain != "" {
+			domains = append(domains, strings.ToLower(settings.Domain))
+		}
+	}
+	return domains, nil
+}
@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"vws-backend/internal/service/face"
+)
+
+type faceRepo struct {
+	conn
+}
+
+func (r *faceRepo) WithTx(ctx context.Context, fn func(face.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&faceRepo{c})
+	})
+}
+
+func (r *faceRepo) CreateEmbedding(ctx context.Context, e *face.Embedding) error {
+	defer r.lock()()
+
+	if _, ok := r.db.embeddings[e.UserID]; ok {
+		return face.ErrAlreadyEnrolled
+	}
+	stored := *e
+	stored.Vector = slices.Clone(e.Vector)
+	r.db.embeddings[e.UserID] = stored
+	return nil
+}
+
+func (r *faceRepo) UpdateEmbedding(ctx context.Context, e *face.Embedding) error {
+	defer r.lock()()
+
+	stored, ok := r.db.embeddings[e.UserID]
+	if !ok {
+		return face.ErrNotEnrolled
+	}
+	stored.Vector = slices.Clone(e.Vector)
+	stored.UpdatedAt = e.UpdatedAt
+	r.db.embeddings[e.UserID] = stored
+	e.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+func (r *faceRepo) GetEmbedding(ctx context.Context, userID int64) (*face.Embedding, error) {
+	defer r.lock()()
+
+	stored, ok := r.db.embeddings[userID]
+	if !ok {
+		return nil, face.ErrNotEnrolled
+	}
+	stored.Vector = slices.Clone(stored.Vector)
+	return &stored, nil
+}
+
+func (r *faceRepo) DeleteEmbedding(ctx context.Context, userID int64) error {
+	defer r.lock()()
+
+	if _, ok := r.db.embeddings[userID]; !ok {
+		return face.ErrNotEnrolled
+	}
+	delete(r.db.embeddings, userID)
+	return nil
+}
+
+func (r *faceRepo) ListEmbeddings(ctx context.Context, afterUserID int64, limit int) ([]face.Embedding, error) {
+	defer r.lock()()
+
+	var embeddings []face.Embedding
+	for _, e := range r.db.embeddings {
+		if e.UserID > afterUserID {
+			e.Vector = slices.Clone(e.Vector)
+			embeddings = append(embeddings, e)
+		}
+	}
+	slices.SortFunc(embeddings, func(a, b face.Embedding) int {
+		return cmp.Compare(a.UserID, b.UserID)
+	})
+	return page(embeddings, limit, 0), nil
+}
+
+func (r *faceRepo) CreateDuplicate(ctx context.Context, d *face.Duplicate) error {
+	defer r.lock()()
+
+	for _, stored := range r.db.duplicates {
+		if (stored.UserID == d.UserID && stored.MatchedUserID == d.MatchedUserID) ||
+			(stored.UserID == d.MatchedUserID && stored.MatchedUserID == d.UserID) {
+			return face.ErrDuplicateFlagged
+		}
+	}
+	d.ID = r.nextID()
+	r.db.duplicates[d.ID] = *d
+	return nil
+}
+
+func (r *faceRepo) ListDuplicates(ctx context.Context, status string, limit, offset int) ([]*face.Duplicate, error) {
+	defer r.lock()()
+
+	var duplicates []*face.Duplicate
+	for _, d := range r.db.duplicates {
+		if status == "" || d.Status == status {
+			duplicates = append(duplicates, &d)
+		}
+	}
+	slices.SortFunc(duplicates, func(a, b *face.Duplicate) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return page(duplicates, limit, offset), nil
+}
+
+func (r *faceRepo) ReviewDuplicate(ctx context.Context, d *face.Duplicate) error {
+	defer r.lock()()
+
+	stored, ok := r.db.duplicates[d.ID]
+	if !ok {
+		return face.ErrDuplicateNotFound
+	}
+	stored.Status, stored.ReviewedBy, stored.ReviewedAt = d.Status, d.ReviewedBy, d.ReviewedAt
+	r.db.duplicates[d.ID] = stored
+	*d = stored
+	return nil
+}
+
+func (r *faceRepo) IsConfirmedDuplicate(ctx context.Context, userID int64) (bool, error) {
+	defer r.lock()()
+
+	for _, d := range r.db.duplicates {
+		if d.UserID == userID && d.Status == face.DuplicateConfirmed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *faceRepo) SaveChallenge(ctx context.Context, c *face.IssuedChallenge) error {
+	defer r.lock()()
+
+	r.db.challenges[c.UserID] = *c
+	return nil
+}
+
+func (r *faceRepo) TakeChallenge(ctx context.Context, userID int64, id string, now time.Time) (*face.IssuedChallenge, error) {
+	defer r.lock()()
+
+	stored, ok := r.db.challenges[userID]
+	if !ok || stored.ID != id {
+		return nil, face.ErrChallengeNotFound
+	}
+	delete(r.db.challenges, userID)
+	if !now.Before(stored.ExpiresAt) {
+		return nil, face.ErrChallengeNotFound
+	}
+	return &stored, nil
+}
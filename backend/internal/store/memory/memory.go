@@ -0,0 +1,197 @@
+// Package memory implements the service repositories in memory, for tests
+// and for running the server without PostgreSQL. Nothing is persisted.
+//
+// Transactions are serialized: one holds the store's lock from start to
+// end, so it never sees concurrent writes, and its changes are undone if
+// it fails. A repository handed to a transaction function must not be used
+// after the function returns.
+package memory
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	"vws-backend/internal/service/analytics"
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/service/face"
+	"vws-backend/internal/service/token"
+	"vws-backend/internal/service/user"
+	"vws-backend/internal/service/verification"
+)
+
+// Store hands out the repositories of every service, all sharing the same
+// data
+type Store struct {
+	db *db
+}
+
+// New creates an empty store
+func New() *Store {
+	return &Store{db: &db{tables: newTables()}}
+}
+
+// Users returns the user repository
+func (s *Store) Users() user.Repository {
+	return &userRepo{conn{db: s.db}}
+}
+
+// Tokens returns the token repository
+func (s *Store) Tokens() token.Repository {
+	return &tokenRepo{conn{db: s.db}}
+}
+
+// Verification returns the verification repository
+func (s *Store) Verification() verification.Repository {
+	return &verificationRepo{conn{db: s.db}}
+}
+
+// Faces returns the face enrollment repository
+func (s *Store) Faces() face.Repository {
+	return &faceRepo{conn{db: s.db}}
+}
+
+// Analytics returns the analytics repository
+func (s *Store) Analytics() analytics.Repository {
+	return &analyticsRepo{conn{db: s.db}}
+}
+
+// Enterprise returns the enterprise repository
+func (s *Store) Enterprise() enterprise.Repository {
+	return &enterpriseRepo{conn{db: s.db}}
+}
+
+type db struct {
+	mu     sync.Mutex
+	lastID int64 // Shared by all tables; like a sequence, not rolled back
+	tables
+}
+
+// tables hold rows by value, so cloning the maps snapshots the data
+type tables struct {
+	users         map[int64]userRow
+	sessions      map[int64]user.Session
+	refreshTokens map[int64]user.RefreshToken
+
+	accounts     map[int64]token.Token // By user ID
+	transactions map[int64]token.Transaction
+
+	certificates map[string]verification.Certificate
+
+	embeddings map[int64]face.Embedding // By user ID
+	duplicates map[int64]face.Duplicate
+	challenges map[int64]face.IssuedChallenge // By user ID
+
+	activities   map[int64]analytics.Activity
+	dailyMetrics map[int64]analytics.DailyMetric
+	engagement   map[int64]analytics.UserEngagement
+	reports      map[int64]analytics.Report
+
+	organizations map[int64]enterprise.Organization
+	members       map[int64]enterprise.Member
+	apiKeys       map[int64]apiKeyRow
+	votingSystems map[int64]enterprise.VotingSystem
+	votes         map[int64]enterprise.Vote
+	voteResponses map[int64]enterprise.VoteResponse
+	whiteLabel    map[int64]enterprise.WhiteLabelSettings // By organization ID
+}
+
+func newTables() tables {
+	return tables{
+		users:         make(map[int64]userRow),
+		sessions:      make(map[int64]user.Session),
+		refreshTokens: make(map[int64]user.RefreshToken),
+		accounts:      make(map[int64]token.Token),
+		transactions:  make(map[int64]token.Transaction),
+		certificates:  make(map[string]verification.Certificate),
+		embeddings:    make(map[int64]face.Embedding),
+		duplicates:    make(map[int64]face.Duplicate),
+		challenges:    make(map[int64]face.IssuedChallenge),
+		activities:    make(map[int64]analytics.Activity),
+		dailyMetrics:  make(map[int64]analytics.DailyMetric),
+		engagement:    make(map[int64]analytics.UserEngagement),
+		reports:       make(map[int64]analytics.Report),
+		organizations: make(map[int64]enterprise.Organization),
+		members:       make(map[int64]enterprise.Member),
+		apiKeys:       make(map[int64]apiKeyRow),
+		votingSystems: make(map[int64]enterprise.VotingSystem),
+		votes:         make(map[int64]enterprise.Vote),
+		voteResponses: make(map[int64]enterprise.VoteResponse),
+		whiteLabel:    make(map[int64]enterprise.WhiteLabelSettings),
+	}
+}
+
+func (t *tables) clone() tables {
+	return tables{
+		users:         maps.Clone(t.users),
+		sessions:      maps.Clone(t.sessions),
+		refreshTokens: maps.Clone(t.refreshTokens),
+		accounts:      maps.Clone(t.accounts),
+		transactions:  maps.Clone(t.transactions),
+		certificates:  maps.Clone(t.certificates),
+		embeddings:    maps.Clone(t.embeddings),
+		duplicates:    maps.Clone(t.duplicates),
+		challenges:    maps.Clone(t.challenges),
+		activities:    maps.Clone(t.activities),
+		dailyMetrics:  maps.Clone(t.dailyMetrics),
+		engagement:    maps.Clone(t.engagement),
+		reports:       maps.Clone(t.reports),
+		organizations: maps.Clone(t.organizations),
+		members:       maps.Clone(t.members),
+		apiKeys:       maps.Clone(t.apiKeys),
+		votingSystems: maps.Clone(t.votingSystems),
+		votes:         maps.Clone(t.votes),
+		voteResponses: maps.Clone(t.voteResponses),
+		whiteLabel:    maps.Clone(t.whiteLabel),
+	}
+}
+
+// conn is what every repository works on
+type conn struct {
+	db *db
+	tx bool // Whether the lock is already held by a transaction
+}
+
+// lock takes the store's lock for one operation, unless a transaction
+// holds it already, and returns the function releasing it
+func (c conn) lock() func() {
+	if c.tx {
+		return func() {}
+	}
+	c.db.mu.Lock()
+	return c.db.mu.Unlock
+}
+
+// withTx runs fn holding the store's lock, undoing its changes unless it
+// returns nil. Inside a transaction it just runs fn.
+func (c conn) withTx(ctx context.Context, fn func(conn) error) error {
+	if c.tx {
+		return fn(c)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	snapshot := c.db.tables.clone()
+	committed := false
+	defer func() {
+		if !committed {
+			c.db.tables = snapshot
+		}
+	}()
+
+	if err := fn(conn{db: c.db, tx: true}); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// nextID returns a new row ID; the lock must be held
+func (c conn) nextID() int64 {
+	c.db.lastID++
+	return c.db.lastID
+}
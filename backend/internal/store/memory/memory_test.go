@@ -0,0 +1,14 @@
+package memory_test
+
+import (
+	"testing"
+
+	"vws-backend/internal/store/memory"
+	"vws-backend/internal/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		return memory.New()
+	})
+}
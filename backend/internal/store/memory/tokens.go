@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"vws-backend/internal/service/token"
+)
+
+type tokenRepo struct {
+	conn
+}
+
+func (r *tokenRepo) WithTx(ctx context.Context, fn func(token.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&tokenRepo{c})
+	})
+}
+
+func (r *tokenRepo) DeductPoints(ctx context.Context, userID int64, points int) error {
+	defer r.lock()()
+
+	row, ok := r.db.users[userID]
+	if !ok {
+		return token.ErrUserNotFound
+	}
+	if row.Points < int64(points) {
+		return token.ErrInsufficientPoints
+	}
+	row.Points -= int64(points)
+	r.db.users[userID] = row
+	return nil
+}
+
+func (r *tokenRepo) GetAccount(ctx context.Context, userID int64) (*token.Token, error) {
+	defer r.lock()()
+
+	account, ok := r.db.accounts[userID]
+	if !ok {
+		return nil, token.ErrNoAccount
+	}
+	return &account, nil
+}
+
+func (r *tokenRepo) Stake(ctx context.Context, userID int64, amount float64, durationDays int, start, end time.Time) error {
+	defer r.lock()()
+
+	account, ok := r.db.accounts[userID]
+	if !ok || account.Balance < amount {
+		return token.ErrInsufficientBalance
+	}
+	account.Balance -= amount
+	account.StakedAmount = amount
+	account.LastStakeDate = start
+	account.StakeDuration = durationDays
+	account.StakeEndDate = end
+	account.UpdatedAt = start
+	r.db.accounts[userID] = account
+	return nil
+}
+
+func (r *tokenRepo) ReleaseStake(ctx context.Context, userID int64, amount float64) error {
+	defer r.lock()()
+
+	account, ok := r.db.accounts[userID]
+	if !ok {
+		return token.ErrNoAccount
+	}
+	account.Balance += amount
+	account.StakedAmount = 0
+	account.LastStakeDate = time.Time{}
+	account.StakeDuration = 0
+	account.StakeEndDate = time.Time{}
+	account.UpdatedAt = time.Now()
+	r.db.accounts[userID] = account
+	return nil
+}
+
+func (r *tokenRepo) Debit(ctx context.Context, userID int64, amount float64) error {
+	defer r.lock()()
+
+	account, ok := r.db.accounts[userID]
+	if !ok || account.Balance < amount {
+		return token.ErrInsufficientBalance
+	}
+	account.Balance -= amount
+	account.UpdatedAt = time.Now()
+	r.db.accounts[userID] = account
+	return nil
+}
+
+func (r *tokenRepo) Credit(ctx context.Context, userID int64, amount float64) error {
+	defer r.lock()()
+
+	now := time.Now()
+	account, ok := r.db.accounts[userID]
+	if !ok {
+		account = token.Token{ID: r.nextID(), UserID: userID, CreatedAt: now}
+	}
+	account.Balance += amount
+	account.UpdatedAt = now
+	r.db.accounts[userID] = account
+	return nil
+}
+
+func (r *tokenRepo) CreateTransaction(ctx context.Context, txn *token.Transaction) error {
+	defer r.lock()()
+
+	txn.ID = r.nextID()
+	r.db.transactions[txn.ID] = *txn
+	return nil
+}
+
+func (r *tokenRepo) GetTransaction(ctx context.Context, id int64) (*token.Transaction, error) {
+	defer r.lock()()
+
+	txn, ok := r.db.transactions[id]
+	if !ok {
+		return nil, token.ErrTransactionNotFound
+	}
+	return &txn, nil
+}
+
+func (r *tokenRepo) ListTransactions(ctx context.Context, userID int64, limit, offset int) ([]*token.Transaction, error) {
+	defer r.lock()()
+
+	var transactions []*token.Transaction
+	for _, txn := range r.db.transactions {
+		if txn.UserID == userID {
+			transactions = append(transactions, &txn)
+		}
+	}
+	slices.SortFunc(transactions, func(a, b *token.Transaction) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return page(transactions, limit, offset), nil
+}
+
+// page applies LIMIT and OFFSET to rows
+func page[T any](rows []T, limit, offset int) []T {
+	limit, offset = max(limit, 0), max(offset, 0)
+	if offset >= len(rows) {
+		return nil
+	}
+	rows = rows[offset:]
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
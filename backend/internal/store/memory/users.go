@@ -0,0 +1,249 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"vws-backend/internal/service/user"
+)
+
+type userRow struct {
+	user.User
+	Role string
+}
+
+type userRepo struct {
+	conn
+}
+
+func (r *userRepo) WithTx(ctx context.Context, fn func(user.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&userRepo{c})
+	})
+}
+
+func (r *userRepo) CreateUser(ctx context.Context, u *user.User) error {
+	defer r.lock()()
+
+	for _, row := range r.db.users {
+		if row.Username == u.Username || row.Email == u.Email {
+			return user.ErrUserExists
+		}
+	}
+	u.ID = r.nextID()
+	r.db.users[u.ID] = userRow{User: *u, Role: user.RoleUser}
+	return nil
+}
+
+func (r *userRepo) GetUser(ctx context.Context, id int64) (*user.User, error) {
+	defer r.lock()()
+
+	row, ok := r.db.users[id]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	u := row.User
+	u.Password = ""
+	return &u, nil
+}
+
+func (r *userRepo) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	defer r.lock()()
+
+	for _, row := range r.db.users {
+		if row.Email == email {
+			u := row.User
+			return &u, nil
+		}
+	}
+	return nil, user.ErrUserNotFound
+}
+
+func (r *userRepo) AddPoints(ctx context.Context, userID, points int64, at time.Time) error {
+	defer r.lock()()
+
+	row, ok := r.db.users[userID]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+	row.Points += points
+	row.UpdatedAt = at
+	r.db.users[userID] = row
+	return nil
+}
+
+func (r *userRepo) RecordLogin(ctx context.Context, userID int64, at time.Time) error {
+	defer r.lock()()
+
+	row, ok := r.db.users[userID]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+	if row.LastLogin.IsZero() || at.Sub(row.LastLogin) <= 24*time.Hour {
+		row.Streak++
+	} else {
+		row.Streak = 1
+	}
+	row.LastLogin = at
+	row.UpdatedAt = at
+	r.db.users[userID] = row
+	return nil
+}
+
+func (r *userRepo) Leaderboard(ctx context.Context, limit int) ([]*user.User, error) {
+	defer r.lock()()
+
+	var users []*user.User
+	for _, row := range r.db.users {
+		users = append(users, &user.User{
+			ID:       row.ID,
+			Username: row.Username,
+			Points:   row.Points,
+			Streak:   row.Streak,
+		})
+	}
+	slices.SortFunc(users, func(a, b *user.User) int {
+		return cmp.Or(cmp.Compare(b.Points, a.Points), cmp.Compare(a.ID, b.ID))
+	})
+	return page(users, limit, 0), nil
+}
+
+func (r *userRepo) GetRole(ctx context.Context, userID int64) (string, error) {
+	defer r.lock()()
+
+	row, ok := r.db.users[userID]
+	if !ok {
+		return "", user.ErrUserNotFound
+	}
+	return row.Role, nil
+}
+
+func (r *userRepo) SetRole(ctx context.Context, userID int64, role string, at time.Time) error {
+	defer r.lock()()
+
+	row, ok := r.db.users[userID]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+	row.Role = role
+	row.UpdatedAt = at
+	r.db.users[userID] = row
+	return nil
+}
+
+func (r *userRepo) CreateSession(ctx context.Context, session *user.Session) error {
+	defer r.lock()()
+
+	session.ID = r.nextID()
+	r.db.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *userRepo) GetSession(ctx context.Context, id int64) (*user.Session, error) {
+	defer r.lock()()
+
+	session, ok := r.db.sessions[id]
+	if !ok {
+		return nil, user.ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+func (r *userRepo) ListActiveSessions(ctx context.Context, userID int64, now time.Time) ([]*user.Session, error) {
+	defer r.lock()()
+
+	var sessions []*user.Session
+	for _, session := range r.db.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(now) {
+			sessions = append(sessions, &session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b *user.Session) int {
+		return cmp.Or(b.LastUsedAt.Compare(a.LastUsedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return sessions, nil
+}
+
+func (r *userRepo) TouchSession(ctx context.Context, sessionID int64, expiresAt, lastUsedAt time.Time) error {
+	defer r.lock()()
+
+	session, ok := r.db.sessions[sessionID]
+	if !ok {
+		return user.ErrSessionNotFound
+	}
+	session.ExpiresAt = expiresAt
+	session.LastUsedAt = lastUsedAt
+	r.db.sessions[sessionID] = session
+	return nil
+}
+
+func (r *userRepo) RevokeSession(ctx context.Context, userID, sessionID int64, reason string, at time.Time) error {
+	defer r.lock()()
+
+	session, ok := r.db.sessions[sessionID]
+	if !ok || session.UserID != userID || session.RevokedAt != nil {
+		return user.ErrSessionNotFound
+	}
+	session.RevokedAt = &at
+	session.RevokeReason = reason
+	r.db.sessions[sessionID] = session
+	return nil
+}
+
+func (r *userRepo) RevokeAllSessions(ctx context.Context, userID int64, reason string, at time.Time) error {
+	defer r.lock()()
+
+	for id, session := range r.db.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &at
+			session.RevokeReason = reason
+			r.db.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (r *userRepo) CreateRefreshToken(ctx context.Context, token *user.RefreshToken) error {
+	defer r.lock()()
+
+	token.ID = r.nextID()
+	r.db.refreshTokens[token.ID] = user.RefreshToken{
+		ID:        token.ID,
+		SessionID: token.SessionID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: token.ExpiresAt,
+	}
+	return nil
+}
+
+func (r *userRepo) GetRefreshToken(ctx context.Context, tokenHash string) (*user.RefreshToken, error) {
+	defer r.lock()()
+
+	for _, token := range r.db.refreshTokens {
+		if token.TokenHash != tokenHash {
+			continue
+		}
+		session, ok := r.db.sessions[token.SessionID]
+		if !ok {
+			break
+		}
+		token.UserID = session.UserID
+		token.SessionRevokedAt = session.RevokedAt
+		return &token, nil
+	}
+	return nil, user.ErrInvalidRefreshToken
+}
+
+func (r *userRepo) MarkRefreshTokenUsed(ctx context.Context, tokenID int64, at time.Time) error {
+	defer r.lock()()
+
+	token, ok := r.db.refreshTokens[tokenID]
+	if !ok {
+		return user.ErrInvalidRefreshToken
+	}
+	token.UsedAt = &at
+	r.db.refreshTokens[tokenID] = token
+	return nil
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"vws-backend/internal/service/verification"
+)
+
+type verificationRepo struct {
+	conn
+}
+
+func (r *verificationRepo) CreateCertificate(ctx context.Context, cert *verification.Certificate) error {
+	defer r.lock()()
+
+	if _, ok := r.db.certificates[cert.ID]; ok {
+		return verification.ErrCertificateExists
+	}
+	for _, existing := range r.db.certificates {
+		if existing.UserID == cert.UserID && existing.ElectionID == cert.ElectionID {
+			return verification.ErrCertificateExists
+		}
+	}
+	r.db.certificates[cert.ID] = *cert
+	return nil
+}
+
+func (r *verificationRepo) ReplaceCertificate(ctx context.Context, oldID string, cert *verification.Certificate) error {
+	return r.withTx(ctx, func(tx conn) error {
+		if _, ok := tx.db.certificates[oldID]; !ok {
+			return verification.ErrCertificateNotFound
+		}
+		delete(tx.db.certificates, oldID)
+		return (&verificationRepo{tx}).CreateCertificate(ctx, cert)
+	})
+}
+
+func (r *verificationRepo) GetCertificate(ctx context.Context, id string) (*verification.Certificate, error) {
+	defer r.lock()()
+
+	cert, ok := r.db.certificates[id]
+	if !ok {
+		return nil, verification.ErrCertificateNotFound
+	}
+	return &cert, nil
+}
+
+func (r *verificationRepo) ListCertificates(ctx context.Context, userID int64) ([]*verification.Certificate, error) {
+	defer r.lock()()
+
+	var certs []*verification.Certificate
+	for _, cert := range r.db.certificates {
+		if cert.UserID == userID {
+			certs = append(certs, &cert)
+		}
+	}
+	slices.SortFunc(certs, func(a, b *verification.Certificate) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return certs, nil
+}
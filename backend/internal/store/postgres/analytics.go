@@ -0,0 +1,211 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"vws-backend/internal/service/analytics"
+)
+
+// utcDay formats the UTC day of a timestamp column like analytics.DayFormat
+const utcDay = `to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')`
+
+type analyticsRepo struct {
+	conn
+}
+
+func (r *analyticsRepo) WithTx(ctx context.Context, fn func(analytics.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&analyticsRepo{c})
+	})
+}
+
+func (r *analyticsRepo) CreateActivity(ctx context.Context, activity *analytics.Activity) error {
+	metadataJSON, err := json.Marshal(activity.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO user_activities (user_id, activity_type, metadata, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		activity.UserID, activity.Type, metadataJSON, activity.CreatedAt,
+	).Scan(&activity.ID)
+}
+
+func (r *analyticsRepo) count(ctx context.Context, query string, args ...any) (int, error) {
+	var n int
+	err := r.q.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (r *analyticsRepo) CountUsers(ctx context.Context, period analytics.Period) (int, error) {
+	return r.count(ctx,
+		`SELECT COUNT(*) FROM users WHERE created_at >= $1 AND created_at < $2`,
+		period.From, period.To)
+}
+
+func (r *analyticsRepo) CountActiveUsers(ctx context.Context, period analytics.Period) (int, error) {
+	return r.count(ctx,
+		`SELECT COUNT(DISTINCT user_id) FROM user_activities WHERE created_at >= $1 AND created_at < $2`,
+		period.From, period.To)
+}
+
+func (r *analyticsRepo) CountRetainedUsers(ctx context.Context, first, second analytics.Period) (int, error) {
+	return r.count(ctx,
+		`SELECT COUNT(DISTINCT a.user_id)
+		FROM user_activities a
+		WHERE a.created_at >= $3 AND a.created_at < $4
+		AND EXISTS (
+			SELECT 1 FROM user_activities p
+			WHERE p.user_id = a.user_id AND p.created_at >= $1 AND p.created_at < $2
+		)`,
+		first.From, first.To, second.From, second.To)
+}
+
+func (r *analyticsRepo) CountActivities(ctx context.Context, filter analytics.ActivityFilter, period analytics.Period) (int, error) {
+	query := `SELECT COUNT(*) FROM user_activities WHERE created_at >= $1 AND created_at < $2`
+	args := []any{period.From, period.To}
+	if filter.UserID != 0 {
+		args = append(args, filter.UserID)
+		query += fmt.Sprintf(` AND user_id = $%d`, len(args))
+	}
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		query += fmt.Sprintf(` AND activity_type = $%d`, len(args))
+	}
+	if filter.Successful {
+		query += ` AND metadata->'success' = 'true'::jsonb`
+	}
+	return r.count(ctx, query, args...)
+}
+
+// countBy runs a query returning key and count pairs
+func (r *analyticsRepo) countBy(ctx context.Context, query string, args ...any) (map[string]int, error) {
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, err
+		}
+		counts[key] = count
+	}
+	return counts, rows.Err()
+}
+
+func (r *analyticsRepo) ActivityCounts(ctx context.Context, period analytics.Period) (map[string]int, error) {
+	return r.countBy(ctx,
+		`SELECT activity_type, COUNT(*)
+		FROM user_activities
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY activity_type`,
+		period.From, period.To)
+}
+
+func (r *analyticsRepo) DailyActiveUsers(ctx context.Context, period analytics.Period) (map[string]int, error) {
+	return r.countBy(ctx,
+		`SELECT `+utcDay+` AS day, COUNT(DISTINCT user_id)
+		FROM user_activities
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY day`,
+		period.From, period.To)
+}
+
+func (r *analyticsRepo) DailyNewUsers(ctx context.Context, period analytics.Period) (map[string]int, error) {
+	return r.countBy(ctx,
+		`SELECT `+utcDay+` AS day, COUNT(*)
+		FROM users
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY day`,
+		period.From, period.To)
+}
+
+func (r *analyticsRepo) TokenVolume(ctx context.Context, period analytics.Period) (analytics.TokenVolume, error) {
+	var volume analytics.TokenVolume
+	err := r.q.QueryRowContext(ctx,
+		`SELECT
+			COALESCE(SUM(amount), 0),
+			COALESCE(SUM(CASE WHEN type = 'STAKE' THEN amount ELSE 0 END), 0),
+			COUNT(*),
+			COUNT(DISTINCT user_id)
+		FROM token_transactions
+		WHERE created_at >= $1 AND created_at < $2`,
+		period.From, period.To,
+	).Scan(&volume.Total, &volume.Staked, &volume.Transactions, &volume.Users)
+	return volume, err
+}
+
+func (r *analyticsRepo) DailyTokenVolume(ctx context.Context, period analytics.Period) (map[string]float64, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+utcDay+` AS day, SUM(amount)
+		FROM token_transactions
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY day`,
+		period.From, period.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	volume := make(map[string]float64)
+	for rows.Next() {
+		var day string
+		var amount float64
+		if err := rows.Scan(&day, &amount); err != nil {
+			return nil, err
+		}
+		volume[day] = amount
+	}
+	return volume, rows.Err()
+}
+
+func (r *analyticsRepo) CreateDailyMetric(ctx context.Context, metric *analytics.DailyMetric) error {
+	metadataJSON, err := json.Marshal(metric.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO daily_metrics (metric_date, metric_type, metric_value, metadata, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		metric.Date, metric.Type, metric.Value, metadataJSON, metric.CreatedAt,
+	).Scan(&metric.ID)
+}
+
+func (r *analyticsRepo) CreateEngagement(ctx context.Context, engagement *analytics.UserEngagement) error {
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO user_engagement (user_id, metric_type, metric_value, start_date, end_date, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		engagement.UserID, engagement.Type, engagement.Value,
+		engagement.StartDate, engagement.EndDate, engagement.CreatedAt,
+	).Scan(&engagement.ID)
+}
+
+func (r *analyticsRepo) CreateReport(ctx context.Context, report *analytics.Report) error {
+	dataJSON, err := json.Marshal(report.Data)
+	if err != nil {
+		return err
+	}
+	parametersJSON, err := json.Marshal(report.Parameters)
+	if err != nil {
+		return err
+	}
+
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO analytics_reports (report_type, report_data, parameters, start_date, end_date, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		report.Type, dataJSON, parametersJSON, report.StartDate, report.EndDate, report.CreatedAt,
+	).Scan(&report.ID)
+}
@@ -0,0 +1,452 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+
+	"vws-backend/internal/service/enterprise"
+)
+
+type enterpriseRepo struct {
+	conn
+}
+
+func (r *enterpriseRepo) WithTx(ctx context.Context, fn func(enterprise.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&enterpriseRepo{c})
+	})
+}
+
+// jsonOr returns def for an empty document, for NOT NULL JSONB columns
+func jsonOr(raw json.RawMessage, def string) []byte {
+	if len(raw) == 0 {
+		return []byte(def)
+	}
+	return raw
+}
+
+// rawJSON maps NULL to a nil document
+func rawJSON(b []byte) json.RawMessage {
+	if b == nil {
+		return nil
+	}
+	return json.RawMessage(b)
+}
+
+func (r *enterpriseRepo) CreateOrganization(ctx context.Context, org *enterprise.Organization) error {
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO organizations
+		(name, description, logo_url, website_url, contact_email, settings, domain, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		org.Name, nullString(org.Description), nullString(org.LogoURL), nullString(org.WebsiteURL),
+		org.ContactEmail, jsonOr(org.Settings, "{}"), nullString(org.Domain), org.CreatedBy,
+		org.CreatedAt, org.UpdatedAt,
+	).Scan(&org.ID)
+}
+
+func (r *enterpriseRepo) GetOrganization(ctx context.Context, id int64) (*enterprise.Organization, error) {
+	org := &enterprise.Organization{}
+	var settings []byte
+	var createdBy sql.NullInt64
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, name, COALESCE(description, ''), COALESCE(logo_url, ''), COALESCE(website_url, ''),
+		contact_email, settings, COALESCE(domain, ''), created_by, created_at, updated_at
+		FROM organizations WHERE id = $1`,
+		id,
+	).Scan(
+		&org.ID, &org.Name, &org.Description, &org.LogoURL, &org.WebsiteURL,
+		&org.ContactEmail, &settings, &org.Domain, &createdBy, &org.CreatedAt, &org.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, enterprise.ErrOrganizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	org.Settings = rawJSON(settings)
+	org.CreatedBy = createdBy.Int64
+	return org, nil
+}
+
+func (r *enterpriseRepo) UpdateOrganization(ctx context.Context, org *enterprise.Organization) error {
+	return r.exec(ctx, enterprise.ErrOrganizationNotFound,
+		`UPDATE organizations
+		SET name = $1, description = $2, contact_email = $3, domain = $4,
+		logo_url = $5, website_url = $6, settings = $7, updated_at = $8
+		WHERE id = $9`,
+		org.Name, nullString(org.Description), org.ContactEmail, nullString(org.Domain),
+		nullString(org.LogoURL), nullString(org.WebsiteURL), jsonOr(org.Settings, "{}"),
+		org.UpdatedAt, org.ID,
+	)
+}
+
+func (r *enterpriseRepo) AddMember(ctx context.Context, member *enterprise.Member) error {
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO organization_members (organization_id, user_id, role, permissions, joined_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5, $6)
+		RETURNING id`,
+		member.OrganizationID, member.UserID, member.Role, jsonOr(member.Permissions, "{}"),
+		member.CreatedAt, member.UpdatedAt,
+	).Scan(&member.ID)
+	if isUniqueViolation(err) {
+		return enterprise.ErrMemberExists
+	}
+	return err
+}
+
+func (r *enterpriseRepo) GetMember(ctx context.Context, orgID, userID int64) (*enterprise.Member, error) {
+	member := &enterprise.Member{}
+	var permissions []byte
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, organization_id, user_id, role, permissions, created_at, updated_at
+		FROM organization_members WHERE organization_id = $1 AND user_id = $2`,
+		orgID, userID,
+	).Scan(
+		&member.ID, &member.OrganizationID, &member.UserID, &member.Role,
+		&permissions, &member.CreatedAt, &member.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, enterprise.ErrMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	member.Permissions = rawJSON(permissions)
+	return member, nil
+}
+
+func (r *enterpriseRepo) ListOwners(ctx context.Context, orgID int64) ([]int64, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT user_id FROM organization_members
+		WHERE organization_id = $1 AND role = $2
+		ORDER BY user_id`+r.forUpdate(),
+		orgID, enterprise.RoleOwner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var owners []int64
+	for rows.Next() {
+		var ownerID int64
+		if err := rows.Scan(&ownerID); err != nil {
+			return nil, err
+		}
+		owners = append(owners, ownerID)
+	}
+	return owners, rows.Err()
+}
+
+func (r *enterpriseRepo) UpdateMemberRole(ctx context.Context, orgID, userID int64, role string, at time.Time) error {
+	return r.exec(ctx, enterprise.ErrMemberNotFound,
+		`UPDATE organization_members SET role = $1, updated_at = $2
+		WHERE organization_id = $3 AND user_id = $4`,
+		role, at, orgID, userID,
+	)
+}
+
+func (r *enterpriseRepo) UpdateMemberPermissions(ctx context.Context, orgID, userID int64, permissions json.RawMessage, at time.Time) error {
+	return r.exec(ctx, enterprise.ErrMemberNotFound,
+		`UPDATE organization_members SET permissions = $1, updated_at = $2
+		WHERE organization_id = $3 AND user_id = $4`,
+		jsonOr(permissions, "{}"), at, orgID, userID,
+	)
+}
+
+func (r *enterpriseRepo) CreateAPIKey(ctx context.Context, key *enterprise.APIKey, keyHash string) error {
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO api_keys
+		(organization_id, name, key_hash, scopes, rate_limit, expires_at, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4::api_key_scope[], $5, $6, $7, $8, $9)
+		RETURNING id`,
+		key.OrganizationID, key.Name, keyHash, pq.Array(key.Scopes), key.RateLimit,
+		nullTime(key.ExpiresAt), key.CreatedBy, key.CreatedAt, key.UpdatedAt,
+	).Scan(&key.ID)
+}
+
+const apiKeyColumns = `id, organization_id, name, scopes, rate_limit,
+	expires_at, last_used_at, created_by, created_at, updated_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*enterprise.APIKey, error) {
+	key := &enterprise.APIKey{}
+	var scopes pq.StringArray
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(
+		&key.ID, &key.OrganizationID, &key.Name, &scopes,
+		&key.RateLimit, &expiresAt, &lastUsedAt,
+		&key.CreatedBy, &key.CreatedAt, &key.UpdatedAt,
+	)
+	key.Scopes = scopes
+	key.ExpiresAt = expiresAt.Time
+	key.LastUsedAt = lastUsedAt.Time
+	return key, err
+}
+
+func (r *enterpriseRepo) GetAPIKeyByHash(ctx context.Context, keyHash string) (*enterprise.APIKey, error) {
+	key, err := scanAPIKey(r.q.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`,
+		keyHash))
+	if err == sql.ErrNoRows {
+		return nil, enterprise.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (r *enterpriseRepo) TouchAPIKey(ctx context.Context, keyID int64, at time.Time) error {
+	return r.exec(ctx, enterprise.ErrAPIKeyNotFound,
+		`UPDATE api_keys SET last_used_at = $1 WHERE id = $2`,
+		at, keyID,
+	)
+}
+
+func (r *enterpriseRepo) ListAPIKeys(ctx context.Context, orgID int64) ([]*enterprise.APIKey, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE organization_id = $1 ORDER BY id`,
+		orgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*enterprise.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *enterpriseRepo) DeleteAPIKey(ctx context.Context, orgID, keyID int64) error {
+	return r.exec(ctx, enterprise.ErrAPIKeyNotFound,
+		`DELETE FROM api_keys WHERE organization_id = $1 AND id = $2`,
+		orgID, keyID,
+	)
+}
+
+func (r *enterpriseRepo) CreateVotingSystem(ctx context.Context, vs *enterprise.VotingSystem) error {
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO voting_systems
+		(organization_id, name, description, voting_type, config, active, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
+		vs.OrganizationID, vs.Name, nullString(vs.Description), vs.VotingType,
+		jsonOr(vs.Config, "{}"), vs.Active, vs.CreatedBy, vs.CreatedAt, vs.UpdatedAt,
+	).Scan(&vs.ID)
+}
+
+const votingSystemColumns = `id, organization_id, name, COALESCE(description, ''), voting_type,
+	config, active, created_by, created_at, updated_at`
+
+func scanVotingSystem(row interface{ Scan(...any) error }) (*enterprise.VotingSystem, error) {
+	vs := &enterprise.VotingSystem{}
+	var config []byte
+	err := row.Scan(
+		&vs.ID, &vs.OrganizationID, &vs.Name, &vs.Description,
+		&vs.VotingType, &config, &vs.Active, &vs.CreatedBy,
+		&vs.CreatedAt, &vs.UpdatedAt,
+	)
+	vs.Config = rawJSON(config)
+	return vs, err
+}
+
+func (r *enterpriseRepo) GetVotingSystem(ctx context.Context, id int64) (*enterprise.VotingSystem, error) {
+	vs, err := scanVotingSystem(r.q.QueryRowContext(ctx,
+		`SELECT `+votingSystemColumns+` FROM voting_systems WHERE id = $1`,
+		id))
+	if err == sql.ErrNoRows {
+		return nil, enterprise.ErrVotingSystemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+func (r *enterpriseRepo) ListVotingSystems(ctx context.Context, orgID int64) ([]*enterprise.VotingSystem, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+votingSystemColumns+` FROM voting_systems WHERE organization_id = $1 ORDER BY id`,
+		orgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var systems []*enterprise.VotingSystem
+	for rows.Next() {
+		vs, err := scanVotingSystem(rows)
+		if err != nil {
+			return nil, err
+		}
+		systems = append(systems, vs)
+	}
+	return systems, rows.Err()
+}
+
+func (r *enterpriseRepo) CreateVote(ctx context.Context, vote *enterprise.Vote) error {
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO votes
+		(voting_system_id, title, description, options, start_date, end_date, status, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		vote.VotingSystemID, vote.Title, nullString(vote.Description), jsonOr(vote.Options, "[]"),
+		vote.StartDate, vote.EndDate, vote.Status, vote.CreatedBy, vote.CreatedAt, vote.UpdatedAt,
+	).Scan(&vote.ID)
+}
+
+func (r *enterpriseRepo) GetVote(ctx context.Context, id int64) (*enterprise.Vote, error) {
+	vote := &enterprise.Vote{}
+	var options, result []byte
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, voting_system_id, title, COALESCE(description, ''), options,
+		start_date, end_date, status, result, created_by, created_at, updated_at
+		FROM votes WHERE id = $1`+r.forShare(),
+		id,
+	).Scan(
+		&vote.ID, &vote.VotingSystemID, &vote.Title, &vote.Description,
+		&options, &vote.StartDate, &vote.EndDate, &vote.Status,
+		&result, &vote.CreatedBy, &vote.CreatedAt, &vote.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, enterprise.ErrVoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	vote.Options = rawJSON(options)
+	vote.Result = rawJSON(result)
+	return vote, nil
+}
+
+func (r *enterpriseRepo) GetVoteOrganization(ctx context.Context, voteID int64) (int64, error) {
+	var orgID int64
+	err := r.q.QueryRowContext(ctx,
+		`SELECT vs.organization_id FROM votes v
+		JOIN voting_systems vs ON vs.id = v.voting_system_id
+		WHERE v.id = $1`,
+		voteID,
+	).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		return 0, enterprise.ErrVoteNotFound
+	}
+	return orgID, err
+}
+
+func (r *enterpriseRepo) SaveVoteResult(ctx context.Context, voteID int64, status string, result json.RawMessage, at time.Time) error {
+	return r.exec(ctx, enterprise.ErrVoteNotFound,
+		`UPDATE votes SET result = $1, status = $2, updated_at = $3
+		WHERE id = $4`,
+		[]byte(result), status, at, voteID,
+	)
+}
+
+func (r *enterpriseRepo) CreateVoteResponse(ctx context.Context, resp *enterprise.VoteResponse) error {
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO vote_responses (vote_id, user_id, response, weight, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		resp.VoteID, resp.UserID, []byte(resp.Response), resp.Weight, resp.CreatedAt, resp.UpdatedAt,
+	).Scan(&resp.ID)
+	if isUniqueViolation(err) {
+		return enterprise.ErrVoteAlreadySubmitted
+	}
+	return err
+}
+
+func (r *enterpriseRepo) ListVoteResponses(ctx context.Context, voteID int64) ([]*enterprise.VoteResponse, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, vote_id, user_id, response, weight, created_at, updated_at
+		FROM vote_responses WHERE vote_id = $1 ORDER BY id`,
+		voteID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var responses []*enterprise.VoteResponse
+	for rows.Next() {
+		resp := &enterprise.VoteResponse{}
+		var response []byte
+		err := rows.Scan(
+			&resp.ID, &resp.VoteID, &resp.UserID, &response, &resp.Weight,
+			&resp.CreatedAt, &resp.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		resp.Response = rawJSON(response)
+		responses = append(responses, resp)
+	}
+	return responses, rows.Err()
+}
+
+func (r *enterpriseRepo) SaveWhiteLabelSettings(ctx context.Context, settings *enterprise.WhiteLabelSettings) error {
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO white_label_settings
+		(organization_id, domain, theme_config, custom_css, custom_js, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET domain = $2, theme_config = $3, custom_css = $4, custom_js = $5, enabled = $6,
+		updated_at = $7
+		RETURNING id, created_at`,
+		settings.OrganizationID, nullString(settings.Domain), jsonOr(settings.ThemeConfig, "{}"),
+		nullString(settings.CustomCSS), nullString(settings.CustomJS), settings.Enabled, settings.UpdatedAt,
+	).Scan(&settings.ID, &settings.CreatedAt)
+}
+
+func (r *enterpriseRepo) GetWhiteLabelSettings(ctx context.Context, orgID int64) (*enterprise.WhiteLabelSettings, error) {
+	settings := &enterprise.WhiteLabelSettings{OrganizationID: orgID}
+	var themeConfig []byte
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, COALESCE(domain, ''), theme_config, COALESCE(custom_css, ''), COALESCE(custom_js, ''),
+		enabled, created_at, updated_at
+		FROM white_label_settings WHERE organization_id = $1`,
+		orgID,
+	).Scan(
+		&settings.ID, &settings.Domain, &themeConfig,
+		&settings.CustomCSS, &settings.CustomJS, &settings.Enabled,
+		&settings.CreatedAt, &settings.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	settings.ThemeConfig = rawJSON(themeConfig)
+	return settings, nil
+}
+
+func (r *enterpriseRepo) ListWhiteLabelDomains(ctx context.Context) ([]string, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT DISTINCT LOWER(domain) FROM white_label_settings WHERE enabled = true AND domain <> ''`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, rows.Err()
+}
@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"vws-backend/internal/service/face"
+)
+
+type faceRepo struct {
+	conn
+}
+
+func (r *faceRepo) WithTx(ctx context.Context, fn func(face.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&faceRepo{c})
+	})
+}
+
+func (r *faceRepo) CreateEmbedding(ctx context.Context, e *face.Embedding) error {
+	_, err := r.q.ExecContext(ctx,
+		`INSERT INTO face_embeddings (user_id, embedding, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)`,
+		e.UserID, pq.Array(e.Vector), e.CreatedAt, e.UpdatedAt)
+	if isUniqueViolation(err) {
+		return face.ErrAlreadyEnrolled
+	}
+	return err
+}
+
+func (r *faceRepo) UpdateEmbedding(ctx context.Context, e *face.Embedding) error {
+	err := r.q.QueryRowContext(ctx,
+		`UPDATE face_embeddings SET embedding = $2, updated_at = $3
+		WHERE user_id = $1
+		RETURNING created_at`,
+		e.UserID, pq.Array(e.Vector), e.UpdatedAt).Scan(&e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return face.ErrNotEnrolled
+	}
+	return err
+}
+
+func (r *faceRepo) GetEmbedding(ctx context.Context, userID int64) (*face.Embedding, error) {
+	e := &face.Embedding{UserID: userID}
+	err := r.q.QueryRowContext(ctx,
+		`SELECT embedding, created_at, updated_at FROM face_embeddings WHERE user_id = $1`,
+		userID).Scan((*pq.Float32Array)(&e.Vector), &e.CreatedAt, &e.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, face.ErrNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *faceRepo) DeleteEmbedding(ctx context.Context, userID int64) error {
+	return r.exec(ctx, face.ErrNotEnrolled,
+		`DELETE FROM face_embeddings WHERE user_id = $1`, userID)
+}
+
+func (r *faceRepo) ListEmbeddings(ctx context.Context, afterUserID int64, limit int) ([]face.Embedding, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT user_id, embedding, created_at, updated_at FROM face_embeddings
+		WHERE user_id > $1
+		ORDER BY user_id
+		LIMIT $2`,
+		afterUserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var embeddings []face.Embedding
+	for rows.Next() {
+		var e face.Embedding
+		if err := rows.Scan(&e.UserID, (*pq.Float32Array)(&e.Vector), &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, e)
+	}
+	return embeddings, rows.Err()
+}
+
+func (r *faceRepo) CreateDuplicate(ctx context.Context, d *face.Duplicate) error {
+	// The pair's unique index covers both orders
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO face_duplicates (user_id, matched_user_id, similarity, status, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		d.UserID, d.MatchedUserID, d.Similarity, d.Status, d.CreatedAt).Scan(&d.ID)
+	if err == sql.ErrNoRows {
+		return face.ErrDuplicateFlagged
+	}
+	return err
+}
+
+const duplicateColumns = `id, user_id, matched_user_id, similarity, status,
+	COALESCE(reviewed_by, 0), reviewed_at, created_at`
+
+func scanDuplicate(row interface{ Scan(...any) error }) (*face.Duplicate, error) {
+	d := &face.Duplicate{}
+	var reviewedAt sql.NullTime
+	err := row.Scan(&d.ID, &d.UserID, &d.MatchedUserID, &d.Similarity, &d.Status,
+		&d.ReviewedBy, &reviewedAt, &d.CreatedAt)
+	d.ReviewedAt = timePtr(reviewedAt)
+	return d, err
+}
+
+func (r *faceRepo) ListDuplicates(ctx context.Context, status string, limit, offset int) ([]*face.Duplicate, error) {
+	query := `SELECT ` + duplicateColumns + ` FROM face_duplicates`
+	args := []any{limit, offset}
+	if status != "" {
+		args = append(args, status)
+		query += ` WHERE status = $3`
+	}
+	rows, err := r.q.QueryContext(ctx, query+` ORDER BY created_at, id LIMIT $1 OFFSET $2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var duplicates []*face.Duplicate
+	for rows.Next() {
+		d, err := scanDuplicate(rows)
+		if err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, d)
+	}
+	return duplicates, rows.Err()
+}
+
+func (r *faceRepo) ReviewDuplicate(ctx context.Context, d *face.Duplicate) error {
+	stored, err := scanDuplicate(r.q.QueryRowContext(ctx,
+		`UPDATE face_duplicates SET status = $2, reviewed_by = $3, reviewed_at = $4
+		WHERE id = $1
+		RETURNING `+duplicateColumns,
+		d.ID, d.Status, d.ReviewedBy, d.ReviewedAt))
+	if err == sql.ErrNoRows {
+		return face.ErrDuplicateNotFound
+	}
+	if err != nil {
+		return err
+	}
+	*d = *stored
+	return nil
+}
+
+func (r *faceRepo) IsConfirmedDuplicate(ctx context.Context, userID int64) (bool, error) {
+	var confirmed bool
+	err := r.q.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM face_duplicates WHERE user_id = $1 AND status = $2)`,
+		userID, face.DuplicateConfirmed).Scan(&confirmed)
+	return confirmed, err
+}
+
+func (r *faceRepo) SaveChallenge(ctx context.Context, c *face.IssuedChallenge) error {
+	_, err := r.q.ExecContext(ctx,
+		`INSERT INTO liveness_challenges (user_id, id, challenge, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET id = EXCLUDED.id, challenge = EXCLUDED.challenge, expires_at = EXCLUDED.expires_at`,
+		c.UserID, c.ID, c.Challenge, c.ExpiresAt)
+	return err
+}
+
+func (r *faceRepo) TakeChallenge(ctx context.Context, userID int64, id string, now time.Time) (*face.IssuedChallenge, error) {
+	c := &face.IssuedChallenge{ID: id, UserID: userID}
+	err := r.q.QueryRowContext(ctx,
+		`DELETE FROM liveness_challenges WHERE user_id = $1 AND id = $2 RETURNING challenge, expires_at`,
+		userID, id).Scan(&c.Challenge, &c.ExpiresAt)
+	if err == sql.ErrNoRows || err == nil && !now.Before(c.ExpiresAt) {
+		return nil, face.ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
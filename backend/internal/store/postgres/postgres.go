@@ -0,0 +1,202 @@
+// Package postgres implements the service repositories on PostgreSQL
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+
+	"vws-backend/internal/service/analytics"
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/service/face"
+	"vws-backend/internal/service/token"
+	"vws-backend/internal/service/user"
+	"vws-backend/internal/service/verification"
+)
+
+// Store hands out the repositories of every service, all sharing one
+// connection pool
+type Store struct {
+	db *sql.DB
+}
+
+// New creates a store on db, which must be migrated to the latest schema
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Users returns the user repository
+func (s *Store) Users() user.Repository {
+	return &userRepo{conn{db: s.db, q: s.db}}
+}
+
+// Tokens returns the token repository
+func (s *Store) Tokens() token.Repository {
+	return &tokenRepo{conn{db: s.db, q: s.db}}
+}
+
+// Verification returns the verification repository
+func (s *Store) Verification() verification.Repository {
+	return &verificationRepo{conn{db: s.db, q: s.db}}
+}
+
+// Faces returns the face enrollment repository
+func (s *Store) Faces() face.Repository {
+	return &faceRepo{conn{db: s.db, q: s.db}}
+}
+
+// Analytics returns the analytics repository
+func (s *Store) Analytics() analytics.Repository {
+	return &analyticsRepo{conn{db: s.db, q: s.db}}
+}
+
+// Enterprise returns the enterprise repository
+func (s *Store) Enterprise() enterprise.Repository {
+	return &enterpriseRepo{conn{db: s.db, q: s.db}}
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn is what every repository runs its queries on
+type conn struct {
+	db *sql.DB // Nil inside a transaction
+	q  querier
+}
+
+// maxTxAttempts bounds how often a transaction is run when it keeps
+// failing on serialization conflicts
+const maxTxAttempts = 3
+
+// withTx runs fn on a connection inside a serializable transaction, or on c
+// itself if it already is one. A transaction failing on a serialization
+// conflict or deadlock is retried from the start after a short, jittered
+// pause; the outermost call retries, since the conflict aborts the whole
+// transaction.
+func (c conn) withTx(ctx context.Context, fn func(conn) error) error {
+	if c.db == nil {
+		return fn(c)
+	}
+
+	var err error
+	for attempt := range maxTxAttempts {
+		if attempt > 0 {
+			if err := sleep(ctx, retryDelay(attempt)); err != nil {
+				return err
+			}
+		}
+		err = c.runTx(ctx, fn)
+		if !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// runTx runs fn in one serializable transaction. Lower isolation levels
+// never fail on serialization conflicts, they let transactions act on
+// stale reads instead.
+func (c conn) runTx(ctx context.Context, fn func(conn) error) error {
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(conn{q: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// isRetryable reports whether err aborted a transaction that may succeed
+// when run again: a serialization failure or a deadlock
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+// retryDelay returns the pause before a retry, growing with the attempt and
+// jittered so conflicting transactions don't collide again
+func retryDelay(attempt int) time.Duration {
+	base := time.Duration(attempt) * 10 * time.Millisecond
+	return base + rand.N(base)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// forUpdate locks the selected rows when running in a transaction. Outside
+// one the lock would be released straight away, so it is left off.
+func (c conn) forUpdate() string {
+	if c.db == nil {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+// forShare is forUpdate with a shared lock, which keeps the rows from
+// changing without blocking other readers that lock them
+func (c conn) forShare() string {
+	if c.db == nil {
+		return " FOR SHARE"
+	}
+	return ""
+}
+
+// exec runs a statement that must change at least one row, returning
+// notFound otherwise
+func (c conn) exec(ctx context.Context, notFound error, query string, args ...any) error {
+	result, err := c.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// nullTime maps the zero time to NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// nullString maps the empty string to NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// timePtr maps NULL to nil
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
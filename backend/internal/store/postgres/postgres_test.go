@@ -0,0 +1,46 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/migrate"
+	"vws-backend/internal/store/postgres"
+	"vws-backend/internal/store/storetest"
+	"vws-backend/migrations"
+)
+
+// TestConformance needs a disposable database, named by
+// VWS_TEST_DATABASE_URL. Every table in it is emptied between tests.
+func TestConformance(t *testing.T) {
+	url := os.Getenv("VWS_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("VWS_TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	m, err := migrate.New(db, migrations.FS)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		_, err := db.ExecContext(ctx, `TRUNCATE
+			users, sessions, refresh_tokens, certificates, tokens, token_transactions,
+			user_activities, daily_metrics, user_engagement, analytics_reports,
+			organizations, organization_members, api_keys, voting_systems, votes,
+			vote_responses, white_label_settings
+			RESTART IDENTITY CASCADE`)
+		require.NoError(t, err)
+		return postgres.New(db)
+	})
+}
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(&pq.Error{Code: "40001"}), "serialization failure")
+	assert.True(t, isRetryable(&pq.Error{Code: "40P01"}), "deadlock")
+	assert.True(t, isRetryable(fmt.Errorf("commit: %w", &pq.Error{Code: "40001"})))
+
+	assert.False(t, isRetryable(nil))
+	assert.False(t, isRetryable(&pq.Error{Code: "23505"}))
+	assert.False(t, isRetryable(errors.New("40001")))
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 1; attempt < maxTxAttempts; attempt++ {
+		base := time.Duration(attempt) * 10 * time.Millisecond
+		for range 20 {
+			delay := retryDelay(attempt)
+			assert.GreaterOrEqual(t, delay, base)
+			assert.Less(t, delay, 2*base)
+		}
+	}
+}
+
+func TestSleep_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, sleep(ctx, time.Hour), context.Canceled)
+	assert.NoError(t, sleep(context.Background(), time.Millisecond))
+}
+
+// fakeDriver hands out connections whose transactions fail to commit with
+// the errors of commits, in turn, recording the isolation levels begun
+type fakeDriver struct {
+	mu         sync.Mutex
+	commits    []error
+	isolations []sql.IsolationLevel
+}
+
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) { return fakeConn{d}, nil }
+func (d *fakeDriver) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("use BeginTx") }
+
+func (c fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.isolations = append(c.d.isolations, sql.IsolationLevel(opts.Isolation))
+	return fakeTx{c.d}, nil
+}
+
+type fakeTx struct{ d *fakeDriver }
+
+func (tx fakeTx) Commit() error {
+	tx.d.mu.Lock()
+	defer tx.d.mu.Unlock()
+	if len(tx.d.commits) == 0 {
+		return nil
+	}
+	err := tx.d.commits[0]
+	tx.d.commits = tx.d.commits[1:]
+	return err
+}
+
+func (tx fakeTx) Rollback() error { return nil }
+
+func TestWithTx_Retries(t *testing.T) {
+	conflict := &pq.Error{Code: "40001"}
+	for name, tc := range map[string]struct {
+		commits []error
+		runs    int
+		err     error
+	}{
+		"commits":             {nil, 1, nil},
+		"conflict once":       {[]error{conflict}, 2, nil},
+		"deadlock":            {[]error{&pq.Error{Code: "40P01"}}, 2, nil},
+		"conflicts every run": {[]error{conflict, conflict, conflict, conflict}, maxTxAttempts, conflict},
+		"other error":         {[]error{sql.ErrConnDone}, 1, sql.ErrConnDone},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{commits: tc.commits}
+			db := sql.OpenDB(d)
+			defer db.Close()
+
+			var runs int
+			err := conn{db: db, q: db}.withTx(context.Background(), func(tx conn) error {
+				runs++
+				assert.Nil(t, tx.db, "fn runs inside the transaction")
+				return nil
+			})
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.runs, runs)
+			for _, level := range d.isolations {
+				assert.Equal(t, sql.LevelSerializable, level)
+			}
+		})
+	}
+}
+
+// TestWithTx_Conflict runs two transactions that each read what the other
+// writes, which PostgreSQL only lets commit serially. It needs a database
+// named by VWS_TEST_DATABASE_URL.
+func TestWithTx_Conflict(t *testing.T) {
+	url := os.Getenv("VWS_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("VWS_TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	_, err = db.ExecContext(ctx, `DROP TABLE IF EXISTS tx_conflict; CREATE TABLE tx_conflict (n int)`)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.ExecContext(ctx, `DROP TABLE tx_conflict`) })
+
+	// Both transactions sum the table before either inserts, each
+	// inserting one more than the sum it read
+	var read sync.WaitGroup
+	read.Add(2)
+	var runs atomic.Int32
+	insert := func() error {
+		first := true
+		return conn{db: db, q: db}.withTx(ctx, func(tx conn) error {
+			runs.Add(1)
+			var sum int
+			if err := tx.q.QueryRowContext(ctx, `SELECT COALESCE(SUM(n), 0) FROM tx_conflict`).Scan(&sum); err != nil {
+				return err
+			}
+			if first {
+				first = false
+				read.Done()
+				read.Wait()
+			}
+			_, err := tx.q.ExecContext(ctx, `INSERT INTO tx_conflict (n) VALUES ($1)`, sum+1)
+			return err
+		})
+	}
+
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() { errs <- insert() }()
+	}
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+
+	assert.Equal(t, int32(3), runs.Load(), "the losing transaction is run again")
+	var values []int
+	rows, err := db.QueryContext(ctx, `SELECT n FROM tx_conflict ORDER BY n`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var n int
+		require.NoError(t, rows.Scan(&n))
+		values = append(values, n)
+	}
+	assert.Equal(t, []int{1, 2}, values, "the retry read the first transaction's insert")
+}
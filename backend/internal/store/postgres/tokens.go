@@ -0,0 +1,171 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vws-backend/internal/service/token"
+)
+
+type tokenRepo struct {
+	conn
+}
+
+func (r *tokenRepo) WithTx(ctx context.Context, fn func(token.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&tokenRepo{c})
+	})
+}
+
+func (r *tokenRepo) DeductPoints(ctx context.Context, userID int64, points int) error {
+	err := r.exec(ctx, token.ErrInsufficientPoints,
+		`UPDATE users SET points = points - $1 WHERE id = $2 AND points >= $1`,
+		points, userID)
+	if err != token.ErrInsufficientPoints {
+		return err
+	}
+
+	var exists bool
+	err = r.q.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`,
+		userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return token.ErrUserNotFound
+	}
+	return token.ErrInsufficientPoints
+}
+
+func (r *tokenRepo) GetAccount(ctx context.Context, userID int64) (*token.Token, error) {
+	t := &token.Token{}
+	var lastStakeDate, stakeEndDate sql.NullTime
+	var stakeDuration sql.NullInt64
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, user_id, balance, staked_amount,
+		last_stake_date, stake_duration_days, stake_end_date,
+		created_at, updated_at
+		FROM tokens WHERE user_id = $1`+r.forUpdate(),
+		userID).Scan(
+		&t.ID, &t.UserID, &t.Balance, &t.StakedAmount,
+		&lastStakeDate, &stakeDuration, &stakeEndDate,
+		&t.CreatedAt, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, token.ErrNoAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.LastStakeDate = lastStakeDate.Time
+	t.StakeDuration = int(stakeDuration.Int64)
+	t.StakeEndDate = stakeEndDate.Time
+	return t, nil
+}
+
+func (r *tokenRepo) Stake(ctx context.Context, userID int64, amount float64, durationDays int, start, end time.Time) error {
+	return r.exec(ctx, token.ErrInsufficientBalance,
+		`UPDATE tokens
+		SET balance = balance - $1,
+			staked_amount = $1,
+			last_stake_date = $2,
+			stake_duration_days = $3,
+			stake_end_date = $4,
+			updated_at = $2
+		WHERE user_id = $5 AND balance >= $1`,
+		amount, start, durationDays, end, userID)
+}
+
+func (r *tokenRepo) ReleaseStake(ctx context.Context, userID int64, amount float64) error {
+	return r.exec(ctx, token.ErrNoAccount,
+		`UPDATE tokens
+		SET balance = balance + $1,
+			staked_amount = 0,
+			last_stake_date = NULL,
+			stake_duration_days = NULL,
+			stake_end_date = NULL,
+			updated_at = NOW()
+		WHERE user_id = $2`,
+		amount, userID)
+}
+
+func (r *tokenRepo) Debit(ctx context.Context, userID int64, amount float64) error {
+	return r.exec(ctx, token.ErrInsufficientBalance,
+		`UPDATE tokens
+		SET balance = balance - $1, updated_at = NOW()
+		WHERE user_id = $2 AND balance >= $1`,
+		amount, userID)
+}
+
+func (r *tokenRepo) Credit(ctx context.Context, userID int64, amount float64) error {
+	_, err := r.q.ExecContext(ctx,
+		`INSERT INTO tokens (user_id, balance)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id)
+		DO UPDATE SET balance = tokens.balance + $2, updated_at = NOW()`,
+		userID, amount)
+	return err
+}
+
+func (r *tokenRepo) CreateTransaction(ctx context.Context, txn *token.Transaction) error {
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO token_transactions
+		(user_id, type, amount, from_user_id, to_user_id, points_converted, description, actor, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		txn.UserID, txn.Type, txn.Amount,
+		sql.NullInt64{Int64: txn.FromUserID, Valid: txn.FromUserID != 0},
+		sql.NullInt64{Int64: txn.ToUserID, Valid: txn.ToUserID != 0},
+		txn.PointsConverted, txn.Description, nullString(txn.Actor), txn.CreatedAt, txn.UpdatedAt,
+	).Scan(&txn.ID)
+}
+
+const transactionColumns = `id, user_id, type, amount, COALESCE(from_user_id, 0), COALESCE(to_user_id, 0),
+	COALESCE(points_converted, 0), COALESCE(description, ''), COALESCE(actor, ''), created_at, updated_at`
+
+func scanTransaction(row interface{ Scan(...any) error }) (*token.Transaction, error) {
+	txn := &token.Transaction{}
+	err := row.Scan(
+		&txn.ID, &txn.UserID, &txn.Type, &txn.Amount, &txn.FromUserID, &txn.ToUserID,
+		&txn.PointsConverted, &txn.Description, &txn.Actor, &txn.CreatedAt, &txn.UpdatedAt)
+	return txn, err
+}
+
+func (r *tokenRepo) GetTransaction(ctx context.Context, id int64) (*token.Transaction, error) {
+	txn, err := scanTransaction(r.q.QueryRowContext(ctx,
+		`SELECT `+transactionColumns+`
+		FROM token_transactions WHERE id = $1`,
+		id))
+	if err == sql.ErrNoRows {
+		return nil, token.ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return txn, nil
+}
+
+func (r *tokenRepo) ListTransactions(ctx context.Context, userID int64, limit, offset int) ([]*token.Transaction, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+transactionColumns+`
+		FROM token_transactions
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`,
+		userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []*token.Transaction
+	for rows.Next() {
+		txn, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, txn)
+	}
+	return transactions, rows.Err()
+}
@@ -0,0 +1,265 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vws-backend/internal/service/user"
+)
+
+type userRepo struct {
+	conn
+}
+
+func (r *userRepo) WithTx(ctx context.Context, fn func(user.Repository) error) error {
+	return r.withTx(ctx, func(c conn) error {
+		return fn(&userRepo{c})
+	})
+}
+
+func (r *userRepo) CreateUser(ctx context.Context, u *user.User) error {
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO users (username, email, password, points, streak, last_login, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		u.Username, u.Email, u.Password, u.Points, u.Streak,
+		nullTime(u.LastLogin), u.CreatedAt, u.UpdatedAt,
+	).Scan(&u.ID)
+	if isUniqueViolation(err) {
+		return user.ErrUserExists
+	}
+	return err
+}
+
+func (r *userRepo) GetUser(ctx context.Context, id int64) (*user.User, error) {
+	u := &user.User{}
+	var lastLogin sql.NullTime
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, username, email, points, streak, last_login, created_at, updated_at
+		FROM users
+		WHERE id = $1`,
+		id,
+	).Scan(&u.ID, &u.Username, &u.Email, &u.Points, &u.Streak, &lastLogin, &u.CreatedAt, &u.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, user.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.LastLogin = lastLogin.Time
+	return u, nil
+}
+
+func (r *userRepo) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	u := &user.User{}
+	var lastLogin sql.NullTime
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, username, email, password, points, streak, last_login, created_at, updated_at
+		FROM users
+		WHERE email = $1`,
+		email,
+	).Scan(&u.ID, &u.Username, &u.Email, &u.Password, &u.Points, &u.Streak, &lastLogin, &u.CreatedAt, &u.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, user.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.LastLogin = lastLogin.Time
+	return u, nil
+}
+
+func (r *userRepo) AddPoints(ctx context.Context, userID, points int64, at time.Time) error {
+	return r.exec(ctx, user.ErrUserNotFound,
+		`UPDATE users
+		SET points = points + $1, updated_at = $2
+		WHERE id = $3`,
+		points, at, userID)
+}
+
+func (r *userRepo) RecordLogin(ctx context.Context, userID int64, at time.Time) error {
+	err := r.exec(ctx, user.ErrUserNotFound,
+		`UPDATE users
+		SET streak = streak + 1, last_login = $1, updated_at = $1
+		WHERE id = $2 AND (
+			last_login IS NULL OR
+			(EXTRACT(EPOCH FROM ($1 - last_login)) <= 86400)
+		)`,
+		at, userID)
+	if err != user.ErrUserNotFound {
+		return err
+	}
+
+	// Reset streak if more than 24 hours have passed
+	return r.exec(ctx, user.ErrUserNotFound,
+		`UPDATE users
+		SET streak = 1, last_login = $1, updated_at = $1
+		WHERE id = $2`,
+		at, userID)
+}
+
+func (r *userRepo) Leaderboard(ctx context.Context, limit int) ([]*user.User, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, username, points, streak
+		FROM users
+		ORDER BY points DESC, id
+		LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*user.User
+	for rows.Next() {
+		u := &user.User{}
+		if err := rows.Scan(&u.ID, &u.Username, &u.Points, &u.Streak); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *userRepo) GetRole(ctx context.Context, userID int64) (string, error) {
+	var role string
+	err := r.q.QueryRowContext(ctx,
+		`SELECT role FROM users WHERE id = $1`,
+		userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", user.ErrUserNotFound
+	}
+	return role, err
+}
+
+func (r *userRepo) SetRole(ctx context.Context, userID int64, role string, at time.Time) error {
+	return r.exec(ctx, user.ErrUserNotFound,
+		`UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`,
+		role, at, userID)
+}
+
+func (r *userRepo) CreateSession(ctx context.Context, session *user.Session) error {
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO sessions (user_id, user_agent, ip_address, expires_at, last_used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		session.UserID, session.UserAgent, session.IPAddress,
+		session.ExpiresAt, session.LastUsedAt, session.CreatedAt,
+	).Scan(&session.ID)
+}
+
+func (r *userRepo) GetSession(ctx context.Context, id int64) (*user.Session, error) {
+	session := &user.Session{}
+	var userAgent, ipAddress, revokeReason sql.NullString
+	var revokedAt sql.NullTime
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, user_id, user_agent, ip_address, expires_at, last_used_at,
+		revoked_at, revoke_reason, created_at
+		FROM sessions WHERE id = $1`,
+		id,
+	).Scan(
+		&session.ID, &session.UserID, &userAgent, &ipAddress,
+		&session.ExpiresAt, &session.LastUsedAt, &revokedAt, &revokeReason,
+		&session.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, user.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session.UserAgent = userAgent.String
+	session.IPAddress = ipAddress.String
+	session.RevokeReason = revokeReason.String
+	session.RevokedAt = timePtr(revokedAt)
+	return session, nil
+}
+
+func (r *userRepo) ListActiveSessions(ctx context.Context, userID int64, now time.Time) ([]*user.Session, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, user_id, user_agent, ip_address, expires_at, last_used_at, created_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC, id DESC`,
+		userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*user.Session
+	for rows.Next() {
+		session := &user.Session{}
+		var userAgent, ipAddress sql.NullString
+		err := rows.Scan(
+			&session.ID, &session.UserID, &userAgent, &ipAddress,
+			&session.ExpiresAt, &session.LastUsedAt, &session.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		session.UserAgent = userAgent.String
+		session.IPAddress = ipAddress.String
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *userRepo) TouchSession(ctx context.Context, sessionID int64, expiresAt, lastUsedAt time.Time) error {
+	return r.exec(ctx, user.ErrSessionNotFound,
+		`UPDATE sessions SET expires_at = $1, last_used_at = $2 WHERE id = $3`,
+		expiresAt, lastUsedAt, sessionID)
+}
+
+func (r *userRepo) RevokeSession(ctx context.Context, userID, sessionID int64, reason string, at time.Time) error {
+	return r.exec(ctx, user.ErrSessionNotFound,
+		`UPDATE sessions SET revoked_at = $1, revoke_reason = $2
+		WHERE id = $3 AND user_id = $4 AND revoked_at IS NULL`,
+		at, reason, sessionID, userID)
+}
+
+func (r *userRepo) RevokeAllSessions(ctx context.Context, userID int64, reason string, at time.Time) error {
+	_, err := r.q.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = $1, revoke_reason = $2
+		WHERE user_id = $3 AND revoked_at IS NULL`,
+		at, reason, userID)
+	return err
+}
+
+func (r *userRepo) CreateRefreshToken(ctx context.Context, token *user.RefreshToken) error {
+	return r.q.QueryRowContext(ctx,
+		`INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`,
+		token.SessionID, token.TokenHash, token.ExpiresAt,
+	).Scan(&token.ID)
+}
+
+func (r *userRepo) GetRefreshToken(ctx context.Context, tokenHash string) (*user.RefreshToken, error) {
+	token := &user.RefreshToken{TokenHash: tokenHash}
+	var usedAt, revokedAt sql.NullTime
+	err := r.q.QueryRowContext(ctx,
+		`SELECT rt.id, rt.expires_at, rt.used_at, s.id, s.user_id, s.revoked_at
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		WHERE rt.token_hash = $1`+r.forUpdate(),
+		tokenHash,
+	).Scan(&token.ID, &token.ExpiresAt, &usedAt, &token.SessionID, &token.UserID, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, user.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.UsedAt = timePtr(usedAt)
+	token.SessionRevokedAt = timePtr(revokedAt)
+	return token, nil
+}
+
+func (r *userRepo) MarkRefreshTokenUsed(ctx context.Context, tokenID int64, at time.Time) error {
+	return r.exec(ctx, user.ErrInvalidRefreshToken,
+		`UPDATE refresh_tokens SET used_at = $1 WHERE id = $2`,
+		at, tokenID)
+}
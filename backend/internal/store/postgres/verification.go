@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"vws-backend/internal/service/verification"
+)
+
+type verificationRepo struct {
+	conn
+}
+
+func (r *verificationRepo) CreateCertificate(ctx context.Context, cert *verification.Certificate) error {
+	_, err := r.q.ExecContext(ctx,
+		`INSERT INTO certificates (id, user_id, election_id, hash, blockchain_txn, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		cert.ID, cert.UserID, cert.ElectionID, cert.Hash, nullString(cert.BlockchainTxn), cert.CreatedAt)
+	if isUniqueViolation(err) {
+		return verification.ErrCertificateExists
+	}
+	return err
+}
+
+func (r *verificationRepo) ReplaceCertificate(ctx context.Context, oldID string, cert *verification.Certificate) error {
+	return r.withTx(ctx, func(tx conn) error {
+		err := tx.exec(ctx, verification.ErrCertificateNotFound,
+			`DELETE FROM certificates WHERE id = $1`, oldID)
+		if err != nil {
+			return err
+		}
+		return (&verificationRepo{tx}).CreateCertificate(ctx, cert)
+	})
+}
+
+const certificateColumns = `id, user_id, election_id, hash, COALESCE(blockchain_txn, ''), created_at`
+
+func scanCertificate(row interface{ Scan(...any) error }) (*verification.Certificate, error) {
+	cert := &verification.Certificate{}
+	err := row.Scan(&cert.ID, &cert.UserID, &cert.ElectionID, &cert.Hash, &cert.BlockchainTxn, &cert.CreatedAt)
+	return cert, err
+}
+
+func (r *verificationRepo) GetCertificate(ctx context.Context, id string) (*verification.Certificate, error) {
+	cert, err := scanCertificate(r.q.QueryRowContext(ctx,
+		`SELECT `+certificateColumns+` FROM certificates WHERE id = $1`,
+		id))
+	if err == sql.ErrNoRows {
+		return nil, verification.ErrCertificateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (r *verificationRepo) ListCertificates(ctx context.Context, userID int64) ([]*verification.Certificate, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+certificateColumns+`
+		FROM certificates WHERE user_id = $1
+		ORDER BY created_at DESC, id`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var certs []*verification.Certificate
+	for rows.Next() {
+		cert, err := scanCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, rows.Err()
+}
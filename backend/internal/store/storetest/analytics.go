@@ -0,0 +1,188 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/analytics"
+	"vws-backend/internal/service/token"
+	"vws-backend/internal/service/user"
+)
+
+func testAnalytics(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	// Three days of data, with late evening activity in a timezone west of
+	// UTC that falls on the next UTC day
+	day1 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	day3 := day1.AddDate(0, 0, 2)
+	west := time.FixedZone("UTC-5", -5*60*60)
+
+	seed := func(t *testing.T) (Store, []*user.User) {
+		store := newStore(t)
+		var users []*user.User
+		for i, name := range []string{"alice", "bob", "carol"} {
+			at := day1.Add(time.Duration(i) * 25 * time.Hour)
+			u := &user.User{
+				Username: name, Email: name + "@example.com", Password: "x",
+				CreatedAt: at, UpdatedAt: at,
+			}
+			require.NoError(t, store.Users().CreateUser(ctx, u))
+			users = append(users, u)
+		}
+		alice, bob, carol := users[0], users[1], users[2]
+
+		repo := store.Analytics()
+		for _, activity := range []*analytics.Activity{
+			{UserID: alice.ID, Type: "LOGIN", CreatedAt: day1.Add(time.Hour)},
+			{UserID: alice.ID, Type: "VOTE", Metadata: map[string]any{"success": true}, CreatedAt: day1.Add(2 * time.Hour)},
+			{UserID: bob.ID, Type: "VOTE", Metadata: map[string]any{"success": false}, CreatedAt: time.Date(2024, 3, 1, 20, 0, 0, 0, west)},
+			{UserID: alice.ID, Type: "LOGIN", CreatedAt: day2.Add(3 * time.Hour)},
+			{UserID: carol.ID, Type: "VOTE", Metadata: map[string]any{"success": true}, CreatedAt: day3.Add(time.Hour)},
+		} {
+			require.NoError(t, repo.CreateActivity(ctx, activity))
+			assert.NotZero(t, activity.ID)
+		}
+
+		for _, txn := range []*token.Transaction{
+			{UserID: alice.ID, Type: token.TypeEarn, Amount: 10, CreatedAt: day1.Add(time.Hour)},
+			{UserID: alice.ID, Type: token.TypeStake, Amount: 4, CreatedAt: day1.Add(2 * time.Hour)},
+			{UserID: bob.ID, Type: token.TypeEarn, Amount: 2.5, CreatedAt: day2.Add(time.Hour)},
+			{UserID: carol.ID, Type: token.TypeEarn, Amount: 100, CreatedAt: day3.Add(time.Hour)},
+		} {
+			txn.UpdatedAt = txn.CreatedAt
+			require.NoError(t, store.Tokens().CreateTransaction(ctx, txn))
+		}
+		return store, users
+	}
+
+	first := analytics.Period{From: day1, To: day2}
+	both := analytics.Period{From: day1, To: day3}
+
+	t.Run("Counts", func(t *testing.T) {
+		store, users := seed(t)
+		repo := store.Analytics()
+
+		n, err := repo.CountUsers(ctx, both)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n, "carol signed up on day three")
+
+		n, err = repo.CountUsers(ctx, analytics.Period{To: day3.AddDate(0, 0, 1)})
+		require.NoError(t, err)
+		assert.Equal(t, 3, n, "a zero start counts from the beginning")
+
+		n, err = repo.CountActiveUsers(ctx, first)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n, "bob's evening activity is on the second UTC day")
+
+		n, err = repo.CountActiveUsers(ctx, both)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		n, err = repo.CountRetainedUsers(ctx, first, analytics.Period{From: day2, To: day3})
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		n, err = repo.CountActivities(ctx, analytics.ActivityFilter{}, both)
+		require.NoError(t, err)
+		assert.Equal(t, 4, n)
+
+		n, err = repo.CountActivities(ctx, analytics.ActivityFilter{Type: "VOTE"}, both)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		n, err = repo.CountActivities(ctx, analytics.ActivityFilter{Type: "VOTE", Successful: true}, both)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		n, err = repo.CountActivities(ctx, analytics.ActivityFilter{UserID: users[0].ID}, both)
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		counts, err := repo.ActivityCounts(ctx, both)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"LOGIN": 2, "VOTE": 2}, counts)
+	})
+
+	t.Run("Daily", func(t *testing.T) {
+		store, _ := seed(t)
+		repo := store.Analytics()
+		all := analytics.Period{From: day1, To: day3.AddDate(0, 0, 1)}
+
+		active, err := repo.DailyActiveUsers(ctx, all)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"2024-03-01": 1, "2024-03-02": 2, "2024-03-03": 1}, active)
+
+		signups, err := repo.DailyNewUsers(ctx, all)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"2024-03-01": 1, "2024-03-02": 1, "2024-03-03": 1}, signups)
+
+		volume, err := repo.DailyTokenVolume(ctx, all)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{"2024-03-01": 14, "2024-03-02": 2.5, "2024-03-03": 100}, volume)
+
+		active, err = repo.DailyActiveUsers(ctx, analytics.Period{From: day1.AddDate(1, 0, 0), To: day1.AddDate(1, 0, 1)})
+		require.NoError(t, err)
+		assert.Empty(t, active)
+	})
+
+	t.Run("TokenVolume", func(t *testing.T) {
+		store, _ := seed(t)
+		repo := store.Analytics()
+
+		volume, err := repo.TokenVolume(ctx, both)
+		require.NoError(t, err)
+		assert.Equal(t, analytics.TokenVolume{Total: 16.5, Staked: 4, Transactions: 3, Users: 2}, volume)
+
+		volume, err = repo.TokenVolume(ctx, analytics.Period{From: day3.AddDate(0, 0, 1), To: day3.AddDate(0, 0, 2)})
+		require.NoError(t, err)
+		assert.Zero(t, volume)
+	})
+
+	t.Run("Records", func(t *testing.T) {
+		store, users := seed(t)
+		repo := store.Analytics()
+		at := now()
+
+		metric := &analytics.DailyMetric{Date: day1, Type: "dau", Value: 1, Metadata: map[string]any{"k": "v"}, CreatedAt: at}
+		require.NoError(t, repo.CreateDailyMetric(ctx, metric))
+		assert.NotZero(t, metric.ID)
+
+		engagement := &analytics.UserEngagement{
+			UserID: users[0].ID, Type: "sessions", Value: 3, StartDate: day1, EndDate: day2, CreatedAt: at,
+		}
+		require.NoError(t, repo.CreateEngagement(ctx, engagement))
+		assert.NotZero(t, engagement.ID)
+
+		report := &analytics.Report{
+			Type: "summary", Data: map[string]any{"users": 3}, StartDate: day1, EndDate: day3, CreatedAt: at,
+		}
+		require.NoError(t, repo.CreateReport(ctx, report))
+		assert.NotZero(t, report.ID)
+	})
+
+	t.Run("TxRollback", func(t *testing.T) {
+		store, users := seed(t)
+		repo := store.Analytics()
+
+		err := repo.WithTx(ctx, func(tx analytics.Repository) error {
+			require.NoError(t, tx.CreateActivity(ctx, &analytics.Activity{
+				UserID: users[1].ID, Type: "LOGIN", CreatedAt: day1.Add(time.Hour),
+			}))
+			n, err := tx.CountActiveUsers(ctx, first)
+			require.NoError(t, err)
+			assert.Equal(t, 2, n, "the transaction sees its own writes")
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+
+		n, err := repo.CountActiveUsers(ctx, first)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+}
@@ -0,0 +1,330 @@
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/service/user"
+)
+
+func testEnterprise(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	// seed creates an organization owned by alice
+	seed := func(t *testing.T) (Store, *user.User, *enterprise.Organization) {
+		store := newStore(t)
+		alice := createUser(t, store, "alice")
+		at := now()
+		org := &enterprise.Organization{
+			Name:         "Acme",
+			ContactEmail: "contact@acme.test",
+			CreatedBy:    alice.ID,
+			CreatedAt:    at,
+			UpdatedAt:    at,
+		}
+		require.NoError(t, store.Enterprise().CreateOrganization(ctx, org))
+		require.NoError(t, store.Enterprise().AddMember(ctx, &enterprise.Member{
+			OrganizationID: org.ID, UserID: alice.ID, Role: enterprise.RoleOwner, CreatedAt: at, UpdatedAt: at,
+		}))
+		return store, alice, org
+	}
+
+	t.Run("Organizations", func(t *testing.T) {
+		store, alice, org := seed(t)
+		repo := store.Enterprise()
+		assert.NotZero(t, org.ID)
+
+		got, err := repo.GetOrganization(ctx, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme", got.Name)
+		assert.Equal(t, alice.ID, got.CreatedBy)
+		assert.Empty(t, got.Description)
+		assert.JSONEq(t, `{}`, string(got.Settings), "settings default to an empty object")
+		assertTime(t, org.CreatedAt, got.CreatedAt)
+
+		got.Description = "Widgets"
+		got.Domain = "acme.test"
+		got.Settings = json.RawMessage(`{"theme": "dark"}`)
+		got.UpdatedAt = got.UpdatedAt.Add(time.Minute)
+		require.NoError(t, repo.UpdateOrganization(ctx, got))
+
+		updated, err := repo.GetOrganization(ctx, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Widgets", updated.Description)
+		assert.Equal(t, "acme.test", updated.Domain)
+		assert.JSONEq(t, `{"theme": "dark"}`, string(updated.Settings))
+		assertTime(t, got.UpdatedAt, updated.UpdatedAt)
+
+		_, err = repo.GetOrganization(ctx, 404)
+		assert.Equal(t, enterprise.ErrOrganizationNotFound, err)
+		assert.Equal(t, enterprise.ErrOrganizationNotFound,
+			repo.UpdateOrganization(ctx, &enterprise.Organization{ID: 404, Name: "x", ContactEmail: "x"}))
+	})
+
+	t.Run("Members", func(t *testing.T) {
+		store, alice, org := seed(t)
+		repo := store.Enterprise()
+		bob := createUser(t, store, "bob")
+		carol := createUser(t, store, "carol")
+
+		at := now()
+		member := &enterprise.Member{OrganizationID: org.ID, UserID: bob.ID, Role: enterprise.RoleMember, CreatedAt: at, UpdatedAt: at}
+		require.NoError(t, repo.AddMember(ctx, member))
+		assert.NotZero(t, member.ID)
+		assert.Equal(t, enterprise.ErrMemberExists, repo.AddMember(ctx, &enterprise.Member{
+			OrganizationID: org.ID, UserID: bob.ID, Role: enterprise.RoleAdmin, CreatedAt: at, UpdatedAt: at,
+		}))
+
+		got, err := repo.GetMember(ctx, org.ID, bob.ID)
+		require.NoError(t, err)
+		assert.Equal(t, enterprise.RoleMember, got.Role)
+		assert.JSONEq(t, `{}`, string(got.Permissions))
+
+		_, err = repo.GetMember(ctx, org.ID, carol.ID)
+		assert.Equal(t, enterprise.ErrMemberNotFound, err)
+
+		require.NoError(t, repo.UpdateMemberRole(ctx, org.ID, bob.ID, enterprise.RoleOwner, at))
+		require.NoError(t, repo.UpdateMemberPermissions(ctx, org.ID, bob.ID, json.RawMessage(`{"votes": ["create"]}`), at))
+		got, err = repo.GetMember(ctx, org.ID, bob.ID)
+		require.NoError(t, err)
+		assert.Equal(t, enterprise.RoleOwner, got.Role)
+		assert.JSONEq(t, `{"votes": ["create"]}`, string(got.Permissions))
+
+		assert.Equal(t, enterprise.ErrMemberNotFound, repo.UpdateMemberRole(ctx, org.ID, carol.ID, enterprise.RoleAdmin, at))
+		assert.Equal(t, enterprise.ErrMemberNotFound, repo.UpdateMemberPermissions(ctx, org.ID, carol.ID, nil, at))
+
+		owners, err := repo.ListOwners(ctx, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{alice.ID, bob.ID}, owners)
+
+		owners, err = repo.ListOwners(ctx, 404)
+		require.NoError(t, err)
+		assert.Empty(t, owners)
+	})
+
+	t.Run("APIKeys", func(t *testing.T) {
+		store, alice, org := seed(t)
+		repo := store.Enterprise()
+
+		at := now()
+		newKey := func(name string) *enterprise.APIKey {
+			key := &enterprise.APIKey{
+				OrganizationID: org.ID,
+				Name:           name,
+				Key:            "plaintext-" + name,
+				Scopes:         []string{enterprise.ScopeRead, enterprise.ScopeWrite},
+				RateLimit:      100,
+				ExpiresAt:      at.Add(time.Hour),
+				CreatedBy:      alice.ID,
+				CreatedAt:      at,
+				UpdatedAt:      at,
+			}
+			require.NoError(t, repo.CreateAPIKey(ctx, key, "hash-"+name))
+			return key
+		}
+		first := newKey("first")
+		second := newKey("second")
+
+		got, err := repo.GetAPIKeyByHash(ctx, "hash-first")
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, got.ID)
+		assert.Empty(t, got.Key, "the plaintext key is never stored")
+		assert.Equal(t, []string{enterprise.ScopeRead, enterprise.ScopeWrite}, got.Scopes)
+		assert.Equal(t, 100, got.RateLimit)
+		assertTime(t, first.ExpiresAt, got.ExpiresAt)
+		assert.True(t, got.LastUsedAt.IsZero())
+
+		_, err = repo.GetAPIKeyByHash(ctx, "unknown")
+		assert.Equal(t, enterprise.ErrInvalidAPIKey, err)
+
+		require.NoError(t, repo.TouchAPIKey(ctx, first.ID, at.Add(time.Minute)))
+		assert.Equal(t, enterprise.ErrAPIKeyNotFound, repo.TouchAPIKey(ctx, 404, at))
+
+		keys, err := repo.ListAPIKeys(ctx, org.ID)
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+		assert.Equal(t, first.ID, keys[0].ID)
+		assertTime(t, at.Add(time.Minute), keys[0].LastUsedAt)
+		assert.Equal(t, second.ID, keys[1].ID)
+
+		assert.Equal(t, enterprise.ErrAPIKeyNotFound, repo.DeleteAPIKey(ctx, org.ID+1, first.ID),
+			"keys are deleted only through their organization")
+		require.NoError(t, repo.DeleteAPIKey(ctx, org.ID, first.ID))
+		assert.Equal(t, enterprise.ErrAPIKeyNotFound, repo.DeleteAPIKey(ctx, org.ID, first.ID))
+
+		_, err = repo.GetAPIKeyByHash(ctx, "hash-first")
+		assert.Equal(t, enterprise.ErrInvalidAPIKey, err)
+		keys, err = repo.ListAPIKeys(ctx, org.ID)
+		require.NoError(t, err)
+		assert.Len(t, keys, 1)
+	})
+
+	t.Run("Votes", func(t *testing.T) {
+		store, alice, org := seed(t)
+		repo := store.Enterprise()
+		bob := createUser(t, store, "bob")
+
+		at := now()
+		vs := &enterprise.VotingSystem{
+			OrganizationID: org.ID,
+			Name:           "Board",
+			VotingType:     "MAJORITY",
+			Active:         true,
+			CreatedBy:      alice.ID,
+			CreatedAt:      at,
+			UpdatedAt:      at,
+		}
+		require.NoError(t, repo.CreateVotingSystem(ctx, vs))
+
+		gotVS, err := repo.GetVotingSystem(ctx, vs.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Board", gotVS.Name)
+		assert.True(t, gotVS.Active)
+		assert.JSONEq(t, `{}`, string(gotVS.Config))
+		_, err = repo.GetVotingSystem(ctx, 404)
+		assert.Equal(t, enterprise.ErrVotingSystemNotFound, err)
+
+		systems, err := repo.ListVotingSystems(ctx, org.ID)
+		require.NoError(t, err)
+		require.Len(t, systems, 1)
+		assert.Equal(t, vs.ID, systems[0].ID)
+
+		vote := &enterprise.Vote{
+			VotingSystemID: vs.ID,
+			Title:          "Budget",
+			Options:        json.RawMessage(`["yes", "no"]`),
+			StartDate:      at,
+			EndDate:        at.Add(24 * time.Hour),
+			Status:         enterprise.VoteStatusPending,
+			CreatedBy:      alice.ID,
+			CreatedAt:      at,
+			UpdatedAt:      at,
+		}
+		require.NoError(t, repo.CreateVote(ctx, vote))
+
+		gotVote, err := repo.GetVote(ctx, vote.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Budget", gotVote.Title)
+		assert.JSONEq(t, `["yes", "no"]`, string(gotVote.Options))
+		assert.Nil(t, gotVote.Result)
+		assertTime(t, vote.EndDate, gotVote.EndDate)
+		_, err = repo.GetVote(ctx, 404)
+		assert.Equal(t, enterprise.ErrVoteNotFound, err)
+
+		orgID, err := repo.GetVoteOrganization(ctx, vote.ID)
+		require.NoError(t, err)
+		assert.Equal(t, org.ID, orgID)
+		_, err = repo.GetVoteOrganization(ctx, 404)
+		assert.Equal(t, enterprise.ErrVoteNotFound, err)
+
+		for _, voter := range []*user.User{alice, bob} {
+			resp := &enterprise.VoteResponse{
+				VoteID: vote.ID, UserID: voter.ID, Response: json.RawMessage(`{"option": "yes"}`),
+				Weight: 1.5, CreatedAt: at, UpdatedAt: at,
+			}
+			require.NoError(t, repo.CreateVoteResponse(ctx, resp))
+			assert.NotZero(t, resp.ID)
+		}
+		assert.Equal(t, enterprise.ErrVoteAlreadySubmitted, repo.CreateVoteResponse(ctx, &enterprise.VoteResponse{
+			VoteID: vote.ID, UserID: bob.ID, Response: json.RawMessage(`{"option": "no"}`),
+			Weight: 1, CreatedAt: at, UpdatedAt: at,
+		}))
+
+		responses, err := repo.ListVoteResponses(ctx, vote.ID)
+		require.NoError(t, err)
+		require.Len(t, responses, 2)
+		assert.Equal(t, alice.ID, responses[0].UserID)
+		assert.Equal(t, 1.5, responses[0].Weight)
+		assert.JSONEq(t, `{"option": "yes"}`, string(responses[1].Response))
+
+		require.NoError(t, repo.SaveVoteResult(ctx, vote.ID, enterprise.VoteStatusCompleted,
+			json.RawMessage(`{"winner": "yes"}`), at.Add(time.Hour)))
+		gotVote, err = repo.GetVote(ctx, vote.ID)
+		require.NoError(t, err)
+		assert.Equal(t, enterprise.VoteStatusCompleted, gotVote.Status)
+		assert.JSONEq(t, `{"winner": "yes"}`, string(gotVote.Result))
+		assertTime(t, at.Add(time.Hour), gotVote.UpdatedAt)
+		assert.Equal(t, enterprise.ErrVoteNotFound,
+			repo.SaveVoteResult(ctx, 404, enterprise.VoteStatusCompleted, json.RawMessage(`{}`), at))
+	})
+
+	t.Run("WhiteLabel", func(t *testing.T) {
+		store, _, org := seed(t)
+		repo := store.Enterprise()
+
+		got, err := repo.GetWhiteLabelSettings(ctx, org.ID)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+
+		at := now()
+		settings := &enterprise.WhiteLabelSettings{
+			OrganizationID: org.ID,
+			Domain:         "Vote.Acme.test",
+			CustomCSS:      "body {}",
+			Enabled:        true,
+			UpdatedAt:      at,
+		}
+		require.NoError(t, repo.SaveWhiteLabelSettings(ctx, settings))
+		assert.NotZero(t, settings.ID)
+		assertTime(t, at, settings.CreatedAt)
+
+		domains, err := repo.ListWhiteLabelDomains(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"vote.acme.test"}, domains, "in lower case")
+
+		replaced := &enterprise.WhiteLabelSettings{
+			OrganizationID: org.ID,
+			Domain:         "vote.acme.test",
+			ThemeConfig:    json.RawMessage(`{"primary": "#000"}`),
+			Enabled:        false,
+			UpdatedAt:      at.Add(time.Hour),
+		}
+		require.NoError(t, repo.SaveWhiteLabelSettings(ctx, replaced))
+		assert.Equal(t, settings.ID, replaced.ID)
+		assertTime(t, at, replaced.CreatedAt, "replacing keeps the creation time")
+
+		got, err = repo.GetWhiteLabelSettings(ctx, org.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Empty(t, got.CustomCSS)
+		assert.False(t, got.Enabled)
+		assert.JSONEq(t, `{"primary": "#000"}`, string(got.ThemeConfig))
+		assertTime(t, at.Add(time.Hour), got.UpdatedAt)
+
+		domains, err = repo.ListWhiteLabelDomains(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, domains, "disabled settings don't count")
+	})
+
+	t.Run("TxRollback", func(t *testing.T) {
+		store, alice, org := seed(t)
+		repo := store.Enterprise()
+		bob := createUser(t, store, "bob")
+
+		err := repo.WithTx(ctx, func(tx enterprise.Repository) error {
+			at := now()
+			require.NoError(t, tx.AddMember(ctx, &enterprise.Member{
+				OrganizationID: org.ID, UserID: bob.ID, Role: enterprise.RoleOwner, CreatedAt: at, UpdatedAt: at,
+			}))
+			require.NoError(t, tx.UpdateMemberRole(ctx, org.ID, alice.ID, enterprise.RoleMember, at))
+
+			owners, err := tx.ListOwners(ctx, org.ID)
+			require.NoError(t, err)
+			assert.Equal(t, []int64{bob.ID}, owners)
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+
+		owners, err := repo.ListOwners(ctx, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{alice.ID}, owners)
+		_, err = repo.GetMember(ctx, org.ID, bob.ID)
+		assert.Equal(t, enterprise.ErrMemberNotFound, err)
+	})
+}
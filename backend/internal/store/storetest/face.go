@@ -0,0 +1,221 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/face"
+)
+
+func testFaces(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	t.Run("Embeddings", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Faces()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+
+		base := now()
+		vector := []float32{0.6, -0.8, 0}
+		require.NoError(t, repo.CreateEmbedding(ctx, &face.Embedding{
+			UserID: alice.ID, Vector: vector, CreatedAt: base, UpdatedAt: base,
+		}))
+		vector[0] = 1 // The repository keeps its own copy
+		assert.Equal(t, face.ErrAlreadyEnrolled, repo.CreateEmbedding(ctx, &face.Embedding{
+			UserID: alice.ID, Vector: []float32{1}, CreatedAt: base, UpdatedAt: base,
+		}), "one embedding per user")
+
+		got, err := repo.GetEmbedding(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, got.UserID)
+		assert.Equal(t, []float32{0.6, -0.8, 0}, got.Vector)
+		assertTime(t, base, got.CreatedAt)
+		assertTime(t, base, got.UpdatedAt)
+
+		_, err = repo.GetEmbedding(ctx, bob.ID)
+		assert.Equal(t, face.ErrNotEnrolled, err)
+
+		updated := &face.Embedding{UserID: alice.ID, Vector: []float32{0, 1}, UpdatedAt: base.Add(time.Minute)}
+		require.NoError(t, repo.UpdateEmbedding(ctx, updated))
+		assertTime(t, base, updated.CreatedAt, "the enrollment time is kept")
+		got, err = repo.GetEmbedding(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []float32{0, 1}, got.Vector)
+		assertTime(t, base, got.CreatedAt)
+		assertTime(t, base.Add(time.Minute), got.UpdatedAt)
+		assert.Equal(t, face.ErrNotEnrolled, repo.UpdateEmbedding(ctx, &face.Embedding{
+			UserID: bob.ID, Vector: []float32{1}, UpdatedAt: base,
+		}))
+
+		require.NoError(t, repo.DeleteEmbedding(ctx, alice.ID))
+		_, err = repo.GetEmbedding(ctx, alice.ID)
+		assert.Equal(t, face.ErrNotEnrolled, err)
+		assert.Equal(t, face.ErrNotEnrolled, repo.DeleteEmbedding(ctx, alice.ID))
+	})
+	t.Run("ListEmbeddings", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Faces()
+		users := []int64{createUser(t, store, "alice").ID, createUser(t, store, "bob").ID, createUser(t, store, "carol").ID}
+
+		at := now()
+		for i, id := range users {
+			require.NoError(t, repo.CreateEmbedding(ctx, &face.Embedding{
+				UserID: id, Vector: []float32{float32(i), 1}, CreatedAt: at, UpdatedAt: at,
+			}))
+		}
+
+		got, err := repo.ListEmbeddings(ctx, 0, 2)
+		require.NoError(t, err)
+		require.Len(t, got, 2, "a page")
+		assert.Equal(t, users[0], got[0].UserID)
+		assert.Equal(t, []float32{0, 1}, got[0].Vector)
+		assert.Equal(t, users[1], got[1].UserID)
+
+		got, err = repo.ListEmbeddings(ctx, got[1].UserID, 2)
+		require.NoError(t, err)
+		require.Len(t, got, 1, "the rest, after the last user")
+		assert.Equal(t, users[2], got[0].UserID)
+		assert.Equal(t, []float32{2, 1}, got[0].Vector)
+	})
+
+	t.Run("Duplicates", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Faces()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+		carol := createUser(t, store, "carol")
+		admin := createUser(t, store, "admin")
+
+		base := now()
+		first := &face.Duplicate{
+			UserID: bob.ID, MatchedUserID: alice.ID, Similarity: 0.75, Status: face.DuplicatePending, CreatedAt: base,
+		}
+		require.NoError(t, repo.CreateDuplicate(ctx, first))
+		assert.NotZero(t, first.ID)
+		assert.Equal(t, face.ErrDuplicateFlagged, repo.CreateDuplicate(ctx, &face.Duplicate{
+			UserID: alice.ID, MatchedUserID: bob.ID, Similarity: 0.8, Status: face.DuplicatePending, CreatedAt: base,
+		}), "a pair is flagged once, either way round")
+		second := &face.Duplicate{
+			UserID: carol.ID, MatchedUserID: alice.ID, Similarity: 0.6, Status: face.DuplicatePending, CreatedAt: base.Add(time.Minute),
+		}
+		require.NoError(t, repo.CreateDuplicate(ctx, second))
+
+		all, err := repo.ListDuplicates(ctx, "", 10, 0)
+		require.NoError(t, err)
+		require.Len(t, all, 2)
+		assert.Equal(t, first.ID, all[0].ID, "oldest first")
+		assert.Equal(t, bob.ID, all[0].UserID)
+		assert.Equal(t, alice.ID, all[0].MatchedUserID)
+		assert.InDelta(t, 0.75, all[0].Similarity, 1e-6)
+		assert.Equal(t, face.DuplicatePending, all[0].Status)
+		assert.Zero(t, all[0].ReviewedBy)
+		assert.Nil(t, all[0].ReviewedAt)
+		assertTime(t, base, all[0].CreatedAt)
+		page, err := repo.ListDuplicates(ctx, "", 1, 1)
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, second.ID, page[0].ID)
+
+		confirmed, err := repo.IsConfirmedDuplicate(ctx, bob.ID)
+		require.NoError(t, err)
+		assert.False(t, confirmed, "pending")
+
+		reviewedAt := base.Add(time.Hour)
+		review := &face.Duplicate{ID: first.ID, Status: face.DuplicateConfirmed, ReviewedBy: admin.ID, ReviewedAt: &reviewedAt}
+		require.NoError(t, repo.ReviewDuplicate(ctx, review))
+		assert.Equal(t, bob.ID, review.UserID, "filled in from the stored duplicate")
+		assert.Equal(t, alice.ID, review.MatchedUserID)
+		assertTime(t, base, review.CreatedAt)
+		require.NoError(t, repo.ReviewDuplicate(ctx, &face.Duplicate{
+			ID: second.ID, Status: face.DuplicateDismissed, ReviewedBy: admin.ID, ReviewedAt: &reviewedAt,
+		}))
+		assert.Equal(t, face.ErrDuplicateNotFound, repo.ReviewDuplicate(ctx, &face.Duplicate{
+			ID: second.ID + 100, Status: face.DuplicateDismissed, ReviewedBy: admin.ID, ReviewedAt: &reviewedAt,
+		}))
+
+		got, err := repo.ListDuplicates(ctx, face.DuplicateConfirmed, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, first.ID, got[0].ID)
+		assert.Equal(t, admin.ID, got[0].ReviewedBy)
+		require.NotNil(t, got[0].ReviewedAt)
+		assertTime(t, reviewedAt, *got[0].ReviewedAt)
+		got, err = repo.ListDuplicates(ctx, face.DuplicatePending, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+
+		for _, tt := range []struct {
+			userID int64
+			want   bool
+		}{
+			{bob.ID, true},
+			{alice.ID, false}, // Enrolled first
+			{carol.ID, false}, // Dismissed
+		} {
+			confirmed, err := repo.IsConfirmedDuplicate(ctx, tt.userID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, confirmed, "user %d", tt.userID)
+		}
+	})
+
+	t.Run("Tx", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Faces()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+
+		// An enrollment rolled back takes its duplicates with it
+		base := now()
+		err := repo.WithTx(ctx, func(tx face.Repository) error {
+			require.NoError(t, tx.CreateEmbedding(ctx, &face.Embedding{
+				UserID: bob.ID, Vector: []float32{1, 0}, CreatedAt: base, UpdatedAt: base,
+			}))
+			require.NoError(t, tx.CreateDuplicate(ctx, &face.Duplicate{
+				UserID: bob.ID, MatchedUserID: alice.ID, Similarity: 0.9, Status: face.DuplicatePending, CreatedAt: base,
+			}))
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+
+		_, err = repo.GetEmbedding(ctx, bob.ID)
+		assert.Equal(t, face.ErrNotEnrolled, err)
+		all, err := repo.ListDuplicates(ctx, "", 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, all)
+	})
+
+	t.Run("Challenges", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Faces()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+
+		base := now()
+		issued := &face.IssuedChallenge{ID: "first", UserID: alice.ID, Challenge: face.ChallengeBlink, ExpiresAt: base.Add(time.Minute)}
+		require.NoError(t, repo.SaveChallenge(ctx, issued))
+		replaced := &face.IssuedChallenge{ID: "second", UserID: alice.ID, Challenge: face.ChallengeTurnLeft, ExpiresAt: base.Add(time.Minute)}
+		require.NoError(t, repo.SaveChallenge(ctx, replaced))
+
+		_, err := repo.TakeChallenge(ctx, alice.ID, "first", base)
+		assert.Equal(t, face.ErrChallengeNotFound, err, "replaced by the second")
+		_, err = repo.TakeChallenge(ctx, bob.ID, "second", base)
+		assert.Equal(t, face.ErrChallengeNotFound, err, "issued to alice")
+
+		got, err := repo.TakeChallenge(ctx, alice.ID, "second", base)
+		require.NoError(t, err)
+		assert.Equal(t, face.ChallengeTurnLeft, got.Challenge)
+		assert.Equal(t, alice.ID, got.UserID)
+		assertTime(t, base.Add(time.Minute), got.ExpiresAt)
+		_, err = repo.TakeChallenge(ctx, alice.ID, "second", base)
+		assert.Equal(t, face.ErrChallengeNotFound, err, "taken once")
+
+		require.NoError(t, repo.SaveChallenge(ctx, issued))
+		_, err = repo.TakeChallenge(ctx, alice.ID, "first", base.Add(time.Minute))
+		assert.Equal(t, face.ErrChallengeNotFound, err, "expired")
+	})
+}
@@ -0,0 +1,71 @@
+// Package storetest is the conformance suite for storage backends. Every
+// backend runs the same tests, so the services behave alike on all of them.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/analytics"
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/service/face"
+	"vws-backend/internal/service/token"
+	"vws-backend/internal/service/user"
+	"vws-backend/internal/service/verification"
+)
+
+// Store is a storage backend handing out the repository of every service
+type Store interface {
+	Users() user.Repository
+	Tokens() token.Repository
+	Verification() verification.Repository
+	Faces() face.Repository
+	Analytics() analytics.Repository
+	Enterprise() enterprise.Repository
+}
+
+// Run runs the suite. newStore is called once per test and must return an
+// empty store.
+func Run(t *testing.T, newStore func(t *testing.T) Store) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newStore) })
+	t.Run("Tokens", func(t *testing.T) { testTokens(t, newStore) })
+	t.Run("Verification", func(t *testing.T) { testVerification(t, newStore) })
+	t.Run("Faces", func(t *testing.T) { testFaces(t, newStore) })
+	t.Run("Analytics", func(t *testing.T) { testAnalytics(t, newStore) })
+	t.Run("Enterprise", func(t *testing.T) { testEnterprise(t, newStore) })
+}
+
+var errRollback = errors.New("rollback")
+
+// now is a base time every backend stores exactly
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// assertTime compares instants regardless of location
+func assertTime(t *testing.T, want, got time.Time, msgAndArgs ...any) {
+	t.Helper()
+	assert.WithinDuration(t, want, got, 0, msgAndArgs...)
+}
+
+// createUser stores a user with the given name
+func createUser(t *testing.T, store Store, name string) *user.User {
+	t.Helper()
+
+	at := now()
+	u := &user.User{
+		Username:  name,
+		Email:     name + "@example.com",
+		Password:  "hash-" + name,
+		LastLogin: at,
+		CreatedAt: at,
+		UpdatedAt: at,
+	}
+	require.NoError(t, store.Users().CreateUser(context.Background(), u))
+	return u
+}
@@ -0,0 +1,269 @@
+package storetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/token"
+)
+
+func testTokens(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	balance := func(t *testing.T, repo token.Repository, userID int64) float64 {
+		t.Helper()
+		account, err := repo.GetAccount(ctx, userID)
+		require.NoError(t, err)
+		return account.Balance
+	}
+
+	t.Run("DeductPoints", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Tokens()
+		alice := createUser(t, store, "alice")
+		require.NoError(t, store.Users().AddPoints(ctx, alice.ID, 100, now()))
+
+		require.NoError(t, repo.DeductPoints(ctx, alice.ID, 60))
+		assert.Equal(t, token.ErrInsufficientPoints, repo.DeductPoints(ctx, alice.ID, 60))
+		assert.Equal(t, token.ErrUserNotFound, repo.DeductPoints(ctx, 404, 1))
+
+		got, err := store.Users().GetUser(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(40), got.Points)
+	})
+
+	t.Run("Balance", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Tokens()
+		alice := createUser(t, store, "alice")
+
+		_, err := repo.GetAccount(ctx, alice.ID)
+		assert.Equal(t, token.ErrNoAccount, err)
+		assert.Equal(t, token.ErrInsufficientBalance, repo.Debit(ctx, alice.ID, 1))
+
+		require.NoError(t, repo.Credit(ctx, alice.ID, 10))
+		require.NoError(t, repo.Credit(ctx, alice.ID, 5))
+		assert.Equal(t, 15.0, balance(t, repo, alice.ID))
+
+		require.NoError(t, repo.Debit(ctx, alice.ID, 15))
+		assert.Equal(t, token.ErrInsufficientBalance, repo.Debit(ctx, alice.ID, 0.5))
+		assert.Zero(t, balance(t, repo, alice.ID))
+	})
+
+	t.Run("Stake", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Tokens()
+		alice := createUser(t, store, "alice")
+		require.NoError(t, repo.Credit(ctx, alice.ID, 100))
+
+		start := now()
+		end := start.AddDate(0, 0, 30)
+		assert.Equal(t, token.ErrInsufficientBalance, repo.Stake(ctx, alice.ID, 101, 30, start, end))
+		assert.Equal(t, token.ErrInsufficientBalance, repo.Stake(ctx, 404, 1, 30, start, end))
+		require.NoError(t, repo.Stake(ctx, alice.ID, 40, 30, start, end))
+
+		account, err := repo.GetAccount(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 60.0, account.Balance)
+		assert.Equal(t, 40.0, account.StakedAmount)
+		assert.Equal(t, 30, account.StakeDuration)
+		assertTime(t, start, account.LastStakeDate)
+		assertTime(t, end, account.StakeEndDate)
+
+		require.NoError(t, repo.ReleaseStake(ctx, alice.ID, 42))
+		account, err = repo.GetAccount(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 102.0, account.Balance)
+		assert.Zero(t, account.StakedAmount)
+		assert.Zero(t, account.StakeDuration)
+		assert.True(t, account.StakeEndDate.IsZero())
+
+		assert.Equal(t, token.ErrNoAccount, repo.ReleaseStake(ctx, 404, 1))
+	})
+
+	t.Run("Transactions", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Tokens()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+
+		base := now()
+		var created []*token.Transaction
+		for i := range 5 {
+			at := base.Add(time.Duration(i) * time.Minute)
+			txn := &token.Transaction{
+				UserID:    alice.ID,
+				Type:      token.TypeEarn,
+				Amount:    float64(i + 1),
+				CreatedAt: at,
+				UpdatedAt: at,
+			}
+			require.NoError(t, repo.CreateTransaction(ctx, txn))
+			created = append(created, txn)
+		}
+		transfer := &token.Transaction{
+			UserID:      bob.ID,
+			Type:        token.TypeTransfer,
+			Amount:      3,
+			FromUserID:  alice.ID,
+			ToUserID:    bob.ID,
+			Description: "gift",
+			CreatedAt:   base,
+			UpdatedAt:   base,
+		}
+		require.NoError(t, repo.CreateTransaction(ctx, transfer))
+
+		got, err := repo.GetTransaction(ctx, transfer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, token.TypeTransfer, got.Type)
+		assert.Equal(t, alice.ID, got.FromUserID)
+		assert.Equal(t, bob.ID, got.ToUserID)
+		assert.Equal(t, "gift", got.Description)
+		assert.Empty(t, got.Actor)
+		assertTime(t, base, got.CreatedAt)
+
+		_, err = repo.GetTransaction(ctx, 404)
+		assert.Equal(t, token.ErrTransactionNotFound, err)
+
+		adjustment := &token.Transaction{
+			UserID:      bob.ID,
+			Type:        token.TypeAdjust,
+			Amount:      -1.5,
+			Description: "refund reversal",
+			Actor:       "ops@example.com",
+			CreatedAt:   base,
+			UpdatedAt:   base,
+		}
+		require.NoError(t, repo.CreateTransaction(ctx, adjustment))
+		got, err = repo.GetTransaction(ctx, adjustment.ID)
+		require.NoError(t, err)
+		assert.Equal(t, -1.5, got.Amount)
+		assert.Equal(t, "ops@example.com", got.Actor)
+
+		page, err := repo.ListTransactions(ctx, alice.ID, 2, 1)
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, created[3].ID, page[0].ID, "newest first")
+		assert.Equal(t, created[2].ID, page[1].ID)
+		assert.Zero(t, page[0].FromUserID)
+
+		page, err = repo.ListTransactions(ctx, alice.ID, 10, 4)
+		require.NoError(t, err)
+		assert.Len(t, page, 1)
+
+		page, err = repo.ListTransactions(ctx, alice.ID, 10, 10)
+		require.NoError(t, err)
+		assert.Empty(t, page)
+	})
+
+	t.Run("TxRollback", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Tokens()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+		require.NoError(t, repo.Credit(ctx, alice.ID, 10))
+
+		// A transfer failing half way leaves both balances untouched
+		err := repo.WithTx(ctx, func(tx token.Repository) error {
+			if err := tx.Debit(ctx, alice.ID, 4); err != nil {
+				return err
+			}
+			if err := tx.Credit(ctx, bob.ID, 4); err != nil {
+				return err
+			}
+			at := now()
+			if err := tx.CreateTransaction(ctx, &token.Transaction{
+				UserID: alice.ID, Type: token.TypeTransfer, Amount: 4, CreatedAt: at, UpdatedAt: at,
+			}); err != nil {
+				return err
+			}
+			return tx.Debit(ctx, alice.ID, 100)
+		})
+		assert.Equal(t, token.ErrInsufficientBalance, err)
+
+		assert.Equal(t, 10.0, balance(t, repo, alice.ID))
+		_, err = repo.GetAccount(ctx, bob.ID)
+		assert.Equal(t, token.ErrNoAccount, err)
+		transactions, err := repo.ListTransactions(ctx, alice.ID, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, transactions)
+	})
+
+	t.Run("TxNested", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Tokens()
+		alice := createUser(t, store, "alice")
+
+		err := repo.WithTx(ctx, func(tx token.Repository) error {
+			require.NoError(t, tx.Credit(ctx, alice.ID, 5))
+			return tx.WithTx(ctx, func(inner token.Repository) error {
+				assert.Equal(t, 5.0, balance(t, inner, alice.ID))
+				return inner.Credit(ctx, alice.ID, 5)
+			})
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 10.0, balance(t, repo, alice.ID))
+	})
+
+	t.Run("TxCrossRepository", func(t *testing.T) {
+		store := newStore(t)
+		alice := createUser(t, store, "alice")
+		require.NoError(t, store.Users().AddPoints(ctx, alice.ID, 10, now()))
+
+		err := store.Tokens().WithTx(ctx, func(tx token.Repository) error {
+			require.NoError(t, tx.DeductPoints(ctx, alice.ID, 10))
+			require.NoError(t, tx.Credit(ctx, alice.ID, 1))
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+
+		got, err := store.Users().GetUser(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), got.Points, "points deducted in the transaction are restored")
+	})
+
+	t.Run("ConcurrentDebits", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Tokens()
+		alice := createUser(t, store, "alice")
+		require.NoError(t, repo.Credit(ctx, alice.ID, 10))
+
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			succeeded int
+		)
+		for range 25 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := repo.WithTx(ctx, func(tx token.Repository) error {
+					account, err := tx.GetAccount(ctx, alice.ID)
+					if err != nil {
+						return err
+					}
+					if account.Balance < 1 {
+						return token.ErrInsufficientBalance
+					}
+					return tx.Debit(ctx, alice.ID, 1)
+				})
+				if err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				} else {
+					assert.Equal(t, token.ErrInsufficientBalance, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 10, succeeded)
+		assert.Zero(t, balance(t, repo, alice.ID), "the balance is never overdrawn")
+	})
+}
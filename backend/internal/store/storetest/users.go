@@ -0,0 +1,311 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/user"
+)
+
+func testUsers(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Users()
+		alice := createUser(t, store, "alice")
+		assert.NotZero(t, alice.ID)
+
+		got, err := repo.GetUser(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", got.Username)
+		assert.Equal(t, "alice@example.com", got.Email)
+		assert.Empty(t, got.Password, "GetUser must not return the password hash")
+		assertTime(t, alice.CreatedAt, got.CreatedAt)
+
+		got, err = repo.GetUserByEmail(ctx, "alice@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, got.ID)
+		assert.Equal(t, "hash-alice", got.Password)
+
+		role, err := repo.GetRole(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.RoleUser, role)
+
+		require.NoError(t, repo.SetRole(ctx, alice.ID, user.RoleAdmin, now()))
+		role, err = repo.GetRole(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.RoleAdmin, role)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newStore(t).Users()
+
+		_, err := repo.GetUser(ctx, 404)
+		assert.Equal(t, user.ErrUserNotFound, err)
+		_, err = repo.GetUserByEmail(ctx, "nobody@example.com")
+		assert.Equal(t, user.ErrUserNotFound, err)
+		_, err = repo.GetRole(ctx, 404)
+		assert.Equal(t, user.ErrUserNotFound, err)
+		assert.Equal(t, user.ErrUserNotFound, repo.AddPoints(ctx, 404, 1, now()))
+		assert.Equal(t, user.ErrUserNotFound, repo.RecordLogin(ctx, 404, now()))
+		assert.Equal(t, user.ErrUserNotFound, repo.SetRole(ctx, 404, user.RoleAdmin, now()))
+	})
+
+	t.Run("Duplicates", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Users()
+		createUser(t, store, "alice")
+
+		at := now()
+		err := repo.CreateUser(ctx, &user.User{
+			Username: "alice", Email: "other@example.com", Password: "x",
+			CreatedAt: at, UpdatedAt: at,
+		})
+		assert.Equal(t, user.ErrUserExists, err)
+
+		err = repo.CreateUser(ctx, &user.User{
+			Username: "other", Email: "alice@example.com", Password: "x",
+			CreatedAt: at, UpdatedAt: at,
+		})
+		assert.Equal(t, user.ErrUserExists, err)
+	})
+
+	t.Run("PointsAndLeaderboard", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Users()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+		carol := createUser(t, store, "carol")
+
+		require.NoError(t, repo.AddPoints(ctx, alice.ID, 10, now()))
+		require.NoError(t, repo.AddPoints(ctx, bob.ID, 30, now()))
+		require.NoError(t, repo.AddPoints(ctx, carol.ID, 10, now()))
+		require.NoError(t, repo.AddPoints(ctx, alice.ID, -5, now()))
+
+		leaders, err := repo.Leaderboard(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, leaders, 3)
+		assert.Equal(t, []int64{bob.ID, carol.ID, alice.ID},
+			[]int64{leaders[0].ID, leaders[1].ID, leaders[2].ID})
+		assert.Equal(t, int64(30), leaders[0].Points)
+		assert.Equal(t, "bob", leaders[0].Username)
+		assert.Empty(t, leaders[0].Email)
+
+		leaders, err = repo.Leaderboard(ctx, 2)
+		require.NoError(t, err)
+		assert.Len(t, leaders, 2)
+	})
+
+	t.Run("LoginStreak", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Users()
+		alice := createUser(t, store, "alice")
+
+		streak := func() int {
+			got, err := repo.GetUser(ctx, alice.ID)
+			require.NoError(t, err)
+			return got.Streak
+		}
+
+		at := alice.LastLogin.Add(time.Hour)
+		require.NoError(t, repo.RecordLogin(ctx, alice.ID, at))
+		assert.Equal(t, 1, streak())
+
+		at = at.Add(24 * time.Hour)
+		require.NoError(t, repo.RecordLogin(ctx, alice.ID, at))
+		assert.Equal(t, 2, streak())
+
+		at = at.Add(25 * time.Hour)
+		require.NoError(t, repo.RecordLogin(ctx, alice.ID, at))
+		assert.Equal(t, 1, streak())
+
+		got, err := repo.GetUser(ctx, alice.ID)
+		require.NoError(t, err)
+		assertTime(t, at, got.LastLogin)
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Users()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+
+		at := now()
+		newSession := func(userID int64, lastUsed, expires time.Time) *user.Session {
+			session := &user.Session{
+				UserID:     userID,
+				UserAgent:  "test",
+				IPAddress:  "127.0.0.1",
+				ExpiresAt:  expires,
+				LastUsedAt: lastUsed,
+				CreatedAt:  lastUsed,
+			}
+			require.NoError(t, repo.CreateSession(ctx, session))
+			return session
+		}
+		older := newSession(alice.ID, at.Add(-2*time.Hour), at.Add(time.Hour))
+		newer := newSession(alice.ID, at.Add(-time.Hour), at.Add(time.Hour))
+		newSession(alice.ID, at.Add(-3*time.Hour), at.Add(-time.Minute))
+		other := newSession(bob.ID, at, at.Add(time.Hour))
+
+		got, err := repo.GetSession(ctx, newer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, got.UserID)
+		assert.Equal(t, "127.0.0.1", got.IPAddress)
+		assert.Nil(t, got.RevokedAt)
+
+		_, err = repo.GetSession(ctx, 404)
+		assert.Equal(t, user.ErrSessionNotFound, err)
+
+		active, err := repo.ListActiveSessions(ctx, alice.ID, at)
+		require.NoError(t, err)
+		require.Len(t, active, 2)
+		assert.Equal(t, newer.ID, active[0].ID)
+		assert.Equal(t, older.ID, active[1].ID)
+
+		require.NoError(t, repo.TouchSession(ctx, older.ID, at.Add(2*time.Hour), at))
+		active, err = repo.ListActiveSessions(ctx, alice.ID, at)
+		require.NoError(t, err)
+		require.Len(t, active, 2)
+		assert.Equal(t, older.ID, active[0].ID)
+		assertTime(t, at.Add(2*time.Hour), active[0].ExpiresAt)
+		assert.Equal(t, user.ErrSessionNotFound, repo.TouchSession(ctx, 404, at, at))
+
+		assert.Equal(t, user.ErrSessionNotFound,
+			repo.RevokeSession(ctx, alice.ID, other.ID, user.RevokeReasonRevoked, at),
+			"a user can't revoke another user's session")
+		require.NoError(t, repo.RevokeSession(ctx, alice.ID, older.ID, user.RevokeReasonRevoked, at))
+		assert.Equal(t, user.ErrSessionNotFound,
+			repo.RevokeSession(ctx, alice.ID, older.ID, user.RevokeReasonRevoked, at),
+			"a session is revoked only once")
+
+		got, err = repo.GetSession(ctx, older.ID)
+		require.NoError(t, err)
+		require.NotNil(t, got.RevokedAt)
+		assertTime(t, at, *got.RevokedAt)
+		assert.Equal(t, user.RevokeReasonRevoked, got.RevokeReason)
+
+		require.NoError(t, repo.RevokeAllSessions(ctx, alice.ID, user.RevokeReasonReuseDetected, at))
+		active, err = repo.ListActiveSessions(ctx, alice.ID, at)
+		require.NoError(t, err)
+		assert.Empty(t, active)
+
+		got, err = repo.GetSession(ctx, older.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.RevokeReasonRevoked, got.RevokeReason, "revoked sessions keep their reason")
+
+		active, err = repo.ListActiveSessions(ctx, bob.ID, at)
+		require.NoError(t, err)
+		assert.Len(t, active, 1)
+	})
+
+	t.Run("RefreshTokens", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Users()
+		alice := createUser(t, store, "alice")
+
+		at := now()
+		session := &user.Session{UserID: alice.ID, ExpiresAt: at.Add(time.Hour), LastUsedAt: at, CreatedAt: at}
+		require.NoError(t, repo.CreateSession(ctx, session))
+
+		rt := &user.RefreshToken{SessionID: session.ID, TokenHash: "hash-1", ExpiresAt: at.Add(time.Hour)}
+		require.NoError(t, repo.CreateRefreshToken(ctx, rt))
+		assert.NotZero(t, rt.ID)
+
+		got, err := repo.GetRefreshToken(ctx, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, rt.ID, got.ID)
+		assert.Equal(t, session.ID, got.SessionID)
+		assert.Equal(t, alice.ID, got.UserID)
+		assertTime(t, rt.ExpiresAt, got.ExpiresAt)
+		assert.Nil(t, got.UsedAt)
+		assert.Nil(t, got.SessionRevokedAt)
+
+		_, err = repo.GetRefreshToken(ctx, "unknown")
+		assert.Equal(t, user.ErrInvalidRefreshToken, err)
+
+		require.NoError(t, repo.MarkRefreshTokenUsed(ctx, rt.ID, at))
+		require.NoError(t, repo.RevokeSession(ctx, alice.ID, session.ID, user.RevokeReasonRevoked, at))
+
+		got, err = repo.GetRefreshToken(ctx, "hash-1")
+		require.NoError(t, err)
+		require.NotNil(t, got.UsedAt)
+		assertTime(t, at, *got.UsedAt)
+		require.NotNil(t, got.SessionRevokedAt)
+		assertTime(t, at, *got.SessionRevokedAt)
+
+		assert.Equal(t, user.ErrInvalidRefreshToken, repo.MarkRefreshTokenUsed(ctx, 404, at))
+	})
+
+	t.Run("TxCommit", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Users()
+
+		var id int64
+		err := repo.WithTx(ctx, func(tx user.Repository) error {
+			at := now()
+			u := &user.User{Username: "alice", Email: "alice@example.com", Password: "x", CreatedAt: at, UpdatedAt: at}
+			if err := tx.CreateUser(ctx, u); err != nil {
+				return err
+			}
+			id = u.ID
+			return tx.AddPoints(ctx, u.ID, 5, at)
+		})
+		require.NoError(t, err)
+
+		got, err := repo.GetUser(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), got.Points)
+	})
+
+	t.Run("TxRollback", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Users()
+		alice := createUser(t, store, "alice")
+
+		err := repo.WithTx(ctx, func(tx user.Repository) error {
+			require.NoError(t, tx.AddPoints(ctx, alice.ID, 5, now()))
+			at := now()
+			require.NoError(t, tx.CreateUser(ctx, &user.User{
+				Username: "bob", Email: "bob@example.com", Password: "x", CreatedAt: at, UpdatedAt: at,
+			}))
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+
+		got, err := repo.GetUser(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Zero(t, got.Points)
+		_, err = repo.GetUserByEmail(ctx, "bob@example.com")
+		assert.Equal(t, user.ErrUserNotFound, err)
+	})
+
+	t.Run("TxNested", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Users()
+		alice := createUser(t, store, "alice")
+
+		err := repo.WithTx(ctx, func(tx user.Repository) error {
+			require.NoError(t, tx.AddPoints(ctx, alice.ID, 5, now()))
+			err := tx.WithTx(ctx, func(inner user.Repository) error {
+				return inner.AddPoints(ctx, alice.ID, 7, now())
+			})
+			require.NoError(t, err)
+
+			got, err := tx.GetUser(ctx, alice.ID)
+			require.NoError(t, err)
+			assert.Equal(t, int64(12), got.Points, "the inner transaction sees and joins the outer one")
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+
+		got, err := repo.GetUser(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Zero(t, got.Points, "the outer rollback undoes the inner transaction")
+	})
+}
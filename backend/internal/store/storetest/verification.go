@@ -0,0 +1,97 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/service/verification"
+)
+
+func testVerification(t *testing.T, newStore func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	t.Run("Certificates", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Verification()
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+
+		base := now()
+		newCert := func(id string, userID int64, election string, at time.Time) *verification.Certificate {
+			return &verification.Certificate{
+				ID:            id,
+				UserID:        userID,
+				ElectionID:    election,
+				Hash:          "hash-" + id,
+				BlockchainTxn: "0x" + id,
+				CreatedAt:     at,
+			}
+		}
+		require.NoError(t, repo.CreateCertificate(ctx, newCert("c1", alice.ID, "e1", base)))
+		require.NoError(t, repo.CreateCertificate(ctx, newCert("c2", alice.ID, "e2", base.Add(time.Minute))))
+		require.NoError(t, repo.CreateCertificate(ctx, newCert("c3", bob.ID, "e1", base)))
+
+		assert.Equal(t, verification.ErrCertificateExists,
+			repo.CreateCertificate(ctx, newCert("c4", alice.ID, "e1", base)),
+			"one certificate per user and election")
+		assert.Equal(t, verification.ErrCertificateExists,
+			repo.CreateCertificate(ctx, newCert("c1", bob.ID, "e3", base)),
+			"certificate IDs are unique")
+
+		got, err := repo.GetCertificate(ctx, "c2")
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, got.UserID)
+		assert.Equal(t, "e2", got.ElectionID)
+		assert.Equal(t, "hash-c2", got.Hash)
+		assert.Equal(t, "0xc2", got.BlockchainTxn)
+		assertTime(t, base.Add(time.Minute), got.CreatedAt)
+
+		_, err = repo.GetCertificate(ctx, "unknown")
+		assert.Equal(t, verification.ErrCertificateNotFound, err)
+
+		certs, err := repo.ListCertificates(ctx, alice.ID)
+		require.NoError(t, err)
+		require.Len(t, certs, 2)
+		assert.Equal(t, "c2", certs[0].ID, "newest first")
+		assert.Equal(t, "c1", certs[1].ID)
+
+		certs, err = repo.ListCertificates(ctx, 404)
+		require.NoError(t, err)
+		assert.Empty(t, certs)
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		store := newStore(t)
+		repo := store.Verification()
+		alice := createUser(t, store, "alice")
+
+		base := now()
+		require.NoError(t, repo.CreateCertificate(ctx, &verification.Certificate{
+			ID: "c1", UserID: alice.ID, ElectionID: "e1", Hash: "hash-c1", CreatedAt: base,
+		}))
+		require.NoError(t, repo.CreateCertificate(ctx, &verification.Certificate{
+			ID: "c2", UserID: alice.ID, ElectionID: "e2", Hash: "hash-c2", CreatedAt: base,
+		}))
+
+		replacement := &verification.Certificate{ID: "c3", UserID: alice.ID, ElectionID: "e1", Hash: "hash-c3", CreatedAt: base}
+		require.NoError(t, repo.ReplaceCertificate(ctx, "c1", replacement),
+			"the replacement may take the user's place in the election")
+		_, err := repo.GetCertificate(ctx, "c1")
+		assert.Equal(t, verification.ErrCertificateNotFound, err)
+		got, err := repo.GetCertificate(ctx, "c3")
+		require.NoError(t, err)
+		assert.Equal(t, "hash-c3", got.Hash)
+
+		assert.Equal(t, verification.ErrCertificateNotFound,
+			repo.ReplaceCertificate(ctx, "c1", &verification.Certificate{ID: "c4", UserID: alice.ID, ElectionID: "e1", CreatedAt: base}))
+
+		clash := &verification.Certificate{ID: "c2", UserID: alice.ID, ElectionID: "e1", Hash: "hash-clash", CreatedAt: base}
+		assert.Equal(t, verification.ErrCertificateExists, repo.ReplaceCertificate(ctx, "c3", clash))
+		_, err = repo.GetCertificate(ctx, "c3")
+		assert.NoError(t, err, "a failed replacement keeps the original")
+	})
+}
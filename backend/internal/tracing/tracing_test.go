@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+
+	"vws-backend/internal/tracing/tracingtest"
+)
+
+func TestStartEnd_RecordsError(t *testing.T) {
+	spans := tracingtest.Install(t)
+
+	failing := func(ctx context.Context) (err error) {
+		_, span := Start(ctx, "test.Failing")
+		defer End(span, &err)
+		return errors.New("boom")
+	}
+	require.Error(t, failing(context.Background()))
+
+	recorded := spans.GetSpans()
+	require.Len(t, recorded, 1)
+	assert.Equal(t, "test.Failing", recorded[0].Name)
+	assert.Equal(t, codes.Error, recorded[0].Status.Code)
+	assert.Equal(t, "boom", recorded[0].Status.Description)
+}
+
+func TestOpenDB_QueriesAreChildSpans(t *testing.T) {
+	spans := tracingtest.Install(t)
+
+	_, mock, err := sqlmock.NewWithDSN("tracing_test")
+	require.NoError(t, err)
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+
+	db, err := OpenDB("sqlmock", "tracing_test")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx, span := Start(context.Background(), "test.Parent")
+	var n int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT 1").Scan(&n))
+	span.End()
+
+	var parentID string
+	queryParents := []string{}
+	for _, s := range spans.GetSpans() {
+		if s.Name == "test.Parent" {
+			parentID = s.SpanContext.SpanID().String()
+			continue
+		}
+		queryParents = append(queryParents, s.Parent.SpanID().String())
+	}
+	require.NotEmpty(t, queryParents, "expected spans for the query")
+	for _, id := range queryParents {
+		assert.Equal(t, parentID, id)
+	}
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "zipkin"})
+	assert.ErrorIs(t, err, ErrUnknownExporter)
+}
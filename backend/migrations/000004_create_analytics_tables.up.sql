@@ -0,0 +1,61 @@
+-- Create enum types
+CREATE TYPE activity_type AS ENUM (
+    'LOGIN', 'LOGOUT', 'REGISTRATION', 'PROFILE_UPDATE',
+    'FACE_DETECTION', 'VERIFICATION', 'VOTE',
+    'TOKEN_CONVERSION', 'TOKEN_STAKE', 'TOKEN_UNSTAKE', 'TOKEN_TRANSFER'
+);
+CREATE TYPE metric_type AS ENUM (
+    'ACTIVE_USERS', 'NEW_USERS', 'VERIFICATIONS', 'TOKEN_VOLUME', 'STAKE_VOLUME',
+    'ENGAGEMENT_RATE', 'RETENTION_RATE', 'ACTIVITY_COUNT', 'VERIFICATION_SUCCESS_RATE'
+);
+
+-- Create user activities table
+CREATE TABLE user_activities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    activity_type activity_type NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Create daily metrics table
+CREATE TABLE daily_metrics (
+    id BIGSERIAL PRIMARY KEY,
+    metric_date DATE NOT NULL,
+    metric_type metric_type NOT NULL,
+    metric_value DECIMAL(20,4) NOT NULL DEFAULT 0,
+    metadata JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Create user engagement table
+CREATE TABLE user_engagement (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    metric_type metric_type NOT NULL,
+    metric_value DECIMAL(20,4) NOT NULL DEFAULT 0,
+    start_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (end_date >= start_date)
+);
+
+-- Create analytics reports table
+CREATE TABLE analytics_reports (
+    id BIGSERIAL PRIMARY KEY,
+    report_type VARCHAR(50) NOT NULL CHECK (report_type IN ('USER_GROWTH', 'PLATFORM_ACTIVITY', 'TOKEN_METRICS')),
+    report_data JSONB NOT NULL,
+    parameters JSONB,
+    start_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes
+CREATE INDEX idx_user_activities_user_id ON user_activities(user_id);
+CREATE INDEX idx_user_activities_type ON user_activities(activity_type);
+CREATE INDEX idx_user_activities_created_at ON user_activities(created_at);
+CREATE INDEX idx_daily_metrics_date_type ON daily_metrics(metric_date, metric_type);
+CREATE INDEX idx_user_engagement_user_id ON user_engagement(user_id);
+CREATE INDEX idx_analytics_reports_type ON analytics_reports(report_type);
+CREATE INDEX idx_analytics_reports_created_at ON analytics_reports(created_at);
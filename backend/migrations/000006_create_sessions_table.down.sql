@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS sessions;
+
+ALTER TABLE users DROP COLUMN IF EXISTS role;
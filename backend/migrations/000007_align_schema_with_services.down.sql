@@ -0,0 +1,6 @@
+ALTER TABLE token_transactions DROP COLUMN IF EXISTS updated_at;
+
+ALTER TABLE tokens DROP CONSTRAINT IF EXISTS tokens_user_id_key;
+
+ALTER TABLE organizations DROP COLUMN IF EXISTS created_by;
+ALTER TABLE organizations DROP COLUMN IF EXISTS domain;
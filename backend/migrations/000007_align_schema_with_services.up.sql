@@ -0,0 +1,8 @@
+-- Columns and constraints the services already rely on
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS domain VARCHAR(255);
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS created_by BIGINT REFERENCES users(id);
+
+-- One token account per user, needed by the ON CONFLICT (user_id) upsert
+ALTER TABLE tokens ADD CONSTRAINT tokens_user_id_key UNIQUE (user_id);
+
+ALTER TABLE token_transactions ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
@@ -0,0 +1,6 @@
+ALTER TABLE token_transactions DROP COLUMN IF EXISTS actor;
+
+-- Adjustments made in the meantime are kept, so existing rows aren't checked
+ALTER TABLE token_transactions DROP CONSTRAINT IF EXISTS token_transactions_type_check;
+ALTER TABLE token_transactions ADD CONSTRAINT token_transactions_type_check
+    CHECK (type IN ('EARN', 'STAKE', 'UNSTAKE', 'TRANSFER')) NOT VALID;
@@ -0,0 +1,7 @@
+-- Operators correct balances with ADJUST transactions, recording who made
+-- the change; the reason goes in the description
+ALTER TABLE token_transactions DROP CONSTRAINT IF EXISTS token_transactions_type_check;
+ALTER TABLE token_transactions ADD CONSTRAINT token_transactions_type_check
+    CHECK (type IN ('EARN', 'STAKE', 'UNSTAKE', 'TRANSFER', 'ADJUST'));
+
+ALTER TABLE token_transactions ADD COLUMN IF NOT EXISTS actor VARCHAR(255);
@@ -0,0 +1,14 @@
+-- Responses to requests sent with an Idempotency-Key, replayed when a
+-- client retries. status is NULL while the first request is in progress.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(512) PRIMARY KEY,
+    fingerprint VARCHAR(64) NOT NULL,
+    status INTEGER,
+    header JSONB,
+    body BYTEA,
+    locked_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
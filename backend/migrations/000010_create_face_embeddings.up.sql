@@ -0,0 +1,8 @@
+-- The reference face each user enrolls for verification, as the embedding
+-- the recognition model computed for it
+CREATE TABLE IF NOT EXISTS face_embeddings (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    embedding REAL[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS face_duplicates;
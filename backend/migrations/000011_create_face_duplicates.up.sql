@@ -0,0 +1,18 @@
+-- Enrolled faces flagged as likely of the same person as another user's,
+-- queued for admins to confirm or dismiss. A pair of users is flagged
+-- once, whichever enrolled first.
+CREATE TABLE IF NOT EXISTS face_duplicates (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    matched_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    similarity REAL NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'CONFIRMED', 'DISMISSED')),
+    reviewed_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_face_duplicates_pair
+    ON face_duplicates(LEAST(user_id, matched_user_id), GREATEST(user_id, matched_user_id));
+CREATE INDEX idx_face_duplicates_status ON face_duplicates(status, created_at);
+CREATE INDEX idx_face_duplicates_user_id ON face_duplicates(user_id);
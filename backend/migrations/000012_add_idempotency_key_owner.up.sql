@@ -0,0 +1,4 @@
+-- The request holding the claim on a key, which alone may complete or
+-- release it. Claims made before the column existed have no owner and run
+-- out with their lock.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS owner VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- Liveness challenges issued to users, one at most per user, answered once
+-- before they expire
+CREATE TABLE IF NOT EXISTS liveness_challenges (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    id VARCHAR(64) NOT NULL,
+    challenge VARCHAR(20) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL schema migrations in the binary
+package migrations
+
+import "embed"
+
+// FS holds the migration files, named <version>_<name>.<up|down>.sql
+//
+//go:embed *.sql
+var FS embed.FS
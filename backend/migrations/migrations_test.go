@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/migrate"
+)
+
+// Every up migration needs a matching down migration and vice versa
+func TestMigrationsArePaired(t *testing.T) {
+	loaded, err := migrate.Load(FS)
+	require.NoError(t, err)
+
+	for i, m := range loaded {
+		assert.Equal(t, uint(i+1), m.Version, "migration versions should be consecutive")
+	}
+}
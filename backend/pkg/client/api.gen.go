@@ -0,0 +1,804 @@
+// Code generated by go run ./internal/gen; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// GetLeaderboard calls GET /api/users/leaderboard: users with the most points
+func (c *Client) GetLeaderboard(ctx context.Context, params GetLeaderboardParams) ([]*User, error) {
+	var out []*User
+	if err := c.do(ctx, http.MethodGet, "/api/users/leaderboard", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Login calls POST /api/users/login: log in and start a session
+func (c *Client) Login(ctx context.Context, body LoginRequest) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, http.MethodPost, "/api/users/login", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetProfile calls GET /api/users/me: profile of the caller
+func (c *Client) GetProfile(ctx context.Context) (*User, error) {
+	var out User
+	if err := c.do(ctx, http.MethodGet, "/api/users/me", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdatePoints calls PUT /api/users/points: add points to the caller
+func (c *Client) UpdatePoints(ctx context.Context, body UpdatePointsRequest) error {
+	return c.do(ctx, http.MethodPut, "/api/users/points", nil, body, nil)
+}
+
+// Refresh calls POST /api/users/refresh: exchange a refresh token for new tokens
+func (c *Client) Refresh(ctx context.Context, body RefreshRequest) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, http.MethodPost, "/api/users/refresh", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Register calls POST /api/users/register: register a user
+func (c *Client) Register(ctx context.Context, body RegisterRequest) (*User, error) {
+	var out User
+	if err := c.do(ctx, http.MethodPost, "/api/users/register", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeAllSessions calls DELETE /api/users/sessions: revoke every session of the caller, or of any user for admins
+func (c *Client) RevokeAllSessions(ctx context.Context, params RevokeAllSessionsParams) error {
+	return c.do(ctx, http.MethodDelete, "/api/users/sessions", params.values(), nil, nil)
+}
+
+// ListSessions calls GET /api/users/sessions: active sessions of the caller, or of any user for admins
+func (c *Client) ListSessions(ctx context.Context, params ListSessionsParams) (*ListSessionsResponse, error) {
+	var out ListSessionsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/users/sessions", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeSession calls DELETE /api/users/sessions/{id}: revoke a session
+func (c *Client) RevokeSession(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/users/sessions/%d", id), nil, nil, nil)
+}
+
+// GetBalance calls GET /api/tokens/balance: token balance and stake of the caller
+func (c *Client) GetBalance(ctx context.Context) (*Token, error) {
+	var out Token
+	if err := c.do(ctx, http.MethodGet, "/api/tokens/balance", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConvertPoints calls POST /api/tokens/convert: convert points to tokens, unless the caller is a confirmed duplicate
+func (c *Client) ConvertPoints(ctx context.Context, body ConvertRequest) (*Transaction, error) {
+	var out Transaction
+	if err := c.do(ctx, http.MethodPost, "/api/tokens/convert", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StakeTokens calls POST /api/tokens/stake: stake tokens for a number of days
+func (c *Client) StakeTokens(ctx context.Context, body StakeRequest) (*Transaction, error) {
+	var out Transaction
+	if err := c.do(ctx, http.MethodPost, "/api/tokens/stake", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTransactions calls GET /api/tokens/transactions: transactions of the caller, newest first
+func (c *Client) GetTransactions(ctx context.Context, params GetTransactionsParams) (*GetTransactionsResponse, error) {
+	var out GetTransactionsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/tokens/transactions", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AllTransactions iterates over every page of GetTransactions, starting at params.Offset
+func (c *Client) AllTransactions(ctx context.Context, params GetTransactionsParams) iter.Seq2[*Transaction, error] {
+	return paginate(params.Limit, params.Offset, func(limit, offset int64) ([]*Transaction, error) {
+		params.Limit, params.Offset = limit, offset
+		page, err := c.GetTransactions(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		return page.Transactions, nil
+	})
+}
+
+// TransferTokens calls POST /api/tokens/transfer: transfer tokens to another user
+func (c *Client) TransferTokens(ctx context.Context, body TransferRequest) (*Transaction, error) {
+	var out Transaction
+	if err := c.do(ctx, http.MethodPost, "/api/tokens/transfer", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UnstakeTokens calls POST /api/tokens/unstake: unstake tokens once the stake period has ended
+func (c *Client) UnstakeTokens(ctx context.Context) (*Transaction, error) {
+	var out Transaction
+	if err := c.do(ctx, http.MethodPost, "/api/tokens/unstake", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCertificate calls GET /api/verification/certificate/{id}: fetch a certificate of the caller
+func (c *Client) GetCertificate(ctx context.Context, id string) (*Certificate, error) {
+	var out Certificate
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/verification/certificate/%s", url.PathEscape(id)), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUserCertificates calls GET /api/verification/certificates: certificates of the caller
+func (c *Client) GetUserCertificates(ctx context.Context) (*GetUserCertificatesResponse, error) {
+	var out GetUserCertificatesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/verification/certificates", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VerifyVoteParticipation calls POST /api/verification/verify: certify participation in an election
+func (c *Client) VerifyVoteParticipation(ctx context.Context, body VerifyRequest) (*Certificate, error) {
+	var out Certificate
+	if err := c.do(ctx, http.MethodPost, "/api/verification/verify", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VerifyCertificate calls POST /api/verification/verify-certificate/{id}: check a certificate against the blockchain
+func (c *Client) VerifyCertificate(ctx context.Context, id string) (*VerifyCertificateResponse, error) {
+	var out VerifyCertificateResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/verification/verify-certificate/%s", url.PathEscape(id)), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TrackActivity calls POST /api/analytics/activities: record an activity of the caller
+func (c *Client) TrackActivity(ctx context.Context, body TrackActivityRequest) (*Status, error) {
+	var out Status
+	if err := c.do(ctx, http.MethodPost, "/api/analytics/activities", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDailyMetrics calls GET /api/analytics/metrics/daily: calculate a metric for a day
+func (c *Client) GetDailyMetrics(ctx context.Context, params GetDailyMetricsParams) (*DailyMetric, error) {
+	var out DailyMetric
+	if err := c.do(ctx, http.MethodGet, "/api/analytics/metrics/daily", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUserEngagement calls GET /api/analytics/metrics/engagement/{userID}: update the engagement of a user over a date range
+func (c *Client) GetUserEngagement(ctx context.Context, userID int64, params GetUserEngagementParams) (*Status, error) {
+	var out Status
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/analytics/metrics/engagement/%d", userID), params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GenerateReport calls POST /api/analytics/reports: generate a report over a date range
+func (c *Client) GenerateReport(ctx context.Context, body GenerateReportRequest) (*Report, error) {
+	var out Report
+	if err := c.do(ctx, http.MethodPost, "/api/analytics/reports", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReport calls GET /api/analytics/reports/{reportID}: fetch a generated report
+func (c *Client) GetReport(ctx context.Context, reportID string) error {
+	return c.do(ctx, http.MethodGet, fmt.Sprintf("/api/analytics/reports/%s", url.PathEscape(reportID)), nil, nil, nil)
+}
+
+// CreateOrganization calls POST /api/enterprise/organizations: create an organization owned by the caller
+func (c *Client) CreateOrganization(ctx context.Context, body OrganizationRequest) (*Organization, error) {
+	var out Organization
+	if err := c.do(ctx, http.MethodPost, "/api/enterprise/organizations", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetOrganization calls GET /api/enterprise/organizations/{id}: fetch an organization
+func (c *Client) GetOrganization(ctx context.Context, id int64) (*Organization, error) {
+	var out Organization
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/enterprise/organizations/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateOrganization calls PUT /api/enterprise/organizations/{id}: update an organization
+func (c *Client) UpdateOrganization(ctx context.Context, id int64, body UpdateOrganizationRequest) (*Organization, error) {
+	var out Organization
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/enterprise/organizations/%d", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAPIKeys calls GET /api/enterprise/organizations/{id}/api-keys: API keys of an organization
+func (c *Client) ListAPIKeys(ctx context.Context, id int64) ([]*APIKey, error) {
+	var out []*APIKey
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/enterprise/organizations/%d/api-keys", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateAPIKey calls POST /api/enterprise/organizations/{id}/api-keys: create an API key, returning its plaintext once
+func (c *Client) CreateAPIKey(ctx context.Context, id int64, body CreateAPIKeyRequest) (*APIKey, error) {
+	var out APIKey
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/enterprise/organizations/%d/api-keys", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeAPIKey calls DELETE /api/enterprise/organizations/{id}/api-keys/{keyId}: revoke an API key
+func (c *Client) RevokeAPIKey(ctx context.Context, id int64, keyID int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/enterprise/organizations/%d/api-keys/%d", id, keyID), nil, nil, nil)
+}
+
+// AddMember calls POST /api/enterprise/organizations/{id}/members: add a member to an organization
+func (c *Client) AddMember(ctx context.Context, id int64, body AddMemberRequest) (*Member, error) {
+	var out Member
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/enterprise/organizations/%d/members", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateMemberPermissions calls PUT /api/enterprise/organizations/{id}/members/{userId}/permissions: replace the permissions of a member
+func (c *Client) UpdateMemberPermissions(ctx context.Context, id int64, userID int64, body UpdateMemberPermissionsRequest) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/api/enterprise/organizations/%d/members/%d/permissions", id, userID), nil, body, nil)
+}
+
+// UpdateMemberRole calls PUT /api/enterprise/organizations/{id}/members/{userId}/role: change the role of a member
+func (c *Client) UpdateMemberRole(ctx context.Context, id int64, userID int64, body UpdateMemberRoleRequest) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/api/enterprise/organizations/%d/members/%d/role", id, userID), nil, body, nil)
+}
+
+// ListVotingSystems calls GET /api/enterprise/organizations/{id}/voting-systems: voting systems of an organization
+func (c *Client) ListVotingSystems(ctx context.Context, id int64) ([]*VotingSystem, error) {
+	var out []*VotingSystem
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/enterprise/organizations/%d/voting-systems", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateVotingSystem calls POST /api/enterprise/organizations/{id}/voting-systems: create a voting system
+func (c *Client) CreateVotingSystem(ctx context.Context, id int64, body CreateVotingSystemRequest) (*VotingSystem, error) {
+	var out VotingSystem
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/enterprise/organizations/%d/voting-systems", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetWhiteLabelSettings calls GET /api/enterprise/organizations/{id}/white-label: white label settings of an organization
+func (c *Client) GetWhiteLabelSettings(ctx context.Context, id int64) (*WhiteLabelSettings, error) {
+	var out WhiteLabelSettings
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/enterprise/organizations/%d/white-label", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateWhiteLabelSettings calls PUT /api/enterprise/organizations/{id}/white-label: configure white labelling
+func (c *Client) UpdateWhiteLabelSettings(ctx context.Context, id int64, body UpdateWhiteLabelRequest) (*WhiteLabelSettings, error) {
+	var out WhiteLabelSettings
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/enterprise/organizations/%d/white-label", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SubmitVoteResponse calls POST /api/enterprise/votes/{id}/responses: cast the caller's response to a vote
+func (c *Client) SubmitVoteResponse(ctx context.Context, id int64, body SubmitVoteResponseRequest) (*VoteResponse, error) {
+	var out VoteResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/enterprise/votes/%d/responses", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetVoteResults calls GET /api/enterprise/votes/{id}/results: tally of a vote
+func (c *Client) GetVoteResults(ctx context.Context, id int64) (map[string]any, error) {
+	var out map[string]any
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/enterprise/votes/%d/results", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateVote calls POST /api/enterprise/voting-systems/{id}/votes: open a vote in a voting system
+func (c *Client) CreateVote(ctx context.Context, id int64, body CreateVoteRequest) (*Vote, error) {
+	var out Vote
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/enterprise/voting-systems/%d/votes", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetLeaderboardParams are the query parameters of GetLeaderboard
+type GetLeaderboardParams struct {
+	Limit int64
+}
+
+func (p GetLeaderboardParams) values() url.Values {
+	q := make(url.Values)
+	if p.Limit != 0 {
+		q.Set("limit", fmt.Sprint(p.Limit))
+	}
+	return q
+}
+
+// User is the user.User schema
+type User struct {
+	CreatedAt time.Time `json:"created_at"`
+	Email     string    `json:"email"`
+	ID        int64     `json:"id"`
+	LastLogin time.Time `json:"last_login"`
+	Points    int64     `json:"points"`
+	Streak    int64     `json:"streak"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Username  string    `json:"username"`
+}
+
+// LoginRequest is the user.loginRequest schema
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// TokenResponse is the user.tokenResponse schema
+type TokenResponse struct {
+	AccessToken      string    `json:"access_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	User             *User     `json:"user,omitempty"`
+}
+
+// UpdatePointsRequest is the user.updatePointsRequest schema
+type UpdatePointsRequest struct {
+	Points int64 `json:"points"`
+}
+
+// RefreshRequest is the user.refreshRequest schema
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RegisterRequest is the user.registerRequest schema
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Username string `json:"username"`
+}
+
+// RevokeAllSessionsParams are the query parameters of RevokeAllSessions
+type RevokeAllSessionsParams struct {
+	UserID int64
+}
+
+func (p RevokeAllSessionsParams) values() url.Values {
+	q := make(url.Values)
+	if p.UserID != 0 {
+		q.Set("user_id", fmt.Sprint(p.UserID))
+	}
+	return q
+}
+
+// ListSessionsParams are the query parameters of ListSessions
+type ListSessionsParams struct {
+	UserID int64
+}
+
+func (p ListSessionsParams) values() url.Values {
+	q := make(url.Values)
+	if p.UserID != 0 {
+		q.Set("user_id", fmt.Sprint(p.UserID))
+	}
+	return q
+}
+
+// Session is the user.Session schema
+type Session struct {
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	ID           int64      `json:"id"`
+	IPAddress    string     `json:"ip_address"`
+	LastUsedAt   time.Time  `json:"last_used_at"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	UserAgent    string     `json:"user_agent"`
+	UserID       int64      `json:"user_id"`
+}
+
+// ListSessionsResponse is described in place by the API document
+type ListSessionsResponse struct {
+	CurrentSession int64      `json:"current_session"`
+	Sessions       []*Session `json:"sessions"`
+}
+
+// Token is the token.Token schema
+type Token struct {
+	Balance       float64   `json:"balance"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ID            int64     `json:"id"`
+	LastStakeDate time.Time `json:"lastStakeDate,omitempty"`
+	StakeDuration int64     `json:"stakeDuration,omitempty"`
+	StakeEndDate  time.Time `json:"stakeEndDate,omitempty"`
+	StakedAmount  float64   `json:"stakedAmount"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	UserID        int64     `json:"userId"`
+}
+
+// ConvertRequest is the token.ConvertRequest schema
+type ConvertRequest struct {
+	Points int64 `json:"points"`
+}
+
+// Transaction is the token.Transaction schema
+type Transaction struct {
+	Actor           string    `json:"actor,omitempty"`
+	Amount          float64   `json:"amount"`
+	CreatedAt       time.Time `json:"created_at"`
+	Description     string    `json:"description"`
+	FromUserID      int64     `json:"from_user_id,omitempty"`
+	ID              int64     `json:"id"`
+	PointsConverted int64     `json:"points_converted"`
+	ToUserID        int64     `json:"to_user_id,omitempty"`
+	Type            string    `json:"type"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	UserID          int64     `json:"user_id"`
+}
+
+// StakeRequest is the token.StakeRequest schema
+type StakeRequest struct {
+	Amount       float64 `json:"amount"`
+	DurationDays int64   `json:"durationDays"`
+}
+
+// GetTransactionsParams are the query parameters of GetTransactions
+type GetTransactionsParams struct {
+	Limit  int64
+	Offset int64
+}
+
+func (p GetTransactionsParams) values() url.Values {
+	q := make(url.Values)
+	if p.Limit != 0 {
+		q.Set("limit", fmt.Sprint(p.Limit))
+	}
+	if p.Offset != 0 {
+		q.Set("offset", fmt.Sprint(p.Offset))
+	}
+	return q
+}
+
+// GetTransactionsResponsePagination is described in place by the API document
+type GetTransactionsResponsePagination struct {
+	Limit  int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+// GetTransactionsResponse is described in place by the API document
+type GetTransactionsResponse struct {
+	Pagination   GetTransactionsResponsePagination `json:"pagination"`
+	Transactions []*Transaction                    `json:"transactions"`
+}
+
+// TransferRequest is the token.TransferRequest schema
+type TransferRequest struct {
+	Amount   float64 `json:"amount"`
+	ToUserID int64   `json:"toUserId"`
+}
+
+// Certificate is the verification.Certificate schema
+type Certificate struct {
+	BlockchainTxn string    `json:"blockchainTxn"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ElectionID    string    `json:"electionId"`
+	Hash          string    `json:"hash"`
+	ID            string    `json:"id"`
+	UserID        int64     `json:"userId"`
+}
+
+// GetUserCertificatesResponse is described in place by the API document
+type GetUserCertificatesResponse struct {
+	Certificates []*Certificate `json:"certificates"`
+}
+
+// VerifyRequest is the verification.VerifyRequest schema
+type VerifyRequest struct {
+	ElectionID string `json:"electionId"`
+	ProofData  []byte `json:"proofData"`
+}
+
+// VerifyCertificateResponse is described in place by the API document
+type VerifyCertificateResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// TrackActivityRequest is the analytics.trackActivityRequest schema
+type TrackActivityRequest struct {
+	Metadata map[string]any `json:"metadata,omitempty"`
+	Type     string         `json:"type"`
+}
+
+// Status is the analytics.status schema
+type Status struct {
+	Status string `json:"status"`
+}
+
+// GetDailyMetricsParams are the query parameters of GetDailyMetrics
+type GetDailyMetricsParams struct {
+	Type string // Required
+	Date string
+}
+
+func (p GetDailyMetricsParams) values() url.Values {
+	q := make(url.Values)
+	if p.Type != "" {
+		q.Set("type", fmt.Sprint(p.Type))
+	}
+	if p.Date != "" {
+		q.Set("date", fmt.Sprint(p.Date))
+	}
+	return q
+}
+
+// DailyMetric is the analytics.DailyMetric schema
+type DailyMetric struct {
+	CreatedAt time.Time      `json:"createdAt"`
+	Date      time.Time      `json:"date"`
+	ID        int64          `json:"id"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Type      string         `json:"type"`
+	Value     float64        `json:"value"`
+}
+
+// GetUserEngagementParams are the query parameters of GetUserEngagement
+type GetUserEngagementParams struct {
+	StartDate string // Required
+	EndDate   string // Required
+}
+
+func (p GetUserEngagementParams) values() url.Values {
+	q := make(url.Values)
+	if p.StartDate != "" {
+		q.Set("startDate", fmt.Sprint(p.StartDate))
+	}
+	if p.EndDate != "" {
+		q.Set("endDate", fmt.Sprint(p.EndDate))
+	}
+	return q
+}
+
+// GenerateReportRequest is the analytics.generateReportRequest schema
+type GenerateReportRequest struct {
+	EndDate    string         `json:"endDate"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+	StartDate  string         `json:"startDate"`
+	Type       string         `json:"type"`
+}
+
+// Report is the analytics.Report schema
+type Report struct {
+	CreatedAt  time.Time      `json:"createdAt"`
+	Data       map[string]any `json:"data"`
+	EndDate    time.Time      `json:"endDate"`
+	ID         int64          `json:"id"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+	StartDate  time.Time      `json:"startDate"`
+	Type       string         `json:"type"`
+}
+
+// OrganizationRequest is the vws-backend.internal.handler.enterprise.Organization schema
+type OrganizationRequest struct {
+	ContactEmail string `json:"contact_email,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Domain       string `json:"domain,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// Organization is the enterprise.Organization schema
+type Organization struct {
+	ContactEmail string    `json:"contact_email"`
+	CreatedAt    time.Time `json:"created_at"`
+	CreatedBy    int64     `json:"created_by"`
+	Description  string    `json:"description"`
+	Domain       string    `json:"domain"`
+	ID           int64     `json:"id"`
+	LogoURL      string    `json:"logo_url"`
+	Name         string    `json:"name"`
+	Settings     any       `json:"settings"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	WebsiteURL   string    `json:"website_url"`
+}
+
+// UpdateOrganizationRequest is the enterprise.updateOrganizationRequest schema
+type UpdateOrganizationRequest struct {
+	ContactEmail string         `json:"contact_email,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	LogoURL      string         `json:"logo_url,omitempty"`
+	Name         string         `json:"name,omitempty"`
+	Settings     map[string]any `json:"settings,omitempty"`
+	WebsiteURL   string         `json:"website_url,omitempty"`
+}
+
+// APIKey is the enterprise.APIKey schema
+type APIKey struct {
+	CreatedAt      time.Time `json:"created_at"`
+	CreatedBy      int64     `json:"created_by"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	ID             int64     `json:"id"`
+	Key            string    `json:"key,omitempty"`
+	LastUsedAt     time.Time `json:"last_used_at"`
+	Name           string    `json:"name"`
+	OrganizationID int64     `json:"organization_id"`
+	RateLimit      int64     `json:"rate_limit"`
+	Scopes         []string  `json:"scopes"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CreateAPIKeyRequest is the enterprise.createAPIKeyRequest schema
+type CreateAPIKeyRequest struct {
+	ExpiresAt string   `json:"expires_at,omitempty"`
+	Name      string   `json:"name"`
+	RateLimit int64    `json:"rate_limit,omitempty"`
+	Scopes    []string `json:"scopes"`
+}
+
+// AddMemberRequest is the enterprise.addMemberRequest schema
+type AddMemberRequest struct {
+	Permissions map[string]bool `json:"permissions,omitempty"`
+	Role        string          `json:"role"`
+	UserID      int64           `json:"user_id"`
+}
+
+// Member is the enterprise.Member schema
+type Member struct {
+	CreatedAt      time.Time `json:"created_at"`
+	ID             int64     `json:"id"`
+	OrganizationID int64     `json:"organization_id"`
+	Permissions    any       `json:"permissions"`
+	Role           string    `json:"role"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	UserID         int64     `json:"user_id"`
+}
+
+// UpdateMemberPermissionsRequest is the enterprise.updateMemberPermissionsRequest schema
+type UpdateMemberPermissionsRequest struct {
+	Permissions map[string]bool `json:"permissions"`
+}
+
+// UpdateMemberRoleRequest is the enterprise.updateMemberRoleRequest schema
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// VotingSystem is the enterprise.VotingSystem schema
+type VotingSystem struct {
+	Active         bool      `json:"active"`
+	Config         any       `json:"config"`
+	CreatedAt      time.Time `json:"created_at"`
+	CreatedBy      int64     `json:"created_by"`
+	Description    string    `json:"description"`
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	OrganizationID int64     `json:"organization_id"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	VotingType     string    `json:"voting_type"`
+}
+
+// CreateVotingSystemRequest is the enterprise.createVotingSystemRequest schema
+type CreateVotingSystemRequest struct {
+	Config      map[string]any `json:"config,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Name        string         `json:"name"`
+	VotingType  string         `json:"voting_type"`
+}
+
+// WhiteLabelSettings is the enterprise.WhiteLabelSettings schema
+type WhiteLabelSettings struct {
+	CreatedAt      time.Time `json:"created_at"`
+	CustomCSS      string    `json:"custom_css"`
+	CustomJS       string    `json:"custom_js"`
+	Domain         string    `json:"domain"`
+	Enabled        bool      `json:"enabled"`
+	ID             int64     `json:"id"`
+	OrganizationID int64     `json:"organization_id"`
+	Settings       any       `json:"settings"`
+	ThemeConfig    any       `json:"theme_config"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// UpdateWhiteLabelRequest is the enterprise.updateWhiteLabelRequest schema
+type UpdateWhiteLabelRequest struct {
+	CustomCSS   string         `json:"custom_css,omitempty"`
+	CustomJS    string         `json:"custom_js,omitempty"`
+	Domain      string         `json:"domain,omitempty"`
+	Enabled     bool           `json:"enabled,omitempty"`
+	ThemeConfig map[string]any `json:"theme_config,omitempty"`
+}
+
+// SubmitVoteResponseRequest is the enterprise.submitVoteResponseRequest schema
+type SubmitVoteResponseRequest struct {
+	Response map[string]any `json:"response"`
+	Weight   float64        `json:"weight,omitempty"`
+}
+
+// VoteResponse is the enterprise.VoteResponse schema
+type VoteResponse struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        int64     `json:"id"`
+	Response  any       `json:"response"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    int64     `json:"user_id"`
+	VoteID    int64     `json:"vote_id"`
+	Weight    float64   `json:"weight"`
+}
+
+// CreateVoteRequest is the enterprise.createVoteRequest schema
+type CreateVoteRequest struct {
+	Description string         `json:"description,omitempty"`
+	EndDate     string         `json:"end_date"`
+	Options     map[string]any `json:"options"`
+	StartDate   string         `json:"start_date"`
+	Title       string         `json:"title"`
+}
+
+// Vote is the enterprise.Vote schema
+type Vote struct {
+	CreatedAt      time.Time `json:"created_at"`
+	CreatedBy      int64     `json:"created_by"`
+	Description    string    `json:"description"`
+	EndDate        time.Time `json:"end_date"`
+	ID             int64     `json:"id"`
+	Options        any       `json:"options"`
+	Result         any       `json:"result"`
+	StartDate      time.Time `json:"start_date"`
+	Status         string    `json:"status"`
+	Title          string    `json:"title"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	VotingSystemID int64     `json:"voting_system_id"`
+}
@@ -0,0 +1,229 @@
+// Package client calls the VWS API from Go. The types and methods for each
+// route are generated from the API's OpenAPI document; requests are
+// authenticated with a JWT or an organization API key, and retried with
+// backoff when the server is overloaded.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:generate go run ./internal/gen -o api.gen.go
+
+// Client calls the API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+	apiKey     string
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithToken authenticates requests with a JWT access token, as returned by
+// Login
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithAPIKey authenticates requests with an organization API key. Only
+// enterprise routes accept them.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetries sets how often a request is retried, and the bounds of the
+// backoff between attempts when the server doesn't say how long to wait
+func WithRetries(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.minBackoff, c.maxBackoff = retries, minBackoff, maxBackoff
+	}
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey returns a context whose requests carry key in the
+// Idempotency-Key header. The API answers a retried request with the
+// response to the first one instead of repeating it, so these requests are
+// also retried after server errors and while an earlier attempt is still
+// in progress. Use a new key, e.g. a random UUID, for every operation:
+//
+//	ctx = client.WithIdempotencyKey(ctx, uuid.NewString())
+//	txn, err := c.TransferTokens(ctx, client.TransferRequest{ToUserID: 2, Amount: 5})
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+func idempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key
+}
+
+// New returns a client for the API served at baseURL, e.g.
+// "https://vws.example.com"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme and host are required", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		retries:    3,
+		minBackoff: 200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// do sends a request with body encoded as JSON, unless it is nil, and
+// decodes a successful response into out, unless it is nil. Responses
+// with an error status are returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+	}
+
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, u.String(), payload)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil || resp.StatusCode == http.StatusNoContent {
+				return nil
+			}
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("decoding %s %s response: %w", method, path, err)
+			}
+			return nil
+		}
+
+		apiErr := readError(resp)
+		if attempt >= c.retries || !retryable(method, apiErr, idempotencyKey(ctx) != "") {
+			return apiErr
+		}
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			wait = c.backoff(attempt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return apiErr
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, target string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if key := idempotencyKey(ctx); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	return c.httpClient.Do(req)
+}
+
+// retryable reports whether a request that failed with err may be sent
+// again. Rate limited and unavailable requests weren't processed, so they
+// always may; other server errors only when repeating the request is safe,
+// as it is for requests with an idempotency key. Those also wait out an
+// earlier attempt still in progress.
+func retryable(method string, err *Error, keyed bool) bool {
+	switch err.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusConflict:
+		return keyed && err.Code == "idempotency_key_in_use"
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		if keyed {
+			return true
+		}
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as a date
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// backoff doubles the wait with every attempt, with jitter so clients
+// throttled together don't retry together
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.minBackoff
+	for i := 0; i < attempt && wait < c.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, c.maxBackoff)
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
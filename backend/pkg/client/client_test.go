@@ -0,0 +1,369 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/api/apitest"
+	"vws-backend/internal/apperr"
+	"vws-backend/internal/service/analytics"
+	"vws-backend/internal/service/enterprise"
+	"vws-backend/internal/service/token"
+	"vws-backend/internal/service/user"
+	"vws-backend/internal/service/verification"
+	"vws-backend/pkg/client"
+)
+
+// newServer serves the real API and returns a client for it without
+// credentials
+func newServer(t *testing.T) (*apitest.Server, *client.Client, string) {
+	t.Helper()
+	s := apitest.New(t)
+	srv := httptest.NewServer(s.Router)
+	t.Cleanup(srv.Close)
+
+	c, err := client.New(srv.URL)
+	require.NoError(t, err)
+	return s, c, srv.URL
+}
+
+// login registers a user and returns a client authenticated as them
+func login(t *testing.T, anonymous *client.Client, baseURL, name string) (*client.Client, *client.User) {
+	t.Helper()
+	ctx := context.Background()
+
+	u, err := anonymous.Register(ctx, client.RegisterRequest{Username: name, Email: name + "@example.com", Password: "password123"})
+	require.NoError(t, err)
+	session, err := anonymous.Login(ctx, client.LoginRequest{Email: name + "@example.com", Password: "password123"})
+	require.NoError(t, err)
+	c, err := client.New(baseURL, client.WithToken(session.AccessToken))
+	require.NoError(t, err)
+	return c, u
+}
+
+func TestUsersAndTokens(t *testing.T) {
+	s, anonymous, baseURL := newServer(t)
+	ctx := context.Background()
+	alice, aliceUser := login(t, anonymous, baseURL, "alice")
+	_, bobUser := login(t, anonymous, baseURL, "bob")
+
+	_, err := anonymous.Login(ctx, client.LoginRequest{Email: "alice@example.com", Password: "wrong"})
+	assert.ErrorIs(t, err, client.ErrInvalidCredentials)
+	assert.ErrorIs(t, err, client.ErrUnauthorized)
+	_, err = anonymous.GetProfile(ctx)
+	assert.ErrorIs(t, err, client.ErrUnauthorized)
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, "missing_token", apiErr.Code)
+
+	_, err = anonymous.Register(ctx, client.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	assert.ErrorIs(t, err, client.ErrUserExists)
+	assert.ErrorIs(t, err, client.ErrConflict)
+	_, err = anonymous.Register(ctx, client.RegisterRequest{Username: "carol", Email: "carol", Password: "short"})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "invalid_request", apiErr.Code)
+
+	profile, err := alice.GetProfile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", profile.Username)
+	require.NoError(t, alice.UpdatePoints(ctx, client.UpdatePointsRequest{Points: 100}))
+	_, err = alice.ConvertPoints(ctx, client.ConvertRequest{Points: 1000})
+	assert.ErrorIs(t, err, client.ErrInsufficientPoints)
+	assert.ErrorIs(t, err, client.ErrBadRequest)
+	leaders, err := anonymous.GetLeaderboard(ctx, client.GetLeaderboardParams{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, leaders, 1)
+	assert.Equal(t, aliceUser.ID, leaders[0].ID)
+
+	_, err = s.Tokens.AdjustBalance(ctx, aliceUser.ID, 100, "test funds", "test")
+	require.NoError(t, err)
+	stake, err := alice.StakeTokens(ctx, client.StakeRequest{Amount: 10, DurationDays: 30})
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, stake.Amount)
+	_, err = alice.StakeTokens(ctx, client.StakeRequest{Amount: 10, DurationDays: 30})
+	assert.ErrorIs(t, err, client.ErrAlreadyStaked)
+	assert.ErrorIs(t, err, client.ErrBadRequest)
+	_, err = alice.TransferTokens(ctx, client.TransferRequest{ToUserID: bobUser.ID, Amount: 1000})
+	assert.ErrorIs(t, err, client.ErrInsufficientBalance)
+
+	for range 4 {
+		_, err := alice.TransferTokens(ctx, client.TransferRequest{ToUserID: bobUser.ID, Amount: 1})
+		require.NoError(t, err)
+	}
+	balance, err := alice.GetBalance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 86.0, balance.Balance)
+
+	page, err := alice.GetTransactions(ctx, client.GetTransactionsParams{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, page.Transactions, 2)
+	assert.Equal(t, int64(2), page.Pagination.Limit)
+
+	var ids []int64
+	for txn, err := range alice.AllTransactions(ctx, client.GetTransactionsParams{Limit: 2}) {
+		require.NoError(t, err)
+		ids = append(ids, txn.ID)
+	}
+	assert.Len(t, ids, 6, "adjustment, stake and four transfers")
+	var skipped int
+	for range alice.AllTransactions(ctx, client.GetTransactionsParams{Limit: 4, Offset: 5}) {
+		skipped++
+	}
+	assert.Equal(t, 1, skipped)
+	for _, err := range anonymous.AllTransactions(ctx, client.GetTransactionsParams{}) {
+		assert.ErrorIs(t, err, client.ErrUnauthorized, "iteration stops at the first error")
+	}
+}
+
+func TestVerificationAndAnalytics(t *testing.T) {
+	_, anonymous, baseURL := newServer(t)
+	ctx := context.Background()
+	alice, aliceUser := login(t, anonymous, baseURL, "alice")
+	bob, _ := login(t, anonymous, baseURL, "bob")
+
+	cert, err := alice.VerifyVoteParticipation(ctx, client.VerifyRequest{ElectionID: "election-1", ProofData: []byte("proof")})
+	require.NoError(t, err)
+	got, err := alice.GetCertificate(ctx, cert.ID)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Hash, got.Hash)
+	_, err = bob.GetCertificate(ctx, cert.ID)
+	assert.ErrorIs(t, err, client.ErrForbidden)
+	certs, err := alice.GetUserCertificates(ctx)
+	require.NoError(t, err)
+	assert.Len(t, certs.Certificates, 1)
+
+	_, err = alice.TrackActivity(ctx, client.TrackActivityRequest{Type: "LOGIN", Metadata: map[string]any{"via": "sdk"}})
+	require.NoError(t, err)
+	metric, err := alice.GetDailyMetrics(ctx, client.GetDailyMetricsParams{Type: "NEW_USERS", Date: time.Now().Format(time.DateOnly)})
+	require.NoError(t, err)
+	assert.Equal(t, "NEW_USERS", metric.Type)
+	_, err = alice.GetDailyMetrics(ctx, client.GetDailyMetricsParams{Type: "BOGUS"})
+	assert.ErrorIs(t, err, client.ErrInvalidMetric)
+	_, err = alice.GetUserEngagement(ctx, aliceUser.ID, client.GetUserEngagementParams{StartDate: "2024-03-01", EndDate: "2024-03-31"})
+	require.NoError(t, err)
+	report, err := alice.GenerateReport(ctx, client.GenerateReportRequest{Type: "USER_GROWTH", StartDate: "2024-03-01", EndDate: "2024-03-31"})
+	require.NoError(t, err)
+	assert.Equal(t, "USER_GROWTH", report.Type)
+}
+
+func TestEnterpriseWithAPIKey(t *testing.T) {
+	_, anonymous, baseURL := newServer(t)
+	ctx := context.Background()
+	alice, _ := login(t, anonymous, baseURL, "alice")
+	_, bobUser := login(t, anonymous, baseURL, "bob")
+
+	org, err := alice.CreateOrganization(ctx, client.OrganizationRequest{Name: "Acme", ContactEmail: "ops@acme.test"})
+	require.NoError(t, err)
+	_, err = alice.AddMember(ctx, org.ID, client.AddMemberRequest{UserID: bobUser.ID, Role: "MEMBER"})
+	require.NoError(t, err)
+	_, err = alice.AddMember(ctx, org.ID, client.AddMemberRequest{UserID: bobUser.ID, Role: "MEMBER"})
+	assert.ErrorIs(t, err, client.ErrMemberExists)
+	require.NoError(t, alice.UpdateMemberRole(ctx, org.ID, bobUser.ID, client.UpdateMemberRoleRequest{Role: "ADMIN"}))
+
+	key, err := alice.CreateAPIKey(ctx, org.ID, client.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"READ"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, key.Key, "the plaintext is returned on creation")
+
+	partner, err := client.New(baseURL, client.WithAPIKey(key.Key))
+	require.NoError(t, err)
+	got, err := partner.GetOrganization(ctx, org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", got.Name)
+	_, err = partner.ListAPIKeys(ctx, org.ID)
+	assert.ErrorIs(t, err, client.ErrForbidden, "the key lacks the ADMIN scope")
+	keys, err := alice.ListAPIKeys(ctx, org.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Empty(t, keys[0].Key, "plaintexts are never listed")
+
+	require.NoError(t, alice.RevokeAPIKey(ctx, org.ID, key.ID))
+	_, err = partner.GetOrganization(ctx, org.ID)
+	assert.ErrorIs(t, err, client.ErrInvalidAPIKey)
+	_, err = alice.GetVoteResults(ctx, 404)
+	assert.ErrorIs(t, err, client.ErrVoteNotFound)
+	assert.ErrorIs(t, err, client.ErrNotFound)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	s, anonymous, baseURL := newServer(t)
+	ctx := context.Background()
+	alice, aliceUser := login(t, anonymous, baseURL, "alice")
+	_, bobUser := login(t, anonymous, baseURL, "bob")
+	_, err := s.Tokens.AdjustBalance(ctx, aliceUser.ID, 100, "test funds", "test")
+	require.NoError(t, err)
+
+	keyed := client.WithIdempotencyKey(ctx, "transfer-1")
+	first, err := alice.TransferTokens(keyed, client.TransferRequest{ToUserID: bobUser.ID, Amount: 5})
+	require.NoError(t, err)
+	retry, err := alice.TransferTokens(keyed, client.TransferRequest{ToUserID: bobUser.ID, Amount: 5})
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, retry.ID, "the retry is answered with the first transfer")
+	balance, err := alice.GetBalance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 95.0, balance.Balance)
+
+	_, err = alice.TransferTokens(keyed, client.TransferRequest{ToUserID: bobUser.ID, Amount: 6})
+	assert.ErrorIs(t, err, client.ErrIdempotencyKeyReused)
+
+	// Requests with a key are safe to retry after server errors
+	var keys []string
+	f := &flaky{failures: 1, status: http.StatusInternalServerError}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		f.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	c, err := client.New(srv.URL, client.WithRetries(3, time.Millisecond, 5*time.Millisecond))
+	require.NoError(t, err)
+	_, err = c.UnstakeTokens(client.WithIdempotencyKey(ctx, "unstake-1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"unstake-1", "unstake-1"}, keys)
+}
+
+func TestErrorsMirrorServices(t *testing.T) {
+	for clientErr, serviceErr := range map[error]*apperr.Error{
+		client.ErrUserExists:           user.ErrUserExists,
+		client.ErrInvalidCredentials:   user.ErrInvalidCredentials,
+		client.ErrInvalidRefreshToken:  user.ErrInvalidRefreshToken,
+		client.ErrRefreshTokenExpired:  user.ErrRefreshTokenExpired,
+		client.ErrRefreshTokenReused:   user.ErrRefreshTokenReused,
+		client.ErrSessionRevoked:       user.ErrSessionRevoked,
+		client.ErrSessionNotFound:      user.ErrSessionNotFound,
+		client.ErrUserNotFound:         user.ErrUserNotFound,
+		client.ErrInsufficientPoints:   token.ErrInsufficientPoints,
+		client.ErrInsufficientBalance:  token.ErrInsufficientBalance,
+		client.ErrInvalidAmount:        token.ErrInvalidAmount,
+		client.ErrInvalidStakePeriod:   token.ErrInvalidStakePeriod,
+		client.ErrAlreadyStaked:        token.ErrAlreadyStaked,
+		client.ErrNoStakedTokens:       token.ErrNoStakedTokens,
+		client.ErrStakePeriodActive:    token.ErrStakePeriodActive,
+		client.ErrCertificateExists:    verification.ErrCertificateExists,
+		client.ErrCertificateNotFound:  verification.ErrCertificateNotFound,
+		client.ErrInvalidDateRange:     analytics.ErrInvalidDateRange,
+		client.ErrInvalidMetric:        analytics.ErrInvalidMetric,
+		client.ErrInvalidActivity:      analytics.ErrInvalidActivity,
+		client.ErrOrganizationNotFound: enterprise.ErrOrganizationNotFound,
+		client.ErrMemberNotFound:       enterprise.ErrMemberNotFound,
+		client.ErrMemberExists:         enterprise.ErrMemberExists,
+		client.ErrLastOwner:            enterprise.ErrLastOwner,
+		client.ErrInvalidRole:          enterprise.ErrInvalidRole,
+		client.ErrVotingSystemNotFound: enterprise.ErrVotingSystemNotFound,
+		client.ErrInvalidVotingType:    enterprise.ErrInvalidVotingType,
+		client.ErrVoteNotFound:         enterprise.ErrVoteNotFound,
+		client.ErrVoteExpired:          enterprise.ErrVoteExpired,
+		client.ErrVoteAlreadySubmitted: enterprise.ErrVoteAlreadySubmitted,
+		client.ErrInvalidScope:         enterprise.ErrInvalidScope,
+		client.ErrInvalidAPIKey:        enterprise.ErrInvalidAPIKey,
+		client.ErrAPIKeyExpired:        enterprise.ErrAPIKeyExpired,
+		client.ErrAPIKeyNotFound:       enterprise.ErrAPIKeyNotFound,
+	} {
+		assert.Equal(t, serviceErr.Error(), clientErr.Error())
+		assert.ErrorIs(t, &client.Error{Code: serviceErr.Code}, clientErr, serviceErr.Code)
+	}
+}
+
+// flaky fails the first requests it serves with status
+type flaky struct {
+	failures   int32
+	status     int
+	retryAfter string
+	calls      atomic.Int32
+}
+
+func (f *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.calls.Add(1) <= f.failures {
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(f.status)
+		w.Write([]byte(`{"error":"try again"}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"id":1,"balance":5}`))
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		method     string
+		status     int
+		failures   int32
+		retryAfter string
+		calls      int32
+		err        error
+	}{
+		"rate limited":        {http.MethodPost, http.StatusTooManyRequests, 2, "0", 3, nil},
+		"unavailable":         {http.MethodPost, http.StatusServiceUnavailable, 1, "", 2, nil},
+		"idempotent error":    {http.MethodGet, http.StatusBadGateway, 2, "", 3, nil},
+		"non-idempotent":      {http.MethodPost, http.StatusInternalServerError, 1, "", 1, client.ErrServer},
+		"gives up":            {http.MethodGet, http.StatusTooManyRequests, 10, "0", 4, client.ErrRateLimited},
+		"client error":        {http.MethodGet, http.StatusBadRequest, 1, "", 1, client.ErrBadRequest},
+		"not implemented":     {http.MethodGet, http.StatusNotImplemented, 1, "", 1, client.ErrServer},
+		"retry after a date":  {http.MethodGet, http.StatusTooManyRequests, 1, time.Now().Add(-time.Second).UTC().Format(http.TimeFormat), 2, nil},
+		"invalid retry after": {http.MethodGet, http.StatusTooManyRequests, 1, "soon", 2, nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := &flaky{failures: tc.failures, status: tc.status, retryAfter: tc.retryAfter}
+			srv := httptest.NewServer(f)
+			defer srv.Close()
+			c, err := client.New(srv.URL, client.WithRetries(3, time.Millisecond, 5*time.Millisecond))
+			require.NoError(t, err)
+
+			if tc.method == http.MethodGet {
+				_, err = c.GetBalance(ctx)
+			} else {
+				_, err = c.UnstakeTokens(ctx)
+			}
+			if tc.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.err)
+			}
+			assert.Equal(t, tc.calls, f.calls.Load())
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	f := &flaky{failures: 1, status: http.StatusTooManyRequests, retryAfter: "1"}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c, err := client.New(srv.URL, client.WithRetries(1, time.Millisecond, time.Millisecond))
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = c.GetBalance(context.Background())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second, "the server's wait overrides the backoff")
+
+	f = &flaky{failures: 1, status: http.StatusTooManyRequests, retryAfter: "60"}
+	srv2 := httptest.NewServer(f)
+	defer srv2.Close()
+	c, err = client.New(srv2.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.GetBalance(ctx)
+	assert.ErrorIs(t, err, client.ErrRateLimited, "waiting ends with the context")
+	assert.True(t, errors.Is(ctx.Err(), context.DeadlineExceeded))
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "localhost:8080", "://"} {
+		_, err := client.New(baseURL)
+		assert.Error(t, err, baseURL)
+	}
+	_, err := client.New("https://vws.example.com/")
+	assert.NoError(t, err)
+}
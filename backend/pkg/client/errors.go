@@ -0,0 +1,179 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Errors the API responds with. They mirror the errors of the services
+// behind it, e.g. ErrInsufficientBalance is token.ErrInsufficientBalance,
+// and are matched with errors.Is:
+//
+//	if errors.Is(err, client.ErrInsufficientBalance) { ... }
+var (
+	// Users
+	ErrUserExists          = errors.New("username or email already taken")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrUserNotFound        = errors.New("user not found")
+
+	// Tokens
+	ErrInsufficientPoints  = errors.New("insufficient points")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrInvalidStakePeriod  = errors.New("invalid stake period")
+	ErrAlreadyStaked       = errors.New("tokens already staked")
+	ErrNoStakedTokens      = errors.New("no staked tokens")
+	ErrStakePeriodActive   = errors.New("stake period still active")
+
+	// Verification
+	ErrCertificateExists   = errors.New("verification already exists")
+	ErrCertificateNotFound = errors.New("certificate not found")
+
+	// Analytics and enterprise
+	ErrInvalidDateRange = errors.New("invalid date range")
+	ErrInvalidMetric    = errors.New("invalid metric type")
+	ErrInvalidActivity  = errors.New("invalid activity type")
+
+	// Enterprise
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrMemberNotFound       = errors.New("member not found")
+	ErrMemberExists         = errors.New("user is already a member")
+	ErrLastOwner            = errors.New("organization must keep at least one owner")
+	ErrInvalidRole          = errors.New("invalid role")
+	ErrVotingSystemNotFound = errors.New("voting system not found")
+	ErrInvalidVotingType    = errors.New("invalid voting type")
+	ErrVoteNotFound         = errors.New("vote not found")
+	ErrVoteExpired          = errors.New("vote has expired")
+	ErrVoteAlreadySubmitted = errors.New("vote already submitted")
+	ErrInvalidScope         = errors.New("invalid API key scope")
+	ErrInvalidAPIKey        = errors.New("invalid API key")
+	ErrAPIKeyExpired        = errors.New("API key has expired")
+	ErrAPIKeyNotFound       = errors.New("API key not found")
+
+	// Idempotency keys
+	ErrIdempotencyKeyInUse  = errors.New("a request with this idempotency key is in progress")
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+)
+
+// Errors for classes of status, for errors the API doesn't name
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// sentinels finds the named errors by the code the API sends with them
+var sentinels = map[string]error{
+	"user_exists":             ErrUserExists,
+	"invalid_credentials":     ErrInvalidCredentials,
+	"invalid_refresh_token":   ErrInvalidRefreshToken,
+	"refresh_token_expired":   ErrRefreshTokenExpired,
+	"refresh_token_reused":    ErrRefreshTokenReused,
+	"session_revoked":         ErrSessionRevoked,
+	"session_not_found":       ErrSessionNotFound,
+	"user_not_found":          ErrUserNotFound,
+	"insufficient_points":     ErrInsufficientPoints,
+	"insufficient_balance":    ErrInsufficientBalance,
+	"invalid_amount":          ErrInvalidAmount,
+	"invalid_stake_period":    ErrInvalidStakePeriod,
+	"already_staked":          ErrAlreadyStaked,
+	"no_staked_tokens":        ErrNoStakedTokens,
+	"stake_period_active":     ErrStakePeriodActive,
+	"certificate_exists":      ErrCertificateExists,
+	"certificate_not_found":   ErrCertificateNotFound,
+	"invalid_date_range":      ErrInvalidDateRange,
+	"invalid_metric":          ErrInvalidMetric,
+	"invalid_activity":        ErrInvalidActivity,
+	"organization_not_found":  ErrOrganizationNotFound,
+	"member_not_found":        ErrMemberNotFound,
+	"member_exists":           ErrMemberExists,
+	"last_owner":              ErrLastOwner,
+	"invalid_role":            ErrInvalidRole,
+	"voting_system_not_found": ErrVotingSystemNotFound,
+	"invalid_voting_type":     ErrInvalidVotingType,
+	"vote_not_found":          ErrVoteNotFound,
+	"vote_expired":            ErrVoteExpired,
+	"vote_already_submitted":  ErrVoteAlreadySubmitted,
+	"invalid_scope":           ErrInvalidScope,
+	"invalid_api_key":         ErrInvalidAPIKey,
+	"api_key_expired":         ErrAPIKeyExpired,
+	"api_key_not_found":       ErrAPIKeyNotFound,
+	"idempotency_key_in_use":  ErrIdempotencyKeyInUse,
+	"idempotency_key_reused":  ErrIdempotencyKeyReused,
+}
+
+// Error is a response with an error status
+type Error struct {
+	StatusCode int
+	Code       string            // Identifies the error, e.g. "vote_not_found"
+	Message    string            // As sent by the API, or the status text
+	Details    map[string]string // Problems with individual fields
+	RequestID  string            // Quote it when reporting a problem
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("vws: %d %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns the named error the code matches, if any, and the error
+// for the class of the status
+func (e *Error) Unwrap() []error {
+	var errs []error
+	if err, ok := sentinels[e.Code]; ok {
+		errs = append(errs, err)
+	}
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		errs = append(errs, ErrBadRequest)
+	case http.StatusUnauthorized:
+		errs = append(errs, ErrUnauthorized)
+	case http.StatusForbidden:
+		errs = append(errs, ErrForbidden)
+	case http.StatusNotFound:
+		errs = append(errs, ErrNotFound)
+	case http.StatusConflict:
+		errs = append(errs, ErrConflict)
+	case http.StatusTooManyRequests:
+		errs = append(errs, ErrRateLimited)
+	default:
+		if e.StatusCode >= 500 {
+			errs = append(errs, ErrServer)
+		}
+	}
+	return errs
+}
+
+// readError reads the error from a response and closes its body
+func readError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+
+	e := &Error{StatusCode: resp.StatusCode}
+	var body struct {
+		Error     string            `json:"error"`
+		Code      string            `json:"code"`
+		Details   map[string]string `json:"details"`
+		RequestID string            `json:"request_id"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err == nil {
+		e.Message, e.Code, e.Details, e.RequestID = body.Error, body.Code, body.Details, body.RequestID
+	}
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
@@ -0,0 +1,532 @@
+// Command gen writes the types and methods of the client from the API
+// document, so the client can't drift from the handlers. Run it with
+// go generate in pkg/client.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+
+	"vws-backend/internal/api"
+	"vws-backend/internal/openapi"
+)
+
+// tags are the parts of the API the client covers
+var tags = []string{"users", "tokens", "verification", "analytics", "enterprise"}
+
+func main() {
+	out := flag.String("o", "api.gen.go", "file to write")
+	flag.Parse()
+	gin.SetMode(gin.ReleaseMode)
+
+	doc, err := api.Document()
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := generate(doc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// operation is an operation of the document and where it is served
+type operation struct {
+	*openapi.Operation
+	method, path string
+}
+
+// generator writes Go declarations for the operations of a document
+type generator struct {
+	doc     *openapi.Document
+	names   map[string]string // Go type names by component name
+	emitted map[string]bool
+	imports map[string]bool
+	types   bytes.Buffer
+	methods bytes.Buffer
+}
+
+// generate returns the formatted source of the client's types and methods
+func generate(doc *openapi.Document) ([]byte, error) {
+	g := &generator{
+		doc:     doc,
+		emitted: make(map[string]bool),
+		imports: map[string]bool{"context": true, "net/http": true},
+	}
+	ops := g.operations()
+	if err := g.name(ops); err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if err := g.method(op); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op.method, op.path, err)
+		}
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by go run ./internal/gen; DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	imports := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	src.WriteString(")\n")
+	src.Write(g.methods.Bytes())
+	src.Write(g.types.Bytes())
+	return format.Source(src.Bytes())
+}
+
+// operations lists the operations the client covers, grouped by tag
+func (g *generator) operations() []operation {
+	var ops []operation
+	for path, item := range g.doc.Paths {
+		for method, op := range item {
+			if len(op.Tags) == 1 && slices.Contains(tags, op.Tags[0]) {
+				ops = append(ops, operation{Operation: op, method: strings.ToUpper(method), path: path})
+			}
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		ti, tj := slices.Index(tags, ops[i].Tags[0]), slices.Index(tags, ops[j].Tags[0])
+		if ti != tj {
+			return ti < tj
+		}
+		if ops[i].path != ops[j].path {
+			return ops[i].path < ops[j].path
+		}
+		return ops[i].method < ops[j].method
+	})
+	return ops
+}
+
+// name chooses Go names for the components the operations use. Components
+// are named after their type; when two share a name, the one only sent in
+// requests gets a Request suffix.
+func (g *generator) name(ops []operation) error {
+	inRequest := make(map[string]bool)
+	inResponse := make(map[string]bool)
+	for _, op := range ops {
+		if body := op.RequestBody; body != nil {
+			for _, media := range body.Content {
+				g.refs(media.Schema, inRequest)
+			}
+		}
+		for _, resp := range op.Responses {
+			for _, media := range resp.Content {
+				g.refs(media.Schema, inResponse)
+			}
+		}
+	}
+
+	byName := make(map[string][]string)
+	for component := range g.doc.Components.Schemas {
+		if inRequest[component] || inResponse[component] {
+			name := exported(component[strings.LastIndex(component, ".")+1:])
+			byName[name] = append(byName[name], component)
+		}
+	}
+	g.names = make(map[string]string)
+	taken := make(map[string]string)
+	for name, components := range byName {
+		for _, component := range components {
+			goName := name
+			if len(components) > 1 && !inResponse[component] {
+				goName += "Request"
+			}
+			if other, ok := taken[goName]; ok {
+				return fmt.Errorf("%s and %s are both named %s", other, component, goName)
+			}
+			taken[goName] = component
+			g.names[component] = goName
+		}
+	}
+	return nil
+}
+
+// refs collects the components a schema refers to, directly or not
+func (g *generator) refs(s *openapi.Schema, seen map[string]bool) {
+	if s == nil {
+		return
+	}
+	if s.Ref != "" {
+		component := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		if !seen[component] {
+			seen[component] = true
+			g.refs(g.doc.Components.Schemas[component], seen)
+		}
+		return
+	}
+	for _, sub := range s.AllOf {
+		g.refs(sub, seen)
+	}
+	for _, prop := range s.Properties {
+		g.refs(prop, seen)
+	}
+	if extra, ok := s.AdditionalProperties.(*openapi.Schema); ok {
+		g.refs(extra, seen)
+	}
+	g.refs(s.Items, seen)
+}
+
+// method writes the method calling an operation, the type of its query
+// parameters, and an iterator when the operation is paginated
+func (g *generator) method(op operation) error {
+	if op.OperationID == "" {
+		return fmt.Errorf("operation has no ID")
+	}
+	name := exported(op.OperationID)
+
+	args := []string{"ctx context.Context"}
+	var pathArgs []string
+	var pathParams []*openapi.Parameter
+	var queryParams []*openapi.Parameter
+	for _, p := range op.Parameters {
+		if p.In == openapi.InPath {
+			pathParams = append(pathParams, p)
+		} else {
+			queryParams = append(queryParams, p)
+		}
+	}
+	path := op.path
+	for _, p := range pathParams {
+		arg := unexported(p.Name)
+		verb, value := "%s", "url.PathEscape("+arg+")"
+		if p.Schema.Type == "integer" {
+			verb, value = "%d", arg
+		} else {
+			g.imports["net/url"] = true
+		}
+		args = append(args, arg+" "+g.goType(p.Schema, ""))
+		path = strings.Replace(path, "{"+p.Name+"}", verb, 1)
+		pathArgs = append(pathArgs, value)
+	}
+	pathExpr := fmt.Sprintf("%q", path)
+	if len(pathArgs) > 0 {
+		g.imports["fmt"] = true
+		pathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", path, strings.Join(pathArgs, ", "))
+	}
+
+	values := "nil"
+	if len(queryParams) > 0 {
+		paramsType := name + "Params"
+		g.params(paramsType, queryParams)
+		args = append(args, "params "+paramsType)
+		values = "params.values()"
+	}
+
+	body := "nil"
+	if op.RequestBody != nil {
+		media, ok := op.RequestBody.Content["application/json"]
+		if !ok {
+			return fmt.Errorf("only JSON request bodies are supported")
+		}
+		args = append(args, "body "+g.goType(media.Schema, name+"Request"))
+		body = "body"
+	}
+
+	// The result is the body of the first success status
+	var success *openapi.Response
+	for status := http.StatusOK; status < 300 && success == nil; status++ {
+		success = op.Responses[strconv.Itoa(status)]
+	}
+	result := ""
+	if success != nil {
+		if media, ok := success.Content["application/json"]; ok {
+			result = g.goType(media.Schema, name+"Response")
+		}
+	}
+
+	fmt.Fprintf(&g.methods, "\n// %s calls %s %s: %s\n", name, op.method, op.path, sentence(op.Summary))
+	switch {
+	case result == "":
+		fmt.Fprintf(&g.methods, "func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+		fmt.Fprintf(&g.methods, "\treturn c.do(ctx, %s, %s, %s, %s, nil)\n}\n", httpMethod(op.method), pathExpr, values, body)
+	case isReference(result):
+		fmt.Fprintf(&g.methods, "func (c *Client) %s(%s) (*%s, error) {\n", name, strings.Join(args, ", "), result)
+		fmt.Fprintf(&g.methods, "\tvar out %s\n", result)
+		fmt.Fprintf(&g.methods, "\tif err := c.do(ctx, %s, %s, %s, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n", httpMethod(op.method), pathExpr, values, body)
+		fmt.Fprintf(&g.methods, "\treturn &out, nil\n}\n")
+	default:
+		fmt.Fprintf(&g.methods, "func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), result)
+		fmt.Fprintf(&g.methods, "\tvar out %s\n", result)
+		fmt.Fprintf(&g.methods, "\tif err := c.do(ctx, %s, %s, %s, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n", httpMethod(op.method), pathExpr, values, body)
+		fmt.Fprintf(&g.methods, "\treturn out, nil\n}\n")
+	}
+
+	g.iterator(op, name, args, queryParams)
+	return nil
+}
+
+// iterator writes an iterator over every page of an operation taking
+// limit and offset parameters and responding with one list
+func (g *generator) iterator(op operation, name string, args []string, params []*openapi.Parameter) {
+	var limit, offset bool
+	for _, p := range params {
+		limit = limit || p.Name == "limit"
+		offset = offset || p.Name == "offset"
+	}
+	if !limit || !offset {
+		return
+	}
+	var page *openapi.Schema
+	for code, resp := range op.Responses {
+		if code == "200" {
+			page = resp.Content["application/json"].Schema
+		}
+	}
+	if page == nil || len(page.Properties) == 0 {
+		return
+	}
+	var list string
+	for prop, s := range page.Properties {
+		if s.Type == "array" {
+			if list != "" {
+				return
+			}
+			list = prop
+		}
+	}
+	if list == "" {
+		return
+	}
+
+	item := g.goType(page.Properties[list].Items, name+"Item")
+	all := "All" + strings.TrimPrefix(strings.TrimPrefix(name, "Get"), "List")
+	g.imports["iter"] = true
+	fmt.Fprintf(&g.methods, "\n// %s iterates over every page of %s, starting at params.Offset\n", all, name)
+	fmt.Fprintf(&g.methods, "func (c *Client) %s(%s) iter.Seq2[%s, error] {\n", all, strings.Join(args, ", "), item)
+	fmt.Fprintf(&g.methods, "\treturn paginate(params.Limit, params.Offset, func(limit, offset int64) ([]%s, error) {\n", item)
+	fmt.Fprintf(&g.methods, "\t\tparams.Limit, params.Offset = limit, offset\n")
+	callArgs := []string{"ctx"}
+	for _, arg := range args[1:] {
+		callArgs = append(callArgs, strings.Fields(arg)[0])
+	}
+	fmt.Fprintf(&g.methods, "\t\tpage, err := c.%s(%s)\n", name, strings.Join(callArgs, ", "))
+	fmt.Fprintf(&g.methods, "\t\tif err != nil {\n\t\t\treturn nil, err\n\t\t}\n")
+	fmt.Fprintf(&g.methods, "\t\treturn page.%s, nil\n\t})\n}\n", exported(list))
+}
+
+// params writes the type holding the query parameters of an operation.
+// Parameters with zero values are left out of the query.
+func (g *generator) params(typ string, params []*openapi.Parameter) {
+	g.imports["fmt"] = true
+	g.imports["net/url"] = true
+	fmt.Fprintf(&g.types, "\n// %s are the query parameters of %s\ntype %s struct {\n", typ, strings.TrimSuffix(typ, "Params"), typ)
+	for _, p := range params {
+		comment := ""
+		if p.Required {
+			comment = " // Required"
+		}
+		fmt.Fprintf(&g.types, "\t%s %s%s\n", exported(p.Name), g.goType(p.Schema, ""), comment)
+	}
+	fmt.Fprintf(&g.types, "}\n\nfunc (p %s) values() url.Values {\n\tq := make(url.Values)\n", typ)
+	for _, p := range params {
+		field := "p." + exported(p.Name)
+		zero := field + " != 0"
+		switch p.Schema.Type {
+		case "string", "":
+			zero = field + ` != ""`
+		case "boolean":
+			zero = field
+		}
+		fmt.Fprintf(&g.types, "\tif %s {\n\t\tq.Set(%q, fmt.Sprint(%s))\n\t}\n", zero, p.Name, field)
+	}
+	fmt.Fprintf(&g.types, "\treturn q\n}\n")
+}
+
+// goType returns the Go type of values matching a schema, writing the
+// declarations of the types it needs. Objects described in place are
+// declared under the name given.
+func (g *generator) goType(s *openapi.Schema, name string) string {
+	if s.Ref != "" {
+		component := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		goName := g.names[component]
+		if !g.emitted[component] {
+			g.emitted[component] = true
+			g.object(goName, component, g.doc.Components.Schemas[component])
+		}
+		return goName
+	}
+	if len(s.AllOf) == 1 {
+		return nullable(s, g.goType(s.AllOf[0], name))
+	}
+
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.imports["time"] = true
+			return nullable(s, "time.Time")
+		case "byte":
+			return "[]byte"
+		}
+		return nullable(s, "string")
+	case "integer":
+		if s.Format == "int32" {
+			return nullable(s, "int32")
+		}
+		return nullable(s, "int64")
+	case "number":
+		if s.Format == "float" {
+			return nullable(s, "float32")
+		}
+		return nullable(s, "float64")
+	case "boolean":
+		return nullable(s, "bool")
+	case "array":
+		return "[]" + g.goType(s.Items, name+"Item")
+	case "object":
+		if len(s.Properties) > 0 {
+			g.object(name, "", s)
+			return nullable(s, name)
+		}
+		if extra, ok := s.AdditionalProperties.(*openapi.Schema); ok {
+			return "map[string]" + g.goType(extra, name+"Value")
+		}
+	}
+	return "any"
+}
+
+// object writes a struct type for an object schema
+func (g *generator) object(name, component string, s *openapi.Schema) {
+	props := make([]string, 0, len(s.Properties))
+	for prop := range s.Properties {
+		props = append(props, prop)
+	}
+	sort.Strings(props)
+
+	var fields bytes.Buffer
+	for _, prop := range props {
+		schema := s.Properties[prop]
+		field := exported(prop)
+		tag := prop
+		if !slices.Contains(s.Required, prop) {
+			tag += ",omitempty"
+		}
+		comment := ""
+		if len(schema.Enum) > 0 {
+			values := make([]string, len(schema.Enum))
+			for i, v := range schema.Enum {
+				values[i] = fmt.Sprint(v)
+			}
+			comment = " // One of " + strings.Join(values, ", ")
+		}
+		fmt.Fprintf(&fields, "\t%s %s `json:%q`%s\n", field, g.goType(schema, name+field), tag, comment)
+	}
+
+	if component != "" {
+		fmt.Fprintf(&g.types, "\n// %s is the %s schema\n", name, component)
+	} else {
+		fmt.Fprintf(&g.types, "\n// %s is described in place by the API document\n", name)
+	}
+	fmt.Fprintf(&g.types, "type %s struct {\n%s}\n", name, fields.Bytes())
+}
+
+// nullable makes a type a pointer when the schema allows null, unless
+// its zero value already encodes as null
+func nullable(s *openapi.Schema, typ string) string {
+	if !s.Nullable || strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") || strings.HasPrefix(typ, "*") {
+		return typ
+	}
+	return "*" + typ
+}
+
+// isReference reports whether values of a type are returned by pointer
+func isReference(typ string) bool {
+	return !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") && !strings.HasPrefix(typ, "*") && typ != "any"
+}
+
+func httpMethod(method string) string {
+	switch method {
+	case http.MethodGet:
+		return "http.MethodGet"
+	case http.MethodPost:
+		return "http.MethodPost"
+	case http.MethodPut:
+		return "http.MethodPut"
+	case http.MethodPatch:
+		return "http.MethodPatch"
+	case http.MethodDelete:
+		return "http.MethodDelete"
+	}
+	return fmt.Sprintf("%q", method)
+}
+
+// initialisms are written in upper case in Go names
+var initialisms = map[string]bool{
+	"API": true, "CSS": true, "ID": true, "IP": true, "JS": true, "JSON": true, "JWT": true, "URL": true, "UUID": true,
+}
+
+// exported turns a JSON or operation name such as "current_session",
+// "toUserId" or "listAPIKeys" into a Go name, e.g. "ListAPIKeys"
+func exported(name string) string {
+	var b strings.Builder
+	for _, word := range words(name) {
+		if upper := strings.ToUpper(word); initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// unexported is exported with the first word in lower case
+func unexported(name string) string {
+	w := words(name)
+	first := strings.ToLower(w[0])
+	return first + strings.TrimPrefix(exported(name), exported(w[0]))
+}
+
+// words splits a name at underscores, dashes and the start of capitalised
+// words. A run of capitals is one word.
+func words(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		split := i == len(runes) || runes[i] == '_' || runes[i] == '-'
+		if !split && i > start && unicode.IsUpper(runes[i]) {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+		if split {
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return words
+}
+
+// sentence lower cases the first letter of a summary to follow a colon,
+// unless it starts with an acronym
+func sentence(summary string) string {
+	first, _, _ := strings.Cut(summary, " ")
+	if len(first) < 2 || strings.ToUpper(first) == first {
+		return summary
+	}
+	return strings.ToLower(summary[:1]) + summary[1:]
+}
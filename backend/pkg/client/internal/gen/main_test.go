@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vws-backend/internal/api"
+)
+
+func TestGeneratedCodeIsCurrent(t *testing.T) {
+	doc, err := api.Document()
+	require.NoError(t, err)
+	want, err := generate(doc)
+	require.NoError(t, err)
+
+	got, err := os.ReadFile("../../api.gen.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got), "run go generate ./pkg/client after changing routes")
+}
+
+func TestNames(t *testing.T) {
+	for name, want := range map[string]string{
+		"current_session": "CurrentSession",
+		"toUserId":        "ToUserID",
+		"listAPIKeys":     "ListAPIKeys",
+		"userID":          "UserID",
+		"custom_css":      "CustomCSS",
+		"api-keys":        "APIKeys",
+		"getHTTPStatus":   "GetHTTPStatus",
+	} {
+		assert.Equal(t, want, exported(name), name)
+	}
+	assert.Equal(t, "keyID", unexported("keyId"))
+	assert.Equal(t, "apiKey", unexported("APIKey"))
+	assert.Equal(t, "id", unexported("id"))
+}
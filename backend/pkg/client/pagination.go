@@ -0,0 +1,34 @@
+package client
+
+import "iter"
+
+// DefaultPageSize is the number of items iterators fetch per request when
+// no limit is given
+const DefaultPageSize = 50
+
+// paginate yields the items of the pages fetch returns, from offset on,
+// until a page comes back short. Iteration stops at the first error.
+func paginate[T any](limit, offset int64, fetch func(limit, offset int64) ([]T, error)) iter.Seq2[T, error] {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	return func(yield func(T, error) bool) {
+		for {
+			page, err := fetch(limit, offset)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range page {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if int64(len(page)) < limit {
+				return
+			}
+			offset += int64(len(page))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+#!/bin/sh
+# fetch.sh downloads the files listed in a manifest into a directory and
+# checks each against its pinned checksum. Files already there with the
+# right checksum are kept.
+#
+# usage: scripts/fetch.sh MANIFEST DIR
+#
+# Each line of the manifest reads "NAME ALGO:HASH URL", ALGO being md5 or
+# sha256. Blank lines and lines starting with # are skipped. A file no
+# checksum is published for reads "NAME unpinned URL": it is refused, unless
+# ALLOW_UNPINNED=1 is set for local development, when it is fetched with a
+# warning giving its sha256, to be checked and pinned. Images are never
+# built with it set.
+set -eu
+
+if [ $# -ne 2 ]; then
+	echo "usage: $0 MANIFEST DIR" >&2
+	exit 2
+fi
+manifest=$1
+dir=$2
+mkdir -p "$dir"
+
+# matches FILE ALGO HASH succeeds if FILE has the checksum HASH
+matches() {
+	[ "$("${2}sum" "$1" | cut -d ' ' -f 1)" = "$3" ]
+}
+
+while read -r name checksum url; do
+	case $name in
+	'' | '#'*) continue ;;
+	esac
+	path=$dir/$name
+	if [ "$checksum" = unpinned ]; then
+		if [ "${ALLOW_UNPINNED:-}" != 1 ]; then
+			echo "$manifest: $name is not pinned, refusing $url (set ALLOW_UNPINNED=1 to fetch it for local development)" >&2
+			exit 1
+		fi
+		if [ ! -f "$path" ]; then
+			echo "Fetching $name..."
+			curl -fsSL --retry 3 -o "$path.part" "$url"
+			mv "$path.part" "$path"
+		fi
+		echo "warning: $name is not pinned, its sha256 is $(sha256sum "$path" | cut -d ' ' -f 1)" >&2
+		continue
+	fi
+	algo=${checksum%%:*}
+	hash=${checksum#*:}
+	case $algo in
+	md5 | sha256) ;;
+	*)
+		echo "$manifest: $name: unknown checksum $checksum" >&2
+		exit 1
+		;;
+	esac
+
+	if [ -f "$path" ] && matches "$path" "$algo" "$hash"; then
+		continue
+	fi
+	rm -f "$path"
+	echo "Fetching $name..."
+	curl -fsSL --retry 3 -o "$path.part" "$url"
+	if ! matches "$path.part" "$algo" "$hash"; then
+		echo "$name: $algo checksum is not $hash, refusing $url" >&2
+		rm -f "$path.part"
+		exit 1
+	fi
+	mv "$path.part" "$path"
+done <"$manifest"